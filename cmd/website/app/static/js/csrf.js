@@ -0,0 +1,37 @@
+/*
+ * Attaches the CSRF token cookie to HTMX requests and regular form posts.
+ * See cmd/website/internal/csrf.
+ */
+(() => {
+   const cookieName = "csrf_token";
+   const headerName = "X-CSRF-Token";
+   const fieldName = "csrf_token";
+
+   const getToken = () => {
+      const match = document.cookie.split("; ").find((c) => c.startsWith(`${cookieName}=`));
+      return match ? decodeURIComponent(match.substring(cookieName.length + 1)) : "";
+   };
+
+   document.addEventListener("htmx:configRequest", (e) => {
+      e.detail.headers[headerName] = getToken();
+   });
+
+   document.addEventListener("submit", (e) => {
+      const form = e.target;
+
+      if (!(form instanceof HTMLFormElement) || form.method.toLowerCase() === "get") {
+         return;
+      }
+
+      let input = form.querySelector(`input[name="${fieldName}"]`);
+
+      if (!input) {
+         input = document.createElement("input");
+         input.type = "hidden";
+         input.name = fieldName;
+         form.appendChild(input);
+      }
+
+      input.value = getToken();
+   });
+})();
@@ -0,0 +1,8 @@
+document.addEventListener("DOMContentLoaded", () => {
+   /*
+    * Photos loaded while scrolling need to be added to the lightbox
+    */
+   htmx.on("htmx:afterSettle", () => {
+      refreshFsLightbox();
+   });
+});
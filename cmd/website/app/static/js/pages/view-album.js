@@ -1,3 +1,5 @@
+let urlRefreshTimer = null;
+
 document.addEventListener("DOMContentLoaded", () => {
    const slideshowTime = 5000;
 
@@ -6,12 +8,77 @@ document.addEventListener("DOMContentLoaded", () => {
       fsLightbox.props.disableBackgroundClose = true;
    }
 
+   scheduleUrlRefresh();
+
    htmx.on("htmx:afterSettle", () => {
       refreshFsLightbox();
+      scheduleUrlRefresh();
 
       if (fsLightbox) {
          fsLightbox.props.slideshowTime = slideshowTime;
          fsLightbox.props.disableBackgroundClose = true;
       }
    });
+
+   // Clear a comment form once its comment is saved
+   htmx.on("htmx:afterRequest", (e) => {
+      if (e.detail.successful && e.detail.elt.matches("form.comment-form")) {
+         e.detail.elt.reset();
+      }
+   });
+
+   // The album's favorite limit has been reached. The server explains why.
+   htmx.on("htmx:responseError", (e) => {
+      if (e.detail.xhr.status === 409) {
+         alert(e.detail.xhr.responseText);
+      }
+   });
 });
+
+/*
+ * Thumbnail URLs are presigned and expire. Before they do, fresh URLs are
+ * fetched for the album and swapped in for thumbnails that haven't loaded
+ * yet, so a gallery left open keeps working. Thumbnails already on screen
+ * are left alone to avoid downloading them again.
+ */
+function scheduleUrlRefresh() {
+   clearTimeout(urlRefreshTimer);
+
+   const gallery = document.querySelector(".gallery[data-url-refresh-seconds]");
+   const seconds = gallery ? parseInt(gallery.dataset.urlRefreshSeconds, 10) : 0;
+
+   if (!seconds) {
+      return;
+   }
+
+   urlRefreshTimer = setTimeout(() => refreshUrls(gallery), seconds * 1000);
+}
+
+async function refreshUrls(gallery) {
+   if (!gallery.isConnected) {
+      return;
+   }
+
+   try {
+      const response = await fetch(`/api/client/albums/${gallery.dataset.albumId}`, { credentials: "same-origin" });
+
+      if (response.ok) {
+         const album = await response.json();
+         const urls = new Map(album.images.map((image) => [image.originalKey, image.thumbnailURL]));
+
+         gallery.querySelectorAll("img[data-key]").forEach((img) => {
+            const url = urls.get(img.dataset.key);
+
+            if (url && !(img.complete && img.naturalWidth > 0)) {
+               img.src = url;
+            }
+         });
+      } else {
+         console.error(`error refreshing image URLs: ${response.status}`);
+      }
+   } catch (error) {
+      console.error("error refreshing image URLs", error);
+   }
+
+   scheduleUrlRefresh();
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/cache"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/seed"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+)
+
+const (
+	commandAudit   = "audit"
+	commandMigrate = "migrate"
+	commandSeed    = "seed"
+	commandServe   = "serve"
+)
+
+/*
+parseCommand splits the subcommand off the command line, returning it and
+the arguments without it so flags after the subcommand are still parsed.
+With no subcommand, or when the first argument is a flag, the website is
+served.
+*/
+func parseCommand(args []string) (string, []string) {
+	if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+		return commandServe, args
+	}
+
+	remaining := append([]string{args[0]}, args[2:]...)
+	return args[1], remaining
+}
+
+/*
+runCommand runs the function registered for command.
+*/
+func runCommand(command string, commands map[string]func() error) error {
+	run, ok := commands[command]
+
+	if !ok {
+		names := make([]string, 0, len(commands))
+
+		for name := range commands {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		return fmt.Errorf("unknown command '%s'. valid commands are %s", command, strings.Join(names, ", "))
+	}
+
+	return run()
+}
+
+/*
+migrateCommand applies pending migrations and exits, so schema changes can
+be a separate deploy step instead of happening as the server starts.
+*/
+func migrateCommand() error {
+	return migrate(os.Stdout)
+}
+
+func migrate(w io.Writer) error {
+	var (
+		err     error
+		applied []string
+	)
+
+	if err = connectDatabase(); err != nil {
+		return err
+	}
+
+	defer db.Pool().Close()
+
+	applied, err = applyMigrations()
+
+	for _, name := range applied {
+		fmt.Fprintf(w, "applied %s\n", name)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		fmt.Fprintln(w, "no pending migrations")
+	}
+
+	return nil
+}
+
+/*
+seedCommand fills a local database and LocalStack bucket with a sample
+client, albums, and photos for development.
+*/
+func seedCommand() error {
+	var (
+		err      error
+		result   seed.Result
+		s3Client s3.S3Client
+		creator  cache.CacheCreatorService
+	)
+
+	// Checked before touching anything, even though the seeder checks too
+	if !seed.IsLocalEndpoint(config.AwsEndpointUrl) {
+		return fmt.Errorf("%w '%s'", seed.ErrNotLocalEndpoint, config.AwsEndpointUrl)
+	}
+
+	if err = connectDatabase(); err != nil {
+		return err
+	}
+
+	defer db.Pool().Close()
+
+	if _, err = applyMigrations(); err != nil {
+		return err
+	}
+
+	if s3Client, err = newS3Client(); err != nil {
+		return err
+	}
+
+	albumService = services.NewAlbumService(services.AlbumServiceConfig{DB: db})
+	cacheFailureService = services.NewCacheFailureService(services.CacheFailureServiceConfig{DB: db})
+	clientService = services.NewClientService(services.ClientServiceConfig{DB: db})
+
+	if creator, err = newCacheCreator(s3Client, context.Background()); err != nil {
+		return err
+	}
+
+	seeder := seed.NewSeeder(seed.SeederConfig{
+		AlbumService:        albumService,
+		Bucket:              config.AwsBucket,
+		CacheCreator:        creator,
+		ClientPhotoFolder:   config.ClientsPhotoFolder,
+		ClientService:       clientService,
+		Endpoint:            config.AwsEndpointUrl,
+		HomePagePhotoFolder: config.HomePagePhotoFolder,
+		Region:              config.AwsRegion,
+		S3Client:            s3Client,
+	})
+
+	result, err = seeder.Seed()
+
+	if errors.Is(err, seed.ErrAlreadySeeded) {
+		fmt.Printf("sample data is already seeded. log in with access code '%s'\n", seed.SampleAccessCode)
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	printSeedResult(os.Stdout, result)
+	return nil
+}
+
+func printSeedResult(w io.Writer, result seed.Result) {
+	fmt.Fprintf(w, "created client %d '%s'. log in with access code '%s'\n", result.Client.ID, result.Client.Name, result.AccessCode)
+
+	for _, album := range result.Albums {
+		fmt.Fprintf(w, "created album %d '%s'\n", album.ID, album.Name)
+	}
+
+	fmt.Fprintf(w, "uploaded %d images\n", len(result.Keys))
+
+	if !result.CacheCreated {
+		fmt.Fprintln(w, "another instance holds the cache creator lock. thumbnails will be created on its next run")
+	}
+}
+
+/*
+auditOptions are the audit command's own flags. They are taken off the
+command line before the configuration is loaded, which would reject them.
+*/
+type auditOptions struct {
+	fix    bool
+	format string
+}
+
+/*
+parseAuditArgs pulls --fix and --format off the command line, returning
+them and the remaining arguments. The format defaults to a table.
+*/
+func parseAuditArgs(args []string) (auditOptions, []string) {
+	options := auditOptions{format: "table"}
+	remaining := []string{}
+
+	for i := 0; i < len(args); i++ {
+		if i == 0 || !strings.HasPrefix(args[i], "-") {
+			remaining = append(remaining, args[i])
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+
+		switch name {
+		case "fix":
+			options.fix = !hasValue || value == "true"
+
+		case "format":
+			if !hasValue && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+
+			options.format = strings.ToLower(value)
+
+		default:
+			remaining = append(remaining, args[i])
+		}
+	}
+
+	return options, remaining
+}
+
+/*
+auditCommand reports, per album, thumbnails without an original, originals
+without a thumbnail, and thumbnails older than their original. With --fix
+it then deletes the orphans and renders the missing and stale thumbnails.
+*/
+func auditCommand(options auditOptions) error {
+	var (
+		err      error
+		s3Client s3.S3Client
+		creator  cache.CacheCreatorService
+		result   cache.AuditResult
+		acquired bool
+	)
+
+	if options.format != "table" && options.format != "json" {
+		return fmt.Errorf("unknown audit format '%s'. valid formats are json, table", options.format)
+	}
+
+	if err = connectDatabase(); err != nil {
+		return err
+	}
+
+	defer db.Pool().Close()
+
+	if s3Client, err = newS3Client(); err != nil {
+		return err
+	}
+
+	albumService = services.NewAlbumService(services.AlbumServiceConfig{DB: db})
+	cacheFailureService = services.NewCacheFailureService(services.CacheFailureServiceConfig{DB: db})
+	clientService = services.NewClientService(services.ClientServiceConfig{DB: db})
+
+	if creator, err = newCacheCreator(s3Client, context.Background()); err != nil {
+		return err
+	}
+
+	if result, err = creator.Audit(); err != nil {
+		return err
+	}
+
+	if err = printAuditResult(os.Stdout, result, options.format); err != nil {
+		return err
+	}
+
+	if !options.fix {
+		return nil
+	}
+
+	// Repairing alongside a cache run would render the same thumbnails twice
+	if acquired, err = creator.TryAcquireLock(); err != nil {
+		return fmt.Errorf("error acquiring the cache creator lock: %w", err)
+	}
+
+	if !acquired {
+		return fmt.Errorf("another instance is running the cache creator. try again when it finishes")
+	}
+
+	defer func() {
+		if err := creator.ReleaseLock(); err != nil {
+			fmt.Fprintf(os.Stderr, "error releasing the cache creator lock: %s\n", err)
+		}
+	}()
+
+	deleted, rendered := creator.Repair(inconsistentAlbums(result.Albums))
+	fmt.Fprintf(os.Stderr, "deleted %d orphaned thumbnails and rendered %d thumbnails\n", deleted, rendered)
+	return nil
+}
+
+func inconsistentAlbums(audits []cache.AlbumAudit) []cache.AlbumAudit {
+	result := []cache.AlbumAudit{}
+
+	for _, audit := range audits {
+		if !audit.Consistent() {
+			result = append(result, audit)
+		}
+	}
+
+	return result
+}
+
+/*
+printAuditResult writes the audit as JSON, or as a table listing only the
+albums with something wrong.
+*/
+func printAuditResult(w io.Writer, result cache.AuditResult, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+
+	albums := inconsistentAlbums(result.Albums)
+
+	if len(albums) == 0 {
+		fmt.Fprintf(w, "all %d albums are consistent\n", len(result.Albums))
+	} else {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CLIENT\tALBUM\tNAME\tORPHANED\tMISSING\tSTALE")
+
+		for _, audit := range albums {
+			fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t%s\n",
+				audit.ClientID,
+				audit.AlbumID,
+				audit.AlbumName,
+				auditNames(audit.Orphaned),
+				auditNames(audit.Missing),
+				auditNames(audit.Stale),
+			)
+		}
+
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	for _, message := range result.Errors {
+		fmt.Fprintf(w, "error auditing %s\n", message)
+	}
+
+	return nil
+}
+
+func auditNames(names []string) string {
+	if len(names) == 0 {
+		return "-"
+	}
+
+	return strings.Join(names, ",")
+}
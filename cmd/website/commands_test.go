@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/cache"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantCommand string
+		wantArgs    []string
+	}{
+		{name: "no arguments", args: []string{"website"}, wantCommand: commandServe, wantArgs: []string{"website"}},
+		{name: "flags only", args: []string{"website", "--host", "0.0.0.0:80"}, wantCommand: commandServe, wantArgs: []string{"website", "--host", "0.0.0.0:80"}},
+		{name: "migrate", args: []string{"website", "migrate"}, wantCommand: commandMigrate, wantArgs: []string{"website"}},
+		{name: "migrate with flags", args: []string{"website", "migrate", "--dsn", "file:./other.db"}, wantCommand: commandMigrate, wantArgs: []string{"website", "--dsn", "file:./other.db"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command, args := parseCommand(tt.args)
+
+			if command != tt.wantCommand || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("parseCommand(%v) = %s, %v; want %s, %v", tt.args, command, args, tt.wantCommand, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestRunCommandDispatches(t *testing.T) {
+	ran := []string{}
+
+	commands := map[string]func() error{
+		commandMigrate: func() error {
+			ran = append(ran, commandMigrate)
+			return nil
+		},
+		commandServe: func() error {
+			ran = append(ran, commandServe)
+			return nil
+		},
+	}
+
+	// Migrating must never start the server
+	if err := runCommand(commandMigrate, commands); err != nil {
+		t.Fatalf("runCommand() = %v", err)
+	}
+
+	if !reflect.DeepEqual(ran, []string{commandMigrate}) {
+		t.Errorf("ran %v, want only %s", ran, commandMigrate)
+	}
+
+	if err := runCommand("mgirate", commands); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("runCommand() = %v, want an unknown command error", err)
+	}
+
+	if len(ran) != 1 {
+		t.Errorf("ran %v after an unknown command, want nothing more", ran)
+	}
+}
+
+func TestRunCommandReturnsErrors(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	err := runCommand(commandMigrate, map[string]func() error{
+		commandMigrate: func() error { return errFailed },
+	})
+
+	if !errors.Is(err, errFailed) {
+		t.Errorf("runCommand() = %v, want %v", err, errFailed)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	previousDSN := config.DSN
+	config.DSN = "file:" + filepath.Join(t.TempDir(), "migrate.db")
+
+	t.Cleanup(func() {
+		config.DSN = previousDSN
+		db = nil
+	})
+
+	out := &bytes.Buffer{}
+
+	if err := migrate(out); err != nil {
+		t.Fatalf("migrate() = %v", err)
+	}
+
+	if !strings.Contains(out.String(), "applied commit00001.sql") {
+		t.Errorf("output = %q, want the applied migrations listed", out.String())
+	}
+
+	out.Reset()
+
+	if err := migrate(out); err != nil {
+		t.Fatalf("second migrate() = %v", err)
+	}
+
+	if out.String() != "no pending migrations\n" {
+		t.Errorf("second output = %q, want nothing pending", out.String())
+	}
+}
+
+func TestParseAuditArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantOptions auditOptions
+		wantArgs    []string
+	}{
+		{name: "defaults", args: []string{"website"}, wantOptions: auditOptions{format: "table"}, wantArgs: []string{"website"}},
+		{name: "fix", args: []string{"website", "--fix"}, wantOptions: auditOptions{fix: true, format: "table"}, wantArgs: []string{"website"}},
+		{name: "format with equals", args: []string{"website", "-format=JSON"}, wantOptions: auditOptions{format: "json"}, wantArgs: []string{"website"}},
+		{
+			name:        "config flags are kept",
+			args:        []string{"website", "--dsn", "file:./other.db", "--format", "json", "--fix"},
+			wantOptions: auditOptions{fix: true, format: "json"},
+			wantArgs:    []string{"website", "--dsn", "file:./other.db"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, args := parseAuditArgs(tt.args)
+
+			if options != tt.wantOptions || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("parseAuditArgs(%v) = %+v, %v; want %+v, %v", tt.args, options, args, tt.wantOptions, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestPrintAuditResult(t *testing.T) {
+	result := cache.AuditResult{
+		Albums: []cache.AlbumAudit{
+			{ClientID: 1, AlbumID: 2, AlbumName: "Fine", Orphaned: []string{}, Missing: []string{}, Stale: []string{}},
+			{ClientID: 1, AlbumID: 3, AlbumName: "Wedding", Orphaned: []string{"old.jpg"}, Missing: []string{"a.jpg", "b.jpg"}, Stale: []string{}},
+		},
+		Errors: []string{"album 4: error listing album images: boom"},
+	}
+
+	out := &bytes.Buffer{}
+
+	if err := printAuditResult(out, result, "table"); err != nil {
+		t.Fatalf("printAuditResult() = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "CLIENT") || strings.Join(strings.Fields(lines[1]), " ") != "1 3 Wedding old.jpg a.jpg,b.jpg -" {
+		t.Errorf("table = %q, want a header and only the inconsistent album", out.String())
+	}
+
+	if !strings.Contains(lines[2], "error auditing album 4") {
+		t.Errorf("table = %q, want the album error listed", out.String())
+	}
+
+	out.Reset()
+
+	if err := printAuditResult(out, result, "json"); err != nil {
+		t.Fatalf("printAuditResult() = %v", err)
+	}
+
+	decoded := cache.AuditResult{}
+
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || !reflect.DeepEqual(decoded, result) {
+		t.Errorf("json = %q, %v; want every album", out.String(), err)
+	}
+}
@@ -0,0 +1,1390 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/putoptions"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/cache"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/requestlog"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+)
+
+var (
+	ErrNotAnImage   = errors.New("file is not an image")
+	ErrFileTooLarge = errors.New("file is too large")
+	ErrNoOriginal   = errors.New("album has no original")
+)
+
+const (
+	defaultClientPageSize = 50
+	defaultLoginLimit     = 50
+	maxClientPageSize     = 200
+	maxLoginLimit         = 500
+)
+
+type AdminControllerConfig struct {
+	AlbumService         services.AlbumServicer
+	Bucket               string
+	CacheCreator         cache.CacheCreator
+	ClientPhotoFolder    string
+	ClientService        services.ClientServicer
+	HomePagePhotoService services.HomePagePhotoServicer
+	MaxUploadSize        int64
+	S3Client             s3.S3Client
+	ZipService           services.ZipServicer
+}
+
+type AdminController struct {
+	albumService         services.AlbumServicer
+	bucket               string
+	cacheCreator         cache.CacheCreator
+	clientPhotoFolder    string
+	clientService        services.ClientServicer
+	homePagePhotoService services.HomePagePhotoServicer
+	maxUploadSize        int64
+	s3Client             s3.S3Client
+	zipService           services.ZipServicer
+
+	// cleanups tracks storage cleanups still running in the background
+	cleanups *sync.WaitGroup
+}
+
+func NewAdminController(config AdminControllerConfig) AdminController {
+	if config.MaxUploadSize <= 0 {
+		config.MaxUploadSize = 100 * 1024 * 1024
+	}
+
+	return AdminController{
+		albumService:         config.AlbumService,
+		bucket:               config.Bucket,
+		cacheCreator:         config.CacheCreator,
+		clientPhotoFolder:    config.ClientPhotoFolder,
+		clientService:        config.ClientService,
+		homePagePhotoService: config.HomePagePhotoService,
+		maxUploadSize:        config.MaxUploadSize,
+		s3Client:             config.S3Client,
+		zipService:           config.ZipService,
+		cleanups:             &sync.WaitGroup{},
+	}
+}
+
+type clientResponse struct {
+	ID              uint   `json:"id"`
+	Name            string `json:"name"`
+	Email           string `json:"email"`
+	AccessCode      string `json:"accessCode"`
+	AccessCodeLabel string `json:"accessCodeLabel"`
+	CreatedAt       string `json:"createdAt"`
+}
+
+type clientSummaryResponse struct {
+	ID               uint   `json:"id"`
+	Name             string `json:"name"`
+	Email            string `json:"email"`
+	Locale           string `json:"locale,omitempty"`
+	NotifyOnDownload bool   `json:"notifyOnDownload"`
+	CreatedAt        string `json:"createdAt"`
+}
+
+type clientListResponse struct {
+	Clients  []clientSummaryResponse `json:"clients"`
+	Page     int                     `json:"page"`
+	PageSize int                     `json:"pageSize"`
+	Total    int                     `json:"total"`
+}
+
+type accessCodeResponse struct {
+	ID         uint   `json:"id"`
+	ClientID   uint   `json:"clientID"`
+	AccessCode string `json:"accessCode"`
+	Label      string `json:"label"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+type albumResponse struct {
+	ID        uint   `json:"id"`
+	ClientID  uint   `json:"clientID"`
+	Name      string `json:"name"`
+	ShootDate string `json:"shootDate"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type loginResponse struct {
+	AccessCodeID uint   `json:"accessCodeID,omitempty"`
+	IPAddress    string `json:"ipAddress"`
+	UserAgent    string `json:"userAgent"`
+	Outcome      string `json:"outcome"`
+	Success      bool   `json:"success"`
+	CreatedAt    string `json:"createdAt"`
+}
+
+type galleryResponse struct {
+	ID        uint   `json:"id"`
+	ClientID  uint   `json:"clientID"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type homePagePhotoFlagResponse struct {
+	FileName string `json:"fileName"`
+	Hidden   bool   `json:"hidden"`
+	Featured bool   `json:"featured"`
+}
+
+type imageStatResponse struct {
+	ImagePath string `json:"imagePath"`
+	Views     int    `json:"views"`
+	Downloads int    `json:"downloads"`
+}
+
+/*
+POST /admin/clients
+
+The response includes the client's access code. It is only stored hashed,
+so this is the only time it can be read back.
+*/
+func (c AdminController) CreateClient(w http.ResponseWriter, r *http.Request) {
+	var (
+		err        error
+		client     *models.Client
+		accessCode models.AccessCode
+	)
+
+	request := services.CreateClientRequest{}
+
+	if err = httphelpers.ReadJSONBody(r, &request); err != nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if client, accessCode, err = c.clientService.Create(request); err != nil {
+		writeServiceError(w, r, err, "error creating client")
+		return
+	}
+
+	httphelpers.WriteJson(w, http.StatusCreated, clientResponse{
+		ID:              client.ID,
+		Name:            client.Name,
+		Email:           client.Email,
+		AccessCode:      accessCode.Code,
+		AccessCodeLabel: accessCode.Label,
+		CreatedAt:       client.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+/*
+GET /admin/clients?search=&page=1&pageSize=50&sort=name&order=asc
+
+Lists clients a page at a time. search matches part of a name or email.
+sort is name, email, or createdAt, and order is asc or desc. pageSize is
+capped at maxClientPageSize.
+*/
+func (c AdminController) ListClients(w http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		clients []models.Client
+		total   int
+	)
+
+	filter := services.ClientFilter{
+		Search:   httphelpers.GetFromRequest[string](r, "search"),
+		Page:     max(httphelpers.GetFromRequest[int](r, "page"), 1),
+		PageSize: httphelpers.GetFromRequest[int](r, "pageSize"),
+		SortBy:   httphelpers.GetFromRequest[string](r, "sort"),
+	}
+
+	if filter.PageSize <= 0 {
+		filter.PageSize = defaultClientPageSize
+	}
+
+	filter.PageSize = min(filter.PageSize, maxClientPageSize)
+
+	switch strings.ToLower(httphelpers.GetFromRequest[string](r, "order")) {
+	case "", "asc":
+	case "desc":
+		filter.Descending = true
+	default:
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "order must be 'asc' or 'desc'")
+		return
+	}
+
+	if clients, err = c.clientService.List(filter); err != nil {
+		writeServiceError(w, r, err, "error listing clients")
+		return
+	}
+
+	if total, err = c.clientService.Count(filter); err != nil {
+		writeServiceError(w, r, err, "error counting clients")
+		return
+	}
+
+	result := clientListResponse{
+		Clients:  make([]clientSummaryResponse, 0, len(clients)),
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+		Total:    total,
+	}
+
+	for _, client := range clients {
+		result.Clients = append(result.Clients, clientSummaryResponse{
+			ID:               client.ID,
+			Name:             client.Name,
+			Email:            client.Email,
+			Locale:           client.Locale,
+			NotifyOnDownload: client.NotifyOnDownload,
+			CreatedAt:        client.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	httphelpers.WriteJson(w, http.StatusOK, result)
+}
+
+type addAccessCodeRequest struct {
+	AccessCode string `json:"accessCode"`
+	Label      string `json:"label"`
+}
+
+/*
+POST /admin/clients/{clientid}/access-codes
+
+Gives a client another access code. A random code is generated when none is
+sent. Like CreateClient, the response is the only time the code can be read
+back.
+*/
+func (c AdminController) AddAccessCode(w http.ResponseWriter, r *http.Request) {
+	var (
+		err        error
+		accessCode models.AccessCode
+	)
+
+	clientID := httphelpers.GetFromRequest[uint](r, "clientid")
+	request := addAccessCodeRequest{}
+
+	if err = httphelpers.ReadJSONBody(r, &request); err != nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if accessCode, err = c.clientService.AddAccessCode(clientID, request.AccessCode, request.Label); err != nil {
+		if errors.Is(err, services.ErrClientNotFound) {
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Client not found")
+			return
+		}
+
+		writeServiceError(w, r, err, "error adding access code")
+		return
+	}
+
+	requestlog.Logger(r).Info("added access code", "clientID", clientID, "accessCodeID", accessCode.ID)
+
+	httphelpers.WriteJson(w, http.StatusCreated, accessCodeResponse{
+		ID:         accessCode.ID,
+		ClientID:   accessCode.ClientID,
+		AccessCode: accessCode.Code,
+		Label:      accessCode.Label,
+		CreatedAt:  accessCode.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+/*
+DELETE /admin/clients/{clientid}/access-codes/{accesscodeid}
+*/
+func (c AdminController) RevokeAccessCode(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	clientID := httphelpers.GetFromRequest[uint](r, "clientid")
+	accessCodeID := httphelpers.GetFromRequest[uint](r, "accesscodeid")
+
+	if err = c.clientService.RevokeAccessCode(clientID, accessCodeID); err != nil {
+		if errors.Is(err, services.ErrAccessCodeNotFound) {
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Access code not found")
+			return
+		}
+
+		requestlog.Logger(r).Error("error revoking access code", "error", err, "clientID", clientID, "accessCodeID", accessCodeID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	requestlog.Logger(r).Info("revoked access code", "clientID", clientID, "accessCodeID", accessCodeID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+POST /admin/clients/{clientid}/invalidate-sessions
+
+Logs the client out everywhere. Their access codes keep working, so anyone
+who still has one can log back in.
+*/
+func (c AdminController) InvalidateSessions(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	clientID := httphelpers.GetFromRequest[uint](r, "clientid")
+
+	if err = c.clientService.InvalidateSessions(clientID); err != nil {
+		if errors.Is(err, services.ErrClientNotFound) {
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Client not found")
+			return
+		}
+
+		requestlog.Logger(r).Error("error invalidating client sessions", "error", err, "clientID", clientID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	requestlog.Logger(r).Info("invalidated client sessions", "clientID", clientID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+GET /admin/clients/{clientid}/logins
+
+Lists a client's most recent login attempts, newest first, for reviewing
+who has been using their access codes. limit defaults to defaultLoginLimit
+and is capped at maxLoginLimit.
+*/
+func (c AdminController) ListClientLogins(w http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		logins []models.LoginAudit
+	)
+
+	clientID := httphelpers.GetFromRequest[uint](r, "clientid")
+	limit := httphelpers.GetFromRequest[int](r, "limit")
+
+	if limit <= 0 {
+		limit = defaultLoginLimit
+	}
+
+	if logins, err = c.clientService.GetRecentLogins(clientID, min(limit, maxLoginLimit)); err != nil {
+		writeServiceError(w, r, err, "error listing client logins")
+		return
+	}
+
+	result := make([]loginResponse, 0, len(logins))
+
+	for _, login := range logins {
+		result = append(result, loginResponse{
+			AccessCodeID: uint(login.AccessCodeID.Int64),
+			IPAddress:    login.IPAddress,
+			UserAgent:    login.UserAgent,
+			Outcome:      login.Outcome,
+			Success:      login.Succeeded(),
+			CreatedAt:    login.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	httphelpers.WriteJson(w, http.StatusOK, result)
+}
+
+/*
+GET /admin/clients/{clientid}/favorites.csv
+
+Downloads every favorite a client has chosen as a CSV of album name, image
+filename, and when it was favorited, for preparing their final edits. Rows
+are written to the response as they are encoded rather than built up first.
+*/
+func (c AdminController) ExportClientFavorites(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		favorites []models.ClientFavorite
+	)
+
+	clientID := httphelpers.GetFromRequest[uint](r, "clientid")
+
+	if favorites, err = c.albumService.GetAllFavoritesForClient(clientID); err != nil {
+		requestlog.Logger(r).Error("error getting client favorites for export", "error", err, "clientID", clientID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=client-%d-favorites.csv", clientID))
+
+	writer := csv.NewWriter(w)
+
+	if err = writer.Write([]string{"Album", "Image", "Favorited At"}); err != nil {
+		requestlog.Logger(r).Error("error writing client favorites export", "error", err, "clientID", clientID)
+		return
+	}
+
+	for _, favorite := range favorites {
+		row := []string{
+			favorite.AlbumName,
+			favorite.ImagePath,
+			favorite.CreatedAt.UTC().Format(time.RFC3339),
+		}
+
+		if err = writer.Write(row); err != nil {
+			requestlog.Logger(r).Error("error writing client favorites export", "error", err, "clientID", clientID)
+			return
+		}
+	}
+
+	writer.Flush()
+
+	if err = writer.Error(); err != nil {
+		requestlog.Logger(r).Error("error writing client favorites export", "error", err, "clientID", clientID)
+	}
+}
+
+/*
+DELETE /admin/clients/{clientid}
+
+Deletes a client along with their albums, favorites, and access codes, for
+when they ask for their data to be removed. Their photo folder is removed
+from storage in the background.
+*/
+func (c AdminController) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	clientID := httphelpers.GetFromRequest[uint](r, "clientid")
+
+	if err = c.clientService.Delete(clientID); err != nil {
+		if errors.Is(err, services.ErrClientNotFound) {
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Client not found")
+			return
+		}
+
+		requestlog.Logger(r).Error("error deleting client", "error", err, "clientID", clientID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	requestlog.Logger(r).Info("deleted client", "clientID", clientID)
+
+	c.removeClientFilesInBackground(requestlog.Logger(r), clientID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+POST /admin/albums
+*/
+func (c AdminController) CreateAlbum(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		album *models.Album
+	)
+
+	request := services.CreateAlbumRequest{}
+
+	if err = httphelpers.ReadJSONBody(r, &request); err != nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if album, err = c.albumService.Create(request); err != nil {
+		writeServiceError(w, r, err, "error creating album")
+		return
+	}
+
+	result := albumResponse{
+		ID:        album.ID,
+		ClientID:  album.ClientID,
+		Name:      album.Name,
+		ShootDate: album.ShootDate.Format(time.DateOnly),
+		CreatedAt: album.CreatedAt.Format(time.RFC3339),
+	}
+
+	if album.ExpiresAt.Valid {
+		result.ExpiresAt = album.ExpiresAt.Time.Format(time.DateOnly)
+	}
+
+	httphelpers.WriteJson(w, http.StatusCreated, result)
+}
+
+/*
+POST /admin/galleries
+
+Creates a gallery for grouping a client's albums from a JSON body like
+{"clientID": 1, "name": "Smith Wedding"}. Albums are added to it with
+PUT /admin/albums/{albumid}/gallery.
+*/
+func (c AdminController) CreateGallery(w http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		gallery *models.Gallery
+	)
+
+	request := services.CreateGalleryRequest{}
+
+	if err = httphelpers.ReadJSONBody(r, &request); err != nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if gallery, err = c.albumService.CreateGallery(request); err != nil {
+		writeServiceError(w, r, err, "error creating gallery")
+		return
+	}
+
+	httphelpers.WriteJson(w, http.StatusCreated, galleryResponse{
+		ID:        gallery.ID,
+		ClientID:  gallery.ClientID,
+		Name:      gallery.Name,
+		CreatedAt: gallery.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+/*
+DELETE /admin/albums/{albumid}
+
+Soft deletes the album, then removes its originals, thumbnails, hero banner,
+and downloads from storage. Storage cleanup is best effort: the album is
+already gone from the database, so failures are logged rather than
+reported.
+*/
+func (c AdminController) DeleteAlbum(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		album *models.Album
+	)
+
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+
+	if album, err = c.albumService.GetAlbumByID(albumID); err != nil {
+		if errors.Is(err, services.ErrAlbumNotFound) {
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Album not found")
+			return
+		}
+
+		requestlog.Logger(r).Error("error getting album to delete", "error", err, "albumID", albumID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	if err = c.albumService.DeleteAlbum(album.ClientID, album.ID); err != nil {
+		if errors.Is(err, services.ErrAlbumNotFound) {
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Album not found")
+			return
+		}
+
+		requestlog.Logger(r).Error("error deleting album", "error", err, "albumID", albumID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	requestlog.Logger(r).Info("deleted album", "clientID", album.ClientID, "albumID", album.ID)
+
+	c.removeAlbumFiles(requestlog.Logger(r), album)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type rejectedUpload struct {
+	Filename string `json:"filename"`
+	Error    string `json:"error"`
+}
+
+/*
+POST /admin/albums/{albumid}/images?rebuildCache=true
+
+Uploads one or more images, sent as multipart file parts, to the album's
+originals. Parts are streamed to S3 as they are read so large files are
+never held in memory. Each file is checked on its own: files that aren't
+images or are over the size limit are rejected without affecting the rest.
+When rebuildCache is set, thumbnails for the album are created in the
+background once the upload finishes.
+*/
+func (c AdminController) UploadAlbumImages(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		album *models.Album
+	)
+
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+	rebuildCache := httphelpers.GetFromRequest[bool](r, "rebuildCache")
+
+	if album, err = c.albumService.GetAlbumByID(albumID); err != nil {
+		if errors.Is(err, services.ErrAlbumNotFound) {
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Album not found")
+			return
+		}
+
+		requestlog.Logger(r).Error("error getting album for upload", "error", err, "albumID", albumID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	keys, rejected, ok := c.receiveUploads(w, r, album, "originals", nil)
+
+	if !ok {
+		return
+	}
+
+	if len(keys) > 0 && rebuildCache {
+		c.cacheCreator.CreateAlbumCacheInBackground(album)
+	}
+
+	status := http.StatusCreated
+
+	if len(keys) == 0 {
+		status = http.StatusBadRequest
+	}
+
+	httphelpers.WriteJson(w, status, map[string]any{
+		"keys":     keys,
+		"rejected": rejected,
+	})
+}
+
+/*
+POST /admin/albums/{albumid}/edited
+
+Uploads edited versions of album images, sent as multipart file parts, so
+clients can compare them with the originals. Each edit must be named the
+same as the original it replaces, and files without one are rejected.
+Otherwise they are checked the same way as originals.
+*/
+func (c AdminController) UploadEditedImages(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		album *models.Album
+	)
+
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+
+	if album, err = c.albumService.GetAlbumByID(albumID); err != nil {
+		if errors.Is(err, services.ErrAlbumNotFound) {
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Album not found")
+			return
+		}
+
+		requestlog.Logger(r).Error("error getting album for edited upload", "error", err, "albumID", albumID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	hasOriginal := func(filename string) error {
+		key := fmt.Sprintf("%s/%d/%d/originals/%s", c.clientPhotoFolder, album.ClientID, album.ID, filename)
+		stat, err := c.s3Client.StatObject(c.bucket, key)
+
+		if err != nil {
+			return fmt.Errorf("error checking for original '%s': %w", key, err)
+		}
+
+		if stat == nil {
+			return fmt.Errorf("%w named '%s'", ErrNoOriginal, filename)
+		}
+
+		return nil
+	}
+
+	keys, rejected, ok := c.receiveUploads(w, r, album, "edited", hasOriginal)
+
+	if !ok {
+		return
+	}
+
+	status := http.StatusCreated
+
+	if len(keys) == 0 {
+		status = http.StatusBadRequest
+	}
+
+	httphelpers.WriteJson(w, status, map[string]any{
+		"keys":     keys,
+		"rejected": rejected,
+	})
+}
+
+/*
+receiveUploads streams each file part of a multipart request into one of
+the album's folders and returns the keys it stored. check, when given, runs
+before a file is stored and rejects it on error. Files that are rejected
+don't stop the rest. When the request itself can't be read an error
+response is written and ok is false.
+*/
+func (c AdminController) receiveUploads(w http.ResponseWriter, r *http.Request, album *models.Album, folder string, check func(filename string) error) (keys []string, rejected []rejectedUpload, ok bool) {
+	var (
+		err    error
+		reader *multipart.Reader
+		part   *multipart.Part
+	)
+
+	if reader, err = r.MultipartReader(); err != nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Expected a multipart/form-data request")
+		return nil, nil, false
+	}
+
+	prefix := fmt.Sprintf("%s/%d/%d/%s/", c.clientPhotoFolder, album.ClientID, album.ID, folder)
+	keys = []string{}
+	rejected = []rejectedUpload{}
+
+	for {
+		if part, err = reader.NextPart(); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			requestlog.Logger(r).Error("error reading multipart upload", "error", err, "albumID", album.ID)
+			httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Error reading upload")
+			return nil, nil, false
+		}
+
+		filename := filepath.Base(part.FileName())
+
+		if part.FileName() == "" || filename == "." || filename == "/" || strings.HasPrefix(filename, ".") {
+			_ = part.Close()
+			continue
+		}
+
+		key := prefix + filename
+
+		if check != nil {
+			if err = check(filename); err != nil {
+				_ = part.Close()
+
+				if !errors.Is(err, ErrNoOriginal) {
+					requestlog.Logger(r).Error("error checking upload", "error", err, "key", key)
+				}
+
+				rejected = append(rejected, rejectedUpload{Filename: filename, Error: err.Error()})
+				continue
+			}
+		}
+
+		if err = c.uploadImage(r, key, part); err != nil {
+			_ = part.Close()
+
+			if !errors.Is(err, ErrNotAnImage) && !errors.Is(err, ErrFileTooLarge) {
+				requestlog.Logger(r).Error("error uploading image", "error", err, "key", key)
+			}
+
+			rejected = append(rejected, rejectedUpload{Filename: filename, Error: err.Error()})
+			continue
+		}
+
+		_ = part.Close()
+		keys = append(keys, key)
+		requestlog.Logger(r).Info("uploaded album image", "albumID", album.ID, "key", key)
+	}
+
+	return keys, rejected, true
+}
+
+/*
+uploadImage streams a single file to S3. The first 512 bytes are sniffed to
+make sure it's an image, rather than trusting the part's Content-Type. If
+the file turns out to be over the size limit the upload is abandoned and
+whatever was written is removed.
+*/
+func (c AdminController) uploadImage(r *http.Request, key string, body io.Reader) error {
+	var (
+		err     error
+		written int64
+		stream  s3.PutStreamResponse
+	)
+
+	buffered := bufio.NewReaderSize(body, 512)
+	head, _ := buffered.Peek(512)
+	contentType := http.DetectContentType(head)
+
+	if !strings.HasPrefix(contentType, "image/") {
+		return fmt.Errorf("%w (detected %s)", ErrNotAnImage, contentType)
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	stream, err = c.s3Client.PutStream(
+		c.bucket,
+		key,
+		putoptions.WithContentType(contentType),
+		putoptions.WithContext(ctx),
+	)
+
+	if err != nil {
+		return fmt.Errorf("error starting upload of '%s': %w", key, err)
+	}
+
+	written, err = io.Copy(stream.Writer, io.LimitReader(buffered, c.maxUploadSize+1))
+
+	if err == nil && written > c.maxUploadSize {
+		err = fmt.Errorf("%w (limit is %d bytes)", ErrFileTooLarge, c.maxUploadSize)
+	}
+
+	if err != nil {
+		cancel()
+		_ = stream.Writer.Close()
+		_, _ = stream.Wait()
+
+		if _, deleteErr := c.s3Client.Delete(c.bucket, []string{key}); deleteErr != nil {
+			requestlog.Logger(r).Error("error removing abandoned upload", "error", deleteErr, "key", key)
+		}
+
+		return err
+	}
+
+	_ = stream.Writer.Close()
+
+	if _, err = stream.Wait(); err != nil {
+		return fmt.Errorf("error uploading '%s': %w", key, err)
+	}
+
+	return nil
+}
+
+/*
+PUT /admin/albums/{albumid}/poster
+
+Sets the album's poster image and X and Y position from a JSON body like
+{"imagePath": "IMG_0001.jpg", "xPos": "60%", "yPos": "30%"}. The position is
+the focal point the hero banner is cropped around. The image must already
+be in the album's originals. The hero banner is rebuilt in the background.
+*/
+func (c AdminController) SetAlbumPoster(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		album *models.Album
+		stat  *s3.ObjectMetadata
+	)
+
+	request := struct {
+		ImagePath string `json:"imagePath"`
+		XPos      string `json:"xPos"`
+		YPos      string `json:"yPos"`
+	}{}
+
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+
+	if err = httphelpers.ReadJSONBody(r, &request); err != nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if album, err = c.albumService.GetAlbumByID(albumID); err != nil {
+		if errors.Is(err, services.ErrAlbumNotFound) {
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Album not found")
+			return
+		}
+
+		requestlog.Logger(r).Error("error getting album to set poster", "error", err, "albumID", albumID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	imagePath := filepath.Base(request.ImagePath)
+
+	if request.ImagePath == "" || imagePath == "." || imagePath == "/" {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "imagePath is required")
+		return
+	}
+
+	key := fmt.Sprintf("%s/%d/%d/originals/%s", c.clientPhotoFolder, album.ClientID, album.ID, imagePath)
+
+	if stat, err = c.s3Client.StatObject(c.bucket, key); err != nil {
+		requestlog.Logger(r).Error("error checking poster image exists", "error", err, "key", key)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	if stat == nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, fmt.Sprintf("Image '%s' does not exist in this album", imagePath))
+		return
+	}
+
+	if err = c.albumService.SetPoster(album.ClientID, album.ID, imagePath, request.XPos, request.YPos); err != nil {
+		writeServiceError(w, r, err, "error setting album poster")
+		return
+	}
+
+	previousPosterPath := album.PosterImagePath
+	album.PosterImagePath = imagePath
+	album.PosterXPos = strings.TrimSpace(request.XPos)
+	album.PosterYPos = strings.TrimSpace(request.YPos)
+
+	c.cacheCreator.RefreshHeroBannerInBackground(album, previousPosterPath, requestlog.Logger(r))
+
+	httphelpers.WriteJson(w, http.StatusOK, map[string]any{
+		"albumID":    album.ID,
+		"imagePath":  album.PosterImagePath,
+		"posterXPos": album.PosterXPos,
+		"posterYPos": album.PosterYPos,
+	})
+}
+
+/*
+PUT /admin/albums/{albumid}/image-order
+
+Saves a curated display order for an album, such as from a drag-and-drop
+editor. The body lists image names in order, like
+{"imagePaths": ["IMG_0003.jpg", "IMG_0001.jpg"]}. Images left out sort
+after the listed ones, by name. An empty list clears the order.
+*/
+func (c AdminController) SetAlbumImageOrder(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		album *models.Album
+	)
+
+	request := struct {
+		ImagePaths []string `json:"imagePaths"`
+	}{}
+
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+
+	if err = httphelpers.ReadJSONBody(r, &request); err != nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if album, err = c.albumService.GetAlbumByID(albumID); err != nil {
+		if errors.Is(err, services.ErrAlbumNotFound) {
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Album not found")
+			return
+		}
+
+		requestlog.Logger(r).Error("error getting album to set image order", "error", err, "albumID", albumID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	seen := map[string]bool{}
+	imagePaths := make([]string, 0, len(request.ImagePaths))
+
+	for _, imagePath := range request.ImagePaths {
+		imagePath = filepath.Base(imagePath)
+
+		if imagePath == "." || imagePath == "/" || seen[imagePath] {
+			continue
+		}
+
+		seen[imagePath] = true
+		imagePaths = append(imagePaths, imagePath)
+	}
+
+	if err = c.albumService.SetImageOrder(album.ID, imagePaths); err != nil {
+		writeServiceError(w, r, err, "error setting album image order")
+		return
+	}
+
+	httphelpers.WriteJson(w, http.StatusOK, map[string]any{
+		"albumID":    album.ID,
+		"imagePaths": imagePaths,
+	})
+}
+
+/*
+PUT /admin/albums/{albumid}/download-permission
+
+Turns downloads of an album's photos on or off from a JSON body like
+{"allowDownload": false}. Albums with downloads off are view only, like
+proofing galleries.
+*/
+func (c AdminController) SetAlbumDownloadPermission(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	request := struct {
+		AllowDownload *bool `json:"allowDownload"`
+	}{}
+
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+
+	if err = httphelpers.ReadJSONBody(r, &request); err != nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if request.AllowDownload == nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "allowDownload is required")
+		return
+	}
+
+	if err = c.albumService.SetDownloadPermission(albumID, *request.AllowDownload); err != nil {
+		if errors.Is(err, services.ErrAlbumNotFound) {
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Album not found")
+			return
+		}
+
+		writeServiceError(w, r, err, "error setting album download permission")
+		return
+	}
+
+	httphelpers.WriteJson(w, http.StatusOK, map[string]any{
+		"albumID":       albumID,
+		"allowDownload": *request.AllowDownload,
+	})
+}
+
+/*
+PUT /admin/albums/{albumid}/purchased
+
+Marks an album as purchased or not from a JSON body like
+{"purchased": true}. Until an album is purchased clients see watermarked
+previews and can't download. The album's previews are rendered for the new
+status in the background.
+*/
+func (c AdminController) SetAlbumPurchased(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		album *models.Album
+	)
+
+	request := struct {
+		Purchased *bool `json:"purchased"`
+	}{}
+
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+
+	if err = httphelpers.ReadJSONBody(r, &request); err != nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if request.Purchased == nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "purchased is required")
+		return
+	}
+
+	if err = c.albumService.SetPurchased(albumID, *request.Purchased); err != nil {
+		if errors.Is(err, services.ErrAlbumNotFound) {
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Album not found")
+			return
+		}
+
+		writeServiceError(w, r, err, "error setting album purchase status")
+		return
+	}
+
+	if album, err = c.albumService.GetAlbumByID(albumID); err != nil {
+		requestlog.Logger(r).Error("error getting album to render its previews", "error", err, "albumID", albumID)
+	} else {
+		c.cacheCreator.CreateAlbumCacheInBackground(album)
+	}
+
+	httphelpers.WriteJson(w, http.StatusOK, map[string]any{
+		"albumID":   albumID,
+		"purchased": *request.Purchased,
+	})
+}
+
+/*
+PUT /admin/albums/{albumid}/max-favorites
+
+Limits how many favorites the client may choose in an album from a JSON
+body like {"maxFavorites": 20}, for proofing packages. A null limit makes it
+unlimited.
+*/
+func (c AdminController) SetAlbumMaxFavorites(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	request := struct {
+		MaxFavorites *int64 `json:"maxFavorites"`
+	}{}
+
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+
+	if err = httphelpers.ReadJSONBody(r, &request); err != nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	maxFavorites := sql.NullInt64{}
+
+	if request.MaxFavorites != nil {
+		maxFavorites = sql.NullInt64{Int64: *request.MaxFavorites, Valid: true}
+	}
+
+	if err = c.albumService.SetMaxFavorites(albumID, maxFavorites); err != nil {
+		if errors.Is(err, services.ErrAlbumNotFound) {
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Album not found")
+			return
+		}
+
+		writeServiceError(w, r, err, "error setting album favorite limit")
+		return
+	}
+
+	httphelpers.WriteJson(w, http.StatusOK, map[string]any{
+		"albumID":      albumID,
+		"maxFavorites": request.MaxFavorites,
+	})
+}
+
+/*
+PUT /admin/albums/{albumid}/gallery
+
+Puts an album in one of its client's galleries from a JSON body like
+{"galleryID": 4}. A null gallery takes the album out of its gallery so it
+is shown on its own.
+*/
+func (c AdminController) SetAlbumGallery(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	request := struct {
+		GalleryID *int64 `json:"galleryID"`
+	}{}
+
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+
+	if err = httphelpers.ReadJSONBody(r, &request); err != nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	galleryID := sql.NullInt64{}
+
+	if request.GalleryID != nil {
+		galleryID = sql.NullInt64{Int64: *request.GalleryID, Valid: true}
+	}
+
+	if err = c.albumService.SetAlbumGallery(albumID, galleryID); err != nil {
+		switch {
+		case errors.Is(err, services.ErrAlbumNotFound):
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Album not found")
+
+		case errors.Is(err, services.ErrGalleryNotFound):
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Gallery not found")
+
+		default:
+			writeServiceError(w, r, err, "error setting album gallery")
+		}
+
+		return
+	}
+
+	httphelpers.WriteJson(w, http.StatusOK, map[string]any{
+		"albumID":   albumID,
+		"galleryID": request.GalleryID,
+	})
+}
+
+/*
+POST /admin/albums/{albumid}/thumbnail/regenerate?key=
+
+Recreates the thumbnail for one original in an album, such as after a bad
+crop, without rebuilding the rest of the album. key is the original's full
+S3 key and must be in the album's originals. Responds with a URL for the
+new thumbnail.
+*/
+func (c AdminController) RegenerateThumbnail(w http.ResponseWriter, r *http.Request) {
+	var (
+		err          error
+		album        *models.Album
+		stat         *s3.ObjectMetadata
+		thumbnailURL string
+	)
+
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+	key := r.URL.Query().Get("key")
+
+	if key == "" {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "key is required")
+		return
+	}
+
+	if album, err = c.albumService.GetAlbumByID(albumID); err != nil {
+		if errors.Is(err, services.ErrAlbumNotFound) {
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Album not found")
+			return
+		}
+
+		requestlog.Logger(r).Error("error getting album to regenerate a thumbnail", "error", err, "albumID", albumID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	if stat, err = c.s3Client.StatObject(c.bucket, key); err != nil {
+		requestlog.Logger(r).Error("error checking original exists", "error", err, "key", key)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	if stat == nil {
+		httphelpers.JsonErrorMessage(w, http.StatusNotFound, fmt.Sprintf("Image '%s' does not exist", key))
+		return
+	}
+
+	if err = c.cacheCreator.RegenerateThumbnail(album, key); err != nil {
+		writeServiceError(w, r, err, "error regenerating thumbnail")
+		return
+	}
+
+	thumbnailKey := c.cacheCreator.ThumbnailFormat().PreviewKey(key, album.Purchased)
+
+	if thumbnailURL, err = c.s3Client.GetUrl(c.bucket, thumbnailKey); err != nil {
+		requestlog.Logger(r).Error("error getting regenerated thumbnail URL", "error", err, "key", thumbnailKey)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	httphelpers.WriteJson(w, http.StatusOK, map[string]any{
+		"albumID":      album.ID,
+		"originalKey":  key,
+		"thumbnailKey": thumbnailKey,
+		"thumbnailURL": thumbnailURL,
+	})
+}
+
+/*
+GET /admin/albums/{albumid}/stats
+
+Reports how many times each image in an album has been opened and
+downloaded. Images nobody has looked at are left out.
+*/
+func (c AdminController) GetAlbumImageStats(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		album *models.Album
+		stats []models.ImageStat
+	)
+
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+
+	if album, err = c.albumService.GetAlbumByID(albumID); err != nil {
+		if errors.Is(err, services.ErrAlbumNotFound) {
+			httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Album not found")
+			return
+		}
+
+		requestlog.Logger(r).Error("error getting album for image stats", "error", err, "albumID", albumID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	if stats, err = c.albumService.GetImageStats(album.ClientID, album.ID); err != nil {
+		writeServiceError(w, r, err, "error getting album image stats")
+		return
+	}
+
+	images := make([]imageStatResponse, 0, len(stats))
+
+	for _, stat := range stats {
+		images = append(images, imageStatResponse{
+			ImagePath: stat.ImagePath,
+			Views:     stat.Views,
+			Downloads: stat.Downloads,
+		})
+	}
+
+	httphelpers.WriteJson(w, http.StatusOK, map[string]any{
+		"albumID": album.ID,
+		"images":  images,
+	})
+}
+
+/*
+POST /admin/cleanup/zips
+
+Removes expired download zips now instead of waiting for the scheduled
+cleanup, and reports how many were removed.
+*/
+func (c AdminController) CleanupZips(w http.ResponseWriter, r *http.Request) {
+	removed, err := c.zipService.CleanupExpiredZips()
+
+	if err != nil {
+		requestlog.Logger(r).Error("error cleaning up expired zips", "error", err, "removed", removed)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	requestlog.Logger(r).Info("cleaned up expired zips", "removed", removed)
+
+	httphelpers.WriteJson(w, http.StatusOK, map[string]any{
+		"removed": removed,
+	})
+}
+
+/*
+PUT /admin/home-page/photos/{filename}/flags
+
+Hides a home page photo or features it first in the gallery. Either flag
+may be left out of the body to keep its current value. Clearing both puts
+the photo back to how it is shown by default.
+*/
+func (c AdminController) SetHomePagePhotoFlags(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		flags map[string]models.HomePagePhotoFlag
+		flag  models.HomePagePhotoFlag
+	)
+
+	request := struct {
+		Hidden   *bool `json:"hidden"`
+		Featured *bool `json:"featured"`
+	}{}
+
+	fileName := filepath.Base(r.PathValue("filename"))
+
+	if fileName == "." || fileName == "/" {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "A file name is required")
+		return
+	}
+
+	if err = httphelpers.ReadJSONBody(r, &request); err != nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if flags, err = c.homePagePhotoService.GetFlags(); err != nil {
+		writeServiceError(w, r, err, "error getting home page photo flags")
+		return
+	}
+
+	flag = flags[fileName]
+
+	if request.Hidden != nil {
+		flag.Hidden = *request.Hidden
+	}
+
+	if request.Featured != nil {
+		flag.Featured = *request.Featured
+	}
+
+	if flag, err = c.homePagePhotoService.SetFlags(fileName, flag.Hidden, flag.Featured); err != nil {
+		writeServiceError(w, r, err, "error setting home page photo flags")
+		return
+	}
+
+	httphelpers.WriteJson(w, http.StatusOK, homePagePhotoFlagResponse{
+		FileName: flag.FileName,
+		Hidden:   flag.Hidden,
+		Featured: flag.Featured,
+	})
+}
+
+/*
+writeServiceError maps validation and conflict errors from the services to
+4xx responses. Anything else is logged and reported as a 500.
+*/
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error, logMessage string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidInput):
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, err.Error())
+
+	case errors.Is(err, services.ErrDuplicateAccessCode):
+		httphelpers.JsonErrorMessage(w, http.StatusConflict, err.Error())
+
+	default:
+		requestlog.Logger(r).Error(logMessage, "error", err)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+	}
+}
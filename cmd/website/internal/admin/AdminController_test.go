@@ -0,0 +1,1182 @@
+package admin
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/geturloptions"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/cache"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+)
+
+/*
+fakeClientService only knows about client 1 and its access code 7. Anything not
+implemented panics through the nil embedded interface.
+*/
+type fakeClientService struct {
+	services.ClientServicer
+
+	deleted     []uint
+	invalidated []uint
+	listed      []services.ClientFilter
+	loginLimits []int
+	revoked     []uint
+}
+
+/*
+List records the filter it was given and returns Jane and John. Sorting by
+anything but name is rejected the way the real service rejects an unknown
+sort.
+*/
+func (f *fakeClientService) List(filter services.ClientFilter) ([]models.Client, error) {
+	f.listed = append(f.listed, filter)
+
+	if filter.SortBy != "" && filter.SortBy != services.ClientSortName {
+		return nil, fmt.Errorf("%w: can't sort clients by '%s'", services.ErrInvalidInput, filter.SortBy)
+	}
+
+	return []models.Client{
+		{BaseModel: models.BaseModel{ID: 1, CreatedAt: time.Now()}, Name: "Jane", Email: "jane@example.com"},
+		{BaseModel: models.BaseModel{ID: 2, CreatedAt: time.Now()}, Name: "John", Email: "john@example.com"},
+	}, nil
+}
+
+func (f *fakeClientService) Count(filter services.ClientFilter) (int, error) {
+	return 12, nil
+}
+
+/*
+Create rejects a blank name and the access code "taken" the way the real
+service does. The name "boom" fails with an unexpected error.
+*/
+func (f *fakeClientService) Create(request services.CreateClientRequest) (*models.Client, models.AccessCode, error) {
+	switch {
+	case request.Name == "":
+		return nil, models.AccessCode{}, fmt.Errorf("%w: a name is required", services.ErrInvalidInput)
+
+	case request.Name == "boom":
+		return nil, models.AccessCode{}, errors.New("database is down")
+
+	case request.AccessCode == "taken":
+		return nil, models.AccessCode{}, services.ErrDuplicateAccessCode
+	}
+
+	code := request.AccessCode
+
+	if code == "" {
+		code = "generated"
+	}
+
+	client := &models.Client{BaseModel: models.BaseModel{ID: 1, CreatedAt: time.Now()}, Name: request.Name, Email: request.Email}
+	return client, models.AccessCode{ID: 7, ClientID: 1, Code: code, Label: "Default", CreatedAt: time.Now()}, nil
+}
+
+func (f *fakeClientService) AddAccessCode(clientID uint, code, label string) (models.AccessCode, error) {
+	if clientID != 1 {
+		return models.AccessCode{}, fmt.Errorf("client %d: %w", clientID, services.ErrClientNotFound)
+	}
+
+	if code == "" {
+		code = "generated"
+	}
+
+	return models.AccessCode{ID: 7, ClientID: clientID, Code: code, Label: label, CreatedAt: time.Now()}, nil
+}
+
+func (f *fakeClientService) RevokeAccessCode(clientID, accessCodeID uint) error {
+	if clientID != 1 || accessCodeID != 7 {
+		return fmt.Errorf("access code %d for client %d: %w", accessCodeID, clientID, services.ErrAccessCodeNotFound)
+	}
+
+	f.revoked = append(f.revoked, accessCodeID)
+	return nil
+}
+
+func (f *fakeClientService) Delete(clientID uint) error {
+	if clientID != 1 {
+		return fmt.Errorf("client %d: %w", clientID, services.ErrClientNotFound)
+	}
+
+	f.deleted = append(f.deleted, clientID)
+	return nil
+}
+
+func (f *fakeClientService) InvalidateSessions(clientID uint) error {
+	if clientID != 1 {
+		return fmt.Errorf("client %d: %w", clientID, services.ErrClientNotFound)
+	}
+
+	f.invalidated = append(f.invalidated, clientID)
+	return nil
+}
+
+// GetRecentLogins records the limit it was given and returns one of each outcome for client 1
+func (f *fakeClientService) GetRecentLogins(clientID uint, limit int) ([]models.LoginAudit, error) {
+	f.loginLimits = append(f.loginLimits, limit)
+
+	if clientID != 1 {
+		return []models.LoginAudit{}, nil
+	}
+
+	return []models.LoginAudit{
+		{ClientID: sql.NullInt64{Int64: 1, Valid: true}, AccessCodeID: sql.NullInt64{Int64: 7, Valid: true}, IPAddress: "203.0.113.9", UserAgent: "Safari", Outcome: models.LoginOutcomeSuccess, CreatedAt: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)},
+		{ClientID: sql.NullInt64{Int64: 1, Valid: true}, IPAddress: "198.51.100.7", UserAgent: "curl/8.0", Outcome: models.LoginOutcomeError, CreatedAt: time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)},
+	}, nil
+}
+
+/*
+fakeAlbumService creates albums for client 1 only. Anything not implemented
+panics through the nil embedded interface.
+*/
+type fakeAlbumService struct {
+	services.AlbumServicer
+
+	allowDownload map[uint]bool
+	deleted       []uint
+	favorites     []models.ClientFavorite
+	galleries     map[uint]sql.NullInt64
+	imageOrder    []string
+	maxFavorites  map[uint]sql.NullInt64
+	purchased     map[uint]bool
+}
+
+func (f *fakeAlbumService) Create(request services.CreateAlbumRequest) (*models.Album, error) {
+	if request.ClientID != 1 {
+		return nil, fmt.Errorf("%w: client %d does not exist", services.ErrInvalidInput, request.ClientID)
+	}
+
+	shootDate, err := time.Parse(time.DateOnly, request.ShootDate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: shootDate must be YYYY-MM-DD", services.ErrInvalidInput)
+	}
+
+	album := &models.Album{BaseModel: models.BaseModel{ID: 3, CreatedAt: time.Now()}, ClientID: request.ClientID, Name: request.Name, ShootDate: shootDate}
+
+	if expiresAt, err := time.Parse(time.DateOnly, request.ExpiresAt); err == nil {
+		album.ExpiresAt = sql.NullTime{Time: expiresAt, Valid: true}
+	}
+
+	return album, nil
+}
+
+func (f *fakeAlbumService) GetAlbumByID(albumID uint) (*models.Album, error) {
+	if albumID != 3 {
+		return nil, fmt.Errorf("album %d: %w", albumID, services.ErrAlbumNotFound)
+	}
+
+	purchased, ok := f.purchased[albumID]
+
+	return &models.Album{BaseModel: models.BaseModel{ID: 3}, ClientID: 1, Name: "Wedding", Purchased: purchased || !ok}, nil
+}
+
+func (f *fakeAlbumService) DeleteAlbum(clientID, albumID uint) error {
+	if clientID != 1 || albumID != 3 {
+		return fmt.Errorf("album %d for client %d: %w", albumID, clientID, services.ErrAlbumNotFound)
+	}
+
+	f.deleted = append(f.deleted, albumID)
+	return nil
+}
+
+func (f *fakeAlbumService) SetImageOrder(albumID uint, imagePaths []string) error {
+	f.imageOrder = imagePaths
+	return nil
+}
+
+func (f *fakeAlbumService) SetDownloadPermission(albumID uint, allowDownload bool) error {
+	if albumID != 3 {
+		return fmt.Errorf("album %d: %w", albumID, services.ErrAlbumNotFound)
+	}
+
+	if f.allowDownload == nil {
+		f.allowDownload = map[uint]bool{}
+	}
+
+	f.allowDownload[albumID] = allowDownload
+	return nil
+}
+
+func (f *fakeAlbumService) SetPurchased(albumID uint, purchased bool) error {
+	if albumID != 3 {
+		return fmt.Errorf("album %d: %w", albumID, services.ErrAlbumNotFound)
+	}
+
+	if f.purchased == nil {
+		f.purchased = map[uint]bool{}
+	}
+
+	f.purchased[albumID] = purchased
+	return nil
+}
+
+// GetAllFavoritesForClient returns favorites for client 1 and none for anyone else
+func (f *fakeAlbumService) GetAllFavoritesForClient(clientID uint) ([]models.ClientFavorite, error) {
+	if clientID != 1 {
+		return []models.ClientFavorite{}, nil
+	}
+
+	return f.favorites, nil
+}
+
+func (f *fakeAlbumService) CreateGallery(request services.CreateGalleryRequest) (*models.Gallery, error) {
+	switch {
+	case request.ClientID != 1:
+		return nil, fmt.Errorf("%w: client %d does not exist", services.ErrInvalidInput, request.ClientID)
+
+	case strings.TrimSpace(request.Name) == "":
+		return nil, fmt.Errorf("%w: name is required", services.ErrInvalidInput)
+	}
+
+	return &models.Gallery{BaseModel: models.BaseModel{ID: 4, CreatedAt: time.Now()}, ClientID: request.ClientID, Name: request.Name}, nil
+}
+
+// SetAlbumGallery knows about album 3 and client 1's gallery 4. Gallery 5 belongs to another client
+func (f *fakeAlbumService) SetAlbumGallery(albumID uint, galleryID sql.NullInt64) error {
+	switch {
+	case albumID != 3:
+		return fmt.Errorf("album %d: %w", albumID, services.ErrAlbumNotFound)
+
+	case galleryID.Valid && galleryID.Int64 == 5:
+		return fmt.Errorf("%w: gallery 5 belongs to another client", services.ErrInvalidInput)
+
+	case galleryID.Valid && galleryID.Int64 != 4:
+		return fmt.Errorf("gallery %d: %w", galleryID.Int64, services.ErrGalleryNotFound)
+	}
+
+	if f.galleries == nil {
+		f.galleries = map[uint]sql.NullInt64{}
+	}
+
+	f.galleries[albumID] = galleryID
+	return nil
+}
+
+func (f *fakeAlbumService) SetMaxFavorites(albumID uint, maxFavorites sql.NullInt64) error {
+	if albumID != 3 {
+		return fmt.Errorf("album %d: %w", albumID, services.ErrAlbumNotFound)
+	}
+
+	if maxFavorites.Valid && maxFavorites.Int64 < 1 {
+		return fmt.Errorf("%w: the favorite limit must be at least 1", services.ErrInvalidInput)
+	}
+
+	if f.maxFavorites == nil {
+		f.maxFavorites = map[uint]sql.NullInt64{}
+	}
+
+	f.maxFavorites[albumID] = maxFavorites
+	return nil
+}
+
+func TestCreateClient(t *testing.T) {
+	controller := NewAdminController(AdminControllerConfig{ClientService: &fakeClientService{}})
+
+	// httphelpers.WriteJson only writes statuses above 299, so a 201 goes out as a 200
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "generated code", body: `{"name": "Jane", "email": "jane@example.com"}`, wantStatus: http.StatusOK, wantBody: `"accessCode":"generated"`},
+		{name: "given code", body: `{"name": "Jane", "accessCode": "jane-code"}`, wantStatus: http.StatusOK, wantBody: `"accessCode":"jane-code"`},
+		{name: "duplicate code", body: `{"name": "Jane", "accessCode": "taken"}`, wantStatus: http.StatusConflict},
+		{name: "missing name", body: `{"email": "jane@example.com"}`, wantStatus: http.StatusBadRequest},
+		{name: "bad body", body: `not json`, wantStatus: http.StatusBadRequest},
+		{name: "unexpected error", body: `{"name": "boom"}`, wantStatus: http.StatusInternalServerError, wantBody: "An unexpected error occurred"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/admin/clients", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			controller.CreateClient(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if tt.wantBody != "" && !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestListClients(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantFilter services.ClientFilter
+	}{
+		{name: "defaults", query: "", wantStatus: http.StatusOK, wantFilter: services.ClientFilter{Page: 1, PageSize: 50}},
+		{name: "search and page", query: "?search=jan&page=2&pageSize=10&sort=name&order=desc", wantStatus: http.StatusOK, wantFilter: services.ClientFilter{Search: "jan", Page: 2, PageSize: 10, SortBy: "name", Descending: true}},
+		{name: "page size is capped", query: "?pageSize=5000", wantStatus: http.StatusOK, wantFilter: services.ClientFilter{Page: 1, PageSize: 200}},
+		{name: "unknown order", query: "?order=sideways", wantStatus: http.StatusBadRequest},
+		{name: "unknown sort", query: "?sort=password", wantStatus: http.StatusBadRequest, wantFilter: services.ClientFilter{Page: 1, PageSize: 50, SortBy: "password"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientService := &fakeClientService{}
+			controller := NewAdminController(AdminControllerConfig{ClientService: clientService})
+
+			w := httptest.NewRecorder()
+			controller.ListClients(w, httptest.NewRequest(http.MethodGet, "/admin/clients"+tt.query, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if tt.wantFilter != (services.ClientFilter{}) && (len(clientService.listed) != 1 || clientService.listed[0] != tt.wantFilter) {
+				t.Errorf("filters = %+v, want %+v", clientService.listed, tt.wantFilter)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			response := clientListResponse{}
+
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+
+			if len(response.Clients) != 2 || response.Clients[0].Name != "Jane" || response.Total != 12 || response.Page != tt.wantFilter.Page || response.PageSize != tt.wantFilter.PageSize {
+				t.Errorf("response = %+v", response)
+			}
+		})
+	}
+}
+
+func TestCreateAlbum(t *testing.T) {
+	controller := NewAdminController(AdminControllerConfig{AlbumService: &fakeAlbumService{}})
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "valid album", body: `{"clientID": 1, "name": "Wedding", "shootDate": "2024-06-01"}`, wantStatus: http.StatusOK, wantBody: `"shootDate":"2024-06-01"`},
+		{name: "with expiration", body: `{"clientID": 1, "name": "Wedding", "shootDate": "2024-06-01", "expiresAt": "2099-01-01"}`, wantStatus: http.StatusOK, wantBody: `"expiresAt":"2099-01-01"`},
+		{name: "unknown client", body: `{"clientID": 2, "name": "Wedding", "shootDate": "2024-06-01"}`, wantStatus: http.StatusBadRequest},
+		{name: "bad date", body: `{"clientID": 1, "name": "Wedding", "shootDate": "June 1st"}`, wantStatus: http.StatusBadRequest},
+		{name: "bad body", body: `not json`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/admin/albums", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			controller.CreateAlbum(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if tt.wantBody != "" && !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAddAccessCode(t *testing.T) {
+	controller := NewAdminController(AdminControllerConfig{ClientService: &fakeClientService{}})
+
+	// httphelpers.WriteJson only writes statuses above 299, so a 201 goes out as a 200
+
+	tests := []struct {
+		name       string
+		clientID   string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "given code", clientID: "1", body: `{"accessCode": "grandma", "label": "Grandma"}`, wantStatus: http.StatusOK, wantCode: `"accessCode":"grandma"`},
+		{name: "generated code", clientID: "1", body: `{"label": "Grandpa"}`, wantStatus: http.StatusOK, wantCode: `"accessCode":"generated"`},
+		{name: "unknown client", clientID: "2", body: `{"label": "Nobody"}`, wantStatus: http.StatusNotFound},
+		{name: "bad body", clientID: "1", body: `not json`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/admin/clients/"+tt.clientID+"/access-codes", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			r.SetPathValue("clientid", tt.clientID)
+
+			w := httptest.NewRecorder()
+			controller.AddAccessCode(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if tt.wantCode != "" && !strings.Contains(w.Body.String(), tt.wantCode) {
+				t.Errorf("body = %s, want it to contain %s", w.Body.String(), tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRevokeAccessCode(t *testing.T) {
+	clientService := &fakeClientService{}
+	controller := NewAdminController(AdminControllerConfig{ClientService: clientService})
+
+	tests := []struct {
+		name         string
+		clientID     string
+		accessCodeID string
+		wantStatus   int
+	}{
+		{name: "another client's code", clientID: "2", accessCodeID: "7", wantStatus: http.StatusNotFound},
+		{name: "unknown code", clientID: "1", accessCodeID: "8", wantStatus: http.StatusNotFound},
+		{name: "own code", clientID: "1", accessCodeID: "7", wantStatus: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodDelete, "/admin/clients/"+tt.clientID+"/access-codes/"+tt.accessCodeID, nil)
+			r.SetPathValue("clientid", tt.clientID)
+			r.SetPathValue("accesscodeid", tt.accessCodeID)
+
+			w := httptest.NewRecorder()
+			controller.RevokeAccessCode(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	if len(clientService.revoked) != 1 {
+		t.Errorf("revoked = %v, want only access code 7", clientService.revoked)
+	}
+}
+
+func TestInvalidateSessions(t *testing.T) {
+	clientService := &fakeClientService{}
+	controller := NewAdminController(AdminControllerConfig{ClientService: clientService})
+
+	tests := []struct {
+		name       string
+		clientID   string
+		wantStatus int
+	}{
+		{name: "known client", clientID: "1", wantStatus: http.StatusNoContent},
+		{name: "unknown client", clientID: "2", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/admin/clients/"+tt.clientID+"/invalidate-sessions", nil)
+			r.SetPathValue("clientid", tt.clientID)
+
+			w := httptest.NewRecorder()
+			controller.InvalidateSessions(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	if len(clientService.invalidated) != 1 {
+		t.Errorf("invalidated = %v, want only client 1", clientService.invalidated)
+	}
+}
+
+func TestListClientLogins(t *testing.T) {
+	clientService := &fakeClientService{}
+	controller := NewAdminController(AdminControllerConfig{ClientService: clientService})
+
+	tests := []struct {
+		name      string
+		clientID  string
+		limit     string
+		wantLimit int
+		wantCount int
+	}{
+		{name: "default limit", clientID: "1", wantLimit: defaultLoginLimit, wantCount: 2},
+		{name: "limit", clientID: "1", limit: "10", wantLimit: 10, wantCount: 2},
+		{name: "capped limit", clientID: "1", limit: "100000", wantLimit: maxLoginLimit, wantCount: 2},
+		{name: "no logins", clientID: "2", wantLimit: defaultLoginLimit, wantCount: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := "/admin/clients/" + tt.clientID + "/logins"
+
+			if tt.limit != "" {
+				target += "?limit=" + tt.limit
+			}
+
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			r.SetPathValue("clientid", tt.clientID)
+
+			w := httptest.NewRecorder()
+			controller.ListClientLogins(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+
+			if got := clientService.loginLimits[len(clientService.loginLimits)-1]; got != tt.wantLimit {
+				t.Errorf("limit = %d, want %d", got, tt.wantLimit)
+			}
+
+			got := []loginResponse{}
+
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+
+			if len(got) != tt.wantCount {
+				t.Fatalf("got %d logins, want %d", len(got), tt.wantCount)
+			}
+
+			if tt.wantCount == 0 {
+				return
+			}
+
+			want := loginResponse{AccessCodeID: 7, IPAddress: "203.0.113.9", UserAgent: "Safari", Outcome: models.LoginOutcomeSuccess, Success: true, CreatedAt: "2024-05-02T10:00:00Z"}
+
+			if got[0] != want {
+				t.Errorf("first login = %+v, want %+v", got[0], want)
+			}
+
+			if got[1].Success || got[1].AccessCodeID != 0 {
+				t.Errorf("second login = %+v, want a failure with no access code", got[1])
+			}
+		})
+	}
+}
+
+func TestSetAlbumImageOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		albumID    string
+		body       string
+		wantStatus int
+		wantOrder  []string
+	}{
+		{name: "new order", albumID: "3", body: `{"imagePaths": ["c.jpg", "a.jpg"]}`, wantStatus: http.StatusOK, wantOrder: []string{"c.jpg", "a.jpg"}},
+		{name: "paths and duplicates", albumID: "3", body: `{"imagePaths": ["Jane/Wedding/c.jpg", "../a.jpg", "c.jpg", "/"]}`, wantStatus: http.StatusOK, wantOrder: []string{"c.jpg", "a.jpg"}},
+		{name: "clear", albumID: "3", body: `{"imagePaths": []}`, wantStatus: http.StatusOK, wantOrder: []string{}},
+		{name: "unknown album", albumID: "4", body: `{"imagePaths": ["a.jpg"]}`, wantStatus: http.StatusNotFound},
+		{name: "bad body", albumID: "3", body: `not json`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			albumService := &fakeAlbumService{}
+			controller := NewAdminController(AdminControllerConfig{AlbumService: albumService})
+
+			r := httptest.NewRequest(http.MethodPut, "/admin/albums/"+tt.albumID+"/image-order", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			r.SetPathValue("albumid", tt.albumID)
+
+			w := httptest.NewRecorder()
+			controller.SetAlbumImageOrder(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if tt.wantOrder != nil && !slices.Equal(albumService.imageOrder, tt.wantOrder) {
+				t.Errorf("stored order = %v, want %v", albumService.imageOrder, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func TestSetAlbumDownloadPermission(t *testing.T) {
+	tests := []struct {
+		name       string
+		albumID    string
+		body       string
+		wantStatus int
+		wantStored bool
+		wantAllow  bool
+	}{
+		{name: "turn off", albumID: "3", body: `{"allowDownload": false}`, wantStatus: http.StatusOK, wantStored: true, wantAllow: false},
+		{name: "turn on", albumID: "3", body: `{"allowDownload": true}`, wantStatus: http.StatusOK, wantStored: true, wantAllow: true},
+		{name: "missing flag", albumID: "3", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown album", albumID: "4", body: `{"allowDownload": false}`, wantStatus: http.StatusNotFound},
+		{name: "bad body", albumID: "3", body: `not json`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			albumService := &fakeAlbumService{}
+			controller := NewAdminController(AdminControllerConfig{AlbumService: albumService})
+
+			r := httptest.NewRequest(http.MethodPut, "/admin/albums/"+tt.albumID+"/download-permission", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			r.SetPathValue("albumid", tt.albumID)
+
+			w := httptest.NewRecorder()
+			controller.SetAlbumDownloadPermission(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if !tt.wantStored {
+				if len(albumService.allowDownload) != 0 {
+					t.Errorf("stored %v, want nothing stored", albumService.allowDownload)
+				}
+
+				return
+			}
+
+			if allowed, ok := albumService.allowDownload[3]; !ok || allowed != tt.wantAllow {
+				t.Errorf("stored allowDownload = %v (set %v), want %v", allowed, ok, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestSetAlbumPurchased(t *testing.T) {
+	tests := []struct {
+		name          string
+		albumID       string
+		body          string
+		wantStatus    int
+		wantStored    bool
+		wantPurchased bool
+	}{
+		{name: "mark unpurchased", albumID: "3", body: `{"purchased": false}`, wantStatus: http.StatusOK, wantStored: true, wantPurchased: false},
+		{name: "mark purchased", albumID: "3", body: `{"purchased": true}`, wantStatus: http.StatusOK, wantStored: true, wantPurchased: true},
+		{name: "missing flag", albumID: "3", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown album", albumID: "4", body: `{"purchased": true}`, wantStatus: http.StatusNotFound},
+		{name: "bad body", albumID: "3", body: `not json`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			albumService := &fakeAlbumService{}
+			cacheCreator := &fakeCacheCreator{}
+			controller := NewAdminController(AdminControllerConfig{AlbumService: albumService, CacheCreator: cacheCreator})
+
+			r := httptest.NewRequest(http.MethodPut, "/admin/albums/"+tt.albumID+"/purchased", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			r.SetPathValue("albumid", tt.albumID)
+
+			w := httptest.NewRecorder()
+			controller.SetAlbumPurchased(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if !tt.wantStored {
+				if len(albumService.purchased) != 0 || len(cacheCreator.rebuilt) != 0 {
+					t.Errorf("stored %v and rebuilt %d albums, want nothing changed", albumService.purchased, len(cacheCreator.rebuilt))
+				}
+
+				return
+			}
+
+			if purchased, ok := albumService.purchased[3]; !ok || purchased != tt.wantPurchased {
+				t.Errorf("stored purchased = %v (set %v), want %v", purchased, ok, tt.wantPurchased)
+			}
+
+			// The previews are rendered for the album as it is now
+			if len(cacheCreator.rebuilt) != 1 || cacheCreator.rebuilt[0].Purchased != tt.wantPurchased {
+				t.Errorf("rebuilt %+v, want album 3 with purchased %v", cacheCreator.rebuilt, tt.wantPurchased)
+			}
+		})
+	}
+}
+
+func TestExportClientFavorites(t *testing.T) {
+	favoritedAt := time.Date(2024, time.June, 1, 12, 30, 0, 0, time.UTC)
+
+	albumService := &fakeAlbumService{favorites: []models.ClientFavorite{
+		{AlbumID: 3, AlbumName: "Smith, Jane & John Wedding", ImagePath: "a.jpg", CreatedAt: favoritedAt},
+		{AlbumID: 3, AlbumName: "Smith, Jane & John Wedding", ImagePath: "b \"final\".jpg", CreatedAt: favoritedAt.Add(time.Minute)},
+		{AlbumID: 5, AlbumName: "Engagement", ImagePath: "c.jpg", CreatedAt: favoritedAt.Add(time.Hour)},
+	}}
+
+	controller := NewAdminController(AdminControllerConfig{AlbumService: albumService})
+
+	tests := []struct {
+		name     string
+		clientID string
+		want     [][]string
+	}{
+		{
+			name:     "client with favorites",
+			clientID: "1",
+			want: [][]string{
+				{"Album", "Image", "Favorited At"},
+				{"Smith, Jane & John Wedding", "a.jpg", "2024-06-01T12:30:00Z"},
+				{"Smith, Jane & John Wedding", "b \"final\".jpg", "2024-06-01T12:31:00Z"},
+				{"Engagement", "c.jpg", "2024-06-01T13:30:00Z"},
+			},
+		},
+		{name: "client without favorites", clientID: "2", want: [][]string{{"Album", "Image", "Favorited At"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin/clients/"+tt.clientID+"/favorites.csv", nil)
+			r.SetPathValue("clientid", tt.clientID)
+
+			w := httptest.NewRecorder()
+			controller.ExportClientFavorites(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+
+			if got := w.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+				t.Errorf("Content-Type = %q, want a CSV", got)
+			}
+
+			rows, err := csv.NewReader(w.Body).ReadAll()
+			if err != nil {
+				t.Fatalf("error reading the CSV: %v", err)
+			}
+
+			if !slices.EqualFunc(rows, tt.want, slices.Equal) {
+				t.Errorf("rows = %q, want %q", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetAlbumMaxFavorites(t *testing.T) {
+	tests := []struct {
+		name       string
+		albumID    string
+		body       string
+		wantStatus int
+		wantStored *sql.NullInt64
+	}{
+		{name: "set a limit", albumID: "3", body: `{"maxFavorites": 20}`, wantStatus: http.StatusOK, wantStored: &sql.NullInt64{Int64: 20, Valid: true}},
+		{name: "remove the limit", albumID: "3", body: `{"maxFavorites": null}`, wantStatus: http.StatusOK, wantStored: &sql.NullInt64{}},
+		{name: "zero", albumID: "3", body: `{"maxFavorites": 0}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown album", albumID: "4", body: `{"maxFavorites": 20}`, wantStatus: http.StatusNotFound},
+		{name: "bad body", albumID: "3", body: `not json`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			albumService := &fakeAlbumService{}
+			controller := NewAdminController(AdminControllerConfig{AlbumService: albumService})
+
+			r := httptest.NewRequest(http.MethodPut, "/admin/albums/"+tt.albumID+"/max-favorites", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			r.SetPathValue("albumid", tt.albumID)
+
+			w := httptest.NewRecorder()
+			controller.SetAlbumMaxFavorites(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			stored, ok := albumService.maxFavorites[3]
+
+			if tt.wantStored == nil {
+				if ok {
+					t.Errorf("stored %+v, want nothing changed", stored)
+				}
+
+				return
+			}
+
+			if !ok || stored != *tt.wantStored {
+				t.Errorf("stored %+v (set %v), want %+v", stored, ok, *tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestCreateGallery(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "created", body: `{"clientID": 1, "name": "Smith Wedding"}`, wantStatus: http.StatusCreated},
+		{name: "no name", body: `{"clientID": 1, "name": " "}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown client", body: `{"clientID": 2, "name": "Smith Wedding"}`, wantStatus: http.StatusBadRequest},
+		{name: "bad body", body: `not json`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := NewAdminController(AdminControllerConfig{AlbumService: &fakeAlbumService{}})
+
+			r := httptest.NewRequest(http.MethodPost, "/admin/galleries", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			controller.CreateGallery(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			got := galleryResponse{}
+
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+
+			if got.ID != 4 || got.ClientID != 1 || got.Name != "Smith Wedding" {
+				t.Errorf("response = %+v, want gallery 4 for client 1", got)
+			}
+		})
+	}
+}
+
+func TestSetAlbumGallery(t *testing.T) {
+	tests := []struct {
+		name       string
+		albumID    string
+		body       string
+		wantStatus int
+		wantStored *sql.NullInt64
+	}{
+		{name: "add to a gallery", albumID: "3", body: `{"galleryID": 4}`, wantStatus: http.StatusOK, wantStored: &sql.NullInt64{Int64: 4, Valid: true}},
+		{name: "remove from its gallery", albumID: "3", body: `{"galleryID": null}`, wantStatus: http.StatusOK, wantStored: &sql.NullInt64{}},
+		{name: "another client's gallery", albumID: "3", body: `{"galleryID": 5}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown gallery", albumID: "3", body: `{"galleryID": 9}`, wantStatus: http.StatusNotFound},
+		{name: "unknown album", albumID: "8", body: `{"galleryID": 4}`, wantStatus: http.StatusNotFound},
+		{name: "bad body", albumID: "3", body: `not json`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			albumService := &fakeAlbumService{}
+			controller := NewAdminController(AdminControllerConfig{AlbumService: albumService})
+
+			r := httptest.NewRequest(http.MethodPut, "/admin/albums/"+tt.albumID+"/gallery", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			r.SetPathValue("albumid", tt.albumID)
+
+			w := httptest.NewRecorder()
+			controller.SetAlbumGallery(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			stored, ok := albumService.galleries[3]
+
+			if tt.wantStored == nil {
+				if ok {
+					t.Errorf("stored %+v, want nothing changed", stored)
+				}
+
+				return
+			}
+
+			if !ok || stored != *tt.wantStored {
+				t.Errorf("stored %+v (set %v), want %+v", stored, ok, *tt.wantStored)
+			}
+		})
+	}
+}
+
+/*
+fakeHomePagePhotoService keeps flags in memory, forgetting photos whose
+flags are both cleared the way the real service does. Anything else panics
+through the nil embedded interface.
+*/
+type fakeHomePagePhotoService struct {
+	services.HomePagePhotoServicer
+
+	flags map[string]models.HomePagePhotoFlag
+}
+
+func (f *fakeHomePagePhotoService) GetFlags() (map[string]models.HomePagePhotoFlag, error) {
+	return f.flags, nil
+}
+
+func (f *fakeHomePagePhotoService) SetFlags(fileName string, hidden, featured bool) (models.HomePagePhotoFlag, error) {
+	flag := models.HomePagePhotoFlag{FileName: fileName, Hidden: hidden, Featured: featured}
+
+	if !hidden && !featured {
+		delete(f.flags, fileName)
+	} else {
+		f.flags[fileName] = flag
+	}
+
+	return flag, nil
+}
+
+func TestSetHomePagePhotoFlags(t *testing.T) {
+	tests := []struct {
+		name       string
+		fileName   string
+		body       string
+		wantStatus int
+		wantFlag   models.HomePagePhotoFlag
+		wantStored bool
+	}{
+		{name: "hide", fileName: "new.jpg", body: `{"hidden": true}`, wantStatus: http.StatusOK, wantFlag: models.HomePagePhotoFlag{FileName: "new.jpg", Hidden: true}, wantStored: true},
+		{name: "feature keeps hidden", fileName: "hidden.jpg", body: `{"featured": true}`, wantStatus: http.StatusOK, wantFlag: models.HomePagePhotoFlag{FileName: "hidden.jpg", Hidden: true, Featured: true}, wantStored: true},
+		{name: "clear", fileName: "hidden.jpg", body: `{"hidden": false}`, wantStatus: http.StatusOK, wantFlag: models.HomePagePhotoFlag{FileName: "hidden.jpg"}},
+		{name: "bad body", fileName: "hidden.jpg", body: `not json`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			homePagePhotoService := &fakeHomePagePhotoService{
+				flags: map[string]models.HomePagePhotoFlag{
+					"hidden.jpg": {FileName: "hidden.jpg", Hidden: true},
+				},
+			}
+
+			controller := NewAdminController(AdminControllerConfig{HomePagePhotoService: homePagePhotoService})
+
+			r := httptest.NewRequest(http.MethodPut, "/admin/home-page/photos/"+tt.fileName+"/flags", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			r.SetPathValue("filename", tt.fileName)
+
+			w := httptest.NewRecorder()
+			controller.SetHomePagePhotoFlags(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			stored, ok := homePagePhotoService.flags[tt.fileName]
+
+			if ok != tt.wantStored || (ok && stored != tt.wantFlag) {
+				t.Errorf("stored flag = %+v, %v; want %+v, %v", stored, ok, tt.wantFlag, tt.wantStored)
+			}
+
+			if want := fmt.Sprintf(`"hidden":%v,"featured":%v`, tt.wantFlag.Hidden, tt.wantFlag.Featured); !strings.Contains(w.Body.String(), want) {
+				t.Errorf("body = %s, want it to contain %s", w.Body.String(), want)
+			}
+		})
+	}
+}
+
+/*
+fakeCacheCreator regenerates thumbnails for album 3's originals only,
+rejecting other keys the way the real service does, and records album
+rebuilds. Anything else panics through the nil embedded interface.
+*/
+type fakeCacheCreator struct {
+	cache.CacheCreator
+
+	rebuilt     []*models.Album
+	regenerated []string
+}
+
+func (f *fakeCacheCreator) CreateAlbumCacheInBackground(album *models.Album) {
+	f.rebuilt = append(f.rebuilt, album)
+}
+
+func (f *fakeCacheCreator) RegenerateThumbnail(album *models.Album, originalKey string) error {
+	if !strings.HasPrefix(originalKey, "clients/1/3/originals/") {
+		return fmt.Errorf("%w: '%s' is not an original in album %d", services.ErrInvalidInput, originalKey, album.ID)
+	}
+
+	f.regenerated = append(f.regenerated, originalKey)
+	return nil
+}
+
+func (f *fakeCacheCreator) ThumbnailFormat() cache.ThumbnailFormat {
+	return cache.JpegThumbnails
+}
+
+/*
+statS3Client knows which keys exist and hands out fake presigned URLs.
+Anything else panics through the nil embedded interface.
+*/
+type statS3Client struct {
+	s3.S3Client
+
+	keys []string
+}
+
+func (c statS3Client) StatObject(bucket, key string) (*s3.ObjectMetadata, error) {
+	if !slices.Contains(c.keys, key) {
+		return nil, nil
+	}
+
+	return &s3.ObjectMetadata{}, nil
+}
+
+func (c statS3Client) GetUrl(bucket, key string, options ...geturloptions.GetUrlOption) (string, error) {
+	return "https://s3.example.com/" + key + "?X-Amz-Signature=abc", nil
+}
+
+func TestUploadEditedImagesNeedsAnOriginal(t *testing.T) {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+
+	part, _ := form.CreateFormFile("files", "missing.jpg")
+	_, _ = part.Write([]byte("\xff\xd8\xff\xe0 edited"))
+	_ = form.Close()
+
+	controller := NewAdminController(AdminControllerConfig{
+		AlbumService:      &fakeAlbumService{},
+		ClientPhotoFolder: "clients",
+		S3Client:          statS3Client{keys: []string{"clients/1/3/originals/a.jpg"}},
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/admin/albums/3/edited", body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r.SetPathValue("albumid", "3")
+
+	w := httptest.NewRecorder()
+	controller.UploadEditedImages(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+
+	got := struct {
+		Keys     []string         `json:"keys"`
+		Rejected []rejectedUpload `json:"rejected"`
+	}{}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+
+	if len(got.Keys) != 0 || len(got.Rejected) != 1 || got.Rejected[0].Filename != "missing.jpg" || !strings.Contains(got.Rejected[0].Error, ErrNoOriginal.Error()) {
+		t.Errorf("response = %+v, want missing.jpg rejected for having no original", got)
+	}
+}
+
+func TestRegenerateThumbnail(t *testing.T) {
+	tests := []struct {
+		name            string
+		albumID         string
+		key             string
+		wantStatus      int
+		wantRegenerated bool
+	}{
+		{name: "valid", albumID: "3", key: "clients/1/3/originals/a.jpg", wantStatus: http.StatusOK, wantRegenerated: true},
+		{name: "outside the album", albumID: "3", key: "clients/2/3/originals/other.jpg", wantStatus: http.StatusBadRequest},
+		{name: "missing original", albumID: "3", key: "clients/1/3/originals/gone.jpg", wantStatus: http.StatusNotFound},
+		{name: "no key", albumID: "3", wantStatus: http.StatusBadRequest},
+		{name: "unknown album", albumID: "9", key: "clients/1/9/originals/a.jpg", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheCreator := &fakeCacheCreator{}
+
+			controller := NewAdminController(AdminControllerConfig{
+				AlbumService:      &fakeAlbumService{},
+				Bucket:            "bucket",
+				CacheCreator:      cacheCreator,
+				ClientPhotoFolder: "clients",
+				S3Client:          statS3Client{keys: []string{"clients/1/3/originals/a.jpg", "clients/2/3/originals/other.jpg"}},
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/admin/albums/"+tt.albumID+"/thumbnail/regenerate?key="+tt.key, nil)
+			r.SetPathValue("albumid", tt.albumID)
+
+			w := httptest.NewRecorder()
+			controller.RegenerateThumbnail(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if regenerated := len(cacheCreator.regenerated) > 0; regenerated != tt.wantRegenerated {
+				t.Errorf("regenerated = %v, want %v", cacheCreator.regenerated, tt.wantRegenerated)
+			}
+
+			if !tt.wantRegenerated {
+				return
+			}
+
+			if want := `"thumbnailURL":"https://s3.example.com/clients/1/3/thumbnails/a.jpg?X-Amz-Signature=abc"`; !strings.Contains(w.Body.String(), want) {
+				t.Errorf("body = %s, want it to contain %s", w.Body.String(), want)
+			}
+		})
+	}
+}
+
+/*
+fakeZipService reports a fixed cleanup result and counts how many times it
+ran. Anything else panics through the nil embedded interface.
+*/
+type fakeZipService struct {
+	services.ZipServicer
+
+	cleanups int
+	err      error
+	removed  int
+}
+
+func (f *fakeZipService) CleanupExpiredZips() (int, error) {
+	f.cleanups++
+	return f.removed, f.err
+}
+
+func TestCleanupZips(t *testing.T) {
+	tests := []struct {
+		name       string
+		zipService *fakeZipService
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "zips removed", zipService: &fakeZipService{removed: 3}, wantStatus: http.StatusOK, wantBody: `"removed":3`},
+		{name: "nothing to remove", zipService: &fakeZipService{}, wantStatus: http.StatusOK, wantBody: `"removed":0`},
+		{name: "cleanup fails", zipService: &fakeZipService{removed: 1, err: errors.New("database is down")}, wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := NewAdminController(AdminControllerConfig{ZipService: tt.zipService})
+
+			r := httptest.NewRequest(http.MethodPost, "/admin/cleanup/zips", nil)
+			w := httptest.NewRecorder()
+			controller.CleanupZips(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if tt.zipService.cleanups != 1 {
+				t.Errorf("cleanup ran %d times, want once", tt.zipService.cleanups)
+			}
+
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
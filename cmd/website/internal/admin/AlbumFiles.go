@@ -0,0 +1,70 @@
+package admin
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/listoptions"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/cache"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+const (
+	// maxDeleteKeys is the most keys S3 accepts in one delete request
+	maxDeleteKeys = 1000
+)
+
+var (
+	// albumFolders are the folders under an album's prefix that hold its files
+	albumFolders = []string{"originals", "edited", "thumbnails", "proofs", "hero-banner", "downloads"}
+)
+
+/*
+removeAlbumFiles deletes everything stored for an album, including the
+dimension sidecar written by the cache run. Each folder is cleaned up on its own so one failure doesn't stop the rest, and errors are
+only logged.
+*/
+func (c AdminController) removeAlbumFiles(l *slog.Logger, album *models.Album) {
+	prefixes := []string{}
+
+	for _, folder := range albumFolders {
+		prefixes = append(prefixes, fmt.Sprintf("%s/%d/%d/%s/", c.clientPhotoFolder, album.ClientID, album.ID, folder))
+	}
+
+	// Listing the sidecar's key only matches the sidecar itself
+	prefixes = append(prefixes, cache.ImageDimensionsKey(c.clientPhotoFolder, album))
+
+	for _, prefix := range prefixes {
+		if err := c.removePrefix(prefix); err != nil {
+			l.Error("error removing album files", "error", err, "albumID", album.ID, "prefix", prefix)
+		}
+	}
+}
+
+func (c AdminController) removePrefix(prefix string) error {
+	var (
+		err  error
+		list s3.ListResponse
+	)
+
+	if list, err = c.s3Client.List(c.bucket, prefix, listoptions.WithGetAll()); err != nil {
+		return fmt.Errorf("error listing '%s': %w", prefix, err)
+	}
+
+	keys := make([]string, 0, len(list.Objects))
+
+	for _, object := range list.Objects {
+		keys = append(keys, object.Key)
+	}
+
+	for start := 0; start < len(keys); start += maxDeleteKeys {
+		batch := keys[start:min(start+maxDeleteKeys, len(keys))]
+
+		if _, err = c.s3Client.Delete(c.bucket, batch); err != nil {
+			return fmt.Errorf("error deleting %d objects under '%s': %w", len(batch), prefix, err)
+		}
+	}
+
+	return nil
+}
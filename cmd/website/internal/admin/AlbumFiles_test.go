@@ -0,0 +1,167 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/deleteoptions"
+	"github.com/adampresley/adamgokit/s3/listoptions"
+)
+
+/*
+listingS3Client lists keys by prefix and records what is deleted. Listing a
+prefix in failList fails. Anything else panics through the nil embedded
+interface.
+*/
+type listingS3Client struct {
+	s3.S3Client
+
+	keys     []string
+	failList string
+	deleted  [][]string
+}
+
+func (c *listingS3Client) List(bucket, path string, options ...listoptions.ListOption) (s3.ListResponse, error) {
+	if path == c.failList {
+		return s3.ListResponse{}, errors.New("storage is down")
+	}
+
+	result := s3.ListResponse{}
+
+	for _, key := range c.keys {
+		if strings.HasPrefix(key, path) {
+			result.Objects = append(result.Objects, s3.Object{Key: key})
+		}
+	}
+
+	result.NumObjects = len(result.Objects)
+	return result, nil
+}
+
+func (c *listingS3Client) Delete(bucket string, keys []string, options ...deleteoptions.DeleteOption) (s3.DeleteResponse, error) {
+	c.deleted = append(c.deleted, keys)
+	return s3.DeleteResponse{DeletedKeys: keys}, nil
+}
+
+func (c *listingS3Client) deletedKeys() []string {
+	result := []string{}
+
+	for _, batch := range c.deleted {
+		result = append(result, batch...)
+	}
+
+	slices.Sort(result)
+	return result
+}
+
+var albumKeys = []string{
+	"clients/1/3/originals/a.jpg",
+	"clients/1/3/originals/b.jpg",
+	"clients/1/3/edited/a.jpg",
+	"clients/1/3/thumbnails/a.jpg",
+	"clients/1/3/proofs/a.jpg",
+	"clients/1/3/hero-banner/a.jpg",
+	"clients/1/3/downloads/Wedding.zip",
+	"clients/1/3/dimensions.json",
+	"clients/1/3/notes.txt",
+	"clients/1/30/originals/other.jpg",
+	"clients/2/3/originals/other.jpg",
+}
+
+func TestDeleteAlbum(t *testing.T) {
+	tests := []struct {
+		name        string
+		albumID     string
+		failList    string
+		wantStatus  int
+		wantDeleted []string
+	}{
+		{
+			name:       "album",
+			albumID:    "3",
+			wantStatus: http.StatusNoContent,
+			wantDeleted: []string{
+				"clients/1/3/dimensions.json",
+				"clients/1/3/downloads/Wedding.zip",
+				"clients/1/3/edited/a.jpg",
+				"clients/1/3/hero-banner/a.jpg",
+				"clients/1/3/originals/a.jpg",
+				"clients/1/3/originals/b.jpg",
+				"clients/1/3/proofs/a.jpg",
+				"clients/1/3/thumbnails/a.jpg",
+			},
+		},
+		{
+			name:       "storage error",
+			albumID:    "3",
+			failList:   "clients/1/3/originals/",
+			wantStatus: http.StatusNoContent,
+			wantDeleted: []string{
+				"clients/1/3/dimensions.json",
+				"clients/1/3/downloads/Wedding.zip",
+				"clients/1/3/edited/a.jpg",
+				"clients/1/3/hero-banner/a.jpg",
+				"clients/1/3/proofs/a.jpg",
+				"clients/1/3/thumbnails/a.jpg",
+			},
+		},
+		{name: "unknown album", albumID: "4", wantStatus: http.StatusNotFound, wantDeleted: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			albumService := &fakeAlbumService{}
+			s3Client := &listingS3Client{keys: albumKeys, failList: tt.failList}
+
+			controller := NewAdminController(AdminControllerConfig{
+				AlbumService:      albumService,
+				ClientPhotoFolder: "clients",
+				S3Client:          s3Client,
+			})
+
+			r := httptest.NewRequest(http.MethodDelete, "/admin/albums/"+tt.albumID, nil)
+			r.SetPathValue("albumid", tt.albumID)
+
+			w := httptest.NewRecorder()
+			controller.DeleteAlbum(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			// The album is deleted even when storage cleanup fails
+			if tt.wantStatus == http.StatusNoContent && !slices.Equal(albumService.deleted, []uint{3}) {
+				t.Errorf("deleted albums = %v, want album 3", albumService.deleted)
+			}
+
+			if got := s3Client.deletedKeys(); !slices.Equal(got, tt.wantDeleted) {
+				t.Errorf("deleted keys = %v, want %v", got, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestRemoveAlbumFilesBatchesDeletes(t *testing.T) {
+	keys := make([]string, maxDeleteKeys+1)
+
+	for i := range keys {
+		keys[i] = fmt.Sprintf("clients/1/3/thumbnails/%d.jpg", i)
+	}
+
+	s3Client := &listingS3Client{keys: keys}
+	controller := NewAdminController(AdminControllerConfig{ClientPhotoFolder: "clients", S3Client: s3Client})
+
+	if err := controller.removePrefix("clients/1/3/thumbnails/"); err != nil {
+		t.Fatalf("removePrefix() = %v", err)
+	}
+
+	if len(s3Client.deleted) != 2 || len(s3Client.deleted[0]) != maxDeleteKeys || len(s3Client.deleted[1]) != 1 {
+		t.Errorf("delete batches = %d, want one full batch and one key", len(s3Client.deleted))
+	}
+}
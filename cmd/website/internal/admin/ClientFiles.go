@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+/*
+removeClientFilesInBackground deletes a client's whole photo folder without
+holding up the request. Failures are only logged, since the client is
+already gone from the database.
+*/
+func (c AdminController) removeClientFilesInBackground(l *slog.Logger, clientID uint) {
+	prefix := fmt.Sprintf("%s/%d/", c.clientPhotoFolder, clientID)
+
+	c.cleanups.Add(1)
+
+	go func() {
+		defer c.cleanups.Done()
+
+		if err := c.removePrefix(prefix); err != nil {
+			l.Error("error removing client files", "error", err, "clientID", clientID, "prefix", prefix)
+			return
+		}
+
+		l.Info("removed client files", "clientID", clientID, "prefix", prefix)
+	}()
+}
+
+/*
+Shutdown waits for background storage cleanups to finish, or until ctx is
+done.
+*/
+func (c AdminController) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+
+	go func() {
+		c.cleanups.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for storage cleanups to finish: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,72 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDeleteClient(t *testing.T) {
+	tests := []struct {
+		name        string
+		clientID    string
+		wantStatus  int
+		wantDeleted []string
+	}{
+		{
+			name:       "client",
+			clientID:   "1",
+			wantStatus: http.StatusNoContent,
+			wantDeleted: []string{
+				"clients/1/3/dimensions.json",
+				"clients/1/3/downloads/Wedding.zip",
+				"clients/1/3/hero-banner/a.jpg",
+				"clients/1/3/notes.txt",
+				"clients/1/3/originals/a.jpg",
+				"clients/1/3/originals/b.jpg",
+				"clients/1/3/proofs/a.jpg",
+				"clients/1/3/thumbnails/a.jpg",
+				"clients/1/30/originals/other.jpg",
+			},
+		},
+		{name: "unknown client", clientID: "2", wantStatus: http.StatusNotFound, wantDeleted: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientService := &fakeClientService{}
+			s3Client := &listingS3Client{keys: albumKeys}
+
+			controller := NewAdminController(AdminControllerConfig{
+				ClientPhotoFolder: "clients",
+				ClientService:     clientService,
+				S3Client:          s3Client,
+			})
+
+			r := httptest.NewRequest(http.MethodDelete, "/admin/clients/"+tt.clientID, nil)
+			r.SetPathValue("clientid", tt.clientID)
+
+			w := httptest.NewRecorder()
+			controller.DeleteClient(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			// Shutdown waits for the background cleanup
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			if err := controller.Shutdown(ctx); err != nil {
+				t.Fatalf("Shutdown() = %v", err)
+			}
+
+			if got := s3Client.deletedKeys(); !slices.Equal(got, tt.wantDeleted) {
+				t.Errorf("deleted keys = %v, want %v", got, tt.wantDeleted)
+			}
+		})
+	}
+}
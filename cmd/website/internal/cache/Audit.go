@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/listoptions"
+	"github.com/adampresley/adampresleyphotography/pkg/metrics"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/alitto/pond/v2"
+)
+
+/*
+AlbumAudit lists an album's thumbnails that are out of step with its
+originals. Names are image names, not keys. Orphaned holds thumbnail names,
+which carry the thumbnail format's suffix, and the others original names.
+*/
+type AlbumAudit struct {
+	ClientID  uint   `json:"clientID"`
+	AlbumID   uint   `json:"albumID"`
+	AlbumName string `json:"albumName"`
+
+	// Purchased albums are audited against their thumbnails, the others against their proofs
+	Purchased bool `json:"purchased"`
+
+	// Orphaned thumbnails have no matching original, including thumbnails in another format
+	Orphaned []string `json:"orphaned"`
+
+	// Missing thumbnails are originals without a thumbnail
+	Missing []string `json:"missing"`
+
+	// Stale thumbnails are older than their original
+	Stale []string `json:"stale"`
+}
+
+/*
+Consistent reports whether every original has an up to date thumbnail and
+every thumbnail has an original.
+*/
+func (a AlbumAudit) Consistent() bool {
+	return len(a.Orphaned) == 0 && len(a.Missing) == 0 && len(a.Stale) == 0
+}
+
+/*
+AuditResult is what Audit found across every client's albums. Albums that
+couldn't be listed are in Errors rather than stopping the audit.
+*/
+type AuditResult struct {
+	Albums []AlbumAudit `json:"albums"`
+	Errors []string     `json:"errors,omitempty"`
+}
+
+/*
+Audit compares each album's thumbnails with its originals. It only reads
+from the bucket. Pass the result to Repair to fix what it found.
+*/
+func (c CacheCreatorService) Audit() (AuditResult, error) {
+	var (
+		err     error
+		clients []models.Client
+		albums  []*models.Album
+		audit   AlbumAudit
+	)
+
+	result := AuditResult{
+		Albums: []AlbumAudit{},
+	}
+
+	if clients, err = c.clientService.GetAll(); err != nil {
+		return result, fmt.Errorf("error retrieving clients: %w", err)
+	}
+
+	for _, client := range clients {
+		if albums, err = c.albumService.GetAlbumList(client.ID); err != nil {
+			return result, fmt.Errorf("error retrieving albums for client %d: %w", client.ID, err)
+		}
+
+		for _, album := range albums {
+			if audit, err = c.AuditAlbum(album); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("album %d: %s", album.ID, err.Error()))
+				continue
+			}
+
+			result.Albums = append(result.Albums, audit)
+		}
+	}
+
+	return result, nil
+}
+
+/*
+AuditAlbum compares a single album's thumbnails with its originals.
+*/
+func (c CacheCreatorService) AuditAlbum(album *models.Album) (AlbumAudit, error) {
+	var (
+		err        error
+		originals  []s3.Object
+		thumbnails s3.ListResponse
+	)
+
+	result := AlbumAudit{
+		ClientID:  album.ClientID,
+		AlbumID:   album.ID,
+		AlbumName: album.Name,
+		Purchased: album.Purchased,
+		Orphaned:  []string{},
+		Missing:   []string{},
+		Stale:     []string{},
+	}
+
+	if originals, err = c.getAlbumImageListing(album); err != nil {
+		return result, err
+	}
+
+	thumbnails, err = c.listObjects(
+		c.albumFolder(album, PreviewFolder(album))+"/",
+		listoptions.WithGetAll(),
+	)
+
+	if err != nil {
+		return result, fmt.Errorf("error listing album thumbnails: %w", err)
+	}
+
+	thumbnailsByName := map[string]s3.Object{}
+
+	for _, thumbnail := range thumbnails.Objects {
+		thumbnailsByName[filepath.Base(thumbnail.Key)] = thumbnail
+	}
+
+	expected := map[string]bool{}
+
+	for _, original := range originals {
+		name := filepath.Base(original.Key)
+		expected[name+c.thumbnailFormat.Suffix] = true
+
+		thumbnail, ok := thumbnailsByName[name+c.thumbnailFormat.Suffix]
+
+		switch {
+		case !ok:
+			result.Missing = append(result.Missing, name)
+
+		case thumbnail.LastModified.Before(original.LastModified):
+			result.Stale = append(result.Stale, name)
+		}
+	}
+
+	for name := range thumbnailsByName {
+		if !expected[name] {
+			result.Orphaned = append(result.Orphaned, name)
+		}
+	}
+
+	sort.Strings(result.Orphaned)
+	sort.Strings(result.Missing)
+	sort.Strings(result.Stale)
+
+	return result, nil
+}
+
+/*
+Repair deletes orphaned thumbnails and renders missing and stale ones for
+each audited album. It keeps going when something fails, logging each
+problem, and returns how many thumbnails it deleted and rendered.
+*/
+func (c CacheCreatorService) Repair(audits []AlbumAudit) (int, int) {
+	var (
+		err      error
+		response s3.DeleteResponse
+		deleted  int
+	)
+
+	pool := pond.NewPool(
+		c.maxCacheWorkers,
+		pond.WithContext(c.shutdownCtx),
+		pond.WithQueueSize(c.maxCacheWorkers*queueSizePerWorker),
+	)
+
+	progress := newCacheProgress(defaultProgressInterval)
+
+	for _, audit := range audits {
+		album := &models.Album{
+			BaseModel: models.BaseModel{ID: audit.AlbumID},
+			ClientID:  audit.ClientID,
+			Name:      audit.AlbumName,
+			Purchased: audit.Purchased,
+		}
+
+		if len(audit.Orphaned) > 0 {
+			keys := make([]string, 0, len(audit.Orphaned))
+
+			for _, name := range audit.Orphaned {
+				keys = append(keys, filepath.Join(c.albumFolder(album, PreviewFolder(album)), name))
+			}
+
+			if response, err = c.s3Client.Delete(c.awsBucket, keys); err != nil {
+				slog.Error("error deleting orphaned thumbnails", "clientID", album.ClientID, "albumID", album.ID, "error", err)
+			} else {
+				deleted += len(response.DeletedKeys)
+			}
+		}
+
+		for _, name := range append(append([]string{}, audit.Missing...), audit.Stale...) {
+			originalKey := filepath.Join(c.albumFolder(album, "originals"), name)
+			progress.submit()
+
+			pool.Submit(func() {
+				if err := c.createThumbnail(album, originalKey); err != nil {
+					slog.Error("error rendering thumbnail", "clientID", album.ClientID, "albumID", album.ID, "key", originalKey, "error", err)
+					progress.fail()
+					return
+				}
+
+				metrics.CacheThumbnailsCreated.Inc()
+				progress.complete()
+			})
+		}
+	}
+
+	_ = pool.Stop().Wait()
+	progress.finish()
+
+	return deleted, int(progress.completed.Load())
+}
+
+func (c CacheCreatorService) albumFolder(album *models.Album, folder string) string {
+	return filepath.Join(
+		c.clientsPhotoFolder,
+		fmt.Sprint(album.ClientID),
+		fmt.Sprint(album.ID),
+		folder,
+	)
+}
@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+func newAuditTestService(s3Client *memoryS3Client) CacheCreatorService {
+	return NewCacheCreatorService(CacheCreatorConfig{
+		AlbumService: fakeAlbumService{albums: map[uint][]*models.Album{
+			1: {{BaseModel: models.BaseModel{ID: 3}, ClientID: 1, Name: "Wedding", Purchased: true}},
+		}},
+		ClientService:      fakeClientService{clients: []models.Client{{BaseModel: models.BaseModel{ID: 1}}}},
+		ClientsPhotoFolder: "clients",
+		MaxCacheWorkers:    2,
+		S3Client:           s3Client,
+		ShutdownCtx:        context.Background(),
+	})
+}
+
+func TestAudit(t *testing.T) {
+	now := time.Now()
+	original := encodeJpeg(t, testImage(40, 20))
+
+	tests := []struct {
+		name         string
+		objects      map[string]time.Time
+		wantOrphaned []string
+		wantMissing  []string
+		wantStale    []string
+	}{
+		{
+			name: "consistent",
+			objects: map[string]time.Time{
+				"clients/1/3/originals/a.jpg":  now.Add(-time.Hour),
+				"clients/1/3/thumbnails/a.jpg": now,
+			},
+		},
+		{
+			name: "orphaned thumbnail",
+			objects: map[string]time.Time{
+				"clients/1/3/originals/a.jpg":  now.Add(-time.Hour),
+				"clients/1/3/thumbnails/a.jpg": now,
+				"clients/1/3/thumbnails/b.jpg": now,
+			},
+			wantOrphaned: []string{"b.jpg"},
+		},
+		{
+			name: "missing thumbnail",
+			objects: map[string]time.Time{
+				"clients/1/3/originals/a.jpg":  now.Add(-time.Hour),
+				"clients/1/3/originals/b.jpg":  now.Add(-time.Hour),
+				"clients/1/3/thumbnails/a.jpg": now,
+			},
+			wantMissing: []string{"b.jpg"},
+		},
+		{
+			name: "stale thumbnail",
+			objects: map[string]time.Time{
+				"clients/1/3/originals/a.jpg":  now,
+				"clients/1/3/thumbnails/a.jpg": now.Add(-time.Hour),
+			},
+			wantStale: []string{"a.jpg"},
+		},
+		{
+			name: "other albums are ignored",
+			objects: map[string]time.Time{
+				"clients/1/3/originals/a.jpg":   now.Add(-time.Hour),
+				"clients/1/3/thumbnails/a.jpg":  now,
+				"clients/1/30/thumbnails/b.jpg": now,
+				"clients/1/30/originals/c.jpg":  now,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Client := newMemoryS3Client()
+
+			for key, lastModified := range tt.objects {
+				s3Client.put(key, original, lastModified)
+			}
+
+			result, err := newAuditTestService(s3Client).Audit()
+
+			if err != nil || len(result.Albums) != 1 || len(result.Errors) != 0 {
+				t.Fatalf("Audit() = %+v, %v; want one album", result, err)
+			}
+
+			audit := result.Albums[0]
+
+			for _, check := range []struct {
+				category string
+				got      []string
+				want     []string
+			}{
+				{category: "orphaned", got: audit.Orphaned, want: tt.wantOrphaned},
+				{category: "missing", got: audit.Missing, want: tt.wantMissing},
+				{category: "stale", got: audit.Stale, want: tt.wantStale},
+			} {
+				if check.want == nil {
+					check.want = []string{}
+				}
+
+				if !reflect.DeepEqual(check.got, check.want) {
+					t.Errorf("%s = %v, want %v", check.category, check.got, check.want)
+				}
+			}
+
+			if wantConsistent := tt.wantOrphaned == nil && tt.wantMissing == nil && tt.wantStale == nil; audit.Consistent() != wantConsistent {
+				t.Errorf("Consistent() = %v, want %v", audit.Consistent(), wantConsistent)
+			}
+		})
+	}
+}
+
+func TestRepair(t *testing.T) {
+	now := time.Now()
+	original := encodeJpeg(t, testImage(40, 20))
+	s3Client := newMemoryS3Client()
+
+	s3Client.put("clients/1/3/originals/missing.jpg", original, now.Add(-time.Hour))
+	s3Client.put("clients/1/3/originals/stale.jpg", original, now.Add(-time.Hour))
+	s3Client.put("clients/1/3/thumbnails/stale.jpg", []byte("old"), now.Add(-time.Hour*2))
+	s3Client.put("clients/1/3/thumbnails/orphan.jpg", []byte("orphan"), now)
+
+	service := newAuditTestService(s3Client)
+
+	result, err := service.Audit()
+
+	if err != nil {
+		t.Fatalf("Audit() = %v", err)
+	}
+
+	deleted, rendered := service.Repair(result.Albums)
+
+	if deleted != 1 || rendered != 2 {
+		t.Errorf("Repair() = %d deleted, %d rendered; want 1 and 2", deleted, rendered)
+	}
+
+	if _, ok := s3Client.get("clients/1/3/thumbnails/orphan.jpg"); ok {
+		t.Errorf("orphaned thumbnail was not deleted")
+	}
+
+	if data, _ := s3Client.get("clients/1/3/thumbnails/stale.jpg"); string(data) == "old" {
+		t.Errorf("stale thumbnail was not rendered again")
+	}
+
+	// A second audit finds nothing left to fix
+	if result, err = service.Audit(); err != nil || !result.Albums[0].Consistent() {
+		t.Errorf("Audit() after Repair() = %+v, %v; want a consistent album", result, err)
+	}
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+const (
+	maxPendingThumbnailWrites = 32
+)
+
+/*
+backgroundTasks runs work that outlives the request that started it, such
+as storing a thumbnail rendered on demand. At most limit tasks started with
+tryGo run at once, and Shutdown waits for every task in flight, the same
+way ZipService waits for its zip jobs.
+*/
+type backgroundTasks struct {
+	slots chan struct{}
+	wg    *sync.WaitGroup
+}
+
+func newBackgroundTasks(limit int) *backgroundTasks {
+	return &backgroundTasks{
+		slots: make(chan struct{}, limit),
+		wg:    &sync.WaitGroup{},
+	}
+}
+
+/*
+tryGo runs fn in the background if a slot is free. It never blocks the
+caller. Returns false, without running fn, when every slot is taken.
+*/
+func (b *backgroundTasks) tryGo(fn func()) bool {
+	select {
+	case b.slots <- struct{}{}:
+	default:
+		return false
+	}
+
+	b.wg.Add(1)
+
+	go func() {
+		defer func() {
+			<-b.slots
+			b.wg.Done()
+		}()
+
+		fn()
+	}()
+
+	return true
+}
+
+/*
+run runs fn in the background no matter how many tasks are in flight. It is
+for work that can't be dropped, like rebuilding an album's cache after an
+upload. Shutdown still waits for it.
+*/
+func (b *backgroundTasks) run(fn func()) {
+	b.wg.Add(1)
+
+	go func() {
+		defer b.wg.Done()
+		fn()
+	}()
+}
+
+// wait blocks until every background task is done or ctx ends
+func (b *backgroundTasks) wait(ctx context.Context) error {
+	done := make(chan struct{})
+
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for background cache tasks: %w", ctx.Err())
+	}
+}
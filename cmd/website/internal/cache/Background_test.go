@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackgroundTasksWaitsForEveryTask(t *testing.T) {
+	tasks := newBackgroundTasks(1)
+	release := make(chan struct{})
+	finished := make(chan string, 2)
+
+	if !tasks.tryGo(func() {
+		<-release
+		finished <- "thumbnail"
+	}) {
+		t.Fatalf("tryGo was refused with a free slot")
+	}
+
+	if tasks.tryGo(func() {}) {
+		t.Errorf("tryGo ran a task with every slot taken")
+	}
+
+	// run isn't limited by the slots
+	tasks.run(func() {
+		<-release
+		finished <- "album cache"
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := tasks.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait with tasks in flight = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+
+	if err := tasks.wait(context.Background()); err != nil {
+		t.Fatalf("wait returned an error: %v", err)
+	}
+
+	if len(finished) != 2 {
+		t.Errorf("%d tasks finished before wait returned, want 2", len(finished))
+	}
+}
@@ -3,9 +3,11 @@ package cache
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
 	"image/jpeg"
+	_ "image/png"
 	"io"
 	"log/slog"
 	"net/http"
@@ -18,7 +20,9 @@ import (
 	"github.com/adampresley/adamgokit/s3/createbucketoptions"
 	"github.com/adampresley/adamgokit/s3/geturloptions"
 	"github.com/adampresley/adamgokit/s3/listoptions"
+	"github.com/adampresley/adamgokit/s3/putoptions"
 	"github.com/adampresley/adamgokit/slices"
+	"github.com/adampresley/adampresleyphotography/pkg/metrics"
 	"github.com/adampresley/adampresleyphotography/pkg/models"
 	"github.com/adampresley/adampresleyphotography/pkg/services"
 	"github.com/alitto/pond/v2"
@@ -27,54 +31,148 @@ import (
 	"github.com/nfnt/resize"
 )
 
+const (
+	queueSizePerWorker = 4
+)
+
+var (
+	DefaultImageExtensions = []string{".jpg", ".jpeg", ".png"}
+
+	ErrDecodeImage = fmt.Errorf("error decoding image")
+
+	// heicSupported is set when the HEIC decoder is compiled in
+	heicSupported = false
+)
+
 type CacheCreator interface {
+	CreateAlbumCache(album *models.Album)
+	CreateAlbumCacheInBackground(album *models.Album)
 	CreateCache()
+	PutThumbnail(thumbnailKey string, thumbnail []byte) error
+	PutThumbnailInBackground(thumbnailKey string, thumbnail []byte, logger *slog.Logger) bool
+	RefreshHeroBanner(album *models.Album, previousPosterPath string) error
+	RefreshHeroBannerInBackground(album *models.Album, previousPosterPath string, logger *slog.Logger)
+	RegenerateThumbnail(album *models.Album, originalKey string) error
+	ReleaseLock() error
+	RenderProof(r io.Reader) ([]byte, error)
+	RenderThumbnail(r io.Reader) ([]byte, error)
+	Shutdown(ctx context.Context) error
+	ThumbnailFormat() ThumbnailFormat
+	TryAcquireLock() (bool, error)
 }
 
 type CacheCreatorConfig struct {
 	AlbumService        services.AlbumServicer
 	AwsBucket           string
 	AwsRegion           string
+	CacheFailureService services.CacheFailureServicer
 	ClientsPhotoFolder  string
 	ClientService       services.ClientServicer
+	HeroAspectRatio     float64
 	HomePagePhotoFolder string
+	ImageExtensions     []string
+	InstanceID          string
+	JpegQuality         int
+	LockTTL             time.Duration
 	MaxCacheWorkers     int
+	ProofWatermark      *Watermark
 	S3Client            s3.S3Client
+	S3MaxAttempts       int
+	S3OperationTimeout  time.Duration
+	S3RetryDelay        time.Duration
 	ShutdownCtx         context.Context
+	ThumbnailFormat     string
+	Watermark           *Watermark
 }
 
 type CacheCreatorService struct {
 	albumService        services.AlbumServicer
 	awsBucket           string
 	awsRegion           string
+	background          *backgroundTasks
+	cacheFailureService services.CacheFailureServicer
 	clientsPhotoFolder  string
 	clientService       services.ClientServicer
+	heroAspectRatio     float64
 	homePagePhotoFolder string
+	imageExtensions     []string
+	instanceID          string
+	jpegQuality         int
+	lockSettleDelay     time.Duration
+	lockTTL             time.Duration
 	maxCacheWorkers     int
+	proofWatermark      *Watermark
 	s3Client            s3.S3Client
+	s3MaxAttempts       int
+	s3OperationTimeout  time.Duration
+	s3RetryDelay        time.Duration
 	shutdownCtx         context.Context
+	thumbnailFormat     ThumbnailFormat
+	watermark           *Watermark
 }
 
 func NewCacheCreatorService(config CacheCreatorConfig) CacheCreatorService {
+	if config.HeroAspectRatio <= 0 {
+		config.HeroAspectRatio = defaultHeroAspectRatio
+	}
+
+	if config.InstanceID == "" {
+		config.InstanceID = newInstanceID()
+	}
+
+	if config.JpegQuality < 1 || config.JpegQuality > 100 {
+		config.JpegQuality = defaultJpegQuality
+	}
+
+	if config.LockTTL <= 0 {
+		config.LockTTL = defaultCacheLockTTL
+	}
+
+	if config.S3MaxAttempts <= 0 {
+		config.S3MaxAttempts = defaultS3MaxAttempts
+	}
+
+	if config.S3OperationTimeout <= 0 {
+		config.S3OperationTimeout = services.DefaultS3OperationTimeout
+	}
+
+	if config.S3RetryDelay <= 0 {
+		config.S3RetryDelay = defaultS3RetryDelay
+	}
+
 	return CacheCreatorService{
 		albumService:        config.AlbumService,
 		awsBucket:           config.AwsBucket,
 		awsRegion:           config.AwsRegion,
+		background:          newBackgroundTasks(maxPendingThumbnailWrites),
+		cacheFailureService: config.CacheFailureService,
 		clientsPhotoFolder:  config.ClientsPhotoFolder,
 		clientService:       config.ClientService,
+		heroAspectRatio:     config.HeroAspectRatio,
 		homePagePhotoFolder: config.HomePagePhotoFolder,
+		imageExtensions:     normalizeImageExtensions(config.ImageExtensions),
+		instanceID:          config.InstanceID,
+		jpegQuality:         config.JpegQuality,
+		lockSettleDelay:     cacheLockSettleDelay,
+		lockTTL:             config.LockTTL,
 		maxCacheWorkers:     config.MaxCacheWorkers,
+		proofWatermark:      config.ProofWatermark,
 		s3Client:            config.S3Client,
+		s3MaxAttempts:       config.S3MaxAttempts,
+		s3OperationTimeout:  config.S3OperationTimeout,
+		s3RetryDelay:        config.S3RetryDelay,
 		shutdownCtx:         config.ShutdownCtx,
+		thumbnailFormat:     ResolveThumbnailFormat(config.ThumbnailFormat),
+		watermark:           config.Watermark,
 	}
 }
 
 func (c CacheCreatorService) CreateCache() {
 	var (
-		err         error
-		clients     []models.Client
-		albums      []*models.Album
-		albumImages []s3.Object
+		err      error
+		clients  []models.Client
+		albums   []*models.Album
+		failures map[string]time.Time
 	)
 
 	slog.Info("starting cache creation...")
@@ -98,7 +196,21 @@ func (c CacheCreatorService) CreateCache() {
 	 */
 	slog.Info("creating cache for clients...", "numClients", len(clients))
 
-	pool := pond.NewPool(c.maxCacheWorkers, pond.WithContext(c.shutdownCtx))
+	if failures, err = c.getFailures(); err != nil {
+		slog.Error("error retrieving cache failures. failed originals will be retried", "error", err)
+	}
+
+	/*
+	 * Bound the queue so submission blocks once it is full instead of
+	 * queueing a task for every image up front
+	 */
+	pool := pond.NewPool(
+		c.maxCacheWorkers,
+		pond.WithContext(c.shutdownCtx),
+		pond.WithQueueSize(c.maxCacheWorkers*queueSizePerWorker),
+	)
+
+	progress := newCacheProgress(defaultProgressInterval)
 
 	if err = c.updateHomePageCache(pool); err != nil {
 		slog.Error("error updating home page cache", "error", err)
@@ -111,37 +223,141 @@ func (c CacheCreatorService) CreateCache() {
 		}
 
 		for _, album := range albums {
-			pool.Submit(func() {
-				if !c.doesHeroExist(album) {
-					slog.Info("creating hero banner cache for album...", "clientID", client.ID, "albumID", album.ID)
-
-					if err = c.createHeroBanner(album); err != nil {
-						slog.Error("error creating hero banner for album", "clientID", client.ID, "albumID", album.ID, "error", err)
-						return
-					}
-				}
-			})
-
-			if albumImages, err = c.getAlbumImageListing(album); err != nil {
+			if err = c.submitAlbum(pool, progress, client, album, failures); err != nil {
 				slog.Error("error retrieving image listing for album", "clientID", client.ID, "albumID", album.ID, "error", err)
 				return
 			}
+		}
+	}
 
-			for _, imageObj := range albumImages {
-				pool.Submit(func() {
-					if !c.doesThumbnailExist(album, imageObj) {
-						slog.Info("creating cache item for album...", "key", imageObj.Key)
+	_ = pool.Stop().Wait()
+	progress.finish()
+}
 
-						if err = c.createThumbnail(album, imageObj.Key); err != nil {
-							slog.Error("error creating cache item for album", "clientID", client.ID, "albumID", album.ID, "imageName", imageObj, "error", err)
-						}
-					}
-				})
-			}
-		}
+/*
+CreateAlbumCache creates the hero banner and any missing thumbnails for a
+single album, such as right after new originals are uploaded. It blocks
+until the album is done.
+*/
+func (c CacheCreatorService) CreateAlbumCache(album *models.Album) {
+	var (
+		err      error
+		failures map[string]time.Time
+	)
+
+	client := models.Client{
+		BaseModel: models.BaseModel{ID: album.ClientID},
+	}
+
+	if failures, err = c.getFailures(); err != nil {
+		slog.Error("error retrieving cache failures. failed originals will be retried", "error", err)
+	}
+
+	pool := pond.NewPool(
+		c.maxCacheWorkers,
+		pond.WithContext(c.shutdownCtx),
+		pond.WithQueueSize(c.maxCacheWorkers*queueSizePerWorker),
+	)
+
+	progress := newCacheProgress(defaultProgressInterval)
+
+	if err = c.submitAlbum(pool, progress, client, album, failures); err != nil {
+		slog.Error("error retrieving image listing for album", "clientID", client.ID, "albumID", album.ID, "error", err)
 	}
 
 	_ = pool.Stop().Wait()
+	progress.finish()
+	slog.Info("album cache created", "clientID", client.ID, "albumID", album.ID)
+}
+
+/*
+submitAlbum queues the hero banner, the dimension sidecar, and thumbnails
+for an album's originals. Thumbnail tasks report into progress as they
+finish.
+*/
+func (c CacheCreatorService) submitAlbum(pool pond.Pool, progress *cacheProgress, client models.Client, album *models.Album, failures map[string]time.Time) error {
+	var (
+		err         error
+		albumImages []s3.Object
+	)
+
+	c.submitHeroBanner(pool, client, album)
+
+	if albumImages, err = c.getAlbumImageListing(album); err != nil {
+		return err
+	}
+
+	pool.Submit(func() {
+		if err := c.updateImageDimensions(album, albumImages); err != nil {
+			slog.Error("error updating album image dimensions", "clientID", client.ID, "albumID", album.ID, "error", err)
+		}
+	})
+
+	for _, imageObj := range albumImages {
+		/*
+		 * Skip originals that failed before, unless they've been
+		 * replaced since
+		 */
+		failedAt, failedBefore := failures[imageObj.Key]
+
+		if failedBefore && failedAt.Equal(imageObj.LastModified.UTC()) {
+			continue
+		}
+
+		c.submitThumbnail(pool, progress, client, album, imageObj, failedBefore)
+	}
+
+	return nil
+}
+
+/*
+submitHeroBanner queues hero banner creation for an album. The client and
+album are passed in rather than captured from the caller's loop so each
+task is bound to the album it was submitted for.
+*/
+func (c CacheCreatorService) submitHeroBanner(pool pond.Pool, client models.Client, album *models.Album) {
+	pool.Submit(func() {
+		if c.doesHeroExist(album) {
+			return
+		}
+
+		slog.Info("creating hero banner cache for album...", "clientID", client.ID, "albumID", album.ID)
+
+		if err := c.createHeroBanner(album); err != nil {
+			slog.Error("error creating hero banner for album", "clientID", client.ID, "albumID", album.ID, "error", err)
+		}
+	})
+}
+
+/*
+submitThumbnail queues thumbnail creation for a single original. Like
+submitHeroBanner, everything the task needs is passed in explicitly.
+*/
+func (c CacheCreatorService) submitThumbnail(pool pond.Pool, progress *cacheProgress, client models.Client, album *models.Album, imageObj s3.Object, failedBefore bool) {
+	progress.submit()
+
+	pool.Submit(func() {
+		if c.doesThumbnailExist(album, imageObj) {
+			progress.skip()
+			return
+		}
+
+		slog.Info("creating cache item for album...", "key", imageObj.Key)
+
+		if err := c.createThumbnail(album, imageObj.Key); err != nil {
+			slog.Error("error creating cache item for album", "clientID", client.ID, "albumID", album.ID, "imageName", imageObj, "error", err)
+			c.recordFailure(imageObj, err)
+			progress.fail()
+			return
+		}
+
+		metrics.CacheThumbnailsCreated.Inc()
+		progress.complete()
+
+		if failedBefore {
+			c.clearFailure(imageObj.Key)
+		}
+	})
 }
 
 func (c CacheCreatorService) ensureBucketExists(bucketName string) error {
@@ -194,12 +410,17 @@ func (c CacheCreatorService) updateHomePageCache(pool pond.Pool) error {
 			return
 		}
 
-		if err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		if err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: c.jpegQuality}); err != nil {
 			slog.Error("error encoding image for thumbnail", "key", thumbnailKey, "error", err)
 			return
 		}
 
-		if _, err = c.s3Client.Put(c.awsBucket, thumbnailKey, bytes.NewReader(buf.Bytes())); err != nil {
+		err = c.withS3Retry("put", thumbnailKey, func() error {
+			_, err := c.s3Client.Put(c.awsBucket, thumbnailKey, bytes.NewReader(buf.Bytes()))
+			return err
+		})
+
+		if err != nil {
 			slog.Error("error uploading resized image", "thumbnailKey", thumbnailKey, "error", err)
 		}
 
@@ -207,8 +428,7 @@ func (c CacheCreatorService) updateHomePageCache(pool pond.Pool) error {
 	}
 
 	originalsKey := filepath.Join(c.homePagePhotoFolder, "original")
-	originals, err = c.s3Client.List(
-		c.awsBucket,
+	originals, err = c.listObjects(
 		originalsKey,
 		listoptions.WithGetUrls(),
 	)
@@ -219,6 +439,10 @@ func (c CacheCreatorService) updateHomePageCache(pool pond.Pool) error {
 
 	slog.Info("checking for updated home page images...", "numImages", len(originals.Objects), "bucket", c.awsBucket, "path", originalsKey)
 
+	if err = c.updateCaptureDates(originals.Objects); err != nil {
+		slog.Error("error updating home page capture dates", "error", err)
+	}
+
 	for _, original := range originals.Objects {
 		thumbnailKey := filepath.Join(c.homePagePhotoFolder, "thumbnail", filepath.Base(original.Key))
 
@@ -241,7 +465,6 @@ func (c CacheCreatorService) getAlbumImageListing(album *models.Album) ([]s3.Obj
 	var (
 		err      error
 		response s3.ListResponse
-		validExt = []string{".jpg", ".jpeg"}
 	)
 
 	key := filepath.Join(
@@ -251,14 +474,13 @@ func (c CacheCreatorService) getAlbumImageListing(album *models.Album) ([]s3.Obj
 		"originals",
 	)
 
-	response, err = c.s3Client.List(
-		c.awsBucket,
+	response, err = c.listObjects(
 		key,
 		listoptions.WithGetUrls(),
 		listoptions.WithGetAll(),
 		listoptions.WithFilter(func(obj types.Object) bool {
 			ext := strings.ToLower(filepath.Ext(aws.ToString(obj.Key)))
-			result := slices.IsInSlice(ext, validExt)
+			result := slices.IsInSlice(ext, c.imageExtensions)
 			return result
 		}),
 		listoptions.WithGetUrlOptions(
@@ -279,14 +501,12 @@ func (c CacheCreatorService) doesThumbnailExist(album *models.Album, original s3
 		stat *s3.ObjectMetadata
 	)
 
-	imageName := filepath.Base(original.Key)
-
 	key := filepath.Join(
 		c.clientsPhotoFolder,
 		fmt.Sprint(album.ClientID),
 		fmt.Sprint(album.ID),
-		"thumbnails",
-		imageName,
+		PreviewFolder(album),
+		filepath.Base(original.Key)+c.thumbnailFormat.Suffix,
 	)
 
 	if stat, err = c.s3Client.StatObject(c.awsBucket, key); err != nil {
@@ -347,44 +567,109 @@ func (c CacheCreatorService) doesHeroExist(album *models.Album) bool {
 
 func (c CacheCreatorService) createThumbnail(album *models.Album, originalKey string) error {
 	var (
-		err      error
-		img      image.Image
-		maxSize  uint = 400
-		original s3.GetObjectResponse
-		buf      bytes.Buffer
+		err       error
+		original  s3.GetObjectResponse
+		thumbnail []byte
 	)
 
-	original, err = c.s3Client.Get(
-		c.awsBucket,
-		originalKey,
-	)
+	err = c.withS3Retry("get", originalKey, func() error {
+		original, err = c.s3Client.Get(c.awsBucket, originalKey)
+		return err
+	})
 
 	if err != nil {
 		return fmt.Errorf("error retrieving original image %s: %w", originalKey, err)
 	}
 
-	if img, err = c.resizeReader(original.Body, maxSize); err != nil {
-		return fmt.Errorf("error resizing image: %w", err)
+	defer original.Body.Close()
+
+	render := c.RenderThumbnail
+
+	if !album.Purchased {
+		render = c.RenderProof
 	}
 
-	if err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
-		return fmt.Errorf("error encoding image for thumbnail: %w", err)
+	if thumbnail, err = render(original.Body); err != nil {
+		return err
 	}
 
 	putKey := filepath.Join(
 		c.clientsPhotoFolder,
 		fmt.Sprint(album.ClientID),
 		fmt.Sprint(album.ID),
-		"thumbnails",
-		filepath.Base(originalKey),
+		PreviewFolder(album),
+		filepath.Base(originalKey)+c.thumbnailFormat.Suffix,
 	)
 
-	_, err = c.s3Client.Put(
-		c.awsBucket,
-		putKey,
-		&buf,
+	return c.PutThumbnail(putKey, thumbnail)
+}
+
+/*
+RenderThumbnail resizes an original image, applies the watermark when one
+is configured, and encodes the result in the configured thumbnail format.
+*/
+func (c CacheCreatorService) RenderThumbnail(r io.Reader) ([]byte, error) {
+	return c.renderPreview(r, c.watermark)
+}
+
+/*
+RenderProof renders a thumbnail for an album that hasn't been purchased. It
+is always watermarked, even when thumbnails otherwise aren't.
+*/
+func (c CacheCreatorService) RenderProof(r io.Reader) ([]byte, error) {
+	watermark := c.proofWatermark
+
+	if watermark == nil {
+		watermark = c.watermark
+	}
+
+	if watermark == nil {
+		return nil, fmt.Errorf("no watermark is configured for proofs")
+	}
+
+	return c.renderPreview(r, watermark)
+}
+
+func (c CacheCreatorService) renderPreview(r io.Reader, watermark *Watermark) ([]byte, error) {
+	var (
+		err     error
+		img     image.Image
+		maxSize uint = 400
+		buf     bytes.Buffer
 	)
 
+	if img, err = c.resizeReader(r, maxSize); err != nil {
+		return nil, fmt.Errorf("error resizing image: %w", err)
+	}
+
+	if watermark != nil {
+		img = watermark.Apply(img)
+	}
+
+	if err = c.thumbnailFormat.encode(&buf, img, c.jpegQuality); err != nil {
+		return nil, fmt.Errorf("error encoding image for thumbnail: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+/*
+PutThumbnail uploads a thumbnail encoded by RenderThumbnail. Thumbnails keep
+the original's name, plus the format's suffix, so they line up with the
+originals listing.
+*/
+func (c CacheCreatorService) PutThumbnail(thumbnailKey string, thumbnail []byte) error {
+	err := c.withS3Retry("put", thumbnailKey, func() error {
+		_, err := c.s3Client.Put(
+			c.awsBucket,
+			thumbnailKey,
+			bytes.NewReader(thumbnail),
+			putoptions.WithContentType(c.thumbnailFormat.ContentType),
+		)
+
+		return err
+	})
+
 	if err != nil {
 		return fmt.Errorf("error uploading thumbnail to S3: %w", err)
 	}
@@ -392,6 +677,145 @@ func (c CacheCreatorService) createThumbnail(album *models.Album, originalKey st
 	return nil
 }
 
+/*
+PutThumbnailInBackground uploads a thumbnail without making the caller wait.
+When too many uploads are already pending the thumbnail is dropped, since
+the next request or cache run renders it again. Returns false when dropped.
+*/
+func (c CacheCreatorService) PutThumbnailInBackground(thumbnailKey string, thumbnail []byte, logger *slog.Logger) bool {
+	started := c.background.tryGo(func() {
+		if err := c.PutThumbnail(thumbnailKey, thumbnail); err != nil {
+			logger.Error("error storing thumbnail in the background", "error", err, "key", thumbnailKey)
+		}
+	})
+
+	if !started {
+		logger.Warn("too many pending thumbnail uploads. skipping", "key", thumbnailKey)
+	}
+
+	return started
+}
+
+/*
+CreateAlbumCacheInBackground runs CreateAlbumCache without making the caller
+wait. Shutdown waits for it to finish.
+*/
+func (c CacheCreatorService) CreateAlbumCacheInBackground(album *models.Album) {
+	c.background.run(func() {
+		c.CreateAlbumCache(album)
+	})
+}
+
+/*
+RefreshHeroBannerInBackground runs RefreshHeroBanner without making the
+caller wait. Shutdown waits for it to finish.
+*/
+func (c CacheCreatorService) RefreshHeroBannerInBackground(album *models.Album, previousPosterPath string, logger *slog.Logger) {
+	c.background.run(func() {
+		if err := c.RefreshHeroBanner(album, previousPosterPath); err != nil {
+			logger.Error("error refreshing hero banner", "error", err, "albumID", album.ID)
+		}
+	})
+}
+
+/*
+Shutdown waits for background work, such as thumbnail uploads and album
+cache rebuilds, to finish, or for ctx to end.
+*/
+func (c CacheCreatorService) Shutdown(ctx context.Context) error {
+	return c.background.wait(ctx)
+}
+
+/*
+ThumbnailFormat returns the format thumbnails are encoded in.
+*/
+func (c CacheCreatorService) ThumbnailFormat() ThumbnailFormat {
+	return c.thumbnailFormat
+}
+
+/*
+ThumbnailKey returns the key of the JPEG thumbnail for an album original.
+Album originals live in an "originals" folder, and their thumbnails in a
+sibling "thumbnails" folder with the same name. Use ThumbnailFormat.Key for
+the configured format.
+*/
+func ThumbnailKey(originalKey string) string {
+	albumFolder := filepath.Dir(filepath.Dir(originalKey))
+	return filepath.Join(albumFolder, "thumbnails", filepath.Base(originalKey))
+}
+
+/*
+ProofKey is ThumbnailKey for the watermarked thumbnails of albums that
+haven't been purchased. They live in a sibling "proofs" folder, so marking
+an album purchased never serves a stale watermarked thumbnail, or the
+reverse.
+*/
+func ProofKey(originalKey string) string {
+	albumFolder := filepath.Dir(filepath.Dir(originalKey))
+	return filepath.Join(albumFolder, "proofs", filepath.Base(originalKey))
+}
+
+/*
+PreviewFolder returns the folder an album's thumbnails are shown from:
+"thumbnails" once it is purchased and "proofs" until then.
+*/
+func PreviewFolder(album *models.Album) string {
+	if album.Purchased {
+		return "thumbnails"
+	}
+
+	return "proofs"
+}
+
+/*
+RegenerateThumbnail recreates the thumbnail for one of an album's originals,
+even when the existing thumbnail is newer than the original. originalKey
+must be directly in the album's originals folder, otherwise the error wraps
+services.ErrInvalidInput. A recorded failure for the original is cleared
+once its thumbnail is made.
+*/
+func (c CacheCreatorService) RegenerateThumbnail(album *models.Album, originalKey string) error {
+	prefix := fmt.Sprintf("%s/%d/%d/originals/", c.clientsPhotoFolder, album.ClientID, album.ID)
+	fileName, ok := strings.CutPrefix(originalKey, prefix)
+
+	if !ok || fileName == "" || fileName == "." || fileName == ".." || strings.Contains(fileName, "/") {
+		return fmt.Errorf("%w: '%s' is not an original in album %d", services.ErrInvalidInput, originalKey, album.ID)
+	}
+
+	if err := c.createThumbnail(album, originalKey); err != nil {
+		return fmt.Errorf("error regenerating thumbnail for '%s': %w", originalKey, err)
+	}
+
+	c.clearFailure(originalKey)
+	return nil
+}
+
+/*
+RefreshHeroBanner recreates an album's hero banner after its poster changes.
+The banner for the previous poster, if there was one, is removed.
+*/
+func (c CacheCreatorService) RefreshHeroBanner(album *models.Album, previousPosterPath string) error {
+	if previousPosterPath != "" && previousPosterPath != album.PosterImagePath {
+		previousKey := filepath.Join(
+			c.clientsPhotoFolder,
+			fmt.Sprint(album.ClientID),
+			fmt.Sprint(album.ID),
+			"hero-banner",
+			previousPosterPath,
+		)
+
+		if _, err := c.s3Client.Delete(c.awsBucket, []string{previousKey}); err != nil {
+			slog.Error("error removing previous hero banner", "key", previousKey, "error", err)
+		}
+	}
+
+	return c.createHeroBanner(album)
+}
+
+/*
+createHeroBanner crops the album's poster to heroAspectRatio, keeping the
+poster's X and Y positions in view, then scales it down.
+*/
 func (c CacheCreatorService) createHeroBanner(album *models.Album) error {
 	var (
 		err      error
@@ -409,20 +833,31 @@ func (c CacheCreatorService) createHeroBanner(album *models.Album) error {
 		album.PosterImagePath,
 	)
 
-	original, err = c.s3Client.Get(
-		c.awsBucket,
-		originalKey,
-	)
+	err = c.withS3Retry("get", originalKey, func() error {
+		original, err = c.s3Client.Get(c.awsBucket, originalKey)
+		return err
+	})
 
 	if err != nil {
 		return fmt.Errorf("error retrieving original image %s: %w", originalKey, err)
 	}
 
-	if img, err = c.resizeReader(original.Body, maxSize); err != nil {
-		return fmt.Errorf("error resizing image: %w", err)
+	defer original.Body.Close()
+
+	if img, _, err = image.Decode(original.Body); err != nil {
+		return fmt.Errorf("%w: %w", ErrDecodeImage, err)
 	}
 
-	if err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+	cropRect := heroCropRect(
+		img.Bounds(),
+		c.heroAspectRatio,
+		focalPoint(album.PosterXPos, "left", "right"),
+		focalPoint(album.PosterYPos, "top", "bottom"),
+	)
+
+	img = c.resize(cropImage(img, cropRect), maxSize)
+
+	if err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: c.jpegQuality}); err != nil {
 		return fmt.Errorf("error encoding image for hero banner: %w", err)
 	}
 
@@ -434,11 +869,10 @@ func (c CacheCreatorService) createHeroBanner(album *models.Album) error {
 		album.PosterImagePath,
 	)
 
-	_, err = c.s3Client.Put(
-		c.awsBucket,
-		putKey,
-		&buf,
-	)
+	err = c.withS3Retry("put", putKey, func() error {
+		_, err := c.s3Client.Put(c.awsBucket, putKey, bytes.NewReader(buf.Bytes()))
+		return err
+	})
 
 	if err != nil {
 		return fmt.Errorf("error uploading hero banner to S3: %w", err)
@@ -473,7 +907,7 @@ func (c CacheCreatorService) resizeReader(r io.Reader, maxSize uint) (image.Imag
 	)
 
 	if img, _, err = image.Decode(r); err != nil {
-		return nil, fmt.Errorf("error decoding image: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrDecodeImage, err)
 	}
 
 	resizedImage := c.resize(img, maxSize)
@@ -506,3 +940,88 @@ func (c CacheCreatorService) resize(img image.Image, maxSize uint) image.Image {
 	resizedImage = resize.Resize(newWidth, newHeight, img, resize.Lanczos3)
 	return resizedImage
 }
+
+/*
+getFailures returns the LastModified of each original that previously
+failed to decode, keyed by the original's key.
+*/
+func (c CacheCreatorService) getFailures() (map[string]time.Time, error) {
+	var (
+		err      error
+		failures []models.CacheFailure
+	)
+
+	result := map[string]time.Time{}
+
+	if c.cacheFailureService == nil {
+		return result, nil
+	}
+
+	if failures, err = c.cacheFailureService.List(); err != nil {
+		return result, err
+	}
+
+	for _, failure := range failures {
+		result[failure.Key] = failure.LastModified.UTC()
+	}
+
+	return result, nil
+}
+
+/*
+recordFailure records originals that can't be decoded. Other errors, such
+as S3 failures, are transient and will be retried on the next run.
+*/
+func (c CacheCreatorService) recordFailure(original s3.Object, err error) {
+	if c.cacheFailureService == nil || !errors.Is(err, ErrDecodeImage) {
+		return
+	}
+
+	if err = c.cacheFailureService.Record(original.Key, original.LastModified, err); err != nil {
+		slog.Error("error recording cache failure", "key", original.Key, "error", err)
+	}
+}
+
+func (c CacheCreatorService) clearFailure(key string) {
+	if c.cacheFailureService == nil {
+		return
+	}
+
+	if err := c.cacheFailureService.Clear(key); err != nil {
+		slog.Error("error clearing cache failure", "key", key, "error", err)
+	}
+}
+
+/*
+normalizeImageExtensions lowercases the accepted original extensions and
+makes sure each has a leading dot. HEIC extensions are dropped with a warning
+when the HEIC decoder isn't compiled in.
+*/
+func normalizeImageExtensions(extensions []string) []string {
+	if len(extensions) == 0 {
+		extensions = DefaultImageExtensions
+	}
+
+	result := make([]string, 0, len(extensions))
+
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+
+		if ext == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+
+		if (ext == ".heic" || ext == ".heif") && !heicSupported {
+			slog.Warn("HEIC support is not compiled in. ignoring extension", "extension", ext)
+			continue
+		}
+
+		result = append(result, ext)
+	}
+
+	return result
+}
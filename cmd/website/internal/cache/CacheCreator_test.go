@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+)
+
+/*
+fakeClientService returns a fixed list of clients. Anything else panics
+through the nil embedded interface.
+*/
+type fakeClientService struct {
+	services.ClientServicer
+
+	clients []models.Client
+}
+
+func (f fakeClientService) GetAll() ([]models.Client, error) {
+	return f.clients, nil
+}
+
+/*
+fakeAlbumService returns a fixed list of albums per client. Anything else
+panics through the nil embedded interface.
+*/
+type fakeAlbumService struct {
+	services.AlbumServicer
+
+	albums map[uint][]*models.Album
+}
+
+func (f fakeAlbumService) GetAlbumList(clientID uint) ([]*models.Album, error) {
+	return f.albums[clientID], nil
+}
+
+func TestCreateCacheWritesEachAlbumUnderItsOwnPrefix(t *testing.T) {
+	s3Client := newMemoryS3Client()
+	clients := []models.Client{}
+	albums := map[uint][]*models.Album{}
+
+	/*
+	 * Every album has an original with the same name, so the only way to
+	 * tell the thumbnails apart is their size. Each album's original is a
+	 * different height.
+	 */
+	wantHeights := map[string]int{}
+	albumID := uint(0)
+
+	for clientID := uint(1); clientID <= 3; clientID++ {
+		clients = append(clients, models.Client{BaseModel: models.BaseModel{ID: clientID}})
+
+		for i := 0; i < 3; i++ {
+			albumID++
+			height := 200 + int(albumID)*40
+
+			album := &models.Album{BaseModel: models.BaseModel{ID: albumID}, ClientID: clientID, Purchased: true, PosterImagePath: "a.jpg"}
+			albums[clientID] = append(albums[clientID], album)
+
+			prefix := fmt.Sprintf("clients/%d/%d/", clientID, albumID)
+			s3Client.put(prefix+"originals/a.jpg", encodeJpeg(t, testImage(800, height)), time.Now().Add(-time.Hour))
+
+			wantHeights[prefix+"thumbnails/a.jpg"] = height / 2
+			wantHeights[prefix+"hero-banner/a.jpg"] = height / 2
+		}
+	}
+
+	service := NewCacheCreatorService(CacheCreatorConfig{
+		AlbumService:        fakeAlbumService{albums: albums},
+		ClientService:       fakeClientService{clients: clients},
+		ClientsPhotoFolder:  "clients",
+		HomePagePhotoFolder: "home",
+		MaxCacheWorkers:     4,
+		S3Client:            s3Client,
+		ShutdownCtx:         context.Background(),
+	})
+
+	service.CreateCache()
+
+	for key, wantHeight := range wantHeights {
+		data, ok := s3Client.get(key)
+
+		if !ok {
+			t.Errorf("nothing written to %s", key)
+			continue
+		}
+
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s is not a JPEG: %v", key, err)
+			continue
+		}
+
+		if got := img.Bounds().Dy(); got != wantHeight {
+			t.Errorf("%s is %dpx tall, want %d from its own album's original", key, got, wantHeight)
+		}
+	}
+
+	// Each album's dimension sidecar has its own original's size
+	for _, clientAlbums := range albums {
+		for _, album := range clientAlbums {
+			dimensions, err := ReadImageDimensions(s3Client, "", "clients", album)
+			want := 200 + int(album.ID)*40
+
+			if err != nil || dimensions["a.jpg"].Width != 800 || dimensions["a.jpg"].Height != want {
+				t.Errorf("album %d dimensions = %+v, %v; want 800x%d", album.ID, dimensions, err, want)
+			}
+		}
+	}
+
+	// 9 originals, 9 thumbnails, 9 hero banners, 9 dimension sidecars, and nothing else
+	if keys := s3Client.keys(); len(keys) != 36 {
+		t.Errorf("bucket has %d objects, want 36: %v", len(keys), keys)
+	}
+}
+
+func TestRegenerateThumbnail(t *testing.T) {
+	const originalKey = "clients/1/2/originals/a.jpg"
+
+	uploadedAt := time.Now().Add(-time.Hour)
+
+	s3Client := newMemoryS3Client()
+	s3Client.put(originalKey, encodeJpeg(t, testImage(800, 600)), uploadedAt)
+	s3Client.put("clients/1/2/thumbnails/a.jpg", []byte("a bad crop"), time.Now())
+
+	failures := newMemoryCacheFailures()
+	_ = failures.Record(originalKey, uploadedAt, errors.New("decode failed"))
+
+	service := NewCacheCreatorService(CacheCreatorConfig{
+		CacheFailureService: failures,
+		ClientsPhotoFolder:  "clients",
+		S3Client:            s3Client,
+	})
+
+	album := &models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true}
+
+	// The thumbnail is newer than the original, but is remade anyway
+	if err := service.RegenerateThumbnail(album, originalKey); err != nil {
+		t.Fatalf("RegenerateThumbnail returned an error: %v", err)
+	}
+
+	thumbnail, _ := s3Client.get("clients/1/2/thumbnails/a.jpg")
+
+	if _, err := jpeg.Decode(bytes.NewReader(thumbnail)); err != nil {
+		t.Errorf("thumbnail wasn't regenerated: %v", err)
+	}
+
+	if failures.has(originalKey) {
+		t.Errorf("the recorded failure wasn't cleared")
+	}
+
+	outside := []string{
+		"clients/1/3/originals/a.jpg",
+		"clients/2/2/originals/a.jpg",
+		"clients/1/2/thumbnails/a.jpg",
+		"clients/1/2/originals/../../3/originals/a.jpg",
+		"clients/1/2/originals/",
+	}
+
+	for _, key := range outside {
+		if err := service.RegenerateThumbnail(album, key); !errors.Is(err, services.ErrInvalidInput) {
+			t.Errorf("RegenerateThumbnail(%q) error = %v, want ErrInvalidInput", key, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+func TestDecodeFailuresAreRecordedUntilTheOriginalIsReplaced(t *testing.T) {
+	const (
+		badKey  = "clients/1/2/originals/bad.jpg"
+		goodKey = "clients/1/2/originals/good.jpg"
+	)
+
+	uploadedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	s3Client := newMemoryS3Client()
+	s3Client.put(badKey, []byte("not an image"), uploadedAt)
+	s3Client.put(goodKey, encodeJpeg(t, testImage(800, 600)), uploadedAt)
+
+	failures := newMemoryCacheFailures()
+
+	service := NewCacheCreatorService(CacheCreatorConfig{
+		CacheFailureService: failures,
+		ClientsPhotoFolder:  "clients",
+		MaxCacheWorkers:     2,
+		S3Client:            s3Client,
+		ShutdownCtx:         context.Background(),
+	})
+
+	album := &models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true}
+
+	service.CreateAlbumCache(album)
+
+	if !failures.has(badKey) {
+		t.Fatalf("the corrupt original was not recorded")
+	}
+
+	if failures.has(goodKey) {
+		t.Errorf("the good original was recorded as a failure")
+	}
+
+	if _, ok := s3Client.get("clients/1/2/thumbnails/good.jpg"); !ok {
+		t.Errorf("one corrupt original stopped the rest of the album")
+	}
+
+	// An unchanged original is skipped on the next run
+	service.CreateAlbumCache(album)
+
+	if got := failures.timesRecorded(badKey); got != 1 {
+		t.Errorf("corrupt original recorded %d times, want it skipped the second time", got)
+	}
+
+	// Re-uploading a good copy clears the failure
+	s3Client.put(badKey, encodeJpeg(t, testImage(800, 600)), uploadedAt.Add(time.Minute))
+	service.CreateAlbumCache(album)
+
+	if failures.has(badKey) {
+		t.Errorf("the failure was not cleared after the original was replaced")
+	}
+
+	if _, ok := s3Client.get("clients/1/2/thumbnails/bad.jpg"); !ok {
+		t.Errorf("no thumbnail for the replaced original")
+	}
+}
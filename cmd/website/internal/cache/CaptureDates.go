@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/putoptions"
+)
+
+const (
+	// CaptureDatesFileName is the sidecar, in the home page photo folder, holding each photo's capture date
+	CaptureDatesFileName = "capture-dates.json"
+
+	// maxExifReadBytes is how much of an original is read looking for EXIF. APP1 segments top out at 64KB
+	maxExifReadBytes = 128 * 1024
+)
+
+/*
+CaptureDate is what the cache run learned about one home page original.
+CapturedAt is zero when the original has no EXIF date. OriginalModified
+records which version of the original was read, so it is only read again
+when it is replaced.
+*/
+type CaptureDate struct {
+	CapturedAt       time.Time `json:"capturedAt,omitzero"`
+	OriginalModified time.Time `json:"originalModified"`
+}
+
+/*
+CaptureDates maps a home page photo's file name to its capture date.
+*/
+type CaptureDates map[string]CaptureDate
+
+/*
+ReadCaptureDates loads the capture date sidecar from the home page photo
+folder. A missing sidecar, such as before the first cache run, returns an
+empty map.
+*/
+func ReadCaptureDates(s3Client s3.S3Client, bucket, homePagePhotoFolder string) (CaptureDates, error) {
+	var (
+		err      error
+		metadata *s3.ObjectMetadata
+		object   s3.GetObjectResponse
+	)
+
+	result := CaptureDates{}
+	key := filepath.Join(homePagePhotoFolder, CaptureDatesFileName)
+
+	if metadata, err = s3Client.StatObject(bucket, key); err != nil {
+		return result, fmt.Errorf("error checking for home page capture dates: %w", err)
+	}
+
+	if metadata == nil {
+		return result, nil
+	}
+
+	if object, err = s3Client.Get(bucket, key); err != nil {
+		return result, fmt.Errorf("error reading home page capture dates: %w", err)
+	}
+
+	defer object.Body.Close()
+
+	if err = json.NewDecoder(object.Body).Decode(&result); err != nil {
+		return CaptureDates{}, fmt.Errorf("error decoding home page capture dates: %w", err)
+	}
+
+	return result, nil
+}
+
+/*
+updateCaptureDates reads the EXIF date of any home page original that is
+new or has been replaced since the last run, drops originals that are gone,
+and writes the sidecar back when anything changed.
+*/
+func (c CacheCreatorService) updateCaptureDates(originals []s3.Object) error {
+	var (
+		err      error
+		existing CaptureDates
+	)
+
+	if existing, err = ReadCaptureDates(c.s3Client, c.awsBucket, c.homePagePhotoFolder); err != nil {
+		slog.Warn("unable to read home page capture dates. they will be rebuilt", "error", err)
+	}
+
+	result := CaptureDates{}
+	changed := err != nil
+
+	for _, original := range originals {
+		fileName := filepath.Base(original.Key)
+
+		if current, ok := existing[fileName]; ok && current.OriginalModified.Equal(original.LastModified) {
+			result[fileName] = current
+			continue
+		}
+
+		changed = true
+		result[fileName] = CaptureDate{
+			CapturedAt:       c.readOriginalCaptureDate(original.Key),
+			OriginalModified: original.LastModified,
+		}
+	}
+
+	// Originals that were removed leave the sidecar with more entries than result
+	if !changed && len(result) == len(existing) {
+		return nil
+	}
+
+	b, err := json.Marshal(result)
+
+	if err != nil {
+		return fmt.Errorf("error encoding home page capture dates: %w", err)
+	}
+
+	key := filepath.Join(c.homePagePhotoFolder, CaptureDatesFileName)
+
+	if _, err = c.s3Client.Put(c.awsBucket, key, bytes.NewReader(b), putoptions.WithContentType("application/json")); err != nil {
+		return fmt.Errorf("error writing home page capture dates: %w", err)
+	}
+
+	slog.Info("updated home page capture dates", "numImages", len(result))
+	return nil
+}
+
+/*
+readOriginalCaptureDate returns an original's EXIF capture date, or the
+zero time when it has none or can't be read.
+*/
+func (c CacheCreatorService) readOriginalCaptureDate(key string) time.Time {
+	var (
+		err        error
+		object     s3.GetObjectResponse
+		capturedAt time.Time
+	)
+
+	if object, err = c.s3Client.Get(c.awsBucket, key); err != nil {
+		slog.Error("error retrieving home page image for its capture date", "key", key, "error", err)
+		return time.Time{}
+	}
+
+	defer object.Body.Close()
+
+	if capturedAt, err = readCaptureDate(io.LimitReader(object.Body, maxExifReadBytes)); err != nil {
+		slog.Debug("home page image has no capture date", "key", key)
+		return time.Time{}
+	}
+
+	return capturedAt
+}
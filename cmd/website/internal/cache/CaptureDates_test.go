@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestUpdateCaptureDates(t *testing.T) {
+	s3Client := newMemoryS3Client()
+	service := NewCacheCreatorService(CacheCreatorConfig{
+		AwsBucket:           "bucket",
+		HomePagePhotoFolder: "home-page",
+		S3Client:            s3Client,
+	})
+
+	plain := encodeJpeg(t, testImage(8, 8))
+	uploaded := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+
+	s3Client.put("home-page/original/dated.jpg", withExifDate(t, plain, binary.BigEndian, "2023:10:14 16:30:05", true), uploaded)
+	s3Client.put("home-page/original/undated.jpg", plain, uploaded)
+
+	originals, _ := s3Client.List("bucket", "home-page/original")
+
+	if err := service.updateCaptureDates(originals.Objects); err != nil {
+		t.Fatalf("updateCaptureDates returned an error: %v", err)
+	}
+
+	got, err := ReadCaptureDates(s3Client, "bucket", "home-page")
+
+	if err != nil {
+		t.Fatalf("ReadCaptureDates returned an error: %v", err)
+	}
+
+	if want := time.Date(2023, time.October, 14, 16, 30, 5, 0, time.UTC); !got["dated.jpg"].CapturedAt.Equal(want) {
+		t.Errorf("dated.jpg captured at %v, want %v", got["dated.jpg"].CapturedAt, want)
+	}
+
+	if undated, ok := got["undated.jpg"]; !ok || !undated.CapturedAt.IsZero() || !undated.OriginalModified.Equal(uploaded) {
+		t.Errorf("undated.jpg = %+v, %v; want no capture date and the upload time", undated, ok)
+	}
+
+	/*
+	 * Replace one original and remove the other. Only the replacement is
+	 * read again, and the removed photo drops out of the sidecar.
+	 */
+	s3Client.put("home-page/original/undated.jpg", withExifDate(t, plain, binary.LittleEndian, "2022:01:02 03:04:05", true), uploaded.Add(time.Hour))
+	_, _ = s3Client.Delete("bucket", []string{"home-page/original/dated.jpg"})
+
+	originals, _ = s3Client.List("bucket", "home-page/original")
+
+	if err = service.updateCaptureDates(originals.Objects); err != nil {
+		t.Fatalf("second updateCaptureDates returned an error: %v", err)
+	}
+
+	got, _ = ReadCaptureDates(s3Client, "bucket", "home-page")
+
+	if _, ok := got["dated.jpg"]; ok || len(got) != 1 {
+		t.Errorf("capture dates = %+v, want only undated.jpg", got)
+	}
+
+	if want := time.Date(2022, time.January, 2, 3, 4, 5, 0, time.UTC); !got["undated.jpg"].CapturedAt.Equal(want) {
+		t.Errorf("replaced undated.jpg captured at %v, want %v", got["undated.jpg"].CapturedAt, want)
+	}
+}
+
+func TestReadCaptureDatesWithoutASidecar(t *testing.T) {
+	got, err := ReadCaptureDates(newMemoryS3Client(), "bucket", "home-page")
+
+	if err != nil || got == nil || len(got) != 0 {
+		t.Errorf("ReadCaptureDates = %v, %v; want an empty map", got, err)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build heic
+
+package cache
+
+/*
+HEIC decoding requires cgo and libde265, so it is only compiled in when
+building with the "heic" tag. See the build-heic target in the Makefile.
+*/
+import _ "github.com/jdeng/goheif"
+
+func init() {
+	heicSupported = true
+}
@@ -0,0 +1,40 @@
+//go:build heic
+
+package cache
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+func TestHeicOriginalMakesAJpegThumbnail(t *testing.T) {
+	original, err := os.ReadFile("testdata/camel.heic")
+	if err != nil {
+		t.Fatalf("error reading HEIC fixture: %v", err)
+	}
+
+	s3Client := newMemoryS3Client()
+	s3Client.put("clients/1/2/originals/camel.heic", original, time.Now())
+
+	service := NewCacheCreatorService(CacheCreatorConfig{
+		ClientsPhotoFolder: "clients",
+		ImageExtensions:    []string{".heic"},
+		S3Client:           s3Client,
+	})
+
+	album := &models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true}
+
+	objects, err := service.getAlbumImageListing(album)
+	if err != nil || len(objects) != 1 {
+		t.Fatalf("listing = %v, %v; want the HEIC original", objects, err)
+	}
+
+	if err = service.createThumbnail(album, "clients/1/2/originals/camel.heic"); err != nil {
+		t.Fatalf("createThumbnail returned an error: %v", err)
+	}
+
+	assertJpegThumbnail(t, s3Client, "clients/1/2/thumbnails/camel.heic")
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"bytes"
+	"image/jpeg"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+// assertJpegThumbnail fails unless key holds a JPEG no larger than the thumbnail size
+func assertJpegThumbnail(t *testing.T, s3Client *memoryS3Client, key string) {
+	t.Helper()
+
+	data, ok := s3Client.get(key)
+
+	if !ok {
+		t.Fatalf("no thumbnail at %s", key)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("thumbnail at %s is not a JPEG: %v", key, err)
+	}
+
+	if bounds := img.Bounds(); bounds.Dx() > 400 || bounds.Dy() > 400 {
+		t.Errorf("thumbnail is %dx%d, want it to fit in 400x400", bounds.Dx(), bounds.Dy())
+	}
+}
+
+func TestPngOriginalMakesAJpegThumbnail(t *testing.T) {
+	s3Client := newMemoryS3Client()
+	s3Client.put("clients/1/2/originals/a.png", encodePng(t, testImage(800, 600)), time.Now())
+
+	service := NewCacheCreatorService(CacheCreatorConfig{
+		ClientsPhotoFolder: "clients",
+		S3Client:           s3Client,
+	})
+
+	if err := service.createThumbnail(&models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true}, "clients/1/2/originals/a.png"); err != nil {
+		t.Fatalf("createThumbnail returned an error: %v", err)
+	}
+
+	assertJpegThumbnail(t, s3Client, "clients/1/2/thumbnails/a.png")
+}
+
+func TestAlbumImageListingUsesTheConfiguredExtensions(t *testing.T) {
+	s3Client := newMemoryS3Client()
+
+	for _, name := range []string{"a.jpg", "b.JPEG", "c.png", "d.gif", "notes.txt"} {
+		s3Client.put("clients/1/2/originals/"+name, []byte{}, time.Now())
+	}
+
+	tests := []struct {
+		name       string
+		extensions []string
+		want       []string
+	}{
+		{name: "defaults", want: []string{"a.jpg", "b.JPEG", "c.png"}},
+		{name: "configured", extensions: []string{"GIF", " .png "}, want: []string{"c.png", "d.gif"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewCacheCreatorService(CacheCreatorConfig{
+				ClientsPhotoFolder: "clients",
+				ImageExtensions:    tt.extensions,
+				S3Client:           s3Client,
+			})
+
+			objects, err := service.getAlbumImageListing(&models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true})
+			if err != nil {
+				t.Fatalf("getAlbumImageListing returned an error: %v", err)
+			}
+
+			got := []string{}
+
+			for _, object := range objects {
+				got = append(got, object.Key[len("clients/1/2/originals/"):])
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("listing = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeImageExtensionsDropsHeicWithoutTheDecoder(t *testing.T) {
+	got := normalizeImageExtensions([]string{"jpg", ".HEIC", "heif"})
+
+	want := []string{".jpg"}
+
+	if heicSupported {
+		want = []string{".jpg", ".heic", ".heif"}
+	}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("extensions = %v, want %v", got, want)
+	}
+}
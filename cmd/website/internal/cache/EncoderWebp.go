@@ -0,0 +1,31 @@
+//go:build webp
+
+package cache
+
+/*
+WebP encoding runs libwebp compiled to WebAssembly, so it needs no cgo, but
+it adds several megabytes to the binary. It is only compiled in when
+building with the "webp" tag. See the build-thumbnail-formats target in the
+Makefile.
+*/
+import (
+	"image"
+	"io"
+
+	"github.com/gen2brain/webp"
+)
+
+const (
+	webpQuality = 85
+)
+
+func init() {
+	thumbnailFormats[ThumbnailFormatWebp] = ThumbnailFormat{
+		Name:        ThumbnailFormatWebp,
+		ContentType: "image/webp",
+		Suffix:      ".webp",
+		encode: func(w io.Writer, img image.Image, _ int) error {
+			return webp.Encode(w, img, webp.Options{Quality: webpQuality, Method: 4})
+		},
+	}
+}
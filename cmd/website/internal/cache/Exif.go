@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	exifTagDateTime         = 0x0132
+	exifTagExifIFDPointer   = 0x8769
+	exifTagDateTimeOriginal = 0x9003
+
+	exifDateLayout = "2006:01:02 15:04:05"
+)
+
+var (
+	errNoExifDate = errors.New("no EXIF capture date")
+)
+
+/*
+readCaptureDate reads the EXIF capture date from the start of a JPEG. It
+prefers DateTimeOriginal and falls back to the IFD0 DateTime. EXIF dates
+carry no time zone, so they are read as UTC. errNoExifDate is returned for
+files without a usable date, including anything that isn't a JPEG.
+*/
+func readCaptureDate(r io.Reader) (time.Time, error) {
+	var (
+		err    error
+		marker [2]byte
+		length uint16
+	)
+
+	br := bufio.NewReader(r)
+
+	if _, err = io.ReadFull(br, marker[:]); err != nil || marker != [2]byte{0xFF, 0xD8} {
+		return time.Time{}, errNoExifDate
+	}
+
+	for {
+		if _, err = io.ReadFull(br, marker[:]); err != nil || marker[0] != 0xFF {
+			return time.Time{}, errNoExifDate
+		}
+
+		// Start of scan or end of image means the metadata segments are over
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			return time.Time{}, errNoExifDate
+		}
+
+		if err = binary.Read(br, binary.BigEndian, &length); err != nil || length < 2 {
+			return time.Time{}, errNoExifDate
+		}
+
+		segment := make([]byte, length-2)
+
+		if _, err = io.ReadFull(br, segment); err != nil {
+			return time.Time{}, errNoExifDate
+		}
+
+		if marker[1] == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return parseExifDate(segment[6:])
+		}
+	}
+}
+
+/*
+parseExifDate walks the TIFF structure inside an EXIF segment looking for
+the capture date.
+*/
+func parseExifDate(tiff []byte) (time.Time, error) {
+	var order binary.ByteOrder
+
+	if len(tiff) < 8 {
+		return time.Time{}, errNoExifDate
+	}
+
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return time.Time{}, errNoExifDate
+	}
+
+	ifd0 := exifIFDEntries(tiff, order, order.Uint32(tiff[4:8]))
+
+	if offset, ok := ifd0[exifTagExifIFDPointer]; ok {
+		exifIFD := exifIFDEntries(tiff, order, order.Uint32(offset))
+
+		if value, ok := exifIFD[exifTagDateTimeOriginal]; ok {
+			if result, err := parseExifDateValue(tiff, order, value); err == nil {
+				return result, nil
+			}
+		}
+	}
+
+	if value, ok := ifd0[exifTagDateTime]; ok {
+		return parseExifDateValue(tiff, order, value)
+	}
+
+	return time.Time{}, errNoExifDate
+}
+
+/*
+exifIFDEntries returns the raw 4 byte value field of each entry in the IFD
+at offset, keyed by tag.
+*/
+func exifIFDEntries(tiff []byte, order binary.ByteOrder, offset uint32) map[uint16][]byte {
+	result := map[uint16][]byte{}
+
+	if int(offset)+2 > len(tiff) {
+		return result
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	start := int(offset) + 2
+
+	for i := 0; i < count; i++ {
+		entry := start + i*12
+
+		if entry+12 > len(tiff) {
+			break
+		}
+
+		result[order.Uint16(tiff[entry:])] = tiff[entry+8 : entry+12]
+	}
+
+	return result
+}
+
+/*
+parseExifDateValue reads an ASCII date value. Dates are 20 bytes, so they
+never fit inline and the value field is always an offset.
+*/
+func parseExifDateValue(tiff []byte, order binary.ByteOrder, value []byte) (time.Time, error) {
+	offset := int(order.Uint32(value))
+
+	if offset+len(exifDateLayout) > len(tiff) {
+		return time.Time{}, errNoExifDate
+	}
+
+	result, err := time.Parse(exifDateLayout, string(tiff[offset:offset+len(exifDateLayout)]))
+
+	if err != nil {
+		return time.Time{}, errNoExifDate
+	}
+
+	return result, nil
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+/*
+withExifDate inserts an APP1 segment after the SOI marker of a JPEG. The
+date is stored as DateTimeOriginal in the EXIF IFD, or as DateTime in IFD0
+when original is false.
+*/
+func withExifDate(t *testing.T, jpegData []byte, order binary.ByteOrder, date string, original bool) []byte {
+	t.Helper()
+
+	tiff := &bytes.Buffer{}
+
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+
+	write := func(v any) {
+		if err := binary.Write(tiff, order, v); err != nil {
+			t.Fatalf("error writing EXIF: %v", err)
+		}
+	}
+
+	write(uint16(42))
+	write(uint32(8))
+
+	if original {
+		// IFD0 at 8 points to the EXIF IFD at 26, whose date follows at 44
+		write(uint16(1))
+		write([]uint16{exifTagExifIFDPointer, 4})
+		write([]uint32{1, 26, 0})
+		write(uint16(1))
+		write([]uint16{exifTagDateTimeOriginal, 2})
+		write([]uint32{20, 44, 0})
+	} else {
+		// IFD0 at 8 holds DateTime, with the date following at 26
+		write(uint16(1))
+		write([]uint16{exifTagDateTime, 2})
+		write([]uint32{20, 26, 0})
+	}
+
+	tiff.WriteString(date + "\x00")
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	result := &bytes.Buffer{}
+	result.Write(jpegData[:2])
+	result.Write([]byte{0xFF, 0xE1})
+	_ = binary.Write(result, binary.BigEndian, uint16(len(segment)+2))
+	result.Write(segment)
+	result.Write(jpegData[2:])
+
+	return result.Bytes()
+}
+
+func TestReadCaptureDate(t *testing.T) {
+	plain := encodeJpeg(t, testImage(8, 8))
+	want := time.Date(2023, time.October, 14, 16, 30, 5, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "big endian DateTimeOriginal", data: withExifDate(t, plain, binary.BigEndian, "2023:10:14 16:30:05", true), want: want},
+		{name: "little endian DateTimeOriginal", data: withExifDate(t, plain, binary.LittleEndian, "2023:10:14 16:30:05", true), want: want},
+		{name: "IFD0 DateTime", data: withExifDate(t, plain, binary.BigEndian, "2023:10:14 16:30:05", false), want: want},
+		{name: "blank date", data: withExifDate(t, plain, binary.BigEndian, "    :  :     :  :  ", true), wantErr: true},
+		{name: "no EXIF", data: plain, wantErr: true},
+		{name: "not a JPEG", data: encodePng(t, testImage(8, 8)), wantErr: true},
+		{name: "truncated", data: withExifDate(t, plain, binary.BigEndian, "2023:10:14 16:30:05", true)[:30], wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readCaptureDate(bytes.NewReader(tt.data))
+
+			if tt.wantErr {
+				if !errors.Is(err, errNoExifDate) {
+					t.Fatalf("readCaptureDate error = %v, want errNoExifDate", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("readCaptureDate returned an error: %v", err)
+			}
+
+			if !got.Equal(tt.want) {
+				t.Errorf("readCaptureDate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultHeroAspectRatio = 16.0 / 9.0
+)
+
+/*
+heroCropRect returns the largest region of bounds with the given aspect
+ratio, width over height. focusX and focusY, from 0 to 1, place the region
+the way CSS background-position percentages do: 0 keeps the left or top
+edge, 1 keeps the right or bottom edge, and 0.5 centers it.
+*/
+func heroCropRect(bounds image.Rectangle, aspectRatio, focusX, focusY float64) image.Rectangle {
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	cropWidth := width
+	cropHeight := int(math.Round(float64(width) / aspectRatio))
+
+	if cropHeight > height {
+		cropHeight = height
+		cropWidth = int(math.Round(float64(height) * aspectRatio))
+	}
+
+	left := bounds.Min.X + int(math.Round(float64(width-cropWidth)*clamp01(focusX)))
+	top := bounds.Min.Y + int(math.Round(float64(height-cropHeight)*clamp01(focusY)))
+
+	return image.Rect(left, top, left+cropWidth, top+cropHeight)
+}
+
+/*
+cropImage copies the region of img inside rect into a new image whose
+bounds start at 0, 0.
+*/
+func cropImage(img image.Image, rect image.Rectangle) image.Image {
+	result := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(result, result.Bounds(), img, rect.Min, draw.Src)
+	return result
+}
+
+/*
+focalPoint turns a poster position into a fraction from 0 to 1 across the
+image. Percentages and the keywords for the axis are understood. Lengths
+such as 20px, and anything else, center the crop, since they only make
+sense against the size of the page the banner is shown on.
+*/
+func focalPoint(position, startKeyword, endKeyword string) float64 {
+	position = strings.ToLower(strings.TrimSpace(position))
+
+	switch position {
+	case startKeyword:
+		return 0
+	case endKeyword:
+		return 1
+	}
+
+	if percent, ok := strings.CutSuffix(position, "%"); ok {
+		if value, err := strconv.ParseFloat(percent, 64); err == nil {
+			return clamp01(value / 100)
+		}
+	}
+
+	return 0.5
+}
+
+func clamp01(value float64) float64 {
+	return math.Min(math.Max(value, 0), 1)
+}
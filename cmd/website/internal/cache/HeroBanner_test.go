@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+func TestHeroCropRect(t *testing.T) {
+	tests := []struct {
+		name   string
+		bounds image.Rectangle
+		aspect float64
+		focusX float64
+		focusY float64
+		want   image.Rectangle
+	}{
+		{name: "wide original, centered", bounds: image.Rect(0, 0, 1000, 400), aspect: 2, focusX: 0.5, focusY: 0.5, want: image.Rect(100, 0, 900, 400)},
+		{name: "wide original, left", bounds: image.Rect(0, 0, 1000, 400), aspect: 2, focusX: 0, focusY: 0.5, want: image.Rect(0, 0, 800, 400)},
+		{name: "wide original, right", bounds: image.Rect(0, 0, 1000, 400), aspect: 2, focusX: 1, focusY: 0.5, want: image.Rect(200, 0, 1000, 400)},
+		{name: "tall original, top", bounds: image.Rect(0, 0, 600, 900), aspect: 2, focusX: 0.5, focusY: 0, want: image.Rect(0, 0, 600, 300)},
+		{name: "tall original, 30% down", bounds: image.Rect(0, 0, 600, 900), aspect: 2, focusX: 0.5, focusY: 0.3, want: image.Rect(0, 180, 600, 480)},
+		{name: "focus out of range", bounds: image.Rect(0, 0, 600, 900), aspect: 2, focusX: 0.5, focusY: 4, want: image.Rect(0, 600, 600, 900)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := heroCropRect(tt.bounds, tt.aspect, tt.focusX, tt.focusY); got != tt.want {
+				t.Errorf("heroCropRect = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFocalPoint(t *testing.T) {
+	tests := []struct {
+		position string
+		want     float64
+	}{
+		{position: "", want: 0.5},
+		{position: "left", want: 0},
+		{position: "Right", want: 1},
+		{position: "center", want: 0.5},
+		{position: "30%", want: 0.3},
+		{position: "150%", want: 1},
+		{position: "20px", want: 0.5},
+	}
+
+	for _, tt := range tests {
+		if got := focalPoint(tt.position, "left", "right"); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("focalPoint(%q) = %v, want %v", tt.position, got, tt.want)
+		}
+	}
+}
+
+func TestHeroBannerIsCroppedAroundTheFocalPoint(t *testing.T) {
+	// The left half of the poster is red and the right half blue
+	poster := image.NewRGBA(image.Rect(0, 0, 1600, 800))
+
+	for y := 0; y < 800; y++ {
+		for x := 0; x < 1600; x++ {
+			if x < 800 {
+				poster.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				poster.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+
+	tests := []struct {
+		name     string
+		xPos     string
+		wantRed  bool
+		wantBlue bool
+	}{
+		{name: "left", xPos: "0%", wantRed: true},
+		{name: "right", xPos: "right", wantBlue: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Client := newMemoryS3Client()
+			s3Client.put("clients/1/2/originals/poster.jpg", encodeJpeg(t, poster), time.Now())
+
+			service := NewCacheCreatorService(CacheCreatorConfig{
+				ClientsPhotoFolder: "clients",
+				HeroAspectRatio:    1,
+				S3Client:           s3Client,
+			})
+
+			album := &models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true, PosterImagePath: "poster.jpg", PosterXPos: tt.xPos}
+
+			if err := service.createHeroBanner(album); err != nil {
+				t.Fatalf("createHeroBanner returned an error: %v", err)
+			}
+
+			data, _ := s3Client.get("clients/1/2/hero-banner/poster.jpg")
+			banner, err := jpeg.Decode(bytes.NewReader(data))
+
+			if err != nil {
+				t.Fatalf("error decoding hero banner: %v", err)
+			}
+
+			if bounds := banner.Bounds(); bounds.Dx() != bounds.Dy() {
+				t.Errorf("banner is %dx%d, want the 1:1 aspect ratio", bounds.Dx(), bounds.Dy())
+			}
+
+			r, _, b, _ := banner.At(banner.Bounds().Dx()/2, banner.Bounds().Dy()/2).RGBA()
+
+			if isRed := r > b; isRed != tt.wantRed {
+				t.Errorf("center of the banner is red %v, want red %v", isRed, tt.wantRed)
+			}
+
+			if isBlue := b > r; isBlue != tt.wantBlue {
+				t.Errorf("center of the banner is blue %v, want blue %v", isBlue, tt.wantBlue)
+			}
+		})
+	}
+}
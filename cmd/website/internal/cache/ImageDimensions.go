@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/putoptions"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+const (
+	// ImageDimensionsFileName is the sidecar, in an album's folder, holding each original's size in pixels
+	ImageDimensionsFileName = "dimensions.json"
+
+	// maxDimensionReadBytes is how much of an original is read looking for its size. JPEGs with large EXIF blocks put it well past the start
+	maxDimensionReadBytes = 512 * 1024
+)
+
+/*
+ImageDimension is the size of one album original. Width and Height are
+zero when the original's header couldn't be read. OriginalModified
+records which version of the original was read, so it is only read again
+when it is replaced.
+*/
+type ImageDimension struct {
+	Width            int       `json:"width"`
+	Height           int       `json:"height"`
+	OriginalModified time.Time `json:"originalModified"`
+}
+
+/*
+ImageDimensions maps an album original's file name to its size.
+*/
+type ImageDimensions map[string]ImageDimension
+
+/*
+ImageDimensionsKey returns where an album's dimension sidecar is stored.
+*/
+func ImageDimensionsKey(clientsPhotoFolder string, album *models.Album) string {
+	return filepath.Join(
+		clientsPhotoFolder,
+		fmt.Sprint(album.ClientID),
+		fmt.Sprint(album.ID),
+		ImageDimensionsFileName,
+	)
+}
+
+/*
+ReadImageDimensions loads an album's dimension sidecar. A missing sidecar,
+such as before the album's first cache run, returns an empty map.
+*/
+func ReadImageDimensions(s3Client s3.S3Client, bucket, clientsPhotoFolder string, album *models.Album) (ImageDimensions, error) {
+	var (
+		err      error
+		metadata *s3.ObjectMetadata
+		object   s3.GetObjectResponse
+	)
+
+	result := ImageDimensions{}
+	key := ImageDimensionsKey(clientsPhotoFolder, album)
+
+	if metadata, err = s3Client.StatObject(bucket, key); err != nil {
+		return result, fmt.Errorf("error checking for image dimensions of album %d: %w", album.ID, err)
+	}
+
+	if metadata == nil {
+		return result, nil
+	}
+
+	if object, err = s3Client.Get(bucket, key); err != nil {
+		return result, fmt.Errorf("error reading image dimensions of album %d: %w", album.ID, err)
+	}
+
+	defer object.Body.Close()
+
+	if err = json.NewDecoder(object.Body).Decode(&result); err != nil {
+		return ImageDimensions{}, fmt.Errorf("error decoding image dimensions of album %d: %w", album.ID, err)
+	}
+
+	return result, nil
+}
+
+/*
+updateImageDimensions reads the size of any album original that is new or
+has been replaced since the last run, drops originals that are gone, and
+writes the sidecar back when anything changed. Only image headers are read,
+so nothing is decoded.
+*/
+func (c CacheCreatorService) updateImageDimensions(album *models.Album, originals []s3.Object) error {
+	var (
+		err      error
+		existing ImageDimensions
+	)
+
+	if existing, err = ReadImageDimensions(c.s3Client, c.awsBucket, c.clientsPhotoFolder, album); err != nil {
+		slog.Warn("unable to read album image dimensions. they will be rebuilt", "albumID", album.ID, "error", err)
+	}
+
+	result := ImageDimensions{}
+	changed := err != nil
+
+	for _, original := range originals {
+		fileName := filepath.Base(original.Key)
+
+		if current, ok := existing[fileName]; ok && current.OriginalModified.Equal(original.LastModified) {
+			result[fileName] = current
+			continue
+		}
+
+		changed = true
+		dimension := c.readOriginalDimension(original.Key)
+		dimension.OriginalModified = original.LastModified
+		result[fileName] = dimension
+	}
+
+	// Originals that were removed leave the sidecar with more entries than result
+	if !changed && len(result) == len(existing) {
+		return nil
+	}
+
+	b, err := json.Marshal(result)
+
+	if err != nil {
+		return fmt.Errorf("error encoding image dimensions of album %d: %w", album.ID, err)
+	}
+
+	key := ImageDimensionsKey(c.clientsPhotoFolder, album)
+
+	if _, err = c.s3Client.Put(c.awsBucket, key, bytes.NewReader(b), putoptions.WithContentType("application/json")); err != nil {
+		return fmt.Errorf("error writing image dimensions of album %d: %w", album.ID, err)
+	}
+
+	slog.Info("updated album image dimensions", "albumID", album.ID, "numImages", len(result))
+	return nil
+}
+
+/*
+readOriginalDimension returns an original's width and height, or zeroes
+when it can't be read.
+*/
+func (c CacheCreatorService) readOriginalDimension(key string) ImageDimension {
+	var (
+		err    error
+		object s3.GetObjectResponse
+		config image.Config
+	)
+
+	if object, err = c.s3Client.Get(c.awsBucket, key); err != nil {
+		slog.Error("error retrieving album image for its dimensions", "key", key, "error", err)
+		return ImageDimension{}
+	}
+
+	defer object.Body.Close()
+
+	if config, _, err = image.DecodeConfig(io.LimitReader(object.Body, maxDimensionReadBytes)); err != nil {
+		slog.Debug("unable to read album image dimensions", "key", key, "error", err)
+		return ImageDimension{}
+	}
+
+	return ImageDimension{
+		Width:  config.Width,
+		Height: config.Height,
+	}
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+func TestUpdateImageDimensions(t *testing.T) {
+	s3Client := newMemoryS3Client()
+	service := NewCacheCreatorService(CacheCreatorConfig{
+		AwsBucket:          "bucket",
+		ClientsPhotoFolder: "clients",
+		S3Client:           s3Client,
+	})
+
+	album := &models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true}
+	uploaded := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+
+	s3Client.put("clients/1/2/originals/wide.jpg", encodeJpeg(t, testImage(60, 40)), uploaded)
+	s3Client.put("clients/1/2/originals/tall.png", encodePng(t, testImage(30, 50)), uploaded)
+	s3Client.put("clients/1/2/originals/broken.jpg", []byte("not an image"), uploaded)
+
+	originals, _ := s3Client.List("bucket", "clients/1/2/originals")
+
+	if err := service.updateImageDimensions(album, originals.Objects); err != nil {
+		t.Fatalf("updateImageDimensions returned an error: %v", err)
+	}
+
+	got, err := ReadImageDimensions(s3Client, "bucket", "clients", album)
+
+	if err != nil {
+		t.Fatalf("ReadImageDimensions returned an error: %v", err)
+	}
+
+	if wide := got["wide.jpg"]; wide.Width != 60 || wide.Height != 40 || !wide.OriginalModified.Equal(uploaded) {
+		t.Errorf("wide.jpg = %+v, want 60x40 and the upload time", wide)
+	}
+
+	if tall := got["tall.png"]; tall.Width != 30 || tall.Height != 50 {
+		t.Errorf("tall.png = %+v, want 30x50", tall)
+	}
+
+	if broken, ok := got["broken.jpg"]; !ok || broken.Width != 0 || broken.Height != 0 {
+		t.Errorf("broken.jpg = %+v, %v; want zeroes", broken, ok)
+	}
+
+	/*
+	 * Replace one original and remove another. Only the replacement is
+	 * read again, and the removed original drops out of the sidecar.
+	 */
+	s3Client.put("clients/1/2/originals/wide.jpg", encodeJpeg(t, testImage(80, 20)), uploaded.Add(time.Hour))
+	_, _ = s3Client.Delete("bucket", []string{"clients/1/2/originals/broken.jpg"})
+
+	originals, _ = s3Client.List("bucket", "clients/1/2/originals")
+
+	if err = service.updateImageDimensions(album, originals.Objects); err != nil {
+		t.Fatalf("second updateImageDimensions returned an error: %v", err)
+	}
+
+	got, _ = ReadImageDimensions(s3Client, "bucket", "clients", album)
+
+	if _, ok := got["broken.jpg"]; ok || len(got) != 2 {
+		t.Errorf("dimensions = %+v, want only wide.jpg and tall.png", got)
+	}
+
+	if wide := got["wide.jpg"]; wide.Width != 80 || wide.Height != 20 {
+		t.Errorf("replaced wide.jpg = %+v, want 80x20", wide)
+	}
+}
+
+func TestReadImageDimensionsWithoutASidecar(t *testing.T) {
+	album := &models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true}
+	got, err := ReadImageDimensions(newMemoryS3Client(), "bucket", "clients", album)
+
+	if err != nil || got == nil || len(got) != 0 {
+		t.Errorf("ReadImageDimensions = %v, %v; want an empty map", got, err)
+	}
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/putoptions"
+)
+
+const (
+	// cacheLockKey is the object in the bucket that holds the cache creator lock
+	cacheLockKey = "locks/cache-creator.json"
+
+	// defaultCacheLockTTL is how long a lock is held before another instance may reclaim it
+	defaultCacheLockTTL = time.Hour * 2
+
+	// cacheLockSettleDelay is how long to wait before reading a lock back to see who won
+	cacheLockSettleDelay = time.Second * 2
+)
+
+/*
+cacheLock is the lease stored in the lock object. ExpiresAt lets other
+instances reclaim a lock left behind by an instance that died mid-run.
+*/
+type cacheLock struct {
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+/*
+newInstanceID names this instance as a lock owner. The random suffix keeps
+two processes on the same host apart.
+*/
+func newInstanceID() string {
+	hostname, _ := os.Hostname()
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+
+	return fmt.Sprintf("%s-%s", hostname, hex.EncodeToString(b))
+}
+
+/*
+TryAcquireLock takes the cache creator lock so only one instance builds the
+cache at a time. It returns false, without an error, when another instance
+holds an unexpired lock.
+
+S3 has no compare-and-swap, so this is advisory: the lock is written, then
+read back after a short delay. When two instances race, the last write wins
+and only that instance sees itself as the owner.
+*/
+func (c CacheCreatorService) TryAcquireLock() (bool, error) {
+	var (
+		err  error
+		lock *cacheLock
+	)
+
+	if lock, err = c.readLock(); err != nil {
+		return false, err
+	}
+
+	if lock != nil && lock.Owner != c.instanceID && time.Now().Before(lock.ExpiresAt) {
+		slog.Info("cache creator lock is held by another instance", "owner", lock.Owner, "expiresAt", lock.ExpiresAt)
+		return false, nil
+	}
+
+	if lock != nil && lock.Owner != c.instanceID {
+		slog.Warn("reclaiming expired cache creator lock", "owner", lock.Owner, "expiresAt", lock.ExpiresAt)
+	}
+
+	b, err := json.Marshal(cacheLock{
+		Owner:     c.instanceID,
+		ExpiresAt: time.Now().Add(c.lockTTL),
+	})
+
+	if err != nil {
+		return false, fmt.Errorf("error encoding cache creator lock: %w", err)
+	}
+
+	if _, err = c.s3Client.Put(c.awsBucket, cacheLockKey, bytes.NewReader(b), putoptions.WithContentType("application/json")); err != nil {
+		return false, fmt.Errorf("error writing cache creator lock: %w", err)
+	}
+
+	time.Sleep(c.lockSettleDelay)
+
+	if lock, err = c.readLock(); err != nil {
+		return false, err
+	}
+
+	if lock == nil || lock.Owner != c.instanceID {
+		slog.Info("lost the race for the cache creator lock")
+		return false, nil
+	}
+
+	return true, nil
+}
+
+/*
+ReleaseLock gives up the cache creator lock. A lock that has since been
+reclaimed by another instance is left alone.
+*/
+func (c CacheCreatorService) ReleaseLock() error {
+	var (
+		err  error
+		lock *cacheLock
+	)
+
+	if lock, err = c.readLock(); err != nil {
+		return err
+	}
+
+	if lock == nil || lock.Owner != c.instanceID {
+		return nil
+	}
+
+	if _, err = c.s3Client.Delete(c.awsBucket, []string{cacheLockKey}); err != nil {
+		return fmt.Errorf("error removing cache creator lock: %w", err)
+	}
+
+	return nil
+}
+
+/*
+readLock returns the current lock, or nil when there isn't one. A lock that
+can't be decoded is treated as expired so it can be reclaimed.
+*/
+func (c CacheCreatorService) readLock() (*cacheLock, error) {
+	var (
+		err      error
+		metadata *s3.ObjectMetadata
+		object   s3.GetObjectResponse
+	)
+
+	if metadata, err = c.s3Client.StatObject(c.awsBucket, cacheLockKey); err != nil {
+		return nil, fmt.Errorf("error checking for the cache creator lock: %w", err)
+	}
+
+	if metadata == nil {
+		return nil, nil
+	}
+
+	if object, err = c.s3Client.Get(c.awsBucket, cacheLockKey); err != nil {
+		return nil, fmt.Errorf("error reading the cache creator lock: %w", err)
+	}
+
+	defer object.Body.Close()
+
+	result := &cacheLock{}
+
+	if err = json.NewDecoder(object.Body).Decode(result); err != nil {
+		slog.Warn("unable to decode the cache creator lock. treating it as expired", "error", err)
+		return &cacheLock{}, nil
+	}
+
+	return result, nil
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newLockTestService(s3Client *memoryS3Client, instanceID string) CacheCreatorService {
+	service := NewCacheCreatorService(CacheCreatorConfig{
+		AwsBucket:  "bucket",
+		InstanceID: instanceID,
+		S3Client:   s3Client,
+	})
+
+	service.lockSettleDelay = 0
+	return service
+}
+
+func TestOnlyOneInstanceAcquiresTheLock(t *testing.T) {
+	s3Client := newMemoryS3Client()
+	first := newLockTestService(s3Client, "first")
+	second := newLockTestService(s3Client, "second")
+
+	if acquired, err := first.TryAcquireLock(); err != nil || !acquired {
+		t.Fatalf("first TryAcquireLock = %v, %v; want the lock", acquired, err)
+	}
+
+	if acquired, err := second.TryAcquireLock(); err != nil || acquired {
+		t.Fatalf("second TryAcquireLock = %v, %v; want it to be turned away", acquired, err)
+	}
+
+	// Releasing someone else's lock leaves it in place
+	if err := second.ReleaseLock(); err != nil {
+		t.Fatalf("second ReleaseLock returned an error: %v", err)
+	}
+
+	if _, ok := s3Client.get(cacheLockKey); !ok {
+		t.Fatalf("the lock was removed by an instance that doesn't hold it")
+	}
+
+	if err := first.ReleaseLock(); err != nil {
+		t.Fatalf("first ReleaseLock returned an error: %v", err)
+	}
+
+	if acquired, err := second.TryAcquireLock(); err != nil || !acquired {
+		t.Errorf("second TryAcquireLock after release = %v, %v; want the lock", acquired, err)
+	}
+}
+
+func TestStaleLocksAreReclaimed(t *testing.T) {
+	tests := []struct {
+		name string
+		lock []byte
+	}{
+		{name: "expired", lock: mustMarshalLock(t, cacheLock{Owner: "crashed", ExpiresAt: time.Now().Add(-time.Minute)})},
+		{name: "unreadable", lock: []byte("not json")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Client := newMemoryS3Client()
+			s3Client.put(cacheLockKey, tt.lock, time.Now())
+
+			service := newLockTestService(s3Client, "survivor")
+
+			if acquired, err := service.TryAcquireLock(); err != nil || !acquired {
+				t.Fatalf("TryAcquireLock = %v, %v; want the lock", acquired, err)
+			}
+
+			data, _ := s3Client.get(cacheLockKey)
+			lock := cacheLock{}
+
+			if err := json.Unmarshal(data, &lock); err != nil || lock.Owner != "survivor" {
+				t.Errorf("lock = %s, want it owned by survivor", data)
+			}
+		})
+	}
+}
+
+func TestRacingInstancesOnlyOneProceeds(t *testing.T) {
+	s3Client := newMemoryS3Client()
+
+	services := []CacheCreatorService{}
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		service := newLockTestService(s3Client, id)
+		service.lockSettleDelay = 50 * time.Millisecond
+		services = append(services, service)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		acquired int
+	)
+
+	start := make(chan struct{})
+
+	for _, service := range services {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			<-start
+
+			ok, err := service.TryAcquireLock()
+			if err != nil {
+				t.Errorf("TryAcquireLock returned an error: %v", err)
+			}
+
+			if ok {
+				mu.Lock()
+				acquired++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	if acquired != 1 {
+		t.Errorf("%d instances acquired the lock, want exactly 1", acquired)
+	}
+}
+
+func mustMarshalLock(t *testing.T, lock cacheLock) []byte {
+	t.Helper()
+
+	b, err := json.Marshal(lock)
+	if err != nil {
+		t.Fatalf("error encoding lock: %v", err)
+	}
+
+	return b
+}
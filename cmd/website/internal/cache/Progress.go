@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultProgressInterval = time.Second * 10
+)
+
+/*
+cacheProgress counts thumbnail tasks as they are submitted and finished.
+Pool workers report into it concurrently, so every counter is atomic. At
+most one progress line is logged per interval, no matter how many workers
+finish at the same time.
+*/
+type cacheProgress struct {
+	completed  atomic.Int64
+	failed     atomic.Int64
+	interval   time.Duration
+	lastReport atomic.Int64
+	now        func() time.Time
+	skipped    atomic.Int64
+	submitted  atomic.Int64
+}
+
+func newCacheProgress(interval time.Duration) *cacheProgress {
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+
+	p := &cacheProgress{
+		interval: interval,
+		now:      time.Now,
+	}
+
+	p.lastReport.Store(p.now().UnixNano())
+	return p
+}
+
+func (p *cacheProgress) submit() {
+	p.submitted.Add(1)
+}
+
+// complete records a task that created a thumbnail
+func (p *cacheProgress) complete() {
+	p.completed.Add(1)
+	p.maybeReport()
+}
+
+// fail records a task whose thumbnail could not be created
+func (p *cacheProgress) fail() {
+	p.failed.Add(1)
+	p.maybeReport()
+}
+
+// skip records a task whose thumbnail already existed
+func (p *cacheProgress) skip() {
+	p.skipped.Add(1)
+	p.maybeReport()
+}
+
+/*
+maybeReport logs progress if the interval has passed since the last report.
+When several workers get here at once, only the one that wins the swap logs.
+Returns true if this call logged.
+*/
+func (p *cacheProgress) maybeReport() bool {
+	now := p.now().UnixNano()
+	last := p.lastReport.Load()
+
+	if now-last < int64(p.interval) {
+		return false
+	}
+
+	if !p.lastReport.CompareAndSwap(last, now) {
+		return false
+	}
+
+	p.log("cache creation progress")
+	return true
+}
+
+// finish logs the final counts
+func (p *cacheProgress) finish() {
+	p.log("cache creation finished")
+}
+
+// done is the number of tasks that have finished, however they ended
+func (p *cacheProgress) done() int64 {
+	return p.completed.Load() + p.failed.Load() + p.skipped.Load()
+}
+
+func (p *cacheProgress) log(message string) {
+	slog.Info(
+		message,
+		"submitted", p.submitted.Load(),
+		"done", p.done(),
+		"created", p.completed.Load(),
+		"skipped", p.skipped.Load(),
+		"failed", p.failed.Load(),
+	)
+}
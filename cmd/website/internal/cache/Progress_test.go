@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/getoptions"
+	"github.com/adampresley/adamgokit/s3/listoptions"
+	"github.com/adampresley/adamgokit/s3/putoptions"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/alitto/pond/v2"
+)
+
+/*
+fakeS3Client lists a fixed set of originals and reports every thumbnail and
+hero banner as up to date. Every object reads back empty and uploads are
+thrown away. Anything else panics through the nil embedded interface.
+*/
+type fakeS3Client struct {
+	s3.S3Client
+
+	objects []s3.Object
+	stats   atomic.Int64
+}
+
+func (f *fakeS3Client) List(bucket, path string, options ...listoptions.ListOption) (s3.ListResponse, error) {
+	return s3.ListResponse{
+		NumObjects: len(f.objects),
+		Objects:    f.objects,
+	}, nil
+}
+
+func (f *fakeS3Client) Get(bucket, key string, options ...getoptions.GetOption) (s3.GetObjectResponse, error) {
+	return s3.GetObjectResponse{Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func (f *fakeS3Client) Put(bucket, key string, body io.Reader, options ...putoptions.PutOption) (s3.PutObjectResponse, error) {
+	_, err := io.Copy(io.Discard, body)
+	return s3.PutObjectResponse{}, err
+}
+
+func (f *fakeS3Client) StatObject(bucket, key string) (*s3.ObjectMetadata, error) {
+	f.stats.Add(1)
+
+	return &s3.ObjectMetadata{
+		LastModified: time.Now(),
+	}, nil
+}
+
+func TestCacheProgressCountsConcurrentWorkers(t *testing.T) {
+	const workers = 16
+	const tasksPerWorker = 500
+
+	progress := newCacheProgress(time.Millisecond)
+	wg := sync.WaitGroup{}
+
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for task := 0; task < tasksPerWorker; task++ {
+				progress.submit()
+
+				switch task % 3 {
+				case 0:
+					progress.complete()
+				case 1:
+					progress.fail()
+				default:
+					progress.skip()
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	want := int64(workers * tasksPerWorker)
+
+	if got := progress.submitted.Load(); got != want {
+		t.Errorf("submitted = %d, want %d", got, want)
+	}
+
+	if got := progress.done(); got != want {
+		t.Errorf("done = %d, want %d", got, want)
+	}
+}
+
+func TestCacheProgressReportsOncePerInterval(t *testing.T) {
+	now := atomic.Int64{}
+	now.Store(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano())
+
+	progress := newCacheProgress(time.Second)
+	progress.now = func() time.Time { return time.Unix(0, now.Load()) }
+	progress.lastReport.Store(now.Load())
+
+	if progress.maybeReport() {
+		t.Fatalf("expected no report before the interval has passed")
+	}
+
+	now.Add(int64(time.Second))
+
+	reports := atomic.Int64{}
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if progress.maybeReport() {
+				reports.Add(1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if got := reports.Load(); got != 1 {
+		t.Errorf("reports = %d, want 1", got)
+	}
+}
+
+func TestSubmitAlbumReportsEveryThumbnail(t *testing.T) {
+	const numImages = 2000
+
+	objects := make([]s3.Object, 0, numImages)
+	modified := time.Now().Add(-time.Hour)
+
+	for i := 0; i < numImages; i++ {
+		objects = append(objects, s3.Object{
+			Key:          fmt.Sprintf("clients/1/2/originals/image-%d.jpg", i),
+			LastModified: modified,
+		})
+	}
+
+	s3Client := &fakeS3Client{objects: objects}
+
+	creator := NewCacheCreatorService(CacheCreatorConfig{
+		AwsBucket:          "bucket",
+		ClientsPhotoFolder: "clients",
+		MaxCacheWorkers:    8,
+		S3Client:           s3Client,
+		ShutdownCtx:        context.Background(),
+	})
+
+	pool := pond.NewPool(
+		creator.maxCacheWorkers,
+		pond.WithQueueSize(creator.maxCacheWorkers*queueSizePerWorker),
+	)
+
+	progress := newCacheProgress(time.Millisecond)
+	client := models.Client{BaseModel: models.BaseModel{ID: 1}}
+	album := &models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true, PosterImagePath: "image-0.jpg"}
+
+	if err := creator.submitAlbum(pool, progress, client, album, map[string]time.Time{}); err != nil {
+		t.Fatalf("submitAlbum returned an error: %v", err)
+	}
+
+	_ = pool.Stop().Wait()
+
+	if got := progress.submitted.Load(); got != numImages {
+		t.Errorf("submitted = %d, want %d", got, numImages)
+	}
+
+	if got := progress.skipped.Load(); got != numImages {
+		t.Errorf("skipped = %d, want %d", got, numImages)
+	}
+
+	if got := progress.done(); got != numImages {
+		t.Errorf("done = %d, want %d", got, numImages)
+	}
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/listoptions"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+)
+
+const (
+	defaultS3MaxAttempts = 4
+	defaultS3RetryDelay  = time.Millisecond * 500
+)
+
+/*
+httpStatusError is satisfied by the AWS SDK's response errors, which carry
+the status code S3 answered with.
+*/
+type httpStatusError interface {
+	HTTPStatusCode() int
+}
+
+/*
+withS3Retry runs an S3 Get or Put, retrying throttling, server errors, and
+timeouts with backoff. Anything else, such as a missing object or a denied
+request, fails straight away since trying again won't change the answer.
+fn must start the request afresh each time, so bodies are rebuilt inside it.
+*/
+func (c CacheCreatorService) withS3Retry(operation, key string, fn func() error) error {
+	return services.RetryWithBackoff(c.backgroundContext(), func() error {
+		err := fn()
+
+		if err != nil && !isRetryableS3Error(err) {
+			return services.Permanent(err)
+		}
+
+		return err
+	}, services.RetryOptions{
+		BaseDelay:   c.s3RetryDelay,
+		MaxAttempts: c.s3MaxAttempts,
+		OnRetry: func(attempt int, err error) {
+			slog.Warn("S3 request failed. retrying", "operation", operation, "key", key, "attempt", attempt, "error", err)
+		},
+	})
+}
+
+/*
+listObjects lists path in the bucket, giving up after s3OperationTimeout so a
+hung S3 endpoint can't stall a cache run, or once the service shuts down.
+*/
+func (c CacheCreatorService) listObjects(path string, options ...listoptions.ListOption) (s3.ListResponse, error) {
+	ctx, cancel := context.WithTimeout(c.backgroundContext(), c.s3OperationTimeout)
+	defer cancel()
+
+	return services.ListObjects(ctx, c.s3Client, c.awsBucket, path, options...)
+}
+
+/*
+backgroundContext is the context S3 work runs under. It ends when the
+service shuts down.
+*/
+func (c CacheCreatorService) backgroundContext() context.Context {
+	if c.shutdownCtx == nil {
+		return context.Background()
+	}
+
+	return c.shutdownCtx
+}
+
+/*
+isRetryableS3Error returns true for errors that may go away on their own:
+429 and 5xx responses, and timeouts. Other responses, such as 403 and 404,
+and errors without a status are not retried.
+*/
+func isRetryableS3Error(err error) bool {
+	var (
+		statusErr httpStatusError
+		netErr    net.Error
+	)
+
+	if errors.As(err, &statusErr) {
+		status := statusErr.HTTPStatusCode()
+		return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
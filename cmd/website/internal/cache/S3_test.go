@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/getoptions"
+	"github.com/adampresley/adamgokit/s3/putoptions"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+type statusError struct {
+	status int
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("https response error StatusCode: %d", e.status)
+}
+
+func (e statusError) HTTPStatusCode() int {
+	return e.status
+}
+
+/*
+flakyS3Client fails the first failures Gets and Puts of each key with err,
+then passes them through to the in-memory bucket.
+*/
+type flakyS3Client struct {
+	*memoryS3Client
+
+	err      error
+	failures int
+
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+func newFlakyS3Client(err error, failures int) *flakyS3Client {
+	return &flakyS3Client{
+		memoryS3Client: newMemoryS3Client(),
+		err:            err,
+		failures:       failures,
+		attempts:       map[string]int{},
+	}
+}
+
+func (f *flakyS3Client) attempt(operation, key string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.attempts[operation+" "+key]++
+	return f.attempts[operation+" "+key]
+}
+
+func (f *flakyS3Client) attemptsFor(operation, key string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.attempts[operation+" "+key]
+}
+
+func (f *flakyS3Client) Get(bucket, key string, options ...getoptions.GetOption) (s3.GetObjectResponse, error) {
+	if f.attempt("get", key) <= f.failures {
+		return s3.GetObjectResponse{}, fmt.Errorf("operation error S3: GetObject: %w", f.err)
+	}
+
+	return f.memoryS3Client.Get(bucket, key, options...)
+}
+
+func (f *flakyS3Client) Put(bucket, key string, body io.Reader, options ...putoptions.PutOption) (s3.PutObjectResponse, error) {
+	if f.attempt("put", key) <= f.failures {
+		// Read the body like a real upload would, so a retry has to start afresh
+		_, _ = io.Copy(io.Discard, body)
+		return s3.PutObjectResponse{}, fmt.Errorf("operation error S3: PutObject: %w", f.err)
+	}
+
+	return f.memoryS3Client.Put(bucket, key, body, options...)
+}
+
+func TestIsRetryableS3Error(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "throttled", err: statusError{status: http.StatusTooManyRequests}, want: true},
+		{name: "server error", err: statusError{status: http.StatusInternalServerError}, want: true},
+		{name: "slow down", err: statusError{status: http.StatusServiceUnavailable}, want: true},
+		{name: "timeout", err: fmt.Errorf("operation error S3: GetObject: %w", context.DeadlineExceeded), want: true},
+		{name: "forbidden", err: statusError{status: http.StatusForbidden}},
+		{name: "not found", err: statusError{status: http.StatusNotFound}},
+		{name: "no status", err: errors.New("something else")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableS3Error(tt.err); got != tt.want {
+				t.Errorf("isRetryableS3Error(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThumbnailsRetryTransientS3Errors(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		failures     int
+		wantErr      bool
+		wantAttempts int
+	}{
+		{name: "fails twice then succeeds", err: statusError{status: http.StatusServiceUnavailable}, failures: 2, wantAttempts: 3},
+		{name: "not retryable", err: statusError{status: http.StatusForbidden}, failures: 2, wantErr: true, wantAttempts: 1},
+		{name: "keeps failing", err: statusError{status: http.StatusInternalServerError}, failures: 10, wantErr: true, wantAttempts: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Client := newFlakyS3Client(tt.err, tt.failures)
+
+			originalKey := "clients/1/3/originals/a.jpg"
+			s3Client.put(originalKey, encodeJpeg(t, testImage(40, 30)), time.Now())
+
+			service := NewCacheCreatorService(CacheCreatorConfig{
+				ClientsPhotoFolder: "clients",
+				S3Client:           s3Client,
+				S3MaxAttempts:      4,
+				S3RetryDelay:       time.Millisecond,
+			})
+
+			album := &models.Album{BaseModel: models.BaseModel{ID: 3}, ClientID: 1, Purchased: true}
+			err := service.createThumbnail(album, originalKey)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("createThumbnail returned %v, want an error %v", err, tt.wantErr)
+			}
+
+			if got := s3Client.attemptsFor("get", originalKey); got != tt.wantAttempts {
+				t.Errorf("got the original %d times, want %d", got, tt.wantAttempts)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			thumbnailKey := "clients/1/3/thumbnails/a.jpg"
+
+			if got := s3Client.attemptsFor("put", thumbnailKey); got != tt.wantAttempts {
+				t.Errorf("put the thumbnail %d times, want %d", got, tt.wantAttempts)
+			}
+
+			if _, ok := s3Client.get(thumbnailKey); !ok {
+				t.Errorf("thumbnail %s was not stored", thumbnailKey)
+			}
+		})
+	}
+}
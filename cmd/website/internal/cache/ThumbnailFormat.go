@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"image"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	ThumbnailFormatAvif = "avif"
+	ThumbnailFormatJpeg = "jpeg"
+	ThumbnailFormatWebp = "webp"
+
+	defaultJpegQuality = 85
+)
+
+/*
+ThumbnailFormat is how album thumbnails are encoded and what they are named.
+*/
+type ThumbnailFormat struct {
+	Name        string
+	ContentType string
+
+	/*
+	 * Suffix is added to the original's name. JPEG has none, so thumbnails
+	 * made before the format was configurable are still found.
+	 */
+	Suffix string
+
+	// encode writes img in this format. jpegQuality is only used by JPEG
+	encode func(w io.Writer, img image.Image, jpegQuality int) error
+}
+
+var (
+	JpegThumbnails = ThumbnailFormat{
+		Name:        ThumbnailFormatJpeg,
+		ContentType: "image/jpeg",
+		encode: func(w io.Writer, img image.Image, jpegQuality int) error {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+		},
+	}
+
+	// thumbnailFormats are the compiled in formats. WebP and AVIF are added by build tags
+	thumbnailFormats = map[string]ThumbnailFormat{
+		ThumbnailFormatJpeg: JpegThumbnails,
+	}
+)
+
+/*
+Key returns the key of the thumbnail in this format for an album original.
+*/
+func (f ThumbnailFormat) Key(originalKey string) string {
+	return ThumbnailKey(originalKey) + f.Suffix
+}
+
+/*
+PreviewKey returns the key an album original is previewed from in this
+format: its thumbnail once the album is purchased and its watermarked proof
+until then.
+*/
+func (f ThumbnailFormat) PreviewKey(originalKey string, purchased bool) string {
+	if purchased {
+		return f.Key(originalKey)
+	}
+
+	return ProofKey(originalKey) + f.Suffix
+}
+
+/*
+ResolveThumbnailFormat returns the thumbnail format with the given name.
+When that format's encoder isn't compiled in, or the name is unknown, it
+falls back to JPEG with a warning.
+*/
+func ResolveThumbnailFormat(name string) ThumbnailFormat {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	if name == "" || name == "jpg" {
+		return JpegThumbnails
+	}
+
+	if format, ok := thumbnailFormats[name]; ok {
+		return format
+	}
+
+	slog.Warn("thumbnail format is not compiled in. build with the tag of the same name to use it. using JPEG", "format", name)
+	return JpegThumbnails
+}
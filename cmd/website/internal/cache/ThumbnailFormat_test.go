@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+func TestThumbnailFormats(t *testing.T) {
+	tests := []struct {
+		format          string
+		wantName        string
+		wantSuffix      string
+		wantContentType string
+		wantMagic       []byte
+		wantMagicAt     int
+	}{
+		{format: "", wantName: ThumbnailFormatJpeg, wantSuffix: "", wantContentType: "image/jpeg", wantMagic: []byte{0xff, 0xd8, 0xff}},
+		{format: "JPG", wantName: ThumbnailFormatJpeg, wantSuffix: "", wantContentType: "image/jpeg", wantMagic: []byte{0xff, 0xd8, 0xff}},
+		{format: "webp", wantName: ThumbnailFormatWebp, wantSuffix: ".webp", wantContentType: "image/webp", wantMagic: []byte("WEBP"), wantMagicAt: 8},
+		{format: "avif", wantName: ThumbnailFormatAvif, wantSuffix: ".avif", wantContentType: "image/avif", wantMagic: []byte("ftypavif"), wantMagicAt: 4},
+		{format: "gif", wantName: ThumbnailFormatJpeg, wantSuffix: "", wantContentType: "image/jpeg", wantMagic: []byte{0xff, 0xd8, 0xff}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			// Without its build tag an encoder falls back to JPEG
+			if _, compiledIn := thumbnailFormats[tt.wantName]; !compiledIn {
+				tt.wantName, tt.wantSuffix, tt.wantContentType = ThumbnailFormatJpeg, "", "image/jpeg"
+				tt.wantMagic, tt.wantMagicAt = []byte{0xff, 0xd8, 0xff}, 0
+			}
+
+			s3Client := newMemoryS3Client()
+			s3Client.put("clients/1/2/originals/a.jpg", encodeJpeg(t, testImage(80, 40)), time.Now().Add(-time.Hour))
+
+			service := NewCacheCreatorService(CacheCreatorConfig{
+				ClientsPhotoFolder: "clients",
+				S3Client:           s3Client,
+				ShutdownCtx:        context.Background(),
+				ThumbnailFormat:    tt.format,
+			})
+
+			format := service.ThumbnailFormat()
+
+			if format.Name != tt.wantName || format.Suffix != tt.wantSuffix || format.ContentType != tt.wantContentType {
+				t.Errorf("ThumbnailFormat() = %s %q %s, want %s %q %s", format.Name, format.Suffix, format.ContentType, tt.wantName, tt.wantSuffix, tt.wantContentType)
+			}
+
+			album := &models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true}
+
+			if err := service.createThumbnail(album, "clients/1/2/originals/a.jpg"); err != nil {
+				t.Fatalf("createThumbnail() = %v", err)
+			}
+
+			wantKey := "clients/1/2/thumbnails/a.jpg" + tt.wantSuffix
+
+			if got := format.Key("clients/1/2/originals/a.jpg"); got != wantKey {
+				t.Errorf("Key() = %s, want %s", got, wantKey)
+			}
+
+			data, ok := s3Client.get(wantKey)
+
+			if !ok {
+				t.Fatalf("nothing written to %s: %v", wantKey, s3Client.keys())
+			}
+
+			if len(data) < tt.wantMagicAt+len(tt.wantMagic) || !bytes.Equal(data[tt.wantMagicAt:tt.wantMagicAt+len(tt.wantMagic)], tt.wantMagic) {
+				t.Errorf("%s does not start like a %s image", wantKey, tt.wantName)
+			}
+
+			if !service.doesThumbnailExist(album, s3.Object{Key: "clients/1/2/originals/a.jpg", LastModified: time.Now().Add(-time.Hour)}) {
+				t.Errorf("the thumbnail just written is not found")
+			}
+		})
+	}
+}
+
+func TestJpegQualityIsConfigurable(t *testing.T) {
+	sizes := map[int][2]int{}
+
+	for _, quality := range []int{50, 95} {
+		s3Client := newMemoryS3Client()
+		s3Client.put("clients/1/2/originals/a.jpg", encodeJpeg(t, testImage(800, 600)), time.Now())
+
+		service := NewCacheCreatorService(CacheCreatorConfig{
+			ClientsPhotoFolder: "clients",
+			JpegQuality:        quality,
+			S3Client:           s3Client,
+		})
+
+		album := &models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true, PosterImagePath: "a.jpg"}
+
+		if err := service.createThumbnail(album, "clients/1/2/originals/a.jpg"); err != nil {
+			t.Fatalf("createThumbnail() = %v", err)
+		}
+
+		if err := service.createHeroBanner(album); err != nil {
+			t.Fatalf("createHeroBanner() = %v", err)
+		}
+
+		thumbnail, _ := s3Client.get("clients/1/2/thumbnails/a.jpg")
+		banner, _ := s3Client.get("clients/1/2/hero-banner/a.jpg")
+		sizes[quality] = [2]int{len(thumbnail), len(banner)}
+	}
+
+	if sizes[50][0] >= sizes[95][0] {
+		t.Errorf("thumbnail at quality 50 is %d bytes, want it smaller than %d bytes at 95", sizes[50][0], sizes[95][0])
+	}
+
+	if sizes[50][1] >= sizes[95][1] {
+		t.Errorf("hero banner at quality 50 is %d bytes, want it smaller than %d bytes at 95", sizes[50][1], sizes[95][1])
+	}
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/fs"
+	"math"
+
+	"github.com/nfnt/resize"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	watermarkOpacity = 0.35
+	watermarkScale   = 0.5
+)
+
+type WatermarkConfig struct {
+	FS        fs.FS
+	ImagePath string
+	Text      string
+	Tiled     bool
+}
+
+/*
+Watermark composites a semi-transparent mark onto an image. The mark is
+either a PNG logo or a line of text, and is scaled relative to the size
+of the image it is applied to.
+*/
+type Watermark struct {
+	mark  image.Image
+	tiled bool
+}
+
+/*
+NewWatermark creates a watermark from a PNG logo when ImagePath is set,
+otherwise from Text. At least one of the two is required.
+*/
+func NewWatermark(config WatermarkConfig) (*Watermark, error) {
+	var (
+		err  error
+		mark image.Image
+	)
+
+	switch {
+	case config.ImagePath != "":
+		if mark, err = loadWatermarkImage(config.FS, config.ImagePath); err != nil {
+			return nil, err
+		}
+
+	case config.Text != "":
+		mark = renderWatermarkText(config.Text)
+
+	default:
+		return nil, fmt.Errorf("watermark requires either an image path or text")
+	}
+
+	return &Watermark{
+		mark:  mark,
+		tiled: config.Tiled,
+	}, nil
+}
+
+/*
+Apply returns a copy of img with the watermark drawn over it. The source
+image is not modified.
+*/
+func (w *Watermark) Apply(img image.Image) image.Image {
+	bounds := img.Bounds()
+	result := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(result, result.Bounds(), img, bounds.Min, draw.Src)
+
+	mark := w.scaledMark(bounds.Dx())
+	markWidth := mark.Bounds().Dx()
+	markHeight := mark.Bounds().Dy()
+
+	if markWidth == 0 || markHeight == 0 {
+		return result
+	}
+
+	mask := image.NewUniform(color.Alpha{A: uint8(math.Round(255 * watermarkOpacity))})
+
+	drawAt := func(x, y int) {
+		r := image.Rect(x, y, x+markWidth, y+markHeight)
+		draw.DrawMask(result, r, mark, mark.Bounds().Min, mask, image.Point{}, draw.Over)
+	}
+
+	if !w.tiled {
+		drawAt((bounds.Dx()-markWidth)/2, (bounds.Dy()-markHeight)/2)
+		return result
+	}
+
+	/*
+	 * Leave a gap the size of the mark between tiles, and offset every
+	 * other row so the tiles form a staggered pattern
+	 */
+	row := 0
+
+	for y := 0; y < bounds.Dy(); y += markHeight * 2 {
+		offset := (row % 2) * markWidth
+
+		for x := -offset; x < bounds.Dx(); x += markWidth * 2 {
+			drawAt(x, y)
+		}
+
+		row++
+	}
+
+	return result
+}
+
+func (w *Watermark) scaledMark(imageWidth int) image.Image {
+	targetWidth := uint(float64(imageWidth) * watermarkScale)
+
+	if w.tiled {
+		targetWidth = uint(float64(imageWidth) * watermarkScale / 2)
+	}
+
+	if targetWidth == 0 {
+		targetWidth = 1
+	}
+
+	return resize.Resize(targetWidth, 0, w.mark, resize.Lanczos3)
+}
+
+func loadWatermarkImage(fsys fs.FS, path string) (image.Image, error) {
+	var (
+		err error
+		f   fs.File
+		img image.Image
+	)
+
+	if fsys == nil {
+		return nil, fmt.Errorf("no file system provided to load watermark image '%s'", path)
+	}
+
+	if f, err = fsys.Open(path); err != nil {
+		return nil, fmt.Errorf("error opening watermark image '%s': %w", path, err)
+	}
+
+	defer f.Close()
+
+	if img, err = png.Decode(f); err != nil {
+		return nil, fmt.Errorf("error decoding watermark image '%s': %w", path, err)
+	}
+
+	return img, nil
+}
+
+/*
+renderWatermarkText draws white text with a dark outline onto a transparent
+image. The outline keeps the text readable on light and dark photos.
+*/
+func renderWatermarkText(text string) image.Image {
+	face := basicfont.Face7x13
+	padding := 2
+
+	width := font.MeasureString(face, text).Ceil() + padding*2
+	height := face.Metrics().Height.Ceil() + padding*2
+
+	result := image.NewRGBA(image.Rect(0, 0, width, height))
+	baseline := padding + face.Metrics().Ascent.Ceil()
+
+	drawText := func(src image.Image, dx, dy int) {
+		d := &font.Drawer{
+			Dst:  result,
+			Src:  src,
+			Face: face,
+			Dot:  fixed.P(padding+dx, baseline+dy),
+		}
+
+		d.DrawString(text)
+	}
+
+	shadow := image.NewUniform(color.RGBA{A: 255})
+
+	for _, offset := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+		drawText(shadow, offset[0], offset[1])
+	}
+
+	drawText(image.White, 0, 0)
+	return result
+}
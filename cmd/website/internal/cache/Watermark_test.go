@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+func TestRenderThumbnailWatermark(t *testing.T) {
+	original := encodeJpeg(t, testImage(800, 600))
+
+	watermark, err := NewWatermark(WatermarkConfig{Text: "PROOF"})
+	if err != nil {
+		t.Fatalf("NewWatermark returned an error: %v", err)
+	}
+
+	plain, err := NewCacheCreatorService(CacheCreatorConfig{}).RenderThumbnail(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("RenderThumbnail returned an error: %v", err)
+	}
+
+	marked, err := NewCacheCreatorService(CacheCreatorConfig{Watermark: watermark}).RenderThumbnail(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("RenderThumbnail with a watermark returned an error: %v", err)
+	}
+
+	again, err := NewCacheCreatorService(CacheCreatorConfig{}).RenderThumbnail(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("RenderThumbnail returned an error: %v", err)
+	}
+
+	if bytes.Equal(plain, marked) {
+		t.Errorf("watermarked thumbnail is identical to the plain one")
+	}
+
+	if !bytes.Equal(plain, again) {
+		t.Errorf("without a watermark the thumbnail changed between renders")
+	}
+}
+
+func TestWatermarkLeavesTheOriginalUntouched(t *testing.T) {
+	original := encodeJpeg(t, testImage(800, 600))
+	originalKey := "clients/1/2/originals/a.jpg"
+
+	s3Client := newMemoryS3Client()
+	s3Client.put(originalKey, original, time.Now())
+
+	watermark, err := NewWatermark(WatermarkConfig{Text: "PROOF", Tiled: true})
+	if err != nil {
+		t.Fatalf("NewWatermark returned an error: %v", err)
+	}
+
+	service := NewCacheCreatorService(CacheCreatorConfig{
+		ClientsPhotoFolder: "clients",
+		S3Client:           s3Client,
+		Watermark:          watermark,
+	})
+
+	if err = service.createThumbnail(&models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true}, originalKey); err != nil {
+		t.Fatalf("createThumbnail returned an error: %v", err)
+	}
+
+	if stored, _ := s3Client.get(originalKey); !bytes.Equal(stored, original) {
+		t.Errorf("the original was modified")
+	}
+
+	if _, ok := s3Client.get("clients/1/2/thumbnails/a.jpg"); !ok {
+		t.Errorf("no thumbnail was written")
+	}
+}
+
+func TestUnpurchasedAlbumsGetWatermarkedProofs(t *testing.T) {
+	original := encodeJpeg(t, testImage(800, 600))
+	originalKey := "clients/1/2/originals/a.jpg"
+
+	s3Client := newMemoryS3Client()
+	s3Client.put(originalKey, original, time.Now().Add(-time.Hour))
+
+	watermark, err := NewWatermark(WatermarkConfig{Text: "PROOF"})
+	if err != nil {
+		t.Fatalf("NewWatermark returned an error: %v", err)
+	}
+
+	// Thumbnails aren't watermarked, only proofs are
+	service := NewCacheCreatorService(CacheCreatorConfig{
+		ClientsPhotoFolder: "clients",
+		ProofWatermark:     watermark,
+		S3Client:           s3Client,
+	})
+
+	purchased := &models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true}
+	unpurchased := &models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1}
+
+	if err = service.createThumbnail(unpurchased, originalKey); err != nil {
+		t.Fatalf("createThumbnail for an unpurchased album returned an error: %v", err)
+	}
+
+	if _, ok := s3Client.get("clients/1/2/thumbnails/a.jpg"); ok {
+		t.Errorf("a clean thumbnail was written for an unpurchased album")
+	}
+
+	proof, ok := s3Client.get("clients/1/2/proofs/a.jpg")
+	if !ok {
+		t.Fatalf("no proof was written for an unpurchased album")
+	}
+
+	if !service.doesThumbnailExist(unpurchased, s3.Object{Key: originalKey, LastModified: time.Now().Add(-time.Hour)}) {
+		t.Errorf("the proof isn't found for the unpurchased album")
+	}
+
+	if service.doesThumbnailExist(purchased, s3.Object{Key: originalKey, LastModified: time.Now().Add(-time.Hour)}) {
+		t.Errorf("the proof is taken for the purchased album's thumbnail")
+	}
+
+	if err = service.createThumbnail(purchased, originalKey); err != nil {
+		t.Fatalf("createThumbnail for a purchased album returned an error: %v", err)
+	}
+
+	thumbnail, ok := s3Client.get("clients/1/2/thumbnails/a.jpg")
+	if !ok {
+		t.Fatalf("no thumbnail was written for a purchased album")
+	}
+
+	if bytes.Equal(proof, thumbnail) {
+		t.Errorf("the proof is identical to the clean thumbnail")
+	}
+
+	if _, err = NewCacheCreatorService(CacheCreatorConfig{}).RenderProof(bytes.NewReader(original)); err == nil {
+		t.Errorf("RenderProof without a watermark returned no error")
+	}
+}
+
+func TestWatermarkScalesWithTheImage(t *testing.T) {
+	logo := encodePng(t, testImage(100, 20))
+
+	watermark, err := NewWatermark(WatermarkConfig{FS: fstest.MapFS{"logo.png": {Data: logo}}, ImagePath: "logo.png"})
+	if err != nil {
+		t.Fatalf("NewWatermark returned an error: %v", err)
+	}
+
+	for _, width := range []int{200, 400, 1000} {
+		if got, want := watermark.scaledMark(width).Bounds().Dx(), width/2; got != want {
+			t.Errorf("mark on a %dpx image is %dpx wide, want %d", width, got, want)
+		}
+	}
+}
+
+func TestNewWatermarkRequiresTextOrAnImage(t *testing.T) {
+	if _, err := NewWatermark(WatermarkConfig{}); err == nil {
+		t.Errorf("NewWatermark without text or an image returned no error")
+	}
+
+	if _, err := NewWatermark(WatermarkConfig{FS: fstest.MapFS{}, ImagePath: "missing.png"}); err == nil {
+		t.Errorf("NewWatermark with a missing image returned no error")
+	}
+}
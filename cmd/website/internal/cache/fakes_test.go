@@ -0,0 +1,264 @@
+package cache
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/deleteoptions"
+	"github.com/adampresley/adamgokit/s3/getoptions"
+	"github.com/adampresley/adamgokit/s3/listoptions"
+	"github.com/adampresley/adamgokit/s3/putoptions"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type memoryObject struct {
+	data         []byte
+	lastModified time.Time
+}
+
+/*
+memoryS3Client is an in-memory bucket. Anything not implemented panics
+through the nil embedded interface.
+*/
+type memoryS3Client struct {
+	s3.S3Client
+
+	mu      sync.Mutex
+	objects map[string]memoryObject
+}
+
+func newMemoryS3Client() *memoryS3Client {
+	return &memoryS3Client{
+		objects: map[string]memoryObject{},
+	}
+}
+
+func (m *memoryS3Client) BucketExists(bucket string) (bool, error) {
+	return true, nil
+}
+
+func (m *memoryS3Client) Delete(bucket string, keys []string, options ...deleteoptions.DeleteOption) (s3.DeleteResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		delete(m.objects, key)
+	}
+
+	return s3.DeleteResponse{DeletedKeys: keys}, nil
+}
+
+func (m *memoryS3Client) Get(bucket, key string, options ...getoptions.GetOption) (s3.GetObjectResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	object, ok := m.objects[key]
+
+	if !ok {
+		return s3.GetObjectResponse{}, io.EOF
+	}
+
+	return s3.GetObjectResponse{
+		Body: io.NopCloser(bytes.NewReader(object.data)),
+		Size: int64(len(object.data)),
+	}, nil
+}
+
+func (m *memoryS3Client) List(bucket, path string, options ...listoptions.ListOption) (s3.ListResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o := &listoptions.ListOptions{}
+
+	for _, option := range options {
+		option(o)
+	}
+
+	result := s3.ListResponse{}
+
+	for key, object := range m.objects {
+		if !strings.HasPrefix(key, path) {
+			continue
+		}
+
+		if o.Filter != nil && !o.Filter(types.Object{Key: aws.String(key)}) {
+			continue
+		}
+
+		result.Objects = append(result.Objects, s3.Object{Key: key, LastModified: object.lastModified, Size: int64(len(object.data))})
+	}
+
+	sort.Slice(result.Objects, func(i, j int) bool {
+		return result.Objects[i].Key < result.Objects[j].Key
+	})
+
+	result.NumObjects = len(result.Objects)
+	return result, nil
+}
+
+func (m *memoryS3Client) Put(bucket, key string, body io.Reader, options ...putoptions.PutOption) (s3.PutObjectResponse, error) {
+	data, err := io.ReadAll(body)
+
+	if err != nil {
+		return s3.PutObjectResponse{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[key] = memoryObject{data: data, lastModified: time.Now()}
+	return s3.PutObjectResponse{}, nil
+}
+
+func (m *memoryS3Client) StatObject(bucket, key string) (*s3.ObjectMetadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	object, ok := m.objects[key]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &s3.ObjectMetadata{LastModified: object.lastModified, Size: int64(len(object.data))}, nil
+}
+
+func (m *memoryS3Client) put(key string, data []byte, lastModified time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[key] = memoryObject{data: data, lastModified: lastModified}
+}
+
+func (m *memoryS3Client) get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	object, ok := m.objects[key]
+	return object.data, ok
+}
+
+func (m *memoryS3Client) keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]string, 0, len(m.objects))
+
+	for key := range m.objects {
+		result = append(result, key)
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// testImage returns a gradient so resizing and watermarking have something to change
+func testImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x % 256), G: uint8(y % 256), B: 128, A: 255})
+		}
+	}
+
+	return img
+}
+
+func encodeJpeg(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("error encoding test JPEG: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func encodePng(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("error encoding test PNG: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+/*
+memoryCacheFailures keeps cache failures in memory and counts how many
+times each original was recorded.
+*/
+type memoryCacheFailures struct {
+	mu       sync.Mutex
+	failures map[string]models.CacheFailure
+	recorded map[string]int
+}
+
+func newMemoryCacheFailures() *memoryCacheFailures {
+	return &memoryCacheFailures{
+		failures: map[string]models.CacheFailure{},
+		recorded: map[string]int{},
+	}
+}
+
+func (m *memoryCacheFailures) Clear(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.failures, key)
+	return nil
+}
+
+func (m *memoryCacheFailures) List() ([]models.CacheFailure, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]models.CacheFailure, 0, len(m.failures))
+
+	for _, failure := range m.failures {
+		result = append(result, failure)
+	}
+
+	return result, nil
+}
+
+func (m *memoryCacheFailures) Record(key string, lastModified time.Time, failure error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.failures[key] = models.CacheFailure{Key: key, Error: failure.Error(), LastModified: lastModified.UTC()}
+	m.recorded[key]++
+	return nil
+}
+
+func (m *memoryCacheFailures) timesRecorded(key string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.recorded[key]
+}
+
+func (m *memoryCacheFailures) has(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.failures[key]
+	return ok
+}
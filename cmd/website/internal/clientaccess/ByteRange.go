@@ -0,0 +1,116 @@
+package clientaccess
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrRangeNotSatisfiable = fmt.Errorf("range not satisfiable")
+	ErrRangeNotSupported   = fmt.Errorf("range not supported")
+)
+
+type byteRange struct {
+	Start int64
+	End   int64
+}
+
+func (br byteRange) Length() int64 {
+	return br.End - br.Start + 1
+}
+
+func (br byteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.Start, br.End, size)
+}
+
+func (br byteRange) Header() string {
+	return fmt.Sprintf("bytes=%d-%d", br.Start, br.End)
+}
+
+/*
+parseByteRange parses a single range from a Range header against an object
+of the given size. Supported forms are "bytes=start-end", "bytes=start-",
+and "bytes=-suffixLength". Multiple ranges return ErrRangeNotSupported so
+the caller can fall back to sending the whole file, which RFC 9110 allows.
+*/
+func parseByteRange(header string, size int64) (byteRange, error) {
+	var (
+		err    error
+		result byteRange
+	)
+
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+
+	if !ok {
+		return result, ErrRangeNotSatisfiable
+	}
+
+	if strings.Contains(spec, ",") {
+		return result, ErrRangeNotSupported
+	}
+
+	startValue, endValue, ok := strings.Cut(strings.TrimSpace(spec), "-")
+
+	if !ok {
+		return result, ErrRangeNotSatisfiable
+	}
+
+	/*
+	 * Suffix range, like bytes=-500 for the last 500 bytes
+	 */
+	if startValue == "" {
+		var suffix int64
+
+		if suffix, err = strconv.ParseInt(endValue, 10, 64); err != nil || suffix <= 0 || size == 0 {
+			return result, ErrRangeNotSatisfiable
+		}
+
+		result.Start = max(size-suffix, 0)
+		result.End = size - 1
+		return result, nil
+	}
+
+	if result.Start, err = strconv.ParseInt(startValue, 10, 64); err != nil || result.Start < 0 || result.Start >= size {
+		return result, ErrRangeNotSatisfiable
+	}
+
+	result.End = size - 1
+
+	if endValue != "" {
+		var end int64
+
+		if end, err = strconv.ParseInt(endValue, 10, 64); err != nil || end < result.Start {
+			return result, ErrRangeNotSatisfiable
+		}
+
+		result.End = min(end, size-1)
+	}
+
+	return result, nil
+}
+
+/*
+newRangeClient returns the HTTP client used to fetch ranges from S3. It
+times out connecting and waiting for S3 to respond, but not reading the
+body, since a large range can take a long time to stream to a slow client.
+The request context ends the transfer if the client goes away.
+*/
+func newRangeClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   time.Second * 10,
+				KeepAlive: time.Second * 30,
+			}).DialContext,
+			IdleConnTimeout:       time.Second * 90,
+			MaxIdleConnsPerHost:   10,
+			ResponseHeaderTimeout: time.Second * 30,
+			TLSHandshakeTimeout:   time.Second * 10,
+		},
+	}
+}
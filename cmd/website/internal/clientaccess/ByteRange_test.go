@@ -0,0 +1,116 @@
+package clientaccess
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+)
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		size    int64
+		want    byteRange
+		wantErr error
+	}{
+		{name: "start and end", header: "bytes=0-99", size: 1000, want: byteRange{Start: 0, End: 99}},
+		{name: "open ended", header: "bytes=500-", size: 1000, want: byteRange{Start: 500, End: 999}},
+		{name: "suffix", header: "bytes=-100", size: 1000, want: byteRange{Start: 900, End: 999}},
+		{name: "suffix longer than the file", header: "bytes=-5000", size: 1000, want: byteRange{Start: 0, End: 999}},
+		{name: "end past the file is clamped", header: "bytes=900-5000", size: 1000, want: byteRange{Start: 900, End: 999}},
+		{name: "start past the file", header: "bytes=1000-", size: 1000, wantErr: ErrRangeNotSatisfiable},
+		{name: "end before start", header: "bytes=500-100", size: 1000, wantErr: ErrRangeNotSatisfiable},
+		{name: "wrong unit", header: "items=0-1", size: 1000, wantErr: ErrRangeNotSatisfiable},
+		{name: "garbage", header: "bytes=abc", size: 1000, wantErr: ErrRangeNotSatisfiable},
+		{name: "multiple ranges", header: "bytes=0-1,5-6", size: 1000, wantErr: ErrRangeNotSupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseByteRange(tt.header, tt.size)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && got != tt.want {
+				t.Errorf("range = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadZipRanges(t *testing.T) {
+	const zipKey = "clients/1/2/downloads/album-2.zip"
+
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	s3Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, "/") != zipKey {
+			http.NotFound(w, r)
+			return
+		}
+
+		http.ServeContent(w, r, "album-2.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	defer s3Server.Close()
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		Bucket:              "bucket",
+		ClientPhotoFolder:   "clients",
+		DownloadTokenSecret: "secret",
+		S3Client:            fakeS3Client{objects: map[string][]byte{zipKey: data}, url: s3Server.URL},
+		ZipService:          fakeZipService{},
+	})
+
+	zipToken := services.SignDownloadToken("secret", services.DownloadToken{AlbumID: 2, ClientID: 1, ExpiresAt: time.Now().Add(time.Hour), Filename: "album-2.zip"})
+
+	tests := []struct {
+		name             string
+		rangeHeader      string
+		wantStatus       int
+		wantBody         []byte
+		wantContentRange string
+	}{
+		{name: "whole file", wantStatus: http.StatusOK, wantBody: data},
+		{name: "first bytes", rangeHeader: "bytes=0-9", wantStatus: http.StatusPartialContent, wantBody: data[:10], wantContentRange: "bytes 0-9/1000"},
+		{name: "resume", rangeHeader: "bytes=990-", wantStatus: http.StatusPartialContent, wantBody: data[990:], wantContentRange: "bytes 990-999/1000"},
+		{name: "past the end", rangeHeader: "bytes=2000-", wantStatus: http.StatusRequestedRangeNotSatisfiable, wantContentRange: "bytes */1000"},
+		{name: "multiple ranges get the whole file", rangeHeader: "bytes=0-1,5-6", wantStatus: http.StatusOK, wantBody: data},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/client/zips/"+zipToken, nil)
+			r.SetPathValue("token", zipToken)
+			r = withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}})
+
+			if tt.rangeHeader != "" {
+				r.Header.Set("Range", tt.rangeHeader)
+			}
+
+			w := httptest.NewRecorder()
+			controller.DownloadZipByToken(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if got := w.Header().Get("Content-Range"); got != tt.wantContentRange {
+				t.Errorf("Content-Range = %q, want %q", got, tt.wantContentRange)
+			}
+
+			if tt.wantBody != nil && !bytes.Equal(w.Body.Bytes(), tt.wantBody) {
+				t.Errorf("body is %d bytes, want %d", w.Body.Len(), len(tt.wantBody))
+			}
+		})
+	}
+}
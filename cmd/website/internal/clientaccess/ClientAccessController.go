@@ -1,12 +1,20 @@
 package clientaccess
 
 import (
+	"bytes"
+	"context"
+	stdsql "database/sql"
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -15,48 +23,117 @@ import (
 	"github.com/adampresley/adamgokit/rendering"
 	"github.com/adampresley/adamgokit/s3"
 	"github.com/adampresley/adamgokit/s3/getoptions"
+	"github.com/adampresley/adamgokit/s3/geturloptions"
 	"github.com/adampresley/adamgokit/s3/listoptions"
 	"github.com/adampresley/adamgokit/sessions"
-	"github.com/adampresley/adamgokit/slices"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/cache"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/i18n"
 	internalmodels "github.com/adampresley/adampresleyphotography/cmd/website/internal/models"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/requestlog"
 	"github.com/adampresley/adampresleyphotography/cmd/website/internal/viewmodels"
+	"github.com/adampresley/adampresleyphotography/pkg/metrics"
 	"github.com/adampresley/adampresleyphotography/pkg/models"
 	"github.com/adampresley/adampresleyphotography/pkg/services"
 	"github.com/rfberaldo/sqlz"
 )
 
+const (
+	// maxDownloadPreviews is how many thumbnails the download-started page shows
+	maxDownloadPreviews = 4
+
+	// filenameLinkTokenExpiration is how long the token a filename download link is swapped for lasts
+	filenameLinkTokenExpiration = time.Minute * 5
+
+	dispositionAttachment = "attachment"
+	dispositionInline     = "inline"
+)
+
 type ClientAccessControllerConfig struct {
-	AlbumService      services.AlbumServicer
-	Bucket            string
-	ClientPhotoFolder string
-	ClientService     services.ClientServicer
-	Renderer          rendering.TemplateRenderer
-	S3Client          s3.S3Client
-	SessionService    sessions.Session[*models.Client]
-	ZipService        services.ZipServicer
+	AlbumService           services.AlbumServicer
+	Branding               viewmodels.Branding
+	Bucket                 string
+	CacheCreator           cache.CacheCreator
+	CdnBaseURL             string
+	ClientPhotoFolder      string
+	ClientService          services.ClientServicer
+	DownloadTokenSecret    string
+	ImageEventService      services.ImageEventServicer
+	ImageUrlExpiration     time.Duration
+	PresignedUrlExpiration time.Duration
+	Renderer               rendering.TemplateRenderer
+	S3Client               s3.S3Client
+	S3OperationTimeout     time.Duration
+	SessionRememberTTL     time.Duration
+	SessionService         sessions.Session[*models.Client]
+	ThumbnailFormat        cache.ThumbnailFormat
+	TrustedProxies         []netip.Prefix
+	UsePresignedDownloads  bool
+	ZipService             services.ZipServicer
 }
 
 type ClientAccessController struct {
-	albumService      services.AlbumServicer
-	bucket            string
-	clientPhotoFolder string
-	clientService     services.ClientServicer
-	renderer          rendering.TemplateRenderer
-	s3Client          s3.S3Client
-	sessionService    sessions.Session[*models.Client]
-	zipService        services.ZipServicer
+	albumService           services.AlbumServicer
+	branding               viewmodels.Branding
+	bucket                 string
+	cacheCreator           cache.CacheCreator
+	cdnBaseURL             string
+	clientPhotoFolder      string
+	clientService          services.ClientServicer
+	downloadTokenSecret    string
+	imageEventService      services.ImageEventServicer
+	imageUrlExpiration     time.Duration
+	presignedUrlExpiration time.Duration
+	rangeClient            *http.Client
+	renderer               rendering.TemplateRenderer
+	s3Client               s3.S3Client
+	s3OperationTimeout     time.Duration
+	sessionRememberTTL     time.Duration
+	sessionService         sessions.Session[*models.Client]
+	thumbnailFormat        cache.ThumbnailFormat
+	trustedProxies         []netip.Prefix
+	usePresignedDownloads  bool
+	zipService             services.ZipServicer
 }
 
 func NewClientAccessController(config ClientAccessControllerConfig) ClientAccessController {
+	if config.ImageUrlExpiration <= 0 {
+		config.ImageUrlExpiration = services.DefaultImageUrlExpiration
+	}
+
+	if config.PresignedUrlExpiration <= 0 {
+		config.PresignedUrlExpiration = time.Minute * 15
+	}
+
+	if config.S3OperationTimeout <= 0 {
+		config.S3OperationTimeout = services.DefaultS3OperationTimeout
+	}
+
+	if config.ThumbnailFormat.Name == "" {
+		config.ThumbnailFormat = cache.JpegThumbnails
+	}
+
 	return ClientAccessController{
-		albumService:      config.AlbumService,
-		bucket:            config.Bucket,
-		clientPhotoFolder: config.ClientPhotoFolder,
-		clientService:     config.ClientService,
-		renderer:          config.Renderer,
-		s3Client:          config.S3Client,
-		sessionService:    config.SessionService,
-		zipService:        config.ZipService,
+		albumService:           config.AlbumService,
+		branding:               config.Branding,
+		bucket:                 config.Bucket,
+		cacheCreator:           config.CacheCreator,
+		cdnBaseURL:             config.CdnBaseURL,
+		clientPhotoFolder:      config.ClientPhotoFolder,
+		clientService:          config.ClientService,
+		downloadTokenSecret:    config.DownloadTokenSecret,
+		imageEventService:      config.ImageEventService,
+		imageUrlExpiration:     config.ImageUrlExpiration,
+		presignedUrlExpiration: config.PresignedUrlExpiration,
+		rangeClient:            newRangeClient(),
+		renderer:               config.Renderer,
+		s3Client:               config.S3Client,
+		s3OperationTimeout:     config.S3OperationTimeout,
+		sessionRememberTTL:     config.SessionRememberTTL,
+		sessionService:         config.SessionService,
+		thumbnailFormat:        config.ThumbnailFormat,
+		trustedProxies:         config.TrustedProxies,
+		usePresignedDownloads:  config.UsePresignedDownloads,
+		zipService:             config.ZipService,
 	}
 }
 
@@ -65,42 +142,85 @@ GET /client
 */
 func (c ClientAccessController) AlbumListPage(w http.ResponseWriter, r *http.Request) {
 	var (
-		err    error
-		albums []*models.Album
+		err       error
+		galleries []models.Gallery
 	)
 
 	viewData := viewmodels.ClientAlbumList{
 		BaseViewModel: viewmodels.BaseViewModel{
-			IsHtmx: httphelpers.IsHtmx(r),
+			Branding: c.branding,
+			Locale:   c.locale(r),
+			IsHtmx:   httphelpers.IsHtmx(r),
 			JavascriptIncludes: []rendering.JavascriptInclude{
 				{Type: "module", Src: "/static/js/pages/album-list.js"},
 			},
 		},
-		Albums: []internalmodels.Album{},
-		Client: &models.Client{},
+		Albums:    []internalmodels.Album{},
+		Galleries: []viewmodels.ClientGallery{},
+		Client:    &models.Client{},
 	}
 
 	viewData.Client = viewmodels.GetClientFromContext(r)
 
-	if albums, err = c.albumService.GetAlbumList(viewData.Client.ID); err != nil && !sqlz.IsNotFound(err) {
-		slog.Error("error getting album list", "error", err, "clientID", viewData.Client.ID)
+	viewData.Filter = viewmodels.ClientAlbumListFilter{
+		Query: strings.TrimSpace(httphelpers.GetFromRequest[string](r, "q")),
+		From:  httphelpers.GetFromRequest[string](r, "from"),
+		To:    httphelpers.GetFromRequest[string](r, "to"),
+	}
+
+	filter := services.AlbumFilter{
+		Name: viewData.Filter.Query,
+	}
+
+	if filter.From, err = parseFilterDate(viewData.Filter.From); err != nil {
+		viewData.IsWarning = true
+		viewData.Message = viewData.T(i18n.AlbumsInvalidFromDate)
+		viewData.Filter.From = ""
+	}
+
+	if filter.To, err = parseFilterDate(viewData.Filter.To); err != nil {
+		viewData.IsWarning = true
+		viewData.Message = viewData.T(i18n.AlbumsInvalidToDate)
+		viewData.Filter.To = ""
+	}
+
+	if galleries, err = c.albumService.SearchGalleries(viewData.Client.ID, filter); err != nil && !sqlz.IsNotFound(err) {
+		requestlog.Logger(r).Error("error getting album list", "error", err, "clientID", viewData.Client.ID)
 		viewData.IsError = true
-		viewData.Message = "An unexpected error occurred. Please reach out for assistance."
+		viewData.Message = viewData.T(i18n.ErrorUnexpected)
 
 		c.renderer.Render("pages/clientaccess/album-list", viewData, w)
 		return
 	}
 
-	for _, album := range albums {
-		converted := c.convertAlbumToViewModel(album, false)
-		viewData.Albums = append(viewData.Albums, converted)
+	/*
+	 * Galleries with nothing to show, either empty or with no albums
+	 * matching the search, are left off the page
+	 */
+	for _, gallery := range galleries {
+		if len(gallery.Albums) == 0 {
+			continue
+		}
+
+		section := viewmodels.ClientGallery{
+			Name:   gallery.Name,
+			Albums: make([]internalmodels.Album, 0, len(gallery.Albums)),
+		}
+
+		for _, album := range gallery.Albums {
+			converted, _ := c.convertAlbumToViewModel(r.Context(), album, false)
+			section.Albums = append(section.Albums, converted)
+			viewData.Albums = append(viewData.Albums, converted)
+		}
+
+		viewData.Galleries = append(viewData.Galleries, section)
 	}
 
 	c.renderer.Render("pages/clientaccess/album-list", viewData, w)
 }
 
 /*
-GET /client/library/{albumid}/download-all
+POST /client/library/{albumid}/download-all
 */
 func (c ClientAccessController) DownloadAllImagesInAlbum(w http.ResponseWriter, r *http.Request) {
 	var (
@@ -112,269 +232,1685 @@ func (c ClientAccessController) DownloadAllImagesInAlbum(w http.ResponseWriter,
 	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
 
 	if album, err = c.albumService.GetAlbum(client.ID, albumID); err != nil {
-		httphelpers.WriteText(w, http.StatusNotFound, "album not found")
+		if isAlbumNotFound(r, err) {
+			httphelpers.WriteText(w, http.StatusNotFound, "album not found")
+			return
+		}
+
+		requestlog.Logger(r).Error("error getting album to download", "error", err, "albumID", albumID)
+		httphelpers.TextInternalServerError(w, "Failed to start download preparation")
 		return
 	}
 
-	// Start the async zip creation process
-	_, err = c.zipService.CreateZipAsync(album, client)
-	if err != nil {
-		slog.Error("failed to start zip creation", "error", err, "albumID", albumID)
-		httphelpers.TextInternalServerError(w, "Failed to start download preparation")
+	if album.IsExpired() {
+		c.renderAlbumExpired(w, r, album)
 		return
 	}
 
-	// Render a success message to the user
-	viewData := viewmodels.ClientDownloadStarted{
-		BaseViewModel: viewmodels.BaseViewModel{
-			IsHtmx: httphelpers.IsHtmx(r),
-		},
-		Album:  album,
-		Client: client,
+	if !album.CanDownload() {
+		writeDownloadsDisabled(w, r, client, albumID)
+		return
 	}
 
-	c.renderer.Render("pages/clientaccess/download-started", viewData, w)
+	/*
+	 * The session holds the client as they were when they logged in, so the
+	 * email preference is read fresh in case they have changed it since.
+	 * When it can't be read they get the email, as they always used to.
+	 */
+	recipient := *client
+
+	if recipient.NotifyOnDownload, err = c.clientService.GetNotificationPreference(client.ID); err != nil {
+		requestlog.Logger(r).Warn("error getting notification preference. sending the email", "error", err, "clientID", client.ID)
+		recipient.NotifyOnDownload = true
+	}
+
+	c.startDownload(w, r, album, &recipient)
 }
 
-func (c ClientAccessController) DownloadImage(w http.ResponseWriter, r *http.Request) {
+/*
+POST /client/library/{albumid}/resend-email
+
+Emails the link to the album's zip again, for clients who lost the first
+email. When there is no zip left that hasn't expired, a new one is started
+instead and they are emailed when it's ready. It is a POST, so it goes
+through the CSRF check, since it sends email and can start a zip.
+*/
+func (c ClientAccessController) ResendDownloadEmail(w http.ResponseWriter, r *http.Request) {
 	var (
 		err    error
-		object s3.GetObjectResponse
+		album  *models.Album
+		resent bool
 	)
 
-	key := httphelpers.GetFromRequest[string](r, "key")
+	client := viewmodels.GetClientFromContext(r)
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
 
-	object, err = c.s3Client.Get(
-		c.bucket,
-		key,
-		getoptions.WithContext(r.Context()),
-		getoptions.WithTimeout(time.Minute*30),
-	)
+	if album, err = c.albumService.GetAlbum(client.ID, albumID); err != nil {
+		if isAlbumNotFound(r, err) {
+			httphelpers.WriteText(w, http.StatusNotFound, "album not found")
+			return
+		}
 
-	if err != nil {
-		slog.Error("error getting image object from S3", "error", err, "bucket", c.bucket, "key", key)
-		httphelpers.WriteText(w, http.StatusInternalServerError, "Failed to download image")
+		requestlog.Logger(r).Error("error getting album to resend its download email", "error", err, "albumID", albumID)
+		httphelpers.TextInternalServerError(w, "Failed to resend the download email")
 		return
 	}
 
-	defer object.Body.Close()
-	fileName := filepath.Base(key)
+	if album.IsExpired() {
+		c.renderAlbumExpired(w, r, album)
+		return
+	}
 
-	w.Header().Set("Content-Type", object.ContentType)
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", object.Size))
+	if !album.CanDownload() {
+		writeDownloadsDisabled(w, r, client, albumID)
+		return
+	}
 
-	_, _ = io.Copy(w, object.Body)
-}
+	// They asked for the email, so it's sent whatever their preference
+	recipient := *client
+	recipient.NotifyOnDownload = true
 
-/*
-GET /client/login
-*/
-func (c ClientAccessController) LoginPage(w http.ResponseWriter, r *http.Request) {
-	viewData := viewmodels.ClientLogin{
+	if resent, err = c.zipService.ResendDownloadEmail(album, &recipient); err != nil {
+		requestlog.Logger(r).Error("failed to resend download email", "error", err, "albumID", albumID)
+		httphelpers.TextInternalServerError(w, "Failed to resend the download email")
+		return
+	}
+
+	if !resent {
+		requestlog.Logger(r).Info("no current zip to resend. starting a new one", "albumID", albumID)
+		c.startDownload(w, r, album, &recipient)
+		return
+	}
+
+	viewData := viewmodels.ClientDownloadStarted{
 		BaseViewModel: viewmodels.BaseViewModel{
-			IsHtmx: httphelpers.IsHtmx(r),
+			Branding: c.branding,
+			Locale:   c.locale(r),
+			IsHtmx:   httphelpers.IsHtmx(r),
 		},
-		ClientCode: "",
+		Album:                album,
+		Client:               &recipient,
+		PreviewThumbnailURLs: c.downloadPreviews(r, album),
+		Resent:               true,
 	}
 
-	c.renderer.Render("pages/clientaccess/login", viewData, w)
+	c.renderer.Render("pages/clientaccess/download-started", viewData, w)
 }
 
 /*
-POST /client/login
+startDownload starts building the album's zip for recipient and tells them
+it's on its way.
 */
-func (c ClientAccessController) LoginAction(w http.ResponseWriter, r *http.Request) {
-	var (
-		err    error
-		client *models.Client
-	)
-
-	pageName := "pages/clientaccess/login"
+func (c ClientAccessController) startDownload(w http.ResponseWriter, r *http.Request, album *models.Album, recipient *models.Client) {
+	jobID, err := c.zipService.CreateZipAsync(album, recipient)
+	if err != nil {
+		requestlog.Logger(r).Error("failed to start zip creation", "error", err, "albumID", album.ID)
+		httphelpers.TextInternalServerError(w, "Failed to start download preparation")
+		return
+	}
 
-	viewData := viewmodels.ClientLogin{
+	// Render a success message to the user
+	viewData := viewmodels.ClientDownloadStarted{
 		BaseViewModel: viewmodels.BaseViewModel{
-			IsHtmx: httphelpers.IsHtmx(r),
+			Branding: c.branding,
+			Locale:   c.locale(r),
+			IsHtmx:   httphelpers.IsHtmx(r),
 		},
-		ClientCode: httphelpers.GetFromRequest[string](r, "password"),
+		Album:                album,
+		Client:               recipient,
+		PreviewThumbnailURLs: c.downloadPreviews(r, album),
 	}
 
-	client, err = c.clientService.GetByPassword(viewData.ClientCode)
+	// When every slot is taken the zip waits its turn, and the client is told where they are in line
+	if job, ok := c.zipService.GetJob(jobID); ok && job.State == services.ZipJobQueued {
+		viewData.QueuePosition = job.QueuePosition
+	}
 
-	if err != nil && !sqlz.IsNotFound(err) {
-		slog.Error("error querying for client information", "error", err)
-		viewData.IsError = true
-		viewData.Message = "An unexpected error occurred. Please reach out for assistance."
+	/*
+	 * The estimate is only informational. The download is already on its
+	 * way, so a failed listing just leaves it off the page.
+	 */
+	fileCount, totalBytes, err := c.zipService.EstimateBundle(album)
 
-		c.renderer.Render(pageName, viewData, w)
-		return
+	if err != nil {
+		requestlog.Logger(r).Warn("error estimating download size", "error", err, "albumID", album.ID)
+	} else {
+		viewData.FileCount = fileCount
+		viewData.EstimatedSize = formatFileSize(totalBytes)
 	}
 
-	if sqlz.IsNotFound(err) {
-		viewData.IsWarning = true
-		viewData.Message = "Your password was not correct. Please try again."
+	c.renderer.Render("pages/clientaccess/download-started", viewData, w)
+}
 
-		c.renderer.Render(pageName, viewData, w)
-		return
+/*
+downloadPreviews returns thumbnail URLs for up to maxDownloadPreviews of the
+album's images, so the download-started page shows what is on its way. The
+poster comes first, then the client's favorites, then the rest in the order
+S3 lists them. Only images whose thumbnail exists are shown. Like the
+estimate, the previews are only there to reassure, so a failed listing
+leaves them off the page.
+*/
+func (c ClientAccessController) downloadPreviews(r *http.Request, album *models.Album) []string {
+	ctx, cancel := context.WithTimeout(r.Context(), c.s3OperationTimeout)
+	defer cancel()
+
+	thumbnails, err := services.ListObjects(
+		ctx,
+		c.s3Client,
+		c.bucket,
+		fmt.Sprintf("%s/%d/%d/%s/", c.clientPhotoFolder, album.ClientID, album.ID, cache.PreviewFolder(album)),
+	)
+
+	if err != nil {
+		requestlog.Logger(r).Warn("error listing thumbnails for the download preview", "error", err, "albumID", album.ID)
+		return []string{}
 	}
 
-	/*
-	 * Setup the session and redirect to the happy place
-	 */
-	if err = c.sessionService.Set(r, client); err != nil {
-		slog.Error("error setting client session", "error", err)
+	keysByImage := make(map[string]string, len(thumbnails.Objects))
+	listed := make([]string, 0, len(thumbnails.Objects))
+
+	for _, thumbnail := range thumbnails.Objects {
+		image := strings.TrimSuffix(filepath.Base(thumbnail.Key), c.thumbnailFormat.Suffix)
+		keysByImage[image] = thumbnail.Key
+		listed = append(listed, image)
 	}
 
-	if err = c.sessionService.Save(w, r); err != nil {
-		slog.Error("error saving session", "error", err)
+	candidates := []string{album.PosterImagePath}
+
+	for _, favorite := range album.Favorites {
+		candidates = append(candidates, favorite.ImagePath)
 	}
 
-	http.Redirect(w, r, "/client", http.StatusFound)
-}
+	candidates = append(candidates, listed...)
 
-/*
-GET /client/logout
-*/
-func (c ClientAccessController) LogoutAction(w http.ResponseWriter, r *http.Request) {
-	_ = c.sessionService.Destroy(w, r)
-	_ = c.sessionService.Save(w, r)
-	http.Redirect(w, r, "/client/login", http.StatusFound)
+	result := []string{}
+	seen := map[string]bool{}
+
+	for _, image := range candidates {
+		key, ok := keysByImage[image]
+
+		if !ok || seen[image] {
+			continue
+		}
+
+		seen[image] = true
+		u, err := c.imageURL(key)
+
+		if err != nil {
+			requestlog.Logger(r).Warn("error getting URL for a download preview", "error", err, "albumID", album.ID, "key", key)
+			continue
+		}
+
+		if result = append(result, u); len(result) == maxDownloadPreviews {
+			break
+		}
+	}
+
+	return result
 }
 
 /*
-GET /client/{id}
+GET /client/library/{albumid}/download-estimate
+
+Reports how many photos a download of the whole album holds and roughly how
+large it is, so clients know what they're in for before starting one.
 */
-func (c ClientAccessController) ViewAlbumPage(w http.ResponseWriter, r *http.Request) {
+func (c ClientAccessController) DownloadEstimate(w http.ResponseWriter, r *http.Request) {
 	var (
-		err   error
-		album *models.Album
+		err        error
+		album      *models.Album
+		fileCount  int
+		totalBytes int64
 	)
 
-	viewData := viewmodels.ClientViewAlbum{
-		BaseViewModel: viewmodels.BaseViewModel{
-			IsHtmx: httphelpers.IsHtmx(r),
-			JavascriptIncludes: []rendering.JavascriptInclude{
-				{Type: "module", Src: "/static/js/pages/view-album.js"},
-			},
-		},
-		Client:  &models.Client{},
-		AlbumID: httphelpers.GetFromRequest[uint](r, "id"),
-		Album:   internalmodels.Album{},
+	client := viewmodels.GetClientFromContext(r)
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+
+	if album, err = c.albumService.GetAlbum(client.ID, albumID); err != nil {
+		c.writeAlbumError(w, r, err, albumID)
+		return
 	}
 
-	viewData.Client = viewmodels.GetClientFromContext(r)
+	if album.IsExpired() {
+		httphelpers.JsonErrorMessage(w, http.StatusGone, "Album access has expired")
+		return
+	}
 
-	if album, err = c.albumService.GetAlbum(viewData.Client.ID, viewData.AlbumID); err != nil {
-		slog.Error("an error occurred querying album in ViewAlbumPage", "error", err, "albumID", viewData.AlbumID)
-		viewData.IsError = true
-		viewData.Message = "An unexpected error occurred. Please reach out for assistance."
+	if !album.CanDownload() {
+		httphelpers.JsonErrorMessage(w, http.StatusForbidden, "Downloads are not available for this album")
+		return
+	}
 
-		c.renderer.Render("pages/clientaccess/view-album", viewData, w)
+	if fileCount, totalBytes, err = c.zipService.EstimateBundle(album); err != nil {
+		requestlog.Logger(r).Error("error estimating download size", "error", err, "albumID", albumID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "Error estimating download size")
 		return
 	}
 
-	viewData.Album = c.convertAlbumToViewModel(album, true)
-	c.renderer.Render("pages/clientaccess/view-album", viewData, w)
+	httphelpers.JsonOK(w, map[string]any{
+		"fileCount":  fileCount,
+		"totalBytes": totalBytes,
+		"size":       formatFileSize(totalBytes),
+	})
 }
 
-func (c ClientAccessController) DownloadZip(w http.ResponseWriter, r *http.Request) {
-	var (
-		err    error
-		object s3.GetObjectResponse
-	)
+/*
+GET /client/downloads/status
 
+Reports every zip the client has asked for that is still being prepared or
+finished recently, with how far along each one is, so the page can show
+one panel for all of them. Only the logged in client's zips are included.
+*/
+func (c ClientAccessController) DownloadStatus(w http.ResponseWriter, r *http.Request) {
 	client := viewmodels.GetClientFromContext(r)
-	filename := httphelpers.GetFromRequest[string](r, "filename")
+	jobs := c.zipService.GetClientJobs(client.ID)
 
-	// Sanitize the filename to prevent directory traversal
-	filename = filepath.Base(filename)
+	result := internalmodels.DownloadStatus{
+		Jobs: make([]internalmodels.DownloadJob, 0, len(jobs)),
+	}
 
-	/*
-	 * This is brittle. It assumes the album ID is the last part of the filename
-	 * separated by a hyphen. E.g. "My-Album-123.zip"
-	 */
-	parts := strings.Split(strings.TrimSuffix(filename, ".zip"), "-")
-	albumID, err := strconv.Atoi(parts[len(parts)-1])
-	if err != nil {
-		slog.Error("error parsing album ID from filename", "error", err, "filename", filename)
-		httphelpers.WriteText(w, http.StatusBadRequest, "Invalid download link")
-		return
+	for _, job := range jobs {
+		// The registry is shared by every client, so this is checked again rather than trusted
+		if job.ClientID != client.ID {
+			continue
+		}
+
+		if job.State == services.ZipJobCompleted {
+			result.Completed++
+		}
+
+		result.Jobs = append(result.Jobs, internalmodels.DownloadJob{
+			ID:            job.ID,
+			AlbumID:       job.AlbumID,
+			AlbumName:     job.AlbumName,
+			State:         string(job.State),
+			QueuePosition: job.QueuePosition,
+			FilesDone:     job.FilesDone,
+			FilesTotal:    job.FilesTotal,
+			DownloadURLs:  job.DownloadURLs,
+			StartedAt:     job.StartedAt.UTC().Format(time.RFC3339),
+			UpdatedAt:     job.UpdatedAt.UTC().Format(time.RFC3339),
+		})
 	}
 
-	zipKey := filepath.Join(
-		c.clientPhotoFolder,
-		fmt.Sprint(client.ID),
-		fmt.Sprint(albumID),
-		"downloads",
-		filename,
-	)
+	result.Total = len(result.Jobs)
+	httphelpers.JsonOK(w, result)
+}
 
-	slog.Info("serving zip download from S3", "filename", filename, "key", zipKey, "clientID", client.ID)
+/*
+GET /client/view-image
 
-	object, err = c.s3Client.Get(
-		c.bucket,
-		zipKey,
-		getoptions.WithContext(r.Context()),
+Opens an original in the lightbox. The view is recorded here, when the
+image is actually opened, rather than for every image on the album page.
+Originals in albums that haven't been purchased open as their watermarked
+proof.
+*/
+func (c ClientAccessController) ViewImage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		purchased bool
 	)
 
-	if err != nil {
-		slog.Error("error getting zip object from S3", "error", err, "bucket", c.bucket, "key", zipKey)
-		httphelpers.WriteText(w, http.StatusNotFound, "Download file not found")
+	client := viewmodels.GetClientFromContext(r)
+	key := httphelpers.GetFromRequest[string](r, "key")
+
+	if !c.keyBelongsToClient(client, key) {
+		requestlog.Logger(r).Warn("client attempted to view a key outside their folder", "clientID", client.ID, "key", key)
+		httphelpers.WriteText(w, http.StatusForbidden, "You do not have access to this image")
 		return
 	}
 
-	defer object.Body.Close()
+	if purchased, err = c.isPurchased(key); err != nil {
+		c.writePurchaseError(w, r, err, key)
+		return
+	}
 
-	// Set appropriate headers for file download
-	w.Header().Set("Content-Type", "application/zip")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", object.Size))
+	c.recordImageEvent(client, key, models.ImageEventView)
 
-	// Stream the file to the response
-	if _, err = io.Copy(w, object.Body); err != nil {
-		slog.Error("error streaming zip file", "error", err, "key", zipKey)
+	// Until the album is purchased the original is only seen watermarked
+	if !purchased {
+		http.Redirect(w, r, "/client/thumb?key="+url.QueryEscape(key), http.StatusFound)
 		return
 	}
 
-	slog.Info("zip file download completed", "filename", filename, "clientID", client.ID)
+	c.redirectToPresignedUrl(w, r, key)
 }
 
 /*
-PUT /client/library/{albumid}/toggle-favorite/{imagepath}
+GET /client/download-image?key=<original key>&disposition=<inline|attachment>
+
+Serves one of the client's originals. It is sent as an attachment unless
+disposition is inline, for the front end to show it full screen instead of
+downloading it. Inline originals are recorded as views rather than
+downloads. Presigned downloads redirect to S3 either way, which serves the
+object without a disposition.
 */
-func (c ClientAccessController) ToggleFavorite(w http.ResponseWriter, r *http.Request) {
+func (c ClientAccessController) DownloadImage(w http.ResponseWriter, r *http.Request) {
 	var (
-		err    error
-		exists bool
+		err           error
+		object        s3.GetObjectResponse
+		allowDownload bool
 	)
 
+	start := time.Now()
 	client := viewmodels.GetClientFromContext(r)
-	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
-	key := filepath.Base(httphelpers.GetFromRequest[string](r, "key"))
+	key := httphelpers.GetFromRequest[string](r, "key")
+	disposition, ok := parseDisposition(r.URL.Query().Get("disposition"))
 
-	if exists, err = c.albumService.ToggleFavorite(client.ID, albumID, key); err != nil {
-		slog.Error("error toggling favorite", "error", err, "albumID", albumID, "imagePath", key)
-		httphelpers.TextInternalServerError(w, "Error toggling favorite")
+	if !ok {
+		httphelpers.WriteText(w, http.StatusBadRequest, "disposition must be inline or attachment")
 		return
 	}
 
-	icon := "icon"
+	if !c.keyBelongsToClient(client, key) {
+		requestlog.Logger(r).Warn("client attempted to download a key outside their folder", "clientID", client.ID, "key", key)
+		httphelpers.WriteText(w, http.StatusForbidden, "You do not have access to this image")
+		return
+	}
 
-	/*
-	 * Update the view model to reflect the favorite status.
-	 * Exist returns true if the image is already a favorite, false otherwise.
-	 */
-	if !exists {
-		icon += " icon-heart"
-	} else {
-		icon += " icon-empty-heart"
+	albumID, ok := albumIDFromKey(key)
+
+	if !ok {
+		requestlog.Logger(r).Warn("client attempted to download a key outside an album", "clientID", client.ID, "key", key)
+		httphelpers.WriteText(w, http.StatusForbidden, "You do not have access to this image")
+		return
 	}
 
-	markup := fmt.Sprintf("<i class='%s'></i>", icon)
-	httphelpers.WriteHtml(w, http.StatusOK, markup)
-}
+	if allowDownload, err = c.albumService.GetDownloadPermission(albumID); err != nil {
+		if errors.Is(err, services.ErrAlbumNotFound) {
+			httphelpers.WriteText(w, http.StatusNotFound, "Image not found")
+			return
+		}
 
-func (c ClientAccessController) convertAlbumToViewModel(album *models.Album, getImages bool) internalmodels.Album {
+		requestlog.Logger(r).Error("error checking album download permission", "error", err, "albumID", albumID)
+		httphelpers.WriteText(w, http.StatusInternalServerError, "Failed to download image")
+		return
+	}
+
+	if !allowDownload {
+		writeDownloadsDisabled(w, r, client, albumID)
+		return
+	}
+
+	eventType := models.ImageEventDownload
+
+	if disposition == dispositionInline {
+		eventType = models.ImageEventView
+	}
+
+	c.recordImageEvent(client, key, eventType)
+
+	if c.usePresignedDownloads {
+		c.redirectToPresignedUrl(w, r, key)
+		return
+	}
+
+	object, err = c.s3Client.Get(
+		c.bucket,
+		key,
+		getoptions.WithContext(r.Context()),
+		getoptions.WithTimeout(time.Minute*30),
+	)
+
+	if err != nil {
+		requestlog.Logger(r).Error("error getting image object from S3", "error", err, "bucket", c.bucket, "key", key)
+		httphelpers.WriteText(w, http.StatusInternalServerError, "Failed to download image")
+		return
+	}
+
+	defer object.Body.Close()
+	fileName := filepath.Base(key)
+
+	if writeCacheHeaders(w, r, object.ETag, object.LastModified) {
+		return
+	}
+
+	contentType, body, err := detectContentType(object.ContentType, object.Body)
+
+	if err != nil {
+		requestlog.Logger(r).Error("error reading image to detect its content type", "error", err, "key", key)
+		httphelpers.WriteText(w, http.StatusInternalServerError, "Failed to download image")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=%s", disposition, fileName))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", object.Size))
+
+	_, _ = io.Copy(w, body)
+	metrics.ImageDownloadDuration.Observe(time.Since(start).Seconds())
+}
+
+/*
+GET /client/thumb?key=<original key>
+
+Serves the thumbnail for an album original. When the cache run hasn't
+created the thumbnail yet it is generated on the fly and stored so later
+requests hit the cache. Albums that haven't been purchased get their
+watermarked proof instead.
+*/
+func (c ClientAccessController) Thumbnail(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		stat      *s3.ObjectMetadata
+		original  s3.GetObjectResponse
+		thumbnail []byte
+		purchased bool
+	)
+
+	client := viewmodels.GetClientFromContext(r)
+	key := filepath.Clean(httphelpers.GetFromRequest[string](r, "key"))
+
+	if !c.keyBelongsToClient(client, key) || filepath.Base(filepath.Dir(key)) != "originals" {
+		requestlog.Logger(r).Warn("client attempted to get a thumbnail for a key outside their folder", "clientID", client.ID, "key", key)
+		httphelpers.WriteText(w, http.StatusForbidden, "You do not have access to this image")
+		return
+	}
+
+	if purchased, err = c.isPurchased(key); err != nil {
+		c.writePurchaseError(w, r, err, key)
+		return
+	}
+
+	thumbnailKey := c.thumbnailFormat.PreviewKey(key, purchased)
+	render := c.cacheCreator.RenderThumbnail
+
+	if !purchased {
+		render = c.cacheCreator.RenderProof
+	}
+
+	if stat, err = c.s3Client.StatObject(c.bucket, thumbnailKey); err != nil {
+		requestlog.Logger(r).Error("error retrieving metadata for thumbnail", "error", err, "key", thumbnailKey)
+	}
+
+	if stat != nil {
+		c.redirectToPresignedUrl(w, r, thumbnailKey)
+		return
+	}
+
+	original, err = c.s3Client.Get(
+		c.bucket,
+		key,
+		getoptions.WithContext(r.Context()),
+	)
+
+	if err != nil {
+		requestlog.Logger(r).Error("error getting original image for thumbnail", "error", err, "key", key)
+		httphelpers.WriteText(w, http.StatusNotFound, "Image not found")
+		return
+	}
+
+	defer original.Body.Close()
+
+	if thumbnail, err = render(original.Body); err != nil {
+		requestlog.Logger(r).Error("error rendering thumbnail", "error", err, "key", key)
+		httphelpers.TextInternalServerError(w, "Failed to create thumbnail")
+		return
+	}
+
+	/*
+	 * Store the thumbnail so the next request is served from the cache. The
+	 * upload must not hold on to the request, so it gets its own logger.
+	 */
+	c.cacheCreator.PutThumbnailInBackground(thumbnailKey, thumbnail, requestlog.Logger(r))
+
+	w.Header().Set("Content-Type", c.thumbnailFormat.ContentType)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(thumbnail)))
+	w.Header().Set("Cache-Control", "private, max-age=300")
+
+	_, _ = io.Copy(w, bytes.NewReader(thumbnail))
+}
+
+/*
+GET /client/login
+*/
+func (c ClientAccessController) LoginPage(w http.ResponseWriter, r *http.Request) {
+	viewData := viewmodels.ClientLogin{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Branding: c.branding,
+			Locale:   c.locale(r),
+			IsHtmx:   httphelpers.IsHtmx(r),
+		},
+		ClientCode: "",
+	}
+
+	c.renderer.Render("pages/clientaccess/login", viewData, w)
+}
+
+/*
+POST /client/login
+*/
+func (c ClientAccessController) LoginAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err        error
+		client     *models.Client
+		accessCode *models.AccessCode
+	)
+
+	pageName := "pages/clientaccess/login"
+
+	viewData := viewmodels.ClientLogin{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Branding: c.branding,
+			Locale:   c.locale(r),
+			IsHtmx:   httphelpers.IsHtmx(r),
+		},
+		ClientCode: httphelpers.GetFromRequest[string](r, "password"),
+	}
+
+	client, accessCode, err = c.clientService.GetByPassword(viewData.ClientCode)
+
+	if err != nil && !sqlz.IsNotFound(err) {
+		requestlog.Logger(r).Error("error querying for client information", "error", err)
+		c.recordLogin(r, models.LoginOutcomeError, nil, nil)
+
+		viewData.IsError = true
+		viewData.Message = viewData.T(i18n.ErrorUnexpected)
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	if sqlz.IsNotFound(err) {
+		metrics.LoginAttempts.WithLabelValues(metrics.LoginResultFailure).Inc()
+		c.recordLogin(r, models.LoginOutcomeIncorrectCode, nil, nil)
+
+		viewData.IsWarning = true
+		viewData.Message = viewData.T(i18n.LoginIncorrectPassword)
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	metrics.LoginAttempts.WithLabelValues(metrics.LoginResultSuccess).Inc()
+	c.recordLogin(r, models.LoginOutcomeSuccess, client, accessCode)
+	requestlog.Logger(r).Info("client logged in", "clientID", client.ID, "accessCodeID", accessCode.ID, "accessCodeLabel", accessCode.Label)
+
+	/*
+	 * Setup the session and redirect to the happy place
+	 */
+	if err = c.sessionService.Set(r, client); err != nil {
+		requestlog.Logger(r).Error("error setting client session", "error", err)
+	}
+
+	if httphelpers.GetFromRequest[bool](r, "remember") {
+		c.extendSession(r)
+	}
+
+	if err = c.sessionService.Save(w, r); err != nil {
+		requestlog.Logger(r).Error("error saving session", "error", err)
+	}
+
+	http.Redirect(w, r, "/client", http.StatusFound)
+}
+
+/*
+recordLogin adds a login attempt to the audit log. client and accessCode
+are nil when the code didn't match. A failure to record is logged but
+doesn't stop the login.
+*/
+func (c ClientAccessController) recordLogin(r *http.Request, outcome string, client *models.Client, accessCode *models.AccessCode) {
+	login := models.LoginAudit{
+		IPAddress: c.remoteIP(r),
+		UserAgent: r.UserAgent(),
+		Outcome:   outcome,
+	}
+
+	if client != nil {
+		login.ClientID = stdsql.NullInt64{Int64: int64(client.ID), Valid: true}
+	}
+
+	if accessCode != nil {
+		login.AccessCodeID = stdsql.NullInt64{Int64: int64(accessCode.ID), Valid: true}
+	}
+
+	if err := c.clientService.RecordLogin(login); err != nil {
+		requestlog.Logger(r).Error("error recording login attempt", "error", err, "outcome", outcome)
+	}
+}
+
+/*
+remoteIP is the address a request came from. X-Forwarded-For is only
+believed when the request came from one of trustedProxies, since anyone
+connecting directly can send it. It is read from the right, skipping
+entries that are themselves trusted proxies, so the address is the one the
+first trusted proxy saw rather than anything the client wrote into the
+header.
+*/
+func (c ClientAccessController) remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !c.isTrustedProxy(host) {
+		return host
+	}
+
+	forwardedFor := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+
+	for index := len(forwardedFor) - 1; index >= 0; index-- {
+		entry := strings.TrimSpace(forwardedFor[index])
+
+		if entry == "" {
+			continue
+		}
+
+		if !c.isTrustedProxy(entry) {
+			return entry
+		}
+
+		host = entry
+	}
+
+	return host
+}
+
+func (c ClientAccessController) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+
+	for _, prefix := range c.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+extendSession keeps the session cookie for sessionRememberTTL instead of the
+store's default lifetime. The options are per session, so this only affects
+the cookie written by this request.
+*/
+func (c ClientAccessController) extendSession(r *http.Request) {
+	session, err := c.sessionService.GetSession(r)
+
+	if err != nil {
+		requestlog.Logger(r).Error("error getting session to extend its lifetime", "error", err)
+		return
+	}
+
+	session.Options.MaxAge = int(c.sessionRememberTTL.Seconds())
+}
+
+/*
+GET /client/logout
+*/
+func (c ClientAccessController) LogoutAction(w http.ResponseWriter, r *http.Request) {
+	_ = c.sessionService.Destroy(w, r)
+	_ = c.sessionService.Save(w, r)
+	http.Redirect(w, r, "/client/login", http.StatusFound)
+}
+
+/*
+GET /client/{id}
+*/
+func (c ClientAccessController) ViewAlbumPage(w http.ResponseWriter, r *http.Request) {
+	c.renderAlbumPage(w, r, viewmodels.GetClientFromContext(r), httphelpers.GetFromRequest[uint](r, "id"), false)
+}
+
+/*
+GET /admin/preview/{clientid}/{albumid}
+
+Shows the photographer a client's album the way the client sees it,
+without needing their access code. The page is marked as a preview and
+nothing on it can be changed, since there is no client session behind it.
+*/
+func (c ClientAccessController) PreviewAlbumPage(w http.ResponseWriter, r *http.Request) {
+	client := &models.Client{BaseModel: models.BaseModel{ID: httphelpers.GetFromRequest[uint](r, "clientid")}}
+	c.renderAlbumPage(w, r, client, httphelpers.GetFromRequest[uint](r, "albumid"), true)
+}
+
+/*
+renderAlbumPage renders one of client's albums. preview marks the page as
+the photographer's preview rather than the client's own view.
+*/
+func (c ClientAccessController) renderAlbumPage(w http.ResponseWriter, r *http.Request, client *models.Client, albumID uint, preview bool) {
+	var (
+		err   error
+		album *models.Album
+	)
+
+	viewData := viewmodels.ClientViewAlbum{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Branding: c.branding,
+			Locale:   c.locale(r),
+			IsHtmx:   httphelpers.IsHtmx(r),
+			JavascriptIncludes: []rendering.JavascriptInclude{
+				{Type: "module", Src: "/static/js/pages/view-album.js"},
+			},
+		},
+		Client:                 client,
+		AlbumID:                albumID,
+		Album:                  internalmodels.Album{},
+		ImageUrlRefreshSeconds: c.imageUrlRefreshSeconds(),
+		Preview:                preview,
+	}
+
+	if album, err = c.albumService.GetAlbum(viewData.Client.ID, viewData.AlbumID); err != nil {
+		if isAlbumNotFound(r, err) {
+			httphelpers.WriteText(w, http.StatusNotFound, "Album not found")
+			return
+		}
+
+		requestlog.Logger(r).Error("an error occurred querying album in ViewAlbumPage", "error", err, "albumID", viewData.AlbumID, "preview", preview)
+		viewData.IsError = true
+		viewData.Message = viewData.T(i18n.ErrorUnexpected)
+
+		c.renderer.Render("pages/clientaccess/view-album", viewData, w)
+		return
+	}
+
+	if album.IsExpired() {
+		c.renderAlbumExpired(w, r, album)
+		return
+	}
+
+	if viewData.Album, err = c.convertAlbumToViewModel(r.Context(), album, true); err != nil {
+		requestlog.Logger(r).Error("error listing album images", "error", err, "albumID", viewData.AlbumID)
+		viewData.IsWarning = true
+		viewData.Message = viewData.T(i18n.ErrorUnexpected)
+
+		if errors.Is(err, context.DeadlineExceeded) {
+			viewData.Message = viewData.T(i18n.AlbumImagesTimeout)
+		}
+	}
+
+	c.renderer.Render("pages/clientaccess/view-album", viewData, w)
+}
+
+/*
+GET /client/downloads
+*/
+func (c ClientAccessController) DownloadsPage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		downloads []services.DownloadInfo
+	)
+
+	viewData := viewmodels.ClientDownloads{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Branding: c.branding,
+			Locale:   c.locale(r),
+			IsHtmx:   httphelpers.IsHtmx(r),
+		},
+		Client:    viewmodels.GetClientFromContext(r),
+		Downloads: []internalmodels.Download{},
+	}
+
+	if downloads, err = c.zipService.ListClientDownloads(viewData.Client.ID); err != nil {
+		requestlog.Logger(r).Error("error listing client downloads", "error", err, "clientID", viewData.Client.ID)
+		viewData.IsError = true
+		viewData.Message = viewData.T(i18n.ErrorUnexpected)
+	}
+
+	for _, download := range downloads {
+		viewData.Downloads = append(viewData.Downloads, internalmodels.Download{
+			AlbumID:     download.AlbumID,
+			AlbumName:   download.AlbumName,
+			CreatedAt:   download.CreatedAt.Format("Jan _2, 2006"),
+			DownloadURL: download.DownloadURL,
+			ExpiresIn:   formatExpiresIn(time.Until(download.ExpiresAt)),
+			Filename:    download.Filename,
+			Part:        download.Part,
+			Size:        formatFileSize(download.Size),
+		})
+	}
+
+	c.renderer.Render("pages/clientaccess/downloads", viewData, w)
+}
+
+/*
+GET /client/settings
+*/
+func (c ClientAccessController) SettingsPage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	client := viewmodels.GetClientFromContext(r)
+
+	viewData := viewmodels.ClientSettings{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Branding: c.branding,
+			Locale:   c.locale(r),
+			IsHtmx:   httphelpers.IsHtmx(r),
+		},
+	}
+
+	if viewData.NotifyOnDownload, err = c.clientService.GetNotificationPreference(client.ID); err != nil {
+		requestlog.Logger(r).Error("error getting notification preference", "error", err, "clientID", client.ID)
+		viewData.IsError = true
+		viewData.Message = viewData.T(i18n.ErrorUnexpected)
+	}
+
+	c.renderer.Render("pages/clientaccess/settings", viewData, w)
+}
+
+/*
+POST /client/settings
+*/
+func (c ClientAccessController) SettingsAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	client := viewmodels.GetClientFromContext(r)
+
+	viewData := viewmodels.ClientSettings{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Branding: c.branding,
+			Locale:   c.locale(r),
+			IsHtmx:   httphelpers.IsHtmx(r),
+		},
+		NotifyOnDownload: httphelpers.GetFromRequest[bool](r, "notifyOnDownload"),
+	}
+
+	if err = c.clientService.SetNotificationPreference(client.ID, viewData.NotifyOnDownload); err != nil {
+		requestlog.Logger(r).Error("error saving notification preference", "error", err, "clientID", client.ID)
+		viewData.IsError = true
+		viewData.Message = viewData.T(i18n.ErrorUnexpected)
+
+		c.renderer.Render("pages/clientaccess/settings", viewData, w)
+		return
+	}
+
+	viewData.Message = viewData.T(i18n.SettingsSaved)
+	c.renderer.Render("pages/clientaccess/settings", viewData, w)
+}
+
+/*
+GET /client/downloads/{filename}
+
+Download links emailed before the album ID moved into the route still point
+here. The album ID is the last hyphenated part of those filenames, e.g.
+"My-Album-123.zip". This can be removed once those links are past the
+download expiration.
+*/
+func (c ClientAccessController) LegacyDownloadZip(w http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		albumID int
+	)
+
+	client := viewmodels.GetClientFromContext(r)
+	filename := filepath.Base(httphelpers.GetFromRequest[string](r, "filename"))
+
+	parts := strings.Split(strings.TrimSuffix(filename, ".zip"), "-")
+
+	if albumID, err = strconv.Atoi(parts[len(parts)-1]); err != nil || albumID <= 0 {
+		httphelpers.WriteText(w, http.StatusBadRequest, "Invalid download link")
+		return
+	}
+
+	if _, err = c.albumService.GetAlbum(client.ID, uint(albumID)); err != nil {
+		httphelpers.WriteText(w, http.StatusNotFound, "Download file not found")
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/client/library/%d/downloads/%s", albumID, url.PathEscape(filename)), http.StatusMovedPermanently)
+}
+
+/*
+GET /client/zips/{token}
+
+Download links in emails and on My Downloads hold a signed token naming the
+zip rather than the zip itself. A token that has been altered, has expired,
+or was issued to another client is refused.
+*/
+func (c ClientAccessController) DownloadZipByToken(w http.ResponseWriter, r *http.Request) {
+	client := viewmodels.GetClientFromContext(r)
+	token, err := services.VerifyDownloadToken(c.downloadTokenSecret, httphelpers.GetFromRequest[string](r, "token"), time.Now())
+
+	if errors.Is(err, services.ErrDownloadTokenExpired) {
+		requestlog.Logger(r).Info("download link has expired", "clientID", client.ID, "albumID", token.AlbumID, "expiresAt", token.ExpiresAt)
+		httphelpers.WriteText(w, http.StatusForbidden, "This download link has expired")
+		return
+	}
+
+	if err != nil || token.ClientID != client.ID {
+		requestlog.Logger(r).Warn("refusing download link", "error", err, "clientID", client.ID, "tokenClientID", token.ClientID)
+		httphelpers.WriteText(w, http.StatusForbidden, "Invalid download link")
+		return
+	}
+
+	c.serveZip(w, r, client, token.AlbumID, token.Filename)
+}
+
+/*
+GET /client/library/{albumid}/downloads/{filename}
+
+Download links sent before they held tokens still point here. The zip isn't
+served from this route, since its name can be guessed. While it hasn't
+expired the client is sent on to a freshly signed token link for it.
+*/
+func (c ClientAccessController) DownloadZip(w http.ResponseWriter, r *http.Request) {
+	client := viewmodels.GetClientFromContext(r)
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+	filename := filepath.Base(httphelpers.GetFromRequest[string](r, "filename"))
+
+	if _, _, ok := c.findZip(w, r, client, albumID, filename); !ok {
+		return
+	}
+
+	token := services.SignDownloadToken(c.downloadTokenSecret, services.DownloadToken{
+		AlbumID:   albumID,
+		ClientID:  client.ID,
+		ExpiresAt: time.Now().Add(filenameLinkTokenExpiration),
+		Filename:  filename,
+	})
+
+	http.Redirect(w, r, "/client/zips/"+url.PathEscape(token), http.StatusFound)
+}
+
+/*
+serveZip sends one of the client's zips, or the download expired page when
+it is past its expiration.
+*/
+func (c ClientAccessController) serveZip(w http.ResponseWriter, r *http.Request, client *models.Client, albumID uint, filename string) {
+	var (
+		err    error
+		object s3.GetObjectResponse
+	)
+
+	// Sanitize the filename to prevent directory traversal
+	filename = filepath.Base(filename)
+	zipKey, stat, ok := c.findZip(w, r, client, albumID, filename)
+
+	if !ok {
+		return
+	}
+
+	if c.usePresignedDownloads {
+		c.redirectToPresignedUrl(w, r, zipKey)
+		return
+	}
+
+	if writeCacheHeaders(w, r, stat.ETag, stat.LastModified) {
+		return
+	}
+
+	requestlog.Logger(r).Info("serving zip download from S3", "filename", filename, "key", zipKey, "clientID", client.ID)
+
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	/*
+	 * Honor Range requests so an interrupted download can be resumed.
+	 * Multiple ranges aren't supported, so those get the whole file.
+	 */
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		br, err := parseByteRange(rangeHeader, stat.Size)
+
+		if errors.Is(err, ErrRangeNotSatisfiable) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", stat.Size))
+			httphelpers.WriteText(w, http.StatusRequestedRangeNotSatisfiable, "Requested range not satisfiable")
+			return
+		}
+
+		if err == nil {
+			c.serveRange(w, r, zipKey, filename, br, stat.Size)
+			return
+		}
+	}
+
+	object, err = c.s3Client.Get(
+		c.bucket,
+		zipKey,
+		getoptions.WithContext(r.Context()),
+	)
+
+	if err != nil {
+		requestlog.Logger(r).Error("error getting zip object from S3", "error", err, "bucket", c.bucket, "key", zipKey)
+		httphelpers.WriteText(w, http.StatusNotFound, "Download file not found")
+		return
+	}
+
+	defer object.Body.Close()
+
+	// Set appropriate headers for file download
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", object.Size))
+
+	// Stream the file to the response
+	if _, err = io.Copy(w, object.Body); err != nil {
+		requestlog.Logger(r).Error("error streaming zip file", "error", err, "key", zipKey)
+		return
+	}
+
+	requestlog.Logger(r).Info("zip file download completed", "filename", filename, "clientID", client.ID)
+}
+
+/*
+findZip looks up one of the client's zips in S3. When it is missing or past
+its expiration the response is written and ok is false.
+*/
+func (c ClientAccessController) findZip(w http.ResponseWriter, r *http.Request, client *models.Client, albumID uint, filename string) (zipKey string, stat *s3.ObjectMetadata, ok bool) {
+	var (
+		err error
+	)
+
+	if albumID == 0 || !strings.HasSuffix(strings.ToLower(filename), ".zip") {
+		httphelpers.WriteText(w, http.StatusBadRequest, "Invalid download link")
+		return "", nil, false
+	}
+
+	zipKey = filepath.Join(
+		c.clientPhotoFolder,
+		fmt.Sprint(client.ID),
+		fmt.Sprint(albumID),
+		"downloads",
+		filename,
+	)
+
+	/*
+	 * Tell the difference between a download that never existed and one
+	 * that has passed its expiration, so the client can request a new one.
+	 */
+	if stat, err = c.s3Client.StatObject(c.bucket, zipKey); err != nil {
+		requestlog.Logger(r).Error("error getting zip metadata from S3", "error", err, "bucket", c.bucket, "key", zipKey)
+		httphelpers.WriteText(w, http.StatusInternalServerError, "Failed to download file")
+		return "", nil, false
+	}
+
+	if stat == nil {
+		httphelpers.WriteText(w, http.StatusNotFound, "Download file not found")
+		return "", nil, false
+	}
+
+	if c.zipService.IsExpired(stat.LastModified) {
+		viewData := viewmodels.ClientDownloadExpired{
+			BaseViewModel: viewmodels.BaseViewModel{
+				Branding: c.branding,
+				Locale:   c.locale(r),
+				IsHtmx:   httphelpers.IsHtmx(r),
+			},
+			AlbumID: albumID,
+		}
+
+		w.WriteHeader(http.StatusGone)
+		c.renderer.Render("pages/clientaccess/download-expired", viewData, w)
+		return "", nil, false
+	}
+
+	return zipKey, stat, true
+}
+
+/*
+serveRange streams part of an S3 object with a 206 response. The S3 client's
+get options have no way to ask for a range, so the range is requested
+through a presigned URL with the controller's own HTTP client instead.
+*/
+func (c ClientAccessController) serveRange(w http.ResponseWriter, r *http.Request, key, filename string, br byteRange, size int64) {
+	var (
+		err      error
+		u        string
+		req      *http.Request
+		response *http.Response
+	)
+
+	u, err = c.s3Client.GetUrl(
+		c.bucket,
+		key,
+		geturloptions.WithContext(r.Context()),
+		geturloptions.WithExpiration(c.presignedUrlExpiration),
+	)
+
+	if err != nil {
+		requestlog.Logger(r).Error("error generating presigned URL for ranged download", "error", err, "key", key)
+		httphelpers.TextInternalServerError(w, "Failed to download file")
+		return
+	}
+
+	if req, err = http.NewRequestWithContext(r.Context(), http.MethodGet, u, nil); err != nil {
+		requestlog.Logger(r).Error("error creating ranged request", "error", err, "key", key)
+		httphelpers.TextInternalServerError(w, "Failed to download file")
+		return
+	}
+
+	req.Header.Set("Range", br.Header())
+
+	if response, err = c.rangeClient.Do(req); err != nil {
+		requestlog.Logger(r).Error("error requesting range from S3", "error", err, "key", key)
+		httphelpers.TextInternalServerError(w, "Failed to download file")
+		return
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusPartialContent {
+		requestlog.Logger(r).Error("unexpected status requesting range from S3", "status", response.Status, "key", key)
+		httphelpers.TextInternalServerError(w, "Failed to download file")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	w.Header().Set("Content-Range", br.ContentRange(size))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", br.Length()))
+	w.WriteHeader(http.StatusPartialContent)
+
+	if _, err = io.Copy(w, response.Body); err != nil {
+		requestlog.Logger(r).Error("error streaming zip file range", "error", err, "key", key)
+	}
+}
+
+/*
+PUT /client/library/{albumid}/toggle-favorite/{imagepath}
+*/
+func (c ClientAccessController) ToggleFavorite(w http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		exists bool
+	)
+
+	client := viewmodels.GetClientFromContext(r)
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+	key := filepath.Base(httphelpers.GetFromRequest[string](r, "key"))
+
+	if exists, err = c.albumService.ToggleFavorite(client.ID, albumID, key); err != nil {
+		limitErr := services.FavoriteLimitError{}
+
+		if errors.As(err, &limitErr) {
+			httphelpers.WriteText(w, http.StatusConflict, i18n.Translate(c.locale(r), i18n.FavoritesLimitReached, limitErr.Limit))
+			return
+		}
+
+		requestlog.Logger(r).Error("error toggling favorite", "error", err, "albumID", albumID, "imagePath", key)
+		httphelpers.TextInternalServerError(w, "Error toggling favorite")
+		return
+	}
+
+	icon := "icon"
+
+	/*
+	 * Update the view model to reflect the favorite status.
+	 * Exist returns true if the image is already a favorite, false otherwise.
+	 */
+	if !exists {
+		icon += " icon-heart"
+	} else {
+		icon += " icon-empty-heart"
+	}
+
+	markup := fmt.Sprintf("<i class='%s'></i>", icon)
+	httphelpers.WriteHtml(w, http.StatusOK, markup)
+}
+
+/*
+POST /client/library/{albumid}/comment
+
+Adds a comment to an image. Responds with the rendered comment so HTMX can
+append it to the image's comment list. The body is escaped here since this
+markup doesn't go through a template.
+*/
+func (c ClientAccessController) AddComment(w http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		album   *models.Album
+		comment models.Comment
+	)
+
+	client := viewmodels.GetClientFromContext(r)
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+	key := filepath.Base(httphelpers.GetFromRequest[string](r, "key"))
+	body := httphelpers.GetFromRequest[string](r, "body")
+
+	if album, err = c.albumService.GetAlbum(client.ID, albumID); err != nil {
+		if isAlbumNotFound(r, err) {
+			httphelpers.WriteText(w, http.StatusNotFound, "Album not found")
+			return
+		}
+
+		requestlog.Logger(r).Error("error getting album to comment on", "error", err, "albumID", albumID)
+		httphelpers.TextInternalServerError(w, "An unexpected error occurred")
+		return
+	}
+
+	if album.IsExpired() {
+		httphelpers.WriteText(w, http.StatusGone, i18n.Translate(c.locale(r), i18n.AlbumExpired))
+		return
+	}
+
+	if key == "" || key == "." || key == "/" {
+		httphelpers.WriteText(w, http.StatusBadRequest, i18n.Translate(c.locale(r), i18n.CommentImageRequired))
+		return
+	}
+
+	if comment, err = c.albumService.AddComment(client.ID, albumID, key, body); err != nil {
+		if errors.Is(err, services.ErrEmptyComment) {
+			httphelpers.WriteText(w, http.StatusBadRequest, i18n.Translate(c.locale(r), i18n.CommentRequired))
+			return
+		}
+
+		requestlog.Logger(r).Error("error adding comment", "error", err, "albumID", albumID, "imagePath", key)
+		httphelpers.TextInternalServerError(w, "Error adding comment")
+		return
+	}
+
+	vm := convertCommentToViewModel(comment)
+
+	markup := fmt.Sprintf(
+		"<li><small>%s</small><p>%s</p></li>",
+		html.EscapeString(vm.CreatedAt),
+		html.EscapeString(vm.Body),
+	)
+
+	httphelpers.WriteHtml(w, http.StatusOK, markup)
+}
+
+/*
+GET /client/library/{albumid}/favorites
+*/
+func (c ClientAccessController) GetFavorites(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		favorites []models.Favorite
+		originals s3.ListResponse
+	)
+
+	client := viewmodels.GetClientFromContext(r)
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+
+	if _, err = c.albumService.GetAlbum(client.ID, albumID); err != nil {
+		c.writeAlbumError(w, r, err, albumID)
+		return
+	}
+
+	if favorites, err = c.albumService.GetFavorites(client.ID, albumID); err != nil {
+		requestlog.Logger(r).Error("error getting favorites", "error", err, "clientID", client.ID, "albumID", albumID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "Error getting favorites")
+		return
+	}
+
+	/*
+	 * Favorites can outlive their images. Only report those that still
+	 * exist in the album's originals.
+	 */
+	ctx, cancel := context.WithTimeout(r.Context(), c.s3OperationTimeout)
+	defer cancel()
+
+	originals, err = services.ListObjects(
+		ctx,
+		c.s3Client,
+		c.bucket,
+		fmt.Sprintf("%s/%d/%d/originals/", c.clientPhotoFolder, client.ID, albumID),
+		listoptions.WithGetAll(),
+	)
+
+	if err != nil {
+		requestlog.Logger(r).Error("error listing album originals for favorites", "error", err, "clientID", client.ID, "albumID", albumID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "Error getting favorites")
+		return
+	}
+
+	existing := map[string]bool{}
+
+	for _, original := range originals.Objects {
+		existing[filepath.Base(original.Key)] = true
+	}
+
+	keys := []string{}
+
+	for _, favorite := range favorites {
+		if existing[favorite.ImagePath] {
+			keys = append(keys, favorite.ImagePath)
+		}
+	}
+
+	httphelpers.JsonOK(w, map[string]any{
+		"count": len(keys),
+		"keys":  keys,
+	})
+}
+
+/*
+PUT /client/library/{albumid}/favorites
+*/
+func (c ClientAccessController) SetFavorites(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	request := struct {
+		Keys     []string `json:"keys"`
+		Favorite bool     `json:"favorite"`
+	}{}
+
+	client := viewmodels.GetClientFromContext(r)
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+
+	if err = httphelpers.ReadJSONBody(r, &request); err != nil {
+		requestlog.Logger(r).Error("error reading set favorites request", "error", err, "albumID", albumID)
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if _, err = c.albumService.GetAlbum(client.ID, albumID); err != nil {
+		c.writeAlbumError(w, r, err, albumID)
+		return
+	}
+
+	keys := make([]string, 0, len(request.Keys))
+
+	for _, key := range request.Keys {
+		keys = append(keys, filepath.Base(key))
+	}
+
+	if err = c.albumService.SetFavorites(client.ID, albumID, keys, request.Favorite); err != nil {
+		limitErr := services.FavoriteLimitError{}
+
+		if errors.As(err, &limitErr) {
+			httphelpers.JsonErrorMessage(w, http.StatusConflict, i18n.Translate(c.locale(r), i18n.FavoritesLimitReached, limitErr.Limit))
+			return
+		}
+
+		requestlog.Logger(r).Error("error setting favorites", "error", err, "albumID", albumID, "numKeys", len(keys))
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "Error setting favorites")
+		return
+	}
+
+	httphelpers.JsonOK(w, map[string]any{
+		"keys":     keys,
+		"favorite": request.Favorite,
+	})
+}
+
+/*
+PUT /client/library/{albumid}/favorites/restore
+
+Brings back a favorite the client removed, keeping when it was first added.
+*/
+func (c ClientAccessController) RestoreFavorite(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	client := viewmodels.GetClientFromContext(r)
+	albumID := httphelpers.GetFromRequest[uint](r, "albumid")
+	key := filepath.Base(httphelpers.GetFromRequest[string](r, "key"))
+
+	if key == "" || key == "." || key == "/" {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, i18n.Translate(c.locale(r), i18n.CommentImageRequired))
+		return
+	}
+
+	if _, err = c.albumService.GetAlbum(client.ID, albumID); err != nil {
+		c.writeAlbumError(w, r, err, albumID)
+		return
+	}
+
+	if err = c.albumService.RestoreFavorite(client.ID, albumID, key); err != nil {
+		limitErr := services.FavoriteLimitError{}
+
+		if errors.As(err, &limitErr) {
+			httphelpers.JsonErrorMessage(w, http.StatusConflict, i18n.Translate(c.locale(r), i18n.FavoritesLimitReached, limitErr.Limit))
+			return
+		}
+
+		requestlog.Logger(r).Error("error restoring favorite", "error", err, "albumID", albumID, "imagePath", key)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "Error restoring favorite")
+		return
+	}
+
+	httphelpers.JsonOK(w, map[string]any{
+		"key":      key,
+		"favorite": true,
+	})
+}
+
+/*
+GET /api/client/albums
+*/
+func (c ClientAccessController) ApiAlbumList(w http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		albums []*models.Album
+	)
+
+	client := viewmodels.GetClientFromContext(r)
+	result := []internalmodels.Album{}
+
+	if albums, err = c.albumService.GetAlbumList(client.ID); err != nil && !sqlz.IsNotFound(err) {
+		requestlog.Logger(r).Error("error getting album list for API", "error", err, "clientID", client.ID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	for _, album := range albums {
+		converted, _ := c.convertAlbumToViewModel(r.Context(), album, false)
+		result = append(result, converted)
+	}
+
+	httphelpers.JsonOK(w, result)
+}
+
+/*
+GET /api/client/albums/{id}
+*/
+func (c ClientAccessController) ApiAlbumDetail(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		album *models.Album
+	)
+
+	client := viewmodels.GetClientFromContext(r)
+	albumID := httphelpers.GetFromRequest[uint](r, "id")
+
+	if album, err = c.albumService.GetAlbum(client.ID, albumID); err != nil {
+		c.writeAlbumError(w, r, err, albumID)
+		return
+	}
+
+	if album.IsExpired() {
+		httphelpers.JsonErrorMessage(w, http.StatusGone, "Album access has expired")
+		return
+	}
+
+	result, err := c.convertAlbumToViewModel(r.Context(), album, true)
+
+	if err != nil {
+		requestlog.Logger(r).Error("error listing album images for API", "error", err, "clientID", client.ID, "albumID", albumID)
+
+		if errors.Is(err, context.DeadlineExceeded) {
+			httphelpers.JsonErrorMessage(w, http.StatusGatewayTimeout, "Album images took too long to load")
+			return
+		}
+
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+		return
+	}
+
+	httphelpers.JsonOK(w, result)
+}
+
+/*
+renderAlbumExpired shows the album access expired page with a 410 status.
+HTMX doesn't swap error responses, so HTMX requests get a 200.
+*/
+func (c ClientAccessController) renderAlbumExpired(w http.ResponseWriter, r *http.Request, album *models.Album) {
+	viewData := viewmodels.ClientAlbumExpired{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Branding: c.branding,
+			Locale:   c.locale(r),
+			IsHtmx:   httphelpers.IsHtmx(r),
+		},
+		AlbumName: album.Name,
+	}
+
+	if !viewData.IsHtmx {
+		w.WriteHeader(http.StatusGone)
+	}
+
+	c.renderer.Render("pages/clientaccess/album-expired", viewData, w)
+}
+
+/*
+isAlbumNotFound reports whether err means the client can't have the album,
+because there is no such album or because it belongs to another client.
+Both are answered as not found so album IDs can't be probed, but attempts
+at another client's album are logged.
+*/
+func isAlbumNotFound(r *http.Request, err error) bool {
+	if errors.Is(err, services.ErrAlbumAccessDenied) {
+		requestlog.Logger(r).Warn("client asked for another client's album", "error", err)
+		return true
+	}
+
+	return errors.Is(err, services.ErrAlbumNotFound)
+}
+
+/*
+writeAlbumError answers a JSON request whose album couldn't be loaded,
+with a 404 when the client can't have it and a 500 otherwise.
+*/
+func (c ClientAccessController) writeAlbumError(w http.ResponseWriter, r *http.Request, err error, albumID uint) {
+	if isAlbumNotFound(r, err) {
+		httphelpers.JsonErrorMessage(w, http.StatusNotFound, "Album not found")
+		return
+	}
+
+	requestlog.Logger(r).Error("error getting album", "error", err, "albumID", albumID)
+	httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "An unexpected error occurred")
+}
+
+/*
+locale returns the locale to show the request in, preferring the one saved
+for the logged in client over the browser's Accept-Language header.
+*/
+func (c ClientAccessController) locale(r *http.Request) string {
+	return i18n.ResolveLocale(r, viewmodels.GetClientFromContext(r).Locale)
+}
+
+/*
+keyBelongsToClient returns true when an S3 key lives under the client's
+photo folder. Every handler that serves an object by a caller-supplied key
+must check this first, otherwise a client could fetch another client's
+photos by guessing keys.
+*/
+func (c ClientAccessController) keyBelongsToClient(client *models.Client, key string) bool {
+	prefix := filepath.Join(c.clientPhotoFolder, fmt.Sprint(client.ID)) + "/"
+	return strings.HasPrefix(filepath.Clean(key), prefix)
+}
+
+/*
+albumIDFromKey reads the album ID out of the key of an album original, which
+is laid out as <client folder>/<client ID>/<album ID>/originals/<image>. ok
+is false for keys that don't fit that layout.
+*/
+func albumIDFromKey(key string) (albumID uint, ok bool) {
+	key = filepath.Clean(key)
+
+	if filepath.Base(filepath.Dir(key)) != "originals" {
+		return 0, false
+	}
+
+	if _, err := fmt.Sscan(filepath.Base(filepath.Dir(filepath.Dir(key))), &albumID); err != nil {
+		return 0, false
+	}
+
+	return albumID, true
+}
+
+/*
+isPurchased reports whether the album an original belongs to has been
+purchased. Keys outside an album's originals are refused with
+services.ErrInvalidInput.
+*/
+func (c ClientAccessController) isPurchased(key string) (bool, error) {
+	albumID, ok := albumIDFromKey(key)
+
+	if !ok {
+		return false, fmt.Errorf("%w: '%s' is not an album original", services.ErrInvalidInput, key)
+	}
+
+	return c.albumService.GetPurchased(albumID)
+}
+
+/*
+writePurchaseError responds to an error from isPurchased.
+*/
+func (c ClientAccessController) writePurchaseError(w http.ResponseWriter, r *http.Request, err error, key string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidInput):
+		httphelpers.WriteText(w, http.StatusForbidden, "You do not have access to this image")
+
+	case errors.Is(err, services.ErrAlbumNotFound):
+		httphelpers.WriteText(w, http.StatusNotFound, "Image not found")
+
+	default:
+		requestlog.Logger(r).Error("error checking album purchase status", "error", err, "key", key)
+		httphelpers.WriteText(w, http.StatusInternalServerError, "An unexpected error occurred")
+	}
+}
+
+/*
+writeDownloadsDisabled refuses a download from an album that is view only or
+hasn't been purchased.
+*/
+func writeDownloadsDisabled(w http.ResponseWriter, r *http.Request, client *models.Client, albumID uint) {
+	requestlog.Logger(r).Info("refusing download from an album that can't be downloaded", "clientID", client.ID, "albumID", albumID)
+	httphelpers.WriteText(w, http.StatusForbidden, "Downloads are not available for this album")
+}
+
+/*
+recordImageEvent records a view or download of an album original. Keys that
+don't fit the layout albumIDFromKey reads aren't recorded.
+*/
+func (c ClientAccessController) recordImageEvent(client *models.Client, key, eventType string) {
+	albumID, ok := albumIDFromKey(key)
+
+	if !ok {
+		return
+	}
+
+	c.imageEventService.Record(models.ImageEvent{
+		ClientID:  client.ID,
+		AlbumID:   albumID,
+		ImagePath: filepath.Base(key),
+		EventType: eventType,
+	})
+}
+
+/*
+redirectToPresignedUrl sends the browser straight to S3 using a short-lived
+presigned URL, so large files don't stream through this process.
+*/
+func (c ClientAccessController) redirectToPresignedUrl(w http.ResponseWriter, r *http.Request, key string) {
+	u, err := c.s3Client.GetUrl(
+		c.bucket,
+		key,
+		geturloptions.WithContext(r.Context()),
+		geturloptions.WithExpiration(c.presignedUrlExpiration),
+	)
+
+	if err != nil {
+		requestlog.Logger(r).Error("error generating presigned download URL", "error", err, "bucket", c.bucket, "key", key)
+		httphelpers.WriteText(w, http.StatusInternalServerError, "Failed to download file")
+		return
+	}
+
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+/*
+convertAlbumToViewModel converts a database album into the structure shared
+by the HTML pages and the JSON API. When getImages is true the thumbnail and
+original URLs for every image in the album are included. Image URLs go
+through the CDN when one is configured and are presigned S3 URLs lasting
+imageUrlExpiration otherwise.
+Listing them gives up after s3OperationTimeout. When the originals can't be listed the album is
+returned without images, along with the error.
+*/
+func (c ClientAccessController) convertAlbumToViewModel(ctx context.Context, album *models.Album, getImages bool) (internalmodels.Album, error) {
 	var (
 		err error
 		u   string
@@ -391,19 +1927,39 @@ func (c ClientAccessController) convertAlbumToViewModel(album *models.Album, get
 		},
 		ShootDate:  album.ShootDate.Format("Jan _2, 2006"),
 		Favorites:  []internalmodels.Favorite{},
+		PosterXPos: album.PosterXPos,
 		PosterYPos: album.PosterYPos,
 		ImageURLs:  []internalmodels.Image{},
+
+		AllowDownload: album.CanDownload(),
+		Purchased:     album.Purchased,
+	}
+
+	favorites := map[string]models.Favorite{}
+	comments := map[string][]internalmodels.Comment{}
+
+	for _, comment := range album.Comments {
+		comments[comment.ImagePath] = append(comments[comment.ImagePath], convertCommentToViewModel(comment))
+	}
+
+	for _, favorite := range album.Favorites {
+		favorites[favorite.ImagePath] = favorite
+
+		result.Favorites = append(result.Favorites, internalmodels.Favorite{
+			ImagePath:   favorite.ImagePath,
+			FavoritedAt: formatFavoritedAt(favorite.CreatedAt),
+		})
 	}
 
 	key := filepath.Join(
 		c.clientPhotoFolder,
 		fmt.Sprint(album.ClientID),
 		fmt.Sprint(album.ID),
-		"thumbnails",
-		album.PosterImagePath,
+		cache.PreviewFolder(album),
+		album.PosterImagePath+c.thumbnailFormat.Suffix,
 	)
 
-	u, err = c.s3Client.GetUrl(c.bucket, key)
+	u, err = c.imageURL(key)
 
 	if err == nil {
 		slog.Info("got poster image URL", "clientID", album.ClientID, "albumID", album.ID, "imagePath", album.PosterImagePath, "url", u)
@@ -413,51 +1969,256 @@ func (c ClientAccessController) convertAlbumToViewModel(album *models.Album, get
 	}
 
 	if getImages {
-		thumbnails, err := c.s3Client.List(
+		ctx, cancel := context.WithTimeout(ctx, c.s3OperationTimeout)
+		defer cancel()
+
+		thumbnails, err := services.ListObjects(
+			ctx,
+			c.s3Client,
 			c.bucket,
-			fmt.Sprintf("%s/%d/%d/thumbnails/", c.clientPhotoFolder, album.ClientID, album.ID),
-			listoptions.WithGetUrls(),
+			fmt.Sprintf("%s/%d/%d/%s/", c.clientPhotoFolder, album.ClientID, album.ID, cache.PreviewFolder(album)),
 		)
 
 		if err != nil {
 			slog.Error("error getting thumbnail image URLs", "error", err, "clientID", album.ClientID, "albumID", album.ID)
 		}
 
-		originals, err := c.s3Client.List(
+		originals, err := services.ListObjects(
+			ctx,
+			c.s3Client,
 			c.bucket,
 			fmt.Sprintf("%s/%d/%d/originals/", c.clientPhotoFolder, album.ClientID, album.ID),
-			listoptions.WithGetUrls(),
 		)
 
 		if err != nil {
-			slog.Error("error getting image URLs", "error", err, "clientID", album.ClientID, "albumID", album.ID)
+			return result, fmt.Errorf("error getting image URLs for album %d: %w", album.ID, err)
+		}
+
+		/*
+		 * Edited versions are named the same as their originals. They are
+		 * clean images, so like the originals they aren't handed out until
+		 * the album is purchased.
+		 */
+		editedURLs := map[string]string{}
+
+		if album.Purchased {
+			edited, err := services.ListObjects(
+				ctx,
+				c.s3Client,
+				c.bucket,
+				fmt.Sprintf("%s/%d/%d/edited/", c.clientPhotoFolder, album.ClientID, album.ID),
+			)
+
+			if err != nil {
+				slog.Error("error getting edited image URLs", "error", err, "clientID", album.ClientID, "albumID", album.ID)
+			}
+
+			for _, object := range edited.Objects {
+				if editedURLs[filepath.Base(object.Key)], err = c.imageURL(object.Key); err != nil {
+					slog.Error("error getting edited image URL", "error", err, "clientID", album.ClientID, "albumID", album.ID, "key", object.Key)
+				}
+			}
+		}
+
+		/*
+		 * Dimensions come from the sidecar written by the cache run, so
+		 * nothing is decoded here. Images it hasn't read yet have none.
+		 */
+		dimensions, err := cache.ReadImageDimensions(c.s3Client, c.bucket, c.clientPhotoFolder, album)
+
+		if err != nil {
+			slog.Error("error getting image dimensions", "error", err, "clientID", album.ClientID, "albumID", album.ID)
+		}
+
+		/*
+		 * Walk the originals rather than the thumbnails so images still show
+		 * up before the cache run has created their thumbnails. Missing
+		 * thumbnails are generated on demand.
+		 */
+		thumbnailURLs := map[string]string{}
+
+		for _, thumbnail := range thumbnails.Objects {
+			if thumbnailURLs[filepath.Base(thumbnail.Key)], err = c.imageURL(thumbnail.Key); err != nil {
+				slog.Error("error getting thumbnail image URL", "error", err, "clientID", album.ClientID, "albumID", album.ID, "key", thumbnail.Key)
+			}
 		}
 
-		for index, thumbnail := range thumbnails.Objects {
+		for _, original := range originals.Objects {
+			baseImage := filepath.Base(original.Key)
+			originalURL, err := c.imageURL(original.Key)
+
+			if err != nil {
+				slog.Error("error getting original image URL", "error", err, "clientID", album.ClientID, "albumID", album.ID, "key", original.Key)
+			}
+
 			newImage := internalmodels.Image{
-				ThumbnailURL: thumbnail.Url,
-				OriginalURL:  originals.Objects[index].Url,
+				ThumbnailURL: thumbnailURLs[baseImage+c.thumbnailFormat.Suffix],
+				OriginalURL:  originalURL,
 				OriginalPath: fmt.Sprintf("%s/%d/%d/originals/", c.clientPhotoFolder, album.ClientID, album.ID),
-				OriginalKey:  originals.Objects[index].Key,
+				OriginalKey:  original.Key,
+				Comments:     comments[baseImage],
+				EditedURL:    editedURLs[baseImage],
+				Width:        dimensions[baseImage].Width,
+				Height:       dimensions[baseImage].Height,
+				SizeBytes:    original.Size,
 			}
 
-			// Is this image a favorite?
-			uu, _ := url.Parse(originals.Objects[index].Url)
-			baseImage := filepath.Base(uu.Path)
+			if newImage.Comments == nil {
+				newImage.Comments = []internalmodels.Comment{}
+			}
 
-			favImagePaths := slices.Map(album.Favorites, func(input models.Favorite, index int) string {
-				return input.ImagePath
-			})
+			if newImage.ThumbnailURL == "" {
+				newImage.ThumbnailURL = "/client/thumb?key=" + url.QueryEscape(original.Key)
+			}
 
-			isFav := slices.IsInSlice(baseImage, favImagePaths)
+			// The clean original isn't handed out until the album is purchased
+			if !album.Purchased {
+				newImage.OriginalURL = newImage.ThumbnailURL
+			}
 
-			if isFav {
+			// Is this image a favorite?
+			if favorite, ok := favorites[baseImage]; ok {
 				newImage.IsFavorite = true
+				newImage.FavoritedAt = formatFavoritedAt(favorite.CreatedAt)
 			}
 
 			result.ImageURLs = append(result.ImageURLs, newImage)
 		}
+
+		sortImagesByOrder(result.ImageURLs, album.ImageOrder)
 	}
 
-	return result
+	return result, nil
+}
+
+/*
+imageURL returns the URL an album image is shown from. Presigned URLs last
+for imageUrlExpiration, so a gallery left open stays usable.
+*/
+func (c ClientAccessController) imageURL(key string) (string, error) {
+	return services.ImageURL(c.s3Client, c.bucket, c.cdnBaseURL, key, geturloptions.WithExpiration(c.imageUrlExpiration))
+}
+
+/*
+imageUrlRefreshSeconds is how long the album page waits before fetching
+fresh image URLs. It refreshes at 80% of the expiration so there is time to
+spare. Images from a CDN don't expire, so it is 0 then and nothing is
+refreshed.
+*/
+func (c ClientAccessController) imageUrlRefreshSeconds() int {
+	if c.cdnBaseURL != "" {
+		return 0
+	}
+
+	return int(c.imageUrlExpiration.Seconds() * 0.8)
+}
+
+/*
+sortImagesByOrder puts images in the album's curated order. Images with a
+stored position come first, by position, followed by the rest by name.
+*/
+func sortImagesByOrder(images []internalmodels.Image, order []models.ImageOrder) {
+	positions := make(map[string]int, len(order))
+
+	for _, o := range order {
+		positions[o.ImagePath] = o.Position
+	}
+
+	sort.SliceStable(images, func(i, j int) bool {
+		nameI := filepath.Base(images[i].OriginalKey)
+		nameJ := filepath.Base(images[j].OriginalKey)
+		posI, orderedI := positions[nameI]
+		posJ, orderedJ := positions[nameJ]
+
+		switch {
+		case orderedI && orderedJ:
+			return posI < posJ
+
+		case orderedI != orderedJ:
+			return orderedI
+
+		default:
+			return nameI < nameJ
+		}
+	})
+}
+
+func parseFilterDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.DateOnly, value)
+}
+
+func convertCommentToViewModel(comment models.Comment) internalmodels.Comment {
+	return internalmodels.Comment{
+		ID:        comment.ID,
+		ImagePath: comment.ImagePath,
+		Body:      comment.Body,
+		CreatedAt: comment.CreatedAt.Format("Jan _2, 2006 3:04 PM"),
+	}
+}
+
+func formatFavoritedAt(createdAt time.Time) string {
+	if createdAt.IsZero() {
+		return ""
+	}
+
+	return createdAt.Format("Jan _2, 2006")
+}
+
+/*
+parseDisposition validates the disposition an image is asked to be served
+with. Anything other than inline or attachment is refused. An empty value
+is an attachment.
+*/
+func parseDisposition(value string) (string, bool) {
+	switch value {
+	case "", dispositionAttachment:
+		return dispositionAttachment, true
+
+	case dispositionInline:
+		return dispositionInline, true
+	}
+
+	return "", false
+}
+
+func formatFileSize(size int64) string {
+	const unit = 1024
+
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func formatExpiresIn(remaining time.Duration) string {
+	days := int(remaining.Hours() / 24)
+
+	switch {
+	case remaining <= 0:
+		return "Expired"
+
+	case days >= 2:
+		return fmt.Sprintf("in %d days", days)
+
+	case remaining >= time.Hour*24:
+		return "in 1 day"
+
+	case remaining >= time.Hour:
+		return fmt.Sprintf("in %d hours", int(remaining.Hours()))
+
+	default:
+		return "in less than an hour"
+	}
 }
@@ -0,0 +1,2161 @@
+package clientaccess
+
+import (
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adamgokit/sessions"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/cache"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/i18n"
+	internalmodels "github.com/adampresley/adampresleyphotography/cmd/website/internal/models"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/viewmodels"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+)
+
+func TestViewImageRecordsAView(t *testing.T) {
+	events := &fakeImageEventService{}
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+			2: {BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true},
+		}},
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		ImageEventService: events,
+		S3Client:          fakeS3Client{url: "https://s3.example.com"},
+	})
+
+	client := &models.Client{BaseModel: models.BaseModel{ID: 1}}
+
+	t.Run("own image", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/client/view-image?key=clients/1/2/originals/a.jpg", nil)
+		w := httptest.NewRecorder()
+
+		controller.ViewImage(w, withClient(r, client))
+
+		if w.Code != http.StatusFound {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+		}
+
+		if got := w.Header().Get("Location"); got != "https://s3.example.com/clients/1/2/originals/a.jpg" {
+			t.Errorf("Location = %q", got)
+		}
+
+		recorded := events.recorded()
+		want := models.ImageEvent{ClientID: 1, AlbumID: 2, ImagePath: "a.jpg", EventType: models.ImageEventView}
+
+		if len(recorded) != 1 || recorded[0] != want {
+			t.Errorf("recorded = %+v, want [%+v]", recorded, want)
+		}
+	})
+
+	t.Run("another client's image", func(t *testing.T) {
+		before := len(events.recorded())
+
+		r := httptest.NewRequest(http.MethodGet, "/client/view-image?key=clients/10/2/originals/a.jpg", nil)
+		w := httptest.NewRecorder()
+
+		controller.ViewImage(w, withClient(r, client))
+
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+		}
+
+		if got := len(events.recorded()); got != before {
+			t.Errorf("recorded %d events for a forbidden image", got-before)
+		}
+	})
+}
+
+func newApiTestController() ClientAccessController {
+	return NewClientAccessController(ClientAccessControllerConfig{
+		AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+			2: {
+				BaseModel:       models.BaseModel{ID: 2},
+				ClientID:        1,
+				Name:            "Summer Wedding",
+				PosterImagePath: "a.jpg",
+				ShootDate:       time.Date(2024, 7, 15, 0, 0, 0, 0, time.UTC),
+				Favorites:       []models.Favorite{{ClientID: 1, AlbumID: 2, ImagePath: "b.jpg"}},
+				Purchased:       true,
+			},
+			3: {BaseModel: models.BaseModel{ID: 3}, ClientID: 9, Name: "Someone Else", Purchased: true},
+		}},
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		S3Client: fakeS3Client{
+			objects: map[string][]byte{
+				"clients/1/2/originals/a.jpg":  nil,
+				"clients/1/2/originals/b.jpg":  nil,
+				"clients/1/2/thumbnails/a.jpg": nil,
+			},
+			url: "https://s3.example.com",
+		},
+	})
+}
+
+func TestApiAlbumList(t *testing.T) {
+	controller := newApiTestController()
+
+	r := httptest.NewRequest(http.MethodGet, "/api/client/albums", nil)
+	w := httptest.NewRecorder()
+
+	controller.ApiAlbumList(w, withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+
+	albums := []map[string]any{}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &albums); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+
+	if len(albums) != 1 || albums[0]["name"] != "Summer Wedding" {
+		t.Fatalf("albums = %v, want only the client's own album", albums)
+	}
+
+	wantKeys := []string{"client", "favorites", "id", "images", "name", "posterImageURL", "posterYPos", "shootDate"}
+
+	if got := sortedKeys(albums[0]); !slices.Equal(got, wantKeys) {
+		t.Errorf("album keys = %v, want %v", got, wantKeys)
+	}
+}
+
+func TestApiAlbumDetail(t *testing.T) {
+	controller := newApiTestController()
+	client := &models.Client{BaseModel: models.BaseModel{ID: 1}}
+
+	tests := []struct {
+		name       string
+		albumID    string
+		wantStatus int
+	}{
+		{name: "own album", albumID: "2", wantStatus: http.StatusOK},
+		{name: "another client's album", albumID: "3", wantStatus: http.StatusNotFound},
+		{name: "missing album", albumID: "4", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/client/albums/"+tt.albumID, nil)
+			r.SetPathValue("id", tt.albumID)
+
+			w := httptest.NewRecorder()
+			controller.ApiAlbumDetail(w, withClient(r, client))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if got := w.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/client/albums/2", nil)
+	r.SetPathValue("id", "2")
+
+	w := httptest.NewRecorder()
+	controller.ApiAlbumDetail(w, withClient(r, client))
+
+	album := struct {
+		ID     uint `json:"id"`
+		Images []struct {
+			ThumbnailURL string `json:"thumbnailURL"`
+			OriginalURL  string `json:"originalURL"`
+			IsFavorite   bool   `json:"isFavorite"`
+		} `json:"images"`
+	}{}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &album); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+
+	if album.ID != 2 || len(album.Images) != 2 {
+		t.Fatalf("album = %+v, want album 2 with two images", album)
+	}
+
+	a, b := album.Images[0], album.Images[1]
+
+	if a.ThumbnailURL != "https://s3.example.com/clients/1/2/thumbnails/a.jpg" || a.OriginalURL != "https://s3.example.com/clients/1/2/originals/a.jpg" || a.IsFavorite {
+		t.Errorf("images[0] = %+v", a)
+	}
+
+	// b.jpg has no thumbnail yet, so it is rendered on demand
+	if b.ThumbnailURL != "/client/thumb?key=clients%2F1%2F2%2Foriginals%2Fb.jpg" || !b.IsFavorite {
+		t.Errorf("images[1] = %+v", b)
+	}
+}
+
+func TestAlbumViewModelCarriesImageDimensions(t *testing.T) {
+	dimensions, _ := json.Marshal(cache.ImageDimensions{
+		"a.jpg": {Width: 1200, Height: 800},
+	})
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		S3Client: fakeS3Client{
+			objects: map[string][]byte{
+				"clients/1/2/originals/a.jpg": []byte("original a"),
+				"clients/1/2/originals/b.jpg": []byte("b"),
+				"clients/1/2/dimensions.json": dimensions,
+			},
+			url: "https://s3.example.com",
+		},
+	})
+
+	album := &models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Name: "Summer Wedding", Purchased: true}
+	result, err := controller.convertAlbumToViewModel(context.Background(), album, true)
+
+	if err != nil {
+		t.Fatalf("convertAlbumToViewModel returned an error: %v", err)
+	}
+
+	if len(result.ImageURLs) != 2 {
+		t.Fatalf("images = %+v, want two", result.ImageURLs)
+	}
+
+	a, b := result.ImageURLs[0], result.ImageURLs[1]
+
+	if a.Width != 1200 || a.Height != 800 || a.SizeBytes != int64(len("original a")) {
+		t.Errorf("a.jpg = %dx%d, %d bytes; want 1200x800, %d bytes", a.Width, a.Height, a.SizeBytes, len("original a"))
+	}
+
+	// The cache run hasn't read b.jpg yet, but its size is in the listing
+	if b.Width != 0 || b.Height != 0 || b.SizeBytes != 1 {
+		t.Errorf("b.jpg = %dx%d, %d bytes; want no dimensions, 1 byte", b.Width, b.Height, b.SizeBytes)
+	}
+
+	// Without a sidecar every image has zeroes
+	controller.s3Client = fakeS3Client{objects: map[string][]byte{"clients/1/2/originals/a.jpg": nil}}
+	result, _ = controller.convertAlbumToViewModel(context.Background(), album, true)
+
+	if len(result.ImageURLs) != 1 || result.ImageURLs[0].Width != 0 || result.ImageURLs[0].Height != 0 {
+		t.Errorf("images without a sidecar = %+v, want zero dimensions", result.ImageURLs)
+	}
+}
+
+func TestEditedVersionsMatchTheirOriginals(t *testing.T) {
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		S3Client: fakeS3Client{
+			objects: map[string][]byte{
+				"clients/1/2/originals/a.jpg":     []byte("original"),
+				"clients/1/2/originals/b.jpg":     []byte("original"),
+				"clients/1/2/edited/a.jpg":        []byte("edited"),
+				"clients/1/2/edited/no-match.jpg": []byte("edited"),
+				"clients/1/20/edited/b.jpg":       []byte("another album"),
+			},
+			url: "https://s3.example.com",
+		},
+	})
+
+	tests := []struct {
+		name       string
+		purchased  bool
+		wantEdited []string
+	}{
+		{name: "purchased", purchased: true, wantEdited: []string{"https://s3.example.com/clients/1/2/edited/a.jpg", ""}},
+		{name: "proof", purchased: false, wantEdited: []string{"", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			album := &models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: tt.purchased}
+			result, err := controller.convertAlbumToViewModel(context.Background(), album, true)
+
+			if err != nil {
+				t.Fatalf("convertAlbumToViewModel returned an error: %v", err)
+			}
+
+			// An edit without an original doesn't add an image
+			got := []string{}
+
+			for _, image := range result.ImageURLs {
+				got = append(got, image.EditedURL)
+			}
+
+			if !slices.Equal(got, tt.wantEdited) {
+				t.Errorf("edited URLs = %q, want %q", got, tt.wantEdited)
+			}
+		})
+	}
+}
+
+func TestAlbumImagesGoThroughTheCdn(t *testing.T) {
+	objects := map[string][]byte{
+		"clients/1/2/originals/Beach Day.jpg":  []byte("original"),
+		"clients/1/2/thumbnails/Beach Day.jpg": []byte("thumbnail"),
+		"clients/1/2/thumbnails/poster.jpg":    []byte("poster"),
+	}
+
+	tests := []struct {
+		name          string
+		cdnBaseURL    string
+		wantOriginal  string
+		wantThumbnail string
+		wantPoster    string
+	}{
+		{
+			name:          "presigned without a CDN",
+			wantOriginal:  "https://s3.example.com/clients/1/2/originals/Beach Day.jpg",
+			wantThumbnail: "https://s3.example.com/clients/1/2/thumbnails/Beach Day.jpg",
+			wantPoster:    "https://s3.example.com/clients/1/2/thumbnails/poster.jpg",
+		},
+		{
+			name:          "through the CDN",
+			cdnBaseURL:    "https://cdn.example.com/",
+			wantOriginal:  "https://cdn.example.com/clients/1/2/originals/Beach%20Day.jpg",
+			wantThumbnail: "https://cdn.example.com/clients/1/2/thumbnails/Beach%20Day.jpg",
+			wantPoster:    "https://cdn.example.com/clients/1/2/thumbnails/poster.jpg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := NewClientAccessController(ClientAccessControllerConfig{
+				Bucket:            "bucket",
+				CdnBaseURL:        tt.cdnBaseURL,
+				ClientPhotoFolder: "clients",
+				S3Client:          fakeS3Client{objects: objects, url: "https://s3.example.com"},
+			})
+
+			album := &models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, PosterImagePath: "poster.jpg", Purchased: true}
+			result, err := controller.convertAlbumToViewModel(context.Background(), album, true)
+
+			if err != nil {
+				t.Fatalf("convertAlbumToViewModel returned an error: %v", err)
+			}
+
+			if len(result.ImageURLs) != 1 {
+				t.Fatalf("images = %+v, want one", result.ImageURLs)
+			}
+
+			if got := result.ImageURLs[0].OriginalURL; got != tt.wantOriginal {
+				t.Errorf("original URL = %q, want %q", got, tt.wantOriginal)
+			}
+
+			if got := result.ImageURLs[0].ThumbnailURL; got != tt.wantThumbnail {
+				t.Errorf("thumbnail URL = %q, want %q", got, tt.wantThumbnail)
+			}
+
+			if result.PosterImageURL != tt.wantPoster {
+				t.Errorf("poster URL = %q, want %q", result.PosterImageURL, tt.wantPoster)
+			}
+		})
+	}
+}
+
+func TestPreviewUrlsDependOnPurchaseStatus(t *testing.T) {
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		S3Client: fakeS3Client{objects: map[string][]byte{
+			"clients/1/2/originals/a.jpg":  []byte("original"),
+			"clients/1/2/originals/b.jpg":  []byte("original"),
+			"clients/1/2/thumbnails/a.jpg": []byte("thumbnail"),
+			"clients/1/2/thumbnails/b.jpg": []byte("thumbnail"),
+			"clients/1/2/proofs/a.jpg":     []byte("proof"),
+		}, url: "https://s3.example.com"},
+	})
+
+	tests := []struct {
+		name          string
+		purchased     bool
+		wantPoster    string
+		wantThumbnail []string
+		wantOriginal  []string
+		wantDownload  bool
+	}{
+		{
+			name:          "purchased",
+			purchased:     true,
+			wantPoster:    "https://s3.example.com/clients/1/2/thumbnails/a.jpg",
+			wantThumbnail: []string{"https://s3.example.com/clients/1/2/thumbnails/a.jpg", "https://s3.example.com/clients/1/2/thumbnails/b.jpg"},
+			wantOriginal:  []string{"https://s3.example.com/clients/1/2/originals/a.jpg", "https://s3.example.com/clients/1/2/originals/b.jpg"},
+			wantDownload:  true,
+		},
+		{
+			// b.jpg has no proof yet, so it is rendered on demand rather than served clean
+			name:          "not purchased",
+			wantPoster:    "https://s3.example.com/clients/1/2/proofs/a.jpg",
+			wantThumbnail: []string{"https://s3.example.com/clients/1/2/proofs/a.jpg", "/client/thumb?key=clients%2F1%2F2%2Foriginals%2Fb.jpg"},
+			wantOriginal:  []string{"https://s3.example.com/clients/1/2/proofs/a.jpg", "/client/thumb?key=clients%2F1%2F2%2Foriginals%2Fb.jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			album := &models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, PosterImagePath: "a.jpg", AllowDownload: true, Purchased: tt.purchased}
+			result, err := controller.convertAlbumToViewModel(context.Background(), album, true)
+
+			if err != nil {
+				t.Fatalf("convertAlbumToViewModel returned an error: %v", err)
+			}
+
+			if result.PosterImageURL != tt.wantPoster {
+				t.Errorf("poster URL = %q, want %q", result.PosterImageURL, tt.wantPoster)
+			}
+
+			thumbnails := []string{}
+			originals := []string{}
+
+			for _, image := range result.ImageURLs {
+				thumbnails = append(thumbnails, image.ThumbnailURL)
+				originals = append(originals, image.OriginalURL)
+			}
+
+			if !slices.Equal(thumbnails, tt.wantThumbnail) {
+				t.Errorf("thumbnail URLs = %v, want %v", thumbnails, tt.wantThumbnail)
+			}
+
+			if !slices.Equal(originals, tt.wantOriginal) {
+				t.Errorf("original URLs = %v, want %v", originals, tt.wantOriginal)
+			}
+
+			if result.AllowDownload != tt.wantDownload || result.Purchased != tt.purchased {
+				t.Errorf("AllowDownload = %v, Purchased = %v; want %v, %v", result.AllowDownload, result.Purchased, tt.wantDownload, tt.purchased)
+			}
+		})
+	}
+}
+
+func TestAlbumImageUrlsUseTheConfiguredExpiration(t *testing.T) {
+	expiration := time.Duration(0)
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		Bucket:             "bucket",
+		ClientPhotoFolder:  "clients",
+		ImageUrlExpiration: time.Hour * 2,
+		S3Client: fakeS3Client{
+			expiration: &expiration,
+			objects: map[string][]byte{
+				"clients/1/2/originals/a.jpg":  []byte("original"),
+				"clients/1/2/thumbnails/a.jpg": []byte("thumbnail"),
+			},
+		},
+	})
+
+	album := &models.Album{BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true}
+
+	if _, err := controller.convertAlbumToViewModel(context.Background(), album, true); err != nil {
+		t.Fatalf("convertAlbumToViewModel returned an error: %v", err)
+	}
+
+	if expiration != time.Hour*2 {
+		t.Errorf("URL expiration = %s, want 2h", expiration)
+	}
+
+	// The page refreshes its URLs well before they expire
+	if got := controller.imageUrlRefreshSeconds(); got != 5760 {
+		t.Errorf("refresh after %d seconds, want 5760", got)
+	}
+
+	controller.cdnBaseURL = "https://cdn.example.com"
+
+	if got := controller.imageUrlRefreshSeconds(); got != 0 {
+		t.Errorf("refresh after %d seconds with a CDN, want 0", got)
+	}
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := []string{}
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+	return keys
+}
+
+func TestDownloadImageOnlyServesTheClientsOwnKeys(t *testing.T) {
+	const ownKey = "clients/1/2/originals/a.jpg"
+
+	events := &fakeImageEventService{}
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+			2: {BaseModel: models.BaseModel{ID: 2}, ClientID: 1, AllowDownload: true, Purchased: true},
+		}},
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		ImageEventService: events,
+		S3Client: fakeS3Client{objects: map[string][]byte{
+			ownKey:                         []byte("mine"),
+			"clients/10/2/originals/a.jpg": []byte("someone else's"),
+			"clients/2/5/originals/b.jpg":  []byte("someone else's"),
+		}},
+	})
+
+	client := &models.Client{BaseModel: models.BaseModel{ID: 1}}
+
+	tests := []struct {
+		name       string
+		key        string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "own key", key: ownKey, wantStatus: http.StatusOK, wantBody: "mine"},
+		{name: "another client's key", key: "clients/2/5/originals/b.jpg", wantStatus: http.StatusForbidden},
+		{name: "client ID that starts with their own", key: "clients/10/2/originals/a.jpg", wantStatus: http.StatusForbidden},
+		{name: "path traversal out of their folder", key: "clients/1/../2/5/originals/b.jpg", wantStatus: http.StatusForbidden},
+		{name: "no key", key: "", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/client/download?key="+url.QueryEscape(tt.key), nil)
+			w := httptest.NewRecorder()
+
+			controller.DownloadImage(w, withClient(r, client))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	if recorded := events.recorded(); len(recorded) != 1 || recorded[0].ImagePath != "a.jpg" {
+		t.Errorf("recorded = %+v, want only the download of the client's own image", recorded)
+	}
+}
+
+func TestDownloadImageDisposition(t *testing.T) {
+	const key = "clients/1/2/originals/a.jpg"
+
+	tests := []struct {
+		name            string
+		disposition     string
+		wantStatus      int
+		wantDisposition string
+		wantEvent       string
+	}{
+		{name: "default", wantStatus: http.StatusOK, wantDisposition: "attachment; filename=a.jpg", wantEvent: models.ImageEventDownload},
+		{name: "attachment", disposition: "attachment", wantStatus: http.StatusOK, wantDisposition: "attachment; filename=a.jpg", wantEvent: models.ImageEventDownload},
+		{name: "inline", disposition: "inline", wantStatus: http.StatusOK, wantDisposition: "inline; filename=a.jpg", wantEvent: models.ImageEventView},
+		{name: "anything else", disposition: "form-data", wantStatus: http.StatusBadRequest},
+		{name: "case matters", disposition: "Inline", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := &fakeImageEventService{}
+
+			controller := NewClientAccessController(ClientAccessControllerConfig{
+				AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+					2: {BaseModel: models.BaseModel{ID: 2}, ClientID: 1, AllowDownload: true, Purchased: true},
+				}},
+				Bucket:            "bucket",
+				ClientPhotoFolder: "clients",
+				ImageEventService: events,
+				S3Client:          fakeS3Client{objects: map[string][]byte{key: []byte("image")}},
+			})
+
+			query := url.Values{"key": {key}}
+
+			if tt.disposition != "" {
+				query.Set("disposition", tt.disposition)
+			}
+
+			w := httptest.NewRecorder()
+			controller.DownloadImage(w, withClient(httptest.NewRequest(http.MethodGet, "/client/download-image?"+query.Encode(), nil), &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if got := w.Header().Get("Content-Disposition"); got != tt.wantDisposition {
+				t.Errorf("Content-Disposition = %q, want %q", got, tt.wantDisposition)
+			}
+
+			recorded := events.recorded()
+
+			if tt.wantEvent == "" {
+				if len(recorded) != 0 {
+					t.Errorf("recorded = %+v, want nothing for a refused request", recorded)
+				}
+
+				return
+			}
+
+			if len(recorded) != 1 || recorded[0].EventType != tt.wantEvent {
+				t.Errorf("recorded = %+v, want one %s", recorded, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestGetFavoritesOnlyCountsImagesThatStillExist(t *testing.T) {
+	favorite := func(imagePath string) models.Favorite {
+		return models.Favorite{ClientID: 1, AlbumID: 2, ImagePath: imagePath}
+	}
+
+	tests := []struct {
+		name      string
+		favorites []models.Favorite
+		wantCount int
+		wantKeys  []string
+	}{
+		{name: "no favorites", wantCount: 0, wantKeys: []string{}},
+		{name: "some favorites", favorites: []models.Favorite{favorite("a.jpg"), favorite("b.jpg")}, wantCount: 2, wantKeys: []string{"a.jpg", "b.jpg"}},
+		{name: "orphaned favorite", favorites: []models.Favorite{favorite("a.jpg"), favorite("deleted.jpg")}, wantCount: 1, wantKeys: []string{"a.jpg"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := NewClientAccessController(ClientAccessControllerConfig{
+				AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+					2: {BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Favorites: tt.favorites, Purchased: true},
+				}},
+				Bucket:            "bucket",
+				ClientPhotoFolder: "clients",
+				S3Client: fakeS3Client{objects: map[string][]byte{
+					"clients/1/2/originals/a.jpg": nil,
+					"clients/1/2/originals/b.jpg": nil,
+					"clients/1/2/originals/c.jpg": nil,
+				}},
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/client/library/2/favorites", nil)
+			r.SetPathValue("albumid", "2")
+
+			w := httptest.NewRecorder()
+			controller.GetFavorites(w, withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+
+			got := struct {
+				Count int      `json:"count"`
+				Keys  []string `json:"keys"`
+			}{}
+
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+
+			if got.Count != tt.wantCount || !slices.Equal(got.Keys, tt.wantKeys) {
+				t.Errorf("favorites = %+v, want count %d and keys %v", got, tt.wantCount, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestToggleFavoritePastTheLimit(t *testing.T) {
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+			2: {
+				BaseModel:    models.BaseModel{ID: 2},
+				ClientID:     1,
+				Favorites:    []models.Favorite{{ClientID: 1, AlbumID: 2, ImagePath: "a.jpg"}},
+				MaxFavorites: sql.NullInt64{Int64: 1, Valid: true},
+			},
+		}},
+	})
+
+	tests := []struct {
+		name       string
+		key        string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "new favorite", key: "b.jpg", wantStatus: http.StatusConflict, wantBody: i18n.Translate(i18n.DefaultLocale, i18n.FavoritesLimitReached, 1)},
+		{name: "un-favoriting", key: "a.jpg", wantStatus: http.StatusOK, wantBody: "<i class='icon icon-empty-heart'></i>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/client/library/2/toggle-favorite?key="+tt.key, nil)
+			r.SetPathValue("albumid", "2")
+
+			w := httptest.NewRecorder()
+			controller.ToggleFavorite(w, withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if got := strings.TrimSpace(w.Body.String()); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestPresignedDownloads(t *testing.T) {
+	const (
+		imageKey = "clients/1/2/originals/a.jpg"
+		zipKey   = "clients/1/2/downloads/album-2.zip"
+	)
+
+	objects := map[string][]byte{
+		imageKey: []byte("image"),
+		zipKey:   []byte("zip"),
+	}
+
+	albums := fakeAlbumService{albums: map[uint]*models.Album{
+		2: {BaseModel: models.BaseModel{ID: 2}, ClientID: 1, AllowDownload: true, Purchased: true},
+	}}
+
+	zipToken := services.SignDownloadToken("secret", services.DownloadToken{AlbumID: 2, ClientID: 1, ExpiresAt: time.Now().Add(time.Hour), Filename: "album-2.zip"})
+
+	newRequest := func(target string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.SetPathValue("token", zipToken)
+
+		return withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}})
+	}
+
+	handlers := []struct {
+		name    string
+		target  string
+		key     string
+		body    string
+		handler func(ClientAccessController) http.HandlerFunc
+	}{
+		{name: "image", target: "/client/download?key=" + imageKey, key: imageKey, body: "image", handler: func(c ClientAccessController) http.HandlerFunc { return c.DownloadImage }},
+		{name: "zip", target: "/client/zips/" + zipToken, key: zipKey, body: "zip", handler: func(c ClientAccessController) http.HandlerFunc { return c.DownloadZipByToken }},
+	}
+
+	for _, h := range handlers {
+		t.Run(h.name+" redirects when enabled", func(t *testing.T) {
+			var expiration time.Duration
+
+			controller := NewClientAccessController(ClientAccessControllerConfig{
+				AlbumService:           albums,
+				Bucket:                 "bucket",
+				ClientPhotoFolder:      "clients",
+				DownloadTokenSecret:    "secret",
+				ImageEventService:      &fakeImageEventService{},
+				PresignedUrlExpiration: 5 * time.Minute,
+				S3Client:               fakeS3Client{expiration: &expiration, objects: objects, url: "https://s3.example.com"},
+				UsePresignedDownloads:  true,
+				ZipService:             fakeZipService{},
+			})
+
+			w := httptest.NewRecorder()
+			h.handler(controller)(w, newRequest(h.target))
+
+			if w.Code != http.StatusFound {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+			}
+
+			if got, want := w.Header().Get("Location"), "https://s3.example.com/"+h.key; got != want {
+				t.Errorf("Location = %q, want %q", got, want)
+			}
+
+			if expiration != 5*time.Minute {
+				t.Errorf("presigned URL expires in %v, want %v", expiration, 5*time.Minute)
+			}
+		})
+
+		t.Run(h.name+" streams when disabled", func(t *testing.T) {
+			controller := NewClientAccessController(ClientAccessControllerConfig{
+				AlbumService:        albums,
+				Bucket:              "bucket",
+				ClientPhotoFolder:   "clients",
+				DownloadTokenSecret: "secret",
+				ImageEventService:   &fakeImageEventService{},
+				S3Client:            fakeS3Client{objects: objects},
+				ZipService:          fakeZipService{},
+			})
+
+			w := httptest.NewRecorder()
+			h.handler(controller)(w, newRequest(h.target))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+
+			if w.Body.String() != h.body {
+				t.Errorf("body = %q, want %q", w.Body.String(), h.body)
+			}
+		})
+	}
+}
+
+func TestDownloadZipTakesTheAlbumFromTheRoute(t *testing.T) {
+	filenames := []string{
+		"Session-2 Part-3.zip",
+		"2023-wedding-17.zip",
+		"album.zip",
+	}
+
+	objects := map[string][]byte{}
+
+	for _, filename := range filenames {
+		objects["clients/1/5/downloads/"+filename] = []byte(filename)
+	}
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		Bucket:              "bucket",
+		ClientPhotoFolder:   "clients",
+		DownloadTokenSecret: "secret",
+		ImageEventService:   &fakeImageEventService{},
+		S3Client:            fakeS3Client{objects: objects},
+		ZipService:          fakeZipService{},
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /client/library/{albumid}/downloads/{filename}", controller.DownloadZip)
+	mux.HandleFunc("GET /client/zips/{token}", controller.DownloadZipByToken)
+
+	client := &models.Client{BaseModel: models.BaseModel{ID: 1}}
+
+	for _, filename := range filenames {
+		t.Run(filename, func(t *testing.T) {
+			r := withClient(httptest.NewRequest(http.MethodGet, "/client/library/5/downloads/"+url.PathEscape(filename), nil), client)
+			w := httptest.NewRecorder()
+
+			mux.ServeHTTP(w, r)
+
+			// The guessable filename link never serves the zip itself
+			if w.Code != http.StatusFound || w.Body.String() == filename {
+				t.Fatalf("status = %d, body = %q; want a redirect rather than the zip", w.Code, w.Body.String())
+			}
+
+			location := w.Header().Get("Location")
+
+			if !strings.HasPrefix(location, "/client/zips/") {
+				t.Fatalf("Location = %q, want a token download link", location)
+			}
+
+			r = withClient(httptest.NewRequest(http.MethodGet, location, nil), client)
+			w = httptest.NewRecorder()
+
+			mux.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+
+			if w.Body.String() != filename {
+				t.Errorf("body = %q, want the zip stored under album 5", w.Body.String())
+			}
+		})
+	}
+
+	t.Run("another client's zip", func(t *testing.T) {
+		r := withClient(httptest.NewRequest(http.MethodGet, "/client/library/5/downloads/album.zip", nil), &models.Client{BaseModel: models.BaseModel{ID: 2}})
+		w := httptest.NewRecorder()
+
+		mux.ServeHTTP(w, r)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("not a zip", func(t *testing.T) {
+		r := withClient(httptest.NewRequest(http.MethodGet, "/client/library/5/downloads/album.txt", nil), client)
+		w := httptest.NewRecorder()
+
+		mux.ServeHTTP(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestDownloadZipByToken(t *testing.T) {
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		Bucket:              "bucket",
+		ClientPhotoFolder:   "clients",
+		DownloadTokenSecret: "secret",
+		ImageEventService:   &fakeImageEventService{},
+		S3Client:            fakeS3Client{objects: map[string][]byte{"clients/1/5/downloads/Wedding-5.zip": []byte("zip")}},
+		ZipService:          fakeZipService{},
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /client/zips/{token}", controller.DownloadZipByToken)
+
+	wedding := services.DownloadToken{AlbumID: 5, ClientID: 1, ExpiresAt: time.Now().Add(time.Hour), Filename: "Wedding-5.zip"}
+	valid := services.SignDownloadToken("secret", wedding)
+
+	expired := wedding
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name       string
+		clientID   uint
+		token      string
+		wantStatus int
+	}{
+		{name: "valid token", clientID: 1, token: valid, wantStatus: http.StatusOK},
+		{name: "expired token", clientID: 1, token: services.SignDownloadToken("secret", expired), wantStatus: http.StatusForbidden},
+		{name: "tampered token", clientID: 1, token: "x" + valid[1:], wantStatus: http.StatusForbidden},
+		{name: "another client's token", clientID: 2, token: valid, wantStatus: http.StatusForbidden},
+		{name: "a filename instead of a token", clientID: 1, token: "Wedding-5.zip", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := withClient(httptest.NewRequest(http.MethodGet, "/client/zips/"+url.PathEscape(tt.token), nil), &models.Client{BaseModel: models.BaseModel{ID: tt.clientID}})
+			w := httptest.NewRecorder()
+
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if tt.wantStatus == http.StatusOK && w.Body.String() != "zip" {
+				t.Errorf("body = %q, want the zip the token names", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestLegacyDownloadZipRedirects(t *testing.T) {
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+			5: {BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Purchased: true},
+			6: {BaseModel: models.BaseModel{ID: 6}, ClientID: 2, Purchased: true},
+		}},
+		ImageEventService: &fakeImageEventService{},
+		ZipService:        fakeZipService{},
+	})
+
+	tests := []struct {
+		name         string
+		filename     string
+		wantStatus   int
+		wantLocation string
+	}{
+		{name: "own album", filename: "wedding-5.zip", wantStatus: http.StatusMovedPermanently, wantLocation: "/client/library/5/downloads/wedding-5.zip"},
+		{name: "another client's album", filename: "wedding-6.zip", wantStatus: http.StatusNotFound},
+		{name: "no album ID", filename: "wedding.zip", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/client/downloads/"+tt.filename, nil)
+			r.SetPathValue("filename", tt.filename)
+
+			w := httptest.NewRecorder()
+			controller.LegacyDownloadZip(w, withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestDownloadZipExpiredMissingAndValid(t *testing.T) {
+	objects := map[string][]byte{
+		"clients/1/5/downloads/album.zip": []byte("zip"),
+	}
+
+	tests := []struct {
+		name       string
+		filename   string
+		expired    bool
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "valid", filename: "album.zip", wantStatus: http.StatusFound, wantBody: "/client/zips/"},
+		{name: "expired", filename: "album.zip", expired: true, wantStatus: http.StatusGone, wantBody: "pages/clientaccess/download-expired"},
+		{name: "missing", filename: "other.zip", wantStatus: http.StatusNotFound, wantBody: "Download file not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := NewClientAccessController(ClientAccessControllerConfig{
+				Bucket:            "bucket",
+				ClientPhotoFolder: "clients",
+				ImageEventService: &fakeImageEventService{},
+				Renderer:          fakeRenderer{},
+				S3Client:          fakeS3Client{objects: objects},
+				ZipService:        fakeZipService{expired: tt.expired},
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/client/library/5/downloads/"+tt.filename, nil)
+			r.SetPathValue("albumid", "5")
+			r.SetPathValue("filename", tt.filename)
+
+			w := httptest.NewRecorder()
+			controller.DownloadZip(w, withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	objects := map[string][]byte{
+		"clients/1/2/originals/cached.jpg":   []byte("cached original"),
+		"clients/1/2/thumbnails/cached.jpg":  []byte("cached thumbnail"),
+		"clients/1/2/originals/uncached.jpg": []byte("uncached original"),
+		"clients/10/2/originals/someone.jpg": []byte("someone else's original"),
+		"clients/1/2/downloads/album-2.zip":  []byte("zip"),
+	}
+
+	tests := []struct {
+		name         string
+		key          string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+		wantStored   string
+	}{
+		{name: "cache hit", key: "clients/1/2/originals/cached.jpg", wantStatus: http.StatusFound, wantLocation: "https://s3.example.com/clients/1/2/thumbnails/cached.jpg"},
+		{name: "cache miss", key: "clients/1/2/originals/uncached.jpg", wantStatus: http.StatusOK, wantBody: "thumbnail of uncached original", wantStored: "clients/1/2/thumbnails/uncached.jpg"},
+		{name: "missing original", key: "clients/1/2/originals/missing.jpg", wantStatus: http.StatusNotFound},
+		{name: "another client's image", key: "clients/10/2/originals/someone.jpg", wantStatus: http.StatusForbidden},
+		{name: "not an original", key: "clients/1/2/downloads/album-2.zip", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheCreator := &fakeCacheCreator{}
+
+			controller := NewClientAccessController(ClientAccessControllerConfig{
+				AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+					2: {BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true},
+				}},
+				Bucket:            "bucket",
+				CacheCreator:      cacheCreator,
+				ClientPhotoFolder: "clients",
+				ImageEventService: &fakeImageEventService{},
+				S3Client:          fakeS3Client{objects: objects, url: "https://s3.example.com"},
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/client/thumb?key="+url.QueryEscape(tt.key), nil)
+			w := httptest.NewRecorder()
+
+			controller.Thumbnail(w, withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+
+			if tt.wantBody != "" {
+				if got := w.Header().Get("Content-Type"); got != "image/jpeg" {
+					t.Errorf("Content-Type = %q, want image/jpeg", got)
+				}
+
+				if w.Body.String() != tt.wantBody {
+					t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+				}
+			}
+
+			stored := cacheCreator.storedThumbnails()
+
+			if tt.wantStored == "" {
+				if len(stored) != 0 {
+					t.Errorf("stored thumbnails %v, want none", slices.Collect(maps.Keys(stored)))
+				}
+
+				return
+			}
+
+			if string(stored[tt.wantStored]) != tt.wantBody {
+				t.Errorf("stored %q at %s, want the served thumbnail", stored[tt.wantStored], tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestThumbnailInAnotherFormat(t *testing.T) {
+	cacheCreator := &fakeCacheCreator{}
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+			2: {BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Purchased: true},
+		}},
+		Bucket:            "bucket",
+		CacheCreator:      cacheCreator,
+		ClientPhotoFolder: "clients",
+		ImageEventService: &fakeImageEventService{},
+		S3Client: fakeS3Client{objects: map[string][]byte{
+			"clients/1/2/originals/cached.jpg":       []byte("cached original"),
+			"clients/1/2/thumbnails/cached.jpg":      []byte("old JPEG thumbnail"),
+			"clients/1/2/thumbnails/cached.jpg.webp": []byte("cached thumbnail"),
+			"clients/1/2/originals/uncached.jpg":     []byte("uncached original"),
+			"clients/1/2/thumbnails/uncached.jpg":    []byte("old JPEG thumbnail"),
+		}, url: "https://s3.example.com"},
+		ThumbnailFormat: cache.ThumbnailFormat{Name: "webp", ContentType: "image/webp", Suffix: ".webp"},
+	})
+
+	client := &models.Client{BaseModel: models.BaseModel{ID: 1}}
+
+	r := httptest.NewRequest(http.MethodGet, "/client/thumb?key="+url.QueryEscape("clients/1/2/originals/cached.jpg"), nil)
+	w := httptest.NewRecorder()
+
+	controller.Thumbnail(w, withClient(r, client))
+
+	if got := w.Header().Get("Location"); w.Code != http.StatusFound || got != "https://s3.example.com/clients/1/2/thumbnails/cached.jpg.webp" {
+		t.Errorf("cache hit = %d %q, want a redirect to the WebP thumbnail", w.Code, got)
+	}
+
+	// An old JPEG thumbnail isn't served in place of the configured format
+	r = httptest.NewRequest(http.MethodGet, "/client/thumb?key="+url.QueryEscape("clients/1/2/originals/uncached.jpg"), nil)
+	w = httptest.NewRecorder()
+
+	controller.Thumbnail(w, withClient(r, client))
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/webp" {
+		t.Errorf("cache miss = %d %q, want a freshly rendered image/webp", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	if _, ok := cacheCreator.storedThumbnails()["clients/1/2/thumbnails/uncached.jpg.webp"]; !ok {
+		t.Errorf("stored %v, want the WebP thumbnail key", slices.Collect(maps.Keys(cacheCreator.storedThumbnails())))
+	}
+}
+
+func TestUnpurchasedAlbumsServeWatermarkedProofs(t *testing.T) {
+	objects := map[string][]byte{
+		"clients/1/2/originals/cached.jpg":    []byte("cached original"),
+		"clients/1/2/thumbnails/cached.jpg":   []byte("clean thumbnail"),
+		"clients/1/2/proofs/cached.jpg":       []byte("cached proof"),
+		"clients/1/2/originals/uncached.jpg":  []byte("uncached original"),
+		"clients/1/2/thumbnails/uncached.jpg": []byte("clean thumbnail"),
+	}
+
+	cacheCreator := &fakeCacheCreator{}
+	events := &fakeImageEventService{}
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+			2: {BaseModel: models.BaseModel{ID: 2}, ClientID: 1, AllowDownload: true},
+		}},
+		Bucket:            "bucket",
+		CacheCreator:      cacheCreator,
+		ClientPhotoFolder: "clients",
+		ImageEventService: events,
+		S3Client:          fakeS3Client{objects: objects, url: "https://s3.example.com"},
+	})
+
+	client := &models.Client{BaseModel: models.BaseModel{ID: 1}}
+
+	r := httptest.NewRequest(http.MethodGet, "/client/thumb?key="+url.QueryEscape("clients/1/2/originals/cached.jpg"), nil)
+	w := httptest.NewRecorder()
+
+	controller.Thumbnail(w, withClient(r, client))
+
+	if got := w.Header().Get("Location"); w.Code != http.StatusFound || got != "https://s3.example.com/clients/1/2/proofs/cached.jpg" {
+		t.Errorf("cache hit = %d %q, want a redirect to the proof", w.Code, got)
+	}
+
+	// A clean thumbnail from before the album was unpurchased isn't served
+	r = httptest.NewRequest(http.MethodGet, "/client/thumb?key="+url.QueryEscape("clients/1/2/originals/uncached.jpg"), nil)
+	w = httptest.NewRecorder()
+
+	controller.Thumbnail(w, withClient(r, client))
+
+	if w.Code != http.StatusOK || w.Body.String() != "proof of uncached original" {
+		t.Errorf("cache miss = %d %q, want a freshly rendered proof", w.Code, w.Body.String())
+	}
+
+	if got := string(cacheCreator.storedThumbnails()["clients/1/2/proofs/uncached.jpg"]); got != "proof of uncached original" {
+		t.Errorf("stored %v, want the proof under proofs/", slices.Collect(maps.Keys(cacheCreator.storedThumbnails())))
+	}
+
+	// Opening the original shows the proof instead
+	r = httptest.NewRequest(http.MethodGet, "/client/view-image?key=clients/1/2/originals/cached.jpg", nil)
+	w = httptest.NewRecorder()
+
+	controller.ViewImage(w, withClient(r, client))
+
+	if got := w.Header().Get("Location"); w.Code != http.StatusFound || got != "/client/thumb?key=clients%2F1%2F2%2Foriginals%2Fcached.jpg" {
+		t.Errorf("view image = %d %q, want a redirect to the proof", w.Code, got)
+	}
+
+	if len(events.recorded()) != 1 {
+		t.Errorf("recorded %+v, want the view", events.recorded())
+	}
+
+	// And the original can't be downloaded
+	r = httptest.NewRequest(http.MethodGet, "/client/download-image?key=clients/1/2/originals/cached.jpg", nil)
+	w = httptest.NewRecorder()
+
+	controller.DownloadImage(w, withClient(r, client))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("download image = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestFormatExpiresIn(t *testing.T) {
+	tests := []struct {
+		remaining time.Duration
+		want      string
+	}{
+		{remaining: -time.Minute, want: "Expired"},
+		{remaining: 30 * time.Minute, want: "in less than an hour"},
+		{remaining: 5 * time.Hour, want: "in 5 hours"},
+		{remaining: 30 * time.Hour, want: "in 1 day"},
+		{remaining: 6*24*time.Hour + time.Hour, want: "in 6 days"},
+	}
+
+	for _, tt := range tests {
+		if got := formatExpiresIn(tt.remaining); got != tt.want {
+			t.Errorf("formatExpiresIn(%v) = %q, want %q", tt.remaining, got, tt.want)
+		}
+	}
+}
+
+func TestFormatFileSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{size: 512, want: "512 B"},
+		{size: 1536, want: "1.5 KB"},
+		{size: 5 * 1024 * 1024, want: "5.0 MB"},
+		{size: 3 * 1024 * 1024 * 1024, want: "3.0 GB"},
+	}
+
+	for _, tt := range tests {
+		if got := formatFileSize(tt.size); got != tt.want {
+			t.Errorf("formatFileSize(%d) = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestAddCommentEscapesHtml(t *testing.T) {
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+			5: {BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Purchased: true},
+			6: {BaseModel: models.BaseModel{ID: 6}, ClientID: 2, Purchased: true},
+		}},
+		ImageEventService: &fakeImageEventService{},
+	})
+
+	tests := []struct {
+		name       string
+		albumID    string
+		body       string
+		key        string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "html in the comment", albumID: "5", key: "a.jpg", body: `<script>alert("hi")</script>`, wantStatus: http.StatusOK, wantBody: `&lt;script&gt;alert(&#34;hi&#34;)&lt;/script&gt;`},
+		{name: "empty comment", albumID: "5", key: "a.jpg", body: "   ", wantStatus: http.StatusBadRequest},
+		{name: "no image", albumID: "5", body: "nice", wantStatus: http.StatusBadRequest},
+		{name: "another client's album", albumID: "6", key: "a.jpg", body: "nice", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"key": {tt.key}, "body": {tt.body}}
+			r := httptest.NewRequest(http.MethodPost, "/client/library/"+tt.albumID+"/comment", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.SetPathValue("albumid", tt.albumID)
+
+			w := httptest.NewRecorder()
+			controller.AddComment(w, withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if tt.wantBody == "" {
+				return
+			}
+
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", w.Body.String(), tt.wantBody)
+			}
+
+			if strings.Contains(w.Body.String(), "<script>") {
+				t.Errorf("body = %q, contains unescaped HTML", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestLoginRememberMeExtendsTheCookie(t *testing.T) {
+	gob.Register(&models.Client{})
+
+	shortTTL := 24 * time.Hour
+	rememberTTL := 30 * 24 * time.Hour
+
+	cookieStore := sessions.NewCookieStore("test-secret-test-secret-test-sec")
+	cookieStore.MaxAge(int(rememberTTL.Seconds()))
+	cookieStore.Options.MaxAge = int(shortTTL.Seconds())
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		ClientService:      fakeClientService{},
+		ImageEventService:  &fakeImageEventService{},
+		SessionRememberTTL: rememberTTL,
+		SessionService:     sessions.NewSessionWrapper[*models.Client](cookieStore, "test", "client"),
+	})
+
+	tests := []struct {
+		name       string
+		remember   string
+		wantMaxAge int
+	}{
+		{name: "not remembered", wantMaxAge: int(shortTTL.Seconds())},
+		{name: "remembered", remember: "true", wantMaxAge: int(rememberTTL.Seconds())},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"password": {"right"}}
+
+			if tt.remember != "" {
+				form.Set("remember", tt.remember)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/client/login", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			w := httptest.NewRecorder()
+			controller.LoginAction(w, r)
+
+			cookies := w.Result().Cookies()
+
+			if len(cookies) != 1 {
+				t.Fatalf("got %d cookies, want 1", len(cookies))
+			}
+
+			if cookies[0].MaxAge != tt.wantMaxAge {
+				t.Errorf("cookie MaxAge = %d, want %d", cookies[0].MaxAge, tt.wantMaxAge)
+			}
+		})
+	}
+
+	// A later login without remember me goes back to the short lifetime
+	if cookieStore.Options.MaxAge != int(shortTTL.Seconds()) {
+		t.Errorf("store default MaxAge = %d, want it left at %d", cookieStore.Options.MaxAge, int(shortTTL.Seconds()))
+	}
+}
+
+func TestLoginActionRecordsAttempts(t *testing.T) {
+	gob.Register(&models.Client{})
+
+	logins := []models.LoginAudit{}
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		ClientService:     fakeClientService{logins: &logins},
+		ImageEventService: &fakeImageEventService{},
+		Renderer:          fakeRenderer{},
+		SessionService:    sessions.NewSessionWrapper[*models.Client](sessions.NewCookieStore("test-secret-test-secret-test-sec"), "test", "client"),
+		// httptest requests come from 192.0.2.1, standing in for the proxy
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+	})
+
+	login := func(password string) {
+		form := url.Values{"password": {password}}
+		r := httptest.NewRequest(http.MethodPost, "/client/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("User-Agent", "Mozilla/5.0 (test)")
+		r.Header.Set("X-Forwarded-For", "198.51.100.7, 203.0.113.9")
+
+		controller.LoginAction(httptest.NewRecorder(), r)
+	}
+
+	login("not-a-real-code")
+	login("right")
+
+	if len(logins) != 2 {
+		t.Fatalf("recorded %d logins, want 2", len(logins))
+	}
+
+	failed, succeeded := logins[0], logins[1]
+
+	if failed.Outcome != models.LoginOutcomeIncorrectCode || failed.ClientID.Valid || failed.AccessCodeID.Valid {
+		t.Errorf("failed login = %+v, want an incorrect code with no client or access code", failed)
+	}
+
+	if succeeded.Outcome != models.LoginOutcomeSuccess || succeeded.ClientID.Int64 != 1 || succeeded.AccessCodeID.Int64 != 7 {
+		t.Errorf("successful login = %+v, want client 1 with access code 7", succeeded)
+	}
+
+	for _, login := range logins {
+		if login.IPAddress != "203.0.113.9" || login.UserAgent != "Mozilla/5.0 (test)" {
+			t.Errorf("login from %q with %q, want 203.0.113.9 with the request's user agent", login.IPAddress, login.UserAgent)
+		}
+
+		if strings.Contains(fmt.Sprintf("%+v", login), "not-a-real-code") {
+			t.Errorf("login %+v contains the code that was tried", login)
+		}
+	}
+}
+
+func TestRemoteIPOnlyTrustsForwardedForFromProxies(t *testing.T) {
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128")},
+	})
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{name: "direct request spoofing the header", remoteAddr: "203.0.113.50:4242", forwardedFor: "198.51.100.7", want: "203.0.113.50"},
+		{name: "direct request", remoteAddr: "203.0.113.50:4242", want: "203.0.113.50"},
+		{name: "through the proxy", remoteAddr: "10.0.0.2:4242", forwardedFor: "198.51.100.7", want: "198.51.100.7"},
+		{name: "client spoofing through the proxy", remoteAddr: "10.0.0.2:4242", forwardedFor: "1.2.3.4, 198.51.100.7", want: "198.51.100.7"},
+		{name: "through two proxies", remoteAddr: "10.0.0.2:4242", forwardedFor: "198.51.100.7, 10.0.0.3", want: "198.51.100.7"},
+		{name: "proxy without the header", remoteAddr: "10.0.0.2:4242", want: "10.0.0.2"},
+		{name: "ipv6 proxy", remoteAddr: "[::1]:4242", forwardedFor: "2001:db8::7", want: "2001:db8::7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/client/login", nil)
+			r.RemoteAddr = tt.remoteAddr
+
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+
+			if got := controller.remoteIP(r); got != tt.want {
+				t.Errorf("remoteIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientPagesAreTranslated(t *testing.T) {
+	var rendered any
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+			5: {BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Purchased: true},
+		}},
+		ClientService:     fakeClientService{},
+		ImageEventService: &fakeImageEventService{},
+		Renderer:          capturingRenderer{data: &rendered},
+	})
+
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		clientLocale   string
+		wantLocale     string
+	}{
+		{name: "no header", wantLocale: "en"},
+		{name: "spanish header", acceptLanguage: "es-MX,es;q=0.9,en;q=0.8", wantLocale: "es"},
+		{name: "unsupported header", acceptLanguage: "fr-CA,fr;q=0.9", wantLocale: "en"},
+		{name: "client preference beats the header", acceptLanguage: "en-US", clientLocale: "es", wantLocale: "es"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"password": {"wrong"}}
+			r := httptest.NewRequest(http.MethodPost, "/client/login", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set("Accept-Language", tt.acceptLanguage)
+
+			controller.LoginAction(httptest.NewRecorder(), withClient(r, &models.Client{Locale: tt.clientLocale}))
+
+			viewData, ok := rendered.(viewmodels.ClientLogin)
+
+			if !ok {
+				t.Fatalf("rendered %T, want viewmodels.ClientLogin", rendered)
+			}
+
+			if viewData.Locale != tt.wantLocale {
+				t.Errorf("locale = %q, want %q", viewData.Locale, tt.wantLocale)
+			}
+
+			if want := i18n.Translate(tt.wantLocale, i18n.LoginIncorrectPassword); viewData.Message != want {
+				t.Errorf("message = %q, want %q", viewData.Message, want)
+			}
+
+			form = url.Values{"body": {"nice"}}
+			r = httptest.NewRequest(http.MethodPost, "/client/library/5/comment", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set("Accept-Language", tt.acceptLanguage)
+			r.SetPathValue("albumid", "5")
+
+			w := httptest.NewRecorder()
+			controller.AddComment(w, withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}, Locale: tt.clientLocale}))
+
+			if want := i18n.Translate(tt.wantLocale, i18n.CommentImageRequired); !strings.Contains(w.Body.String(), want) {
+				t.Errorf("comment error = %q, want %q", w.Body.String(), want)
+			}
+		})
+	}
+}
+
+func TestNotificationSettings(t *testing.T) {
+	var rendered any
+
+	clientService := fakeClientService{notify: map[uint]bool{1: true}}
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		ClientService: clientService,
+		Renderer:      capturingRenderer{data: &rendered},
+	})
+
+	client := &models.Client{BaseModel: models.BaseModel{ID: 1}, NotifyOnDownload: true}
+
+	r := httptest.NewRequest(http.MethodPost, "/client/settings", strings.NewReader(url.Values{}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	controller.SettingsAction(httptest.NewRecorder(), withClient(r, client))
+
+	if clientService.notify[1] {
+		t.Fatalf("preference after submitting the box unchecked = on, want off")
+	}
+
+	controller.SettingsPage(httptest.NewRecorder(), withClient(httptest.NewRequest(http.MethodGet, "/client/settings", nil), client))
+
+	if viewData := rendered.(viewmodels.ClientSettings); viewData.NotifyOnDownload || viewData.IsError {
+		t.Errorf("settings page = %+v, want notifications shown as off", viewData)
+	}
+
+	form := url.Values{"notifyOnDownload": {"true"}}
+	r = httptest.NewRequest(http.MethodPost, "/client/settings", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	controller.SettingsAction(httptest.NewRecorder(), withClient(r, client))
+
+	if !clientService.notify[1] {
+		t.Errorf("preference after checking the box = off, want on")
+	}
+}
+
+func TestDownloadAllUsesTheCurrentNotificationPreference(t *testing.T) {
+	tests := []struct {
+		name       string
+		notify     map[uint]bool
+		wantNotify bool
+	}{
+		{name: "turned off since logging in", notify: map[uint]bool{1: false}, wantNotify: false},
+		{name: "turned on", notify: map[uint]bool{1: true}, wantNotify: true},
+		{name: "preference can't be read", notify: map[uint]bool{}, wantNotify: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := []*models.Client{}
+
+			controller := NewClientAccessController(ClientAccessControllerConfig{
+				AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+					5: {BaseModel: models.BaseModel{ID: 5}, ClientID: 1, AllowDownload: true, Purchased: true},
+				}},
+				ClientService: fakeClientService{notify: tt.notify},
+				Renderer:      fakeRenderer{},
+				S3Client:      fakeS3Client{},
+				ZipService:    fakeZipService{started: &started},
+			})
+
+			// The session still has the preference from when they logged in
+			client := &models.Client{BaseModel: models.BaseModel{ID: 1}, NotifyOnDownload: !tt.wantNotify}
+
+			r := httptest.NewRequest(http.MethodPost, "/client/library/5/download-all", nil)
+			r.SetPathValue("albumid", "5")
+
+			controller.DownloadAllImagesInAlbum(httptest.NewRecorder(), withClient(r, client))
+
+			if len(started) != 1 {
+				t.Fatalf("started %d zips, want 1", len(started))
+			}
+
+			if started[0].NotifyOnDownload != tt.wantNotify {
+				t.Errorf("zip started with NotifyOnDownload = %v, want %v", started[0].NotifyOnDownload, tt.wantNotify)
+			}
+		})
+	}
+}
+
+func TestDownloadAllReportsTheQueuePosition(t *testing.T) {
+	tests := []struct {
+		name          string
+		queuePosition int
+	}{
+		{name: "started right away", queuePosition: 0},
+		{name: "queued", queuePosition: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rendered any
+
+			controller := NewClientAccessController(ClientAccessControllerConfig{
+				AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+					5: {BaseModel: models.BaseModel{ID: 5}, ClientID: 1, AllowDownload: true, Purchased: true},
+				}},
+				ClientService: fakeClientService{notify: map[uint]bool{1: true}},
+				Renderer:      capturingRenderer{data: &rendered},
+				S3Client:      fakeS3Client{},
+				ZipService:    fakeZipService{queuePosition: tt.queuePosition},
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/client/library/5/download-all", nil)
+			r.SetPathValue("albumid", "5")
+
+			controller.DownloadAllImagesInAlbum(httptest.NewRecorder(), withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+			viewData := rendered.(viewmodels.ClientDownloadStarted)
+
+			if viewData.QueuePosition != tt.queuePosition {
+				t.Errorf("queue position = %d, want %d", viewData.QueuePosition, tt.queuePosition)
+			}
+		})
+	}
+}
+
+func TestDownloadStartedPreviewsTheAlbum(t *testing.T) {
+	var rendered any
+
+	objects := map[string][]byte{}
+
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg", "e.jpg", "f.jpg"} {
+		objects["clients/1/5/originals/"+name] = []byte("original")
+		objects["clients/1/5/proofs/"+name] = []byte("proof")
+	}
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+			5: {
+				BaseModel:       models.BaseModel{ID: 5},
+				ClientID:        1,
+				AllowDownload:   true,
+				PosterImagePath: "c.jpg",
+				// z.jpg has no thumbnail yet, so it is passed over
+				Favorites: []models.Favorite{{ImagePath: "e.jpg"}, {ImagePath: "z.jpg"}, {ImagePath: "c.jpg"}},
+			},
+		}},
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		ClientService:     fakeClientService{notify: map[uint]bool{1: true}},
+		Renderer:          capturingRenderer{data: &rendered},
+		S3Client:          fakeS3Client{objects: objects, url: "https://s3.example.com"},
+		ZipService:        fakeZipService{},
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/client/library/5/download-all", nil)
+	r.SetPathValue("albumid", "5")
+
+	controller.DownloadAllImagesInAlbum(httptest.NewRecorder(), withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+	want := []string{
+		"https://s3.example.com/clients/1/5/proofs/c.jpg",
+		"https://s3.example.com/clients/1/5/proofs/e.jpg",
+		"https://s3.example.com/clients/1/5/proofs/a.jpg",
+		"https://s3.example.com/clients/1/5/proofs/b.jpg",
+	}
+
+	if got := rendered.(viewmodels.ClientDownloadStarted).PreviewThumbnailURLs; !slices.Equal(got, want) {
+		t.Errorf("previews = %v, want the poster, then favorites, then the rest: %v", got, want)
+	}
+}
+
+func TestResendDownloadEmail(t *testing.T) {
+	tests := []struct {
+		name        string
+		resendable  bool
+		wantResent  int
+		wantStarted int
+	}{
+		{name: "zip still available", resendable: true, wantResent: 1},
+		{name: "no zip to resend", resendable: false, wantStarted: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				rendered any
+				resent   []*models.Client
+				started  []*models.Client
+			)
+
+			controller := NewClientAccessController(ClientAccessControllerConfig{
+				AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+					5: {BaseModel: models.BaseModel{ID: 5}, ClientID: 1, AllowDownload: true, Purchased: true},
+				}},
+				Renderer:   capturingRenderer{data: &rendered},
+				S3Client:   fakeS3Client{},
+				ZipService: fakeZipService{resendable: tt.resendable, resent: &resent, started: &started},
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/client/library/5/resend-email", nil)
+			r.SetPathValue("albumid", "5")
+
+			// They turned the emails off, but asking for one again sends it anyway
+			client := &models.Client{BaseModel: models.BaseModel{ID: 1}, Email: "jane@example.com"}
+			controller.ResendDownloadEmail(httptest.NewRecorder(), withClient(r, client))
+
+			if len(resent) != tt.wantResent {
+				t.Errorf("resent %d emails, want %d", len(resent), tt.wantResent)
+			}
+
+			if len(started) != tt.wantStarted {
+				t.Fatalf("started %d zips, want %d", len(started), tt.wantStarted)
+			}
+
+			for _, recipient := range append(resent, started...) {
+				if !recipient.NotifyOnDownload {
+					t.Errorf("recipient NotifyOnDownload = false, want true")
+				}
+			}
+
+			viewData := rendered.(viewmodels.ClientDownloadStarted)
+
+			if viewData.Resent != tt.resendable {
+				t.Errorf("Resent = %v, want %v", viewData.Resent, tt.resendable)
+			}
+		})
+	}
+}
+
+func TestAlbumErrorsMapToTheirStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		albumID    string
+		err        error
+		wantStatus int
+	}{
+		{name: "missing album", albumID: "9", wantStatus: http.StatusNotFound},
+		{name: "another client's album", albumID: "6", wantStatus: http.StatusNotFound},
+		{name: "database failure", albumID: "5", err: errors.New("database is locked"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := NewClientAccessController(ClientAccessControllerConfig{
+				AlbumService: fakeAlbumService{
+					albums: map[uint]*models.Album{
+						5: {BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Purchased: true},
+						6: {BaseModel: models.BaseModel{ID: 6}, ClientID: 2, Purchased: true},
+					},
+					err: tt.err,
+				},
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/api/client/albums/"+tt.albumID+"/favorites", nil)
+			r.SetPathValue("albumid", tt.albumID)
+			w := httptest.NewRecorder()
+
+			controller.GetFavorites(w, withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestViewAlbumGivesUpOnASlowS3(t *testing.T) {
+	var rendered any
+
+	release := make(chan struct{})
+	defer close(release)
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+			2: {BaseModel: models.BaseModel{ID: 2}, ClientID: 1, Name: "Summer Wedding", Purchased: true},
+		}},
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		Renderer:          capturingRenderer{data: &rendered},
+		S3Client: slowS3Client{
+			fakeS3Client: fakeS3Client{objects: map[string][]byte{"clients/1/2/originals/a.jpg": nil}},
+			release:      release,
+		},
+		S3OperationTimeout: time.Millisecond * 20,
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/client/2", nil)
+	r.SetPathValue("id", "2")
+
+	start := time.Now()
+	controller.ViewAlbumPage(httptest.NewRecorder(), withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("album page took %s, want it to give up after the timeout", elapsed)
+	}
+
+	viewData := rendered.(viewmodels.ClientViewAlbum)
+
+	if want := i18n.Translate(i18n.DefaultLocale, i18n.AlbumImagesTimeout); viewData.Message != want || !viewData.IsWarning {
+		t.Errorf("message = %q, warning %v; want %q", viewData.Message, viewData.IsWarning, want)
+	}
+
+	if viewData.Album.Name != "Summer Wedding" || len(viewData.Album.ImageURLs) != 0 {
+		t.Errorf("album = %+v, want the album without images", viewData.Album)
+	}
+}
+
+func TestAlbumListPageGroupsAlbumsByGallery(t *testing.T) {
+	var rendered any
+
+	album := func(id uint, name string) *models.Album {
+		return &models.Album{BaseModel: models.BaseModel{ID: id}, ClientID: 1, Name: name, Purchased: true, AllowDownload: true}
+	}
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		AlbumService: fakeAlbumService{galleries: []models.Gallery{
+			{BaseModel: models.BaseModel{ID: 4}, Name: "Wedding", Albums: []*models.Album{album(2, "Reception"), album(1, "Ceremony")}},
+			{BaseModel: models.BaseModel{ID: 5}, Name: "Anniversary", Albums: []*models.Album{}},
+			{Albums: []*models.Album{album(3, "Headshots")}},
+		}},
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		Renderer:          capturingRenderer{data: &rendered},
+		S3Client:          fakeS3Client{objects: map[string][]byte{}},
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/client", nil)
+	w := httptest.NewRecorder()
+	controller.AlbumListPage(w, withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}, Name: "Jane"}))
+
+	viewData, ok := rendered.(viewmodels.ClientAlbumList)
+
+	if !ok {
+		t.Fatalf("rendered %T, want viewmodels.ClientAlbumList", rendered)
+	}
+
+	got := [][]string{}
+
+	for _, gallery := range viewData.Galleries {
+		section := []string{gallery.Name}
+
+		for _, album := range gallery.Albums {
+			section = append(section, album.Name)
+		}
+
+		got = append(got, section)
+	}
+
+	// The empty gallery is left off and ungrouped albums have no heading
+	want := [][]string{{"Wedding", "Reception", "Ceremony"}, {"", "Headshots"}}
+
+	if !slices.EqualFunc(got, want, slices.Equal[[]string]) {
+		t.Errorf("sections = %v, want %v", got, want)
+	}
+
+	if len(viewData.Albums) != 3 {
+		t.Errorf("got %d albums, want all 3", len(viewData.Albums))
+	}
+}
+
+func TestPreviewAlbumPage(t *testing.T) {
+	tests := []struct {
+		name       string
+		clientID   string
+		albumID    string
+		wantStatus int
+	}{
+		{name: "client's album", clientID: "1", albumID: "2", wantStatus: http.StatusOK},
+		{name: "another client's album", clientID: "3", albumID: "2", wantStatus: http.StatusNotFound},
+		{name: "missing album", clientID: "1", albumID: "9", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rendered any
+
+			controller := NewClientAccessController(ClientAccessControllerConfig{
+				AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+					2: {
+						BaseModel: models.BaseModel{ID: 2},
+						ClientID:  1,
+						Client:    models.Client{BaseModel: models.BaseModel{ID: 1}, Name: "Jane"},
+						Name:      "Summer Wedding",
+						Favorites: []models.Favorite{{ClientID: 1, AlbumID: 2, ImagePath: "a.jpg"}},
+						Purchased: true,
+					},
+				}},
+				Bucket:            "bucket",
+				ClientPhotoFolder: "clients",
+				Renderer:          capturingRenderer{data: &rendered},
+				S3Client: fakeS3Client{objects: map[string][]byte{
+					"clients/1/2/originals/a.jpg": nil,
+					"clients/1/2/originals/b.jpg": nil,
+				}},
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/admin/preview/"+tt.clientID+"/"+tt.albumID, nil)
+			r.SetPathValue("clientid", tt.clientID)
+			r.SetPathValue("albumid", tt.albumID)
+
+			// There is no client session behind a preview
+			w := httptest.NewRecorder()
+			controller.PreviewAlbumPage(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if w.Body.String() != "pages/clientaccess/view-album" {
+				t.Errorf("rendered %q, want the client's album page", w.Body.String())
+			}
+
+			viewData := rendered.(viewmodels.ClientViewAlbum)
+
+			if !viewData.Preview || viewData.Client.ID != 1 {
+				t.Errorf("preview = %v for client %d, want a preview for client 1", viewData.Preview, viewData.Client.ID)
+			}
+
+			if viewData.Album.Name != "Summer Wedding" || viewData.Album.Client.Name != "Jane" || len(viewData.Album.ImageURLs) != 2 {
+				t.Errorf("album = %+v, want Jane's album with both images", viewData.Album)
+			}
+
+			if !viewData.Album.ImageURLs[0].IsFavorite || viewData.Album.ImageURLs[1].IsFavorite {
+				t.Errorf("images = %+v, want only a.jpg shown as a favorite", viewData.Album.ImageURLs)
+			}
+		})
+	}
+}
+
+func TestSortImagesByOrder(t *testing.T) {
+	images := func(names ...string) []internalmodels.Image {
+		result := []internalmodels.Image{}
+
+		for _, name := range names {
+			result = append(result, internalmodels.Image{OriginalKey: "Jane/Wedding/" + name})
+		}
+
+		return result
+	}
+
+	order := func(names ...string) []models.ImageOrder {
+		result := []models.ImageOrder{}
+
+		for position, name := range names {
+			result = append(result, models.ImageOrder{AlbumID: 1, ImagePath: name, Position: position})
+		}
+
+		return result
+	}
+
+	tests := []struct {
+		name  string
+		order []models.ImageOrder
+		want  []string
+	}{
+		{name: "ordered", order: order("c.jpg", "a.jpg", "b.jpg"), want: []string{"c.jpg", "a.jpg", "b.jpg"}},
+		{name: "partially ordered", order: order("c.jpg"), want: []string{"c.jpg", "a.jpg", "b.jpg"}},
+		{name: "unordered", order: nil, want: []string{"a.jpg", "b.jpg", "c.jpg"}},
+		{name: "order names a deleted image", order: order("gone.jpg", "b.jpg"), want: []string{"b.jpg", "a.jpg", "c.jpg"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := images("b.jpg", "c.jpg", "a.jpg")
+			sortImagesByOrder(got, tt.order)
+
+			names := []string{}
+
+			for _, image := range got {
+				names = append(names, strings.TrimPrefix(image.OriginalKey, "Jane/Wedding/"))
+			}
+
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("order = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadsAreBlockedForViewOnlyAlbums(t *testing.T) {
+	const key = "clients/1/5/originals/a.jpg"
+
+	started := []*models.Client{}
+	events := &fakeImageEventService{}
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+			5: {BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Name: "Proofs", AllowDownload: false, Purchased: true},
+		}},
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		ClientService:     fakeClientService{notify: map[uint]bool{1: true}},
+		ImageEventService: events,
+		Renderer:          fakeRenderer{},
+		S3Client:          fakeS3Client{objects: map[string][]byte{key: []byte("image")}},
+		ZipService:        fakeZipService{resendable: true, started: &started},
+	})
+
+	tests := []struct {
+		name    string
+		target  string
+		handler func(ClientAccessController) http.HandlerFunc
+	}{
+		{name: "download all", target: "/client/library/5/download-all", handler: func(c ClientAccessController) http.HandlerFunc { return c.DownloadAllImagesInAlbum }},
+		{name: "download estimate", target: "/client/library/5/download-estimate", handler: func(c ClientAccessController) http.HandlerFunc { return c.DownloadEstimate }},
+		{name: "resend download email", target: "/client/library/5/resend-email", handler: func(c ClientAccessController) http.HandlerFunc { return c.ResendDownloadEmail }},
+		{name: "single image", target: "/client/download-image?key=" + url.QueryEscape(key), handler: func(c ClientAccessController) http.HandlerFunc { return c.DownloadImage }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r.SetPathValue("albumid", "5")
+
+			w := httptest.NewRecorder()
+			tt.handler(controller)(w, withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+
+	if len(started) != 0 {
+		t.Errorf("started %d zips, want none", len(started))
+	}
+
+	if recorded := events.recorded(); len(recorded) != 0 {
+		t.Errorf("recorded %+v, want no downloads recorded", recorded)
+	}
+}
+
+func TestDownloadStatusOnlyReportsTheClientsJobs(t *testing.T) {
+	started := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		ZipService: fakeZipService{jobs: []services.ZipJob{
+			{ID: "Engagement-6", AlbumID: 6, AlbumName: "Engagement", ClientID: 1, State: services.ZipJobRunning, FilesDone: 3, FilesTotal: 10, StartedAt: started, UpdatedAt: started},
+			{ID: "Portraits-7", AlbumID: 7, AlbumName: "Portraits", ClientID: 2, State: services.ZipJobCompleted, DownloadURLs: []string{"https://example.com/john.zip"}},
+			{ID: "Wedding-5", AlbumID: 5, AlbumName: "Wedding", ClientID: 1, State: services.ZipJobCompleted, FilesDone: 4, FilesTotal: 4, DownloadURLs: []string{"https://example.com/wedding.zip"}},
+		}},
+	})
+
+	w := httptest.NewRecorder()
+	controller.DownloadStatus(w, withClient(httptest.NewRequest(http.MethodGet, "/client/downloads/status", nil), &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	got := internalmodels.DownloadStatus{}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("error decoding %s: %v", w.Body.String(), err)
+	}
+
+	if got.Total != 2 || got.Completed != 1 || len(got.Jobs) != 2 {
+		t.Fatalf("status = %+v, want 1 of 2 zips prepared", got)
+	}
+
+	want := internalmodels.DownloadJob{
+		ID:         "Engagement-6",
+		AlbumID:    6,
+		AlbumName:  "Engagement",
+		State:      "running",
+		FilesDone:  3,
+		FilesTotal: 10,
+		StartedAt:  "2024-06-01T12:00:00Z",
+		UpdatedAt:  "2024-06-01T12:00:00Z",
+	}
+
+	if !reflect.DeepEqual(got.Jobs[0], want) {
+		t.Errorf("first job = %+v, want %+v", got.Jobs[0], want)
+	}
+
+	if got.Jobs[1].ID != "Wedding-5" || strings.Contains(w.Body.String(), "john.zip") {
+		t.Errorf("jobs = %+v, want only the client's own", got.Jobs)
+	}
+}
+
+func TestDownloadEstimate(t *testing.T) {
+	albums := map[uint]*models.Album{
+		5: {BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Name: "Wedding", AllowDownload: true, Purchased: true},
+		6: {BaseModel: models.BaseModel{ID: 6}, ClientID: 1, Name: "Reception", ExpiresAt: sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true}},
+		7: {BaseModel: models.BaseModel{ID: 7}, ClientID: 2, Name: "Portraits", Purchased: true},
+	}
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		AlbumService:      fakeAlbumService{albums: albums},
+		ImageEventService: &fakeImageEventService{},
+		Renderer:          fakeRenderer{},
+		ZipService:        fakeZipService{fileCount: 340, totalBytes: 1288490189},
+	})
+
+	tests := []struct {
+		name       string
+		albumID    string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "own album", albumID: "5", wantStatus: http.StatusOK, wantBody: `"size":"1.2 GB"`},
+		{name: "expired album", albumID: "6", wantStatus: http.StatusGone},
+		{name: "another client's album", albumID: "7", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/client/library/"+tt.albumID+"/download-estimate", nil)
+			r.SetPathValue("albumid", tt.albumID)
+
+			w := httptest.NewRecorder()
+			controller.DownloadEstimate(w, withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			got := struct {
+				FileCount  int   `json:"fileCount"`
+				TotalBytes int64 `json:"totalBytes"`
+			}{}
+
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("error decoding %s: %v", w.Body.String(), err)
+			}
+
+			if got.FileCount != 340 || got.TotalBytes != 1288490189 {
+				t.Errorf("estimate = %+v, want 340 files and 1288490189 bytes", got)
+			}
+
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
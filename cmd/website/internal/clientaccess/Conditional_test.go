@@ -0,0 +1,142 @@
+package clientaccess
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+)
+
+func TestWriteCacheHeaders(t *testing.T) {
+	lastModified := time.Date(2024, time.June, 1, 12, 0, 0, 500, time.UTC)
+
+	tests := []struct {
+		name            string
+		headers         map[string]string
+		etag            string
+		wantNotModified bool
+	}{
+		{name: "no conditions", etag: "abc"},
+		{name: "matching etag", etag: "abc", headers: map[string]string{"If-None-Match": `"abc"`}, wantNotModified: true},
+		{name: "quoted etag from S3", etag: `"abc"`, headers: map[string]string{"If-None-Match": `"abc"`}, wantNotModified: true},
+		{name: "one of several etags", etag: "abc", headers: map[string]string{"If-None-Match": `"xyz", W/"abc"`}, wantNotModified: true},
+		{name: "any etag", etag: "abc", headers: map[string]string{"If-None-Match": "*"}, wantNotModified: true},
+		{name: "different etag", etag: "abc", headers: map[string]string{"If-None-Match": `"xyz"`}},
+		{name: "not modified since", etag: "abc", headers: map[string]string{"If-Modified-Since": "Sat, 01 Jun 2024 12:00:00 GMT"}, wantNotModified: true},
+		{name: "modified since", etag: "abc", headers: map[string]string{"If-Modified-Since": "Sat, 01 Jun 2024 11:59:59 GMT"}},
+		{name: "bad date", etag: "abc", headers: map[string]string{"If-Modified-Since": "yesterday"}},
+		{
+			name:    "etag wins over date",
+			etag:    "abc",
+			headers: map[string]string{"If-None-Match": `"xyz"`, "If-Modified-Since": "Sat, 01 Jun 2024 12:00:00 GMT"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+
+			w := httptest.NewRecorder()
+
+			if got := writeCacheHeaders(w, r, tt.etag, lastModified); got != tt.wantNotModified {
+				t.Fatalf("writeCacheHeaders = %v, want %v", got, tt.wantNotModified)
+			}
+
+			if tt.wantNotModified && w.Code != http.StatusNotModified {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusNotModified)
+			}
+
+			if got := w.Header().Get("ETag"); got != `"abc"` {
+				t.Errorf("ETag = %s, want \"abc\"", got)
+			}
+
+			if got := w.Header().Get("Last-Modified"); got != "Sat, 01 Jun 2024 12:00:00 GMT" {
+				t.Errorf("Last-Modified = %s, want Sat, 01 Jun 2024 12:00:00 GMT", got)
+			}
+		})
+	}
+}
+
+func TestDownloadsHonorConditionalRequests(t *testing.T) {
+	const (
+		imageKey = "clients/1/5/originals/a.jpg"
+		zipKey   = "clients/1/5/downloads/album.zip"
+	)
+
+	objects := map[string][]byte{
+		imageKey: []byte("image"),
+		zipKey:   []byte("zip"),
+	}
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+			5: {BaseModel: models.BaseModel{ID: 5}, ClientID: 1, AllowDownload: true, Purchased: true},
+		}},
+		Bucket:              "bucket",
+		ClientPhotoFolder:   "clients",
+		DownloadTokenSecret: "secret",
+		ImageEventService:   &fakeImageEventService{},
+		Renderer:            fakeRenderer{},
+		S3Client:            fakeS3Client{objects: objects},
+		ZipService:          fakeZipService{},
+	})
+
+	serveImage := func(w http.ResponseWriter, r *http.Request) {
+		controller.DownloadImage(w, r)
+	}
+
+	zipToken := services.SignDownloadToken("secret", services.DownloadToken{AlbumID: 5, ClientID: 1, ExpiresAt: time.Now().Add(time.Hour), Filename: "album.zip"})
+
+	serveZip := func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("token", zipToken)
+		controller.DownloadZipByToken(w, r)
+	}
+
+	tests := []struct {
+		name        string
+		target      string
+		serve       http.HandlerFunc
+		ifNoneMatch string
+		wantStatus  int
+		wantBody    string
+	}{
+		{name: "image with matching etag", target: "/client/download-image?key=" + url.QueryEscape(imageKey), serve: serveImage, ifNoneMatch: `"` + fakeETag(objects[imageKey]) + `"`, wantStatus: http.StatusNotModified},
+		{name: "image with stale etag", target: "/client/download-image?key=" + url.QueryEscape(imageKey), serve: serveImage, ifNoneMatch: `"stale"`, wantStatus: http.StatusOK, wantBody: "image"},
+		{name: "image without etag", target: "/client/download-image?key=" + url.QueryEscape(imageKey), serve: serveImage, wantStatus: http.StatusOK, wantBody: "image"},
+		{name: "zip with matching etag", target: "/client/zips/" + zipToken, serve: serveZip, ifNoneMatch: `"` + fakeETag(objects[zipKey]) + `"`, wantStatus: http.StatusNotModified},
+		{name: "zip with stale etag", target: "/client/zips/" + zipToken, serve: serveZip, ifNoneMatch: `"stale"`, wantStatus: http.StatusOK, wantBody: "zip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+
+			w := httptest.NewRecorder()
+			tt.serve(w, withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+
+			if w.Header().Get("ETag") == "" || w.Header().Get("Last-Modified") == "" {
+				t.Errorf("headers = %v, want an ETag and Last-Modified", w.Header())
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package clientaccess
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// sniffLength is how much of a body http.DetectContentType looks at
+const sniffLength = 512
+
+/*
+detectContentType returns the Content-Type to serve an object with. S3
+reports whatever type the object was uploaded with, which is nothing or a
+generic binary type when the uploader didn't set one. In those cases the
+start of the body is sniffed instead. The returned reader still yields the
+whole body, including the sniffed bytes.
+*/
+func detectContentType(stored string, body io.Reader) (string, io.Reader, error) {
+	if !isGenericContentType(stored) {
+		return stored, body, nil
+	}
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(body, head)
+
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", body, err
+	}
+
+	head = head[:n]
+	return http.DetectContentType(head), io.MultiReader(bytes.NewReader(head), body), nil
+}
+
+func isGenericContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return true
+	}
+
+	switch mediaType {
+	case "application/octet-stream", "binary/octet-stream", "application/binary":
+		return true
+	}
+
+	return false
+}
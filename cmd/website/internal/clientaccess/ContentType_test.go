@@ -0,0 +1,112 @@
+package clientaccess
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+func testJpeg(t *testing.T) []byte {
+	t.Helper()
+
+	b := &bytes.Buffer{}
+
+	if err := jpeg.Encode(b, image.NewRGBA(image.Rect(0, 0, 64, 64)), nil); err != nil {
+		t.Fatalf("error encoding jpeg: %v", err)
+	}
+
+	return b.Bytes()
+}
+
+func testPng(t *testing.T) []byte {
+	t.Helper()
+
+	b := &bytes.Buffer{}
+
+	if err := png.Encode(b, image.NewRGBA(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatalf("error encoding png: %v", err)
+	}
+
+	return b.Bytes()
+}
+
+func TestDetectContentType(t *testing.T) {
+	jpegData := testJpeg(t)
+	pngData := testPng(t)
+
+	tests := []struct {
+		name   string
+		stored string
+		data   []byte
+		want   string
+	}{
+		{name: "jpeg without a type", stored: "", data: jpegData, want: "image/jpeg"},
+		{name: "png without a type", stored: "", data: pngData, want: "image/png"},
+		{name: "jpeg stored as binary", stored: "application/octet-stream", data: jpegData, want: "image/jpeg"},
+		{name: "png stored as S3's default", stored: "binary/octet-stream", data: pngData, want: "image/png"},
+		{name: "stored type is trusted", stored: "image/heic", data: jpegData, want: "image/heic"},
+		{name: "short body", stored: "", data: []byte("hi"), want: "text/plain; charset=utf-8"},
+		{name: "empty body", stored: "", data: nil, want: "text/plain; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType, body, err := detectContentType(tt.stored, bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("detectContentType returned an error: %v", err)
+			}
+
+			if contentType != tt.want {
+				t.Errorf("content type = %s, want %s", contentType, tt.want)
+			}
+
+			// Sniffing must not eat the start of the body
+			if got, _ := io.ReadAll(body); !bytes.Equal(got, tt.data) {
+				t.Errorf("body has %d bytes, want the original %d", len(got), len(tt.data))
+			}
+		})
+	}
+}
+
+func TestDownloadImageDetectsTheContentType(t *testing.T) {
+	const key = "clients/1/5/originals/a.jpg"
+
+	data := testJpeg(t)
+
+	// fakeS3Client reports every object as application/octet-stream
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		AlbumService: fakeAlbumService{albums: map[uint]*models.Album{
+			5: {BaseModel: models.BaseModel{ID: 5}, ClientID: 1, AllowDownload: true, Purchased: true},
+		}},
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		ImageEventService: &fakeImageEventService{},
+		S3Client:          fakeS3Client{objects: map[string][]byte{key: data}},
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/client/download-image?key="+url.QueryEscape(key), nil)
+	w := httptest.NewRecorder()
+
+	controller.DownloadImage(w, withClient(r, &models.Client{BaseModel: models.BaseModel{ID: 1}}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "image/jpeg") {
+		t.Errorf("Content-Type = %s, want image/jpeg", got)
+	}
+
+	if !bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("body has %d bytes, want the original %d", w.Body.Len(), len(data))
+	}
+}
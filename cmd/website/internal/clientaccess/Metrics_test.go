@@ -0,0 +1,87 @@
+package clientaccess
+
+import (
+	"encoding/gob"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/adampresley/adamgokit/sessions"
+	"github.com/adampresley/adampresleyphotography/pkg/metrics"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// loginAttempts reads the login counter for result from the registry
+func loginAttempts(t *testing.T, registry *prometheus.Registry, result string) float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("error gathering metrics: %v", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != "photography_auth_login_attempts_total" {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "result" && label.GetValue() == result {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestLoginActionCountsAttempts(t *testing.T) {
+	gob.Register(&models.Client{})
+
+	registry := prometheus.NewRegistry()
+
+	if err := metrics.Register(registry); err != nil {
+		t.Fatalf("error registering metrics: %v", err)
+	}
+
+	controller := NewClientAccessController(ClientAccessControllerConfig{
+		ClientService:     fakeClientService{},
+		ImageEventService: &fakeImageEventService{},
+		Renderer:          fakeRenderer{},
+		SessionService:    sessions.NewSessionWrapper[*models.Client](sessions.NewCookieStore("test-secret-test-secret-test-sec"), "test", "client"),
+	})
+
+	login := func(password string) int {
+		form := url.Values{"password": {password}}
+		r := httptest.NewRequest(http.MethodPost, "/client/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		w := httptest.NewRecorder()
+		controller.LoginAction(w, r)
+
+		return w.Code
+	}
+
+	failuresBefore := loginAttempts(t, registry, metrics.LoginResultFailure)
+	successesBefore := loginAttempts(t, registry, metrics.LoginResultSuccess)
+
+	login("wrong")
+	login("wrong")
+
+	if status := login("right"); status != http.StatusFound {
+		t.Fatalf("successful login status = %d, want %d", status, http.StatusFound)
+	}
+
+	if got := loginAttempts(t, registry, metrics.LoginResultFailure) - failuresBefore; got != 2 {
+		t.Errorf("failed logins counted = %v, want 2", got)
+	}
+
+	if got := loginAttempts(t, registry, metrics.LoginResultSuccess) - successesBefore; got != 1 {
+		t.Errorf("successful logins counted = %v, want 1", got)
+	}
+}
@@ -0,0 +1,461 @@
+package clientaccess
+
+import (
+	"bytes"
+	"crypto/md5"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/getoptions"
+	"github.com/adampresley/adamgokit/s3/geturloptions"
+	"github.com/adampresley/adamgokit/s3/listoptions"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/cache"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/viewmodels"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+)
+
+/*
+fakeS3Client serves objects from memory. URLs point at url with the key
+appended, so tests can stand up an httptest server for presigned requests.
+When expiration is set, GetUrl stores the expiration it was asked for there.
+Every object was last modified at fakeLastModified, and its ETag is the MD5
+of its contents. Anything not implemented panics through the nil embedded
+interface.
+*/
+var fakeLastModified = time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+func fakeETag(data []byte) string {
+	return fmt.Sprintf("%x", md5.Sum(data))
+}
+
+type fakeS3Client struct {
+	s3.S3Client
+
+	expiration *time.Duration
+	objects    map[string][]byte
+	url        string
+}
+
+func (f fakeS3Client) Get(bucket, key string, options ...getoptions.GetOption) (s3.GetObjectResponse, error) {
+	data, ok := f.objects[key]
+
+	if !ok {
+		return s3.GetObjectResponse{}, io.EOF
+	}
+
+	return s3.GetObjectResponse{
+		Body:         io.NopCloser(bytes.NewReader(data)),
+		ContentType:  "application/octet-stream",
+		ETag:         fakeETag(data),
+		LastModified: fakeLastModified,
+		Size:         int64(len(data)),
+	}, nil
+}
+
+func (f fakeS3Client) GetUrl(bucket, key string, options ...geturloptions.GetUrlOption) (string, error) {
+	if f.expiration != nil {
+		o := &geturloptions.GetUrlOptions{}
+
+		for _, option := range options {
+			option(o)
+		}
+
+		*f.expiration = o.Expiration
+	}
+
+	return f.url + "/" + key, nil
+}
+
+func (f fakeS3Client) List(bucket, path string, options ...listoptions.ListOption) (s3.ListResponse, error) {
+	result := s3.ListResponse{}
+
+	for key, data := range f.objects {
+		if strings.HasPrefix(key, path) {
+			result.Objects = append(result.Objects, s3.Object{Key: key, Size: int64(len(data)), Url: f.url + "/" + key})
+		}
+	}
+
+	sort.Slice(result.Objects, func(i, j int) bool {
+		return result.Objects[i].Key < result.Objects[j].Key
+	})
+
+	result.NumObjects = len(result.Objects)
+	return result, nil
+}
+
+/*
+slowS3Client holds every listing until release is closed, like an S3
+endpoint that has stopped answering.
+*/
+type slowS3Client struct {
+	fakeS3Client
+
+	release chan struct{}
+}
+
+func (f slowS3Client) List(bucket, path string, options ...listoptions.ListOption) (s3.ListResponse, error) {
+	<-f.release
+	return f.fakeS3Client.List(bucket, path, options...)
+}
+
+func (f fakeS3Client) StatObject(bucket, key string) (*s3.ObjectMetadata, error) {
+	data, ok := f.objects[key]
+
+	if !ok {
+		return nil, nil
+	}
+
+	// HeadObject returns the ETag quoted, unlike GetObject
+	return &s3.ObjectMetadata{
+		ETag:         `"` + fakeETag(data) + `"`,
+		LastModified: fakeLastModified,
+		Size:         int64(len(data)),
+	}, nil
+}
+
+/*
+fakeAlbumService serves albums from memory, keyed by ID. GetAlbum fails with
+err when it is set. Anything not implemented panics through the nil
+embedded interface.
+*/
+type fakeAlbumService struct {
+	services.AlbumServicer
+
+	albums    map[uint]*models.Album
+	err       error
+	galleries []models.Gallery
+}
+
+func (f fakeAlbumService) GetAlbum(clientID, albumID uint) (*models.Album, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	album, ok := f.albums[albumID]
+
+	if !ok {
+		return nil, fmt.Errorf("album %d: %w", albumID, services.ErrAlbumNotFound)
+	}
+
+	if album.ClientID != clientID {
+		return nil, fmt.Errorf("album %d, client %d: %w", albumID, clientID, services.ErrAlbumAccessDenied)
+	}
+
+	return album, nil
+}
+
+func (f fakeAlbumService) GetDownloadPermission(albumID uint) (bool, error) {
+	album, ok := f.albums[albumID]
+
+	if !ok {
+		return false, fmt.Errorf("album %d: %w", albumID, services.ErrAlbumNotFound)
+	}
+
+	return album.CanDownload(), nil
+}
+
+func (f fakeAlbumService) GetPurchased(albumID uint) (bool, error) {
+	album, ok := f.albums[albumID]
+
+	if !ok {
+		return false, fmt.Errorf("album %d: %w", albumID, services.ErrAlbumNotFound)
+	}
+
+	return album.Purchased, nil
+}
+
+func (f fakeAlbumService) GetFavorites(clientID, albumID uint) ([]models.Favorite, error) {
+	album, err := f.GetAlbum(clientID, albumID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return album.Favorites, nil
+}
+
+/*
+ToggleFavorite only reports the toggle. It refuses new favorites past the
+album's MaxFavorites like the real service, but doesn't store anything.
+*/
+func (f fakeAlbumService) ToggleFavorite(clientID, albumID uint, key string) (bool, error) {
+	album, err := f.GetAlbum(clientID, albumID)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, favorite := range album.Favorites {
+		if favorite.ImagePath == key {
+			return true, nil
+		}
+	}
+
+	if album.MaxFavorites.Valid && int64(len(album.Favorites)) >= album.MaxFavorites.Int64 {
+		return false, services.FavoriteLimitError{AlbumID: albumID, Limit: int(album.MaxFavorites.Int64)}
+	}
+
+	return false, nil
+}
+
+func (f fakeAlbumService) AddComment(clientID, albumID uint, imagePath, body string) (models.Comment, error) {
+	if strings.TrimSpace(body) == "" {
+		return models.Comment{}, services.ErrEmptyComment
+	}
+
+	return models.Comment{ID: 1, ClientID: clientID, AlbumID: albumID, ImagePath: imagePath, Body: body, CreatedAt: time.Now()}, nil
+}
+
+// SearchGalleries returns the fake's galleries as they are, whatever the filter
+func (f fakeAlbumService) SearchGalleries(clientID uint, filter services.AlbumFilter) ([]models.Gallery, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	return f.galleries, nil
+}
+
+func (f fakeAlbumService) GetAlbumList(clientID uint) ([]*models.Album, error) {
+	result := []*models.Album{}
+
+	for _, album := range f.albums {
+		if album.ClientID == clientID {
+			result = append(result, album)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result, nil
+}
+
+/*
+fakeZipService reports every zip as expired when expired is set. Zips that
+are started are recorded in started, when it is set, and are reported as
+queued at queuePosition when that is set. A download email can be resent
+only when resendable is set, and resends are recorded in resent.
+GetClientJobs returns every job in jobs, whichever client it belongs to, so
+tests can check only the caller's are reported. Anything else panics
+through the nil embedded interface.
+*/
+type fakeZipService struct {
+	services.ZipServicer
+
+	expired       bool
+	fileCount     int
+	jobs          []services.ZipJob
+	queuePosition int
+	resendable    bool
+	resent        *[]*models.Client
+	started       *[]*models.Client
+	totalBytes    int64
+}
+
+func (f fakeZipService) CreateZipAsync(album *models.Album, client *models.Client) (string, error) {
+	if f.started != nil {
+		*f.started = append(*f.started, client)
+	}
+
+	return "job", nil
+}
+
+func (f fakeZipService) ResendDownloadEmail(album *models.Album, client *models.Client) (bool, error) {
+	if !f.resendable {
+		return false, nil
+	}
+
+	if f.resent != nil {
+		*f.resent = append(*f.resent, client)
+	}
+
+	return true, nil
+}
+
+func (f fakeZipService) GetJob(jobID string) (services.ZipJob, bool) {
+	if f.queuePosition > 0 {
+		return services.ZipJob{ID: jobID, State: services.ZipJobQueued, QueuePosition: f.queuePosition}, true
+	}
+
+	return services.ZipJob{ID: jobID, State: services.ZipJobRunning}, true
+}
+
+func (f fakeZipService) GetClientJobs(clientID uint) []services.ZipJob {
+	return f.jobs
+}
+
+func (f fakeZipService) EstimateBundle(album *models.Album) (int, int64, error) {
+	return f.fileCount, f.totalBytes, nil
+}
+
+func (f fakeZipService) IsExpired(lastModified time.Time) bool {
+	return f.expired
+}
+
+/*
+fakeRenderer writes the name of the template it was asked to render.
+*/
+type fakeRenderer struct{}
+
+func (f fakeRenderer) Render(templateName string, data any, w io.Writer) error {
+	_, err := io.WriteString(w, templateName)
+	return err
+}
+
+func (f fakeRenderer) RenderString(templateString string, data any, w io.Writer) error {
+	_, err := io.WriteString(w, templateString)
+	return err
+}
+
+/*
+capturingRenderer keeps the view data of the last page it rendered.
+*/
+type capturingRenderer struct {
+	fakeRenderer
+	data *any
+}
+
+func (f capturingRenderer) Render(templateName string, data any, w io.Writer) error {
+	*f.data = data
+	return f.fakeRenderer.Render(templateName, data, w)
+}
+
+/*
+fakeImageEventService keeps recorded events in memory.
+*/
+type fakeImageEventService struct {
+	mu     sync.Mutex
+	events []models.ImageEvent
+}
+
+func (f *fakeImageEventService) Record(events ...models.ImageEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.events = append(f.events, events...)
+}
+
+func (f *fakeImageEventService) Start() {}
+func (f *fakeImageEventService) Stop()  {}
+
+func (f *fakeImageEventService) recorded() []models.ImageEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]models.ImageEvent{}, f.events...)
+}
+
+// withClient returns r as if the client access middleware had let it through
+func withClient(r *http.Request, client *models.Client) *http.Request {
+	return r.WithContext(viewmodels.ContextWithClient(r.Context(), client))
+}
+
+/*
+fakeCacheCreator "renders" a thumbnail by prefixing the original with
+"thumbnail of ", and a proof with "proof of ", and keeps background uploads
+in memory. Anything else panics through the nil embedded interface.
+*/
+type fakeCacheCreator struct {
+	cache.CacheCreator
+
+	mu     sync.Mutex
+	stored map[string][]byte
+}
+
+func (f *fakeCacheCreator) RenderThumbnail(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte("thumbnail of "), data...), nil
+}
+
+func (f *fakeCacheCreator) RenderProof(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte("proof of "), data...), nil
+}
+
+func (f *fakeCacheCreator) PutThumbnailInBackground(thumbnailKey string, thumbnail []byte, logger *slog.Logger) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.stored == nil {
+		f.stored = map[string][]byte{}
+	}
+
+	f.stored[thumbnailKey] = thumbnail
+	return true
+}
+
+func (f *fakeCacheCreator) storedThumbnails() map[string][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return maps.Clone(f.stored)
+}
+
+/*
+fakeClientService lets in anyone using the access code "right" as client 1.
+Notification preferences are kept in notify, and clients missing from it are
+not found. Anything else panics through the nil embedded interface.
+*/
+type fakeClientService struct {
+	services.ClientServicer
+
+	logins *[]models.LoginAudit
+	notify map[uint]bool
+}
+
+// RecordLogin keeps the attempt when the test gave the fake somewhere to put it
+func (f fakeClientService) RecordLogin(login models.LoginAudit) error {
+	if f.logins != nil {
+		*f.logins = append(*f.logins, login)
+	}
+
+	return nil
+}
+
+func (f fakeClientService) GetNotificationPreference(clientID uint) (bool, error) {
+	notify, ok := f.notify[clientID]
+
+	if !ok {
+		return false, fmt.Errorf("client %d: %w", clientID, services.ErrClientNotFound)
+	}
+
+	return notify, nil
+}
+
+func (f fakeClientService) SetNotificationPreference(clientID uint, notifyOnDownload bool) error {
+	if _, ok := f.notify[clientID]; !ok {
+		return fmt.Errorf("client %d: %w", clientID, services.ErrClientNotFound)
+	}
+
+	f.notify[clientID] = notifyOnDownload
+	return nil
+}
+
+func (f fakeClientService) GetByPassword(password string) (*models.Client, *models.AccessCode, error) {
+	if password != "right" {
+		return nil, nil, sql.ErrNoRows
+	}
+
+	return &models.Client{BaseModel: models.BaseModel{ID: 1}}, &models.AccessCode{ID: 7, ClientID: 1, Label: "Default"}, nil
+}
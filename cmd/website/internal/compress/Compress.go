@@ -0,0 +1,229 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	/*
+	 * compressibleTypes are the content types worth compressing. Anything
+	 * else, like images and zips, is already compressed and is sent as is.
+	 */
+	compressibleTypes = []string{
+		"application/javascript",
+		"application/json",
+		"application/xml",
+		"image/svg+xml",
+		"text/",
+	}
+
+	gzipWriters = sync.Pool{
+		New: func() any {
+			return gzip.NewWriter(io.Discard)
+		},
+	}
+)
+
+/*
+NewMiddleware returns a middleware that gzips text responses, like rendered
+pages and JSON, for clients that send Accept-Encoding: gzip. Whether a
+response is compressed is decided by its Content-Type once the handler
+starts writing, so images and zips pass through untouched. Responses that
+are already encoded, partial content, and range requests are left alone
+too. Compressible responses always get Vary: Accept-Encoding so caches keep
+the two versions apart.
+*/
+func NewMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				acceptsGzip:    acceptsGzip(r.Header.Get("Accept-Encoding")),
+				status:         http.StatusOK,
+			}
+
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+/*
+acceptsGzip reports whether an Accept-Encoding header allows gzip. A
+quality of 0 refuses it, and a wildcard allows it unless gzip is refused
+by name.
+*/
+func acceptsGzip(header string) bool {
+	result := false
+
+	for _, encoding := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if name != "gzip" && name != "*" {
+			continue
+		}
+
+		allowed := true
+
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if quality, err := strconv.ParseFloat(q, 64); err == nil && quality == 0 {
+				allowed = false
+			}
+		}
+
+		if name == "gzip" {
+			return allowed
+		}
+
+		result = allowed
+	}
+
+	return result
+}
+
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return false
+	}
+
+	for _, compressible := range compressibleTypes {
+		if mediaType == compressible || (strings.HasSuffix(compressible, "/") && strings.HasPrefix(mediaType, compressible)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+compressWriter holds back the status until the first write, when the
+Content-Type is known, and then either gzips the body or passes it
+through.
+*/
+type compressWriter struct {
+	http.ResponseWriter
+
+	acceptsGzip bool
+	decided     bool
+	gz          *gzip.Writer
+	status      int
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.decided {
+		return
+	}
+
+	w.status = status
+
+	// Informational responses don't end the headers
+	if status >= 100 && status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		w.decide(nil)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.decide(b)
+	}
+
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+/*
+decide picks whether to compress and sends the headers. first is the
+start of the body, used to sniff the Content-Type like net/http does when
+the handler didn't set one.
+*/
+func (w *compressWriter) decide(first []byte) {
+	w.decided = true
+	header := w.ResponseWriter.Header()
+
+	if header.Get("Content-Type") == "" && len(first) > 0 && header.Get("Content-Encoding") == "" {
+		header.Set("Content-Type", http.DetectContentType(first))
+	}
+
+	compressible := w.status != http.StatusNoContent &&
+		w.status != http.StatusNotModified &&
+		w.status != http.StatusPartialContent &&
+		header.Get("Content-Encoding") == "" &&
+		header.Get("Content-Range") == "" &&
+		isCompressible(header.Get("Content-Type"))
+
+	if compressible {
+		header.Add("Vary", "Accept-Encoding")
+	}
+
+	if compressible && w.acceptsGzip && len(first) > 0 {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+
+		w.gz = gzipWriters.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+/*
+Flush sends what has been compressed so far, for handlers that stream
+their response. Flushing before anything is written sends the headers, so
+that response isn't compressed.
+*/
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(nil)
+	}
+
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+/*
+Close finishes the gzip stream. A handler that never wrote anything still
+gets its status sent.
+*/
+func (w *compressWriter) Close() {
+	if !w.decided {
+		w.decide(nil)
+	}
+
+	if w.gz != nil {
+		_ = w.gz.Close()
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
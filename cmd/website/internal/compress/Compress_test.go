@@ -0,0 +1,169 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var page = "<!DOCTYPE html><html><body>" + strings.Repeat(`<img src="/client/thumb?key=a.jpg" />`, 200) + "</body></html>"
+
+func TestMiddlewareCompressesText(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		wantGzip       bool
+		wantVary       bool
+	}{
+		{name: "html", acceptEncoding: "gzip, deflate, br", contentType: "text/html; charset=utf-8", body: page, wantGzip: true, wantVary: true},
+		{name: "json", acceptEncoding: "gzip", contentType: "application/json", body: `{"images": []}`, wantGzip: true, wantVary: true},
+		{name: "sniffed html", acceptEncoding: "gzip", body: page, wantGzip: true, wantVary: true},
+		{name: "gzip not accepted", acceptEncoding: "br", contentType: "text/html; charset=utf-8", body: page, wantVary: true},
+		{name: "gzip refused", acceptEncoding: "gzip;q=0, *", contentType: "text/html; charset=utf-8", body: page, wantVary: true},
+		{name: "wildcard", acceptEncoding: "*", contentType: "text/html; charset=utf-8", body: page, wantGzip: true, wantVary: true},
+		{name: "zip", acceptEncoding: "gzip", contentType: "application/zip", body: "PK\x03\x04 zip"},
+		{name: "image", acceptEncoding: "gzip", contentType: "image/jpeg", body: "\xff\xd8\xff\xe0 jpeg"},
+		{name: "sniffed image", acceptEncoding: "gzip", body: "\x89PNG\r\n\x1a\n png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+
+				w.Header().Set("Content-Length", strconv.Itoa(len(tt.body)))
+				_, _ = io.WriteString(w, tt.body)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/client", nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if got := w.Header().Get("Content-Encoding") == "gzip"; got != tt.wantGzip {
+				t.Fatalf("gzipped = %v, want %v", got, tt.wantGzip)
+			}
+
+			if got := w.Header().Get("Vary") == "Accept-Encoding"; got != tt.wantVary {
+				t.Errorf("Vary = %q, want it set %v", w.Header().Get("Vary"), tt.wantVary)
+			}
+
+			body := w.Body.String()
+
+			if tt.wantGzip {
+				if w.Header().Get("Content-Length") != "" {
+					t.Errorf("Content-Length = %q, want it removed", w.Header().Get("Content-Length"))
+				}
+
+				if len(body) >= len(tt.body) && len(tt.body) > 1000 {
+					t.Errorf("compressed to %d bytes, want less than %d", len(body), len(tt.body))
+				}
+
+				reader, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("body is not gzipped: %v", err)
+				}
+
+				decompressed, err := io.ReadAll(reader)
+				if err != nil {
+					t.Fatalf("error decompressing body: %v", err)
+				}
+
+				body = string(decompressed)
+			}
+
+			if body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestMiddlewareLeavesSomeResponsesAlone(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		header  http.Header
+		handler http.HandlerFunc
+	}{
+		{
+			name:   "range request",
+			method: http.MethodGet,
+			header: http.Header{"Range": {"bytes=0-9"}},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				_, _ = io.WriteString(w, page)
+			},
+		},
+		{
+			name:   "already encoded",
+			method: http.MethodGet,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.Header().Set("Content-Encoding", "br")
+				_, _ = io.WriteString(w, page)
+			},
+		},
+		{
+			name:   "no content",
+			method: http.MethodDelete,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+		},
+		{
+			name:   "head",
+			method: http.MethodHead,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/client", nil)
+			r.Header = tt.header.Clone()
+
+			if r.Header == nil {
+				r.Header = http.Header{}
+			}
+
+			r.Header.Set("Accept-Encoding", "gzip")
+
+			w := httptest.NewRecorder()
+			NewMiddleware()(tt.handler).ServeHTTP(w, r)
+
+			if got := w.Header().Get("Content-Encoding"); got == "gzip" {
+				t.Errorf("Content-Encoding = %q, want the response left alone", got)
+			}
+		})
+	}
+}
+
+func TestMiddlewareKeepsTheStatus(t *testing.T) {
+	handler := NewMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `{"message": "Album not found"}`)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/client/albums/9", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("status = %d, Content-Encoding = %q; want a gzipped 404", w.Code, w.Header().Get("Content-Encoding"))
+	}
+}
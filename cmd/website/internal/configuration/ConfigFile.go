@@ -0,0 +1,95 @@
+package configuration
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+applyConfigFile fills config from the YAML file at path. Keys can be either
+the field name (awsBucket, AwsBucket) or the environment variable name
+(AWS_BUCKET), so an existing .env can be turned into a config file with
+little more than swapping "=" for ": ".
+
+Fields that were set with an environment variable or a flag in args are
+left alone, so both still override the file. Keys that don't match a field
+are an error, since they're almost always a typo.
+*/
+func applyConfigFile(config *Config, path string, args []string) error {
+	var (
+		err     error
+		b       []byte
+		entries map[string]yaml.Node
+	)
+
+	if b, err = os.ReadFile(path); err != nil {
+		return fmt.Errorf("error reading config file '%s': %w", path, err)
+	}
+
+	if err = yaml.Unmarshal(b, &entries); err != nil {
+		return fmt.Errorf("error parsing config file '%s': %w", path, err)
+	}
+
+	value := reflect.ValueOf(config).Elem()
+	configType := value.Type()
+
+	for key, node := range entries {
+		field, ok := findField(configType, key)
+
+		if !ok {
+			return fmt.Errorf("unknown setting '%s' in config file '%s'", key, path)
+		}
+
+		if isSetExplicitly(field, args) {
+			continue
+		}
+
+		if err = node.Decode(value.FieldByIndex(field.Index).Addr().Interface()); err != nil {
+			return fmt.Errorf("error reading '%s' from config file '%s': %w", key, path, err)
+		}
+	}
+
+	return nil
+}
+
+func findField(configType reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+
+		if strings.EqualFold(field.Name, key) || field.Tag.Get("env") == key {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+/*
+isSetExplicitly reports whether a field was given a value with its
+environment variable or its command line flag.
+*/
+func isSetExplicitly(field reflect.StructField, args []string) bool {
+	if _, ok := os.LookupEnv(field.Tag.Get("env")); ok {
+		return true
+	}
+
+	flagName := field.Tag.Get("flag")
+
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+
+		if strings.HasPrefix(arg, "-") && name == flagName {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,107 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("error writing config file: %v", err)
+	}
+
+	return path
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+awsBucket: file-bucket
+HOME_PAGE_PHOTO_FOLDER: portfolio
+maxCacheWorkers: 8
+watermarkEnabled: true
+`)
+
+	config := Config{AwsBucket: "default-bucket", HomePagePhotoFolder: "home-page", MaxCacheWorkers: 20}
+
+	if err := applyConfigFile(&config, path, nil); err != nil {
+		t.Fatalf("applyConfigFile() = %v", err)
+	}
+
+	if config.AwsBucket != "file-bucket" || config.HomePagePhotoFolder != "portfolio" || config.MaxCacheWorkers != 8 || !config.WatermarkEnabled {
+		t.Errorf("config = %+v, want the file's values", config)
+	}
+}
+
+func TestApplyConfigFileEnvironmentOverridesTheFile(t *testing.T) {
+	path := writeConfigFile(t, "AWS_BUCKET: file-bucket\nHOME_PAGE_PHOTO_FOLDER: portfolio\n")
+
+	t.Setenv("AWS_BUCKET", "env-bucket")
+
+	// configinator has already copied the environment variable in by the time the file is read
+	config := Config{AwsBucket: "env-bucket", HomePagePhotoFolder: "home-page"}
+
+	if err := applyConfigFile(&config, path, nil); err != nil {
+		t.Fatalf("applyConfigFile() = %v", err)
+	}
+
+	if config.AwsBucket != "env-bucket" {
+		t.Errorf("AwsBucket = %s, want the environment variable's value", config.AwsBucket)
+	}
+
+	if config.HomePagePhotoFolder != "portfolio" {
+		t.Errorf("HomePagePhotoFolder = %s, want the file's value", config.HomePagePhotoFolder)
+	}
+}
+
+func TestApplyConfigFileFlagsOverrideTheFile(t *testing.T) {
+	path := writeConfigFile(t, "host: file-host:9000\nlogLevel: error\nmaxCacheWorkers: 8\n")
+
+	config := Config{Host: "flag-host:80", LogLevel: "warn", MaxCacheWorkers: 20}
+	args := []string{"--host", "flag-host:80", "-loglevel=warn", "--", "-mcc=3"}
+
+	if err := applyConfigFile(&config, path, args); err != nil {
+		t.Fatalf("applyConfigFile() = %v", err)
+	}
+
+	if config.Host != "flag-host:80" || config.LogLevel != "warn" {
+		t.Errorf("Host = %s, LogLevel = %s; want the flags' values", config.Host, config.LogLevel)
+	}
+
+	// Anything after -- isn't a flag
+	if config.MaxCacheWorkers != 8 {
+		t.Errorf("MaxCacheWorkers = %d, want the file's value", config.MaxCacheWorkers)
+	}
+}
+
+func TestApplyConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  string
+	}{
+		{name: "unknown key", contents: "awsBuckett: typo\n", wantErr: "unknown setting 'awsBuckett'"},
+		{name: "wrong type", contents: "maxCacheWorkers: lots\n", wantErr: "maxCacheWorkers"},
+		{name: "not yaml", contents: "host: [\n", wantErr: "error parsing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{}
+			err := applyConfigFile(&config, writeConfigFile(t, tt.contents), nil)
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("applyConfigFile() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := applyConfigFile(&Config{}, filepath.Join(t.TempDir(), "missing.yaml"), nil); err == nil {
+		t.Errorf("applyConfigFile() with a missing file = nil, want an error")
+	}
+}
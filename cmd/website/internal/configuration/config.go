@@ -1,28 +1,341 @@
 package configuration
 
-import "github.com/adampresley/configinator"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+	"github.com/adampresley/configinator"
+)
+
+// DefaultCookieSecret is the shipped cookie secret. Anyone who has read the source can forge sessions with it
+const DefaultCookieSecret = "password"
 
 type Config struct {
-	AwsEndpointUrl         string `flag:"awsep" env:"AWS_ENDPOINT_URL" default:"http://localhost:4566" description:"AWS endpoint URL"`
-	AwsRegion              string `flag:"awsregion" env:"AWS_REGION" default:"us-central-1" description:"AWS region"`
-	AwsAccessKeyId         string `flag:"awsaccesskeyid" env:"AWS_ACCESS_KEY_ID" default:"" description:"AWS access key ID"`
-	AwsSecretAccessKey     string `flag:"awssecretaccesskey" env:"AWS_SECRET_ACCESS_KEY" default:"" description:"AWS secret access key"`
-	AwsBucket              string `flag:"awsbucket" env:"AWS_BUCKET" default:"adampresleyphotography.com" description:"S3 bucket"`
-	ClientsPhotoFolder     string `flag:"cpf" env:"CLIENTS_PHOTO_FOLDER" default:"clients" description:"S3 folder for clients' photos"`
-	CookieSecret           string `flag:"cookiesecret" env:"COOKIE_SECRET" default:"password" description:"Secret for encoding coodies"`
-	DataMigrationDir       string `flag:"dmd" env:"DATA_MIGRATION_DIR" default:"../../sql-migrations" description:"Migration folder"`
-	DownloadBaseURL        string `flag:"dlb" env:"DOWNLOAD_BASE_URL" default:"http://localhost:8080" description:"Base URL for downloading images"`
-	DownloadExpirationDays int    `flag:"dle" env:"DOWNLOAD_EXPIRATION_DAYS" default:"30" description:"Number of days before images expire in the download directory"`
-	DSN                    string `flag:"dsn" env:"DSN" default:"file:./data/adampresleyphotography.db" description:"Data source name"`
-	EmailApiKey            string `flag:"emailapikey" env:"EMAIL_API_KEY" default:"" description:"API key for sending emails"`
-	HomePagePhotoFolder    string `flag:"hppf" env:"HOME_PAGE_PHOTO_FOLDER" default:"home-page" description:"S3 folder for home page photos"`
-	Host                   string `flag:"host" env:"HOST" default:"localhost:8081" description:"The address and port to bind the HTTP server to"`
-	LogLevel               string `flag:"loglevel" env:"LOG_LEVEL" default:"debug" description:"The log level to use. Valid values are 'debug', 'info', 'warn', and 'error'"`
-	MaxCacheWorkers        int    `flag:"mcc" env:"MAX_CACHE_WORKERS" default:"20" description:"Maximum number of concurrent cache workers"`
+	AdminToken                string `flag:"admintoken" env:"ADMIN_TOKEN" default:"" description:"Bearer token required for admin endpoints and /metrics. Leave blank to disable them"`
+	AwsEndpointUrl            string `flag:"awsep" env:"AWS_ENDPOINT_URL" default:"http://localhost:4566" description:"AWS endpoint URL"`
+	AwsRegion                 string `flag:"awsregion" env:"AWS_REGION" default:"us-central-1" description:"AWS region"`
+	AwsAccessKeyId            string `flag:"awsaccesskeyid" env:"AWS_ACCESS_KEY_ID" default:"" description:"AWS access key ID"`
+	AwsSecretAccessKey        string `flag:"awssecretaccesskey" env:"AWS_SECRET_ACCESS_KEY" default:"" description:"AWS secret access key"`
+	AwsBucket                 string `flag:"awsbucket" env:"AWS_BUCKET" default:"adampresleyphotography.com" description:"S3 bucket"`
+	BrandLogoPath             string `flag:"brandlogopath" env:"BRAND_LOGO_PATH" default:"/static/images/logo.png" description:"URL path of the logo shown in the site header"`
+	CacheImageExtensions      string `flag:"cacheimageextensions" env:"CACHE_IMAGE_EXTENSIONS" default:".jpg,.jpeg,.png" description:"Comma separated list of original image extensions to create thumbnails for. HEIC requires a build with the heic tag"`
+	CacheLockTTLMinutes       int    `flag:"cachelockttlminutes" env:"CACHE_LOCK_TTL_MINUTES" default:"120" description:"Number of minutes an instance holds the cache creator lock before another instance may reclaim it. Should be longer than a cache run"`
+	CacheRunIntervalMinutes   int    `flag:"cacherunintervalminutes" env:"CACHE_RUN_INTERVAL_MINUTES" default:"60" description:"Number of minutes between cache creator runs"`
+	CacheRunOnStartup         bool   `flag:"cacherunonstartup" env:"CACHE_RUN_ON_STARTUP" default:"true" description:"Run the cache creator as soon as the server starts rather than waiting for the first interval"`
+	CdnBaseURL                string `flag:"cdnbaseurl" env:"CDN_BASE_URL" default:"" description:"Base URL of a CDN in front of the S3 bucket, such as https://cdn.example.com. Album and home page images are linked through it instead of presigned S3 URLs. Leave blank to use presigned URLs"`
+	ClientsPhotoFolder        string `flag:"cpf" env:"CLIENTS_PHOTO_FOLDER" default:"clients" description:"S3 folder for clients' photos"`
+	ConfigFile                string `flag:"config" env:"CONFIG_FILE" default:"" description:"Optional YAML file to read settings from. Environment variables and flags override values in the file"`
+	ContactEmail              string `flag:"contactemail" env:"CONTACT_EMAIL" default:"" description:"Address contact form inquiries are emailed to. Inquiries can't be sent while this is blank"`
+	CookieSecret              string `flag:"cookiesecret" env:"COOKIE_SECRET" default:"password" description:"Secret for encoding coodies"`
+	CspImageSources           string `flag:"cspimagesources" env:"CSP_IMAGE_SOURCES" default:"" description:"Comma separated list of extra origins images may be loaded from, such as https://images.example.com. The S3 endpoint and CDN_BASE_URL are always allowed"`
+	DataMigrationDir          string `flag:"dmd" env:"DATA_MIGRATION_DIR" default:"../../sql-migrations" description:"Migration folder"`
+	DownloadBaseURL           string `flag:"dlb" env:"DOWNLOAD_BASE_URL" default:"http://localhost:8080" description:"Base URL for downloading images"`
+	DownloadExpirationDays    int    `flag:"dle" env:"DOWNLOAD_EXPIRATION_DAYS" default:"30" description:"Number of days before images expire in the download directory"`
+	DownloadTokenSecret       string `flag:"downloadtokensecret" env:"DOWNLOAD_TOKEN_SECRET" default:"" description:"Secret used to sign the tokens in download links so they can't be guessed or altered"`
+	DSN                       string `flag:"dsn" env:"DSN" default:"file:./data/adampresleyphotography.db" description:"Data source name"`
+	EmailApiKey               string `flag:"emailapikey" env:"EMAIL_API_KEY" default:"" description:"API key for sending emails"`
+	EmailProvider             string `flag:"emailprovider" env:"EMAIL_PROVIDER" default:"resend" description:"Email provider to use. Valid values are 'resend' and 'smtp'"`
+	EmailSubject              string `flag:"emailsubject" env:"EMAIL_SUBJECT" default:"Your photos download is ready!" description:"Subject line for the download ready email"`
+	EmailTemplatePath         string `flag:"emailtemplatepath" env:"EMAIL_TEMPLATE_PATH" default:"app/emails/download-ready.html" description:"Path in the embedded app file system to the download ready email template"`
+	FaviconPath               string `flag:"faviconpath" env:"FAVICON_PATH" default:"" description:"URL path of the favicon. Leave blank for the browser's default"`
+	FromEmail                 string `flag:"fromemail" env:"FROM_EMAIL" default:"noreply@adampresleyphotography.com" description:"Address emails to clients and contact inquiries are sent from"`
+	FromName                  string `flag:"fromname" env:"FROM_NAME" default:"" description:"Name emails are sent from. Defaults to the site name"`
+	HeroAspectRatio           string `flag:"heroaspectratio" env:"HERO_ASPECT_RATIO" default:"16:9" description:"Width to height ratio album hero banners are cropped to, like 16:9 or 2.5. The crop is centered on the poster's X and Y position"`
+	HomePageInitialCount      int    `flag:"homepageinitialcount" env:"HOME_PAGE_INITIAL_COUNT" default:"24" description:"Number of home page photos shown at first. More are loaded as the visitor scrolls"`
+	HomePagePhotoFolder       string `flag:"hppf" env:"HOME_PAGE_PHOTO_FOLDER" default:"home-page" description:"S3 folder for home page photos"`
+	HomePageSortByCaptureDate bool   `flag:"homepagesortbycapturedate" env:"HOME_PAGE_SORT_BY_CAPTURE_DATE" default:"false" description:"Show home page photos newest first by their EXIF capture date, falling back to when the original was uploaded"`
+	Host                      string `flag:"host" env:"HOST" default:"localhost:8081" description:"The address and port to bind the HTTP server to"`
+	ImageUrlExpirationMinutes int    `flag:"imageurlexpirationminutes" env:"IMAGE_URL_EXPIRATION_MINUTES" default:"60" description:"Number of minutes presigned album and home page image URLs are valid for. Open album pages fetch fresh URLs before they expire"`
+	JpegQuality               int    `flag:"jpegquality" env:"JPEG_QUALITY" default:"85" description:"Quality, from 1 to 100, JPEG thumbnails, hero banners, and home page photos are encoded at. Lower values make smaller files"`
+	LogLevel                  string `flag:"loglevel" env:"LOG_LEVEL" default:"debug" description:"The log level to use. Valid values are 'debug', 'info', 'warn', and 'error'"`
+	MaxCacheWorkers           int    `flag:"mcc" env:"MAX_CACHE_WORKERS" default:"20" description:"Maximum number of concurrent cache workers"`
+	MaxConcurrentZipJobs      int    `flag:"maxconcurrentzipjobs" env:"MAX_CONCURRENT_ZIP_JOBS" default:"4" description:"Number of album zips built at once. Further download requests wait in a queue"`
+	MaxZipJobsPerClient       int    `flag:"maxzipjobsperclient" env:"MAX_ZIP_JOBS_PER_CLIENT" default:"2" description:"Number of album zips built at once for any one client, so one client can't take every slot"`
+	MetricsOpen               bool   `flag:"metricsopen" env:"METRICS_OPEN" default:"false" description:"Serve /metrics without a token when ADMIN_TOKEN is blank. Only enable this when /metrics is not reachable from the internet"`
+	PresignedUrlMinutes       int    `flag:"presignedurlminutes" env:"PRESIGNED_URL_MINUTES" default:"15" description:"Number of minutes a presigned download URL is valid for"`
+	S3OperationTimeoutSeconds int    `flag:"s3operationtimeoutseconds" env:"S3_OPERATION_TIMEOUT_SECONDS" default:"30" description:"Number of seconds to wait on an S3 listing before giving up, so a hung S3 endpoint can't hold up a page or a cache run"`
+	SessionRememberTTL        int    `flag:"sessionrememberttl" env:"SESSION_REMEMBER_TTL" default:"720" description:"Number of hours a client stays logged in when they check 'remember me'"`
+	SessionShortTTL           int    `flag:"sessionshortttl" env:"SESSION_SHORT_TTL" default:"24" description:"Number of hours a client stays logged in by default"`
+	SiteName                  string `flag:"sitename" env:"SITE_NAME" default:"Adam Presley Photography" description:"Name of the site, shown in page titles and used as the email sender name unless FROM_NAME is set"`
+	SmtpHost                  string `flag:"smtphost" env:"SMTP_HOST" default:"" description:"SMTP server host when using the smtp email provider"`
+	SmtpPassword              string `flag:"smtppassword" env:"SMTP_PASSWORD" default:"" description:"SMTP password"`
+	SmtpPort                  int    `flag:"smtpport" env:"SMTP_PORT" default:"587" description:"SMTP server port"`
+	SmtpUser                  string `flag:"smtpuser" env:"SMTP_USER" default:"" description:"SMTP user name"`
+	ThumbnailFormat           string `flag:"thumbnailformat" env:"THUMBNAIL_FORMAT" default:"jpeg" description:"Format album thumbnails are encoded in. Valid values are 'jpeg', 'webp', and 'avif'. WebP and AVIF require a build with the tag of the same name, otherwise JPEG is used"`
+	TrustedProxies            string `flag:"trustedproxies" env:"TRUSTED_PROXIES" default:"" description:"Comma separated list of IPs or CIDRs, like 10.0.0.0/8, of reverse proxies in front of the app. X-Forwarded-For is only believed on requests from them. Leave blank when clients connect directly"`
+	UploadMaxSizeMB           int    `flag:"uploadmaxsizemb" env:"UPLOAD_MAX_SIZE_MB" default:"100" description:"Largest image, in megabytes, that can be uploaded to an album through the admin endpoint"`
+	UsePresignedDownloads     bool   `flag:"usepresigneddownloads" env:"USE_PRESIGNED_DOWNLOADS" default:"false" description:"Redirect downloads to presigned S3 URLs instead of streaming them through the app"`
+	WatermarkEnabled          bool   `flag:"watermarkenabled" env:"WATERMARK_ENABLED" default:"false" description:"Overlay a watermark on the thumbnails of purchased albums. Albums that haven't been purchased are always watermarked"`
+	WatermarkImagePath        string `flag:"watermarkimagepath" env:"WATERMARK_IMAGE_PATH" default:"" description:"Path in the embedded app file system to a PNG watermark. Takes precedence over the watermark text"`
+	WatermarkText             string `flag:"watermarktext" env:"WATERMARK_TEXT" default:"adampresleyphotography.com" description:"Text to use as the watermark when no watermark image is set"`
+	WatermarkTiled            bool   `flag:"watermarktiled" env:"WATERMARK_TILED" default:"false" description:"Tile the watermark across the thumbnail instead of centering it"`
+	WebhookSecret             string `flag:"webhooksecret" env:"WEBHOOK_SECRET" default:"" description:"Shared secret used to sign download ready webhooks with HMAC-SHA256. Required when WEBHOOK_URL is set"`
+	WebhookURL                string `flag:"webhookurl" env:"WEBHOOK_URL" default:"" description:"URL to POST a JSON notification to when a download is ready, alongside the email. Leave blank to only send email"`
+	ZipCleanupIntervalHours   int    `flag:"zipcleanupintervalhours" env:"ZIP_CLEANUP_INTERVAL_HOURS" default:"24" description:"Hours between removals of expired download zips"`
+	ZipDownloadWorkers        int    `flag:"zipdownloadworkers" env:"ZIP_DOWNLOAD_WORKERS" default:"4" description:"Number of album originals to download in parallel when building a zip"`
+	ZipFavoritesFolder        bool   `flag:"zipfavoritesfolder" env:"ZIP_FAVORITES_FOLDER" default:"false" description:"Put the client's favorites in a favorites folder inside album zips, with the rest of the photos at the root"`
+	ZipIncludeManifest        bool   `flag:"zipincludemanifest" env:"ZIP_INCLUDE_MANIFEST" default:"true" description:"Add a manifest.txt listing the album, client, and photos to each album zip"`
+	ZipMaxSizeMB              int    `flag:"zipmaxsizemb" env:"ZIP_MAX_SIZE_MB" default:"0" description:"Largest album zip, in megabytes, before it is split into numbered parts. 0 never splits"`
+	ZipPrewarmDays            int    `flag:"zipprewarmdays" env:"ZIP_PREWARM_DAYS" default:"0" description:"Build zips ahead of time for albums delivered within this many days, so downloads are ready when clients ask. 0 turns it off"`
+	ZipPrewarmIntervalMinutes int    `flag:"zipprewarmintervalminutes" env:"ZIP_PREWARM_INTERVAL_MINUTES" default:"60" description:"Minutes between runs of the zip prewarmer"`
+}
+
+/*
+ParseAspectRatio reads a width to height ratio written as "16:9", "16/9", or
+a single number like "1.78".
+*/
+func ParseAspectRatio(value string) (float64, error) {
+	var (
+		err    error
+		width  float64
+		height = 1.0
+	)
+
+	value = strings.TrimSpace(value)
+	widthPart, heightPart, found := strings.Cut(strings.ReplaceAll(value, "/", ":"), ":")
+
+	if width, err = strconv.ParseFloat(strings.TrimSpace(widthPart), 64); err != nil {
+		return 0, fmt.Errorf("'%s' is not an aspect ratio. Use a value like 16:9", value)
+	}
+
+	if found {
+		if height, err = strconv.ParseFloat(strings.TrimSpace(heightPart), 64); err != nil {
+			return 0, fmt.Errorf("'%s' is not an aspect ratio. Use a value like 16:9", value)
+		}
+	}
+
+	if width <= 0 || height <= 0 || math.IsInf(width/height, 0) || math.IsNaN(width/height) {
+		return 0, fmt.Errorf("'%s' must have a width and height greater than 0", value)
+	}
+
+	return width / height, nil
+}
+
+/*
+ParseTrustedProxies reads a comma separated list of IPs and CIDRs. A bare
+IP is a range of just that address. Blank entries are skipped.
+*/
+func ParseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var (
+		err    error
+		prefix netip.Prefix
+		addr   netip.Addr
+	)
+
+	result := []netip.Prefix{}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "/") {
+			if prefix, err = netip.ParsePrefix(entry); err != nil {
+				return nil, fmt.Errorf("'%s' is not an IP or CIDR", entry)
+			}
+
+			result = append(result, prefix.Masked())
+			continue
+		}
+
+		if addr, err = netip.ParseAddr(entry); err != nil {
+			return nil, fmt.Errorf("'%s' is not an IP or CIDR", entry)
+		}
+
+		result = append(result, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+
+	return result, nil
 }
 
-func LoadConfig() Config {
+/*
+LoadConfig reads settings from flags, environment variables, and defaults,
+then fills in anything not set by a flag or environment variable from the
+config file, if one was given.
+*/
+func LoadConfig() (Config, error) {
 	config := Config{}
 	configinator.Behold(&config)
-	return config
+
+	if config.ConfigFile == "" {
+		return config, nil
+	}
+
+	err := applyConfigFile(&config, config.ConfigFile, os.Args[1:])
+	return config, err
+}
+
+/*
+Validate checks the configuration for values the app can't run with and
+returns every problem found at once, so an operator can fix them all
+before restarting.
+*/
+func (c Config) Validate() error {
+	var (
+		errs []error
+	)
+
+	if c.AwsBucket == "" {
+		errs = append(errs, errors.New("AWS_BUCKET is required"))
+	}
+
+	if c.CookieSecret == "" {
+		errs = append(errs, errors.New("COOKIE_SECRET is required"))
+	}
+
+	if c.DownloadTokenSecret == "" {
+		errs = append(errs, errors.New("DOWNLOAD_TOKEN_SECRET is required"))
+	}
+
+	switch strings.ToLower(c.EmailProvider) {
+	case "", services.EmailProviderResend:
+		if c.EmailApiKey == "" {
+			errs = append(errs, errors.New("EMAIL_API_KEY is required when using the resend email provider"))
+		}
+
+	case services.EmailProviderSmtp:
+		if c.SmtpHost == "" {
+			errs = append(errs, errors.New("SMTP_HOST is required when using the smtp email provider"))
+		}
+
+	default:
+		errs = append(errs, fmt.Errorf("EMAIL_PROVIDER '%s' is not valid. Use 'resend' or 'smtp'", c.EmailProvider))
+	}
+
+	if c.FromEmail == "" {
+		errs = append(errs, errors.New("FROM_EMAIL is required"))
+	}
+
+	if c.DownloadExpirationDays <= 0 {
+		errs = append(errs, fmt.Errorf("DOWNLOAD_EXPIRATION_DAYS must be greater than 0, got %d", c.DownloadExpirationDays))
+	}
+
+	switch strings.ToLower(c.ThumbnailFormat) {
+	case "", "jpeg", "jpg", "webp", "avif":
+	default:
+		errs = append(errs, fmt.Errorf("THUMBNAIL_FORMAT '%s' is not valid. Use 'jpeg', 'webp', or 'avif'", c.ThumbnailFormat))
+	}
+
+	if c.S3OperationTimeoutSeconds <= 0 {
+		errs = append(errs, fmt.Errorf("S3_OPERATION_TIMEOUT_SECONDS must be greater than 0, got %d", c.S3OperationTimeoutSeconds))
+	}
+
+	if _, err := ParseAspectRatio(c.HeroAspectRatio); err != nil {
+		errs = append(errs, fmt.Errorf("HERO_ASPECT_RATIO %w", err))
+	}
+
+	if c.ImageUrlExpirationMinutes <= 0 {
+		errs = append(errs, fmt.Errorf("IMAGE_URL_EXPIRATION_MINUTES must be greater than 0, got %d", c.ImageUrlExpirationMinutes))
+	}
+
+	if c.JpegQuality < 1 || c.JpegQuality > 100 {
+		errs = append(errs, fmt.Errorf("JPEG_QUALITY must be from 1 to 100, got %d", c.JpegQuality))
+	}
+
+	if c.MaxCacheWorkers <= 0 {
+		errs = append(errs, fmt.Errorf("MAX_CACHE_WORKERS must be greater than 0, got %d", c.MaxCacheWorkers))
+	}
+
+	if c.MaxConcurrentZipJobs <= 0 {
+		errs = append(errs, fmt.Errorf("MAX_CONCURRENT_ZIP_JOBS must be greater than 0, got %d", c.MaxConcurrentZipJobs))
+	}
+
+	if c.MaxZipJobsPerClient <= 0 {
+		errs = append(errs, fmt.Errorf("MAX_ZIP_JOBS_PER_CLIENT must be greater than 0, got %d", c.MaxZipJobsPerClient))
+	}
+
+	if c.SessionShortTTL <= 0 {
+		errs = append(errs, fmt.Errorf("SESSION_SHORT_TTL must be greater than 0, got %d", c.SessionShortTTL))
+	}
+
+	if c.SessionRememberTTL <= 0 {
+		errs = append(errs, fmt.Errorf("SESSION_REMEMBER_TTL must be greater than 0, got %d", c.SessionRememberTTL))
+	} else if c.SessionRememberTTL < c.SessionShortTTL {
+		errs = append(errs, fmt.Errorf("SESSION_REMEMBER_TTL must be at least SESSION_SHORT_TTL (%d), got %d", c.SessionShortTTL, c.SessionRememberTTL))
+	}
+
+	if c.ZipCleanupIntervalHours <= 0 {
+		errs = append(errs, fmt.Errorf("ZIP_CLEANUP_INTERVAL_HOURS must be greater than 0, got %d", c.ZipCleanupIntervalHours))
+	}
+
+	if c.ZipPrewarmDays < 0 {
+		errs = append(errs, fmt.Errorf("ZIP_PREWARM_DAYS must be 0 or more, got %d", c.ZipPrewarmDays))
+	}
+
+	if c.ZipPrewarmIntervalMinutes <= 0 {
+		errs = append(errs, fmt.Errorf("ZIP_PREWARM_INTERVAL_MINUTES must be greater than 0, got %d", c.ZipPrewarmIntervalMinutes))
+	}
+
+	if c.CdnBaseURL != "" {
+		if u, err := url.Parse(c.CdnBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("CDN_BASE_URL '%s' must be an http or https URL", c.CdnBaseURL))
+		}
+	}
+
+	for _, source := range strings.Split(c.CspImageSources, ",") {
+		source = strings.TrimSpace(source)
+
+		if source == "" {
+			continue
+		}
+
+		if u, err := url.Parse(source); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("CSP_IMAGE_SOURCES entry '%s' must be an origin such as https://images.example.com", source))
+		}
+	}
+
+	if _, err := ParseTrustedProxies(c.TrustedProxies); err != nil {
+		errs = append(errs, fmt.Errorf("TRUSTED_PROXIES entry %w", err))
+	}
+
+	if c.WebhookURL != "" {
+		if u, err := url.Parse(c.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("WEBHOOK_URL '%s' must be an http or https URL", c.WebhookURL))
+		}
+
+		if c.WebhookSecret == "" {
+			errs = append(errs, errors.New("WEBHOOK_SECRET is required when WEBHOOK_URL is set"))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+/*
+SenderName is the name emails are sent from. It is the site name unless
+FROM_NAME is set.
+*/
+func (c Config) SenderName() string {
+	if c.FromName != "" {
+		return c.FromName
+	}
+
+	return c.SiteName
+}
+
+/*
+Warnings lists settings the app can run with but shouldn't, like the
+default cookie secret.
+*/
+func (c Config) Warnings() []string {
+	result := []string{}
+
+	if c.CookieSecret == DefaultCookieSecret {
+		result = append(result, "COOKIE_SECRET is set to the default value. Sessions can be forged until it is changed")
+	}
+
+	return result
 }
@@ -0,0 +1,218 @@
+package configuration
+
+import (
+	"strings"
+	"testing"
+)
+
+func validConfig() Config {
+	return Config{
+		AwsBucket:                 "adampresleyphotography.com",
+		CookieSecret:              "a-long-random-secret",
+		DownloadExpirationDays:    30,
+		DownloadTokenSecret:       "another-long-random-secret",
+		EmailApiKey:               "re_123",
+		EmailProvider:             "resend",
+		FromEmail:                 "noreply@example.com",
+		HeroAspectRatio:           "16:9",
+		ImageUrlExpirationMinutes: 60,
+		JpegQuality:               85,
+		MaxCacheWorkers:           20,
+		MaxConcurrentZipJobs:      4,
+		MaxZipJobsPerClient:       2,
+		S3OperationTimeoutSeconds: 30,
+		SessionRememberTTL:        720,
+		SessionShortTTL:           24,
+		ZipCleanupIntervalHours:   24,
+		ZipPrewarmIntervalMinutes: 60,
+	}
+}
+
+func TestValidateAcceptsAValidConfig(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(c *Config)
+		wantErr string
+	}{
+		{name: "missing bucket", change: func(c *Config) { c.AwsBucket = "" }, wantErr: "AWS_BUCKET"},
+		{name: "missing cookie secret", change: func(c *Config) { c.CookieSecret = "" }, wantErr: "COOKIE_SECRET"},
+		{name: "missing download token secret", change: func(c *Config) { c.DownloadTokenSecret = "" }, wantErr: "DOWNLOAD_TOKEN_SECRET"},
+		{name: "no s3 operation timeout", change: func(c *Config) { c.S3OperationTimeoutSeconds = 0 }, wantErr: "S3_OPERATION_TIMEOUT_SECONDS"},
+		{name: "resend without an api key", change: func(c *Config) { c.EmailApiKey = "" }, wantErr: "EMAIL_API_KEY"},
+		{name: "blank provider without an api key", change: func(c *Config) { c.EmailProvider = ""; c.EmailApiKey = "" }, wantErr: "EMAIL_API_KEY"},
+		{name: "smtp without a host", change: func(c *Config) { c.EmailProvider = "smtp" }, wantErr: "SMTP_HOST"},
+		{name: "unknown provider", change: func(c *Config) { c.EmailProvider = "pigeon" }, wantErr: "EMAIL_PROVIDER"},
+		{name: "missing from email", change: func(c *Config) { c.FromEmail = "" }, wantErr: "FROM_EMAIL"},
+		{name: "zero expiration days", change: func(c *Config) { c.DownloadExpirationDays = 0 }, wantErr: "DOWNLOAD_EXPIRATION_DAYS"},
+		{name: "negative expiration days", change: func(c *Config) { c.DownloadExpirationDays = -1 }, wantErr: "DOWNLOAD_EXPIRATION_DAYS"},
+		{name: "bad hero aspect ratio", change: func(c *Config) { c.HeroAspectRatio = "wide" }, wantErr: "HERO_ASPECT_RATIO"},
+		{name: "zero image url expiration", change: func(c *Config) { c.ImageUrlExpirationMinutes = 0 }, wantErr: "IMAGE_URL_EXPIRATION_MINUTES"},
+		{name: "zero jpeg quality", change: func(c *Config) { c.JpegQuality = 0 }, wantErr: "JPEG_QUALITY"},
+		{name: "jpeg quality over 100", change: func(c *Config) { c.JpegQuality = 101 }, wantErr: "JPEG_QUALITY"},
+		{name: "zero cache workers", change: func(c *Config) { c.MaxCacheWorkers = 0 }, wantErr: "MAX_CACHE_WORKERS"},
+		{name: "zero concurrent zip jobs", change: func(c *Config) { c.MaxConcurrentZipJobs = 0 }, wantErr: "MAX_CONCURRENT_ZIP_JOBS"},
+		{name: "zero zip jobs per client", change: func(c *Config) { c.MaxZipJobsPerClient = 0 }, wantErr: "MAX_ZIP_JOBS_PER_CLIENT"},
+		{name: "zero short session ttl", change: func(c *Config) { c.SessionShortTTL = 0 }, wantErr: "SESSION_SHORT_TTL"},
+		{name: "negative remember session ttl", change: func(c *Config) { c.SessionRememberTTL = -1 }, wantErr: "SESSION_REMEMBER_TTL"},
+		{name: "remember session shorter than the default", change: func(c *Config) { c.SessionRememberTTL = 12 }, wantErr: "SESSION_REMEMBER_TTL must be at least"},
+		{name: "remember session as long as the default", change: func(c *Config) { c.SessionRememberTTL = 24 }},
+		{name: "zero zip cleanup interval", change: func(c *Config) { c.ZipCleanupIntervalHours = 0 }, wantErr: "ZIP_CLEANUP_INTERVAL_HOURS"},
+		{name: "negative zip prewarm days", change: func(c *Config) { c.ZipPrewarmDays = -1 }, wantErr: "ZIP_PREWARM_DAYS"},
+		{name: "zero zip prewarm interval", change: func(c *Config) { c.ZipPrewarmIntervalMinutes = 0 }, wantErr: "ZIP_PREWARM_INTERVAL_MINUTES"},
+		{name: "relative cdn base url", change: func(c *Config) { c.CdnBaseURL = "cdn.example.com" }, wantErr: "CDN_BASE_URL"},
+		{name: "cdn base url", change: func(c *Config) { c.CdnBaseURL = "https://cdn.example.com" }},
+		{name: "csp image source without a scheme", change: func(c *Config) { c.CspImageSources = "https://a.example.com, images.example.com" }, wantErr: "CSP_IMAGE_SOURCES"},
+		{name: "csp image sources", change: func(c *Config) { c.CspImageSources = "https://a.example.com, https://*.images.example.com" }},
+		{name: "trusted proxy that isn't an ip", change: func(c *Config) { c.TrustedProxies = "10.0.0.0/8, proxy.example.com" }, wantErr: "TRUSTED_PROXIES"},
+		{name: "trusted proxies", change: func(c *Config) { c.TrustedProxies = "10.0.0.0/8, 192.168.1.10, ::1" }},
+		{name: "webhook without a secret", change: func(c *Config) { c.WebhookURL = "https://example.com/hooks" }, wantErr: "WEBHOOK_SECRET"},
+		{name: "webhook that isn't http", change: func(c *Config) { c.WebhookURL = "ftp://example.com/hooks"; c.WebhookSecret = "s" }, wantErr: "WEBHOOK_URL"},
+		{name: "relative webhook", change: func(c *Config) { c.WebhookURL = "/hooks"; c.WebhookSecret = "s" }, wantErr: "WEBHOOK_URL"},
+		{name: "webhook with a secret", change: func(c *Config) { c.WebhookURL = "https://example.com/hooks"; c.WebhookSecret = "s" }},
+		{name: "unknown thumbnail format", change: func(c *Config) { c.ThumbnailFormat = "gif" }, wantErr: "THUMBNAIL_FORMAT"},
+		{name: "avif thumbnails", change: func(c *Config) { c.ThumbnailFormat = "AVIF" }},
+		{name: "smtp with a host", change: func(c *Config) { c.EmailProvider = "SMTP"; c.EmailApiKey = ""; c.SmtpHost = "smtp.example.com" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig()
+			tt.change(&config)
+
+			err := config.Validate()
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want an error mentioning %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	err := Config{EmailProvider: "resend"}.Validate()
+
+	if err == nil {
+		t.Fatalf("Validate() = nil, want an error")
+	}
+
+	for _, want := range []string{"AWS_BUCKET", "COOKIE_SECRET", "EMAIL_API_KEY", "DOWNLOAD_EXPIRATION_DAYS", "MAX_CACHE_WORKERS"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestSenderName(t *testing.T) {
+	config := Config{SiteName: "Jane Doe Photography"}
+
+	if got := config.SenderName(); got != "Jane Doe Photography" {
+		t.Errorf("SenderName() = %q, want the site name", got)
+	}
+
+	config.FromName = "Jane Doe"
+
+	if got := config.SenderName(); got != "Jane Doe" {
+		t.Errorf("SenderName() = %q, want FROM_NAME", got)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	if warnings := validConfig().Warnings(); len(warnings) != 0 {
+		t.Errorf("Warnings() = %v, want none", warnings)
+	}
+
+	config := validConfig()
+	config.CookieSecret = DefaultCookieSecret
+
+	// The default secret is a warning, not an error, so local development still starts
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+
+	if warnings := config.Warnings(); len(warnings) != 1 || !strings.Contains(warnings[0], "COOKIE_SECRET") {
+		t.Errorf("Warnings() = %v, want one about COOKIE_SECRET", warnings)
+	}
+}
+
+func TestParseAspectRatio(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{value: "16:9", want: 16.0 / 9.0},
+		{value: " 3 / 1 ", want: 3},
+		{value: "2.5", want: 2.5},
+		{value: "1:0", wantErr: true},
+		{value: "-4:3", wantErr: true},
+		{value: "wide", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseAspectRatio(tt.value)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAspectRatio(%q) error = %v, want an error %v", tt.value, err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseAspectRatio(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{value: "", want: []string{}},
+		{value: "10.0.0.0/8", want: []string{"10.0.0.0/8"}},
+		{value: " 10.1.2.3/8 , 192.168.1.10,, ::1", want: []string{"10.0.0.0/8", "192.168.1.10/32", "::1/128"}},
+		{value: "::ffff:192.168.1.10", want: []string{"192.168.1.10/32"}},
+		{value: "10.0.0.0/33", wantErr: true},
+		{value: "proxy.example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			prefixes, err := ParseTrustedProxies(tt.value)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTrustedProxies(%q) error = %v, want an error %v", tt.value, err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			got := []string{}
+
+			for _, prefix := range prefixes {
+				got = append(got, prefix.String())
+			}
+
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ParseTrustedProxies(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
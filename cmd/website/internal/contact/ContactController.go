@@ -0,0 +1,231 @@
+package contact
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/email"
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/rendering"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/requestlog"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/viewmodels"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+)
+
+const (
+	// HoneypotField is hidden from people by the form's CSS. Anything filled in here came from a bot
+	HoneypotField = "website"
+
+	maxNameLength    = 100
+	maxMessageLength = 5000
+
+	defaultRateLimit  = 5
+	defaultRateWindow = time.Hour
+)
+
+type ContactHandlers interface {
+	ContactAction(w http.ResponseWriter, r *http.Request)
+	ContactPage(w http.ResponseWriter, r *http.Request)
+}
+
+type ContactControllerConfig struct {
+	Branding     viewmodels.Branding
+	ContactEmail string
+	EmailSender  services.EmailSender
+	FromEmail    string
+	FromName     string
+	RateLimit    int
+	RateWindow   time.Duration
+	Renderer     rendering.TemplateRenderer
+}
+
+type ContactController struct {
+	branding     viewmodels.Branding
+	contactEmail string
+	emailSender  services.EmailSender
+	fromEmail    string
+	fromName     string
+	limiter      *rateLimiter
+	renderer     rendering.TemplateRenderer
+}
+
+func NewContactController(config ContactControllerConfig) ContactController {
+	if config.RateLimit <= 0 {
+		config.RateLimit = defaultRateLimit
+	}
+
+	if config.RateWindow <= 0 {
+		config.RateWindow = defaultRateWindow
+	}
+
+	return ContactController{
+		branding:     config.Branding,
+		contactEmail: config.ContactEmail,
+		emailSender:  config.EmailSender,
+		fromEmail:    config.FromEmail,
+		fromName:     config.FromName,
+		limiter:      newRateLimiter(config.RateLimit, config.RateWindow),
+		renderer:     config.Renderer,
+	}
+}
+
+/*
+GET /contact
+*/
+func (c ContactController) ContactPage(w http.ResponseWriter, r *http.Request) {
+	viewData := viewmodels.ContactPage{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Branding: c.branding,
+			IsHtmx:   httphelpers.IsHtmx(r),
+		},
+	}
+
+	c.renderer.Render("pages/contact", viewData, w)
+}
+
+/*
+POST /contact
+
+Emails an inquiry to the photographer. The visitor's address is set as the
+reply-to so the inquiry can be answered directly. Submissions that fill in
+the honeypot field get the thank-you page without anything being sent, so
+bots can't tell they were caught.
+*/
+func (c ContactController) ContactAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	pageName := "pages/contact"
+
+	viewData := viewmodels.ContactPage{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Branding: c.branding,
+			IsHtmx:   httphelpers.IsHtmx(r),
+		},
+		Name:    strings.TrimSpace(httphelpers.GetFromRequest[string](r, "name")),
+		Email:   strings.TrimSpace(httphelpers.GetFromRequest[string](r, "email")),
+		Inquiry: strings.TrimSpace(httphelpers.GetFromRequest[string](r, "message")),
+	}
+
+	if httphelpers.GetFromRequest[string](r, HoneypotField) != "" {
+		requestlog.Logger(r).Warn("ignoring contact form submission that filled in the honeypot")
+		viewData.Sent = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	if message := validate(viewData); message != "" {
+		viewData.IsWarning = true
+		viewData.Message = message
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	if !c.limiter.allow(visitorKey(r), time.Now()) {
+		requestlog.Logger(r).Warn("contact form submission rate limited", "visitor", visitorKey(r))
+		viewData.IsWarning = true
+		viewData.Message = "You've sent several messages recently. Please wait a while before sending another."
+
+		w.WriteHeader(http.StatusTooManyRequests)
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	if c.contactEmail == "" {
+		requestlog.Logger(r).Error("contact form submitted but no contact email is configured")
+		viewData.IsError = true
+		viewData.Message = "Sorry, messages can't be sent right now. Please email me directly."
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	if err = c.emailSender.Send(c.inquiryEmail(viewData)); err != nil {
+		requestlog.Logger(r).Error("error sending contact form inquiry", "error", err)
+		viewData.IsError = true
+		viewData.Message = "Sorry, there was a problem sending your message. Please try again later."
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	requestlog.Logger(r).Info("contact form inquiry sent")
+
+	viewData.Sent = true
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+validate returns a message describing what's wrong with a submission, or
+an empty string when it's fine.
+*/
+func validate(inquiry viewmodels.ContactPage) string {
+	switch {
+	case inquiry.Name == "":
+		return "Please enter your name."
+
+	case len(inquiry.Name) > maxNameLength:
+		return fmt.Sprintf("Please keep your name under %d characters.", maxNameLength)
+
+	case strings.ContainsAny(inquiry.Name, "\r\n"):
+		return "Please enter your name on a single line."
+
+	case !isPlainEmailAddress(inquiry.Email):
+		return "Please enter a valid email address."
+
+	case inquiry.Inquiry == "":
+		return "Please enter a message."
+
+	case len(inquiry.Inquiry) > maxMessageLength:
+		return fmt.Sprintf("Please keep your message under %d characters.", maxMessageLength)
+	}
+
+	return ""
+}
+
+/*
+isPlainEmailAddress accepts a bare address like jane@example.com. Forms
+with a display name are turned away since the address ends up in the
+reply-to header.
+*/
+func isPlainEmailAddress(value string) bool {
+	address, err := mail.ParseAddress(value)
+	return err == nil && address.Address == value
+}
+
+func (c ContactController) inquiryEmail(inquiry viewmodels.ContactPage) services.EmailMessage {
+	subject := fmt.Sprintf("Photography inquiry from %s", inquiry.Name)
+
+	textBody := fmt.Sprintf("Name: %s\r\nEmail: %s\r\n\r\n%s\r\n", inquiry.Name, inquiry.Email, inquiry.Inquiry)
+
+	htmlBody := fmt.Sprintf(
+		"<p><strong>Name:</strong> %s<br />\n<strong>Email:</strong> %s</p>\n<p>%s</p>\n",
+		template.HTMLEscapeString(inquiry.Name),
+		template.HTMLEscapeString(inquiry.Email),
+		strings.ReplaceAll(template.HTMLEscapeString(inquiry.Inquiry), "\n", "<br />\n"),
+	)
+
+	return services.EmailMessage{
+		From: email.EmailAddress{
+			Email: c.fromEmail,
+			Name:  c.fromName,
+		},
+		HtmlBody: htmlBody,
+		ReplyTo: &email.EmailAddress{
+			Email: inquiry.Email,
+			Name:  inquiry.Name,
+		},
+		Subject:  subject,
+		TextBody: textBody,
+		To: []email.EmailAddress{
+			{Email: c.contactEmail},
+		},
+	}
+}
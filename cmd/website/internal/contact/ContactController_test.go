@@ -0,0 +1,276 @@
+package contact
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/viewmodels"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+)
+
+// recordingEmailSender keeps sent messages, failing every send when err is set
+type recordingEmailSender struct {
+	err  error
+	sent []services.EmailMessage
+}
+
+func (s *recordingEmailSender) Send(mail services.EmailMessage) error {
+	s.sent = append(s.sent, mail)
+	return s.err
+}
+
+// fakeRenderer keeps the view data it was asked to render
+type fakeRenderer struct {
+	data *viewmodels.ContactPage
+}
+
+func (f fakeRenderer) Render(templateName string, data any, w io.Writer) error {
+	*f.data = data.(viewmodels.ContactPage)
+	return nil
+}
+
+func (f fakeRenderer) RenderString(templateString string, data any, w io.Writer) error {
+	return nil
+}
+
+func newTestController(sender *recordingEmailSender, viewData *viewmodels.ContactPage) ContactController {
+	return NewContactController(ContactControllerConfig{
+		Branding:     viewmodels.Branding{SiteName: "Jane Doe Photography", LogoPath: "/static/images/jane.png"},
+		ContactEmail: "adam@example.com",
+		EmailSender:  sender,
+		FromEmail:    "noreply@example.com",
+		FromName:     "Website",
+		Renderer:     fakeRenderer{data: viewData},
+	})
+}
+
+func postContact(controller ContactController, form url.Values, remoteAddr string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/contact", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.RemoteAddr = remoteAddr
+
+	w := httptest.NewRecorder()
+	controller.ContactAction(w, r)
+	return w
+}
+
+func validForm() url.Values {
+	return url.Values{
+		"name":    {"Jane Doe"},
+		"email":   {"jane@example.com"},
+		"message": {"I'd like to book senior portraits.\r\nAre you free in May?"},
+	}
+}
+
+func TestContactSendsTheInquiry(t *testing.T) {
+	sender := &recordingEmailSender{}
+	viewData := viewmodels.ContactPage{}
+
+	w := postContact(newTestController(sender, &viewData), validForm(), "203.0.113.7:5000")
+
+	if w.Code != http.StatusOK || !viewData.Sent || viewData.IsError || viewData.IsWarning {
+		t.Fatalf("status = %d, view = %+v; want the thank-you page", w.Code, viewData)
+	}
+
+	if len(sender.sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(sender.sent))
+	}
+
+	mail := sender.sent[0]
+
+	if len(mail.To) != 1 || mail.To[0].Email != "adam@example.com" {
+		t.Errorf("to = %+v, want adam@example.com", mail.To)
+	}
+
+	if mail.ReplyTo == nil || mail.ReplyTo.Email != "jane@example.com" || mail.ReplyTo.Name != "Jane Doe" {
+		t.Errorf("reply-to = %+v, want Jane Doe <jane@example.com>", mail.ReplyTo)
+	}
+
+	if !strings.Contains(mail.Subject, "Jane Doe") || !strings.Contains(mail.TextBody, "Are you free in May?") {
+		t.Errorf("subject = %q, text = %q; want the name and message", mail.Subject, mail.TextBody)
+	}
+}
+
+func TestContactCarriesTheBranding(t *testing.T) {
+	sender := &recordingEmailSender{}
+	viewData := viewmodels.ContactPage{}
+	controller := newTestController(sender, &viewData)
+
+	controller.ContactPage(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/contact", nil))
+
+	if viewData.Branding.SiteName != "Jane Doe Photography" || viewData.Branding.LogoPath != "/static/images/jane.png" {
+		t.Errorf("branding = %+v, want the configured branding", viewData.Branding)
+	}
+
+	postContact(controller, validForm(), "203.0.113.7:5000")
+
+	if len(sender.sent) != 1 || sender.sent[0].From.Email != "noreply@example.com" || sender.sent[0].From.Name != "Website" {
+		t.Fatalf("sent %+v, want one email from Website <noreply@example.com>", sender.sent)
+	}
+
+	if viewData.Branding.SiteName != "Jane Doe Photography" {
+		t.Errorf("thank-you page branding = %+v, want the configured branding", viewData.Branding)
+	}
+}
+
+func TestContactEscapesTheHtmlBody(t *testing.T) {
+	sender := &recordingEmailSender{}
+	viewData := viewmodels.ContactPage{}
+
+	form := validForm()
+	form.Set("message", "<script>alert(1)</script>")
+
+	postContact(newTestController(sender, &viewData), form, "203.0.113.7:5000")
+
+	if len(sender.sent) != 1 || strings.Contains(sender.sent[0].HtmlBody, "<script>") {
+		t.Errorf("html body = %q, want the message escaped", sender.sent[0].HtmlBody)
+	}
+}
+
+func TestContactHoneypotSendsNothing(t *testing.T) {
+	sender := &recordingEmailSender{}
+	viewData := viewmodels.ContactPage{}
+
+	form := validForm()
+	form.Set(HoneypotField, "https://spam.example.com")
+
+	w := postContact(newTestController(sender, &viewData), form, "203.0.113.7:5000")
+
+	if len(sender.sent) != 0 {
+		t.Errorf("sent %d emails, want none", len(sender.sent))
+	}
+
+	// Bots get the same thank-you page so they can't tell they were caught
+	if w.Code != http.StatusOK || !viewData.Sent {
+		t.Errorf("status = %d, sent = %v; want the thank-you page", w.Code, viewData.Sent)
+	}
+}
+
+func TestContactValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		value string
+	}{
+		{name: "missing name", field: "name", value: "  "},
+		{name: "long name", field: "name", value: strings.Repeat("a", maxNameLength+1)},
+		{name: "name with a line break", field: "name", value: "Jane\nBcc: everyone@example.com"},
+		{name: "missing email", field: "email", value: ""},
+		{name: "bad email", field: "email", value: "jane at example"},
+		{name: "email with a display name", field: "email", value: "Jane <jane@example.com>"},
+		{name: "missing message", field: "message", value: ""},
+		{name: "long message", field: "message", value: strings.Repeat("a", maxMessageLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &recordingEmailSender{}
+			viewData := viewmodels.ContactPage{}
+
+			form := validForm()
+			form.Set(tt.field, tt.value)
+
+			postContact(newTestController(sender, &viewData), form, "203.0.113.7:5000")
+
+			if len(sender.sent) != 0 {
+				t.Errorf("sent %d emails, want none", len(sender.sent))
+			}
+
+			if viewData.Sent || !viewData.IsWarning || viewData.Message == "" {
+				t.Errorf("view = %+v, want a warning and the form", viewData)
+			}
+
+			// What the visitor typed is kept so they don't have to start over
+			if tt.field != "message" && viewData.Inquiry != validForm().Get("message") {
+				t.Errorf("inquiry = %q, want what was typed kept", viewData.Inquiry)
+			}
+		})
+	}
+}
+
+func TestContactIsRateLimited(t *testing.T) {
+	sender := &recordingEmailSender{}
+	viewData := viewmodels.ContactPage{}
+	controller := newTestController(sender, &viewData)
+
+	for i := 0; i < defaultRateLimit; i++ {
+		if w := postContact(controller, validForm(), "203.0.113.7:5000"); w.Code != http.StatusOK {
+			t.Fatalf("submission %d status = %d, want %d", i+1, w.Code, http.StatusOK)
+		}
+	}
+
+	if w := postContact(controller, validForm(), "203.0.113.7:5001"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+
+	// Someone else can still get through
+	if w := postContact(controller, validForm(), "198.51.100.2:5000"); w.Code != http.StatusOK {
+		t.Errorf("other visitor status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	if len(sender.sent) != defaultRateLimit+1 {
+		t.Errorf("sent %d emails, want %d", len(sender.sent), defaultRateLimit+1)
+	}
+}
+
+func TestContactReportsSendFailures(t *testing.T) {
+	sender := &recordingEmailSender{err: errors.New("provider is down")}
+	viewData := viewmodels.ContactPage{}
+
+	postContact(newTestController(sender, &viewData), validForm(), "203.0.113.7:5000")
+
+	if viewData.Sent || !viewData.IsError {
+		t.Errorf("view = %+v, want an error", viewData)
+	}
+}
+
+func TestRateLimiterWindow(t *testing.T) {
+	limiter := newRateLimiter(2, time.Hour)
+	start := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	if !limiter.allow("a", start) || !limiter.allow("a", start.Add(time.Minute)) {
+		t.Fatalf("the first two submissions were turned away")
+	}
+
+	if limiter.allow("a", start.Add(2*time.Minute)) {
+		t.Errorf("a third submission within the hour was allowed")
+	}
+
+	if !limiter.allow("a", start.Add(time.Hour+time.Second)) {
+		t.Errorf("a submission after the first one aged out was turned away")
+	}
+}
+
+func TestVisitorKey(t *testing.T) {
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{name: "direct", remoteAddr: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "behind a proxy", remoteAddr: "10.0.0.1:5000", forwardedFor: "198.51.100.9", want: "198.51.100.9"},
+		{name: "spoofed entry", remoteAddr: "10.0.0.1:5000", forwardedFor: "1.2.3.4, 198.51.100.9", want: "198.51.100.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/contact", nil)
+			r.RemoteAddr = tt.remoteAddr
+
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+
+			if got := visitorKey(r); got != tt.want {
+				t.Errorf("visitorKey = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package contact
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+rateLimiter allows each visitor a number of submissions within a sliding
+window. It is kept in memory, so limits reset when the server restarts and
+aren't shared between instances, which is enough to slow down a bot
+hammering the form.
+*/
+type rateLimiter struct {
+	mu          sync.Mutex
+	limit       int
+	window      time.Duration
+	submissions map[string][]time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:       limit,
+		window:      window,
+		submissions: map[string][]time.Time{},
+	}
+}
+
+/*
+allow records a submission from key and reports whether it is within the
+limit. Submissions that are turned away aren't counted.
+*/
+func (l *rateLimiter) allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-l.window)
+
+	// Sweep every visitor so the map doesn't grow forever
+	for k, times := range l.submissions {
+		recent := times[:0]
+
+		for _, t := range times {
+			if t.After(cutoff) {
+				recent = append(recent, t)
+			}
+		}
+
+		if len(recent) == 0 {
+			delete(l.submissions, k)
+			continue
+		}
+
+		l.submissions[k] = recent
+	}
+
+	if len(l.submissions[key]) >= l.limit {
+		return false
+	}
+
+	l.submissions[key] = append(l.submissions[key], now)
+	return true
+}
+
+/*
+visitorKey identifies who sent a request for rate limiting. Behind a proxy
+every request comes from the proxy, so the last X-Forwarded-For entry, the
+one the proxy added, is used instead. Earlier entries come from the visitor
+and can't be trusted.
+*/
+func visitorKey(r *http.Request) string {
+	if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+		entries := strings.Split(forwardedFor, ",")
+		return strings.TrimSpace(entries[len(entries)-1])
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
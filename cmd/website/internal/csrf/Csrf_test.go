@@ -0,0 +1,115 @@
+package csrf
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	handler := NewMiddleware("admin-token")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name          string
+		method        string
+		authorization string
+		cookie        string
+		header        string
+		wantStatus    int
+	}{
+		{name: "safe method", method: http.MethodGet, wantStatus: http.StatusNoContent},
+		{name: "matching token", method: http.MethodPost, cookie: "abc", header: "abc", wantStatus: http.StatusNoContent},
+		{name: "missing token", method: http.MethodPost, cookie: "abc", wantStatus: http.StatusForbidden},
+		{name: "wrong token", method: http.MethodPost, cookie: "abc", header: "xyz", wantStatus: http.StatusForbidden},
+		{name: "admin bearer token", method: http.MethodPost, authorization: "Bearer admin-token", wantStatus: http.StatusNoContent},
+		{name: "wrong bearer token", method: http.MethodPost, authorization: "Bearer guess", wantStatus: http.StatusForbidden},
+		{name: "basic credentials", method: http.MethodPost, authorization: "Basic dXNlcjpwYXNz", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: CookieName, Value: tt.cookie})
+			}
+
+			if tt.header != "" {
+				r.Header.Set(HeaderName, tt.header)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestMiddlewareWithoutBearerTokenExemptsNothing(t *testing.T) {
+	handler := NewMiddleware("")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Authorization", "Bearer ")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestCookieIsSecureOverHTTPS(t *testing.T) {
+	handler := NewMiddleware("")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name       string
+		tls        bool
+		proto      string
+		wantSecure bool
+	}{
+		{name: "plain http", wantSecure: false},
+		{name: "direct tls", tls: true, wantSecure: true},
+		{name: "behind a tls proxy", proto: "https", wantSecure: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			cookie := w.Header().Get("Set-Cookie")
+
+			if !strings.HasPrefix(cookie, CookieName+"=") {
+				t.Fatalf("Set-Cookie = %q, want a %s cookie", cookie, CookieName)
+			}
+
+			if got := strings.Contains(cookie, "; Secure"); got != tt.wantSecure {
+				t.Errorf("Set-Cookie = %q, secure = %v, want %v", cookie, got, tt.wantSecure)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package home
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/geturloptions"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/cache"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/requestlog"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/viewmodels"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+)
+
+const (
+	// defaultFeedCacheTTL is how long a built feed is served before S3 is listed again
+	defaultFeedCacheTTL = 5 * time.Minute
+
+	// defaultFeedItemCount is how many of the newest photos are in the feed
+	defaultFeedItemCount = 20
+
+	jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+)
+
+/*
+feedCache keeps the newest photos for ttl so busy feed readers don't list
+the bucket on every request. Builds are
+serialized, so only one request lists S3 when the feed expires.
+*/
+type feedCache struct {
+	mu        sync.Mutex
+	photos    []viewmodels.HomePagePhoto
+	expiresAt time.Time
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	Title         string `json:"title"`
+	ContentHTML   string `json:"content_html"`
+	Image         string `json:"image"`
+	DatePublished string `json:"date_published"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+/*
+GET /feed.json
+
+A JSON Feed of the newest home page photos, for followers and search
+engines. The feed is public and cached for a few minutes.
+*/
+func (c HomeController) JSONFeed(w http.ResponseWriter, r *http.Request) {
+	photos, ok := c.feedPhotos(w, r)
+
+	if !ok {
+		return
+	}
+
+	baseURL := siteURL(r)
+
+	result := jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       c.branding.SiteName,
+		HomePageURL: baseURL + "/",
+		FeedURL:     baseURL + "/feed.json",
+		Items:       make([]jsonFeedItem, 0, len(photos)),
+	}
+
+	for _, photo := range photos {
+		result.Items = append(result.Items, jsonFeedItem{
+			ID:            photo.FileName,
+			URL:           photoURL(baseURL, "original", photo.FileName),
+			Title:         photo.FileName,
+			ContentHTML:   feedItemHTML(baseURL, photo),
+			Image:         photoURL(baseURL, "thumbnail", photo.FileName),
+			DatePublished: photo.CapturedAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		requestlog.Logger(r).Error("error writing JSON feed", "error", err)
+	}
+}
+
+/*
+GET /feed.xml
+
+The same photos as JSONFeed, as RSS 2.0 for readers that don't support
+JSON Feed.
+*/
+func (c HomeController) RSSFeed(w http.ResponseWriter, r *http.Request) {
+	photos, ok := c.feedPhotos(w, r)
+
+	if !ok {
+		return
+	}
+
+	baseURL := siteURL(r)
+
+	result := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       c.branding.SiteName,
+			Link:        baseURL + "/",
+			Description: "Recent photos from " + c.branding.SiteName,
+			Items:       make([]rssItem, 0, len(photos)),
+		},
+	}
+
+	for _, photo := range photos {
+		result.Channel.Items = append(result.Channel.Items, rssItem{
+			Title:       photo.FileName,
+			Link:        photoURL(baseURL, "original", photo.FileName),
+			GUID:        rssGUID{Value: photo.FileName},
+			PubDate:     photo.CapturedAt.UTC().Format(time.RFC1123Z),
+			Description: feedItemHTML(baseURL, photo),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	_, _ = w.Write([]byte(xml.Header))
+
+	if err := xml.NewEncoder(w).Encode(result); err != nil {
+		requestlog.Logger(r).Error("error writing RSS feed", "error", err)
+	}
+}
+
+/*
+GET /photos/{size}/{filename}
+
+Feed items link here rather than straight to S3, since readers keep items
+long after a presigned URL would expire. Redirects to the photo through the
+CDN when one is configured, or to a freshly presigned URL. Hidden photos
+aren't served.
+*/
+func (c HomeController) Photo(w http.ResponseWriter, r *http.Request) {
+	size := httphelpers.GetFromRequest[string](r, "size")
+	fileName := filepath.Base(httphelpers.GetFromRequest[string](r, "filename"))
+
+	if (size != "thumbnail" && size != "original") || fileName == "." || c.getFlags(r)[fileName].Hidden {
+		httphelpers.WriteText(w, http.StatusNotFound, "Photo not found")
+		return
+	}
+
+	key := filepath.Join(c.homePagePhotoFolder, size, fileName)
+	u, err := services.ImageURL(c.s3Client, c.awsBucket, c.cdnBaseURL, key, geturloptions.WithExpiration(c.imageUrlExpiration))
+
+	if err != nil {
+		requestlog.Logger(r).Error("error getting URL for a feed photo", "error", err, "key", key)
+		httphelpers.TextInternalServerError(w, "There was a problem getting the photo")
+		return
+	}
+
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+/*
+feedPhotos returns the photos for a feed and sets how long the response may
+be cached. When the feed can't be built an error is written and ok is
+false.
+*/
+func (c HomeController) feedPhotos(w http.ResponseWriter, r *http.Request) ([]viewmodels.HomePagePhoto, bool) {
+	photos, expiresAt, err := c.getFeedPhotos(r)
+
+	if err != nil {
+		requestlog.Logger(r).Error("error getting photos for the feed", "error", err, "bucket", c.awsBucket, "prefix", c.homePagePhotoFolder)
+		httphelpers.TextInternalServerError(w, "There was a problem getting the feed")
+		return nil, false
+	}
+
+	maxAge := max(int(expiresAt.Sub(c.clock.Now()).Seconds()), 0)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+
+	return photos, true
+}
+
+/*
+getFeedPhotos returns the newest photos from the cache, building the feed
+when it has expired. If building fails, the last feed is served until the
+next attempt rather than failing. Returns when the photos expire.
+*/
+func (c HomeController) getFeedPhotos(r *http.Request) ([]viewmodels.HomePagePhoto, time.Time, error) {
+	c.feed.mu.Lock()
+	defer c.feed.mu.Unlock()
+
+	now := c.clock.Now()
+
+	if c.feed.photos != nil && now.Before(c.feed.expiresAt) {
+		return c.feed.photos, c.feed.expiresAt, nil
+	}
+
+	photos, err := c.newestPhotos(r)
+
+	if err != nil {
+		if c.feed.photos == nil {
+			return nil, time.Time{}, err
+		}
+
+		requestlog.Logger(r).Error("error refreshing the feed. serving the last one", "error", err)
+		photos = c.feed.photos
+	}
+
+	c.feed.photos = photos
+	c.feed.expiresAt = now.Add(c.feedCacheTTL)
+
+	return c.feed.photos, c.feed.expiresAt, nil
+}
+
+/*
+newestPhotos lists every home page photo, using the same listing and
+cached fallback as the home page, and returns the most recently uploaded.
+Hidden photos are left out. Dates are when the
+original was uploaded, since that is when a photo was added to the site.
+*/
+func (c HomeController) newestPhotos(r *http.Request) ([]viewmodels.HomePagePhoto, error) {
+	var (
+		err        error
+		thumbnails []s3.Object
+		originals  []s3.Object
+	)
+
+	// The photos are shared by every request until they expire, so one reader hanging up doesn't cancel the listing
+	ctx, cancel := context.WithTimeout(context.Background(), c.s3OperationTimeout)
+	defer cancel()
+
+	everything := func(objects []s3.Object) bool { return false }
+
+	if thumbnails, _, _, err = c.listFolderOrCached(ctx, r, "thumbnail", everything); err != nil {
+		return nil, err
+	}
+
+	if originals, _, _, err = c.listFolderOrCached(ctx, r, "original", everything); err != nil {
+		return nil, err
+	}
+
+	photos := pairPhotos(thumbnails, originals, c.getFlags(r), cache.CaptureDates{})
+	sortByCaptureDate(photos)
+
+	return photos[:min(len(photos), c.feedItemCount)], nil
+}
+
+// photoURL is the lasting link to a home page photo, served by Photo
+func photoURL(baseURL, size, fileName string) string {
+	return baseURL + "/photos/" + size + "/" + url.PathEscape(fileName)
+}
+
+func feedItemHTML(baseURL string, photo viewmodels.HomePagePhoto) string {
+	return fmt.Sprintf(`<img src="%s" alt="%s" />`, html.EscapeString(photoURL(baseURL, "thumbnail", photo.FileName)), html.EscapeString(photo.FileName))
+}
+
+/*
+siteURL is the scheme and host the request was made to, for the absolute
+links a feed needs. Behind a proxy the scheme comes from X-Forwarded-Proto.
+*/
+func siteURL(r *http.Request) string {
+	scheme := "http"
+
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
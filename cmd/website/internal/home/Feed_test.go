@@ -0,0 +1,225 @@
+package home
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/viewmodels"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+// fakeClock is a clock tests move by hand
+type fakeClock struct {
+	now *time.Time
+}
+
+func (f fakeClock) Now() time.Time {
+	return *f.now
+}
+
+func newFeedController(s3Client fakeS3Client, now *time.Time, flags map[string]models.HomePagePhotoFlag) HomeController {
+	return NewHomeController(HomeControllerConfig{
+		AwsBucket:            "bucket",
+		Branding:             viewmodels.Branding{SiteName: "Adam Presley Photography"},
+		Clock:                fakeClock{now: now},
+		FeedCacheTTL:         5 * time.Minute,
+		FeedItemCount:        2,
+		HomePagePhotoFolder:  "home-page",
+		HomePagePhotoService: fakeHomePagePhotoService{flags: flags},
+		S3Client:             s3Client,
+	})
+}
+
+func TestJSONFeedListsTheNewestPhotos(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 12, 0, 0, 0, time.UTC) }
+	now := day(30)
+
+	s3Client := fakeS3Client{
+		fileNames: []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"},
+		modified:  map[string]time.Time{"a.jpg": day(1), "b.jpg": day(9), "c.jpg": day(5), "d.jpg": day(20)},
+	}
+
+	controller := newFeedController(s3Client, &now, map[string]models.HomePagePhotoFlag{"d.jpg": {FileName: "d.jpg", Hidden: true}})
+
+	r := httptest.NewRequest(http.MethodGet, "/feed.json", nil)
+	r.Host = "adampresleyphotography.com"
+	r.Header.Set("X-Forwarded-Proto", "https")
+
+	w := httptest.NewRecorder()
+	controller.JSONFeed(w, r)
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/feed+json; charset=utf-8" {
+		t.Fatalf("status = %d, Content-Type = %q; want a JSON feed", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	got := jsonFeed{}
+
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("error decoding feed: %v", err)
+	}
+
+	if got.Version != jsonFeedVersion || got.Title != "Adam Presley Photography" || got.FeedURL != "https://adampresleyphotography.com/feed.json" {
+		t.Errorf("feed = %+v, want the site's JSON feed", got)
+	}
+
+	// The hidden photo is left out and only the two newest of the rest are listed
+	ids := []string{}
+
+	for _, item := range got.Items {
+		ids = append(ids, item.ID)
+	}
+
+	if !slices.Equal(ids, []string{"b.jpg", "c.jpg"}) {
+		t.Fatalf("items = %v, want [b.jpg c.jpg]", ids)
+	}
+
+	// Items link to the site rather than to URLs that expire
+	want := jsonFeedItem{
+		ID:            "b.jpg",
+		URL:           "https://adampresleyphotography.com/photos/original/b.jpg",
+		Title:         "b.jpg",
+		ContentHTML:   `<img src="https://adampresleyphotography.com/photos/thumbnail/b.jpg" alt="b.jpg" />`,
+		Image:         "https://adampresleyphotography.com/photos/thumbnail/b.jpg",
+		DatePublished: "2024-03-09T12:00:00Z",
+	}
+
+	if got.Items[0] != want {
+		t.Errorf("first item = %+v, want %+v", got.Items[0], want)
+	}
+}
+
+func TestRSSFeedListsTheSamePhotos(t *testing.T) {
+	now := time.Date(2024, 3, 30, 12, 0, 0, 0, time.UTC)
+
+	s3Client := fakeS3Client{
+		fileNames: []string{"a.jpg", "b.jpg"},
+		modified:  map[string]time.Time{"a.jpg": now.AddDate(0, 0, -1), "b.jpg": now.AddDate(0, 0, -2)},
+	}
+
+	controller := newFeedController(s3Client, &now, nil)
+
+	w := httptest.NewRecorder()
+	controller.RSSFeed(w, httptest.NewRequest(http.MethodGet, "/feed.xml", nil))
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/rss+xml; charset=utf-8" {
+		t.Fatalf("status = %d, Content-Type = %q; want an RSS feed", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	got := rssFeed{}
+
+	if err := xml.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("error decoding feed: %v", err)
+	}
+
+	if len(got.Channel.Items) != 2 || got.Channel.Items[0].GUID.Value != "a.jpg" || got.Channel.Items[0].PubDate != "Fri, 29 Mar 2024 12:00:00 +0000" {
+		t.Fatalf("items = %+v, want a.jpg then b.jpg", got.Channel.Items)
+	}
+
+	if got.Channel.Items[0].Link != "http://example.com/photos/original/a.jpg" {
+		t.Errorf("link = %q, want the photo's page on the site", got.Channel.Items[0].Link)
+	}
+
+	if got.Channel.Link != "http://example.com/" {
+		t.Errorf("link = %q, want the site the request was made to", got.Channel.Link)
+	}
+}
+
+func TestFeedIsCachedBriefly(t *testing.T) {
+	now := time.Date(2024, 3, 30, 12, 0, 0, 0, time.UTC)
+
+	s3Client := fakeS3Client{
+		fileNames: []string{"a.jpg"},
+		listed:    map[string]int{},
+	}
+
+	controller := newFeedController(s3Client, &now, nil)
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		controller.JSONFeed(w, httptest.NewRequest(http.MethodGet, "/feed.json", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+
+		return w
+	}
+
+	if w := get(); w.Header().Get("Cache-Control") != "public, max-age=300" {
+		t.Errorf("Cache-Control = %q, want the full TTL", w.Header().Get("Cache-Control"))
+	}
+
+	// Within the TTL the feed comes from the cache, for both formats
+	now = now.Add(4 * time.Minute)
+
+	if w := get(); w.Header().Get("Cache-Control") != "public, max-age=60" {
+		t.Errorf("Cache-Control = %q, want what is left of the TTL", w.Header().Get("Cache-Control"))
+	}
+
+	controller.RSSFeed(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/feed.xml", nil))
+
+	if got := s3Client.listed["home-page/thumbnail"]; got != 1 {
+		t.Errorf("thumbnails listed %d times within the TTL, want 1", got)
+	}
+
+	// Once it expires S3 is listed again
+	now = now.Add(2 * time.Minute)
+	get()
+
+	if got := s3Client.listed["home-page/thumbnail"]; got != 2 {
+		t.Errorf("thumbnails listed %d times after the TTL, want 2", got)
+	}
+}
+
+func TestPhotoRedirectsToAFreshURL(t *testing.T) {
+	var expiration time.Duration
+
+	controller := NewHomeController(HomeControllerConfig{
+		AwsBucket:            "bucket",
+		HomePagePhotoFolder:  "home-page",
+		HomePagePhotoService: fakeHomePagePhotoService{flags: map[string]models.HomePagePhotoFlag{"hidden.jpg": {FileName: "hidden.jpg", Hidden: true}}},
+		ImageUrlExpiration:   10 * time.Minute,
+		S3Client:             fakeS3Client{expiration: &expiration},
+	})
+
+	tests := []struct {
+		name         string
+		size         string
+		fileName     string
+		wantStatus   int
+		wantLocation string
+	}{
+		{name: "thumbnail", size: "thumbnail", fileName: "a.jpg", wantStatus: http.StatusFound, wantLocation: "https://cdn.example.com/home-page/thumbnail/a.jpg"},
+		{name: "original", size: "original", fileName: "a.jpg", wantStatus: http.StatusFound, wantLocation: "https://cdn.example.com/home-page/original/a.jpg"},
+		{name: "hidden photo", size: "original", fileName: "hidden.jpg", wantStatus: http.StatusNotFound},
+		{name: "unknown size", size: "huge", fileName: "a.jpg", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/photos/"+tt.size+"/"+tt.fileName, nil)
+			r.SetPathValue("size", tt.size)
+			r.SetPathValue("filename", tt.fileName)
+
+			w := httptest.NewRecorder()
+			controller.Photo(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+
+	if expiration != 10*time.Minute {
+		t.Errorf("presigned URL expires in %v, want %v", expiration, 10*time.Minute)
+	}
+}
@@ -1,103 +1,509 @@
 package home
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log/slog"
 	"net/http"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/adampresley/adamgokit/httphelpers"
 	"github.com/adampresley/adamgokit/rendering"
 	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/geturloptions"
 	"github.com/adampresley/adamgokit/s3/listoptions"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/cache"
 	"github.com/adampresley/adampresleyphotography/cmd/website/internal/configuration"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/requestlog"
 	"github.com/adampresley/adampresleyphotography/cmd/website/internal/viewmodels"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+	"github.com/rfberaldo/sqlz"
+)
+
+const (
+	// defaultInitialCount is how many photos are shown before scrolling loads more
+	defaultInitialCount = 24
 )
 
 type HomeHandlers interface {
 	HomePage(w http.ResponseWriter, r *http.Request)
+	HomePhotos(w http.ResponseWriter, r *http.Request)
+	JSONFeed(w http.ResponseWriter, r *http.Request)
+	Photo(w http.ResponseWriter, r *http.Request)
+	RSSFeed(w http.ResponseWriter, r *http.Request)
+	Sitemap(w http.ResponseWriter, r *http.Request)
 }
 
 type HomeControllerConfig struct {
-	AwsBucket           string
-	HomePagePhotoFolder string
-	Config              *configuration.Config
-	Renderer            rendering.TemplateRenderer
-	S3Client            s3.S3Client
+	AwsBucket            string
+	Branding             viewmodels.Branding
+	CdnBaseURL           string
+	Clock                services.Clock
+	FeedCacheTTL         time.Duration
+	FeedItemCount        int
+	HomePagePhotoFolder  string
+	HomePagePhotoService services.HomePagePhotoServicer
+	Config               *configuration.Config
+	ImageUrlExpiration   time.Duration
+	InitialCount         int
+	Renderer             rendering.TemplateRenderer
+	S3Client             s3.S3Client
+	S3OperationTimeout   time.Duration
+	SortByCaptureDate    bool
 }
 
 type HomeController struct {
-	awsBucket           string
-	homePagePhotoFolder string
-	config              *configuration.Config
-	renderer            rendering.TemplateRenderer
-	s3Client            s3.S3Client
+	awsBucket            string
+	branding             viewmodels.Branding
+	cdnBaseURL           string
+	clock                services.Clock
+	feed                 *feedCache
+	feedCacheTTL         time.Duration
+	feedItemCount        int
+	homePagePhotoFolder  string
+	homePagePhotoService services.HomePagePhotoServicer
+	config               *configuration.Config
+	imageUrlExpiration   time.Duration
+	initialCount         int
+	renderer             rendering.TemplateRenderer
+	s3Client             s3.S3Client
+	s3OperationTimeout   time.Duration
+	sortByCaptureDate    bool
 }
 
 func NewHomeController(config HomeControllerConfig) HomeController {
+	if config.InitialCount <= 0 {
+		config.InitialCount = defaultInitialCount
+	}
+
+	if config.ImageUrlExpiration <= 0 {
+		config.ImageUrlExpiration = services.DefaultImageUrlExpiration
+	}
+
+	if config.S3OperationTimeout <= 0 {
+		config.S3OperationTimeout = services.DefaultS3OperationTimeout
+	}
+
+	if config.Clock == nil {
+		config.Clock = services.SystemClock
+	}
+
+	if config.FeedCacheTTL <= 0 {
+		config.FeedCacheTTL = defaultFeedCacheTTL
+	}
+
+	if config.FeedItemCount <= 0 {
+		config.FeedItemCount = defaultFeedItemCount
+	}
+
 	return HomeController{
-		awsBucket:           config.AwsBucket,
-		homePagePhotoFolder: config.HomePagePhotoFolder,
-		config:              config.Config,
-		renderer:            config.Renderer,
-		s3Client:            config.S3Client,
+		awsBucket:            config.AwsBucket,
+		branding:             config.Branding,
+		cdnBaseURL:           config.CdnBaseURL,
+		clock:                config.Clock,
+		feed:                 &feedCache{},
+		feedCacheTTL:         config.FeedCacheTTL,
+		feedItemCount:        config.FeedItemCount,
+		homePagePhotoFolder:  config.HomePagePhotoFolder,
+		homePagePhotoService: config.HomePagePhotoService,
+		config:               config.Config,
+		imageUrlExpiration:   config.ImageUrlExpiration,
+		initialCount:         config.InitialCount,
+		renderer:             config.Renderer,
+		s3Client:             config.S3Client,
+		s3OperationTimeout:   config.S3OperationTimeout,
+		sortByCaptureDate:    config.SortByCaptureDate,
 	}
 }
 
 /*
 GET /
+
+Renders the first batch of photos. The rest are loaded by HomePhotos as
+the visitor scrolls.
 */
 func (c HomeController) HomePage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
 	pageName := "pages/home"
 
 	viewData := viewmodels.HomePage{
 		BaseViewModel: viewmodels.BaseViewModel{
-			Message:            "",
-			IsHtmx:             httphelpers.IsHtmx(r),
-			JavascriptIncludes: []rendering.JavascriptInclude{},
+			Branding: c.branding,
+			Message:  "",
+			IsHtmx:   httphelpers.IsHtmx(r),
+			JavascriptIncludes: []rendering.JavascriptInclude{
+				{Type: "module", Src: "/static/js/pages/home.js"},
+			},
 		},
 		Photos: []viewmodels.HomePagePhoto{},
 	}
 
-	thumbnails, err := c.s3Client.List(
-		c.awsBucket,
-		fmt.Sprintf("%s/thumbnail", c.homePagePhotoFolder),
-		listoptions.WithGetUrls(),
-	)
-
-	if err != nil {
-		slog.Error("error listing objects in S3 bucket", "error", err, "bucket", c.awsBucket, "prefix", c.homePagePhotoFolder)
+	if viewData.Photos, viewData.NextOffset, viewData.FromCache, err = c.getPhotos(r, 0); err != nil {
+		requestlog.Logger(r).Error("error getting home page photos", "error", err, "bucket", c.awsBucket, "prefix", c.homePagePhotoFolder)
 		viewData.IsError = true
 		viewData.Message = "There was a problem getting photo for this page."
 
-		c.renderer.Render(pageName, viewData, w)
+		if errors.Is(err, context.DeadlineExceeded) {
+			viewData.Message = "Photos are taking longer than usual to load. Please try again in a moment."
+		}
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+GET /home/photos?offset=
+
+Returns the next batch of photos as an HTMX partial for infinite scroll.
+The partial ends with a trigger for the batch after it, if there is one.
+*/
+func (c HomeController) HomePhotos(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	offset := max(httphelpers.GetFromRequest[int](r, "offset"), 0)
+
+	viewData := viewmodels.HomePage{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Branding: c.branding,
+			IsHtmx:   httphelpers.IsHtmx(r),
+		},
+	}
+
+	if viewData.Photos, viewData.NextOffset, _, err = c.getPhotos(r, offset); err != nil {
+		requestlog.Logger(r).Error("error getting home page photos", "error", err, "bucket", c.awsBucket, "prefix", c.homePagePhotoFolder, "offset", offset)
+
+		if errors.Is(err, context.DeadlineExceeded) {
+			httphelpers.WriteText(w, http.StatusGatewayTimeout, "Photos are taking longer than usual to load. Please try again in a moment.")
+			return
+		}
+
+		httphelpers.TextInternalServerError(w, "There was a problem getting more photos")
 		return
 	}
 
-	originals, err := c.s3Client.List(
-		c.awsBucket,
-		fmt.Sprintf("%s/original", c.homePagePhotoFolder),
-		listoptions.WithGetUrls(),
+	c.renderer.Render("components/home-photos", viewData, w)
+}
+
+/*
+getPhotos returns the batch of photos starting at offset, and the offset of
+the batch after it. The next offset is 0 when this is the last batch.
+
+Hidden photos are dropped and ordering is applied before the batch is cut,
+so offsets always count visible photos in display order. Sorting by capture
+date or featuring photos needs every photo, so the whole folder is listed
+then. Otherwise listing stops once there are enough thumbnails for this
+batch. Either way, URLs are only signed for the photos in the batch. Listing
+gives up after s3OperationTimeout. fromCache is true when S3 couldn't be
+listed and the last cached listing was used instead.
+*/
+func (c HomeController) getPhotos(r *http.Request, offset int) ([]viewmodels.HomePagePhoto, int, bool, error) {
+	var (
+		err             error
+		flags           map[string]models.HomePagePhotoFlag
+		thumbnails      []s3.Object
+		originals       []s3.Object
+		captureDates    = cache.CaptureDates{}
+		photos          = []viewmodels.HomePagePhoto{}
+		more            bool
+		thumbnailsCache bool
+		originalsCache  bool
 	)
 
+	ctx, cancel := context.WithTimeout(r.Context(), c.s3OperationTimeout)
+	defer cancel()
+
+	flags = c.getFlags(r)
+	wanted := 0
+
+	if !c.sortByCaptureDate && !hasFeatured(flags) {
+		// One more than the batch tells whether there is a next batch
+		wanted = offset + c.initialCount + 1 + countHidden(flags)
+	}
+
+	thumbnails, more, thumbnailsCache, err = c.listFolderOrCached(ctx, r, "thumbnail", func(objects []s3.Object) bool {
+		return wanted > 0 && len(objects) >= wanted
+	})
+
 	if err != nil {
-		slog.Error("error listing objects in S3 bucket", "error", err, "bucket", c.awsBucket, "prefix", c.homePagePhotoFolder)
-		viewData.IsError = true
-		viewData.Message = "There was a problem getting photo for this page."
+		return nil, 0, false, err
+	}
 
-		c.renderer.Render(pageName, viewData, w)
-		return
+	if len(thumbnails) == 0 {
+		return photos, 0, thumbnailsCache, nil
+	}
+
+	/*
+	 * Thumbnails are named after their original and S3 lists keys in order,
+	 * so the originals only need listing as far as the last thumbnail
+	 */
+	lastFileName := filepath.Base(thumbnails[len(thumbnails)-1].Key)
+
+	originals, _, originalsCache, err = c.listFolderOrCached(ctx, r, "original", func(objects []s3.Object) bool {
+		return filepath.Base(objects[len(objects)-1].Key) >= lastFileName
+	})
+
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	fromCache := thumbnailsCache || originalsCache
+
+	if c.sortByCaptureDate {
+		if captureDates, err = cache.ReadCaptureDates(c.s3Client, c.awsBucket, c.homePagePhotoFolder); err != nil {
+			requestlog.Logger(r).Error("error reading home page capture dates. using upload dates", "error", err)
+		}
+	}
+
+	photos = pairPhotos(thumbnails, originals, flags, captureDates)
+
+	if c.sortByCaptureDate {
+		sortByCaptureDate(photos)
+	}
+
+	sortFeaturedFirst(photos)
+
+	if offset >= len(photos) {
+		return []viewmodels.HomePagePhoto{}, 0, fromCache, nil
+	}
+
+	batch := photos[offset:min(offset+c.initialCount, len(photos))]
+	nextOffset := 0
+
+	if len(photos) > offset+len(batch) || more {
+		nextOffset = offset + len(batch)
+	}
+
+	if err = c.signUrls(batch); err != nil {
+		return nil, 0, false, err
+	}
+
+	return batch, nextOffset, fromCache, nil
+}
+
+/*
+getFlags returns the hidden and featured flags. When they can't be read,
+every photo is shown as usual rather than failing the page.
+*/
+func (c HomeController) getFlags(r *http.Request) map[string]models.HomePagePhotoFlag {
+	if c.homePagePhotoService == nil {
+		return map[string]models.HomePagePhotoFlag{}
+	}
+
+	flags, err := c.homePagePhotoService.GetFlags()
+
+	if err != nil {
+		requestlog.Logger(r).Error("error getting home page photo flags. showing every photo", "error", err)
+		return map[string]models.HomePagePhotoFlag{}
+	}
+
+	return flags
+}
+
+/*
+listFolder lists a folder under the home page photo folder a page at a
+time using continuation tokens, stopping early once done reports there is
+enough. more is true when listing stopped before the end of the folder.
+*/
+func (c HomeController) listFolder(ctx context.Context, folder string, done func(objects []s3.Object) bool) ([]s3.Object, bool, error) {
+	var (
+		err      error
+		response s3.ListResponse
+		token    string
+		result   = []s3.Object{}
+	)
+
+	prefix := fmt.Sprintf("%s/%s", c.homePagePhotoFolder, folder)
+
+	for {
+		if response, err = services.ListObjects(ctx, c.s3Client, c.awsBucket, prefix, listoptions.WithContinuationToken(token)); err != nil {
+			return nil, false, fmt.Errorf("error listing objects in '%s': %w", prefix, err)
+		}
+
+		result = append(result, response.Objects...)
+
+		// A token that doesn't move forward would list the same page forever
+		if response.ContinuationToken == "" || response.ContinuationToken == token {
+			return result, false, nil
+		}
+
+		if len(result) > 0 && done(result) {
+			return result, true, nil
+		}
+
+		token = response.ContinuationToken
+	}
+}
+
+/*
+listFolderOrCached lists a folder with listFolder, saving what it finds as
+the folder's cached listing. When S3 can't be listed the cached listing is
+returned instead, with cached set to true, so the gallery still shows while
+S3 is unreachable. The listing error is only returned when there is nothing
+cached to fall back on. A failure to read or save the cache is logged and
+otherwise ignored.
+*/
+func (c HomeController) listFolderOrCached(ctx context.Context, r *http.Request, folder string, done func(objects []s3.Object) bool) ([]s3.Object, bool, bool, error) {
+	var (
+		err      error
+		cacheErr error
+		objects  []s3.Object
+		more     bool
+		listing  services.CachedListing
+	)
+
+	objects, more, err = c.listFolder(ctx, folder, done)
+
+	if c.homePagePhotoService == nil {
+		return objects, more, false, err
+	}
+
+	prefix := fmt.Sprintf("%s/%s", c.homePagePhotoFolder, folder)
+
+	if err == nil {
+		if cacheErr = c.homePagePhotoService.SaveListing(prefix, objects, !more); cacheErr != nil {
+			requestlog.Logger(r).Error("error caching home page listing", "error", cacheErr, "prefix", prefix)
+		}
+
+		return objects, more, false, nil
+	}
+
+	if listing, cacheErr = c.homePagePhotoService.GetListing(prefix); cacheErr != nil {
+		if !sqlz.IsNotFound(cacheErr) {
+			requestlog.Logger(r).Error("error getting cached home page listing", "error", cacheErr, "prefix", prefix)
+		}
+
+		return nil, false, false, err
+	}
+
+	requestlog.Logger(r).Warn("S3 listing failed. showing the cached listing", "error", err, "prefix", prefix, "cachedAt", listing.UpdatedAt)
+	return listing.Objects, !listing.Complete, true, nil
+}
+
+/*
+signUrls swaps the S3 keys in a batch of photos for URLs the browser can
+load, going through the CDN when one is configured. Presigned URLs last
+for imageUrlExpiration.
+*/
+func (c HomeController) signUrls(photos []viewmodels.HomePagePhoto) error {
+	var (
+		err error
+	)
+
+	expiration := geturloptions.WithExpiration(c.imageUrlExpiration)
+
+	for index := range photos {
+		if photos[index].ThumbnailPath, err = services.ImageURL(c.s3Client, c.awsBucket, c.cdnBaseURL, photos[index].ThumbnailPath, expiration); err != nil {
+			return fmt.Errorf("error getting URL for '%s': %w", photos[index].ThumbnailPath, err)
+		}
+
+		if photos[index].OriginalPath, err = services.ImageURL(c.s3Client, c.awsBucket, c.cdnBaseURL, photos[index].OriginalPath, expiration); err != nil {
+			return fmt.Errorf("error getting URL for '%s': %w", photos[index].OriginalPath, err)
+		}
 	}
 
-	for index, obj := range thumbnails.Objects {
-		fileName := filepath.Base(obj.Url)
+	return nil
+}
 
-		viewData.Photos = append(viewData.Photos, viewmodels.HomePagePhoto{
-			ThumbnailPath: obj.Url,
+/*
+pairPhotos matches each thumbnail with its original by file name, dropping
+hidden photos and thumbnails whose original is gone. The paths are left as
+S3 keys for signUrls. Matching by name rather than position keeps the pairs
+right when a thumbnail hasn't been made yet for a new original.
+*/
+func pairPhotos(thumbnails, originals []s3.Object, flags map[string]models.HomePagePhotoFlag, captureDates cache.CaptureDates) []viewmodels.HomePagePhoto {
+	originalsByName := make(map[string]s3.Object, len(originals))
+
+	for _, original := range originals {
+		originalsByName[filepath.Base(original.Key)] = original
+	}
+
+	result := make([]viewmodels.HomePagePhoto, 0, len(thumbnails))
+
+	for _, thumbnail := range thumbnails {
+		fileName := filepath.Base(thumbnail.Key)
+		original, ok := originalsByName[fileName]
+
+		if !ok || flags[fileName].Hidden {
+			continue
+		}
+
+		result = append(result, viewmodels.HomePagePhoto{
+			CapturedAt:    capturedAt(captureDates, fileName, original.LastModified),
+			Featured:      flags[fileName].Featured,
+			ThumbnailPath: thumbnail.Key,
 			FileName:      fileName,
-			OriginalPath:  originals.Objects[index].Url,
+			OriginalPath:  original.Key,
 		})
 	}
 
-	c.renderer.Render(pageName, viewData, w)
+	return result
+}
+
+func hasFeatured(flags map[string]models.HomePagePhotoFlag) bool {
+	for _, flag := range flags {
+		if flag.Featured && !flag.Hidden {
+			return true
+		}
+	}
+
+	return false
+}
+
+func countHidden(flags map[string]models.HomePagePhotoFlag) int {
+	result := 0
+
+	for _, flag := range flags {
+		if flag.Hidden {
+			result++
+		}
+	}
+
+	return result
+}
+
+/*
+capturedAt returns a photo's EXIF capture date from the cache run's sidecar,
+or lastModified when the photo has no EXIF date or hasn't been read yet.
+*/
+func capturedAt(captureDates cache.CaptureDates, fileName string, lastModified time.Time) time.Time {
+	if captureDate, ok := captureDates[fileName]; ok && !captureDate.CapturedAt.IsZero() {
+		return captureDate.CapturedAt
+	}
+
+	return lastModified
+}
+
+/*
+sortByCaptureDate puts the newest photos first. Photos taken at the same
+moment keep the order S3 listed them in.
+*/
+func sortByCaptureDate(photos []viewmodels.HomePagePhoto) {
+	slices.SortStableFunc(photos, func(a, b viewmodels.HomePagePhoto) int {
+		return b.CapturedAt.Compare(a.CapturedAt)
+	})
+}
+
+/*
+sortFeaturedFirst moves featured photos to the front, keeping the existing
+order within the featured and unfeatured photos.
+*/
+func sortFeaturedFirst(photos []viewmodels.HomePagePhoto) {
+	slices.SortStableFunc(photos, func(a, b viewmodels.HomePagePhoto) int {
+		switch {
+		case a.Featured == b.Featured:
+			return 0
+		case a.Featured:
+			return -1
+		default:
+			return 1
+		}
+	})
 }
@@ -0,0 +1,567 @@
+package home
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/geturloptions"
+	"github.com/adampresley/adamgokit/s3/listoptions"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/cache"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/viewmodels"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+)
+
+/*
+fakeS3Client lists the thumbnail and original folders pageSize objects at a
+time, handing out the index of the next object as the continuation token.
+originals defaults to the thumbnails' file names. Objects are given the
+LastModified in modified for their file name. When expiration is set,
+GetUrl stores the expiration it was asked for there. Anything else panics
+through the nil embedded interface.
+*/
+type fakeS3Client struct {
+	s3.S3Client
+
+	expiration *time.Duration
+	fileNames  []string
+	modified   map[string]time.Time
+	originals  []string
+	pageSize   int
+	listed     map[string]int
+}
+
+func (f fakeS3Client) List(bucket, path string, options ...listoptions.ListOption) (s3.ListResponse, error) {
+	o := &listoptions.ListOptions{}
+
+	for _, option := range options {
+		option(o)
+	}
+
+	fileNames := f.fileNames
+
+	if strings.HasSuffix(path, "/original") && f.originals != nil {
+		fileNames = f.originals
+	}
+
+	start, _ := strconv.Atoi(o.ContinuationToken)
+	end := len(fileNames)
+
+	if f.pageSize > 0 {
+		end = min(start+f.pageSize, len(fileNames))
+	}
+
+	result := s3.ListResponse{}
+
+	for _, fileName := range fileNames[start:end] {
+		result.Objects = append(result.Objects, s3.Object{Key: path + "/" + fileName, LastModified: f.modified[fileName]})
+	}
+
+	if end < len(fileNames) {
+		result.ContinuationToken = strconv.Itoa(end)
+	}
+
+	if f.listed != nil {
+		f.listed[path] += len(result.Objects)
+	}
+
+	return result, nil
+}
+
+/*
+slowS3Client holds every listing until release is closed, like an S3
+endpoint that has stopped answering.
+*/
+type slowS3Client struct {
+	fakeS3Client
+
+	release chan struct{}
+}
+
+func (f slowS3Client) List(bucket, path string, options ...listoptions.ListOption) (s3.ListResponse, error) {
+	<-f.release
+	return f.fakeS3Client.List(bucket, path, options...)
+}
+
+/*
+unreachableS3Client fails every listing, like an S3 endpoint that can't be
+reached.
+*/
+type unreachableS3Client struct {
+	fakeS3Client
+}
+
+func (f unreachableS3Client) List(bucket, path string, options ...listoptions.ListOption) (s3.ListResponse, error) {
+	return s3.ListResponse{}, errors.New("dial tcp: connection refused")
+}
+
+func (f fakeS3Client) GetUrl(bucket, key string, options ...geturloptions.GetUrlOption) (string, error) {
+	if f.expiration != nil {
+		o := &geturloptions.GetUrlOptions{}
+
+		for _, option := range options {
+			option(o)
+		}
+
+		*f.expiration = o.Expiration
+	}
+
+	return "https://cdn.example.com/" + key, nil
+}
+
+// fakeRenderer keeps the template and view data it was asked to render
+type fakeRenderer struct {
+	data         *viewmodels.HomePage
+	templateName *string
+}
+
+func (f fakeRenderer) Render(templateName string, data any, w io.Writer) error {
+	*f.data = data.(viewmodels.HomePage)
+
+	if f.templateName != nil {
+		*f.templateName = templateName
+	}
+
+	return nil
+}
+
+func (f fakeRenderer) RenderString(templateString string, data any, w io.Writer) error {
+	return nil
+}
+
+/*
+fakeHomePagePhotoService keeps cached listings in memory, keyed by folder.
+listings can be nil when a test doesn't care about the cache.
+*/
+type fakeHomePagePhotoService struct {
+	flags    map[string]models.HomePagePhotoFlag
+	listings map[string]services.CachedListing
+}
+
+func (f fakeHomePagePhotoService) GetFlags() (map[string]models.HomePagePhotoFlag, error) {
+	return f.flags, nil
+}
+
+func (f fakeHomePagePhotoService) GetListing(folder string) (services.CachedListing, error) {
+	listing, ok := f.listings[folder]
+
+	if !ok {
+		return services.CachedListing{}, fmt.Errorf("no listing for '%s': %w", folder, sql.ErrNoRows)
+	}
+
+	return listing, nil
+}
+
+func (f fakeHomePagePhotoService) SaveListing(folder string, objects []s3.Object, complete bool) error {
+	if f.listings != nil {
+		f.listings[folder] = services.CachedListing{Objects: objects, Complete: complete, UpdatedAt: time.Now()}
+	}
+
+	return nil
+}
+
+func (f fakeHomePagePhotoService) SetFlags(fileName string, hidden, featured bool) (models.HomePagePhotoFlag, error) {
+	return models.HomePagePhotoFlag{}, nil
+}
+
+func TestSortByCaptureDate(t *testing.T) {
+	captureDates := cache.CaptureDates{
+		"summer.jpg": {CapturedAt: time.Date(2023, time.July, 4, 0, 0, 0, 0, time.UTC)},
+		"winter.jpg": {CapturedAt: time.Date(2021, time.January, 10, 0, 0, 0, 0, time.UTC)},
+		"scan.jpg":   {},
+	}
+
+	uploads := []struct {
+		fileName     string
+		lastModified time.Time
+	}{
+		{fileName: "winter.jpg", lastModified: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)},
+		{fileName: "scan.jpg", lastModified: time.Date(2022, time.March, 3, 0, 0, 0, 0, time.UTC)},
+		{fileName: "summer.jpg", lastModified: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)},
+		{fileName: "new.jpg", lastModified: time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	photos := []viewmodels.HomePagePhoto{}
+
+	for _, upload := range uploads {
+		photos = append(photos, viewmodels.HomePagePhoto{
+			CapturedAt: capturedAt(captureDates, upload.fileName, upload.lastModified),
+			FileName:   upload.fileName,
+		})
+	}
+
+	sortByCaptureDate(photos)
+
+	// new.jpg hasn't been read by the cache run yet and scan.jpg has no EXIF, so both use their upload date
+	want := []string{"new.jpg", "summer.jpg", "scan.jpg", "winter.jpg"}
+
+	for i, photo := range photos {
+		if photo.FileName != want[i] {
+			t.Fatalf("photo %d = %s, want order %v", i, photo.FileName, want)
+		}
+	}
+
+	if !photos[2].CapturedAt.Equal(uploads[1].lastModified) {
+		t.Errorf("scan.jpg captured at %v, want its upload date %v", photos[2].CapturedAt, uploads[1].lastModified)
+	}
+}
+
+func TestHomePageHidesAndFeaturesPhotos(t *testing.T) {
+	viewData := viewmodels.HomePage{}
+
+	controller := NewHomeController(HomeControllerConfig{
+		AwsBucket:           "bucket",
+		HomePagePhotoFolder: "home-page",
+		HomePagePhotoService: fakeHomePagePhotoService{
+			flags: map[string]models.HomePagePhotoFlag{
+				"b.jpg": {FileName: "b.jpg", Hidden: true},
+				"c.jpg": {FileName: "c.jpg", Featured: true},
+				"e.jpg": {FileName: "e.jpg", Hidden: true, Featured: true},
+			},
+		},
+		Renderer: fakeRenderer{data: &viewData},
+		S3Client: fakeS3Client{fileNames: []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg", "e.jpg"}},
+	})
+
+	controller.HomePage(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	got := []string{}
+
+	for _, photo := range viewData.Photos {
+		got = append(got, photo.FileName)
+
+		if photo.Featured != (photo.FileName == "c.jpg") {
+			t.Errorf("%s featured = %v", photo.FileName, photo.Featured)
+		}
+
+		if !strings.Contains(photo.OriginalPath, "/original/"+photo.FileName) {
+			t.Errorf("%s original = %s, want its own original", photo.FileName, photo.OriginalPath)
+		}
+	}
+
+	if want := []string{"c.jpg", "a.jpg", "d.jpg"}; !slices.Equal(got, want) {
+		t.Errorf("photos = %v, want %v", got, want)
+	}
+}
+
+func TestHomePhotosPages(t *testing.T) {
+	viewData := viewmodels.HomePage{}
+	templateName := ""
+	listed := map[string]int{}
+
+	/*
+	 * f.jpg's thumbnail hasn't been made yet, so pairing by position would
+	 * give every photo after it the wrong original
+	 */
+	controller := NewHomeController(HomeControllerConfig{
+		AwsBucket:           "bucket",
+		HomePagePhotoFolder: "home-page",
+		InitialCount:        2,
+		Renderer:            fakeRenderer{data: &viewData, templateName: &templateName},
+		S3Client: fakeS3Client{
+			fileNames: []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg", "g.jpg", "h.jpg", "i.jpg", "j.jpg"},
+			originals: []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg", "f.jpg", "g.jpg", "h.jpg", "i.jpg", "j.jpg"},
+			pageSize:  2,
+			listed:    listed,
+		},
+	})
+
+	controller.HomePage(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := photoNames(viewData.Photos); !slices.Equal(got, []string{"a.jpg", "b.jpg"}) || viewData.NextOffset != 2 {
+		t.Fatalf("first page = %v, next %d; want [a.jpg b.jpg], next 2", got, viewData.NextOffset)
+	}
+
+	if templateName != "pages/home" {
+		t.Errorf("first page rendered %s, want pages/home", templateName)
+	}
+
+	// The first page only needs three thumbnails, which is two pages of the listing
+	if listed["home-page/thumbnail"] != 4 {
+		t.Errorf("listed %d thumbnails for the first page, want 4", listed["home-page/thumbnail"])
+	}
+
+	tests := []struct {
+		offset     string
+		want       []string
+		wantOffset int
+	}{
+		{offset: "2", want: []string{"c.jpg", "d.jpg"}, wantOffset: 4},
+		{offset: "4", want: []string{"g.jpg", "h.jpg"}, wantOffset: 6},
+		{offset: "6", want: []string{"i.jpg", "j.jpg"}, wantOffset: 0},
+		{offset: "20", want: []string{}, wantOffset: 0},
+		{offset: "-1", want: []string{"a.jpg", "b.jpg"}, wantOffset: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run("offset "+tt.offset, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			controller.HomePhotos(w, httptest.NewRequest(http.MethodGet, "/home/photos?offset="+tt.offset, nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+
+			if templateName != "components/home-photos" {
+				t.Errorf("rendered %s, want components/home-photos", templateName)
+			}
+
+			if got := photoNames(viewData.Photos); !slices.Equal(got, tt.want) || viewData.NextOffset != tt.wantOffset {
+				t.Errorf("photos = %v, next %d; want %v, next %d", got, viewData.NextOffset, tt.want, tt.wantOffset)
+			}
+
+			for _, photo := range viewData.Photos {
+				if photo.ThumbnailPath != "https://cdn.example.com/home-page/thumbnail/"+photo.FileName ||
+					photo.OriginalPath != "https://cdn.example.com/home-page/original/"+photo.FileName {
+					t.Errorf("%s paths = %s, %s; want its own thumbnail and original", photo.FileName, photo.ThumbnailPath, photo.OriginalPath)
+				}
+			}
+		})
+	}
+}
+
+func photoNames(photos []viewmodels.HomePagePhoto) []string {
+	result := []string{}
+
+	for _, photo := range photos {
+		result = append(result, photo.FileName)
+	}
+
+	return result
+}
+
+func TestPairPhotos(t *testing.T) {
+	objects := func(folder string, fileNames ...string) []s3.Object {
+		result := []s3.Object{}
+
+		for _, fileName := range fileNames {
+			result = append(result, s3.Object{Key: "home-page/" + folder + "/" + fileName})
+		}
+
+		return result
+	}
+
+	tests := []struct {
+		name       string
+		thumbnails []s3.Object
+		originals  []s3.Object
+		want       []string
+	}{
+		{name: "matching", thumbnails: objects("thumbnail", "a.jpg", "b.jpg"), originals: objects("original", "a.jpg", "b.jpg"), want: []string{"a.jpg", "b.jpg"}},
+		{name: "thumbnail not made yet", thumbnails: objects("thumbnail", "a.jpg", "c.jpg"), originals: objects("original", "a.jpg", "b.jpg", "c.jpg"), want: []string{"a.jpg", "c.jpg"}},
+		{name: "original deleted", thumbnails: objects("thumbnail", "a.jpg", "b.jpg", "c.jpg"), originals: objects("original", "a.jpg", "c.jpg"), want: []string{"a.jpg", "c.jpg"}},
+		{name: "different orders", thumbnails: objects("thumbnail", "c.jpg", "a.jpg", "b.jpg"), originals: objects("original", "b.jpg", "c.jpg", "a.jpg"), want: []string{"c.jpg", "a.jpg", "b.jpg"}},
+		{name: "no originals", thumbnails: objects("thumbnail", "a.jpg"), want: []string{}},
+		{name: "no thumbnails", originals: objects("original", "a.jpg"), want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			photos := pairPhotos(tt.thumbnails, tt.originals, nil, nil)
+
+			if got := photoNames(photos); !slices.Equal(got, tt.want) {
+				t.Fatalf("photos = %v, want %v", got, tt.want)
+			}
+
+			for _, photo := range photos {
+				if photo.ThumbnailPath != "home-page/thumbnail/"+photo.FileName || photo.OriginalPath != "home-page/original/"+photo.FileName {
+					t.Errorf("%s paired %s with %s", photo.FileName, photo.ThumbnailPath, photo.OriginalPath)
+				}
+			}
+		})
+	}
+}
+
+func TestHomePageWithMoreThumbnailsThanOriginals(t *testing.T) {
+	viewData := viewmodels.HomePage{}
+
+	controller := NewHomeController(HomeControllerConfig{
+		AwsBucket:           "bucket",
+		HomePagePhotoFolder: "home-page",
+		Renderer:            fakeRenderer{data: &viewData},
+		S3Client: fakeS3Client{
+			fileNames: []string{"a.jpg", "b.jpg", "c.jpg"},
+			originals: []string{"b.jpg"},
+		},
+	})
+
+	controller.HomePage(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if viewData.IsError {
+		t.Fatalf("home page reported an error: %s", viewData.Message)
+	}
+
+	if got := photoNames(viewData.Photos); !slices.Equal(got, []string{"b.jpg"}) {
+		t.Errorf("photos = %v, want [b.jpg]", got)
+	}
+}
+
+func TestHomePageGivesUpOnASlowS3(t *testing.T) {
+	viewData := viewmodels.HomePage{}
+	release := make(chan struct{})
+	defer close(release)
+
+	controller := NewHomeController(HomeControllerConfig{
+		AwsBucket:           "bucket",
+		HomePagePhotoFolder: "home-page",
+		Renderer:            fakeRenderer{data: &viewData},
+		S3Client: slowS3Client{
+			fakeS3Client: fakeS3Client{fileNames: []string{"a.jpg"}},
+			release:      release,
+		},
+		S3OperationTimeout: time.Millisecond * 20,
+	})
+
+	start := time.Now()
+	controller.HomePage(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("home page took %s, want it to give up after the timeout", elapsed)
+	}
+
+	if !viewData.IsError || !strings.Contains(viewData.Message, "taking longer than usual") {
+		t.Errorf("message = %q, error %v; want the slow loading message", viewData.Message, viewData.IsError)
+	}
+
+	w := httptest.NewRecorder()
+	controller.HomePhotos(w, httptest.NewRequest(http.MethodGet, "/home/photos?offset=2", nil))
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("more photos status = %d, want %d", w.Code, http.StatusGatewayTimeout)
+	}
+}
+
+func TestHomePageFallsBackToTheCachedListing(t *testing.T) {
+	viewData := viewmodels.HomePage{}
+	photoService := fakeHomePagePhotoService{listings: map[string]services.CachedListing{}}
+
+	config := HomeControllerConfig{
+		AwsBucket:            "bucket",
+		HomePagePhotoFolder:  "home-page",
+		HomePagePhotoService: photoService,
+		Renderer:             fakeRenderer{data: &viewData},
+		S3Client:             fakeS3Client{fileNames: []string{"a.jpg", "b.jpg"}},
+	}
+
+	// A successful load refreshes the cache
+	NewHomeController(config).HomePage(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if viewData.FromCache {
+		t.Errorf("photos listed from S3 were marked as cached")
+	}
+
+	for _, folder := range []string{"home-page/thumbnail", "home-page/original"} {
+		if listing := photoService.listings[folder]; len(listing.Objects) != 2 || !listing.Complete {
+			t.Errorf("cached %s = %+v, want both photos and complete", folder, listing)
+		}
+	}
+
+	config.S3Client = unreachableS3Client{}
+	viewData = viewmodels.HomePage{}
+
+	NewHomeController(config).HomePage(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if viewData.IsError {
+		t.Fatalf("home page reported an error with a cached listing: %s", viewData.Message)
+	}
+
+	if !viewData.FromCache {
+		t.Errorf("FromCache = false, want the cached gallery indicator")
+	}
+
+	if got := photoNames(viewData.Photos); !slices.Equal(got, []string{"a.jpg", "b.jpg"}) {
+		t.Errorf("photos = %v, want [a.jpg b.jpg]", got)
+	}
+
+	// Without a cache the error is still shown
+	config.HomePagePhotoService = fakeHomePagePhotoService{}
+	viewData = viewmodels.HomePage{}
+
+	NewHomeController(config).HomePage(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !viewData.IsError || len(viewData.Photos) != 0 {
+		t.Errorf("error = %v, photos = %v; want an error and no photos", viewData.IsError, photoNames(viewData.Photos))
+	}
+}
+
+func TestHomePagePhotosGoThroughTheCdn(t *testing.T) {
+	tests := []struct {
+		name          string
+		cdnBaseURL    string
+		wantThumbnail string
+		wantOriginal  string
+	}{
+		{
+			name:          "presigned without a CDN",
+			wantThumbnail: "https://cdn.example.com/home-page/thumbnail/a b.jpg",
+			wantOriginal:  "https://cdn.example.com/home-page/original/a b.jpg",
+		},
+		{
+			name:          "through the CDN",
+			cdnBaseURL:    "https://images.example.com",
+			wantThumbnail: "https://images.example.com/home-page/thumbnail/a%20b.jpg",
+			wantOriginal:  "https://images.example.com/home-page/original/a%20b.jpg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viewData := viewmodels.HomePage{}
+
+			controller := NewHomeController(HomeControllerConfig{
+				AwsBucket:           "bucket",
+				CdnBaseURL:          tt.cdnBaseURL,
+				HomePagePhotoFolder: "home-page",
+				Renderer:            fakeRenderer{data: &viewData},
+				S3Client:            fakeS3Client{fileNames: []string{"a b.jpg"}},
+			})
+
+			controller.HomePage(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if len(viewData.Photos) != 1 {
+				t.Fatalf("photos = %+v, want one", viewData.Photos)
+			}
+
+			if got := viewData.Photos[0].ThumbnailPath; got != tt.wantThumbnail {
+				t.Errorf("thumbnail = %q, want %q", got, tt.wantThumbnail)
+			}
+
+			if got := viewData.Photos[0].OriginalPath; got != tt.wantOriginal {
+				t.Errorf("original = %q, want %q", got, tt.wantOriginal)
+			}
+		})
+	}
+}
+
+func TestHomePagePhotoUrlsUseTheConfiguredExpiration(t *testing.T) {
+	viewData := viewmodels.HomePage{}
+	expiration := time.Duration(0)
+
+	controller := NewHomeController(HomeControllerConfig{
+		AwsBucket:           "bucket",
+		HomePagePhotoFolder: "home-page",
+		ImageUrlExpiration:  time.Minute * 90,
+		Renderer:            fakeRenderer{data: &viewData},
+		S3Client:            fakeS3Client{expiration: &expiration, fileNames: []string{"a.jpg"}},
+	})
+
+	controller.HomePage(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if len(viewData.Photos) != 1 {
+		t.Fatalf("photos = %+v, want one", viewData.Photos)
+	}
+
+	if expiration != time.Minute*90 {
+		t.Errorf("URL expiration = %s, want 1h30m", expiration)
+	}
+}
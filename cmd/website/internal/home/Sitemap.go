@@ -0,0 +1,74 @@
+package home
+
+import (
+	"encoding/xml"
+	"net/http"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/requestlog"
+)
+
+const sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+/*
+publicPaths are the pages anyone can visit, in the order they are listed
+in the sitemap. Everything under /client is behind an access code and
+never listed.
+*/
+var publicPaths = []string{
+	"/",
+	"/contact",
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+/*
+GET /sitemap.xml
+
+Lists the public pages for search engines. The home page's lastmod is when
+the newest photo was uploaded. The photos come from the feed's cache, so
+the sitemap is cached for as long as the feeds and S3 is listed at most
+once per TTL for all three.
+*/
+func (c HomeController) Sitemap(w http.ResponseWriter, r *http.Request) {
+	photos, ok := c.feedPhotos(w, r)
+
+	if !ok {
+		return
+	}
+
+	baseURL := siteURL(r)
+
+	result := sitemapURLSet{
+		Xmlns: sitemapNamespace,
+		URLs:  make([]sitemapURL, 0, len(publicPaths)),
+	}
+
+	for _, path := range publicPaths {
+		url := sitemapURL{Loc: baseURL + path}
+
+		if path == "/" && len(photos) > 0 {
+			url.LastMod = photos[0].CapturedAt.UTC().Format(time.RFC3339)
+		}
+
+		result.URLs = append(result.URLs, url)
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	_, _ = w.Write([]byte(xml.Header))
+
+	if err := xml.NewEncoder(w).Encode(result); err != nil {
+		requestlog.Logger(r).Error("error writing sitemap", "error", err)
+	}
+}
@@ -0,0 +1,81 @@
+package home
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSitemapListsPublicPages(t *testing.T) {
+	now := time.Date(2024, 3, 30, 12, 0, 0, 0, time.UTC)
+
+	s3Client := fakeS3Client{
+		fileNames: []string{"a.jpg", "b.jpg"},
+		modified:  map[string]time.Time{"a.jpg": now.AddDate(0, 0, -10), "b.jpg": now.AddDate(0, 0, -2)},
+	}
+
+	controller := newFeedController(s3Client, &now, nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil)
+	r.Host = "adampresleyphotography.com"
+	r.Header.Set("X-Forwarded-Proto", "https")
+
+	w := httptest.NewRecorder()
+	controller.Sitemap(w, r)
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/xml; charset=utf-8" {
+		t.Fatalf("status = %d, Content-Type = %q; want a sitemap", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	if w.Header().Get("Cache-Control") != "public, max-age=300" {
+		t.Errorf("Cache-Control = %q, want the feed's TTL", w.Header().Get("Cache-Control"))
+	}
+
+	body := w.Body.String()
+	got := sitemapURLSet{}
+
+	if err := xml.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("error decoding sitemap: %v", err)
+	}
+
+	if got.Xmlns != sitemapNamespace {
+		t.Errorf("xmlns = %q, want %q", got.Xmlns, sitemapNamespace)
+	}
+
+	want := sitemapURL{Loc: "https://adampresleyphotography.com/", LastMod: "2024-03-28T12:00:00Z"}
+
+	if len(got.URLs) == 0 || got.URLs[0] != want {
+		t.Fatalf("urls = %+v, want the home page first with the newest photo's date", got.URLs)
+	}
+
+	for _, url := range got.URLs {
+		if strings.Contains(url.Loc, "/client") || strings.Contains(url.Loc, "/admin") {
+			t.Errorf("sitemap lists private page %q", url.Loc)
+		}
+	}
+
+	if strings.Contains(body, "/client") {
+		t.Errorf("sitemap = %q, want no client paths", body)
+	}
+}
+
+func TestSitemapOmitsLastModWithoutPhotos(t *testing.T) {
+	now := time.Date(2024, 3, 30, 12, 0, 0, 0, time.UTC)
+	controller := newFeedController(fakeS3Client{}, &now, nil)
+
+	w := httptest.NewRecorder()
+	controller.Sitemap(w, httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil))
+
+	got := sitemapURLSet{}
+
+	if err := xml.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("error decoding sitemap: %v", err)
+	}
+
+	if len(got.URLs) != len(publicPaths) || got.URLs[0].LastMod != "" {
+		t.Errorf("urls = %+v, want every public page and no lastmod", got.URLs)
+	}
+}
@@ -0,0 +1,153 @@
+package i18n
+
+import (
+	"fmt"
+)
+
+const (
+	DefaultLocale = "en"
+)
+
+/*
+Message keys for client facing strings. Keys are grouped by the page or
+feature they belong to.
+*/
+const (
+	AlbumExpired                = "album.expired"
+	AlbumExpiredBody            = "albumExpired.body"
+	AlbumExpiredTitle           = "albumExpired.title"
+	AlbumImagesTimeout          = "album.imagesTimeout"
+	AlbumsInvalidFromDate       = "albums.invalidFromDate"
+	AlbumsInvalidToDate         = "albums.invalidToDate"
+	CommentImageRequired        = "comment.imageRequired"
+	CommentRequired             = "comment.required"
+	DownloadExpiredBody         = "downloadExpired.body"
+	DownloadExpiredRequestAgain = "downloadExpired.requestAgain"
+	DownloadExpiredTitle        = "downloadExpired.title"
+	DownloadResentBody          = "downloadResent.body"
+	DownloadResentTitle         = "downloadResent.title"
+	DownloadStartedFileCount    = "downloadStarted.fileCount"
+	DownloadStartedNoEmail      = "downloadStarted.noEmail"
+	DownloadStartedPreparing    = "downloadStarted.preparing"
+	DownloadStartedQueued       = "downloadStarted.queued"
+	DownloadStartedTitle        = "downloadStarted.title"
+	ErrorUnexpected             = "error.unexpected"
+	FavoritesLimitReached       = "favorites.limitReached"
+	LoginIncorrectPassword      = "login.incorrectPassword"
+	LoginPassword               = "login.password"
+	LoginRemember               = "login.remember"
+	LoginSubmit                 = "login.submit"
+	LoginTitle                  = "login.title"
+	NavBackToAlbums             = "nav.backToAlbums"
+	NavReturnToAlbum            = "nav.returnToAlbum"
+	SettingsNotifyOnDownload    = "settings.notifyOnDownload"
+	SettingsNotifyOnDownloadOff = "settings.notifyOnDownloadOff"
+	SettingsSave                = "settings.save"
+	SettingsSaved               = "settings.saved"
+	SettingsTitle               = "settings.title"
+)
+
+/*
+catalog holds each supported locale's messages. English is complete. Any
+message missing from another locale falls back to English.
+*/
+var catalog = map[string]map[string]string{
+	"en": {
+		AlbumExpired:                "This album has expired",
+		AlbumExpiredBody:            "Access to \"%s\" has expired. Galleries are only available for a limited time after delivery. Please reach out if you need access again.",
+		AlbumExpiredTitle:           "Album Access Expired",
+		AlbumImagesTimeout:          "This album is taking longer than usual to load. Please try again in a moment.",
+		AlbumsInvalidFromDate:       "The 'from' date is not valid.",
+		AlbumsInvalidToDate:         "The 'to' date is not valid.",
+		CommentImageRequired:        "An image is required",
+		CommentRequired:             "Please enter a comment",
+		DownloadExpiredBody:         "This download has expired. Download links are only available for a limited time. You can request it again and we'll email you a new link when it's ready.",
+		DownloadExpiredRequestAgain: "Request Download Again",
+		DownloadExpiredTitle:        "Download Expired",
+		DownloadResentBody:          "We've sent the download link for \"%s\" to %s again.",
+		DownloadResentTitle:         "Download Link Sent",
+		DownloadStartedFileCount:    "It holds %d photos, about %s.",
+		DownloadStartedNoEmail:      "Your download for \"%s\" is being prepared. It will be on your My Downloads page when it's ready. This may take several minutes depending on the size of the album.",
+		DownloadStartedPreparing:    "Your download for \"%s\" is being prepared. You will receive an email at %s when your download is ready. This may take several minutes depending on the size of the album.",
+		DownloadStartedQueued:       "Other downloads are being prepared right now, so yours is queued, position %d. It will start as soon as a spot opens up.",
+		DownloadStartedTitle:        "Download Started",
+		ErrorUnexpected:             "An unexpected error occurred. Please reach out for assistance.",
+		FavoritesLimitReached:       "You can choose up to %d favorites in this album. Remove one to choose another.",
+		LoginIncorrectPassword:      "Your password was not correct. Please try again.",
+		LoginPassword:               "Password:",
+		LoginRemember:               "Remember me on this device",
+		LoginSubmit:                 "Log In",
+		LoginTitle:                  "Login",
+		NavBackToAlbums:             "Back to Albums",
+		NavReturnToAlbum:            "Return to Album",
+		SettingsNotifyOnDownload:    "Email me when a download is ready",
+		SettingsNotifyOnDownloadOff: "With this off, downloads are still prepared. Pick them up from My Downloads.",
+		SettingsSave:                "Save",
+		SettingsSaved:               "Your settings have been saved.",
+		SettingsTitle:               "Settings",
+	},
+	"es": {
+		AlbumExpired:                "Este álbum ha expirado",
+		AlbumExpiredBody:            "El acceso a \"%s\" ha expirado. Las galerías solo están disponibles por un tiempo limitado después de la entrega. Comuníquese con nosotros si necesita acceso de nuevo.",
+		AlbumExpiredTitle:           "Acceso al álbum expirado",
+		AlbumImagesTimeout:          "Este álbum está tardando más de lo normal en cargar. Inténtelo de nuevo en un momento.",
+		AlbumsInvalidFromDate:       "La fecha 'desde' no es válida.",
+		AlbumsInvalidToDate:         "La fecha 'hasta' no es válida.",
+		CommentImageRequired:        "Se requiere una imagen",
+		CommentRequired:             "Escriba un comentario",
+		DownloadExpiredBody:         "Esta descarga ha expirado. Los enlaces de descarga solo están disponibles por un tiempo limitado. Puede solicitarla de nuevo y le enviaremos un enlace nuevo por correo cuando esté lista.",
+		DownloadExpiredRequestAgain: "Solicitar la descarga de nuevo",
+		DownloadExpiredTitle:        "Descarga expirada",
+		DownloadResentBody:          "Le hemos enviado de nuevo el enlace de descarga de \"%s\" a %s.",
+		DownloadResentTitle:         "Enlace de descarga enviado",
+		DownloadStartedFileCount:    "Contiene %d fotos, aproximadamente %s.",
+		DownloadStartedNoEmail:      "Estamos preparando su descarga de \"%s\". Estará en su página Mis descargas cuando esté lista. Esto puede tardar varios minutos según el tamaño del álbum.",
+		DownloadStartedPreparing:    "Estamos preparando su descarga de \"%s\". Recibirá un correo en %s cuando esté lista. Esto puede tardar varios minutos según el tamaño del álbum.",
+		DownloadStartedQueued:       "Se están preparando otras descargas en este momento, así que la suya está en cola, posición %d. Comenzará en cuanto haya un lugar disponible.",
+		DownloadStartedTitle:        "Descarga iniciada",
+		ErrorUnexpected:             "Se produjo un error inesperado. Comuníquese con nosotros para obtener ayuda.",
+		FavoritesLimitReached:       "Puede elegir hasta %d favoritas en este álbum. Quite una para elegir otra.",
+		LoginIncorrectPassword:      "La contraseña no es correcta. Inténtelo de nuevo.",
+		LoginPassword:               "Contraseña:",
+		LoginRemember:               "Recordarme en este dispositivo",
+		LoginSubmit:                 "Entrar",
+		LoginTitle:                  "Iniciar sesión",
+		NavBackToAlbums:             "Volver a los álbumes",
+		NavReturnToAlbum:            "Volver al álbum",
+		SettingsNotifyOnDownload:    "Enviarme un correo cuando una descarga esté lista",
+		SettingsNotifyOnDownloadOff: "Si lo desactiva, las descargas se siguen preparando. Recójalas en Mis descargas.",
+		SettingsSave:                "Guardar",
+		SettingsSaved:               "Su configuración se ha guardado.",
+		SettingsTitle:               "Configuración",
+	},
+}
+
+/*
+IsSupported reports whether there is a catalog for locale.
+*/
+func IsSupported(locale string) bool {
+	_, ok := catalog[locale]
+	return ok
+}
+
+/*
+Translate returns the message for key in locale, formatted with args. When
+the locale or the message is missing the English message is used, and when
+English doesn't have it either the key itself is returned so the gap is
+visible rather than blank.
+*/
+func Translate(locale, key string, args ...any) string {
+	message, ok := catalog[locale][key]
+
+	if !ok {
+		if message, ok = catalog[DefaultLocale][key]; !ok {
+			return key
+		}
+	}
+
+	if len(args) == 0 {
+		return message
+	}
+
+	return fmt.Sprintf(message, args...)
+}
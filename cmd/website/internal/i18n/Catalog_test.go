@@ -0,0 +1,51 @@
+package i18n
+
+import (
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		name   string
+		locale string
+		key    string
+		args   []any
+		want   string
+	}{
+		{name: "english", locale: "en", key: LoginIncorrectPassword, want: "Your password was not correct. Please try again."},
+		{name: "spanish", locale: "es", key: LoginIncorrectPassword, want: "La contraseña no es correcta. Inténtelo de nuevo."},
+		{name: "arguments", locale: "en", key: DownloadStartedFileCount, args: []any{12, "40 MB"}, want: "It holds 12 photos, about 40 MB."},
+		{name: "unknown locale falls back to english", locale: "fr", key: NavBackToAlbums, want: "Back to Albums"},
+		{name: "unknown key", locale: "es", key: "nope.missing", want: "nope.missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Translate(tt.locale, tt.key, tt.args...); got != tt.want {
+				t.Errorf("Translate(%q, %q) = %q, want %q", tt.locale, tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranslateFallsBackToEnglishForMissingMessages(t *testing.T) {
+	catalog["en"]["test.onlyEnglish"] = "Only in English"
+
+	t.Cleanup(func() {
+		delete(catalog["en"], "test.onlyEnglish")
+	})
+
+	if got := Translate("es", "test.onlyEnglish"); got != "Only in English" {
+		t.Errorf("Translate() = %q, want the English message", got)
+	}
+}
+
+func TestEveryLocaleTranslatesEveryEnglishMessage(t *testing.T) {
+	for locale, messages := range catalog {
+		for key := range catalog[DefaultLocale] {
+			if _, ok := messages[key]; !ok {
+				t.Errorf("locale %s is missing %s", locale, key)
+			}
+		}
+	}
+}
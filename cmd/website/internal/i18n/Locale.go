@@ -0,0 +1,112 @@
+package i18n
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type languageRange struct {
+	tag     string
+	quality float64
+}
+
+/*
+ResolveLocale picks the locale to show a request in. A supported preference
+saved for the client wins. Otherwise the Accept-Language header is used,
+falling back to DefaultLocale.
+*/
+func ResolveLocale(r *http.Request, preferred string) string {
+	preferred = normalizeTag(preferred)
+
+	if IsSupported(preferred) {
+		return preferred
+	}
+
+	if IsSupported(baseLanguage(preferred)) {
+		return baseLanguage(preferred)
+	}
+
+	return LocaleFromAcceptLanguage(r.Header.Get("Accept-Language"))
+}
+
+/*
+LocaleFromAcceptLanguage returns the supported locale the header ranks
+highest. A regional tag, such as es-MX, matches its base language when there
+is no catalog for the region. Ranges with a quality of 0 are refused, and a
+wildcard or a header with nothing supported gives DefaultLocale.
+*/
+func LocaleFromAcceptLanguage(header string) string {
+	for _, r := range parseAcceptLanguage(header) {
+		if r.tag == "*" {
+			return DefaultLocale
+		}
+
+		if IsSupported(r.tag) {
+			return r.tag
+		}
+
+		if IsSupported(baseLanguage(r.tag)) {
+			return baseLanguage(r.tag)
+		}
+	}
+
+	return DefaultLocale
+}
+
+/*
+parseAcceptLanguage returns the header's language ranges, most preferred
+first. Ranges with equal quality keep the order they were sent in.
+*/
+func parseAcceptLanguage(header string) []languageRange {
+	result := []languageRange{}
+
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = normalizeTag(tag)
+
+		if tag == "" {
+			continue
+		}
+
+		quality := 1.0
+
+		for _, param := range strings.Split(params, ";") {
+			name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+
+			if !found || strings.TrimSpace(name) != "q" {
+				continue
+			}
+
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+
+			if err != nil || q < 0 || q > 1 {
+				q = 0
+			}
+
+			quality = q
+		}
+
+		if quality == 0 {
+			continue
+		}
+
+		result = append(result, languageRange{tag: tag, quality: quality})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].quality > result[j].quality
+	})
+
+	return result
+}
+
+func normalizeTag(tag string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(tag)), "_", "-")
+}
+
+func baseLanguage(tag string) string {
+	base, _, _ := strings.Cut(tag, "-")
+	return base
+}
@@ -0,0 +1,55 @@
+package i18n
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocaleFromAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: "en"},
+		{header: "es", want: "es"},
+		{header: "es-MX,es;q=0.9,en;q=0.8", want: "es"},
+		{header: "ES_mx", want: "es"},
+		{header: "fr-FR,fr;q=0.9,es;q=0.5,en;q=0.4", want: "es"},
+		{header: "en;q=0.5,es;q=0.9", want: "es"},
+		{header: "es;q=0,en", want: "en"},
+		{header: "de,fr", want: "en"},
+		{header: "*", want: "en"},
+		{header: "es;q=bogus,en;q=0.1", want: "en"},
+	}
+
+	for _, tt := range tests {
+		if got := LocaleFromAcceptLanguage(tt.header); got != tt.want {
+			t.Errorf("LocaleFromAcceptLanguage(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestResolveLocale(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		preferred string
+		want      string
+	}{
+		{name: "no preference", header: "es", want: "es"},
+		{name: "preference wins over the header", header: "es", preferred: "en", want: "en"},
+		{name: "regional preference", header: "en", preferred: "es-AR", want: "es"},
+		{name: "unsupported preference uses the header", header: "es", preferred: "de", want: "es"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/client", nil)
+			r.Header.Set("Accept-Language", tt.header)
+
+			if got := ResolveLocale(r, tt.preferred); got != tt.want {
+				t.Errorf("ResolveLocale() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
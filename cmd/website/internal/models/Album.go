@@ -1,20 +1,37 @@
 package models
 
 type Album struct {
-	ID             uint
-	Name           string
-	PosterImageURL string
-	Client         Client
-	ShootDate      string
-	Favorites      []Favorite
-	PosterYPos     string
-	ImageURLs      []Image
+	ID             uint       `json:"id"`
+	Name           string     `json:"name"`
+	PosterImageURL string     `json:"posterImageURL"`
+	Client         Client     `json:"client"`
+	ShootDate      string     `json:"shootDate"`
+	Favorites      []Favorite `json:"favorites"`
+	PosterXPos     string     `json:"posterXPos"`
+	PosterYPos     string     `json:"posterYPos"`
+	ImageURLs      []Image    `json:"images"`
+
+	// AllowDownload is false for view only and unpurchased albums. Their download buttons are hidden
+	AllowDownload bool `json:"allowDownload"`
+
+	// Purchased is false while an album is a proof. Its images are watermarked
+	Purchased bool `json:"purchased"`
 }
 
 type Image struct {
-	ThumbnailURL string
-	OriginalURL  string
-	IsFavorite   bool
-	OriginalKey  string
-	OriginalPath string
+	ThumbnailURL string    `json:"thumbnailURL"`
+	OriginalURL  string    `json:"originalURL"`
+	IsFavorite   bool      `json:"isFavorite"`
+	FavoritedAt  string    `json:"favoritedAt,omitempty"`
+	OriginalKey  string    `json:"originalKey"`
+	OriginalPath string    `json:"originalPath"`
+	Comments     []Comment `json:"comments"`
+
+	// Width and Height are 0 until the cache run has read the original
+	Width     int   `json:"width"`
+	Height    int   `json:"height"`
+	SizeBytes int64 `json:"sizeBytes"`
+
+	// EditedURL is the edited version of the image to compare with the original. Empty when there isn't one
+	EditedURL string `json:"editedURL,omitempty"`
 }
@@ -1,7 +1,7 @@
 package models
 
 type Client struct {
-	ID    uint
-	Name  string
-	Email string
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
 }
@@ -0,0 +1,8 @@
+package models
+
+type Comment struct {
+	ID        uint   `json:"id"`
+	ImagePath string `json:"imagePath"`
+	Body      string `json:"body"`
+	CreatedAt string `json:"createdAt"`
+}
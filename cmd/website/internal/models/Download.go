@@ -0,0 +1,12 @@
+package models
+
+type Download struct {
+	AlbumID     uint   `json:"albumID"`
+	AlbumName   string `json:"albumName"`
+	CreatedAt   string `json:"createdAt"`
+	DownloadURL string `json:"downloadURL"`
+	ExpiresIn   string `json:"expiresIn"`
+	Filename    string `json:"filename"`
+	Part        int    `json:"part,omitempty"`
+	Size        string `json:"size"`
+}
@@ -0,0 +1,25 @@
+package models
+
+/*
+DownloadJob is a zip a client asked for, as it is being prepared. State is
+queued, running, completed, or failed.
+*/
+type DownloadJob struct {
+	ID            string   `json:"id"`
+	AlbumID       uint     `json:"albumID"`
+	AlbumName     string   `json:"albumName"`
+	State         string   `json:"state"`
+	QueuePosition int      `json:"queuePosition,omitempty"`
+	FilesDone     int      `json:"filesDone"`
+	FilesTotal    int      `json:"filesTotal"`
+	DownloadURLs  []string `json:"downloadURLs,omitempty"`
+	StartedAt     string   `json:"startedAt"`
+	UpdatedAt     string   `json:"updatedAt"`
+}
+
+// DownloadStatus is every zip a client has in progress or recently finished, newest first
+type DownloadStatus struct {
+	Jobs      []DownloadJob `json:"jobs"`
+	Completed int           `json:"completed"`
+	Total     int           `json:"total"`
+}
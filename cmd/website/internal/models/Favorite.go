@@ -1,6 +1,7 @@
 package models
 
 type Favorite struct {
-	ID        uint
-	ImagePath string
+	ID          uint   `json:"id"`
+	ImagePath   string `json:"imagePath"`
+	FavoritedAt string `json:"favoritedAt"`
 }
@@ -0,0 +1,147 @@
+package requestlog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	HeaderRequestID = "X-Request-ID"
+)
+
+type contextKey struct{}
+
+/*
+requestInfo is stored in the request context by the middleware. It is a
+pointer so middlewares further down the chain, like the client access
+middleware, can fill in details that get logged once the request finishes.
+*/
+type requestInfo struct {
+	clientID  uint
+	requestID string
+}
+
+/*
+NewMiddleware returns a middleware that assigns every request an ID, adds it
+to the response headers, and logs the method, path, status, duration, and
+client ID once the request completes. An incoming X-Request-ID header is
+reused so IDs can be correlated with an upstream proxy.
+*/
+func NewMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			info := &requestInfo{
+				requestID: r.Header.Get(HeaderRequestID),
+			}
+
+			if info.requestID == "" || len(info.requestID) > 64 {
+				info.requestID = newRequestID()
+			}
+
+			w.Header().Set(HeaderRequestID, info.requestID)
+
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			ctx := context.WithValue(r.Context(), contextKey{}, info)
+
+			next.ServeHTTP(sw, r.WithContext(ctx))
+
+			args := []any{
+				"requestID", info.requestID,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", sw.status,
+				"duration", time.Since(start),
+			}
+
+			if info.clientID != 0 {
+				args = append(args, "clientID", info.clientID)
+			}
+
+			slog.Info("request", args...)
+		})
+	}
+}
+
+/*
+Logger returns the default logger with the request ID attached. Handlers
+should use this instead of slog directly so their log lines can be tied
+back to a request.
+*/
+func Logger(r *http.Request) *slog.Logger {
+	return FromContext(r.Context())
+}
+
+/*
+FromContext is like Logger, for code that only has the request context.
+*/
+func FromContext(ctx context.Context) *slog.Logger {
+	if info, ok := ctx.Value(contextKey{}).(*requestInfo); ok {
+		return slog.With("requestID", info.requestID)
+	}
+
+	return slog.Default()
+}
+
+/*
+RequestID returns the ID of the current request, or an empty string when
+the request didn't go through the middleware.
+*/
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(contextKey{}).(*requestInfo); ok {
+		return info.requestID
+	}
+
+	return ""
+}
+
+/*
+SetClientID records the logged in client for the request log line.
+*/
+func SetClientID(r *http.Request, clientID uint) {
+	if info, ok := r.Context().Value(contextKey{}).(*requestInfo); ok {
+		info.clientID = clientID
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,139 @@
+package requestlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureLogs sends the default logger to a buffer for the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	previous := slog.Default()
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	return buf
+}
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	result := []map[string]any{}
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		entry := map[string]any{}
+
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+
+		result = append(result, entry)
+	}
+
+	return result
+}
+
+func TestMiddlewareSetsTheRequestIDHeader(t *testing.T) {
+	captureLogs(t)
+
+	handler := NewMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{name: "generated", wantSame: false},
+		{name: "from the proxy", incoming: "proxy-123", wantSame: true},
+		{name: "too long", incoming: strings.Repeat("a", 65), wantSame: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			if tt.incoming != "" {
+				r.Header.Set(HeaderRequestID, tt.incoming)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			got := w.Header().Get(HeaderRequestID)
+
+			if got == "" {
+				t.Fatalf("no %s header", HeaderRequestID)
+			}
+
+			if (got == tt.incoming) != tt.wantSame {
+				t.Errorf("%s = %q, incoming %q, want reused %v", HeaderRequestID, got, tt.incoming, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestMiddlewareLogsTheRequest(t *testing.T) {
+	buf := captureLogs(t)
+
+	handler := NewMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetClientID(r, 42)
+		Logger(r).Info("inside the handler")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/client/login", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	requestID := w.Header().Get(HeaderRequestID)
+	lines := logLines(t, buf)
+
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2: %s", len(lines), buf.String())
+	}
+
+	if lines[0]["requestID"] != requestID {
+		t.Errorf("handler log line = %v, want requestID %q", lines[0], requestID)
+	}
+
+	request := lines[1]
+
+	want := map[string]any{
+		"msg":       "request",
+		"requestID": requestID,
+		"method":    http.MethodPost,
+		"path":      "/client/login",
+		"status":    float64(http.StatusTeapot),
+		"clientID":  float64(42),
+	}
+
+	for key, value := range want {
+		if request[key] != value {
+			t.Errorf("%s = %v, want %v", key, request[key], value)
+		}
+	}
+
+	if _, ok := request["duration"]; !ok {
+		t.Errorf("request log line %v has no duration", request)
+	}
+}
+
+func TestLoggerOutsideTheMiddleware(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	if Logger(r) != slog.Default() {
+		t.Errorf("Logger without the middleware is not the default logger")
+	}
+
+	if id := RequestID(r.Context()); id != "" {
+		t.Errorf("RequestID = %q, want empty", id)
+	}
+}
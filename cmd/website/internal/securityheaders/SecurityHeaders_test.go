@@ -0,0 +1,108 @@
+package securityheaders
+
+import (
+	"crypto/tls"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html><body><h1>{{.}}</h1><script src="/static/js/htmx.min.js"></script></body></html>`))
+
+func renderPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = pageTemplate.Execute(w, "Albums")
+}
+
+func TestMiddlewareSetsHeadersOnPages(t *testing.T) {
+	handler := NewMiddleware(Config{})(http.HandlerFunc(renderPage))
+
+	r := httptest.NewRequest(http.MethodGet, "/client", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<h1>Albums</h1>") {
+		t.Fatalf("status = %d, body = %q; want the rendered page", w.Code, w.Body.String())
+	}
+
+	want := map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"X-Frame-Options":        "DENY",
+		"Referrer-Policy":        "strict-origin-when-cross-origin",
+	}
+
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+
+	csp := w.Header().Get("Content-Security-Policy")
+
+	for _, directive := range []string{"default-src 'self'", "script-src 'self' https://cdnjs.cloudflare.com", "frame-ancestors 'none'", "object-src 'none'"} {
+		if !strings.Contains(csp, directive) {
+			t.Errorf("Content-Security-Policy = %q, want it to contain %q", csp, directive)
+		}
+	}
+
+	if strings.Contains(csp, "unsafe-eval") || strings.Contains(csp, "script-src 'self' 'unsafe-inline'") {
+		t.Errorf("Content-Security-Policy = %q, want no inline or eval'd scripts", csp)
+	}
+
+	if got := w.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("Strict-Transport-Security = %q over plain HTTP, want it unset", got)
+	}
+}
+
+func TestMiddlewareAllowsConfiguredImageSources(t *testing.T) {
+	handler := NewMiddleware(Config{
+		ImageSources: []string{"https://s3.us-east-1.amazonaws.com", "https://*.s3.us-east-1.amazonaws.com", "https://cdn.example.com"},
+	})(http.HandlerFunc(renderPage))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	csp := w.Header().Get("Content-Security-Policy")
+	want := "img-src 'self' data: https://s3.us-east-1.amazonaws.com https://*.s3.us-east-1.amazonaws.com https://cdn.example.com;"
+
+	if !strings.Contains(csp, want) {
+		t.Errorf("Content-Security-Policy = %q, want it to contain %q", csp, want)
+	}
+}
+
+func TestMiddlewareOnlySendsHSTSOverHTTPS(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(r *http.Request)
+		want  bool
+	}{
+		{name: "plain http", setup: func(r *http.Request) {}},
+		{name: "tls", setup: func(r *http.Request) { r.TLS = &tls.ConnectionState{} }, want: true},
+		{name: "behind a proxy", setup: func(r *http.Request) { r.Header.Set("X-Forwarded-Proto", "https") }, want: true},
+		{name: "proxied plain http", setup: func(r *http.Request) { r.Header.Set("X-Forwarded-Proto", "http") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			tt.setup(r)
+
+			w := httptest.NewRecorder()
+			NewMiddleware(Config{})(http.HandlerFunc(renderPage)).ServeHTTP(w, r)
+
+			got := w.Header().Get("Strict-Transport-Security")
+
+			if (got != "") != tt.want {
+				t.Errorf("Strict-Transport-Security = %q, want it set %v", got, tt.want)
+			}
+
+			if tt.want && got != "max-age=31536000; includeSubDomains" {
+				t.Errorf("Strict-Transport-Security = %q, want %q", got, "max-age=31536000; includeSubDomains")
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package seed
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/createbucketoptions"
+	"github.com/adampresley/adamgokit/s3/putoptions"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/cache"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+	"github.com/rfberaldo/sqlz"
+)
+
+const (
+	// SampleAccessCode is what the sample client logs in with
+	SampleAccessCode = "sample-client"
+)
+
+var (
+	ErrAlreadySeeded    = errors.New("sample data has already been seeded")
+	ErrNotLocalEndpoint = errors.New("refusing to seed a non-local S3 endpoint")
+
+	//go:embed images
+	bundledImages embed.FS
+
+	sampleAlbums = []services.CreateAlbumRequest{
+		{Name: "Family Session", ShootDate: "2024-05-18"},
+		{Name: "Fall Portraits", ShootDate: "2024-10-05"},
+	}
+)
+
+type SeederConfig struct {
+	AlbumService        services.AlbumServicer
+	Bucket              string
+	CacheCreator        cache.CacheCreator
+	ClientPhotoFolder   string
+	ClientService       services.ClientServicer
+	Endpoint            string
+	HomePagePhotoFolder string
+	Region              string
+	S3Client            s3.S3Client
+
+	// Images holds the sample photos at its root. Defaults to the bundled ones
+	Images fs.FS
+}
+
+type Seeder struct {
+	albumService        services.AlbumServicer
+	bucket              string
+	cacheCreator        cache.CacheCreator
+	clientPhotoFolder   string
+	clientService       services.ClientServicer
+	endpoint            string
+	homePagePhotoFolder string
+	images              fs.FS
+	region              string
+	s3Client            s3.S3Client
+}
+
+/*
+Result describes what Seed created.
+*/
+type Result struct {
+	Client     *models.Client
+	AccessCode string
+	Albums     []*models.Album
+	Keys       []string
+
+	// CacheCreated is false when another instance held the cache creator lock
+	CacheCreated bool
+}
+
+func NewSeeder(config SeederConfig) Seeder {
+	if config.Images == nil {
+		config.Images, _ = fs.Sub(bundledImages, "images")
+	}
+
+	return Seeder{
+		albumService:        config.AlbumService,
+		bucket:              config.Bucket,
+		cacheCreator:        config.CacheCreator,
+		clientPhotoFolder:   config.ClientPhotoFolder,
+		clientService:       config.ClientService,
+		endpoint:            config.Endpoint,
+		homePagePhotoFolder: config.HomePagePhotoFolder,
+		images:              config.Images,
+		region:              config.Region,
+		s3Client:            config.S3Client,
+	}
+}
+
+/*
+Seed creates a sample client who logs in with SampleAccessCode, gives them
+a couple of albums filled with the sample photos, and puts the same photos
+on the home page. A cache run then creates thumbnails and hero banners so
+the site looks the way it would in production.
+
+It only runs against a local S3 endpoint, like LocalStack, and stops with
+ErrAlreadySeeded when the sample client already exists.
+*/
+func (s Seeder) Seed() (Result, error) {
+	var (
+		err    error
+		images map[string][]byte
+		album  *models.Album
+	)
+
+	result := Result{}
+
+	if !IsLocalEndpoint(s.endpoint) {
+		return result, fmt.Errorf("%w '%s'", ErrNotLocalEndpoint, s.endpoint)
+	}
+
+	if _, _, err = s.clientService.GetByPassword(SampleAccessCode); err == nil {
+		return result, ErrAlreadySeeded
+	}
+
+	if !sqlz.IsNotFound(err) {
+		return result, fmt.Errorf("error checking for the sample client: %w", err)
+	}
+
+	if images, err = s.readImages(); err != nil {
+		return result, err
+	}
+
+	if err = s.ensureBucketExists(); err != nil {
+		return result, err
+	}
+
+	result.Client, _, err = s.clientService.Create(services.CreateClientRequest{
+		Name:            "Sample Client",
+		Email:           "sample@example.com",
+		AccessCode:      SampleAccessCode,
+		AccessCodeLabel: "Seeded",
+	})
+
+	if err != nil {
+		return result, fmt.Errorf("error creating the sample client: %w", err)
+	}
+
+	result.AccessCode = SampleAccessCode
+
+	for _, request := range sampleAlbums {
+		request.ClientID = result.Client.ID
+
+		if album, err = s.albumService.Create(request); err != nil {
+			return result, fmt.Errorf("error creating sample album '%s': %w", request.Name, err)
+		}
+
+		prefix := fmt.Sprintf("%s/%d/%d/originals/", s.clientPhotoFolder, album.ClientID, album.ID)
+
+		if err = s.upload(prefix, images, &result); err != nil {
+			return result, err
+		}
+
+		if err = s.albumService.SetPoster(album.ClientID, album.ID, firstImage(images), "50%", "50%"); err != nil {
+			return result, fmt.Errorf("error setting the poster for sample album '%s': %w", album.Name, err)
+		}
+
+		if album, err = s.albumService.GetAlbum(album.ClientID, album.ID); err != nil {
+			return result, fmt.Errorf("error reading back sample album '%s': %w", request.Name, err)
+		}
+
+		result.Albums = append(result.Albums, album)
+	}
+
+	if err = s.upload(path.Join(s.homePagePhotoFolder, "original")+"/", images, &result); err != nil {
+		return result, err
+	}
+
+	result.CacheCreated, err = s.runCache()
+	return result, err
+}
+
+/*
+runCache creates thumbnails and hero banners for everything that was
+uploaded. If a running server holds the cache creator lock the run is
+skipped, since that server will pick up the new photos on its next run.
+*/
+func (s Seeder) runCache() (bool, error) {
+	acquired, err := s.cacheCreator.TryAcquireLock()
+
+	if err != nil {
+		return false, fmt.Errorf("error acquiring the cache creator lock: %w", err)
+	}
+
+	if !acquired {
+		return false, nil
+	}
+
+	s.cacheCreator.CreateCache()
+
+	if err = s.cacheCreator.ReleaseLock(); err != nil {
+		return true, fmt.Errorf("error releasing the cache creator lock: %w", err)
+	}
+
+	return true, nil
+}
+
+func (s Seeder) readImages() (map[string][]byte, error) {
+	var (
+		err     error
+		entries []fs.DirEntry
+		b       []byte
+	)
+
+	result := map[string][]byte{}
+
+	if entries, err = fs.ReadDir(s.images, "."); err != nil {
+		return nil, fmt.Errorf("error reading sample images: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		if b, err = fs.ReadFile(s.images, entry.Name()); err != nil {
+			return nil, fmt.Errorf("error reading sample image '%s': %w", entry.Name(), err)
+		}
+
+		result[entry.Name()] = b
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("there are no sample images to seed")
+	}
+
+	return result, nil
+}
+
+func (s Seeder) ensureBucketExists() error {
+	exists, err := s.s3Client.BucketExists(s.bucket)
+
+	if err != nil {
+		return fmt.Errorf("error checking bucket '%s' exists: %w", s.bucket, err)
+	}
+
+	if exists {
+		return nil
+	}
+
+	if err = s.s3Client.CreateBucket(s.bucket, createbucketoptions.WithRegion(s.region)); err != nil {
+		return fmt.Errorf("error creating bucket '%s': %w", s.bucket, err)
+	}
+
+	return nil
+}
+
+func (s Seeder) upload(prefix string, images map[string][]byte, result *Result) error {
+	for _, name := range sortedNames(images) {
+		key := prefix + name
+
+		_, err := s.s3Client.Put(
+			s.bucket,
+			key,
+			bytes.NewReader(images[name]),
+			putoptions.WithContentType(http.DetectContentType(images[name])),
+		)
+
+		if err != nil {
+			return fmt.Errorf("error uploading sample image '%s': %w", key, err)
+		}
+
+		result.Keys = append(result.Keys, key)
+	}
+
+	return nil
+}
+
+/*
+IsLocalEndpoint reports whether an S3 endpoint points at this machine or a
+LocalStack container. localhost.localstack.cloud is LocalStack's own name
+that resolves to 127.0.0.1. A blank endpoint means real AWS.
+*/
+func IsLocalEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+
+	if host == "localhost" || host == "localstack" || host == "host.docker.internal" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".localhost.localstack.cloud") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func sortedNames(images map[string][]byte) []string {
+	result := make([]string, 0, len(images))
+
+	for name := range images {
+		result = append(result, name)
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+func firstImage(images map[string][]byte) string {
+	return sortedNames(images)[0]
+}
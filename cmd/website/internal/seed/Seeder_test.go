@@ -0,0 +1,293 @@
+package seed
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/putoptions"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/cache"
+	"github.com/adampresley/adampresleyphotography/pkg/migrations"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+	_ "github.com/glebarez/sqlite"
+	"github.com/rfberaldo/sqlz"
+	"github.com/rfberaldo/sqlz/binds"
+)
+
+/*
+memoryS3Client keeps uploads in memory. The bucket always exists. Anything
+else panics through the nil embedded interface.
+*/
+type memoryS3Client struct {
+	s3.S3Client
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *memoryS3Client) BucketExists(bucket string) (bool, error) {
+	return true, nil
+}
+
+func (m *memoryS3Client) Put(bucket, key string, body io.Reader, options ...putoptions.PutOption) (s3.PutObjectResponse, error) {
+	data, err := io.ReadAll(body)
+
+	if err != nil {
+		return s3.PutObjectResponse{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[key] = data
+	return s3.PutObjectResponse{}, nil
+}
+
+func (m *memoryS3Client) keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]string, 0, len(m.objects))
+
+	for key := range m.objects {
+		result = append(result, key)
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+/*
+fakeCacheCreator counts cache runs. The lock is available unless locked is
+set. Anything else panics through the nil embedded interface.
+*/
+type fakeCacheCreator struct {
+	cache.CacheCreator
+
+	locked   bool
+	runs     int
+	released int
+}
+
+func (f *fakeCacheCreator) TryAcquireLock() (bool, error) {
+	return !f.locked, nil
+}
+
+func (f *fakeCacheCreator) ReleaseLock() error {
+	f.released++
+	return nil
+}
+
+func (f *fakeCacheCreator) CreateCache() {
+	f.runs++
+}
+
+func newTestDB(t *testing.T) *sqlz.DB {
+	t.Helper()
+
+	binds.Register("sqlite", binds.BindByDriver("sqlite3"))
+
+	db, err := sqlz.Connect("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("error opening test database: %v", err)
+	}
+
+	// Every connection to :memory: gets its own database
+	db.Pool().SetMaxOpenConns(1)
+
+	t.Cleanup(func() {
+		_ = db.Pool().Close()
+	})
+
+	migrator := migrations.NewMigrator(migrations.MigratorConfig{
+		DB: db,
+		FS: os.DirFS(filepath.Join("..", "..", "sql-migrations")),
+	})
+
+	if _, err = migrator.Migrate(); err != nil {
+		t.Fatalf("error running migrations: %v", err)
+	}
+
+	return db
+}
+
+type testSeeder struct {
+	seeder        Seeder
+	s3Client      *memoryS3Client
+	cacheCreator  *fakeCacheCreator
+	albumService  services.AlbumService
+	clientService services.ClientService
+}
+
+func newTestSeeder(t *testing.T, endpoint string) testSeeder {
+	db := newTestDB(t)
+
+	result := testSeeder{
+		s3Client:      &memoryS3Client{objects: map[string][]byte{}},
+		cacheCreator:  &fakeCacheCreator{},
+		albumService:  services.NewAlbumService(services.AlbumServiceConfig{DB: db}),
+		clientService: services.NewClientService(services.ClientServiceConfig{DB: db}),
+	}
+
+	result.seeder = NewSeeder(SeederConfig{
+		AlbumService:        result.albumService,
+		Bucket:              "test-bucket",
+		CacheCreator:        result.cacheCreator,
+		ClientPhotoFolder:   "clients",
+		ClientService:       result.clientService,
+		Endpoint:            endpoint,
+		HomePagePhotoFolder: "home-page",
+		S3Client:            result.s3Client,
+		Images: fstest.MapFS{
+			"b.jpg":     {Data: []byte("\xff\xd8\xff\xe0 second")},
+			"a.jpg":     {Data: []byte("\xff\xd8\xff\xe0 first")},
+			".DS_Store": {Data: []byte("junk")},
+		},
+	})
+
+	return result
+}
+
+func TestSeed(t *testing.T) {
+	ts := newTestSeeder(t, "http://localhost:4566")
+
+	result, err := ts.seeder.Seed()
+
+	if err != nil {
+		t.Fatalf("Seed() = %v", err)
+	}
+
+	// The sample client can log in with the known access code
+	client, _, err := ts.clientService.GetByPassword(SampleAccessCode)
+
+	if err != nil || client.ID != result.Client.ID {
+		t.Fatalf("GetByPassword(%s) = %+v, %v; want client %d", SampleAccessCode, client, err, result.Client.ID)
+	}
+
+	albums, err := ts.albumService.GetAlbumList(client.ID)
+
+	if err != nil || len(albums) != len(sampleAlbums) {
+		t.Fatalf("GetAlbumList() = %d albums, %v; want %d", len(albums), err, len(sampleAlbums))
+	}
+
+	for _, album := range result.Albums {
+		if album.PosterImagePath != "a.jpg" {
+			t.Errorf("album %d poster = %q, want a.jpg", album.ID, album.PosterImagePath)
+		}
+	}
+
+	first, second := result.Albums[0], result.Albums[1]
+
+	want := []string{
+		fmt.Sprintf("clients/%d/%d/originals/a.jpg", client.ID, first.ID),
+		fmt.Sprintf("clients/%d/%d/originals/b.jpg", client.ID, first.ID),
+		fmt.Sprintf("clients/%d/%d/originals/a.jpg", client.ID, second.ID),
+		fmt.Sprintf("clients/%d/%d/originals/b.jpg", client.ID, second.ID),
+		"home-page/original/a.jpg",
+		"home-page/original/b.jpg",
+	}
+
+	sort.Strings(want)
+
+	if got := ts.s3Client.keys(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("uploaded keys = %v, want %v", got, want)
+	}
+
+	if ts.cacheCreator.runs != 1 || ts.cacheCreator.released != 1 || !result.CacheCreated {
+		t.Errorf("cache runs = %d, released = %d, created = %v; want one run with the lock released", ts.cacheCreator.runs, ts.cacheCreator.released, result.CacheCreated)
+	}
+}
+
+func TestSeedOnlyOnce(t *testing.T) {
+	ts := newTestSeeder(t, "http://127.0.0.1:4566")
+
+	if _, err := ts.seeder.Seed(); err != nil {
+		t.Fatalf("Seed() = %v", err)
+	}
+
+	uploaded := len(ts.s3Client.keys())
+
+	if _, err := ts.seeder.Seed(); !errors.Is(err, ErrAlreadySeeded) {
+		t.Errorf("second Seed() = %v, want ErrAlreadySeeded", err)
+	}
+
+	if len(ts.s3Client.keys()) != uploaded || ts.cacheCreator.runs != 1 {
+		t.Errorf("the second seed uploaded or cached again")
+	}
+}
+
+func TestSeedSkipsTheCacheRunWhenLocked(t *testing.T) {
+	ts := newTestSeeder(t, "http://localstack:4566")
+	ts.cacheCreator.locked = true
+
+	result, err := ts.seeder.Seed()
+
+	if err != nil {
+		t.Fatalf("Seed() = %v", err)
+	}
+
+	if result.CacheCreated || ts.cacheCreator.runs != 0 || ts.cacheCreator.released != 0 {
+		t.Errorf("created = %v, runs = %d, released = %d; want the run skipped", result.CacheCreated, ts.cacheCreator.runs, ts.cacheCreator.released)
+	}
+}
+
+func TestSeedRefusesRemoteEndpoints(t *testing.T) {
+	for _, endpoint := range []string{"", "https://s3.us-east-1.amazonaws.com", "https://nyc3.digitaloceanspaces.com"} {
+		ts := newTestSeeder(t, endpoint)
+
+		if _, err := ts.seeder.Seed(); !errors.Is(err, ErrNotLocalEndpoint) {
+			t.Errorf("Seed() with endpoint %q = %v, want ErrNotLocalEndpoint", endpoint, err)
+		}
+
+		if keys := ts.s3Client.keys(); len(keys) != 0 {
+			t.Errorf("endpoint %q: uploaded %v, want nothing", endpoint, keys)
+		}
+
+		if _, _, err := ts.clientService.GetByPassword(SampleAccessCode); !sqlz.IsNotFound(err) {
+			t.Errorf("endpoint %q: sample client was created", endpoint)
+		}
+	}
+}
+
+func TestIsLocalEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     bool
+	}{
+		{endpoint: "http://localhost:4566", want: true},
+		{endpoint: "http://LOCALHOST:4566", want: true},
+		{endpoint: "http://127.0.0.1:4566", want: true},
+		{endpoint: "http://[::1]:4566", want: true},
+		{endpoint: "http://localstack:4566", want: true},
+		{endpoint: "http://s3.localhost.localstack.cloud:4566", want: true},
+		{endpoint: "http://bucket.localhost:4566", want: true},
+		{endpoint: "", want: false},
+		{endpoint: "https://s3.amazonaws.com", want: false},
+		{endpoint: "http://localhost.example.com", want: false},
+		{endpoint: "http://10.0.0.5:4566", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := IsLocalEndpoint(tt.endpoint); got != tt.want {
+			t.Errorf("IsLocalEndpoint(%q) = %v, want %v", tt.endpoint, got, tt.want)
+		}
+	}
+}
+
+func TestBundledImages(t *testing.T) {
+	seeder := NewSeeder(SeederConfig{})
+
+	images, err := seeder.readImages()
+
+	if err != nil || len(images) == 0 {
+		t.Fatalf("readImages() = %d images, %v; want the bundled images", len(images), err)
+	}
+}
@@ -1,22 +1,48 @@
 package viewmodels
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/adampresley/adamgokit/rendering"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/i18n"
 	"github.com/adampresley/adampresleyphotography/pkg/models"
 )
 
+type contextKey int
+
+const (
+	clientContextKey contextKey = iota
+)
+
 type BaseViewModel struct {
+	Branding           Branding
 	Message            string
 	IsError            bool
 	IsWarning          bool
 	IsHtmx             bool
 	JavascriptIncludes []rendering.JavascriptInclude
+	Locale             string
+}
+
+/*
+T translates key into the page's locale. Templates call it as
+{{.T "login.title"}}.
+*/
+func (b BaseViewModel) T(key string, args ...any) string {
+	return i18n.Translate(b.Locale, key, args...)
+}
+
+/*
+ContextWithClient returns a copy of ctx carrying the logged in client, for
+GetClientFromContext to retrieve.
+*/
+func ContextWithClient(ctx context.Context, client *models.Client) context.Context {
+	return context.WithValue(ctx, clientContextKey, client)
 }
 
 func GetClientFromContext(r *http.Request) *models.Client {
-	if result, ok := r.Context().Value("client").(*models.Client); ok {
+	if result, ok := r.Context().Value(clientContextKey).(*models.Client); ok {
 		return result
 	}
 
@@ -0,0 +1,32 @@
+package viewmodels
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+func TestClientRoundTripsThroughContext(t *testing.T) {
+	client := &models.Client{BaseModel: models.BaseModel{ID: 42}, Name: "Jane"}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(ContextWithClient(r.Context(), client))
+
+	if got := GetClientFromContext(r); got != client {
+		t.Errorf("GetClientFromContext = %+v, want %+v", got, client)
+	}
+}
+
+func TestClientIsNotReadFromAStringKey(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	//lint:ignore SA1029 this is the old, colliding key the typed key replaced
+	r = r.WithContext(context.WithValue(r.Context(), "client", &models.Client{BaseModel: models.BaseModel{ID: 42}}))
+
+	if got := GetClientFromContext(r); got.ID != 0 {
+		t.Errorf("GetClientFromContext = client %d, want an empty client", got.ID)
+	}
+}
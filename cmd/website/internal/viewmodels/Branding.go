@@ -0,0 +1,11 @@
+package viewmodels
+
+/*
+Branding is who the site belongs to. Layouts use it for the page title,
+logo, and favicon.
+*/
+type Branding struct {
+	SiteName    string
+	LogoPath    string
+	FaviconPath string
+}
@@ -0,0 +1,7 @@
+package viewmodels
+
+type ClientAlbumExpired struct {
+	BaseViewModel
+
+	AlbumName string
+}
@@ -8,6 +8,27 @@ import (
 type ClientAlbumList struct {
 	BaseViewModel
 
-	Client *models.Client
+	Client    *models.Client
+	Albums    []internalmodels.Album
+	Galleries []ClientGallery
+	Filter    ClientAlbumListFilter
+}
+
+/*
+ClientGallery is a section of the album list. Albums that aren't in a
+gallery are shown in a section with no name.
+*/
+type ClientGallery struct {
+	Name   string
 	Albums []internalmodels.Album
 }
+
+type ClientAlbumListFilter struct {
+	Query string
+	From  string
+	To    string
+}
+
+func (f ClientAlbumListFilter) IsActive() bool {
+	return f.Query != "" || f.From != "" || f.To != ""
+}
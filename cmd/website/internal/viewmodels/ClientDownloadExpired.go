@@ -0,0 +1,7 @@
+package viewmodels
+
+type ClientDownloadExpired struct {
+	BaseViewModel
+
+	AlbumID uint
+}
@@ -7,4 +7,14 @@ type ClientDownloadStarted struct {
 
 	Client *models.Client
 	Album  *models.Album
+
+	FileCount     int
+	EstimatedSize string
+	QueuePosition int
+
+	// PreviewThumbnailURLs are a few of the album's thumbnails, the poster and favorites first
+	PreviewThumbnailURLs []string
+
+	// Resent is set when the link to an existing zip was emailed again
+	Resent bool
 }
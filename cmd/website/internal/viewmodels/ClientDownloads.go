@@ -0,0 +1,13 @@
+package viewmodels
+
+import (
+	internalmodels "github.com/adampresley/adampresleyphotography/cmd/website/internal/models"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+type ClientDownloads struct {
+	BaseViewModel
+
+	Client    *models.Client
+	Downloads []internalmodels.Download
+}
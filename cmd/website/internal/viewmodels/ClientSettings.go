@@ -0,0 +1,7 @@
+package viewmodels
+
+type ClientSettings struct {
+	BaseViewModel
+
+	NotifyOnDownload bool
+}
@@ -11,4 +11,10 @@ type ClientViewAlbum struct {
 	Client  *models.Client
 	AlbumID uint
 	Album   internalmodels.Album
+
+	// ImageUrlRefreshSeconds is how long before the page fetches fresh image URLs. 0 never refreshes
+	ImageUrlRefreshSeconds int
+
+	// Preview is set when the photographer is looking at the album instead of the client
+	Preview bool
 }
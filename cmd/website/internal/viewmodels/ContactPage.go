@@ -0,0 +1,10 @@
+package viewmodels
+
+type ContactPage struct {
+	BaseViewModel
+
+	Name    string
+	Email   string
+	Inquiry string
+	Sent    bool
+}
@@ -1,11 +1,17 @@
 package viewmodels
 
+import "time"
+
 type HomePage struct {
 	BaseViewModel
-	Photos []HomePagePhoto
+	FromCache  bool
+	Photos     []HomePagePhoto
+	NextOffset int
 }
 
 type HomePagePhoto struct {
+	CapturedAt    time.Time
+	Featured      bool
 	OriginalPath  string
 	ThumbnailPath string
 	FileName      string
@@ -4,11 +4,12 @@ import (
 	"context"
 	"embed"
 	"encoding/gob"
+	"fmt"
 	"io/fs"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -19,17 +20,36 @@ import (
 	"github.com/adampresley/adamgokit/retrier"
 	"github.com/adampresley/adamgokit/s3"
 	"github.com/adampresley/adamgokit/sessions"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/admin"
 	"github.com/adampresley/adampresleyphotography/cmd/website/internal/cache"
 	"github.com/adampresley/adampresleyphotography/cmd/website/internal/clientaccess"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/compress"
 	"github.com/adampresley/adampresleyphotography/cmd/website/internal/configuration"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/contact"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/csrf"
 	"github.com/adampresley/adampresleyphotography/cmd/website/internal/home"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/requestlog"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/securityheaders"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/viewmodels"
+	"github.com/adampresley/adampresleyphotography/pkg/metrics"
+	"github.com/adampresley/adampresleyphotography/pkg/migrations"
 	"github.com/adampresley/adampresleyphotography/pkg/models"
 	"github.com/adampresley/adampresleyphotography/pkg/services"
 	_ "github.com/glebarez/sqlite"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rfberaldo/sqlz"
 	"github.com/rfberaldo/sqlz/binds"
 )
 
+const (
+	adminShutdownTimeout    = time.Second * 30
+	cacheShutdownTimeout    = time.Second * 15
+	defaultCacheRunInterval = time.Hour
+	zipShutdownTimeout      = time.Minute
+)
+
 var (
 	Version string = "development"
 	appName string = "adampresleyphotography"
@@ -43,27 +63,76 @@ var (
 	config configuration.Config
 
 	/* Services */
-	albumService        services.AlbumServicer
-	cacheCreatorService cache.CacheCreator
-	clientService       services.ClientServicer
-	db                  *sqlz.DB
-	renderer            rendering.TemplateRenderer
-	sessionService      sessions.Session[*models.Client]
-	zipService          services.ZipServicer
+	albumService         services.AlbumServicer
+	cacheCreatorService  cache.CacheCreator
+	cacheFailureService  services.CacheFailureServicer
+	clientService        services.ClientServicer
+	homePagePhotoService services.HomePagePhotoServicer
+	db                   *sqlz.DB
+	imageEventService    services.ImageEventServicer
+	renderer             rendering.TemplateRenderer
+	sessionService       sessions.Session[*models.Client]
+	zipService           services.ZipServicer
 
 	/* Controllers */
+	adminController        admin.AdminController
 	clientAccessController clientaccess.ClientAccessController
+	contactController      contact.ContactHandlers
 	homeController         home.HomeHandlers
 )
 
 func main() {
 	var (
-		err error
+		err     error
+		command string
+		audit   auditOptions
 	)
 
-	config = configuration.LoadConfig()
+	command, os.Args = parseCommand(os.Args)
+
+	if command == commandAudit {
+		audit, os.Args = parseAuditArgs(os.Args)
+	}
+
+	config, err = configuration.LoadConfig()
 	setupLogger(&config, Version)
 
+	if err != nil {
+		slog.Error("error loading configuration", "error", err)
+		os.Exit(1)
+	}
+
+	err = runCommand(command, map[string]func() error{
+		commandAudit: func() error {
+			return auditCommand(audit)
+		},
+		commandMigrate: migrateCommand,
+		commandSeed:    seedCommand,
+		commandServe:   serve,
+	})
+
+	if err != nil {
+		slog.Error(err.Error(), "command", command)
+		os.Exit(1)
+	}
+}
+
+/*
+serve runs the website until it receives a shutdown signal.
+*/
+func serve() error {
+	var (
+		err error
+	)
+
+	if err = config.Validate(); err != nil {
+		return err
+	}
+
+	for _, warning := range config.Warnings() {
+		slog.Warn("!!! " + warning + " !!!")
+	}
+
 	slog.Info("configuration loaded",
 		slog.String("app", appName),
 		slog.String("version", Version),
@@ -80,38 +149,38 @@ func main() {
 	/*
 	 * Setup services
 	 */
-	binds.Register("sqlite", binds.BindByDriver("sqlite3"))
-	if db, err = sqlz.Connect("sqlite", config.DSN); err != nil {
+	if err = connectDatabase(); err != nil {
 		panic(err)
 	}
 
 	migrateDatabase()
 	gob.Register(&models.Client{})
 
-	cookieStore := sessions.NewCookieStore(config.CookieSecret)
-	sessionService = sessions.NewSessionWrapper[*models.Client](cookieStore, "adamphotographyclients", "client")
+	metricsRegistry := prometheus.NewRegistry()
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
 
-	awsConfig := &awsconfig.Config{
-		Endpoint:        config.AwsEndpointUrl,
-		Region:          config.AwsRegion,
-		AccessKeyID:     config.AwsAccessKeyId,
-		SecretAccessKey: config.AwsSecretAccessKey,
+	if err = metrics.Register(metricsRegistry); err != nil {
+		panic(err)
 	}
 
-	retrier.Retry(func() error {
-		if err = awsConfig.Load(); err != nil {
-			slog.Error("failed to load AWS config. trying again", "error", err)
-			return err
-		}
+	sessionShortTTL := time.Duration(config.SessionShortTTL) * time.Hour
+	sessionRememberTTL := time.Duration(config.SessionRememberTTL) * time.Hour
 
-		return nil
-	})
+	/*
+	 * The cookie codec rejects cookies older than its max age, so it has to
+	 * allow the longer "remember me" lifetime. New sessions default to the
+	 * short lifetime and LoginAction extends it when asked.
+	 */
+	cookieStore := sessions.NewCookieStore(config.CookieSecret)
+	cookieStore.MaxAge(int(sessionRememberTTL.Seconds()))
+	cookieStore.Options.MaxAge = int(sessionShortTTL.Seconds())
 
-	if err != nil {
-		panic(err)
-	}
+	sessionService = sessions.NewSessionWrapper[*models.Client](cookieStore, "adamphotographyclients", "client")
 
-	s3Client, err := s3.NewClient(awsConfig)
+	s3Client, err := newS3Client()
 
 	if err != nil {
 		panic(err)
@@ -132,55 +201,146 @@ func main() {
 		DB: db,
 	})
 
+	cacheFailureService = services.NewCacheFailureService(services.CacheFailureServiceConfig{
+		DB: db,
+	})
+
 	clientService = services.NewClientService(services.ClientServiceConfig{
 		DB: db,
 	})
 
-	zipService = services.NewZipService(services.ZipServiceConfig{
-		AlbumService:      albumService,
-		BaseDownloadURL:   config.DownloadBaseURL,
-		Bucket:            config.AwsBucket,
-		ClientPhotoFolder: config.ClientsPhotoFolder,
-		ClientService:     clientService,
-		ExpirationDays:    config.DownloadExpirationDays,
-		S3Client:          s3Client,
-		EmailApiKey:       config.EmailApiKey,
-		FromName:          "Adam Presley",
-		FromEmail:         "noreply@adampresleyphotography.com",
+	homePagePhotoService = services.NewHomePagePhotoService(services.HomePagePhotoServiceConfig{
+		DB: db,
 	})
 
-	cacheCreatorService = cache.NewCacheCreatorService(cache.CacheCreatorConfig{
-		AlbumService:        albumService,
-		AwsBucket:           config.AwsBucket,
-		AwsRegion:           config.AwsRegion,
-		ClientsPhotoFolder:  config.ClientsPhotoFolder,
-		ClientService:       clientService,
-		HomePagePhotoFolder: config.HomePagePhotoFolder,
-		MaxCacheWorkers:     config.MaxCacheWorkers,
-		S3Client:            s3Client,
-		ShutdownCtx:         shutdownCtx,
+	migratedAccessCodes, err := clientService.MigrateLegacyAccessCodes()
+
+	if err != nil {
+		panic(err)
+	}
+
+	if migratedAccessCodes > 0 {
+		slog.Info("hashed plain text access codes", slog.Int("count", migratedAccessCodes))
+	}
+
+	imageEventService = services.NewImageEventService(services.ImageEventServiceConfig{
+		DB: db,
+	})
+
+	imageEventService.Start()
+
+	emailSender, err := services.NewEmailSender(services.EmailSenderConfig{
+		ApiKey:       config.EmailApiKey,
+		Provider:     config.EmailProvider,
+		SmtpHost:     config.SmtpHost,
+		SmtpPassword: config.SmtpPassword,
+		SmtpPort:     config.SmtpPort,
+		SmtpUser:     config.SmtpUser,
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	zipService = services.NewZipService(services.ZipServiceConfig{
+		AlbumService:         albumService,
+		BaseDownloadURL:      config.DownloadBaseURL,
+		Bucket:               config.AwsBucket,
+		ClientPhotoFolder:    config.ClientsPhotoFolder,
+		ClientService:        clientService,
+		DownloadTokenSecret:  config.DownloadTokenSecret,
+		DownloadWorkers:      config.ZipDownloadWorkers,
+		ExpirationDays:       config.DownloadExpirationDays,
+		FavoritesFolder:      config.ZipFavoritesFolder,
+		S3Client:             s3Client,
+		EmailSender:          emailSender,
+		EmailTemplate:        services.LoadEmailTemplate(appFS, config.EmailTemplatePath, config.EmailSubject),
+		IncludeManifest:      config.ZipIncludeManifest,
+		MaxZipBytes:          int64(config.ZipMaxSizeMB) * 1024 * 1024,
+		FromName:             config.SenderName(),
+		FromEmail:            config.FromEmail,
+		MaxConcurrentZipJobs: config.MaxConcurrentZipJobs,
+		MaxZipJobsPerClient:  config.MaxZipJobsPerClient,
+		WebhookURL:           config.WebhookURL,
+		WebhookSecret:        config.WebhookSecret,
 	})
 
+	if cacheCreatorService, err = newCacheCreator(s3Client, shutdownCtx); err != nil {
+		panic(err)
+	}
+
 	/*
 	 * Setup controllers
 	 */
+	branding := viewmodels.Branding{
+		SiteName:    config.SiteName,
+		LogoPath:    config.BrandLogoPath,
+		FaviconPath: config.FaviconPath,
+	}
+
+	trustedProxies, err := configuration.ParseTrustedProxies(config.TrustedProxies)
+
+	if err != nil {
+		panic(err)
+	}
+
 	clientAccessController = clientaccess.NewClientAccessController(clientaccess.ClientAccessControllerConfig{
-		AlbumService:      albumService,
-		Bucket:            config.AwsBucket,
-		ClientPhotoFolder: config.ClientsPhotoFolder,
-		ClientService:     clientService,
-		Renderer:          renderer,
-		S3Client:          s3Client,
-		SessionService:    sessionService,
-		ZipService:        zipService,
+		AlbumService:           albumService,
+		Branding:               branding,
+		Bucket:                 config.AwsBucket,
+		CacheCreator:           cacheCreatorService,
+		CdnBaseURL:             config.CdnBaseURL,
+		ClientPhotoFolder:      config.ClientsPhotoFolder,
+		ClientService:          clientService,
+		DownloadTokenSecret:    config.DownloadTokenSecret,
+		ImageEventService:      imageEventService,
+		ImageUrlExpiration:     time.Duration(config.ImageUrlExpirationMinutes) * time.Minute,
+		PresignedUrlExpiration: time.Duration(config.PresignedUrlMinutes) * time.Minute,
+		Renderer:               renderer,
+		S3Client:               s3Client,
+		S3OperationTimeout:     time.Duration(config.S3OperationTimeoutSeconds) * time.Second,
+		SessionRememberTTL:     sessionRememberTTL,
+		SessionService:         sessionService,
+		ThumbnailFormat:        cacheCreatorService.ThumbnailFormat(),
+		TrustedProxies:         trustedProxies,
+		UsePresignedDownloads:  config.UsePresignedDownloads,
+		ZipService:             zipService,
+	})
+
+	adminController = admin.NewAdminController(admin.AdminControllerConfig{
+		AlbumService:         albumService,
+		Bucket:               config.AwsBucket,
+		CacheCreator:         cacheCreatorService,
+		ClientPhotoFolder:    config.ClientsPhotoFolder,
+		ClientService:        clientService,
+		HomePagePhotoService: homePagePhotoService,
+		MaxUploadSize:        int64(config.UploadMaxSizeMB) * 1024 * 1024,
+		S3Client:             s3Client,
+		ZipService:           zipService,
+	})
+
+	contactController = contact.NewContactController(contact.ContactControllerConfig{
+		ContactEmail: config.ContactEmail,
+		EmailSender:  emailSender,
+		Branding:     branding,
+		FromEmail:    config.FromEmail,
+		FromName:     config.SenderName(),
+		Renderer:     renderer,
 	})
 
 	homeController = home.NewHomeController(home.HomeControllerConfig{
-		AwsBucket:           config.AwsBucket,
-		HomePagePhotoFolder: config.HomePagePhotoFolder,
-		Config:              &config,
-		Renderer:            renderer,
-		S3Client:            s3Client,
+		AwsBucket:            config.AwsBucket,
+		Branding:             branding,
+		CdnBaseURL:           config.CdnBaseURL,
+		HomePagePhotoFolder:  config.HomePagePhotoFolder,
+		HomePagePhotoService: homePagePhotoService,
+		Config:               &config,
+		ImageUrlExpiration:   time.Duration(config.ImageUrlExpirationMinutes) * time.Minute,
+		InitialCount:         config.HomePageInitialCount,
+		Renderer:             renderer,
+		S3Client:             s3Client,
+		S3OperationTimeout:   time.Duration(config.S3OperationTimeoutSeconds) * time.Second,
+		SortByCaptureDate:    config.HomePageSortByCaptureDate,
 	})
 
 	/*
@@ -190,25 +350,80 @@ func main() {
 
 	clientAccessMiddleware := newClientAccessMiddleware(
 		sessionService,
+		clientService,
 		[]string{
 			"/static",
 			"/client/login",
 		},
 	)
 
+	clientApiMiddleware := newClientApiMiddleware(sessionService, clientService)
+	requiredAdminMiddleware := newRequiredAdminTokenMiddleware(config.AdminToken)
+	metricsMiddleware := newMetricsMiddleware(config.AdminToken, config.MetricsOpen)
+
 	routes := []mux.Route{
 		{Path: "GET /heartbeat", HandlerFunc: heartbeat},
+		{Path: "GET /readiness", HandlerFunc: newReadinessHandler(db, s3Client, config.AwsBucket)},
+		{Path: "GET /metrics", Handler: promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}), Middlewares: []mux.MiddlewareFunc{metricsMiddleware}},
+		{Path: "GET /admin/clients", HandlerFunc: adminController.ListClients, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "POST /admin/clients", HandlerFunc: adminController.CreateClient, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "DELETE /admin/clients/{clientid}", HandlerFunc: adminController.DeleteClient, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "POST /admin/clients/{clientid}/access-codes", HandlerFunc: adminController.AddAccessCode, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "DELETE /admin/clients/{clientid}/access-codes/{accesscodeid}", HandlerFunc: adminController.RevokeAccessCode, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "POST /admin/clients/{clientid}/invalidate-sessions", HandlerFunc: adminController.InvalidateSessions, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "GET /admin/clients/{clientid}/favorites.csv", HandlerFunc: adminController.ExportClientFavorites, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "GET /admin/clients/{clientid}/logins", HandlerFunc: adminController.ListClientLogins, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "POST /admin/albums", HandlerFunc: adminController.CreateAlbum, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "POST /admin/galleries", HandlerFunc: adminController.CreateGallery, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "DELETE /admin/albums/{albumid}", HandlerFunc: adminController.DeleteAlbum, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "POST /admin/albums/{albumid}/images", HandlerFunc: adminController.UploadAlbumImages, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "POST /admin/albums/{albumid}/edited", HandlerFunc: adminController.UploadEditedImages, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "PUT /admin/albums/{albumid}/image-order", HandlerFunc: adminController.SetAlbumImageOrder, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "POST /admin/albums/{albumid}/thumbnail/regenerate", HandlerFunc: adminController.RegenerateThumbnail, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "GET /admin/albums/{albumid}/stats", HandlerFunc: adminController.GetAlbumImageStats, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "PUT /admin/albums/{albumid}/poster", HandlerFunc: adminController.SetAlbumPoster, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "PUT /admin/albums/{albumid}/download-permission", HandlerFunc: adminController.SetAlbumDownloadPermission, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "PUT /admin/albums/{albumid}/purchased", HandlerFunc: adminController.SetAlbumPurchased, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "PUT /admin/albums/{albumid}/max-favorites", HandlerFunc: adminController.SetAlbumMaxFavorites, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "PUT /admin/albums/{albumid}/gallery", HandlerFunc: adminController.SetAlbumGallery, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "POST /admin/cleanup/zips", HandlerFunc: adminController.CleanupZips, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "GET /admin/preview/{clientid}/{albumid}", HandlerFunc: clientAccessController.PreviewAlbumPage, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
+		{Path: "PUT /admin/home-page/photos/{filename}/flags", HandlerFunc: adminController.SetHomePagePhotoFlags, Middlewares: []mux.MiddlewareFunc{requiredAdminMiddleware}},
 		{Path: "GET /", HandlerFunc: homeController.HomePage},
+		{Path: "GET /home/photos", HandlerFunc: homeController.HomePhotos},
+		{Path: "GET /feed.json", HandlerFunc: homeController.JSONFeed},
+		{Path: "GET /feed.xml", HandlerFunc: homeController.RSSFeed},
+		{Path: "GET /photos/{size}/{filename}", HandlerFunc: homeController.Photo},
+		{Path: "GET /sitemap.xml", HandlerFunc: homeController.Sitemap},
+		{Path: "GET /contact", HandlerFunc: contactController.ContactPage},
+		{Path: "POST /contact", HandlerFunc: contactController.ContactAction},
 		{Path: "GET /client/login", HandlerFunc: clientAccessController.LoginPage},
 		{Path: "POST /client/login", HandlerFunc: clientAccessController.LoginAction},
 		{Path: "GET /client/logout", HandlerFunc: clientAccessController.LogoutAction},
 		{Path: "GET /client", HandlerFunc: clientAccessController.AlbumListPage, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
 		{Path: "GET /client/", HandlerFunc: clientAccessController.AlbumListPage, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
 		{Path: "GET /client/{id}", HandlerFunc: clientAccessController.ViewAlbumPage, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+		{Path: "GET /client/downloads", HandlerFunc: clientAccessController.DownloadsPage, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+		{Path: "GET /client/downloads/status", HandlerFunc: clientAccessController.DownloadStatus, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+		{Path: "GET /client/settings", HandlerFunc: clientAccessController.SettingsPage, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+		{Path: "POST /client/settings", HandlerFunc: clientAccessController.SettingsAction, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+		{Path: "GET /client/thumb", HandlerFunc: clientAccessController.Thumbnail, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+		{Path: "GET /client/view-image", HandlerFunc: clientAccessController.ViewImage, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
 		{Path: "GET /client/download-image", HandlerFunc: clientAccessController.DownloadImage, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
-		{Path: "GET /client/library/{albumid}/download-all", HandlerFunc: clientAccessController.DownloadAllImagesInAlbum, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
-		{Path: "GET /client/downloads/{filename}", HandlerFunc: clientAccessController.DownloadZip, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+		{Path: "POST /client/library/{albumid}/download-all", HandlerFunc: clientAccessController.DownloadAllImagesInAlbum, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+		{Path: "GET /client/library/{albumid}/download-estimate", HandlerFunc: clientAccessController.DownloadEstimate, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+		{Path: "POST /client/library/{albumid}/resend-email", HandlerFunc: clientAccessController.ResendDownloadEmail, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+		{Path: "GET /client/library/{albumid}/downloads/{filename}", HandlerFunc: clientAccessController.DownloadZip, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+		{Path: "GET /client/zips/{token}", HandlerFunc: clientAccessController.DownloadZipByToken, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+		{Path: "GET /client/downloads/{filename}", HandlerFunc: clientAccessController.LegacyDownloadZip, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+		{Path: "POST /client/library/{albumid}/comment", HandlerFunc: clientAccessController.AddComment, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
 		{Path: "PUT /client/library/{albumid}/toggle-favorite", HandlerFunc: clientAccessController.ToggleFavorite, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+		{Path: "GET /client/library/{albumid}/favorites", HandlerFunc: clientAccessController.GetFavorites, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+		{Path: "PUT /client/library/{albumid}/favorites", HandlerFunc: clientAccessController.SetFavorites, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+		{Path: "PUT /client/library/{albumid}/favorites/restore", HandlerFunc: clientAccessController.RestoreFavorite, Middlewares: []mux.MiddlewareFunc{clientAccessMiddleware}},
+
+		{Path: "GET /api/client/albums", HandlerFunc: clientAccessController.ApiAlbumList, Middlewares: []mux.MiddlewareFunc{clientApiMiddleware}},
+		{Path: "GET /api/client/albums/{id}", HandlerFunc: clientAccessController.ApiAlbumDetail, Middlewares: []mux.MiddlewareFunc{clientApiMiddleware}},
 	}
 
 	routerConfig := mux.RouterConfig{
@@ -221,13 +436,26 @@ func main() {
 		HttpWriteTimeout:     60,
 	}
 
+	/*
+	 * The request logger wraps the whole router, rather than being a router
+	 * middleware, so it runs before the per-route client middlewares and
+	 * sees the final response status. Compression wraps the router too, so
+	 * static files are compressed along with rendered pages. Security
+	 * headers go on every response, including static files and errors.
+	 */
+	securityHeadersMiddleware := securityheaders.NewMiddleware(securityheaders.Config{
+		ImageSources: imageSources(config),
+	})
+
 	m := mux.SetupRouter(routerConfig, routes)
-	httpServer, quit := mux.SetupServer(routerConfig, m)
+	httpServer, quit := mux.SetupServer(routerConfig, requestlog.NewMiddleware()(securityHeadersMiddleware(csrf.NewMiddleware(config.AdminToken)(compress.NewMiddleware()(m)))))
 
 	/*
-	 * Start the zip cleanup job
+	 * Start the zip cleanup job. Zips left incomplete by a crash are removed
+	 * first so nobody is emailed a link to a broken file.
 	 */
-	zipService.StartCleanupRoutine(24 * time.Hour)
+	go zipService.CleanupInvalidZips()
+	zipService.StartCleanupRoutine(time.Duration(config.ZipCleanupIntervalHours) * time.Hour)
 	defer zipService.StopCleanupRoutine()
 
 	/*
@@ -235,6 +463,11 @@ func main() {
 	 */
 	setupCacheCreator(quit)
 
+	/*
+	 * Start the zip prewarmer, when turned on
+	 */
+	setupZipPrewarmer(shutdownCtx)
+
 	/*
 	 * Wait for graceful shutdown
 	 */
@@ -244,86 +477,310 @@ func main() {
 
 	cancel()
 	mux.Shutdown(httpServer)
+
+	zipShutdownCtx, zipShutdownCancel := context.WithTimeout(context.Background(), zipShutdownTimeout)
+	defer zipShutdownCancel()
+
+	if err = zipService.Shutdown(zipShutdownCtx); err != nil {
+		slog.Error("error shutting down zip service", "error", err)
+	}
+
+	adminShutdownCtx, adminShutdownCancel := context.WithTimeout(context.Background(), adminShutdownTimeout)
+	defer adminShutdownCancel()
+
+	if err = adminController.Shutdown(adminShutdownCtx); err != nil {
+		slog.Error("error shutting down admin controller", "error", err)
+	}
+
+	cacheShutdownCtx, cacheShutdownCancel := context.WithTimeout(context.Background(), cacheShutdownTimeout)
+	defer cacheShutdownCancel()
+
+	if err = cacheCreatorService.Shutdown(cacheShutdownCtx); err != nil {
+		slog.Error("error shutting down cache creator", "error", err)
+	}
+
+	imageEventService.Stop()
+
 	slog.Info("server stopped")
+	return nil
+}
+
+func connectDatabase() error {
+	var (
+		err error
+	)
+
+	binds.Register("sqlite", binds.BindByDriver("sqlite3"))
+
+	if db, err = sqlz.Connect("sqlite", config.DSN); err != nil {
+		return fmt.Errorf("error connecting to the database: %w", err)
+	}
+
+	return nil
 }
 
 func heartbeat(w http.ResponseWriter, r *http.Request) {
 	httphelpers.TextOK(w, "OK")
 }
 
+func newS3Client() (s3.S3Client, error) {
+	var (
+		err error
+	)
+
+	awsConfig := &awsconfig.Config{
+		Endpoint:        config.AwsEndpointUrl,
+		Region:          config.AwsRegion,
+		AccessKeyID:     config.AwsAccessKeyId,
+		SecretAccessKey: config.AwsSecretAccessKey,
+	}
+
+	retrier.Retry(func() error {
+		if err = awsConfig.Load(); err != nil {
+			slog.Error("failed to load AWS config. trying again", "error", err)
+			return err
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s3.NewClient(awsConfig)
+}
+
+/*
+newCacheCreator builds the cache creator from the configuration. It uses
+the package level album, client, and cache failure services, so those must
+be set up first.
+*/
+func newCacheCreator(s3Client s3.S3Client, shutdownCtx context.Context) (cache.CacheCreatorService, error) {
+	var (
+		err             error
+		heroAspectRatio float64
+		watermark       *cache.Watermark
+		proofWatermark  *cache.Watermark
+	)
+
+	if heroAspectRatio, err = configuration.ParseAspectRatio(config.HeroAspectRatio); err != nil {
+		return cache.CacheCreatorService{}, fmt.Errorf("error reading HERO_ASPECT_RATIO: %w", err)
+	}
+
+	/*
+	 * Albums that haven't been purchased are always watermarked. The
+	 * setting only decides whether purchased albums are too.
+	 */
+	proofWatermark, err = cache.NewWatermark(cache.WatermarkConfig{
+		FS:        appFS,
+		ImagePath: config.WatermarkImagePath,
+		Text:      config.WatermarkText,
+		Tiled:     config.WatermarkTiled,
+	})
+
+	if err != nil {
+		return cache.CacheCreatorService{}, err
+	}
+
+	if config.WatermarkEnabled {
+		watermark = proofWatermark
+	}
+
+	return cache.NewCacheCreatorService(cache.CacheCreatorConfig{
+		AlbumService:        albumService,
+		AwsBucket:           config.AwsBucket,
+		AwsRegion:           config.AwsRegion,
+		CacheFailureService: cacheFailureService,
+		ClientsPhotoFolder:  config.ClientsPhotoFolder,
+		ClientService:       clientService,
+		HeroAspectRatio:     heroAspectRatio,
+		HomePagePhotoFolder: config.HomePagePhotoFolder,
+		ImageExtensions:     strings.Split(config.CacheImageExtensions, ","),
+		JpegQuality:         config.JpegQuality,
+		LockTTL:             time.Duration(config.CacheLockTTLMinutes) * time.Minute,
+		MaxCacheWorkers:     config.MaxCacheWorkers,
+		ProofWatermark:      proofWatermark,
+		S3Client:            s3Client,
+		S3OperationTimeout:  time.Duration(config.S3OperationTimeoutSeconds) * time.Second,
+		ShutdownCtx:         shutdownCtx,
+		ThumbnailFormat:     config.ThumbnailFormat,
+		Watermark:           watermark,
+	}), nil
+}
+
 func migrateDatabase() {
 	var (
-		err  error
-		dirs []fs.DirEntry
-		b    []byte
+		err     error
+		applied []string
 	)
 
-	if dirs, err = sqlMigrationsFs.ReadDir("sql-migrations"); err != nil {
+	if applied, err = applyMigrations(); err != nil {
 		panic(err)
 	}
 
-	for _, d := range dirs {
-		if d.IsDir() {
-			continue
-		}
+	for _, name := range applied {
+		slog.Info("applied migration", "name", name)
+	}
+}
 
-		if strings.HasPrefix(d.Name(), "commit") {
-			if b, err = fs.ReadFile(sqlMigrationsFs, filepath.Join("sql-migrations", d.Name())); err != nil {
-				panic(err)
-			}
+func applyMigrations() ([]string, error) {
+	var (
+		err     error
+		scripts fs.FS
+	)
 
-			if err = runSqlScript(b); err != nil {
-				if !isIgnorableError(err) {
-					panic(err)
-				}
-			}
-		}
+	if scripts, err = fs.Sub(sqlMigrationsFs, "sql-migrations"); err != nil {
+		return nil, err
 	}
+
+	migrator := migrations.NewMigrator(migrations.MigratorConfig{
+		DB: db,
+		FS: scripts,
+	})
+
+	return migrator.Migrate()
 }
 
-func runSqlScript(script []byte) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
-	defer cancel()
+/*
+cacheRunInterval is how often the cache creator runs. Anything but a
+positive number of minutes falls back to defaultCacheRunInterval.
+*/
+func cacheRunInterval(minutes int) time.Duration {
+	if minutes <= 0 {
+		slog.Warn("invalid cache run interval. using the default", "minutes", minutes, "default", defaultCacheRunInterval)
+		return defaultCacheRunInterval
+	}
 
-	_, err := db.Exec(ctx, string(script))
-	return err
+	return time.Duration(minutes) * time.Minute
 }
 
-func isIgnorableError(err error) bool {
-	if strings.Contains(err.Error(), "duplicate column") {
-		return true
+/*
+imageSources are the origins the Content-Security-Policy lets images load
+from. Presigned URLs point at the S3 endpoint, either path style or with
+the bucket as a subdomain, so both are allowed. Without an endpoint the
+app talks to AWS itself. The CDN and any configured extras are added too.
+*/
+func imageSources(c configuration.Config) []string {
+	result := []string{}
+
+	if u, err := url.Parse(c.AwsEndpointUrl); err == nil && u.Scheme != "" && u.Host != "" {
+		result = append(result, u.Scheme+"://"+u.Host, u.Scheme+"://*."+u.Host)
+	} else {
+		result = append(result, "https://*.amazonaws.com")
+	}
+
+	if u, err := url.Parse(c.CdnBaseURL); err == nil && u.Scheme != "" && u.Host != "" {
+		result = append(result, u.Scheme+"://"+u.Host)
+	}
+
+	for _, source := range strings.Split(c.CspImageSources, ",") {
+		if source = strings.TrimSpace(source); source != "" {
+			result = append(result, source)
+		}
 	}
 
-	return false
+	return result
 }
 
 func setupCacheCreator(quit chan os.Signal) {
+	ticker := time.NewTicker(cacheRunInterval(config.CacheRunIntervalMinutes))
+	go runCacheCreator(cacheCreatorService, config.CacheRunOnStartup, ticker.C, quit)
+}
+
+/*
+runCacheCreator builds the cache on every tick, and once up front when
+runOnStartup is set, until quit receives. Runs don't overlap.
+*/
+func runCacheCreator(creator cache.CacheCreator, runOnStartup bool, ticks <-chan time.Time, quit <-chan os.Signal) {
+	running := false
+
+	runner := func() {
+		running = true
+
+		defer func() {
+			running = false
+		}()
+
+		/*
+		 * Only one instance builds the cache at a time. If the lock
+		 * can't be checked at all, the run goes ahead anyway. A new
+		 * deployment's bucket may not exist until CreateCache makes it.
+		 */
+		acquired, err := creator.TryAcquireLock()
+
+		if err != nil {
+			slog.Error("error acquiring cache creator lock. running without it", "error", err)
+		} else if !acquired {
+			slog.Info("another instance is running the cache creator. skipping...")
+			return
+		}
+
+		defer func() {
+			if acquired {
+				if err := creator.ReleaseLock(); err != nil {
+					slog.Error("error releasing cache creator lock", "error", err)
+				}
+			}
+		}()
+
+		creator.CreateCache()
+		slog.Info("cache creator finished.")
+	}
+
+	if runOnStartup {
+		runner()
+	}
+
+	for {
+		select {
+		case <-quit:
+			return
+
+		case <-ticks:
+			if running {
+				slog.Info("cache creator already running. skipping...")
+				continue
+			}
+
+			runner()
+		}
+	}
+}
+
+/*
+setupZipPrewarmer builds zips ahead of time for albums delivered within the
+last ZIP_PREWARM_DAYS, once at startup and then every
+ZIP_PREWARM_INTERVAL_MINUTES, until ctx is done. Runs don't overlap.
+*/
+func setupZipPrewarmer(ctx context.Context) {
+	if config.ZipPrewarmDays <= 0 {
+		return
+	}
+
 	go func() {
-		ticker := time.NewTicker(1 * time.Hour)
-		running := true
+		ticker := time.NewTicker(time.Duration(config.ZipPrewarmIntervalMinutes) * time.Minute)
+		defer ticker.Stop()
 
 		runner := func() {
-			defer func() {
-				running = false
-			}()
+			built, err := zipService.PrewarmRecentAlbums(config.ZipPrewarmDays)
 
-			cacheCreatorService.CreateCache()
-			slog.Info("cache creator finished.")
+			if err != nil {
+				slog.Error("error prewarming album zips", "error", err, "built", built)
+				return
+			}
+
+			slog.Info("zip prewarmer finished.", "built", built)
 		}
 
 		runner()
 
 		for {
 			select {
-			case <-quit:
+			case <-ctx.Done():
 				return
 
 			case <-ticker.C:
-				if running {
-					slog.Info("cache creator already running. skipping...")
-					continue
-				}
-
 				runner()
 			}
 		}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/cache"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/configuration"
+)
+
+func TestCacheRunInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		minutes int
+		want    time.Duration
+	}{
+		{name: "configured", minutes: 15, want: 15 * time.Minute},
+		{name: "a day", minutes: 1440, want: 24 * time.Hour},
+		{name: "zero", minutes: 0, want: time.Hour},
+		{name: "negative", minutes: -5, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cacheRunInterval(tt.minutes); got != tt.want {
+				t.Errorf("cacheRunInterval(%d) = %v, want %v", tt.minutes, got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+fakeCacheCreator counts the caches it builds and always gets the lock.
+Anything not implemented panics through the nil embedded interface.
+*/
+type fakeCacheCreator struct {
+	cache.CacheCreator
+
+	built *atomic.Int32
+}
+
+func (f fakeCacheCreator) TryAcquireLock() (bool, error) { return true, nil }
+func (f fakeCacheCreator) ReleaseLock() error            { return nil }
+func (f fakeCacheCreator) CreateCache()                  { f.built.Add(1) }
+
+func TestRunCacheCreator(t *testing.T) {
+	tests := []struct {
+		name         string
+		runOnStartup bool
+		want         int32
+	}{
+		{name: "run on startup", runOnStartup: true, want: 2},
+		{name: "wait for the first tick", runOnStartup: false, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creator := fakeCacheCreator{built: &atomic.Int32{}}
+			ticks := make(chan time.Time)
+			quit := make(chan os.Signal)
+			done := make(chan struct{})
+
+			go func() {
+				runCacheCreator(creator, tt.runOnStartup, ticks, quit)
+				close(done)
+			}()
+
+			// Neither send is taken until the run before it has finished
+			ticks <- time.Now()
+			quit <- os.Interrupt
+			<-done
+
+			if got := creator.built.Load(); got != tt.want {
+				t.Errorf("cache built %d times, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageSources(t *testing.T) {
+	tests := []struct {
+		name   string
+		config configuration.Config
+		want   []string
+	}{
+		{
+			name:   "local endpoint",
+			config: configuration.Config{AwsEndpointUrl: "http://localhost:4566"},
+			want:   []string{"http://localhost:4566", "http://*.localhost:4566"},
+		},
+		{
+			name:   "aws",
+			config: configuration.Config{},
+			want:   []string{"https://*.amazonaws.com"},
+		},
+		{
+			name: "cdn and extras",
+			config: configuration.Config{
+				AwsEndpointUrl:  "https://s3.us-east-1.amazonaws.com/",
+				CdnBaseURL:      "https://cdn.example.com/photos",
+				CspImageSources: "https://a.example.com, ,https://b.example.com",
+			},
+			want: []string{
+				"https://s3.us-east-1.amazonaws.com",
+				"https://*.s3.us-east-1.amazonaws.com",
+				"https://cdn.example.com",
+				"https://a.example.com",
+				"https://b.example.com",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := imageSources(tt.config); !slices.Equal(got, tt.want) {
+				t.Errorf("imageSources() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
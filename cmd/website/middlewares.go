@@ -1,15 +1,20 @@
 package main
 
 import (
-	"context"
+	"crypto/subtle"
+	"log/slog"
 	"net/http"
 	"strings"
 
+	"github.com/adampresley/adamgokit/httphelpers"
 	"github.com/adampresley/adamgokit/sessions"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/requestlog"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/viewmodels"
 	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
 )
 
-func newClientAccessMiddleware(sessionService sessions.Session[*models.Client], excludedPaths []string) func(http.Handler) http.Handler {
+func newClientAccessMiddleware(sessionService sessions.Session[*models.Client], clientService services.ClientServicer, excludedPaths []string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			var (
@@ -23,7 +28,7 @@ func newClientAccessMiddleware(sessionService sessions.Session[*models.Client],
 			 * If this path is excluded, keep going.
 			 */
 			for _, excludedPath := range excludedPaths {
-				if strings.HasPrefix(path, excludedPath) {
+				if pathHasPrefix(path, excludedPath) {
 					next.ServeHTTP(w, r)
 					return
 				}
@@ -34,8 +39,143 @@ func newClientAccessMiddleware(sessionService sessions.Session[*models.Client],
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), "client", sessionClient)
+			if !isSessionCurrent(w, r, sessionService, clientService, sessionClient) {
+				http.Redirect(w, r, "/client/login", http.StatusTemporaryRedirect)
+				return
+			}
+
+			requestlog.SetClientID(r, sessionClient.ID)
+
+			ctx := viewmodels.ContextWithClient(r.Context(), sessionClient)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+/*
+isSessionCurrent compares the session generation stored in the session with
+the client's current one. When they differ, the client's sessions have been
+invalidated, so this session is destroyed. Errors looking up the generation
+are treated as invalid, too.
+*/
+func isSessionCurrent(w http.ResponseWriter, r *http.Request, sessionService sessions.Session[*models.Client], clientService services.ClientServicer, sessionClient *models.Client) bool {
+	generation, err := clientService.GetSessionGeneration(sessionClient.ID)
+
+	if err != nil {
+		requestlog.Logger(r).Error("error getting client session generation", "error", err, "clientID", sessionClient.ID)
+	}
+
+	if err == nil && generation == sessionClient.SessionGeneration {
+		return true
+	}
+
+	if err == nil {
+		requestlog.Logger(r).Info("rejecting invalidated client session", "clientID", sessionClient.ID, "sessionGeneration", sessionClient.SessionGeneration, "currentGeneration", generation)
+	}
+
+	_ = sessionService.Destroy(w, r)
+	return false
+}
+
+/*
+pathHasPrefix reports whether path is prefix or sits beneath it. Unlike
+strings.HasPrefix it only matches on segment boundaries, so "/client/login"
+matches "/client/login" and "/client/login/", but not "/client/loginx".
+*/
+func pathHasPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	if path == prefix {
+		return true
+	}
+
+	return strings.HasPrefix(path, prefix+"/")
+}
+
+/*
+newClientApiMiddleware is the JSON API counterpart to newClientAccessMiddleware.
+Instead of redirecting to the login page it responds with a 401.
+*/
+func newClientApiMiddleware(sessionService sessions.Session[*models.Client], clientService services.ClientServicer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				err           error
+				sessionClient *models.Client
+			)
+
+			if sessionClient, err = sessionService.Get(r); err != nil {
+				httphelpers.JsonErrorMessage(w, http.StatusUnauthorized, "Not logged in")
+				return
+			}
+
+			if !isSessionCurrent(w, r, sessionService, clientService, sessionClient) {
+				httphelpers.JsonErrorMessage(w, http.StatusUnauthorized, "Not logged in")
+				return
+			}
+
+			requestlog.SetClientID(r, sessionClient.ID)
+
+			ctx := viewmodels.ContextWithClient(r.Context(), sessionClient)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+/*
+newAdminTokenMiddleware protects admin endpoints with a bearer token. When
+no token is configured the endpoints are left open.
+*/
+func newAdminTokenMiddleware(adminToken string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if adminToken == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+				httphelpers.TextUnauthorized(w, "Unauthorized")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+/*
+newRequiredAdminTokenMiddleware is like newAdminTokenMiddleware, but for
+endpoints that change data. These are never left open, so when no token
+is configured they are disabled.
+*/
+func newRequiredAdminTokenMiddleware(adminToken string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if adminToken == "" {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				httphelpers.JsonErrorMessage(w, http.StatusForbidden, "Admin endpoints are disabled. Set ADMIN_TOKEN to enable them")
+			})
+		}
+
+		return newAdminTokenMiddleware(adminToken)(next)
+	}
+}
+
+/*
+newMetricsMiddleware protects /metrics with the admin token. Without a
+token metrics are disabled like the other admin endpoints, unless open is
+set to serve them to anyone, such as on a private network.
+*/
+func newMetricsMiddleware(adminToken string, open bool) func(http.Handler) http.Handler {
+	if !open {
+		return newRequiredAdminTokenMiddleware(adminToken)
+	}
+
+	if adminToken == "" {
+		slog.Warn("/metrics is open to anyone. set ADMIN_TOKEN or METRICS_OPEN=false to protect it")
+	}
+
+	return newAdminTokenMiddleware(adminToken)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/gob"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adampresley/adamgokit/sessions"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/viewmodels"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/adampresley/adampresleyphotography/pkg/services"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		adminToken    string
+		open          bool
+		authorization string
+		wantStatus    int
+	}{
+		{name: "no token is denied by default", wantStatus: http.StatusForbidden},
+		{name: "no token and open is allowed", open: true, wantStatus: http.StatusOK},
+		{name: "token without header is denied", adminToken: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "token with wrong header is denied", adminToken: "secret", authorization: "Bearer nope", wantStatus: http.StatusUnauthorized},
+		{name: "token with header is allowed", adminToken: "secret", authorization: "Bearer secret", wantStatus: http.StatusOK},
+		{name: "open still checks a configured token", adminToken: "secret", open: true, wantStatus: http.StatusUnauthorized},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			newMetricsMiddleware(tt.adminToken, tt.open)(next).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAlbumPreviewRequiresTheAdminToken(t *testing.T) {
+	gob.Register(&models.Client{})
+
+	sessionService := sessions.NewSessionWrapper[*models.Client](sessions.NewCookieStore("test-secret-test-secret-test-sec"), "test", "client")
+	client := sessionCookie(t, sessionService, &models.Client{BaseModel: models.BaseModel{ID: 1}})
+
+	tests := []struct {
+		name          string
+		adminToken    string
+		cookie        *http.Cookie
+		authorization string
+		wantStatus    int
+	}{
+		{name: "admin", adminToken: "secret", authorization: "Bearer secret", wantStatus: http.StatusOK},
+		{name: "the album's client", adminToken: "secret", cookie: client, wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", adminToken: "secret", authorization: "Bearer nope", wantStatus: http.StatusUnauthorized},
+		{name: "admin endpoints disabled", cookie: client, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previewed := false
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				previewed = true
+				w.WriteHeader(http.StatusOK)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/admin/preview/1/2", nil)
+
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			newRequiredAdminTokenMiddleware(tt.adminToken)(next).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if previewed != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("previewed = %v, want it only for the admin", previewed)
+			}
+		})
+	}
+}
+
+/*
+fakeSessionGenerations reports a fixed session generation for every client.
+Anything not implemented panics through the nil embedded interface.
+*/
+type fakeSessionGenerations struct {
+	services.ClientServicer
+
+	generation int
+}
+
+func (f fakeSessionGenerations) GetSessionGeneration(clientID uint) (int, error) {
+	return f.generation, nil
+}
+
+// sessionCookie logs client in and returns the session cookie the browser would get
+func sessionCookie(t *testing.T, sessionService sessions.Session[*models.Client], client *models.Client) *http.Cookie {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, "/client/login", nil)
+	w := httptest.NewRecorder()
+
+	if err := sessionService.Set(r, client); err != nil {
+		t.Fatalf("error setting session: %v", err)
+	}
+
+	if err := sessionService.Save(w, r); err != nil {
+		t.Fatalf("error saving session: %v", err)
+	}
+
+	cookies := w.Result().Cookies()
+
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+
+	return cookies[0]
+}
+
+func TestClientApiMiddleware(t *testing.T) {
+	gob.Register(&models.Client{})
+
+	sessionService := sessions.NewSessionWrapper[*models.Client](sessions.NewCookieStore("test-secret-test-secret-test-sec"), "test", "client")
+	current := sessionCookie(t, sessionService, &models.Client{BaseModel: models.BaseModel{ID: 1}, SessionGeneration: 2})
+	invalidated := sessionCookie(t, sessionService, &models.Client{BaseModel: models.BaseModel{ID: 1}, SessionGeneration: 1})
+
+	tests := []struct {
+		name         string
+		cookie       *http.Cookie
+		wantStatus   int
+		wantClientID uint
+	}{
+		{name: "no session", wantStatus: http.StatusUnauthorized},
+		{name: "garbage cookie", cookie: &http.Cookie{Name: "test", Value: "nope"}, wantStatus: http.StatusUnauthorized},
+		{name: "invalidated session", cookie: invalidated, wantStatus: http.StatusUnauthorized},
+		{name: "valid session", cookie: current, wantStatus: http.StatusOK, wantClientID: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotClientID uint
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotClientID = viewmodels.GetClientFromContext(r).ID
+				w.WriteHeader(http.StatusOK)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/api/client/albums", nil)
+
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+
+			w := httptest.NewRecorder()
+			newClientApiMiddleware(sessionService, fakeSessionGenerations{generation: 2})(next).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if tt.wantStatus == http.StatusUnauthorized && w.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", w.Header().Get("Content-Type"))
+			}
+
+			if gotClientID != tt.wantClientID {
+				t.Errorf("client ID in context = %d, want %d", gotClientID, tt.wantClientID)
+			}
+		})
+	}
+}
+
+func TestPathHasPrefix(t *testing.T) {
+	tests := []struct {
+		path   string
+		prefix string
+		want   bool
+	}{
+		{path: "/client/login", prefix: "/client/login", want: true},
+		{path: "/client/login/", prefix: "/client/login", want: true},
+		{path: "/client/login/help", prefix: "/client/login", want: true},
+		{path: "/client/loginx", prefix: "/client/login", want: false},
+		{path: "/static/css/site.css", prefix: "/static/", want: true},
+		{path: "/staticsecret", prefix: "/static", want: false},
+		{path: "/client", prefix: "/client/login", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := pathHasPrefix(tt.path, tt.prefix); got != tt.want {
+			t.Errorf("pathHasPrefix(%q, %q) = %v, want %v", tt.path, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestClientAccessMiddlewareExcludesWholeSegments(t *testing.T) {
+	sessionService := sessions.NewSessionWrapper[*models.Client](sessions.NewCookieStore("test-secret-test-secret-test-sec"), "test", "client")
+
+	handler := newClientAccessMiddleware(sessionService, fakeSessionGenerations{}, []string{"/client/login"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{path: "/client/login", wantStatus: http.StatusNoContent},
+		{path: "/client/login/", wantStatus: http.StatusNoContent},
+		{path: "/client/loginx", wantStatus: http.StatusTemporaryRedirect},
+		{path: "/client", wantStatus: http.StatusTemporaryRedirect},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/listoptions"
+	"github.com/adampresley/adampresleyphotography/cmd/website/internal/requestlog"
+	"github.com/rfberaldo/sqlz"
+)
+
+const (
+	readinessCheckTimeout = time.Second * 3
+
+	// readinessCheckPrefix is listed to prove the bucket is reachable. It
+	// doesn't need to exist. A missing bucket is still an error.
+	readinessCheckPrefix = "readiness-check/"
+)
+
+type readinessResponse struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+/*
+newReadinessHandler returns a handler that reports whether the database and
+S3 bucket are reachable. It responds with 503 when any check fails. Unlike
+/heartbeat this is meant for readiness probes, not liveness.
+*/
+func newReadinessHandler(db *sqlz.DB, s3Client s3.S3Client, bucket string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks := map[string]func(ctx context.Context) error{
+			"database": func(ctx context.Context) error {
+				var one int
+				return db.QueryRow(ctx, &one, "SELECT 1")
+			},
+			"s3": func(ctx context.Context) error {
+				_, err := s3Client.List(bucket, readinessCheckPrefix, listoptions.WithContext(ctx))
+				return err
+			},
+		}
+
+		result := readinessResponse{
+			Ready:  true,
+			Checks: map[string]string{},
+		}
+
+		errs := runReadinessChecks(r.Context(), checks)
+
+		for name := range checks {
+			if err := errs[name]; err != nil {
+				requestlog.Logger(r).Error("readiness check failed", "check", name, "error", err)
+
+				result.Ready = false
+				result.Checks[name] = err.Error()
+				continue
+			}
+
+			result.Checks[name] = "ok"
+		}
+
+		status := http.StatusOK
+
+		if !result.Ready {
+			status = http.StatusServiceUnavailable
+		}
+
+		httphelpers.WriteJson(w, status, result)
+	}
+}
+
+/*
+runReadinessChecks runs every check at once, sharing a context that ends
+after readinessCheckTimeout or when the request goes away. Each check must
+honor the context, so none of them outlive the request. Returns the error
+from each check, keyed by name. Checks that passed have a nil error.
+*/
+func runReadinessChecks(parent context.Context, checks map[string]func(ctx context.Context) error) map[string]error {
+	ctx, cancel := context.WithTimeout(parent, readinessCheckTimeout)
+	defer cancel()
+
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	result := make(map[string]error, len(checks))
+
+	for name, check := range checks {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			err := check(ctx)
+
+			mu.Lock()
+			result[name] = err
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+	return result
+}
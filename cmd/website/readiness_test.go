@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunReadinessChecksReportsEachCheck(t *testing.T) {
+	errDown := errors.New("down")
+
+	result := runReadinessChecks(context.Background(), map[string]func(ctx context.Context) error{
+		"up":   func(ctx context.Context) error { return nil },
+		"down": func(ctx context.Context) error { return errDown },
+	})
+
+	if err := result["up"]; err != nil {
+		t.Errorf("up check returned %v, want nil", err)
+	}
+
+	if err := result["down"]; !errors.Is(err, errDown) {
+		t.Errorf("down check returned %v, want %v", err, errDown)
+	}
+}
+
+func TestRunReadinessChecksWaitsForCanceledChecks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := atomic.Bool{}
+
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		cancel()
+	}()
+
+	result := runReadinessChecks(ctx, map[string]func(ctx context.Context) error{
+		"slow": func(ctx context.Context) error {
+			<-ctx.Done()
+			finished.Store(true)
+			return ctx.Err()
+		},
+	})
+
+	if !finished.Load() {
+		t.Fatalf("runReadinessChecks returned before the check finished")
+	}
+
+	if err := result["slow"]; !errors.Is(err, context.Canceled) {
+		t.Errorf("slow check returned %v, want %v", err, context.Canceled)
+	}
+}
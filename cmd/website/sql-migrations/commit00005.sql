@@ -0,0 +1,3 @@
+-- Add created_at to favorites table
+ALTER TABLE favorites ADD COLUMN created_at datetime;
+UPDATE favorites SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
@@ -0,0 +1,2 @@
+-- Add deleted_at to favorites table so favorites can be restored
+ALTER TABLE favorites ADD COLUMN deleted_at datetime;
@@ -0,0 +1,11 @@
+--
+-- cache_failures records originals that could not be turned into thumbnails
+-- so they aren't retried until the original changes
+--
+CREATE TABLE IF NOT EXISTS "cache_failures" (
+  "key" text PRIMARY KEY,
+  error text,
+  last_modified datetime,
+  created_at datetime,
+  updated_at datetime
+);
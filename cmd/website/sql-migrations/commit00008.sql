@@ -0,0 +1,2 @@
+-- Add expires_at to albums so gallery access can be time limited. NULL means never
+ALTER TABLE albums ADD COLUMN expires_at datetime;
@@ -0,0 +1,13 @@
+--
+-- image_events records client views and downloads of individual images
+--
+CREATE TABLE IF NOT EXISTS "image_events" (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  client_id integer,
+  album_id integer,
+  image_path text,
+  event_type text,
+  created_at datetime
+);
+
+CREATE INDEX IF NOT EXISTS idx_image_events_client_album ON image_events (client_id, album_id);
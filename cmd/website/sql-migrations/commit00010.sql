@@ -0,0 +1,13 @@
+--
+-- comments holds client notes on individual album images
+--
+CREATE TABLE IF NOT EXISTS "comments" (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  client_id integer,
+  album_id integer,
+  image_path text,
+  body text,
+  created_at datetime
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_client_album ON comments (client_id, album_id);
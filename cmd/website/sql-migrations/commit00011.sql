@@ -0,0 +1,16 @@
+--
+-- access_codes lets a client have more than one password, each with a label
+-- so individual people can be told apart and revoked
+--
+CREATE TABLE IF NOT EXISTS "access_codes" (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  client_id integer,
+  code text,
+  label text,
+  created_at datetime,
+  revoked_at datetime
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_codes_client_id ON access_codes (client_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_access_codes_active_code ON access_codes (code) WHERE revoked_at IS NULL;
+
@@ -0,0 +1,2 @@
+-- session_generation is embedded in client sessions. Bumping it logs out every existing session
+ALTER TABLE clients ADD COLUMN session_generation integer NOT NULL DEFAULT 0;
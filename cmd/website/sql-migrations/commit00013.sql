@@ -0,0 +1,2 @@
+-- New access codes are stored as a SHA-256 hash instead of plain text
+ALTER TABLE access_codes ADD COLUMN code_hash text;
@@ -0,0 +1 @@
+CREATE UNIQUE INDEX IF NOT EXISTS idx_access_codes_active_code_hash ON access_codes (code_hash) WHERE revoked_at IS NULL;
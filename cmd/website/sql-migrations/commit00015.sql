@@ -0,0 +1,10 @@
+--
+-- image_order holds a curated display order for an album's images. Images
+-- without a row sort after the ordered ones, by name
+--
+CREATE TABLE IF NOT EXISTS "image_order" (
+  album_id integer,
+  image_path text,
+  position integer,
+  UNIQUE (album_id, image_path)
+);
@@ -0,0 +1,11 @@
+--
+-- home_page_photo_flags lets the home gallery be curated. Hidden photos are
+-- left off the page and featured photos are shown first. Photos without a
+-- row are shown as usual
+--
+CREATE TABLE IF NOT EXISTS "home_page_photo_flags" (
+  file_name text PRIMARY KEY,
+  hidden integer NOT NULL DEFAULT 0,
+  featured integer NOT NULL DEFAULT 0,
+  updated_at datetime
+);
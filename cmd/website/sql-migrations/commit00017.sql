@@ -0,0 +1,3 @@
+-- locale is the language a client has asked to see the site in, such as
+-- 'es'. Blank means use their browser's Accept-Language header
+ALTER TABLE clients ADD COLUMN locale text NOT NULL DEFAULT '';
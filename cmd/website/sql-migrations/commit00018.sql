@@ -0,0 +1,4 @@
+-- notify_on_download controls whether a client is emailed when their album
+-- download is ready. Clients who turn it off pick downloads up from the
+-- My Downloads page instead
+ALTER TABLE clients ADD COLUMN notify_on_download integer NOT NULL DEFAULT 1;
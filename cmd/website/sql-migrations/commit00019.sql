@@ -0,0 +1,12 @@
+--
+-- home_page_listings keeps the last successful S3 listing of each home page
+-- folder, so the gallery can still be shown while S3 is unreachable.
+-- objects is a JSON array of the listed keys. complete is 0 when listing
+-- stopped before the end of the folder
+--
+CREATE TABLE IF NOT EXISTS "home_page_listings" (
+  folder text PRIMARY KEY,
+  objects text NOT NULL DEFAULT '[]',
+  complete integer NOT NULL DEFAULT 0,
+  updated_at datetime
+);
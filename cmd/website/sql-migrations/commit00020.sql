@@ -0,0 +1,3 @@
+-- Add x-position to album table. Together with poster_y_pos it is the
+-- focal point the hero banner is cropped around
+ALTER TABLE albums ADD COLUMN poster_x_pos TEXT;
@@ -0,0 +1,3 @@
+-- allow_download controls whether clients can download an album's photos.
+-- Proofing galleries turn it off so they are view only
+ALTER TABLE albums ADD COLUMN allow_download integer NOT NULL DEFAULT 1;
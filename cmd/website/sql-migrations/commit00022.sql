@@ -0,0 +1,3 @@
+-- purchased marks a proofing album as paid for. Until it is, clients see
+-- watermarked previews and can't download. Existing albums count as purchased
+ALTER TABLE albums ADD COLUMN purchased integer NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+-- max_favorites limits how many favorites a client may choose in an album,
+-- for proofing packages like "choose your best 20". NULL is unlimited
+ALTER TABLE albums ADD COLUMN max_favorites integer;
@@ -0,0 +1,16 @@
+--
+-- login_audit records every client login attempt for security review.
+-- client_id and access_code_id are NULL when the code didn't match anyone.
+-- The code that was tried is never stored, only the outcome
+--
+CREATE TABLE IF NOT EXISTS "login_audit" (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  client_id integer,
+  access_code_id integer,
+  ip_address text NOT NULL DEFAULT '',
+  user_agent text NOT NULL DEFAULT '',
+  outcome text NOT NULL,
+  created_at datetime NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_audit_client_created ON login_audit (client_id, created_at);
@@ -0,0 +1,17 @@
+--
+-- galleries group a client's albums that belong together, like the
+-- ceremony and reception of one wedding. Albums with no gallery_id are
+-- shown on their own
+--
+CREATE TABLE IF NOT EXISTS "galleries" (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  created_at datetime,
+  updated_at datetime,
+  deleted_at datetime,
+  client_id integer NOT NULL,
+  name text NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_galleries_client ON galleries (client_id);
+
+ALTER TABLE albums ADD COLUMN gallery_id integer;
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"io"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	LoginResultFailure = "failure"
+	LoginResultSuccess = "success"
+)
+
+var (
+	CacheThumbnailsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "photography",
+		Subsystem: "cache",
+		Name:      "thumbnails_created_total",
+		Help:      "Number of album thumbnails created by the cache creator.",
+	})
+
+	ImageDownloadDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "photography",
+		Subsystem: "downloads",
+		Name:      "image_duration_seconds",
+		Help:      "Time taken to serve a single image download.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	})
+
+	LoginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "photography",
+		Subsystem: "auth",
+		Name:      "login_attempts_total",
+		Help:      "Number of client login attempts by result.",
+	}, []string{"result"})
+
+	ZipBytesWritten = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "photography",
+		Subsystem: "zip",
+		Name:      "bytes_written_total",
+		Help:      "Number of bytes written to album zip files.",
+	})
+
+	ZipJobsCompleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "photography",
+		Subsystem: "zip",
+		Name:      "jobs_completed_total",
+		Help:      "Number of album zip jobs that completed.",
+	})
+
+	ZipJobsFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "photography",
+		Subsystem: "zip",
+		Name:      "jobs_failed_total",
+		Help:      "Number of album zip jobs that failed.",
+	})
+
+	ZipJobsStarted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "photography",
+		Subsystem: "zip",
+		Name:      "jobs_started_total",
+		Help:      "Number of album zip jobs started.",
+	})
+)
+
+/*
+Register adds all of the application metrics to a registry. Call this once
+at startup.
+*/
+func Register(registry prometheus.Registerer) error {
+	collectors := []prometheus.Collector{
+		CacheThumbnailsCreated,
+		ImageDownloadDuration,
+		LoginAttempts,
+		ZipBytesWritten,
+		ZipJobsCompleted,
+		ZipJobsFailed,
+		ZipJobsStarted,
+	}
+
+	for _, collector := range collectors {
+		if err := registry.Register(collector); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+CountingWriter counts the bytes written through it into a counter.
+*/
+type CountingWriter struct {
+	Counter prometheus.Counter
+	Writer  io.Writer
+}
+
+func (w CountingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.Counter.Add(float64(n))
+	return n, err
+}
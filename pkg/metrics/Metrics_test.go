@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCountingWriter(t *testing.T) {
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_bytes_total"})
+	buf := &bytes.Buffer{}
+	w := CountingWriter{Counter: counter, Writer: buf}
+
+	_, _ = w.Write([]byte("hello "))
+	_, _ = w.Write([]byte("world"))
+
+	metric := &dto.Metric{}
+
+	if err := counter.Write(metric); err != nil {
+		t.Fatalf("error reading counter: %v", err)
+	}
+
+	if got := metric.GetCounter().GetValue(); got != 11 {
+		t.Errorf("counted %v bytes, want 11", got)
+	}
+
+	if buf.String() != "hello world" {
+		t.Errorf("wrote %q, want %q", buf.String(), "hello world")
+	}
+}
+
+func TestRegisterTwiceFails(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	if err := Register(registry); err != nil {
+		t.Fatalf("Register returned an error: %v", err)
+	}
+
+	if err := Register(registry); err == nil {
+		t.Errorf("registering the same metrics twice returned no error")
+	}
+}
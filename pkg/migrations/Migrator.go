@@ -0,0 +1,287 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rfberaldo/sqlz"
+)
+
+var (
+	// ErrChecksumMismatch means a migration was edited after it was applied
+	ErrChecksumMismatch = errors.New("migration changed after it was applied")
+)
+
+type MigratorConfig struct {
+	DB *sqlz.DB
+
+	// FS holds the commit*.sql migration scripts at its root
+	FS fs.FS
+}
+
+/*
+Migrator applies SQL migration scripts in file name order, recording each
+in the schema_migrations table so it only ever runs once.
+*/
+type Migrator struct {
+	db   *sqlz.DB
+	fsys fs.FS
+}
+
+// execer is satisfied by both *sqlz.DB and *sqlz.Tx
+type execer interface {
+	Exec(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+type migration struct {
+	Name     string
+	Checksum string
+	Script   string
+}
+
+type appliedMigration struct {
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+func NewMigrator(config MigratorConfig) Migrator {
+	return Migrator{
+		db:   config.DB,
+		fsys: config.FS,
+	}
+}
+
+/*
+Migrate runs every migration that hasn't been applied yet and returns the
+names of the ones it ran. It stops at the first failure.
+
+Databases created before migrations were tracked have already run some of
+the scripts, and re-running an ALTER TABLE ... ADD COLUMN fails with a
+duplicate column error. Only while the tracking table is being created for
+the first time are those errors taken to mean the migration was already
+applied. After that, every error is returned.
+*/
+func (m Migrator) Migrate() ([]string, error) {
+	var (
+		err        error
+		migrations []migration
+		applied    map[string]appliedMigration
+		tracked    bool
+	)
+
+	ran := []string{}
+
+	if migrations, err = m.load(); err != nil {
+		return ran, err
+	}
+
+	if tracked, err = m.isTracked(); err != nil {
+		return ran, err
+	}
+
+	if err = m.createTrackingTable(); err != nil {
+		return ran, err
+	}
+
+	if applied, err = m.applied(); err != nil {
+		return ran, err
+	}
+
+	for _, mig := range migrations {
+		if previous, ok := applied[mig.Name]; ok {
+			if previous.Checksum != mig.Checksum {
+				return ran, fmt.Errorf("%w: %s", ErrChecksumMismatch, mig.Name)
+			}
+
+			continue
+		}
+
+		if err = m.apply(mig, tracked); err != nil {
+			return ran, err
+		}
+
+		ran = append(ran, mig.Name)
+	}
+
+	return ran, nil
+}
+
+func (m Migrator) load() ([]migration, error) {
+	var (
+		err     error
+		entries []fs.DirEntry
+		b       []byte
+	)
+
+	result := []migration{}
+
+	if entries, err = fs.ReadDir(m.fsys, "."); err != nil {
+		return result, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "commit") || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		if b, err = fs.ReadFile(m.fsys, entry.Name()); err != nil {
+			return result, fmt.Errorf("error reading migration %s: %w", entry.Name(), err)
+		}
+
+		sum := sha256.Sum256(b)
+
+		result = append(result, migration{
+			Name:     entry.Name(),
+			Checksum: hex.EncodeToString(sum[:]),
+			Script:   string(b),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+func (m Migrator) isTracked() (bool, error) {
+	var (
+		err   error
+		count int
+	)
+
+	sql := `SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='schema_migrations'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = m.db.QueryRow(ctx, &count, sql); err != nil {
+		return false, fmt.Errorf("error checking for the schema_migrations table: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+func (m Migrator) createTrackingTable() error {
+	var (
+		err error
+	)
+
+	sql := `
+CREATE TABLE IF NOT EXISTS "schema_migrations" (
+  name text PRIMARY KEY,
+  checksum text,
+  applied_at datetime
+)
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if _, err = m.db.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("error creating the schema_migrations table: %w", err)
+	}
+
+	return nil
+}
+
+func (m Migrator) applied() (map[string]appliedMigration, error) {
+	var (
+		err  error
+		rows []appliedMigration
+	)
+
+	sql := `
+SELECT
+   sm.name
+   , sm.checksum
+   , sm.applied_at
+FROM schema_migrations AS sm
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = m.db.Query(ctx, &rows, sql); err != nil {
+		return nil, fmt.Errorf("error querying for applied migrations: %w", err)
+	}
+
+	result := make(map[string]appliedMigration, len(rows))
+
+	for _, row := range rows {
+		result[row.Name] = row
+	}
+
+	return result, nil
+}
+
+/*
+apply runs a migration's statements and records it in one transaction, so
+a failure part way through leaves nothing behind. For untracked databases a
+duplicate column error rolls back and records the migration as applied.
+*/
+func (m Migrator) apply(mig migration, tracked bool) error {
+	var (
+		err error
+		tx  *sqlz.Tx
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	if tx, err = m.db.Begin(ctx); err != nil {
+		return fmt.Errorf("error starting transaction for migration %s: %w", mig.Name, err)
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for _, statement := range splitStatements(mig.Script) {
+		if _, err = tx.Exec(ctx, statement); err != nil {
+			if tracked || !isDuplicateColumn(err) {
+				return fmt.Errorf("error running migration %s: %w", mig.Name, err)
+			}
+
+			_ = tx.Rollback()
+			return m.record(ctx, m.db, mig)
+		}
+	}
+
+	if err = m.record(ctx, tx, mig); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing migration %s: %w", mig.Name, err)
+	}
+
+	return nil
+}
+
+func (m Migrator) record(ctx context.Context, db execer, mig migration) error {
+	var (
+		err error
+	)
+
+	sql := `INSERT INTO schema_migrations (name, checksum, applied_at) VALUES (?, ?, ?)`
+
+	if _, err = db.Exec(ctx, sql, mig.Name, mig.Checksum, time.Now().UTC()); err != nil {
+		return fmt.Errorf("error recording migration %s: %w", mig.Name, err)
+	}
+
+	return nil
+}
+
+func isDuplicateColumn(err error) bool {
+	return strings.Contains(err.Error(), "duplicate column")
+}
@@ -0,0 +1,209 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/glebarez/sqlite"
+	"github.com/rfberaldo/sqlz"
+	"github.com/rfberaldo/sqlz/binds"
+)
+
+func newTestDB(t *testing.T) *sqlz.DB {
+	t.Helper()
+
+	binds.Register("sqlite", binds.BindByDriver("sqlite3"))
+
+	db, err := sqlz.Connect("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("error opening test database: %v", err)
+	}
+
+	// Every connection to :memory: gets its own database
+	db.Pool().SetMaxOpenConns(1)
+
+	t.Cleanup(func() {
+		_ = db.Pool().Close()
+	})
+
+	return db
+}
+
+func countRows(t *testing.T, db *sqlz.DB, table string) int {
+	t.Helper()
+
+	count := 0
+
+	if err := db.QueryRow(context.Background(), &count, `SELECT COUNT(*) FROM `+table); err != nil {
+		t.Fatalf("error counting %s: %v", table, err)
+	}
+
+	return count
+}
+
+func TestMigrateRunsEachMigrationOnce(t *testing.T) {
+	db := newTestDB(t)
+
+	scripts := fstest.MapFS{
+		"commit00002.sql": {Data: []byte(`INSERT INTO things (name) VALUES ('second');`)},
+		"commit00001.sql": {Data: []byte(`CREATE TABLE things (name text);`)},
+		"README.md":       {Data: []byte(`not a migration`)},
+	}
+
+	migrator := NewMigrator(MigratorConfig{DB: db, FS: scripts})
+
+	applied, err := migrator.Migrate()
+
+	if err != nil {
+		t.Fatalf("Migrate() = %v", err)
+	}
+
+	if want := []string{"commit00001.sql", "commit00002.sql"}; !reflect.DeepEqual(applied, want) {
+		t.Errorf("applied = %v, want %v", applied, want)
+	}
+
+	// A second startup runs nothing, so the insert isn't repeated
+	if applied, err = migrator.Migrate(); err != nil || len(applied) != 0 {
+		t.Errorf("second Migrate() = %v, %v; want nothing applied", applied, err)
+	}
+
+	if count := countRows(t, db, "things"); count != 1 {
+		t.Errorf("things has %d rows, want 1", count)
+	}
+
+	// A new migration is picked up on the next startup
+	scripts["commit00003.sql"] = &fstest.MapFile{Data: []byte(`INSERT INTO things (name) VALUES ('third');`)}
+
+	if applied, err = migrator.Migrate(); err != nil || !reflect.DeepEqual(applied, []string{"commit00003.sql"}) {
+		t.Errorf("third Migrate() = %v, %v; want commit00003.sql applied", applied, err)
+	}
+}
+
+func TestMigrateReturnsRealErrors(t *testing.T) {
+	db := newTestDB(t)
+
+	scripts := fstest.MapFS{
+		"commit00001.sql": {Data: []byte(`CREATE TABLE things (name text);`)},
+		"commit00002.sql": {Data: []byte(`INSERT INTO nowhere (name) VALUES ('x');`)},
+		"commit00003.sql": {Data: []byte(`INSERT INTO things (name) VALUES ('never');`)},
+	}
+
+	applied, err := NewMigrator(MigratorConfig{DB: db, FS: scripts}).Migrate()
+
+	if err == nil {
+		t.Fatalf("Migrate() = nil, want an error")
+	}
+
+	if !reflect.DeepEqual(applied, []string{"commit00001.sql"}) {
+		t.Errorf("applied = %v, want only commit00001.sql", applied)
+	}
+
+	// The failed migration isn't recorded, so it's tried again next time
+	if count := countRows(t, db, "schema_migrations"); count != 1 {
+		t.Errorf("schema_migrations has %d rows, want 1", count)
+	}
+
+	if count := countRows(t, db, "things"); count != 0 {
+		t.Errorf("things has %d rows, want 0", count)
+	}
+}
+
+func TestMigrateRejectsChangedMigrations(t *testing.T) {
+	db := newTestDB(t)
+
+	scripts := fstest.MapFS{
+		"commit00001.sql": {Data: []byte(`CREATE TABLE things (name text);`)},
+	}
+
+	migrator := NewMigrator(MigratorConfig{DB: db, FS: scripts})
+
+	if _, err := migrator.Migrate(); err != nil {
+		t.Fatalf("Migrate() = %v", err)
+	}
+
+	scripts["commit00001.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE things (name text, size integer);`)}
+
+	if _, err := migrator.Migrate(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Migrate() = %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestMigrateAdoptsUntrackedDatabases(t *testing.T) {
+	db := newTestDB(t)
+
+	// A database migrated before tracking existed already has the column
+	if _, err := db.Exec(context.Background(), `CREATE TABLE things (name text, size integer)`); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+
+	scripts := fstest.MapFS{
+		"commit00001.sql": {Data: []byte(`CREATE TABLE IF NOT EXISTS things (name text);`)},
+		"commit00002.sql": {Data: []byte(`ALTER TABLE things ADD COLUMN size integer;`)},
+	}
+
+	migrator := NewMigrator(MigratorConfig{DB: db, FS: scripts})
+
+	if _, err := migrator.Migrate(); err != nil {
+		t.Fatalf("Migrate() = %v, want the duplicate column taken as already applied", err)
+	}
+
+	if count := countRows(t, db, "schema_migrations"); count != 2 {
+		t.Errorf("schema_migrations has %d rows, want 2", count)
+	}
+
+	// Once tracked, the same error is a real failure
+	scripts["commit00003.sql"] = &fstest.MapFile{Data: []byte(`ALTER TABLE things ADD COLUMN size integer;`)}
+
+	if _, err := migrator.Migrate(); err == nil {
+		t.Errorf("Migrate() = nil, want the duplicate column reported")
+	}
+}
+
+func TestMigrateRollsBackPartialMigrations(t *testing.T) {
+	db := newTestDB(t)
+
+	scripts := fstest.MapFS{
+		"commit00001.sql": {Data: []byte(`CREATE TABLE things (name text);`)},
+		"commit00002.sql": {Data: []byte(`
+CREATE TABLE others (name text);
+INSERT INTO things (name) VALUES ('first');
+INSERT INTO nowhere (name) VALUES ('second');
+`)},
+	}
+
+	if _, err := NewMigrator(MigratorConfig{DB: db, FS: scripts}).Migrate(); err == nil {
+		t.Fatalf("Migrate() = nil, want an error")
+	}
+
+	if count := countRows(t, db, "things"); count != 0 {
+		t.Errorf("things has %d rows, want the insert rolled back", count)
+	}
+
+	tables := 0
+
+	if err := db.QueryRow(context.Background(), &tables, `SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='others'`); err != nil {
+		t.Fatalf("error checking for the others table: %v", err)
+	}
+
+	if tables != 0 {
+		t.Errorf("the others table exists, want it rolled back")
+	}
+
+	// Fixing the migration lets it run in full
+	scripts["commit00002.sql"] = &fstest.MapFile{Data: []byte(`
+CREATE TABLE others (name text);
+INSERT INTO things (name) VALUES ('first');
+INSERT INTO others (name) VALUES ('second');
+`)}
+
+	if applied, err := NewMigrator(MigratorConfig{DB: db, FS: scripts}).Migrate(); err != nil || !reflect.DeepEqual(applied, []string{"commit00002.sql"}) {
+		t.Fatalf("Migrate() = %v, %v; want commit00002.sql applied", applied, err)
+	}
+
+	if countRows(t, db, "things") != 1 || countRows(t, db, "others") != 1 {
+		t.Errorf("want one row in things and others")
+	}
+}
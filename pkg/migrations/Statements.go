@@ -0,0 +1,169 @@
+package migrations
+
+import (
+	"strings"
+)
+
+/*
+splitStatements breaks a migration script into its individual statements
+on semicolons, skipping semicolons inside quotes and comments. Blank and
+comment-only statements are dropped.
+
+CREATE TRIGGER bodies contain semicolons of their own, so a BEGIN ... END
+block is kept whole. CASE ... END is tracked too so its END isn't mistaken
+for the end of the trigger.
+*/
+func splitStatements(script string) []string {
+	result := []string{}
+	current := strings.Builder{}
+	blockDepth := 0
+	caseDepth := 0
+
+	flush := func() {
+		statement := strings.TrimSpace(current.String())
+		current.Reset()
+
+		if hasCode(statement) {
+			result = append(result, statement)
+		}
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := closingQuote(script, i)
+			current.WriteString(script[i:end])
+			i = end - 1
+
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			end := strings.IndexByte(script[i:], '\n')
+
+			if end == -1 {
+				end = len(script) - i
+			}
+
+			current.WriteString(script[i : i+end])
+			i += end - 1
+
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+
+			if end == -1 {
+				end = len(script) - i
+			} else {
+				end += 4
+			}
+
+			current.WriteString(script[i : i+end])
+			i += end - 1
+
+		case c == ';' && blockDepth == 0:
+			flush()
+
+		default:
+			if word, ok := keywordAt(script, i); ok {
+				switch word {
+				case "BEGIN":
+					if isTriggerBody(current.String()) {
+						blockDepth++
+					}
+
+				case "CASE":
+					caseDepth++
+
+				case "END":
+					if caseDepth > 0 {
+						caseDepth--
+					} else if blockDepth > 0 {
+						blockDepth--
+					}
+				}
+
+				current.WriteString(script[i : i+len(word)])
+				i += len(word) - 1
+				continue
+			}
+
+			current.WriteByte(c)
+		}
+	}
+
+	flush()
+	return result
+}
+
+/*
+closingQuote returns the index just past the quote that closes the one at
+start. A doubled quote is an escaped quote, not the end.
+*/
+func closingQuote(script string, start int) int {
+	quote := script[start]
+
+	for i := start + 1; i < len(script); i++ {
+		if script[i] != quote {
+			continue
+		}
+
+		if i+1 < len(script) && script[i+1] == quote {
+			i++
+			continue
+		}
+
+		return i + 1
+	}
+
+	return len(script)
+}
+
+/*
+keywordAt reports whether a whole word starts at i, returning it upper
+cased. Only BEGIN and END matter to splitStatements, but any word is
+returned so it is copied in one go.
+*/
+func keywordAt(script string, i int) (string, bool) {
+	if !isWordByte(script[i]) || (i > 0 && isWordByte(script[i-1])) {
+		return "", false
+	}
+
+	end := i
+
+	for end < len(script) && isWordByte(script[end]) {
+		end++
+	}
+
+	return strings.ToUpper(script[i:end]), true
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isTriggerBody(statement string) bool {
+	code := []string{}
+
+	for _, line := range strings.Split(statement, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			code = append(code, line)
+		}
+	}
+
+	words := strings.Fields(strings.ToUpper(strings.Join(code, "\n")))
+	return len(words) > 1 && words[0] == "CREATE" && (words[1] == "TRIGGER" || (len(words) > 2 && words[2] == "TRIGGER"))
+}
+
+/*
+hasCode reports whether a statement is more than whitespace and comments.
+*/
+func hasCode(statement string) bool {
+	for _, line := range strings.Split(statement, "\n") {
+		line = strings.TrimSpace(line)
+
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return true
+		}
+	}
+
+	return false
+}
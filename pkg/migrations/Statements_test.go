@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "single statement without a semicolon",
+			script: "CREATE TABLE a (x text)",
+			want:   []string{"CREATE TABLE a (x text)"},
+		},
+		{
+			name:   "two statements",
+			script: "ALTER TABLE a ADD COLUMN y text;\nUPDATE a SET y = x;\n",
+			want:   []string{"ALTER TABLE a ADD COLUMN y text", "UPDATE a SET y = x"},
+		},
+		{
+			name:   "semicolons in strings",
+			script: `INSERT INTO a (x) VALUES ('one;two'), ('it''s; fine'); INSERT INTO "b;c" (x) VALUES ('z');`,
+			want:   []string{`INSERT INTO a (x) VALUES ('one;two'), ('it''s; fine')`, `INSERT INTO "b;c" (x) VALUES ('z')`},
+		},
+		{
+			name:   "semicolons in comments",
+			script: "-- add y; then fill it\nALTER TABLE a ADD COLUMN y text;\n/* not; here */ UPDATE a SET y = x;",
+			want:   []string{"-- add y; then fill it\nALTER TABLE a ADD COLUMN y text", "/* not; here */ UPDATE a SET y = x"},
+		},
+		{
+			name:   "comment only statements are dropped",
+			script: "CREATE TABLE a (x text);\n\n-- the end\n;\n",
+			want:   []string{"CREATE TABLE a (x text)"},
+		},
+		{
+			name:   "trigger body",
+			script: "-- keep updated_at current\nCREATE TRIGGER t AFTER UPDATE ON a BEGIN UPDATE a SET y = CASE WHEN x = '' THEN NULL ELSE x END; UPDATE b SET z = 1; END;\nCREATE INDEX i ON a (x);",
+			want: []string{
+				"-- keep updated_at current\nCREATE TRIGGER t AFTER UPDATE ON a BEGIN UPDATE a SET y = CASE WHEN x = '' THEN NULL ELSE x END; UPDATE b SET z = 1; END",
+				"CREATE INDEX i ON a (x)",
+			},
+		},
+		{
+			name:   "words containing begin and end",
+			script: "CREATE TABLE a (begin_at datetime, ended integer); CREATE TABLE b (x text);",
+			want:   []string{"CREATE TABLE a (begin_at datetime, ended integer)", "CREATE TABLE b (x text)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
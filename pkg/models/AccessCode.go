@@ -0,0 +1,15 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type AccessCode struct {
+	ID        uint
+	ClientID  uint
+	Code      string
+	Label     string
+	CreatedAt time.Time
+	RevokedAt sql.NullTime
+}
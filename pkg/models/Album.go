@@ -1,6 +1,7 @@
 package models
 
 import (
+	"database/sql"
 	"time"
 )
 
@@ -14,5 +15,37 @@ type Album struct {
 	Client          Client `db:"client"`
 	ShootDate       time.Time
 	Favorites       []Favorite
+	Comments        []Comment
+	ImageOrder      []ImageOrder
+	PosterXPos      string `db:"poster_x_pos"`
 	PosterYPos      string `db:"poster_y_pos"`
+	ExpiresAt       sql.NullTime
+
+	// AllowDownload is off for view only albums, like proofing galleries
+	AllowDownload bool
+
+	// Purchased is off until a proofing album is paid for. Previews are watermarked until then
+	Purchased bool
+
+	// MaxFavorites limits how many favorites the client may choose. NULL is unlimited
+	MaxFavorites sql.NullInt64
+
+	// GalleryID is the gallery the album is grouped into. NULL when it stands alone
+	GalleryID sql.NullInt64
+}
+
+/*
+CanDownload returns true when clients may download the album's photos. That
+takes downloads being turned on and the album being purchased.
+*/
+func (a *Album) CanDownload() bool {
+	return a.AllowDownload && a.Purchased
+}
+
+/*
+IsExpired returns true when the album has an expiration date and it has
+passed. Albums without an expiration never expire.
+*/
+func (a *Album) IsExpired() bool {
+	return a.ExpiresAt.Valid && !a.ExpiresAt.Time.After(time.Now())
 }
@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+type CacheFailure struct {
+	Key          string
+	Error        string
+	LastModified time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
@@ -11,8 +11,15 @@ var (
 type Client struct {
 	BaseModel
 
-	Password string
-	Name     string
-	Email    string
-	Albums   []Album
+	Name              string
+	Email             string
+	SessionGeneration int
+
+	// Locale is the language the client asked to see the site in. Blank uses their browser's
+	Locale string
+
+	// NotifyOnDownload sends the client an email when an album download is ready
+	NotifyOnDownload bool
+
+	Albums []Album
 }
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+/*
+ClientFavorite is one of a client's favorites along with the name of the
+album it is in, for exporting everything a client has chosen.
+*/
+type ClientFavorite struct {
+	AlbumID   uint
+	AlbumName string
+	ImagePath string
+	CreatedAt time.Time
+}
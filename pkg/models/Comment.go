@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+type Comment struct {
+	ID        uint
+	ClientID  uint
+	AlbumID   uint
+	ImagePath string
+	Body      string
+	CreatedAt time.Time
+}
@@ -0,0 +1,18 @@
+package models
+
+/*
+Gallery groups a client's albums from one event. A Gallery with an ID of 0
+holds the albums that aren't in any gallery.
+*/
+type Gallery struct {
+	BaseModel
+
+	ClientID uint
+	Name     string
+	Albums   []*Album
+}
+
+// IsUngrouped returns true for the albums that aren't in a gallery
+func (g Gallery) IsUngrouped() bool {
+	return g.ID == 0
+}
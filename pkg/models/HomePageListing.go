@@ -0,0 +1,12 @@
+package models
+
+import (
+	"time"
+)
+
+type HomePageListing struct {
+	Folder    string
+	Objects   string
+	Complete  bool
+	UpdatedAt time.Time
+}
@@ -0,0 +1,12 @@
+package models
+
+import (
+	"time"
+)
+
+type HomePagePhotoFlag struct {
+	FileName  string
+	Hidden    bool
+	Featured  bool
+	UpdatedAt time.Time
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	ImageEventDownload = "download"
+	ImageEventView     = "view"
+)
+
+type ImageEvent struct {
+	ClientID  uint
+	AlbumID   uint
+	ImagePath string
+	EventType string
+	CreatedAt time.Time
+}
+
+type ImageStat struct {
+	ImagePath string
+	Views     int
+	Downloads int
+}
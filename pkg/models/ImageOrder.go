@@ -0,0 +1,7 @@
+package models
+
+type ImageOrder struct {
+	AlbumID   uint
+	ImagePath string
+	Position  int
+}
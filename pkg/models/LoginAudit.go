@@ -0,0 +1,30 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	LoginOutcomeError         = "error"
+	LoginOutcomeIncorrectCode = "incorrect_code"
+	LoginOutcomeSuccess       = "success"
+)
+
+/*
+LoginAudit is one client login attempt. ClientID and AccessCodeID are only
+set when the code matched. Outcome is one of the LoginOutcome values.
+*/
+type LoginAudit struct {
+	ID           uint
+	ClientID     sql.NullInt64
+	AccessCodeID sql.NullInt64
+	IPAddress    string `db:"ip_address"`
+	UserAgent    string
+	Outcome      string
+	CreatedAt    time.Time
+}
+
+func (l LoginAudit) Succeeded() bool {
+	return l.Outcome == LoginOutcomeSuccess
+}
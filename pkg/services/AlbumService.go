@@ -2,19 +2,103 @@ package services
 
 import (
 	"context"
+	stdsql "database/sql"
+	"errors"
 	"fmt"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/adampresley/adampresleyphotography/pkg/models"
 	"github.com/rfberaldo/sqlz"
 )
 
+const (
+	maxCommentLength = 2000
+)
+
+var (
+	ErrAlbumAccessDenied = errors.New("album belongs to another client")
+	ErrAlbumNotFound     = errors.New("album not found")
+	ErrEmptyComment      = errors.New("comment is empty")
+	ErrGalleryNotFound   = errors.New("gallery not found")
+
+	// ErrFavoriteLimitReached is matched by FavoriteLimitError
+	ErrFavoriteLimitReached = errors.New("album's favorite limit reached")
+
+	/*
+	 * posterYPosPattern accepts the background-position-y values that make
+	 * sense for the hero banner: a keyword, or a length or percentage
+	 */
+	posterYPosPattern = regexp.MustCompile(`^(top|center|bottom|-?\d{1,4}(\.\d{1,2})?(%|px|rem|em)?)$`)
+
+	// posterXPosPattern is posterYPosPattern for background-position-x
+	posterXPosPattern = regexp.MustCompile(`^(left|center|right|-?\d{1,4}(\.\d{1,2})?(%|px|rem|em)?)$`)
+)
+
 type AlbumServicer interface {
+	AddComment(clientID, albumID uint, imagePath, body string) (models.Comment, error)
+	Create(request CreateAlbumRequest) (*models.Album, error)
+	CreateGallery(request CreateGalleryRequest) (*models.Gallery, error)
+	DeleteAlbum(clientID, albumID uint) error
 	GetAlbum(clientID uint, albumID uint) (*models.Album, error)
+	GetAlbumByID(albumID uint) (*models.Album, error)
+	CountFavorites(clientID, albumID uint) (int, error)
 	GetAlbumList(clientID uint) ([]*models.Album, error)
+	GetDownloadPermission(albumID uint) (bool, error)
+	GetPurchased(albumID uint) (bool, error)
+	GetComments(clientID, albumID uint) ([]models.Comment, error)
+	GetAllFavoritesForClient(clientID uint) ([]models.ClientFavorite, error)
+	GetFavorites(clientID, albumID uint) ([]models.Favorite, error)
+	GetGalleries(clientID uint) ([]models.Gallery, error)
+	GetImageOrder(albumID uint) ([]models.ImageOrder, error)
+	GetImageStats(clientID, albumID uint) ([]models.ImageStat, error)
+	RestoreFavorite(clientID, albumID uint, key string) error
+	SearchAlbums(clientID uint, filter AlbumFilter) ([]*models.Album, error)
+	SearchGalleries(clientID uint, filter AlbumFilter) ([]models.Gallery, error)
+	SetAlbumGallery(albumID uint, galleryID stdsql.NullInt64) error
+	SetDownloadPermission(albumID uint, allowDownload bool) error
+	SetPurchased(albumID uint, purchased bool) error
+	SetPoster(clientID, albumID uint, imagePath, xPos, yPos string) error
+	SetFavorites(clientID, albumID uint, keys []string, favorite bool) error
+	SetImageOrder(albumID uint, imagePaths []string) error
+	SetMaxFavorites(albumID uint, maxFavorites stdsql.NullInt64) error
 	ToggleFavorite(clientID, albumID uint, key string) (bool, error)
 }
 
+/*
+AlbumFilter narrows an album listing. Name is matched as a case-insensitive
+substring. From and To bound the shoot date, inclusive. Zero values are ignored.
+*/
+type AlbumFilter struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+func (f AlbumFilter) IsEmpty() bool {
+	return f.Name == "" && f.From.IsZero() && f.To.IsZero()
+}
+
+/*
+CreateAlbumRequest holds the details for a new album. ShootDate is required
+and ExpiresAt is optional, both formatted as YYYY-MM-DD.
+*/
+type CreateAlbumRequest struct {
+	ClientID  uint   `json:"clientID"`
+	Name      string `json:"name"`
+	ShootDate string `json:"shootDate"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// CreateGalleryRequest holds the details for a new gallery
+type CreateGalleryRequest struct {
+	ClientID uint   `json:"clientID"`
+	Name     string `json:"name"`
+}
+
 type AlbumServiceConfig struct {
 	DB *sqlz.DB
 }
@@ -23,115 +107,1108 @@ type AlbumService struct {
 	db *sqlz.DB
 }
 
-func NewAlbumService(config AlbumServiceConfig) AlbumService {
-	return AlbumService{
-		db: config.DB,
+func NewAlbumService(config AlbumServiceConfig) AlbumService {
+	return AlbumService{
+		db: config.DB,
+	}
+}
+
+/*
+Create adds an album for an existing client. Images are stored under the
+album's ID, so no path is needed up front.
+*/
+func (s AlbumService) Create(request CreateAlbumRequest) (*models.Album, error) {
+	var (
+		err        error
+		id         int64
+		count      int
+		execResult stdsql.Result
+	)
+
+	request.Name = strings.TrimSpace(request.Name)
+
+	if request.ClientID == 0 {
+		return nil, fmt.Errorf("%w: client ID is required", ErrInvalidInput)
+	}
+
+	if request.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+
+	now := time.Now().UTC()
+
+	result := &models.Album{
+		BaseModel: models.BaseModel{
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		Name:          request.Name,
+		ClientID:      request.ClientID,
+		AllowDownload: true,
+		Purchased:     true,
+	}
+
+	if result.ShootDate, err = time.Parse(time.DateOnly, request.ShootDate); err != nil {
+		return nil, fmt.Errorf("%w: shoot date must be formatted as YYYY-MM-DD", ErrInvalidInput)
+	}
+
+	if request.ExpiresAt != "" {
+		if result.ExpiresAt.Time, err = time.Parse(time.DateOnly, request.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("%w: expiration date must be formatted as YYYY-MM-DD", ErrInvalidInput)
+		}
+
+		result.ExpiresAt.Valid = true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	sql := `
+SELECT
+	COUNT(*)
+FROM clients
+WHERE 1=1
+	AND id=?
+	AND deleted_at IS NULL
+	`
+
+	if err = s.db.QueryRow(ctx, &count, sql, request.ClientID); err != nil {
+		return nil, fmt.Errorf("error checking for client %d: %w", request.ClientID, err)
+	}
+
+	if count == 0 {
+		return nil, fmt.Errorf("%w: client %d does not exist", ErrInvalidInput, request.ClientID)
+	}
+
+	sql = `
+INSERT INTO albums (
+    created_at,
+    updated_at,
+    name,
+    "path",
+    client_id,
+    shoot_date,
+    poster_image_path,
+    expires_at
+) VALUES (?, ?, ?, '', ?, ?, '', ?)
+`
+
+	params := []any{
+		result.CreatedAt,
+		result.UpdatedAt,
+		result.Name,
+		result.ClientID,
+		result.ShootDate,
+		result.ExpiresAt,
+	}
+
+	if execResult, err = s.db.Exec(ctx, sql, params...); err != nil {
+		return nil, fmt.Errorf("error inserting album '%s' for client %d: %w", result.Name, result.ClientID, err)
+	}
+
+	if id, err = execResult.LastInsertId(); err != nil {
+		return nil, fmt.Errorf("error getting ID of new album '%s': %w", result.Name, err)
+	}
+
+	result.ID = uint(id)
+	return result, nil
+}
+
+/*
+GetAlbum returns a single album, including expired ones. Callers should
+check Album.IsExpired before granting access. The error wraps
+ErrAlbumAccessDenied when the album belongs to another client, and
+ErrAlbumNotFound when there is no such album.
+*/
+func (s AlbumService) GetAlbum(clientID, albumID uint) (*models.Album, error) {
+	var (
+		err error
+	)
+
+	result := &models.Album{}
+
+	sql := `
+SELECT
+   a.id 
+   , a.created_at 
+   , a.updated_at
+   , a.deleted_at
+   , a.name 
+   , a."path"
+   , a.shoot_date
+   , a.client_id
+   , a.poster_image_path
+	, COALESCE(a.poster_x_pos, '') AS poster_x_pos
+	, COALESCE(a.poster_y_pos, '') AS poster_y_pos
+   , a.expires_at
+   , a.allow_download
+   , a.purchased
+   , a.max_favorites
+   , a.gallery_id
+   , c.id AS "client.id"
+   , c.created_at AS "client.created_at"
+   , c.updated_at AS "client.updated_at"
+   , c.deleted_at AS "client.deleted_at"
+   , c.name AS "client.name"
+FROM albums AS a
+   INNER JOIN clients AS c ON c.id=a.client_id
+WHERE 1=1
+   AND a.deleted_at IS NULL
+   AND c.deleted_at IS NULL
+   AND a.id=?
+   AND a.client_id=?
+   `
+
+	params := []any{albumID, clientID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.QueryRow(ctx, result, sql, params...); err != nil {
+		if sqlz.IsNotFound(err) {
+			return result, s.albumNotFound(ctx, clientID, albumID)
+		}
+
+		return result, fmt.Errorf("error querying for album %d, client %d: %w", albumID, clientID, err)
+	}
+
+	if result.Favorites, err = s.GetFavorites(clientID, albumID); err != nil {
+		return result, err
+	}
+
+	if result.Comments, err = s.GetComments(clientID, albumID); err != nil {
+		return result, err
+	}
+
+	if result.ImageOrder, err = s.GetImageOrder(albumID); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+/*
+albumNotFound explains why a client's album couldn't be found. When the
+album exists but belongs to another client the error wraps
+ErrAlbumAccessDenied, otherwise ErrAlbumNotFound. Either way it also wraps
+sql.ErrNoRows.
+*/
+func (s AlbumService) albumNotFound(ctx context.Context, clientID, albumID uint) error {
+	var (
+		err   error
+		owner uint
+	)
+
+	sql := `
+SELECT
+	client_id
+FROM albums
+WHERE 1=1
+	AND id=?
+	AND deleted_at IS NULL
+	`
+
+	if err = s.db.QueryRow(ctx, &owner, sql, albumID); err != nil && !sqlz.IsNotFound(err) {
+		return fmt.Errorf("error querying for owner of album %d: %w", albumID, err)
+	}
+
+	if err == nil && owner != clientID {
+		return notFound(ErrAlbumAccessDenied, "album %d belongs to another client, not client %d", albumID, clientID)
+	}
+
+	return notFound(ErrAlbumNotFound, "album %d not found for client %d", albumID, clientID)
+}
+
+/*
+AddComment stores a client's note on an image. The body is trimmed, stripped
+of control characters other than newlines and tabs, and capped at
+maxCommentLength characters. It is stored as plain text; templates are
+responsible for escaping it when rendered. Returns ErrEmptyComment when
+nothing is left after sanitizing.
+*/
+func (s AlbumService) AddComment(clientID, albumID uint, imagePath, body string) (models.Comment, error) {
+	var (
+		err error
+		id  int64
+	)
+
+	comment := models.Comment{
+		ClientID:  clientID,
+		AlbumID:   albumID,
+		ImagePath: imagePath,
+		Body:      sanitizeCommentBody(body),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if comment.Body == "" {
+		return comment, ErrEmptyComment
+	}
+
+	sql := `
+INSERT INTO comments (
+    client_id,
+    album_id,
+    image_path,
+    body,
+    created_at
+) VALUES (?, ?, ?, ?, ?)
+`
+
+	params := []any{
+		comment.ClientID,
+		comment.AlbumID,
+		comment.ImagePath,
+		comment.Body,
+		comment.CreatedAt,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	result, err := s.db.Exec(ctx, sql, params...)
+
+	if err != nil {
+		return comment, fmt.Errorf("error adding comment for album %d, client %d: %w", albumID, clientID, err)
+	}
+
+	if id, err = result.LastInsertId(); err == nil {
+		comment.ID = uint(id)
+	}
+
+	return comment, nil
+}
+
+/*
+GetComments returns all comments on an album, oldest first.
+*/
+func (s AlbumService) GetComments(clientID, albumID uint) ([]models.Comment, error) {
+	var (
+		err error
+	)
+
+	result := []models.Comment{}
+
+	sql := `
+SELECT
+	id
+	, client_id
+	, album_id
+	, image_path
+	, body
+	, created_at
+FROM comments
+WHERE 1=1
+	AND client_id=?
+	AND album_id=?
+ORDER BY created_at, id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.Query(ctx, &result, sql, clientID, albumID); err != nil {
+		return result, fmt.Errorf("error querying for comments for album %d, client %d: %w", albumID, clientID, err)
+	}
+
+	return result, nil
+}
+
+func sanitizeCommentBody(body string) string {
+	body = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return -1
+		}
+
+		return r
+	}, strings.TrimSpace(body))
+
+	if runes := []rune(body); len(runes) > maxCommentLength {
+		body = strings.TrimSpace(string(runes[:maxCommentLength]))
+	}
+
+	return body
+}
+
+/*
+DeleteAlbum soft deletes an album so it no longer shows up for the client or
+the admin. Its photos in storage are left alone; removing them is up to the
+caller. Returns a not found error if the client has no such album.
+*/
+func (s AlbumService) DeleteAlbum(clientID, albumID uint) error {
+	var (
+		err        error
+		execResult stdsql.Result
+		affected   int64
+	)
+
+	sql := `
+UPDATE albums SET
+    deleted_at = ?,
+    updated_at = ?
+WHERE 1=1
+    AND id = ?
+    AND client_id = ?
+    AND deleted_at IS NULL
+`
+
+	now := time.Now().UTC()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if execResult, err = s.db.Exec(ctx, sql, now, now, albumID, clientID); err != nil {
+		return fmt.Errorf("error deleting album %d, client %d: %w", albumID, clientID, err)
+	}
+
+	if affected, err = execResult.RowsAffected(); err != nil {
+		return fmt.Errorf("error checking deleted album %d: %w", albumID, err)
+	}
+
+	if affected == 0 {
+		return notFound(ErrAlbumNotFound, "album %d not found for client %d", albumID, clientID)
+	}
+
+	return nil
+}
+
+/*
+GetAlbumByID returns an album without knowing which client owns it. This is
+for admin use; client facing code should use GetAlbum so albums are always
+scoped to the logged in client. The error wraps ErrAlbumNotFound when there
+is no such album.
+*/
+func (s AlbumService) GetAlbumByID(albumID uint) (*models.Album, error) {
+	var (
+		err      error
+		clientID uint
+	)
+
+	sql := `
+SELECT
+	client_id
+FROM albums
+WHERE 1=1
+	AND id=?
+	AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.QueryRow(ctx, &clientID, sql, albumID); err != nil {
+		if sqlz.IsNotFound(err) {
+			return nil, notFound(ErrAlbumNotFound, "album %d not found", albumID)
+		}
+
+		return nil, fmt.Errorf("error querying for client of album %d: %w", albumID, err)
+	}
+
+	return s.GetAlbum(clientID, albumID)
+}
+
+/*
+CountFavorites returns the number of favorites stored for an album. This is
+a count of database rows, so it includes favorites whose image may since
+have been removed from storage.
+*/
+func (s AlbumService) CountFavorites(clientID, albumID uint) (int, error) {
+	var (
+		err   error
+		count int
+	)
+
+	sql := `
+SELECT
+	COUNT(*)
+FROM favorites
+WHERE 1=1
+	AND client_id=?
+	AND album_id=?
+	AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.QueryRow(ctx, &count, sql, clientID, albumID); err != nil {
+		return 0, fmt.Errorf("error counting favorites for album %d, client %d: %w", albumID, clientID, err)
+	}
+
+	return count, nil
+}
+
+func (s AlbumService) GetFavorites(clientID, albumID uint) ([]models.Favorite, error) {
+	var (
+		err error
+	)
+
+	result := []models.Favorite{}
+
+	sql := `
+SELECT
+	album_id
+	, client_id
+	, image_path
+	, created_at
+FROM favorites
+WHERE 1=1
+	AND client_id=?
+	AND album_id=?
+	AND deleted_at IS NULL
+ORDER BY image_path
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.Query(ctx, &result, sql, clientID, albumID); err != nil {
+		return result, fmt.Errorf("error querying for favorites for album %d, client %d: %w", albumID, clientID, err)
+	}
+
+	return result, nil
+}
+
+/*
+GetAllFavoritesForClient returns a client's favorites across all of their
+albums, newest album first and by image within each album. Favorites in
+deleted albums are left out.
+*/
+func (s AlbumService) GetAllFavoritesForClient(clientID uint) ([]models.ClientFavorite, error) {
+	var (
+		err error
+	)
+
+	result := []models.ClientFavorite{}
+
+	sql := `
+SELECT
+	f.album_id
+	, a.name AS album_name
+	, f.image_path
+	, f.created_at
+FROM favorites AS f
+	INNER JOIN albums AS a ON a.id=f.album_id
+WHERE 1=1
+	AND f.client_id=?
+	AND f.deleted_at IS NULL
+	AND a.deleted_at IS NULL
+ORDER BY a.shoot_date DESC, a.id, f.image_path
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.Query(ctx, &result, sql, clientID); err != nil {
+		return result, fmt.Errorf("error querying for favorites for client %d: %w", clientID, err)
+	}
+
+	return result, nil
+}
+
+/*
+GetImageOrder returns the stored display order for an album's images,
+lowest position first. Albums that have never been ordered return an empty
+slice.
+*/
+func (s AlbumService) GetImageOrder(albumID uint) ([]models.ImageOrder, error) {
+	var (
+		err error
+	)
+
+	result := []models.ImageOrder{}
+
+	sql := `
+SELECT
+	album_id
+	, image_path
+	, position
+FROM image_order
+WHERE 1=1
+	AND album_id=?
+ORDER BY position
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.Query(ctx, &result, sql, albumID); err != nil {
+		return result, fmt.Errorf("error querying image order for album %d: %w", albumID, err)
+	}
+
+	return result, nil
+}
+
+/*
+SetImageOrder replaces an album's display order. imagePaths is the new
+order; images left out of it fall back to name order after the listed ones.
+An empty slice clears the order.
+*/
+func (s AlbumService) SetImageOrder(albumID uint, imagePaths []string) error {
+	var (
+		err error
+		tx  *sqlz.Tx
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if tx, err = s.db.Begin(ctx); err != nil {
+		return fmt.Errorf("error starting transaction to set image order for album %d: %w", albumID, err)
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err = tx.Exec(ctx, "DELETE FROM image_order WHERE album_id=?", albumID); err != nil {
+		return fmt.Errorf("error clearing image order for album %d: %w", albumID, err)
+	}
+
+	if len(imagePaths) > 0 {
+		placeholders := make([]string, 0, len(imagePaths))
+		params := make([]any, 0, len(imagePaths)*3)
+
+		for position, imagePath := range imagePaths {
+			placeholders = append(placeholders, "(?, ?, ?)")
+			params = append(params, albumID, imagePath, position)
+		}
+
+		sql := `
+INSERT INTO image_order (
+    album_id,
+    image_path,
+    position
+) VALUES ` + strings.Join(placeholders, ", ")
+
+		if _, err = tx.Exec(ctx, sql, params...); err != nil {
+			return fmt.Errorf("error inserting image order for album %d: %w", albumID, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing image order for album %d: %w", albumID, err)
+	}
+
+	return nil
+}
+
+/*
+GetImageStats returns view and download counts for each image in an album
+that has at least one recorded event, most downloaded first.
+*/
+func (s AlbumService) GetImageStats(clientID, albumID uint) ([]models.ImageStat, error) {
+	var (
+		err error
+	)
+
+	result := []models.ImageStat{}
+
+	sql := `
+SELECT
+	image_path
+	, SUM(CASE WHEN event_type = ? THEN 1 ELSE 0 END) AS views
+	, SUM(CASE WHEN event_type = ? THEN 1 ELSE 0 END) AS downloads
+FROM image_events
+WHERE 1=1
+	AND client_id=?
+	AND album_id=?
+GROUP BY image_path
+ORDER BY downloads DESC, views DESC, image_path
+	`
+
+	params := []any{
+		models.ImageEventView,
+		models.ImageEventDownload,
+		clientID,
+		albumID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.Query(ctx, &result, sql, params...); err != nil {
+		return result, fmt.Errorf("error querying image stats for album %d, client %d: %w", albumID, clientID, err)
+	}
+
+	return result, nil
+}
+
+/*
+GetAlbumList returns a client's albums, newest first. Expired albums are
+left out. expires_at goes through datetime() so it compares as a time, no
+matter which format the driver or a hand-written update stored it in.
+*/
+func (s AlbumService) GetAlbumList(clientID uint) ([]*models.Album, error) {
+	var (
+		err error
+	)
+
+	result := []*models.Album{}
+
+	sql := `
+SELECT
+   a.id
+   , a.created_at
+   , a.updated_at
+   , a.deleted_at
+   , a.name
+   , a."path"
+   , a.client_id
+   , a.shoot_date
+   , a.poster_image_path
+	, COALESCE(a.poster_x_pos, '') AS poster_x_pos
+	, COALESCE(a.poster_y_pos, '') AS poster_y_pos
+   , a.expires_at
+   , a.allow_download
+   , a.purchased
+   , a.max_favorites
+   , a.gallery_id
+FROM albums AS a
+WHERE 1=1
+   AND a.deleted_at IS NULL
+   AND a.client_id = ?
+   AND (a.expires_at IS NULL OR datetime(a.expires_at) > datetime('now'))
+ORDER BY a.shoot_date DESC
+   `
+
+	params := []any{
+		clientID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.Query(ctx, &result, sql, params...); err != nil {
+		return result, fmt.Errorf("error querying for albums by client ID %d: %w", clientID, err)
+	}
+
+	return result, nil
+}
+
+func (s AlbumService) SearchAlbums(clientID uint, filter AlbumFilter) ([]*models.Album, error) {
+	var (
+		err error
+	)
+
+	if filter.IsEmpty() {
+		return s.GetAlbumList(clientID)
+	}
+
+	result := []*models.Album{}
+
+	sql := `
+SELECT
+   a.id
+   , a.created_at
+   , a.updated_at
+   , a.deleted_at
+   , a.name
+   , a."path"
+   , a.client_id
+   , a.shoot_date
+   , a.poster_image_path
+	, COALESCE(a.poster_x_pos, '') AS poster_x_pos
+	, COALESCE(a.poster_y_pos, '') AS poster_y_pos
+   , a.expires_at
+   , a.allow_download
+   , a.purchased
+   , a.max_favorites
+   , a.gallery_id
+FROM albums AS a
+WHERE 1=1
+   AND a.deleted_at IS NULL
+   AND a.client_id = ?
+   AND (a.expires_at IS NULL OR datetime(a.expires_at) > datetime('now'))
+`
+
+	params := []any{
+		clientID,
+	}
+
+	if filter.Name != "" {
+		sql += "   AND a.name LIKE ? ESCAPE '\\'\n"
+		params = append(params, "%"+escapeLike(filter.Name)+"%")
+	}
+
+	if !filter.From.IsZero() {
+		sql += "   AND a.shoot_date >= ?\n"
+		params = append(params, filter.From.Format(time.DateOnly))
+	}
+
+	if !filter.To.IsZero() {
+		sql += "   AND a.shoot_date < ?\n"
+		params = append(params, filter.To.AddDate(0, 0, 1).Format(time.DateOnly))
+	}
+
+	sql += "ORDER BY a.shoot_date DESC\n"
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.Query(ctx, &result, sql, params...); err != nil {
+		return result, fmt.Errorf("error searching albums for client ID %d: %w", clientID, err)
+	}
+
+	return result, nil
+}
+
+/*
+GetGalleries returns a client's albums grouped by gallery. See
+SearchGalleries.
+*/
+func (s AlbumService) GetGalleries(clientID uint) ([]models.Gallery, error) {
+	return s.SearchGalleries(clientID, AlbumFilter{})
+}
+
+/*
+SearchGalleries returns the albums matching filter grouped by gallery.
+Every one of the client's galleries is returned, even when none of its
+albums match, so callers decide whether to show empty ones. Albums that
+aren't in a gallery come last, in a Gallery with an ID of 0, when there
+are any.
+*/
+func (s AlbumService) SearchGalleries(clientID uint, filter AlbumFilter) ([]models.Gallery, error) {
+	var (
+		err    error
+		albums []*models.Album
+	)
+
+	galleries := []models.Gallery{}
+
+	sql := `
+SELECT
+   g.id
+   , g.created_at
+   , g.updated_at
+   , g.deleted_at
+   , g.client_id
+   , g.name
+FROM galleries AS g
+WHERE 1=1
+   AND g.deleted_at IS NULL
+   AND g.client_id = ?
+ORDER BY g.name COLLATE NOCASE, g.id
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.Query(ctx, &galleries, sql, clientID); err != nil {
+		return nil, fmt.Errorf("error querying galleries for client %d: %w", clientID, err)
+	}
+
+	if albums, err = s.SearchAlbums(clientID, filter); err != nil {
+		return nil, err
+	}
+
+	return groupAlbumsByGallery(galleries, albums), nil
+}
+
+/*
+groupAlbumsByGallery puts each album into its gallery, keeping the albums'
+order. Galleries are ordered by their newest album, so the most recent
+event comes first, and galleries without albums follow in the order given.
+Albums whose gallery isn't in galleries are treated as ungrouped.
+*/
+func groupAlbumsByGallery(galleries []models.Gallery, albums []*models.Album) []models.Gallery {
+	result := make([]models.Gallery, len(galleries))
+	index := map[int64]int{}
+	ungrouped := models.Gallery{Albums: []*models.Album{}}
+
+	for i, gallery := range galleries {
+		gallery.Albums = []*models.Album{}
+		result[i] = gallery
+		index[int64(gallery.ID)] = i
+	}
+
+	for _, album := range albums {
+		i, ok := index[album.GalleryID.Int64]
+
+		if !album.GalleryID.Valid || !ok {
+			ungrouped.Albums = append(ungrouped.Albums, album)
+			continue
+		}
+
+		result[i].Albums = append(result[i].Albums, album)
+	}
+
+	slices.SortStableFunc(result, func(a, b models.Gallery) int {
+		switch {
+		case len(a.Albums) == 0 && len(b.Albums) == 0:
+			return 0
+		case len(a.Albums) == 0:
+			return 1
+		case len(b.Albums) == 0:
+			return -1
+		}
+
+		return b.Albums[0].ShootDate.Compare(a.Albums[0].ShootDate)
+	})
+
+	if len(ungrouped.Albums) > 0 {
+		result = append(result, ungrouped)
+	}
+
+	return result
+}
+
+/*
+SetFavorites marks or un-marks many images as favorites in a single
+transaction. It is idempotent: favoriting an image that is already a
+favorite, or un-favoriting one that is not, is a no-op. Favoriting that
+would take the client past the album's limit adds none of them and returns
+a FavoriteLimitError.
+*/
+func (s AlbumService) SetFavorites(clientID, albumID uint, keys []string, favorite bool) error {
+	var (
+		err error
+		tx  *sqlz.Tx
+	)
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if favorite {
+		if err = s.checkFavoriteLimit(clientID, albumID, keys); err != nil {
+			return err
+		}
+	}
+
+	placeholders := make([]string, 0, len(keys))
+	params := []any{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if tx, err = s.db.Begin(ctx); err != nil {
+		return fmt.Errorf("error starting transaction to set favorites for client %d, album %d: %w", clientID, albumID, err)
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if favorite {
+		now := time.Now().UTC()
+
+		for _, key := range keys {
+			placeholders = append(placeholders, "(?, ?, ?, ?)")
+			params = append(params, clientID, albumID, key, now)
+		}
+
+		sql := `
+INSERT INTO favorites (
+    client_id,
+    album_id,
+    image_path,
+    created_at
+) VALUES ` + strings.Join(placeholders, ", ") + `
+ON CONFLICT (client_id, album_id, image_path) DO UPDATE SET
+    created_at = excluded.created_at,
+    deleted_at = NULL
+WHERE favorites.deleted_at IS NOT NULL
+`
+
+		if _, err = tx.Exec(ctx, sql, params...); err != nil {
+			return fmt.Errorf("error adding favorites for client %d, album %d: %w", clientID, albumID, err)
+		}
+	} else {
+		params = append(params, time.Now().UTC(), clientID, albumID)
+
+		for _, key := range keys {
+			placeholders = append(placeholders, "?")
+			params = append(params, key)
+		}
+
+		sql := `
+UPDATE favorites SET
+    deleted_at = ?
+WHERE 1=1
+    AND client_id = ?
+    AND album_id = ?
+    AND deleted_at IS NULL
+    AND image_path IN (` + strings.Join(placeholders, ", ") + `)
+`
+
+		if _, err = tx.Exec(ctx, sql, params...); err != nil {
+			return fmt.Errorf("error removing favorites for client %d, album %d: %w", clientID, albumID, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing favorites for client %d, album %d: %w", clientID, albumID, err)
+	}
+
+	return nil
+}
+
+/*
+RestoreFavorite brings back a favorite that was previously removed. The
+original favorited timestamp is kept. Returns a FavoriteLimitError when the
+client already has as many favorites as the album allows.
+*/
+func (s AlbumService) RestoreFavorite(clientID, albumID uint, key string) error {
+	var (
+		err error
+	)
+
+	if err = s.checkFavoriteLimit(clientID, albumID, []string{key}); err != nil {
+		return err
+	}
+
+	sql := `
+UPDATE favorites SET
+    deleted_at = NULL
+WHERE 1=1
+    AND client_id = ?
+    AND album_id = ?
+    AND image_path = ?
+    AND deleted_at IS NOT NULL
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if _, err = s.db.Exec(ctx, sql, clientID, albumID, key); err != nil {
+		return fmt.Errorf("error restoring favorite for client %d, album %d, image %s: %w",
+			clientID, albumID, key, err)
 	}
+
+	return nil
 }
 
-func (s AlbumService) GetAlbum(clientID, albumID uint) (*models.Album, error) {
+/*
+GetDownloadPermission returns whether clients may download an album's
+photos, one at a time or as a zip. That takes downloads being turned on and
+the album being purchased. It is a lighter read than GetAlbum for checks
+made on every download. Returns a not found error if the album doesn't
+exist.
+*/
+func (s AlbumService) GetDownloadPermission(albumID uint) (bool, error) {
 	var (
-		err error
+		err           error
+		allowDownload bool
 	)
 
-	result := &models.Album{}
-
 	sql := `
 SELECT
-   a.id 
-   , a.created_at 
-   , a.updated_at
-   , a.deleted_at
-   , a.name 
-   , a."path"
-   , a.shoot_date
-   , a.client_id
-   , a.poster_image_path
-	, COALESCE(a.poster_y_pos, '') AS poster_y_pos
-   , c.id AS "client.id"
-   , c.created_at AS "client.created_at"
-   , c.updated_at AS "client.updated_at"
-   , c.deleted_at AS "client.deleted_at"
-   , c.name AS "client.name"
+   a.allow_download AND a.purchased
 FROM albums AS a
-   INNER JOIN clients AS c ON c.id=a.client_id
 WHERE 1=1
    AND a.deleted_at IS NULL
-   AND c.deleted_at IS NULL
    AND a.id=?
-   AND a.client_id=?
    `
 
-	params := []any{albumID, clientID}
-
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	if err = s.db.QueryRow(ctx, result, sql, params...); err != nil {
-		return result, fmt.Errorf("error querying for album %d, client %d: %w", albumID, clientID, err)
+	if err = s.db.QueryRow(ctx, &allowDownload, sql, albumID); err != nil {
+		if sqlz.IsNotFound(err) {
+			return false, notFound(ErrAlbumNotFound, "album %d not found", albumID)
+		}
+
+		return false, fmt.Errorf("error querying download permission for album %d: %w", albumID, err)
 	}
 
-	// Get favorites
-	sql = `
-SELECT
-	album_id
-	, client_id
-	, image_path
-FROM favorites
+	return allowDownload, nil
+}
+
+/*
+SetDownloadPermission turns downloads of an album's photos on or off. Albums
+with downloads off are view only, like proofing galleries. Returns a not
+found error if the album doesn't exist.
+*/
+func (s AlbumService) SetDownloadPermission(albumID uint, allowDownload bool) error {
+	var (
+		err        error
+		execResult stdsql.Result
+		affected   int64
+	)
+
+	sql := `
+UPDATE albums SET
+    allow_download = ?,
+    updated_at = ?
 WHERE 1=1
-	AND client_id=?
-	AND album_id=?
-	`
-	params = []any{clientID, albumID}
+    AND id = ?
+    AND deleted_at IS NULL
+`
 
-	ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	if err = s.db.Query(ctx, &result.Favorites, sql, params...); err != nil {
-		return result, fmt.Errorf("error querying for favorites for album %d, client %d: %w", albumID, clientID, err)
+	if execResult, err = s.db.Exec(ctx, sql, allowDownload, time.Now().UTC(), albumID); err != nil {
+		return fmt.Errorf("error setting download permission for album %d: %w", albumID, err)
 	}
 
-	return result, nil
+	if affected, err = execResult.RowsAffected(); err != nil {
+		return fmt.Errorf("error checking download permission update for album %d: %w", albumID, err)
+	}
+
+	if affected == 0 {
+		return notFound(ErrAlbumNotFound, "album %d not found", albumID)
+	}
+
+	return nil
 }
 
-func (s AlbumService) GetAlbumList(clientID uint) ([]*models.Album, error) {
+/*
+SetPoster changes the image used for an album's poster and hero banner, and
+its horizontal and vertical position. xPos and yPos may be empty, or CSS
+background-position-x and background-position-y values like "center" or
+"30%". Percentages and keywords also pick the hero banner's crop. Callers
+are responsible for checking that the image exists.
+*/
+func (s AlbumService) SetPoster(clientID, albumID uint, imagePath, xPos, yPos string) error {
 	var (
 		err error
 	)
 
-	result := []*models.Album{}
+	xPos = strings.TrimSpace(xPos)
+	yPos = strings.TrimSpace(yPos)
+
+	if imagePath == "" {
+		return fmt.Errorf("%w: image path is required", ErrInvalidInput)
+	}
+
+	if xPos != "" && !posterXPosPattern.MatchString(xPos) {
+		return fmt.Errorf("%w: '%s' is not a valid X position. Use left, center, right, or a value like 30%% or 20px", ErrInvalidInput, xPos)
+	}
+
+	if yPos != "" && !posterYPosPattern.MatchString(yPos) {
+		return fmt.Errorf("%w: '%s' is not a valid Y position. Use top, center, bottom, or a value like 30%% or 20px", ErrInvalidInput, yPos)
+	}
 
 	sql := `
-SELECT
-   a.id
-   , a.created_at
-   , a.updated_at
-   , a.deleted_at
-   , a.name
-   , a."path"
-   , a.client_id
-   , a.shoot_date
-   , a.poster_image_path
-	, COALESCE(a.poster_y_pos, '') AS poster_y_pos
-FROM albums AS a
+UPDATE albums SET
+    poster_image_path = ?,
+    poster_x_pos = ?,
+    poster_y_pos = ?,
+    updated_at = ?
 WHERE 1=1
-   AND a.deleted_at IS NULL
-   AND a.client_id = ?
-ORDER BY a.shoot_date DESC
-   `
+    AND id = ?
+    AND client_id = ?
+    AND deleted_at IS NULL
+`
 
 	params := []any{
+		imagePath,
+		xPos,
+		yPos,
+		time.Now().UTC(),
+		albumID,
 		clientID,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	if err = s.db.Query(ctx, &result, sql, params...); err != nil {
-		return result, fmt.Errorf("error querying for albums by client ID %d: %w", clientID, err)
+	if _, err = s.db.Exec(ctx, sql, params...); err != nil {
+		return fmt.Errorf("error setting poster for album %d, client %d: %w", albumID, clientID, err)
 	}
 
-	return result, nil
+	return nil
 }
 
 func (s AlbumService) ToggleFavorite(clientID, albumID uint, key string) (bool, error) {
@@ -141,7 +1218,7 @@ func (s AlbumService) ToggleFavorite(clientID, albumID uint, key string) (bool,
 		favorite models.Favorite
 	)
 
-	// First, check if the favorite already exists
+	// First, check if the favorite already exists. Soft-deleted favorites don't count.
 	sql := `
 SELECT 
     client_id,
@@ -152,6 +1229,7 @@ WHERE 1=1
     AND client_id = ?
     AND album_id = ?
     AND image_path = ?
+    AND deleted_at IS NULL
 `
 
 	params := []any{
@@ -178,11 +1256,12 @@ WHERE 1=1
 		exists = true
 	}
 
-	// Now either insert or delete based on existence
+	// Now either insert or soft-delete based on existence
 	if exists {
-		// Delete the favorite
+		// Soft-delete the favorite so it can be restored
 		sql = `
-DELETE FROM favorites
+UPDATE favorites SET
+    deleted_at = ?
 WHERE 1=1
     AND client_id = ?
     AND album_id = ?
@@ -191,23 +1270,31 @@ WHERE 1=1
 		ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
 		defer cancel()
 
-		if _, err = s.db.Exec(ctx, sql, params...); err != nil {
+		if _, err = s.db.Exec(ctx, sql, append([]any{time.Now().UTC()}, params...)...); err != nil {
 			return false, fmt.Errorf("error removing favorite for client %d, album %d, image %s: %w",
 				clientID, albumID, key, err)
 		}
 	} else {
-		// Insert the favorite
+		if err = s.checkFavoriteLimit(clientID, albumID, []string{key}); err != nil {
+			return false, err
+		}
+
+		// Insert the favorite, or revive a previously soft-deleted one
 		sql = `
 INSERT INTO favorites (
     client_id,
     album_id,
-    image_path
-) VALUES (?, ?, ?)
+    image_path,
+    created_at
+) VALUES (?, ?, ?, ?)
+ON CONFLICT (client_id, album_id, image_path) DO UPDATE SET
+    created_at = excluded.created_at,
+    deleted_at = NULL
 `
 		ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
 		defer cancel()
 
-		if _, err = s.db.Exec(ctx, sql, params...); err != nil {
+		if _, err = s.db.Exec(ctx, sql, append(params, time.Now().UTC())...); err != nil {
 			return false, fmt.Errorf("error adding favorite for client %d, album %d, image %s: %w",
 				clientID, albumID, key, err)
 		}
@@ -215,3 +1302,356 @@ INSERT INTO favorites (
 
 	return exists, nil
 }
+
+/*
+escapeLike escapes the LIKE wildcard characters in a search term so they
+are matched literally.
+*/
+func escapeLike(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(value)
+}
+
+/*
+GetPurchased returns whether an album has been purchased. Unpurchased
+albums are shown with watermarked previews. Returns a not found error if
+the album doesn't exist.
+*/
+func (s AlbumService) GetPurchased(albumID uint) (bool, error) {
+	var (
+		err       error
+		purchased bool
+	)
+
+	sql := `
+SELECT
+   a.purchased
+FROM albums AS a
+WHERE 1=1
+   AND a.deleted_at IS NULL
+   AND a.id=?
+   `
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.QueryRow(ctx, &purchased, sql, albumID); err != nil {
+		if sqlz.IsNotFound(err) {
+			return false, notFound(ErrAlbumNotFound, "album %d not found", albumID)
+		}
+
+		return false, fmt.Errorf("error querying purchase status for album %d: %w", albumID, err)
+	}
+
+	return purchased, nil
+}
+
+/*
+SetPurchased marks an album as purchased or not. Until it is purchased,
+clients see watermarked previews and can't download its photos. Returns a
+not found error if the album doesn't exist.
+*/
+func (s AlbumService) SetPurchased(albumID uint, purchased bool) error {
+	var (
+		err        error
+		execResult stdsql.Result
+		affected   int64
+	)
+
+	sql := `
+UPDATE albums SET
+    purchased = ?,
+    updated_at = ?
+WHERE 1=1
+    AND id = ?
+    AND deleted_at IS NULL
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if execResult, err = s.db.Exec(ctx, sql, purchased, time.Now().UTC(), albumID); err != nil {
+		return fmt.Errorf("error setting purchase status for album %d: %w", albumID, err)
+	}
+
+	if affected, err = execResult.RowsAffected(); err != nil {
+		return fmt.Errorf("error checking purchase status update for album %d: %w", albumID, err)
+	}
+
+	if affected == 0 {
+		return notFound(ErrAlbumNotFound, "album %d not found", albumID)
+	}
+
+	return nil
+}
+
+/*
+SetMaxFavorites sets how many favorites a client may choose in an album.
+A NULL limit makes it unlimited. Favorites already over a new limit are
+kept, but no more can be added until the client is under it. Returns a not
+found error if the album doesn't exist.
+*/
+func (s AlbumService) SetMaxFavorites(albumID uint, maxFavorites stdsql.NullInt64) error {
+	var (
+		err        error
+		execResult stdsql.Result
+		affected   int64
+	)
+
+	if maxFavorites.Valid && maxFavorites.Int64 < 1 {
+		return fmt.Errorf("%w: the favorite limit must be at least 1, got %d", ErrInvalidInput, maxFavorites.Int64)
+	}
+
+	sql := `
+UPDATE albums SET
+    max_favorites = ?,
+    updated_at = ?
+WHERE 1=1
+    AND id = ?
+    AND deleted_at IS NULL
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if execResult, err = s.db.Exec(ctx, sql, maxFavorites, time.Now().UTC(), albumID); err != nil {
+		return fmt.Errorf("error setting favorite limit for album %d: %w", albumID, err)
+	}
+
+	if affected, err = execResult.RowsAffected(); err != nil {
+		return fmt.Errorf("error checking favorite limit update for album %d: %w", albumID, err)
+	}
+
+	if affected == 0 {
+		return notFound(ErrAlbumNotFound, "album %d not found", albumID)
+	}
+
+	return nil
+}
+
+/*
+CreateGallery adds a gallery for an existing client. Albums are put in it
+with SetAlbumGallery.
+*/
+func (s AlbumService) CreateGallery(request CreateGalleryRequest) (*models.Gallery, error) {
+	var (
+		err        error
+		id         int64
+		count      int
+		execResult stdsql.Result
+	)
+
+	request.Name = strings.TrimSpace(request.Name)
+
+	if request.ClientID == 0 {
+		return nil, fmt.Errorf("%w: client ID is required", ErrInvalidInput)
+	}
+
+	if request.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+
+	now := time.Now().UTC()
+
+	result := &models.Gallery{
+		BaseModel: models.BaseModel{
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		ClientID: request.ClientID,
+		Name:     request.Name,
+		Albums:   []*models.Album{},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	sql := `
+SELECT
+	COUNT(*)
+FROM clients
+WHERE 1=1
+	AND id=?
+	AND deleted_at IS NULL
+	`
+
+	if err = s.db.QueryRow(ctx, &count, sql, request.ClientID); err != nil {
+		return nil, fmt.Errorf("error checking for client %d: %w", request.ClientID, err)
+	}
+
+	if count == 0 {
+		return nil, fmt.Errorf("%w: client %d does not exist", ErrInvalidInput, request.ClientID)
+	}
+
+	sql = `
+INSERT INTO galleries (
+    created_at,
+    updated_at,
+    client_id,
+    name
+) VALUES (?, ?, ?, ?)
+`
+
+	if execResult, err = s.db.Exec(ctx, sql, result.CreatedAt, result.UpdatedAt, result.ClientID, result.Name); err != nil {
+		return nil, fmt.Errorf("error inserting gallery '%s' for client %d: %w", result.Name, result.ClientID, err)
+	}
+
+	if id, err = execResult.LastInsertId(); err != nil {
+		return nil, fmt.Errorf("error getting ID of new gallery '%s': %w", result.Name, err)
+	}
+
+	result.ID = uint(id)
+	return result, nil
+}
+
+/*
+SetAlbumGallery puts an album in a gallery, or takes it out of one when
+galleryID is NULL. The gallery must belong to the album's client. The
+error wraps ErrAlbumNotFound or ErrGalleryNotFound when either doesn't
+exist.
+*/
+func (s AlbumService) SetAlbumGallery(albumID uint, galleryID stdsql.NullInt64) error {
+	var (
+		err      error
+		clientID uint
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	sql := `
+SELECT
+	client_id
+FROM albums
+WHERE 1=1
+	AND id=?
+	AND deleted_at IS NULL
+	`
+
+	if err = s.db.QueryRow(ctx, &clientID, sql, albumID); err != nil {
+		if sqlz.IsNotFound(err) {
+			return notFound(ErrAlbumNotFound, "album %d not found", albumID)
+		}
+
+		return fmt.Errorf("error querying for client of album %d: %w", albumID, err)
+	}
+
+	if galleryID.Valid {
+		var galleryClientID uint
+
+		sql = `
+SELECT
+	client_id
+FROM galleries
+WHERE 1=1
+	AND id=?
+	AND deleted_at IS NULL
+	`
+
+		if err = s.db.QueryRow(ctx, &galleryClientID, sql, galleryID.Int64); err != nil {
+			if sqlz.IsNotFound(err) {
+				return notFound(ErrGalleryNotFound, "gallery %d not found", galleryID.Int64)
+			}
+
+			return fmt.Errorf("error querying for gallery %d: %w", galleryID.Int64, err)
+		}
+
+		if galleryClientID != clientID {
+			return fmt.Errorf("%w: gallery %d belongs to another client", ErrInvalidInput, galleryID.Int64)
+		}
+	}
+
+	sql = `
+UPDATE albums SET
+    gallery_id = ?,
+    updated_at = ?
+WHERE 1=1
+    AND id = ?
+    AND deleted_at IS NULL
+`
+
+	if _, err = s.db.Exec(ctx, sql, galleryID, time.Now().UTC(), albumID); err != nil {
+		return fmt.Errorf("error setting gallery for album %d: %w", albumID, err)
+	}
+
+	return nil
+}
+
+/*
+FavoriteLimitError is returned when favoriting would take a client past
+the number of favorites their album allows. It matches
+ErrFavoriteLimitReached.
+*/
+type FavoriteLimitError struct {
+	AlbumID uint
+	Limit   int
+}
+
+func (e FavoriteLimitError) Error() string {
+	return fmt.Sprintf("album %d allows at most %d favorites", e.AlbumID, e.Limit)
+}
+
+func (e FavoriteLimitError) Is(target error) bool {
+	return target == ErrFavoriteLimitReached
+}
+
+/*
+checkFavoriteLimit returns a FavoriteLimitError when favoriting keys would
+take the client past the album's MaxFavorites. Keys that are already
+favorites don't count against the limit, so favoriting them again is always
+allowed. Albums without a limit allow any number.
+*/
+func (s AlbumService) checkFavoriteLimit(clientID, albumID uint, keys []string) error {
+	var (
+		err   error
+		limit struct {
+			MaxFavorites stdsql.NullInt64 `db:"max_favorites"`
+			Favorites    int              `db:"favorites"`
+			Chosen       int              `db:"chosen"`
+		}
+	)
+
+	unique := map[string]bool{}
+	placeholders := make([]string, 0, len(keys))
+	params := []any{}
+
+	for _, key := range keys {
+		if !unique[key] {
+			unique[key] = true
+			placeholders = append(placeholders, "?")
+			params = append(params, key)
+		}
+	}
+
+	sql := `
+SELECT
+   a.max_favorites
+   , COUNT(f.image_path) AS favorites
+   , COUNT(CASE WHEN f.image_path IN (` + strings.Join(placeholders, ", ") + `) THEN 1 END) AS chosen
+FROM albums AS a
+   LEFT JOIN favorites AS f ON f.album_id=a.id AND f.client_id=? AND f.deleted_at IS NULL
+WHERE 1=1
+   AND a.deleted_at IS NULL
+   AND a.id=?
+GROUP BY a.id
+   `
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.QueryRow(ctx, &limit, sql, append(params, clientID, albumID)...); err != nil {
+		if sqlz.IsNotFound(err) {
+			return notFound(ErrAlbumNotFound, "album %d not found", albumID)
+		}
+
+		return fmt.Errorf("error checking favorite limit for album %d, client %d: %w", albumID, clientID, err)
+	}
+
+	adding := len(unique) - limit.Chosen
+
+	if limit.MaxFavorites.Valid && adding > 0 && limit.Favorites+adding > int(limit.MaxFavorites.Int64) {
+		return FavoriteLimitError{AlbumID: albumID, Limit: int(limit.MaxFavorites.Int64)}
+	}
+
+	return nil
+}
@@ -0,0 +1,863 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/rfberaldo/sqlz"
+)
+
+func albumNames(albums []*models.Album) []string {
+	result := []string{}
+
+	for _, album := range albums {
+		result = append(result, album.Name)
+	}
+
+	slices.Sort(result)
+	return result
+}
+
+func TestGetAlbumListLeavesOutExpiredAlbums(t *testing.T) {
+	db := newTestDB(t)
+	service := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	clientID := insertTestClient(t, db, "Jane")
+	shootDate := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	insertTestAlbum(t, db, clientID, "never expires", shootDate, nil)
+	insertTestAlbum(t, db, clientID, "expired time", shootDate, time.Now().Add(-time.Hour))
+	insertTestAlbum(t, db, clientID, "future time", shootDate, time.Now().Add(time.Hour))
+	insertTestAlbum(t, db, clientID, "expired local time", shootDate, time.Now().Add(-time.Minute).In(time.FixedZone("EST", -5*60*60)))
+	insertTestAlbum(t, db, clientID, "expired date", shootDate, "2000-01-01")
+	insertTestAlbum(t, db, clientID, "future date", shootDate, "2999-12-31")
+
+	albums, err := service.GetAlbumList(clientID)
+	if err != nil {
+		t.Fatalf("GetAlbumList returned an error: %v", err)
+	}
+
+	want := []string{"future date", "future time", "never expires"}
+
+	if got := albumNames(albums); !slices.Equal(got, want) {
+		t.Errorf("albums = %v, want %v", got, want)
+	}
+
+	searched, err := service.SearchAlbums(clientID, AlbumFilter{Name: "e"})
+	if err != nil {
+		t.Fatalf("SearchAlbums returned an error: %v", err)
+	}
+
+	if got := albumNames(searched); !slices.Equal(got, want) {
+		t.Errorf("searched albums = %v, want %v", got, want)
+	}
+}
+
+func TestSearchAlbums(t *testing.T) {
+	db := newTestDB(t)
+	service := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	clientID := insertTestClient(t, db, "Jane")
+	otherClientID := insertTestClient(t, db, "John")
+
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2024, month, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	insertTestAlbum(t, db, clientID, "Spring Wedding", day(time.April, 20), nil)
+	insertTestAlbum(t, db, clientID, "Summer Family", day(time.June, 1), nil)
+	insertTestAlbum(t, db, clientID, "Summer Wedding", day(time.July, 15), nil)
+	insertTestAlbum(t, db, clientID, "100% Candid", day(time.August, 3), nil)
+	insertTestAlbum(t, db, clientID, "Fall_Portraits", day(time.October, 31), nil)
+	insertTestAlbum(t, db, otherClientID, "Summer Wedding", day(time.July, 15), nil)
+
+	tests := []struct {
+		name   string
+		filter AlbumFilter
+		want   []string
+	}{
+		{
+			name:   "empty filter lists everything",
+			filter: AlbumFilter{},
+			want:   []string{"100% Candid", "Fall_Portraits", "Spring Wedding", "Summer Family", "Summer Wedding"},
+		},
+		{
+			name:   "name is a case insensitive substring",
+			filter: AlbumFilter{Name: "wedding"},
+			want:   []string{"Spring Wedding", "Summer Wedding"},
+		},
+		{
+			name:   "percent is matched literally",
+			filter: AlbumFilter{Name: "%"},
+			want:   []string{"100% Candid"},
+		},
+		{
+			name:   "underscore is matched literally",
+			filter: AlbumFilter{Name: "_"},
+			want:   []string{"Fall_Portraits"},
+		},
+		{
+			name:   "date range includes both ends",
+			filter: AlbumFilter{From: day(time.June, 1), To: day(time.August, 3)},
+			want:   []string{"100% Candid", "Summer Family", "Summer Wedding"},
+		},
+		{
+			name:   "from only",
+			filter: AlbumFilter{From: day(time.August, 1)},
+			want:   []string{"100% Candid", "Fall_Portraits"},
+		},
+		{
+			name:   "to only",
+			filter: AlbumFilter{To: day(time.June, 1)},
+			want:   []string{"Spring Wedding", "Summer Family"},
+		},
+		{
+			name:   "name and date range combined",
+			filter: AlbumFilter{Name: "summer", From: day(time.July, 1), To: day(time.December, 31)},
+			want:   []string{"Summer Wedding"},
+		},
+		{
+			name:   "nothing matches",
+			filter: AlbumFilter{Name: "graduation"},
+			want:   []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			albums, err := service.SearchAlbums(clientID, tt.filter)
+			if err != nil {
+				t.Fatalf("SearchAlbums returned an error: %v", err)
+			}
+
+			if got := albumNames(albums); !slices.Equal(got, tt.want) {
+				t.Errorf("albums = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func favoritePaths(t *testing.T, service AlbumService, clientID, albumID uint) []string {
+	t.Helper()
+
+	favorites, err := service.GetFavorites(clientID, albumID)
+	if err != nil {
+		t.Fatalf("GetFavorites returned an error: %v", err)
+	}
+
+	result := []string{}
+
+	for _, favorite := range favorites {
+		result = append(result, favorite.ImagePath)
+	}
+
+	return result
+}
+
+func TestSetFavorites(t *testing.T) {
+	db := newTestDB(t)
+	service := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	clientID := insertTestClient(t, db, "Jane")
+	albumID := insertTestAlbum(t, db, clientID, "Wedding", time.Now(), nil)
+
+	if err := service.SetFavorites(clientID, albumID, []string{"a.jpg", "b.jpg"}, true); err != nil {
+		t.Fatalf("batch add returned an error: %v", err)
+	}
+
+	if got, want := favoritePaths(t, service, clientID, albumID), []string{"a.jpg", "b.jpg"}; !slices.Equal(got, want) {
+		t.Fatalf("after batch add favorites = %v, want %v", got, want)
+	}
+
+	before, err := service.GetFavorites(clientID, albumID)
+	if err != nil {
+		t.Fatalf("GetFavorites returned an error: %v", err)
+	}
+
+	// a.jpg is already a favorite, c.jpg is new
+	if err = service.SetFavorites(clientID, albumID, []string{"a.jpg", "c.jpg"}, true); err != nil {
+		t.Fatalf("mixed add returned an error: %v", err)
+	}
+
+	after, err := service.GetFavorites(clientID, albumID)
+	if err != nil {
+		t.Fatalf("GetFavorites returned an error: %v", err)
+	}
+
+	if got, want := favoritePaths(t, service, clientID, albumID), []string{"a.jpg", "b.jpg", "c.jpg"}; !slices.Equal(got, want) {
+		t.Fatalf("after mixed add favorites = %v, want %v", got, want)
+	}
+
+	if !after[0].CreatedAt.Equal(before[0].CreatedAt) {
+		t.Errorf("re-favoriting a.jpg changed when it was favorited from %v to %v", before[0].CreatedAt, after[0].CreatedAt)
+	}
+
+	// d.jpg was never a favorite
+	if err = service.SetFavorites(clientID, albumID, []string{"a.jpg", "c.jpg", "d.jpg"}, false); err != nil {
+		t.Fatalf("batch remove returned an error: %v", err)
+	}
+
+	if got, want := favoritePaths(t, service, clientID, albumID), []string{"b.jpg"}; !slices.Equal(got, want) {
+		t.Fatalf("after batch remove favorites = %v, want %v", got, want)
+	}
+
+	if err = service.SetFavorites(clientID, albumID, nil, true); err != nil {
+		t.Errorf("empty batch returned an error: %v", err)
+	}
+}
+
+func TestCountFavorites(t *testing.T) {
+	db := newTestDB(t)
+	service := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	clientID := insertTestClient(t, db, "Jane")
+	albumID := insertTestAlbum(t, db, clientID, "Wedding", time.Now(), nil)
+
+	count := func() int {
+		t.Helper()
+
+		result, err := service.CountFavorites(clientID, albumID)
+		if err != nil {
+			t.Fatalf("CountFavorites returned an error: %v", err)
+		}
+
+		return result
+	}
+
+	if got := count(); got != 0 {
+		t.Errorf("count with no favorites = %d, want 0", got)
+	}
+
+	if err := service.SetFavorites(clientID, albumID, []string{"a.jpg", "b.jpg", "c.jpg"}, true); err != nil {
+		t.Fatalf("SetFavorites returned an error: %v", err)
+	}
+
+	if err := service.SetFavorites(clientID, albumID, []string{"c.jpg"}, false); err != nil {
+		t.Fatalf("SetFavorites returned an error: %v", err)
+	}
+
+	if got := count(); got != 2 {
+		t.Errorf("count = %d, want 2", got)
+	}
+}
+
+func TestToggleAndRestoreFavorite(t *testing.T) {
+	db := newTestDB(t)
+	service := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	clientID := insertTestClient(t, db, "Jane")
+	albumID := insertTestAlbum(t, db, clientID, "Wedding", time.Now(), nil)
+
+	before := time.Now().UTC().Add(-time.Second)
+
+	// ToggleFavorite reports whether the image was a favorite before the toggle
+	existed, err := service.ToggleFavorite(clientID, albumID, "a.jpg")
+	if err != nil || existed {
+		t.Fatalf("first toggle = %v, %v; want false, nil", existed, err)
+	}
+
+	favorites, err := service.GetFavorites(clientID, albumID)
+	if err != nil || len(favorites) != 1 {
+		t.Fatalf("favorites = %+v, %v; want one favorite", favorites, err)
+	}
+
+	favoritedAt := favorites[0].CreatedAt
+
+	if favoritedAt.Before(before) {
+		t.Errorf("favorited at %v, want a time after %v", favoritedAt, before)
+	}
+
+	if existed, err = service.ToggleFavorite(clientID, albumID, "a.jpg"); err != nil || !existed {
+		t.Fatalf("second toggle = %v, %v; want true, nil", existed, err)
+	}
+
+	if got := favoritePaths(t, service, clientID, albumID); len(got) != 0 {
+		t.Fatalf("favorites after un-favoriting = %v, want none", got)
+	}
+
+	var stored int
+
+	if err = db.QueryRow(context.Background(), &stored, `SELECT COUNT(*) FROM favorites WHERE image_path='a.jpg' AND deleted_at IS NOT NULL`); err != nil || stored != 1 {
+		t.Fatalf("soft-deleted rows = %d, %v; want 1", stored, err)
+	}
+
+	if err = service.RestoreFavorite(clientID, albumID, "a.jpg"); err != nil {
+		t.Fatalf("RestoreFavorite returned an error: %v", err)
+	}
+
+	favorites, err = service.GetFavorites(clientID, albumID)
+	if err != nil || len(favorites) != 1 {
+		t.Fatalf("favorites after restore = %+v, %v; want one favorite", favorites, err)
+	}
+
+	if !favorites[0].CreatedAt.Equal(favoritedAt) {
+		t.Errorf("restored favorite was favorited at %v, want the original %v", favorites[0].CreatedAt, favoritedAt)
+	}
+}
+
+func TestGetAllFavoritesForClient(t *testing.T) {
+	db := newTestDB(t)
+	service := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	jane := insertTestClient(t, db, "Jane")
+	john := insertTestClient(t, db, "John")
+	wedding := insertTestAlbum(t, db, jane, "Wedding", time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC), nil)
+	engagement := insertTestAlbum(t, db, jane, "Engagement", time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), nil)
+	deleted := insertTestAlbum(t, db, jane, "Deleted", time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), nil)
+	johns := insertTestAlbum(t, db, john, "Birthday", time.Now(), nil)
+
+	if err := service.SetFavorites(jane, wedding, []string{"b.jpg", "a.jpg", "removed.jpg"}, true); err != nil {
+		t.Fatalf("SetFavorites returned an error: %v", err)
+	}
+
+	if err := service.SetFavorites(jane, wedding, []string{"removed.jpg"}, false); err != nil {
+		t.Fatalf("SetFavorites returned an error: %v", err)
+	}
+
+	for albumID, clientID := range map[uint]uint{engagement: jane, deleted: jane, johns: john} {
+		if _, err := service.ToggleFavorite(clientID, albumID, "c.jpg"); err != nil {
+			t.Fatalf("ToggleFavorite returned an error: %v", err)
+		}
+	}
+
+	if err := service.DeleteAlbum(jane, deleted); err != nil {
+		t.Fatalf("DeleteAlbum returned an error: %v", err)
+	}
+
+	favorites, err := service.GetAllFavoritesForClient(jane)
+	if err != nil {
+		t.Fatalf("GetAllFavoritesForClient returned an error: %v", err)
+	}
+
+	got := []string{}
+
+	for _, favorite := range favorites {
+		got = append(got, favorite.AlbumName+"/"+favorite.ImagePath)
+
+		if favorite.CreatedAt.IsZero() {
+			t.Errorf("favorite %s/%s has no favorited time", favorite.AlbumName, favorite.ImagePath)
+		}
+	}
+
+	if want := []string{"Wedding/a.jpg", "Wedding/b.jpg", "Engagement/c.jpg"}; !slices.Equal(got, want) {
+		t.Errorf("favorites = %v, want %v", got, want)
+	}
+}
+
+func TestFavoriteLimit(t *testing.T) {
+	db := newTestDB(t)
+	service := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	clientID := insertTestClient(t, db, "Jane")
+	albumID := insertTestAlbum(t, db, clientID, "Wedding", time.Now(), nil)
+
+	if err := service.SetMaxFavorites(albumID, sql.NullInt64{Int64: 0, Valid: true}); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("limit of 0: error = %v, want %v", err, ErrInvalidInput)
+	}
+
+	if err := service.SetMaxFavorites(albumID, sql.NullInt64{Int64: 2, Valid: true}); err != nil {
+		t.Fatalf("SetMaxFavorites returned an error: %v", err)
+	}
+
+	album, err := service.GetAlbumByID(albumID)
+	if err != nil || album.MaxFavorites != (sql.NullInt64{Int64: 2, Valid: true}) {
+		t.Fatalf("album favorite limit = %+v, %v; want 2", album.MaxFavorites, err)
+	}
+
+	if _, err = service.ToggleFavorite(clientID, albumID, "a.jpg"); err != nil {
+		t.Fatalf("first favorite returned an error: %v", err)
+	}
+
+	// Three new favorites would go past the limit, so none are added
+	if err = service.SetFavorites(clientID, albumID, []string{"a.jpg", "b.jpg", "c.jpg"}, true); !errors.Is(err, ErrFavoriteLimitReached) {
+		t.Fatalf("batch past the limit: error = %v, want %v", err, ErrFavoriteLimitReached)
+	}
+
+	if got, want := favoritePaths(t, service, clientID, albumID), []string{"a.jpg"}; !slices.Equal(got, want) {
+		t.Fatalf("after batch past the limit favorites = %v, want %v", got, want)
+	}
+
+	// a.jpg is already a favorite, so only b.jpg counts against the limit
+	if err = service.SetFavorites(clientID, albumID, []string{"a.jpg", "b.jpg", "b.jpg"}, true); err != nil {
+		t.Fatalf("batch up to the limit returned an error: %v", err)
+	}
+
+	_, err = service.ToggleFavorite(clientID, albumID, "c.jpg")
+	limitErr := FavoriteLimitError{}
+
+	if !errors.As(err, &limitErr) || limitErr.Limit != 2 {
+		t.Fatalf("favorite past the limit: error = %v, want a FavoriteLimitError with a limit of 2", err)
+	}
+
+	if err = service.SetFavorites(clientID, albumID, []string{"a.jpg"}, true); err != nil {
+		t.Errorf("re-favoriting at the limit returned an error: %v", err)
+	}
+
+	// Un-favoriting makes room again
+	if _, err = service.ToggleFavorite(clientID, albumID, "a.jpg"); err != nil {
+		t.Fatalf("un-favoriting returned an error: %v", err)
+	}
+
+	if _, err = service.ToggleFavorite(clientID, albumID, "c.jpg"); err != nil {
+		t.Fatalf("favorite after making room returned an error: %v", err)
+	}
+
+	if err = service.RestoreFavorite(clientID, albumID, "a.jpg"); !errors.Is(err, ErrFavoriteLimitReached) {
+		t.Fatalf("restore past the limit: error = %v, want %v", err, ErrFavoriteLimitReached)
+	}
+
+	if err = service.SetMaxFavorites(albumID, sql.NullInt64{}); err != nil {
+		t.Fatalf("removing the limit returned an error: %v", err)
+	}
+
+	if err = service.RestoreFavorite(clientID, albumID, "a.jpg"); err != nil {
+		t.Errorf("restore without a limit returned an error: %v", err)
+	}
+
+	if got, want := favoritePaths(t, service, clientID, albumID), []string{"a.jpg", "b.jpg", "c.jpg"}; !slices.Equal(got, want) {
+		t.Errorf("favorites = %v, want %v", got, want)
+	}
+}
+
+func TestAddAndGetComments(t *testing.T) {
+	db := newTestDB(t)
+	service := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	jane := insertTestClient(t, db, "Jane")
+	john := insertTestClient(t, db, "John")
+	albumID := insertTestAlbum(t, db, jane, "Wedding", time.Now(), nil)
+
+	first, err := service.AddComment(jane, albumID, "a.jpg", "  please retouch this one  ")
+	if err != nil {
+		t.Fatalf("AddComment returned an error: %v", err)
+	}
+
+	if first.ID == 0 || first.Body != "please retouch this one" {
+		t.Errorf("comment = %+v, want an ID and a trimmed body", first)
+	}
+
+	if _, err = service.AddComment(jane, albumID, "b.jpg", "<script>alert(1)</script>\x00\x07 and\nthis"); err != nil {
+		t.Fatalf("AddComment returned an error: %v", err)
+	}
+
+	if _, err = service.AddComment(jane, albumID, "a.jpg", " \x00 \t "); !errors.Is(err, ErrEmptyComment) {
+		t.Errorf("blank comment: error = %v, want %v", err, ErrEmptyComment)
+	}
+
+	long, err := service.AddComment(jane, albumID, "a.jpg", strings.Repeat("é", maxCommentLength+10))
+	if err != nil {
+		t.Fatalf("AddComment returned an error: %v", err)
+	}
+
+	if got := len([]rune(long.Body)); got != maxCommentLength {
+		t.Errorf("long comment kept %d characters, want %d", got, maxCommentLength)
+	}
+
+	comments, err := service.GetComments(jane, albumID)
+	if err != nil {
+		t.Fatalf("GetComments returned an error: %v", err)
+	}
+
+	if len(comments) != 3 {
+		t.Fatalf("got %d comments, want 3", len(comments))
+	}
+
+	// Stored as plain text. Templates escape it when rendering.
+	if comments[1].ImagePath != "b.jpg" || comments[1].Body != "<script>alert(1)</script> and\nthis" {
+		t.Errorf("second comment = %+v, want the HTML kept as text without control characters", comments[1])
+	}
+
+	if others, _ := service.GetComments(john, albumID); len(others) != 0 {
+		t.Errorf("another client sees %d comments, want none", len(others))
+	}
+
+	album, err := service.GetAlbum(jane, albumID)
+	if err != nil {
+		t.Fatalf("GetAlbum returned an error: %v", err)
+	}
+
+	if len(album.Comments) != 3 {
+		t.Errorf("album has %d comments, want 3", len(album.Comments))
+	}
+}
+
+func TestCreateAlbum(t *testing.T) {
+	db := newTestDB(t)
+	service := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	clientID := insertTestClient(t, db, "Jane")
+
+	album, err := service.Create(CreateAlbumRequest{ClientID: clientID, Name: " Wedding ", ShootDate: "2024-06-01", ExpiresAt: "2099-01-01"})
+	if err != nil {
+		t.Fatalf("Create returned an error: %v", err)
+	}
+
+	if album.ID == 0 || album.Name != "Wedding" || !album.ExpiresAt.Valid {
+		t.Errorf("album = %+v, want an ID, a trimmed name, and an expiration", album)
+	}
+
+	stored, err := service.GetAlbum(clientID, album.ID)
+	if err != nil {
+		t.Fatalf("GetAlbum returned an error: %v", err)
+	}
+
+	if stored.Name != "Wedding" || stored.ShootDate.Format(time.DateOnly) != "2024-06-01" {
+		t.Errorf("stored album = %+v, want the created one", stored)
+	}
+
+	tests := []struct {
+		name    string
+		request CreateAlbumRequest
+	}{
+		{name: "missing client", request: CreateAlbumRequest{Name: "Wedding", ShootDate: "2024-06-01"}},
+		{name: "unknown client", request: CreateAlbumRequest{ClientID: clientID + 100, Name: "Wedding", ShootDate: "2024-06-01"}},
+		{name: "missing name", request: CreateAlbumRequest{ClientID: clientID, ShootDate: "2024-06-01"}},
+		{name: "bad shoot date", request: CreateAlbumRequest{ClientID: clientID, Name: "Wedding", ShootDate: "June 1st"}},
+		{name: "bad expiration", request: CreateAlbumRequest{ClientID: clientID, Name: "Wedding", ShootDate: "2024-06-01", ExpiresAt: "soon"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.Create(tt.request); !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("error = %v, want %v", err, ErrInvalidInput)
+			}
+		})
+	}
+}
+
+func TestSetAndGetImageOrder(t *testing.T) {
+	db := newTestDB(t)
+	service := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	clientID := insertTestClient(t, db, "Jane")
+	albumID := insertTestAlbum(t, db, clientID, "Wedding", time.Now(), nil)
+
+	paths := func() []string {
+		order, err := service.GetImageOrder(albumID)
+		if err != nil {
+			t.Fatalf("GetImageOrder returned an error: %v", err)
+		}
+
+		result := []string{}
+
+		for _, o := range order {
+			result = append(result, o.ImagePath)
+		}
+
+		return result
+	}
+
+	if got := paths(); len(got) != 0 {
+		t.Errorf("order of a new album = %v, want none", got)
+	}
+
+	if err := service.SetImageOrder(albumID, []string{"c.jpg", "a.jpg", "b.jpg"}); err != nil {
+		t.Fatalf("SetImageOrder returned an error: %v", err)
+	}
+
+	if got := paths(); !slices.Equal(got, []string{"c.jpg", "a.jpg", "b.jpg"}) {
+		t.Errorf("order = %v, want c.jpg, a.jpg, b.jpg", got)
+	}
+
+	// Setting the order again replaces it rather than adding to it
+	if err := service.SetImageOrder(albumID, []string{"b.jpg"}); err != nil {
+		t.Fatalf("SetImageOrder returned an error: %v", err)
+	}
+
+	if got := paths(); !slices.Equal(got, []string{"b.jpg"}) {
+		t.Errorf("order = %v, want only b.jpg", got)
+	}
+
+	album, err := service.GetAlbum(clientID, albumID)
+	if err != nil {
+		t.Fatalf("GetAlbum returned an error: %v", err)
+	}
+
+	if len(album.ImageOrder) != 1 || album.ImageOrder[0].ImagePath != "b.jpg" {
+		t.Errorf("album.ImageOrder = %+v, want the stored order", album.ImageOrder)
+	}
+
+	if err := service.SetImageOrder(albumID, nil); err != nil {
+		t.Fatalf("clearing the order returned an error: %v", err)
+	}
+
+	if got := paths(); len(got) != 0 {
+		t.Errorf("order after clearing = %v, want none", got)
+	}
+}
+
+func TestDeleteAlbum(t *testing.T) {
+	db := newTestDB(t)
+	service := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	clientID := insertTestClient(t, db, "Jane")
+	otherClientID := insertTestClient(t, db, "John")
+	albumID := insertTestAlbum(t, db, clientID, "Wedding", time.Now(), nil)
+	keptID := insertTestAlbum(t, db, clientID, "Engagement", time.Now(), nil)
+
+	// Another client can't delete the album
+	if err := service.DeleteAlbum(otherClientID, albumID); !sqlz.IsNotFound(err) {
+		t.Fatalf("DeleteAlbum by another client = %v, want not found", err)
+	}
+
+	if err := service.DeleteAlbum(clientID, albumID); err != nil {
+		t.Fatalf("DeleteAlbum returned an error: %v", err)
+	}
+
+	// The row is kept with deleted_at set
+	var deletedAt sql.NullTime
+
+	if err := db.QueryRow(context.Background(), &deletedAt, `SELECT deleted_at FROM albums WHERE id=?`, albumID); err != nil || !deletedAt.Valid {
+		t.Errorf("deleted_at = %+v, %v; want it set", deletedAt, err)
+	}
+
+	if _, err := service.GetAlbum(clientID, albumID); !sqlz.IsNotFound(err) {
+		t.Errorf("GetAlbum after delete = %v, want not found", err)
+	}
+
+	if _, err := service.GetAlbumByID(albumID); !sqlz.IsNotFound(err) {
+		t.Errorf("GetAlbumByID after delete = %v, want not found", err)
+	}
+
+	albums, err := service.GetAlbumList(clientID)
+	if err != nil {
+		t.Fatalf("GetAlbumList returned an error: %v", err)
+	}
+
+	if len(albums) != 1 || albums[0].ID != keptID {
+		t.Errorf("albums = %v, want only Engagement", albumNames(albums))
+	}
+
+	// Deleting twice is not found
+	if err := service.DeleteAlbum(clientID, albumID); !sqlz.IsNotFound(err) {
+		t.Errorf("second DeleteAlbum = %v, want not found", err)
+	}
+}
+
+func TestSetAndGetDownloadPermission(t *testing.T) {
+	db := newTestDB(t)
+	service := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	clientID := insertTestClient(t, db, "Jane")
+	albumID := insertTestAlbum(t, db, clientID, "Wedding", time.Now(), nil)
+
+	// Albums from before the setting existed can be downloaded
+	if allowed, err := service.GetDownloadPermission(albumID); err != nil || !allowed {
+		t.Fatalf("GetDownloadPermission = %v, %v; want true", allowed, err)
+	}
+
+	if err := service.SetDownloadPermission(albumID, false); err != nil {
+		t.Fatalf("SetDownloadPermission returned an error: %v", err)
+	}
+
+	if allowed, err := service.GetDownloadPermission(albumID); err != nil || allowed {
+		t.Errorf("GetDownloadPermission = %v, %v; want false", allowed, err)
+	}
+
+	album, err := service.GetAlbum(clientID, albumID)
+	if err != nil {
+		t.Fatalf("GetAlbum returned an error: %v", err)
+	}
+
+	if album.AllowDownload {
+		t.Errorf("GetAlbum AllowDownload = true, want false")
+	}
+
+	albums, err := service.GetAlbumList(clientID)
+	if err != nil {
+		t.Fatalf("GetAlbumList returned an error: %v", err)
+	}
+
+	if len(albums) != 1 || albums[0].AllowDownload {
+		t.Errorf("GetAlbumList = %+v, want Wedding with downloads off", albums)
+	}
+
+	if err = service.SetDownloadPermission(999, true); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("SetDownloadPermission on a missing album = %v, want %v", err, ErrAlbumNotFound)
+	}
+
+	if _, err = service.GetDownloadPermission(999); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("GetDownloadPermission on a missing album = %v, want %v", err, ErrAlbumNotFound)
+	}
+}
+
+func TestSetAndGetPurchased(t *testing.T) {
+	db := newTestDB(t)
+	service := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	clientID := insertTestClient(t, db, "Jane")
+	albumID := insertTestAlbum(t, db, clientID, "Wedding", time.Now(), nil)
+
+	// Albums from before proofing existed count as purchased
+	if purchased, err := service.GetPurchased(albumID); err != nil || !purchased {
+		t.Fatalf("GetPurchased = %v, %v; want true", purchased, err)
+	}
+
+	if err := service.SetPurchased(albumID, false); err != nil {
+		t.Fatalf("SetPurchased returned an error: %v", err)
+	}
+
+	if purchased, err := service.GetPurchased(albumID); err != nil || purchased {
+		t.Errorf("GetPurchased = %v, %v; want false", purchased, err)
+	}
+
+	// Downloads stay turned on but an unpurchased album can't be downloaded
+	if allowed, err := service.GetDownloadPermission(albumID); err != nil || allowed {
+		t.Errorf("GetDownloadPermission = %v, %v; want false until purchased", allowed, err)
+	}
+
+	album, err := service.GetAlbum(clientID, albumID)
+	if err != nil {
+		t.Fatalf("GetAlbum returned an error: %v", err)
+	}
+
+	if album.Purchased || album.CanDownload() {
+		t.Errorf("GetAlbum Purchased = %v, CanDownload = %v; want both false", album.Purchased, album.CanDownload())
+	}
+
+	if err = service.SetPurchased(albumID, true); err != nil {
+		t.Fatalf("SetPurchased returned an error: %v", err)
+	}
+
+	if allowed, err := service.GetDownloadPermission(albumID); err != nil || !allowed {
+		t.Errorf("GetDownloadPermission = %v, %v; want true once purchased", allowed, err)
+	}
+
+	if err = service.SetPurchased(999, true); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("SetPurchased on a missing album = %v, want %v", err, ErrAlbumNotFound)
+	}
+
+	if _, err = service.GetPurchased(999); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("GetPurchased on a missing album = %v, want %v", err, ErrAlbumNotFound)
+	}
+}
+
+func galleryNames(galleries []models.Gallery) []string {
+	result := []string{}
+
+	for _, gallery := range galleries {
+		result = append(result, gallery.Name)
+	}
+
+	return result
+}
+
+func TestGalleries(t *testing.T) {
+	db := newTestDB(t)
+	service := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	jane := insertTestClient(t, db, "Jane")
+	john := insertTestClient(t, db, "John")
+	day := func(d int) time.Time { return time.Date(2024, 6, d, 0, 0, 0, 0, time.UTC) }
+
+	ceremony := insertTestAlbum(t, db, jane, "Ceremony", day(1), nil)
+	reception := insertTestAlbum(t, db, jane, "Reception", day(2), nil)
+	headshots := insertTestAlbum(t, db, jane, "Headshots", day(20), nil)
+	engagement := insertTestAlbum(t, db, jane, "Engagement", day(10), nil)
+	johnAlbum := insertTestAlbum(t, db, john, "Graduation", day(5), nil)
+
+	create := func(clientID uint, name string) uint {
+		t.Helper()
+
+		gallery, err := service.CreateGallery(CreateGalleryRequest{ClientID: clientID, Name: name})
+		if err != nil {
+			t.Fatalf("CreateGallery(%q) returned an error: %v", name, err)
+		}
+
+		return gallery.ID
+	}
+
+	wedding := create(jane, "Wedding")
+	portraits := create(jane, "Portraits")
+	create(jane, "Anniversary")
+	johnGallery := create(john, "Graduation")
+
+	assign := func(albumID, galleryID uint) {
+		t.Helper()
+
+		if err := service.SetAlbumGallery(albumID, sql.NullInt64{Int64: int64(galleryID), Valid: true}); err != nil {
+			t.Fatalf("SetAlbumGallery(%d, %d) returned an error: %v", albumID, galleryID, err)
+		}
+	}
+
+	assign(ceremony, wedding)
+	assign(reception, wedding)
+	assign(headshots, portraits)
+	assign(engagement, portraits)
+
+	// Engagement is taken back out of its gallery
+	if err := service.SetAlbumGallery(engagement, sql.NullInt64{}); err != nil {
+		t.Fatalf("SetAlbumGallery to clear returned an error: %v", err)
+	}
+
+	galleries, err := service.GetGalleries(jane)
+	if err != nil {
+		t.Fatalf("GetGalleries returned an error: %v", err)
+	}
+
+	// Newest album first, then empty galleries, then the ungrouped albums
+	if got, want := galleryNames(galleries), []string{"Portraits", "Wedding", "Anniversary", ""}; !slices.Equal(got, want) {
+		t.Fatalf("galleries = %v, want %v", got, want)
+	}
+
+	wantAlbums := [][]string{{"Headshots"}, {"Reception", "Ceremony"}, {}, {"Engagement"}}
+
+	for i, gallery := range galleries {
+		if got := albumNames(gallery.Albums); !slices.Equal(got, wantAlbums[i]) {
+			t.Errorf("gallery %q albums = %v, want %v", gallery.Name, got, wantAlbums[i])
+		}
+	}
+
+	if !galleries[3].IsUngrouped() || galleries[2].IsUngrouped() {
+		t.Errorf("IsUngrouped = %v for %q and %v for %q, want only the last to be ungrouped", galleries[2].IsUngrouped(), galleries[2].Name, galleries[3].IsUngrouped(), galleries[3].Name)
+	}
+
+	// Searching keeps every gallery but only the matching albums
+	galleries, err = service.SearchGalleries(jane, AlbumFilter{Name: "cer"})
+	if err != nil {
+		t.Fatalf("SearchGalleries returned an error: %v", err)
+	}
+
+	if got, want := galleryNames(galleries), []string{"Wedding", "Anniversary", "Portraits"}; !slices.Equal(got, want) {
+		t.Errorf("searched galleries = %v, want %v with no ungrouped albums", got, want)
+	}
+
+	if got := albumNames(galleries[0].Albums); !slices.Equal(got, []string{"Ceremony"}) {
+		t.Errorf("searched Wedding albums = %v, want [Ceremony]", got)
+	}
+
+	// Albums only go in their own client's galleries
+	if err = service.SetAlbumGallery(johnAlbum, sql.NullInt64{Int64: int64(wedding), Valid: true}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("SetAlbumGallery into another client's gallery = %v, want ErrInvalidInput", err)
+	}
+
+	if err = service.SetAlbumGallery(johnAlbum, sql.NullInt64{Int64: 999, Valid: true}); !errors.Is(err, ErrGalleryNotFound) {
+		t.Errorf("SetAlbumGallery into a missing gallery = %v, want ErrGalleryNotFound", err)
+	}
+
+	if err = service.SetAlbumGallery(999, sql.NullInt64{Int64: int64(johnGallery), Valid: true}); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("SetAlbumGallery for a missing album = %v, want ErrAlbumNotFound", err)
+	}
+
+	// A client with no galleries only gets ungrouped albums
+	newClient := insertTestClient(t, db, "Ann")
+	insertTestAlbum(t, db, newClient, "Family", day(3), nil)
+
+	if galleries, err = service.GetGalleries(newClient); err != nil || len(galleries) != 1 || !galleries[0].IsUngrouped() || len(galleries[0].Albums) != 1 {
+		t.Errorf("GetGalleries for a client without galleries = %+v, %v; want one ungrouped album", galleries, err)
+	}
+
+	if _, err = service.CreateGallery(CreateGalleryRequest{ClientID: jane, Name: "  "}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("CreateGallery without a name = %v, want ErrInvalidInput", err)
+	}
+
+	if _, err = service.CreateGallery(CreateGalleryRequest{ClientID: 999, Name: "Nope"}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("CreateGallery for a missing client = %v, want ErrInvalidInput", err)
+	}
+}
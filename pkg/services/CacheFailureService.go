@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/rfberaldo/sqlz"
+)
+
+type CacheFailureServicer interface {
+	Clear(key string) error
+	List() ([]models.CacheFailure, error)
+	Record(key string, lastModified time.Time, failure error) error
+}
+
+type CacheFailureServiceConfig struct {
+	DB *sqlz.DB
+}
+
+type CacheFailureService struct {
+	db *sqlz.DB
+}
+
+func NewCacheFailureService(config CacheFailureServiceConfig) CacheFailureService {
+	return CacheFailureService{
+		db: config.DB,
+	}
+}
+
+/*
+Clear removes the failure record for an original, if there is one.
+*/
+func (s CacheFailureService) Clear(key string) error {
+	var (
+		err error
+	)
+
+	sql := `DELETE FROM cache_failures WHERE "key"=?`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if _, err = s.db.Exec(ctx, sql, key); err != nil {
+		return fmt.Errorf("error clearing cache failure for '%s': %w", key, err)
+	}
+
+	return nil
+}
+
+/*
+List returns every original that failed to cache, most recent first.
+*/
+func (s CacheFailureService) List() ([]models.CacheFailure, error) {
+	var (
+		err      error
+		failures []models.CacheFailure
+	)
+
+	sql := `
+SELECT
+   cf."key"
+   , cf.error
+   , cf.last_modified
+   , cf.created_at
+   , cf.updated_at
+FROM cache_failures AS cf
+ORDER BY cf.updated_at DESC
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.Query(ctx, &failures, sql); err != nil {
+		return nil, fmt.Errorf("error querying for cache failures: %w", err)
+	}
+
+	return failures, nil
+}
+
+/*
+Record stores a failure for an original. lastModified is the original's
+LastModified at the time of the failure, and is used to tell when the
+original has been replaced.
+*/
+func (s CacheFailureService) Record(key string, lastModified time.Time, failure error) error {
+	var (
+		err error
+	)
+
+	sql := `
+INSERT INTO cache_failures (
+    "key",
+    error,
+    last_modified,
+    created_at,
+    updated_at
+) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT ("key") DO UPDATE SET
+    error = excluded.error,
+    last_modified = excluded.last_modified,
+    updated_at = excluded.updated_at
+`
+
+	now := time.Now().UTC()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if _, err = s.db.Exec(ctx, sql, key, failure.Error(), lastModified.UTC(), now, now); err != nil {
+		return fmt.Errorf("error recording cache failure for '%s': %w", key, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCacheFailureService(t *testing.T) {
+	db := newTestDB(t)
+	service := NewCacheFailureService(CacheFailureServiceConfig{DB: db})
+
+	first := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	second := first.Add(time.Hour)
+
+	if err := service.Record("clients/1/2/originals/a.jpg", first, errors.New("bad header")); err != nil {
+		t.Fatalf("Record returned an error: %v", err)
+	}
+
+	// Recording the same original again replaces the failure
+	if err := service.Record("clients/1/2/originals/a.jpg", second, errors.New("still bad")); err != nil {
+		t.Fatalf("Record returned an error: %v", err)
+	}
+
+	failures, err := service.List()
+	if err != nil {
+		t.Fatalf("List returned an error: %v", err)
+	}
+
+	if len(failures) != 1 {
+		t.Fatalf("got %d failures, want 1", len(failures))
+	}
+
+	if failures[0].Error != "still bad" || !failures[0].LastModified.Equal(second) {
+		t.Errorf("failure = %+v, want the second recording", failures[0])
+	}
+
+	if err = service.Clear("clients/1/2/originals/a.jpg"); err != nil {
+		t.Fatalf("Clear returned an error: %v", err)
+	}
+
+	if failures, _ = service.List(); len(failures) != 0 {
+		t.Errorf("got %d failures after clearing, want 0", len(failures))
+	}
+}
@@ -2,91 +2,1100 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	stdsql "database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/mail"
+	"strings"
 	"time"
 
 	"github.com/adampresley/adampresleyphotography/pkg/models"
 	"github.com/rfberaldo/sqlz"
 )
 
+const (
+	/*
+	 * Generated codes leave out characters that are easy to confuse, like 0 and O
+	 */
+	accessCodeAlphabet    = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	accessCodeLength      = 10
+	maxAccessCodeAttempts = 5
+
+	/*
+	 * User agents are recorded with login attempts. Anything past this
+	 * is cut off so a client can't fill the table with one request.
+	 */
+	maxLoginUserAgentLength = 512
+)
+
+var (
+	ErrAccessCodeNotFound  = errors.New("access code not found")
+	ErrClientNotFound      = models.ErrClientNotFound
+	ErrDuplicateAccessCode = errors.New("access code is already in use")
+)
+
 type ClientServicer interface {
+	AddAccessCode(clientID uint, code, label string) (models.AccessCode, error)
+	Count(filter ClientFilter) (int, error)
+	Create(request CreateClientRequest) (*models.Client, models.AccessCode, error)
+	Delete(clientID uint) error
 	GetAll() ([]models.Client, error)
-	GetByPassword(password string) (*models.Client, error)
+	GetByPassword(password string) (*models.Client, *models.AccessCode, error)
+	GetNotificationPreference(clientID uint) (bool, error)
+	GetRecentLogins(clientID uint, limit int) ([]models.LoginAudit, error)
+	GetSessionGeneration(clientID uint) (int, error)
+	InvalidateSessions(clientID uint) error
+	List(filter ClientFilter) ([]models.Client, error)
+	MigrateLegacyAccessCodes() (int, error)
+	RecordLogin(login models.LoginAudit) error
+	RevokeAccessCode(clientID, accessCodeID uint) error
+	SetNotificationPreference(clientID uint, notifyOnDownload bool) error
+}
+
+/*
+ClientFilter narrows and orders a client listing. Search is matched as a
+case-insensitive substring of the name or email. Page starts at 1, and a
+PageSize of 0 returns every match. SortBy is one of the ClientSort values,
+defaulting to name.
+*/
+type ClientFilter struct {
+	Search     string
+	Page       int
+	PageSize   int
+	SortBy     string
+	Descending bool
+}
+
+const (
+	ClientSortCreatedAt = "createdAt"
+	ClientSortEmail     = "email"
+	ClientSortName      = "name"
+)
+
+var (
+	clientSortColumns = map[string]string{
+		ClientSortCreatedAt: "c.created_at",
+		ClientSortEmail:     "c.email COLLATE NOCASE",
+		ClientSortName:      "c.name COLLATE NOCASE",
+	}
+)
+
+/*
+where returns the conditions and parameters selecting the clients that
+match the filter's search.
+*/
+func (f ClientFilter) where() (string, []any) {
+	sql := `
+WHERE 1=1
+   AND c.deleted_at IS NULL
+`
+
+	params := []any{}
+
+	if search := strings.TrimSpace(f.Search); search != "" {
+		sql += "   AND (c.name LIKE ? ESCAPE '\\' OR c.email LIKE ? ESCAPE '\\')\n"
+		pattern := "%" + escapeLike(search) + "%"
+		params = append(params, pattern, pattern)
+	}
+
+	return sql, params
+}
+
+/*
+CreateClientRequest holds the details for a new client. AccessCode is
+optional; a random one is generated when it's empty.
+*/
+type CreateClientRequest struct {
+	Name            string `json:"name"`
+	Email           string `json:"email"`
+	AccessCode      string `json:"accessCode"`
+	AccessCodeLabel string `json:"accessCodeLabel"`
+
+	// Locale, such as "es", overrides the client's Accept-Language header
+	Locale string `json:"locale"`
+}
+
+/*
+querier is satisfied by both *sqlz.DB and *sqlz.Tx, so helpers can run
+inside or outside a transaction.
+*/
+type querier interface {
+	Exec(ctx context.Context, query string, args ...any) (stdsql.Result, error)
+	QueryRow(ctx context.Context, dst any, query string, args ...any) error
 }
 
 type ClientServiceConfig struct {
-	DB *sqlz.DB
+	DB                   *sqlz.DB
+	SessionGenerationTTL time.Duration
 }
 
 type ClientService struct {
-	db *sqlz.DB
+	db          *sqlz.DB
+	generations *sessionGenerationCache
 }
 
 func NewClientService(config ClientServiceConfig) ClientService {
+	if config.SessionGenerationTTL <= 0 {
+		config.SessionGenerationTTL = defaultSessionGenerationTTL
+	}
+
 	return ClientService{
-		db: config.DB,
+		db:          config.DB,
+		generations: newSessionGenerationCache(config.SessionGenerationTTL),
 	}
 }
 
+/*
+GetAll returns every client, ordered by name. It is for background jobs
+that need to visit all of them; anything shown to a person should page
+through List instead.
+*/
 func (s ClientService) GetAll() ([]models.Client, error) {
+	return s.List(ClientFilter{})
+}
+
+/*
+List returns the clients matching filter, one page at a time. An unknown
+SortBy is an ErrInvalidInput.
+*/
+func (s ClientService) List(filter ClientFilter) ([]models.Client, error) {
 	var (
 		err     error
 		clients []models.Client
 	)
 
+	if filter.SortBy == "" {
+		filter.SortBy = ClientSortName
+	}
+
+	sortColumn, ok := clientSortColumns[filter.SortBy]
+
+	if !ok {
+		return nil, fmt.Errorf("%w: can't sort clients by '%s'", ErrInvalidInput, filter.SortBy)
+	}
+
+	direction := "ASC"
+
+	if filter.Descending {
+		direction = "DESC"
+	}
+
+	where, params := filter.where()
+
 	sql := `
 SELECT
    c.id
    , c.created_at
    , c.updated_at
    , c.deleted_at
-   , c.password
    , c.name
    , c.email
-FROM clients AS c
-WHERE 1=1
-   AND c.deleted_at IS NULL
-ORDER BY c.name
-`
+   , c.session_generation
+   , c.locale
+   , c.notify_on_download
+FROM clients AS c` + where + fmt.Sprintf("ORDER BY %s %s, c.id %s\n", sortColumn, direction, direction)
+
+	if filter.PageSize > 0 {
+		page := max(filter.Page, 1)
+
+		sql += "LIMIT ? OFFSET ?\n"
+		params = append(params, filter.PageSize, (page-1)*filter.PageSize)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	if err = s.db.Query(ctx, &clients, sql); err != nil {
-		return nil, fmt.Errorf("error querying for all clients: %w", err)
+	if err = s.db.Query(ctx, &clients, sql, params...); err != nil {
+		return nil, fmt.Errorf("error querying for clients: %w", err)
 	}
 
 	return clients, nil
 }
 
-func (s ClientService) GetByPassword(password string) (*models.Client, error) {
+/*
+Count returns how many clients match filter's search, ignoring paging.
+*/
+func (s ClientService) Count(filter ClientFilter) (int, error) {
+	var (
+		err   error
+		count int
+	)
+
+	where, params := filter.where()
+
+	sql := `
+SELECT
+   COUNT(*)
+FROM clients AS c` + where
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.QueryRow(ctx, &count, sql, params...); err != nil {
+		return 0, fmt.Errorf("error counting clients: %w", err)
+	}
+
+	return count, nil
+}
+
+/*
+AddAccessCode gives a client another password. When code is empty a random
+one is generated. Only a hash of the code is stored, so the returned access
+code is the only place the plain text is available. Returns
+ErrDuplicateAccessCode if the code is already in use, and a not found error
+if the client doesn't exist.
+*/
+func (s ClientService) AddAccessCode(clientID uint, code, label string) (models.AccessCode, error) {
+	var (
+		err    error
+		exists bool
+	)
+
+	code = strings.TrimSpace(code)
+	label = strings.TrimSpace(label)
+
+	if label == "" {
+		return models.AccessCode{}, fmt.Errorf("%w: label is required", ErrInvalidInput)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	sql := `
+SELECT
+   EXISTS (SELECT 1 FROM clients WHERE id=? AND deleted_at IS NULL)
+   `
+
+	if err = s.db.QueryRow(ctx, &exists, sql, clientID); err != nil {
+		return models.AccessCode{}, fmt.Errorf("error checking client %d exists: %w", clientID, err)
+	}
+
+	if !exists {
+		return models.AccessCode{}, notFound(ErrClientNotFound, "client %d not found", clientID)
+	}
+
+	if code == "" {
+		return s.insertGeneratedAccessCode(ctx, s.db, clientID, label)
+	}
+
+	if err = s.checkAccessCodeAvailable(ctx, s.db, code); err != nil {
+		return models.AccessCode{}, err
+	}
+
+	return insertAccessCode(ctx, s.db, clientID, code, label)
+}
+
+/*
+Create adds a client along with their first access code. When no code is
+given a random one is generated. The returned access code holds the plain
+text code, which is the only time it is available since only its hash is
+stored.
+*/
+func (s ClientService) Create(request CreateClientRequest) (*models.Client, models.AccessCode, error) {
+	var (
+		err        error
+		id         int64
+		tx         *sqlz.Tx
+		execResult stdsql.Result
+		accessCode models.AccessCode
+	)
+
+	request.Name = strings.TrimSpace(request.Name)
+	request.Email = strings.TrimSpace(request.Email)
+	request.AccessCode = strings.TrimSpace(request.AccessCode)
+	request.Locale = strings.ToLower(strings.TrimSpace(request.Locale))
+
+	if request.Name == "" {
+		return nil, accessCode, fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+
+	if request.Email != "" {
+		if _, err = mail.ParseAddress(request.Email); err != nil {
+			return nil, accessCode, fmt.Errorf("%w: email '%s' is not valid", ErrInvalidInput, request.Email)
+		}
+	}
+
+	if request.AccessCodeLabel == "" {
+		request.AccessCodeLabel = "Default"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if tx, err = s.db.Begin(ctx); err != nil {
+		return nil, accessCode, fmt.Errorf("error starting transaction to create client: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	now := time.Now().UTC()
+
+	result := &models.Client{
+		BaseModel: models.BaseModel{
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		Name:             request.Name,
+		Email:            request.Email,
+		Locale:           request.Locale,
+		NotifyOnDownload: true,
+	}
+
+	sql := `
+INSERT INTO clients (
+    created_at,
+    updated_at,
+    name,
+    email,
+    locale
+) VALUES (?, ?, ?, ?, ?)
+`
+
+	if execResult, err = tx.Exec(ctx, sql, result.CreatedAt, result.UpdatedAt, result.Name, result.Email, result.Locale); err != nil {
+		return nil, accessCode, fmt.Errorf("error inserting client '%s': %w", result.Name, err)
+	}
+
+	if id, err = execResult.LastInsertId(); err != nil {
+		return nil, accessCode, fmt.Errorf("error getting ID of new client '%s': %w", result.Name, err)
+	}
+
+	result.ID = uint(id)
+
+	if request.AccessCode != "" {
+		if err = s.checkAccessCodeAvailable(ctx, tx, request.AccessCode); err != nil {
+			return nil, accessCode, err
+		}
+
+		if accessCode, err = insertAccessCode(ctx, tx, result.ID, request.AccessCode, request.AccessCodeLabel); err != nil {
+			return nil, accessCode, err
+		}
+	} else {
+		if accessCode, err = s.insertGeneratedAccessCode(ctx, tx, result.ID, request.AccessCodeLabel); err != nil {
+			return nil, accessCode, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, accessCode, fmt.Errorf("error committing new client '%s': %w", result.Name, err)
+	}
+
+	return result, accessCode, nil
+}
+
+/*
+Delete removes a client, for when they ask for their data to be removed. The
+client, their albums, galleries, and favorites are soft deleted and their
+access codes revoked in one transaction, so nothing is left pointing at a
+deleted client. Existing sessions stop working. Their photos in storage
+are left alone; removing them is up to the caller. Returns a not found
+error if the client doesn't exist.
+*/
+func (s ClientService) Delete(clientID uint) error {
+	var (
+		err        error
+		tx         *sqlz.Tx
+		execResult stdsql.Result
+		affected   int64
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if tx, err = s.db.Begin(ctx); err != nil {
+		return fmt.Errorf("error starting transaction to delete client %d: %w", clientID, err)
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	now := time.Now().UTC()
+
+	sql := `
+UPDATE clients SET
+    deleted_at = ?,
+    updated_at = ?,
+    session_generation = session_generation + 1
+WHERE 1=1
+    AND id = ?
+    AND deleted_at IS NULL
+`
+
+	if execResult, err = tx.Exec(ctx, sql, now, now, clientID); err != nil {
+		return fmt.Errorf("error deleting client %d: %w", clientID, err)
+	}
+
+	if affected, err = execResult.RowsAffected(); err != nil {
+		return fmt.Errorf("error checking deleted client %d: %w", clientID, err)
+	}
+
+	if affected == 0 {
+		return notFound(ErrClientNotFound, "client %d not found", clientID)
+	}
+
+	sql = `
+UPDATE albums SET
+    deleted_at = ?,
+    updated_at = ?
+WHERE 1=1
+    AND client_id = ?
+    AND deleted_at IS NULL
+`
+
+	if _, err = tx.Exec(ctx, sql, now, now, clientID); err != nil {
+		return fmt.Errorf("error deleting albums for client %d: %w", clientID, err)
+	}
+
+	sql = `
+UPDATE galleries SET
+    deleted_at = ?,
+    updated_at = ?
+WHERE 1=1
+    AND client_id = ?
+    AND deleted_at IS NULL
+`
+
+	if _, err = tx.Exec(ctx, sql, now, now, clientID); err != nil {
+		return fmt.Errorf("error deleting galleries for client %d: %w", clientID, err)
+	}
+
+	sql = `
+UPDATE favorites SET
+    deleted_at = ?
+WHERE 1=1
+    AND client_id = ?
+    AND deleted_at IS NULL
+`
+
+	if _, err = tx.Exec(ctx, sql, now, clientID); err != nil {
+		return fmt.Errorf("error deleting favorites for client %d: %w", clientID, err)
+	}
+
+	sql = `
+UPDATE access_codes SET
+    revoked_at = ?
+WHERE 1=1
+    AND client_id = ?
+    AND revoked_at IS NULL
+`
+
+	if _, err = tx.Exec(ctx, sql, now, clientID); err != nil {
+		return fmt.Errorf("error revoking access codes for client %d: %w", clientID, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing deletion of client %d: %w", clientID, err)
+	}
+
+	s.generations.forget(clientID)
+	return nil
+}
+
+/*
+GetByPassword finds the client that owns an active access code, and returns
+the code that matched. Codes are only ever matched by hash.
+*/
+func (s ClientService) GetByPassword(password string) (*models.Client, *models.AccessCode, error) {
 	var (
 		err error
 	)
 
-	result := &models.Client{}
+	accessCode := &models.AccessCode{}
 
 	sql := `
+SELECT
+   ac.id
+   , ac.client_id
+   , COALESCE(ac.code, '') AS code
+   , ac.label
+   , ac.created_at
+   , ac.revoked_at
+FROM access_codes AS ac
+WHERE 1=1
+   AND ac.revoked_at IS NULL
+   AND ac.code_hash=?
+   `
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.QueryRow(ctx, accessCode, sql, hashAccessCode(password)); err != nil {
+		return nil, nil, fmt.Errorf("error querying for access code: %w", err)
+	}
+
+	result := &models.Client{}
+
+	sql = `
 SELECT
    c.id
    , c.created_at
    , c.updated_at
    , c.deleted_at
-   , c.password
    , c.name
-	, c.email
+   , c.email
+   , c.session_generation
+   , c.locale
+   , c.notify_on_download
+FROM clients AS c
+WHERE 1=1
+   AND c.deleted_at IS NULL
+   AND c.id=?
+   `
+
+	if err = s.db.QueryRow(ctx, result, sql, accessCode.ClientID); err != nil {
+		return nil, nil, fmt.Errorf("error querying for client %d by access code: %w", accessCode.ClientID, err)
+	}
+
+	return result, accessCode, nil
+}
+
+/*
+GetSessionGeneration returns a client's current session generation. Sessions
+created under an older generation are no longer valid. It is checked on
+every request, so the generation is cached for a short time.
+*/
+func (s ClientService) GetSessionGeneration(clientID uint) (int, error) {
+	var (
+		err        error
+		generation int
+		ok         bool
+	)
+
+	if generation, ok = s.generations.get(clientID); ok {
+		return generation, nil
+	}
+
+	sql := `
+SELECT
+   c.session_generation
+FROM clients AS c
+WHERE 1=1
+   AND c.deleted_at IS NULL
+   AND c.id=?
+   `
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.QueryRow(ctx, &generation, sql, clientID); err != nil {
+		if sqlz.IsNotFound(err) {
+			return 0, notFound(ErrClientNotFound, "client %d not found", clientID)
+		}
+
+		return 0, fmt.Errorf("error querying session generation for client %d: %w", clientID, err)
+	}
+
+	s.generations.set(clientID, generation)
+	return generation, nil
+}
+
+/*
+GetNotificationPreference returns whether a client wants an email when their
+album download is ready. Sessions carry a copy of the client from when they
+logged in, so callers read the preference here to pick up later changes.
+Returns a not found error if the client doesn't exist.
+*/
+func (s ClientService) GetNotificationPreference(clientID uint) (bool, error) {
+	var (
+		err              error
+		notifyOnDownload bool
+	)
+
+	sql := `
+SELECT
+   c.notify_on_download
+FROM clients AS c
+WHERE 1=1
+   AND c.deleted_at IS NULL
+   AND c.id=?
+   `
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.QueryRow(ctx, &notifyOnDownload, sql, clientID); err != nil {
+		if sqlz.IsNotFound(err) {
+			return false, notFound(ErrClientNotFound, "client %d not found", clientID)
+		}
+
+		return false, fmt.Errorf("error querying notification preference for client %d: %w", clientID, err)
+	}
+
+	return notifyOnDownload, nil
+}
+
+/*
+GetRecentLogins returns a client's most recent login attempts, newest
+first. Attempts with a code that matched nobody aren't tied to a client and
+don't appear here.
+*/
+func (s ClientService) GetRecentLogins(clientID uint, limit int) ([]models.LoginAudit, error) {
+	var (
+		err error
+	)
+
+	if limit <= 0 {
+		return nil, fmt.Errorf("%w: limit must be greater than 0", ErrInvalidInput)
+	}
+
+	result := []models.LoginAudit{}
+
+	sql := `
+SELECT
+   la.id
+   , la.client_id
+   , la.access_code_id
+   , la.ip_address
+   , la.user_agent
+   , la.outcome
+   , la.created_at
+FROM login_audit AS la
+WHERE 1=1
+   AND la.client_id = ?
+ORDER BY la.created_at DESC, la.id DESC
+LIMIT ?
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.Query(ctx, &result, sql, clientID, limit); err != nil {
+		return nil, fmt.Errorf("error querying recent logins for client %d: %w", clientID, err)
+	}
+
+	return result, nil
+}
+
+/*
+InvalidateSessions logs out every existing session for a client by bumping
+their session generation. Returns a not found error if the client doesn't
+exist.
+*/
+func (s ClientService) InvalidateSessions(clientID uint) error {
+	var (
+		err        error
+		execResult stdsql.Result
+		affected   int64
+	)
+
+	sql := `
+UPDATE clients SET
+    session_generation = session_generation + 1,
+    updated_at = ?
+WHERE 1=1
+    AND id = ?
+    AND deleted_at IS NULL
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if execResult, err = s.db.Exec(ctx, sql, time.Now().UTC(), clientID); err != nil {
+		return fmt.Errorf("error invalidating sessions for client %d: %w", clientID, err)
+	}
+
+	s.generations.forget(clientID)
+
+	if affected, err = execResult.RowsAffected(); err != nil {
+		return fmt.Errorf("error checking invalidated sessions for client %d: %w", clientID, err)
+	}
+
+	if affected == 0 {
+		return notFound(ErrClientNotFound, "client %d not found", clientID)
+	}
+
+	return nil
+}
+
+/*
+MigrateLegacyAccessCodes hashes access codes that were stored as plain text,
+either in access_codes.code or as the old clients.password, and clears the
+plain text. It runs on every startup and does nothing once there is nothing
+left to migrate. Returns the number of codes migrated.
+*/
+func (s ClientService) MigrateLegacyAccessCodes() (int, error) {
+	var (
+		err       error
+		tx        *sqlz.Tx
+		migrated  int
+		plainText []models.AccessCode
+		clients   []legacyClientPassword
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	if tx, err = s.db.Begin(ctx); err != nil {
+		return 0, fmt.Errorf("error starting transaction to migrate access codes: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	sql := `
+SELECT
+   ac.id
+   , ac.client_id
+   , ac.code
+   , ac.label
+   , ac.created_at
+   , ac.revoked_at
+FROM access_codes AS ac
+WHERE 1=1
+   AND COALESCE(ac.code, '') <> ''
+   `
+
+	if err = tx.Query(ctx, &plainText, sql); err != nil && !sqlz.IsNotFound(err) {
+		return 0, fmt.Errorf("error querying for plain text access codes: %w", err)
+	}
+
+	for _, accessCode := range plainText {
+		if err = hashLegacyAccessCode(ctx, tx, accessCode); err != nil {
+			return 0, err
+		}
+
+		migrated++
+	}
+
+	sql = `
+SELECT
+   c.id
+   , c.password
 FROM clients AS c
 WHERE 1=1
    AND c.deleted_at IS NULL
-   AND c.password=?
+   AND COALESCE(c.password, '') <> ''
    `
 
+	if err = tx.Query(ctx, &clients, sql); err != nil && !sqlz.IsNotFound(err) {
+		return 0, fmt.Errorf("error querying for client passwords: %w", err)
+	}
+
+	for _, client := range clients {
+		if err = s.checkAccessCodeAvailable(ctx, tx, client.Password); errors.Is(err, ErrDuplicateAccessCode) {
+			continue
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err = insertAccessCode(ctx, tx, client.ID, client.Password, "Default"); err != nil {
+			return 0, err
+		}
+
+		migrated++
+	}
+
+	sql = `
+UPDATE clients SET
+    password = NULL
+WHERE 1=1
+    AND password IS NOT NULL
+`
+
+	if _, err = tx.Exec(ctx, sql); err != nil {
+		return 0, fmt.Errorf("error clearing client passwords: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing migrated access codes: %w", err)
+	}
+
+	return migrated, nil
+}
+
+/*
+RecordLogin writes a login attempt to the audit log. The code that was
+tried is never passed in, so it can't be stored. CreatedAt defaults to now
+and long user agents are cut off.
+*/
+func (s ClientService) RecordLogin(login models.LoginAudit) error {
+	var (
+		err error
+	)
+
+	switch login.Outcome {
+	case models.LoginOutcomeError, models.LoginOutcomeIncorrectCode, models.LoginOutcomeSuccess:
+	default:
+		return fmt.Errorf("%w: unknown login outcome '%s'", ErrInvalidInput, login.Outcome)
+	}
+
+	if login.CreatedAt.IsZero() {
+		login.CreatedAt = time.Now().UTC()
+	}
+
+	if len(login.UserAgent) > maxLoginUserAgentLength {
+		login.UserAgent = strings.ToValidUTF8(login.UserAgent[:maxLoginUserAgentLength], "")
+	}
+
+	sql := `
+INSERT INTO login_audit (
+    client_id,
+    access_code_id,
+    ip_address,
+    user_agent,
+    outcome,
+    created_at
+) VALUES (?, ?, ?, ?, ?, ?)
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if _, err = s.db.Exec(ctx, sql, login.ClientID, login.AccessCodeID, login.IPAddress, login.UserAgent, login.Outcome, login.CreatedAt); err != nil {
+		return fmt.Errorf("error recording %s login: %w", login.Outcome, err)
+	}
+
+	return nil
+}
+
+/*
+RevokeAccessCode stops one of a client's access codes from being used to log
+in. Returns a not found error if the client has no active access code with
+that ID.
+*/
+func (s ClientService) RevokeAccessCode(clientID, accessCodeID uint) error {
+	var (
+		err        error
+		execResult stdsql.Result
+		affected   int64
+	)
+
+	sql := `
+UPDATE access_codes SET
+    revoked_at = ?
+WHERE 1=1
+    AND id = ?
+    AND client_id = ?
+    AND revoked_at IS NULL
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if execResult, err = s.db.Exec(ctx, sql, time.Now().UTC(), accessCodeID, clientID); err != nil {
+		return fmt.Errorf("error revoking access code %d: %w", accessCodeID, err)
+	}
+
+	if affected, err = execResult.RowsAffected(); err != nil {
+		return fmt.Errorf("error checking revoked access code %d: %w", accessCodeID, err)
+	}
+
+	if affected == 0 {
+		return notFound(ErrAccessCodeNotFound, "access code %d not found for client %d", accessCodeID, clientID)
+	}
+
+	return nil
+}
+
+/*
+SetNotificationPreference turns download ready emails on or off for a
+client. Zips are still built either way. Returns a not found error if the
+client doesn't exist.
+*/
+func (s ClientService) SetNotificationPreference(clientID uint, notifyOnDownload bool) error {
+	var (
+		err        error
+		execResult stdsql.Result
+		affected   int64
+	)
+
+	sql := `
+UPDATE clients SET
+    notify_on_download = ?,
+    updated_at = ?
+WHERE 1=1
+    AND id = ?
+    AND deleted_at IS NULL
+`
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	if err = s.db.QueryRow(ctx, result, sql, password); err != nil {
-		return result, fmt.Errorf("error querying for client by password: %w", err)
+	if execResult, err = s.db.Exec(ctx, sql, notifyOnDownload, time.Now().UTC(), clientID); err != nil {
+		return fmt.Errorf("error setting notification preference for client %d: %w", clientID, err)
+	}
+
+	if affected, err = execResult.RowsAffected(); err != nil {
+		return fmt.Errorf("error checking notification preference for client %d: %w", clientID, err)
+	}
+
+	if affected == 0 {
+		return notFound(ErrClientNotFound, "client %d not found", clientID)
+	}
+
+	return nil
+}
+
+/*
+checkAccessCodeAvailable returns ErrDuplicateAccessCode when code matches an
+active access code.
+*/
+func (s ClientService) checkAccessCodeAvailable(ctx context.Context, q querier, code string) error {
+	var (
+		err   error
+		count int
+	)
+
+	sql := `
+SELECT
+   COUNT(*)
+FROM access_codes
+WHERE 1=1
+   AND revoked_at IS NULL
+   AND code_hash=?
+   `
+
+	if err = q.QueryRow(ctx, &count, sql, hashAccessCode(code)); err != nil {
+		return fmt.Errorf("error checking if access code is in use: %w", err)
+	}
+
+	if count > 0 {
+		return ErrDuplicateAccessCode
+	}
+
+	return nil
+}
+
+/*
+insertGeneratedAccessCode creates a random access code for a client. On the
+rare chance the code is already taken a new one is generated.
+*/
+func (s ClientService) insertGeneratedAccessCode(ctx context.Context, q querier, clientID uint, label string) (models.AccessCode, error) {
+	var (
+		err  error
+		code string
+	)
+
+	for range maxAccessCodeAttempts {
+		if code, err = generateAccessCode(); err != nil {
+			return models.AccessCode{}, err
+		}
+
+		if err = s.checkAccessCodeAvailable(ctx, q, code); errors.Is(err, ErrDuplicateAccessCode) {
+			continue
+		}
+
+		if err != nil {
+			return models.AccessCode{}, err
+		}
+
+		return insertAccessCode(ctx, q, clientID, code, label)
+	}
+
+	return models.AccessCode{}, fmt.Errorf("could not generate a unique access code after %d attempts", maxAccessCodeAttempts)
+}
+
+func insertAccessCode(ctx context.Context, q querier, clientID uint, code, label string) (models.AccessCode, error) {
+	var (
+		err        error
+		id         int64
+		execResult stdsql.Result
+	)
+
+	result := models.AccessCode{
+		ClientID:  clientID,
+		Code:      code,
+		Label:     label,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	sql := `
+INSERT INTO access_codes (
+    client_id,
+    code_hash,
+    label,
+    created_at
+) VALUES (?, ?, ?, ?)
+`
+
+	if execResult, err = q.Exec(ctx, sql, result.ClientID, hashAccessCode(code), result.Label, result.CreatedAt); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return result, ErrDuplicateAccessCode
+		}
+
+		return result, fmt.Errorf("error adding access code '%s' for client %d: %w", label, clientID, err)
+	}
+
+	if id, err = execResult.LastInsertId(); err == nil {
+		result.ID = uint(id)
 	}
 
 	return result, nil
 }
+
+/*
+legacyClientPassword is a password left in clients.password from before
+access codes existed.
+*/
+type legacyClientPassword struct {
+	ID       uint
+	Password string
+}
+
+/*
+hashLegacyAccessCode replaces a plain text access code with its hash. If an
+active code with the same hash already exists, the plain text one is a
+duplicate and is revoked instead.
+*/
+func hashLegacyAccessCode(ctx context.Context, q querier, accessCode models.AccessCode) error {
+	var (
+		err error
+	)
+
+	sql := `
+UPDATE access_codes SET
+    code_hash = ?,
+    code = NULL
+WHERE 1=1
+    AND id = ?
+`
+
+	if _, err = q.Exec(ctx, sql, hashAccessCode(accessCode.Code), accessCode.ID); err == nil {
+		return nil
+	}
+
+	if !strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return fmt.Errorf("error hashing access code %d: %w", accessCode.ID, err)
+	}
+
+	sql = `
+UPDATE access_codes SET
+    code = NULL,
+    revoked_at = COALESCE(revoked_at, ?)
+WHERE 1=1
+    AND id = ?
+`
+
+	if _, err = q.Exec(ctx, sql, time.Now().UTC(), accessCode.ID); err != nil {
+		return fmt.Errorf("error revoking duplicate access code %d: %w", accessCode.ID, err)
+	}
+
+	return nil
+}
+
+func hashAccessCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateAccessCode() (string, error) {
+	b := make([]byte, accessCodeLength)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating access code: %w", err)
+	}
+
+	for i := range b {
+		b[i] = accessCodeAlphabet[int(b[i])%len(accessCodeAlphabet)]
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,555 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/rfberaldo/sqlz"
+)
+
+func TestMigrateLegacyAccessCodes(t *testing.T) {
+	db := newTestDB(t)
+	service := NewClientService(ClientServiceConfig{DB: db})
+
+	jane := insertTestClient(t, db, "Jane")
+	john := insertTestClient(t, db, "John")
+	now := time.Now()
+
+	mustExec(t, db, `UPDATE clients SET password=? WHERE id=?`, "jane-old", jane)
+	mustExec(t, db, `UPDATE clients SET password=? WHERE id=?`, "shared", john)
+	mustExec(t, db, `INSERT INTO access_codes (client_id, code, label, created_at) VALUES (?, ?, 'Default', ?)`, john, "shared", now)
+
+	migrated, err := service.MigrateLegacyAccessCodes()
+	if err != nil {
+		t.Fatalf("MigrateLegacyAccessCodes returned an error: %v", err)
+	}
+
+	if migrated != 2 {
+		t.Errorf("migrated = %d, want 2", migrated)
+	}
+
+	var plainText int
+
+	if err = db.QueryRow(context.Background(), &plainText, `SELECT COUNT(*) FROM access_codes WHERE code IS NOT NULL`); err != nil {
+		t.Fatalf("error counting plain text codes: %v", err)
+	}
+
+	if plainText != 0 {
+		t.Errorf("%d access codes are still stored as plain text", plainText)
+	}
+
+	var passwords int
+
+	if err = db.QueryRow(context.Background(), &passwords, `SELECT COUNT(*) FROM clients WHERE password IS NOT NULL`); err != nil {
+		t.Fatalf("error counting client passwords: %v", err)
+	}
+
+	if passwords != 0 {
+		t.Errorf("%d clients still have a plain text password", passwords)
+	}
+
+	tests := []struct {
+		code     string
+		clientID uint
+	}{
+		{code: "jane-old", clientID: jane},
+		{code: "shared", clientID: john},
+	}
+
+	for _, tt := range tests {
+		client, _, err := service.GetByPassword(tt.code)
+		if err != nil {
+			t.Fatalf("GetByPassword(%q) returned an error: %v", tt.code, err)
+		}
+
+		if client.ID != tt.clientID {
+			t.Errorf("GetByPassword(%q) = client %d, want %d", tt.code, client.ID, tt.clientID)
+		}
+	}
+
+	// A second run has nothing left to do
+	if migrated, err = service.MigrateLegacyAccessCodes(); err != nil || migrated != 0 {
+		t.Errorf("second run = %d, %v; want 0, nil", migrated, err)
+	}
+}
+
+func TestGetByPasswordIgnoresPlainTextCodes(t *testing.T) {
+	db := newTestDB(t)
+	service := NewClientService(ClientServiceConfig{DB: db})
+
+	clientID := insertTestClient(t, db, "Jane")
+	mustExec(t, db, `INSERT INTO access_codes (client_id, code, label, created_at) VALUES (?, ?, 'Default', ?)`, clientID, "plain", time.Now())
+
+	if _, _, err := service.GetByPassword("plain"); !sqlz.IsNotFound(err) {
+		t.Errorf("error = %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestAddAccessCode(t *testing.T) {
+	db := newTestDB(t)
+	service := NewClientService(ClientServiceConfig{DB: db})
+
+	clientID := insertTestClient(t, db, "Jane")
+
+	generated, err := service.AddAccessCode(clientID, "", "Grandma")
+	if err != nil {
+		t.Fatalf("AddAccessCode returned an error: %v", err)
+	}
+
+	if generated.Code == "" || generated.ID == 0 {
+		t.Fatalf("generated access code = %+v, want a code and an ID", generated)
+	}
+
+	client, _, err := service.GetByPassword(generated.Code)
+	if err != nil || client.ID != clientID {
+		t.Fatalf("GetByPassword with the generated code = %v, %v", client, err)
+	}
+
+	if _, err = service.AddAccessCode(clientID, generated.Code, "Again"); !errors.Is(err, ErrDuplicateAccessCode) {
+		t.Errorf("reusing a code: error = %v, want %v", err, ErrDuplicateAccessCode)
+	}
+
+	if _, err = service.AddAccessCode(clientID, "something", ""); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("missing label: error = %v, want %v", err, ErrInvalidInput)
+	}
+
+	if _, err = service.AddAccessCode(clientID+100, "something", "Nobody"); !sqlz.IsNotFound(err) {
+		t.Errorf("unknown client: error = %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestRevokeAccessCodeIsScopedToTheClient(t *testing.T) {
+	db := newTestDB(t)
+	service := NewClientService(ClientServiceConfig{DB: db})
+
+	jane := insertTestClient(t, db, "Jane")
+	john := insertTestClient(t, db, "John")
+
+	accessCode, err := service.AddAccessCode(jane, "jane-code", "Jane")
+	if err != nil {
+		t.Fatalf("AddAccessCode returned an error: %v", err)
+	}
+
+	if err = service.RevokeAccessCode(john, accessCode.ID); !sqlz.IsNotFound(err) {
+		t.Fatalf("revoking another client's code: error = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	if _, _, err = service.GetByPassword("jane-code"); err != nil {
+		t.Fatalf("code stopped working after a foreign revoke: %v", err)
+	}
+
+	if err = service.RevokeAccessCode(jane, accessCode.ID); err != nil {
+		t.Fatalf("RevokeAccessCode returned an error: %v", err)
+	}
+
+	if _, _, err = service.GetByPassword("jane-code"); !sqlz.IsNotFound(err) {
+		t.Errorf("revoked code: error = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	if err = service.RevokeAccessCode(jane, accessCode.ID); !sqlz.IsNotFound(err) {
+		t.Errorf("revoking twice: error = %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestSessionGenerationIsCachedUntilInvalidated(t *testing.T) {
+	db := newTestDB(t)
+	service := NewClientService(ClientServiceConfig{DB: db, SessionGenerationTTL: time.Hour})
+
+	clientID := insertTestClient(t, db, "Jane")
+
+	before, err := service.GetSessionGeneration(clientID)
+	if err != nil {
+		t.Fatalf("GetSessionGeneration returned an error: %v", err)
+	}
+
+	// A change the service doesn't know about is only seen once the TTL passes
+	mustExec(t, db, `UPDATE clients SET session_generation = session_generation + 10 WHERE id=?`, clientID)
+
+	if cached, _ := service.GetSessionGeneration(clientID); cached != before {
+		t.Errorf("generation = %d, want the cached %d", cached, before)
+	}
+
+	if err = service.InvalidateSessions(clientID); err != nil {
+		t.Fatalf("InvalidateSessions returned an error: %v", err)
+	}
+
+	after, err := service.GetSessionGeneration(clientID)
+	if err != nil {
+		t.Fatalf("GetSessionGeneration returned an error: %v", err)
+	}
+
+	if after != before+11 {
+		t.Errorf("generation after invalidating = %d, want %d", after, before+11)
+	}
+
+	if err = service.InvalidateSessions(clientID + 100); !sqlz.IsNotFound(err) {
+		t.Errorf("unknown client: error = %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestCreateClient(t *testing.T) {
+	db := newTestDB(t)
+	service := NewClientService(ClientServiceConfig{DB: db})
+
+	client, generated, err := service.Create(CreateClientRequest{Name: "  Jane  ", Email: "jane@example.com"})
+	if err != nil {
+		t.Fatalf("Create returned an error: %v", err)
+	}
+
+	if client.ID == 0 || client.Name != "Jane" {
+		t.Errorf("client = %+v, want an ID and a trimmed name", client)
+	}
+
+	if generated.Code == "" || generated.Label != "Default" {
+		t.Errorf("access code = %+v, want a generated code labeled Default", generated)
+	}
+
+	if found, _, err := service.GetByPassword(generated.Code); err != nil || found.ID != client.ID {
+		t.Errorf("logging in with the generated code = %v, %v; want client %d", found, err, client.ID)
+	}
+
+	john, given, err := service.Create(CreateClientRequest{Name: "John", AccessCode: "john-code", AccessCodeLabel: "John", Locale: " ES "})
+	if err != nil {
+		t.Fatalf("Create with a code returned an error: %v", err)
+	}
+
+	if given.Code != "john-code" || given.Label != "John" {
+		t.Errorf("access code = %+v, want the given code and label", given)
+	}
+
+	if found, _, err := service.GetByPassword("john-code"); err != nil || found.ID != john.ID || found.Locale != "es" {
+		t.Errorf("logging in with the given code = %v, %v; want client %d with locale es", found, err, john.ID)
+	}
+
+	var plainText int
+
+	if err = db.QueryRow(context.Background(), &plainText, `SELECT COUNT(*) FROM access_codes WHERE code IS NOT NULL`); err != nil {
+		t.Fatalf("error counting plain text codes: %v", err)
+	}
+
+	if plainText != 0 {
+		t.Errorf("%d access codes were stored as plain text", plainText)
+	}
+}
+
+func TestCreateClientRejectsDuplicatesAndBadInput(t *testing.T) {
+	db := newTestDB(t)
+	service := NewClientService(ClientServiceConfig{DB: db})
+
+	if _, _, err := service.Create(CreateClientRequest{Name: "Jane", AccessCode: "shared"}); err != nil {
+		t.Fatalf("Create returned an error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		request CreateClientRequest
+		wantErr error
+	}{
+		{name: "duplicate code", request: CreateClientRequest{Name: "John", AccessCode: "shared"}, wantErr: ErrDuplicateAccessCode},
+		{name: "missing name", request: CreateClientRequest{Name: "   "}, wantErr: ErrInvalidInput},
+		{name: "bad email", request: CreateClientRequest{Name: "John", Email: "not an email"}, wantErr: ErrInvalidInput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := service.Create(tt.request); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Nothing is left behind by a failed create
+	clients, err := service.GetAll()
+	if err != nil {
+		t.Fatalf("GetAll returned an error: %v", err)
+	}
+
+	if len(clients) != 1 {
+		t.Errorf("got %d clients, want only the first one", len(clients))
+	}
+}
+
+func TestDeleteClientCascades(t *testing.T) {
+	db := newTestDB(t)
+	service := NewClientService(ClientServiceConfig{DB: db})
+	albumService := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	jane, janeCode, err := service.Create(CreateClientRequest{Name: "Jane", AccessCode: "jane-code"})
+	if err != nil {
+		t.Fatalf("Create returned an error: %v", err)
+	}
+
+	john, _, err := service.Create(CreateClientRequest{Name: "John", AccessCode: "john-code"})
+	if err != nil {
+		t.Fatalf("Create returned an error: %v", err)
+	}
+
+	janeAlbum := insertTestAlbum(t, db, jane.ID, "Wedding", time.Now(), nil)
+	johnAlbum := insertTestAlbum(t, db, john.ID, "Graduation", time.Now(), nil)
+
+	if _, err = albumService.CreateGallery(CreateGalleryRequest{ClientID: jane.ID, Name: "Wedding"}); err != nil {
+		t.Fatalf("CreateGallery returned an error: %v", err)
+	}
+
+	if err = albumService.SetFavorites(jane.ID, janeAlbum, []string{"a.jpg", "b.jpg"}, true); err != nil {
+		t.Fatalf("SetFavorites returned an error: %v", err)
+	}
+
+	if err = albumService.SetFavorites(john.ID, johnAlbum, []string{"a.jpg"}, true); err != nil {
+		t.Fatalf("SetFavorites returned an error: %v", err)
+	}
+
+	generation, err := service.GetSessionGeneration(jane.ID)
+	if err != nil {
+		t.Fatalf("GetSessionGeneration returned an error: %v", err)
+	}
+
+	if err = service.Delete(jane.ID); err != nil {
+		t.Fatalf("Delete returned an error: %v", err)
+	}
+
+	// Logging in with the deleted client's code fails
+	if _, _, err = service.GetByPassword(janeCode.Code); !sqlz.IsNotFound(err) {
+		t.Errorf("GetByPassword after delete: error = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	// Existing sessions are no longer valid
+	if _, err = service.GetSessionGeneration(jane.ID); !sqlz.IsNotFound(err) {
+		t.Errorf("GetSessionGeneration after delete: error = %v, want %v (was generation %d)", err, sql.ErrNoRows, generation)
+	}
+
+	clients, err := service.GetAll()
+	if err != nil {
+		t.Fatalf("GetAll returned an error: %v", err)
+	}
+
+	if len(clients) != 1 || clients[0].ID != john.ID {
+		t.Errorf("clients = %+v, want only John", clients)
+	}
+
+	if _, err = albumService.GetAlbumByID(janeAlbum); !sqlz.IsNotFound(err) {
+		t.Errorf("GetAlbumByID after delete: error = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	// Nothing is left active that points at the deleted client
+	var active int
+
+	err = db.QueryRow(context.Background(), &active, `
+SELECT
+	(SELECT COUNT(*) FROM albums WHERE client_id=? AND deleted_at IS NULL)
+	+ (SELECT COUNT(*) FROM galleries WHERE client_id=? AND deleted_at IS NULL)
+	+ (SELECT COUNT(*) FROM favorites WHERE client_id=? AND deleted_at IS NULL)
+	+ (SELECT COUNT(*) FROM access_codes WHERE client_id=? AND revoked_at IS NULL)
+`, jane.ID, jane.ID, jane.ID, jane.ID)
+
+	if err != nil {
+		t.Fatalf("error counting active rows: %v", err)
+	}
+
+	if active != 0 {
+		t.Errorf("%d albums, galleries, favorites, or access codes are still active for the deleted client", active)
+	}
+
+	// Other clients are untouched
+	if client, _, err := service.GetByPassword("john-code"); err != nil || client.ID != john.ID {
+		t.Errorf("GetByPassword for John = %v, %v", client, err)
+	}
+
+	if count, err := albumService.CountFavorites(john.ID, johnAlbum); err != nil || count != 1 {
+		t.Errorf("John's favorites = %d, %v; want 1", count, err)
+	}
+
+	if err = service.Delete(jane.ID); !sqlz.IsNotFound(err) {
+		t.Errorf("deleting twice: error = %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestNotificationPreference(t *testing.T) {
+	db := newTestDB(t)
+	service := NewClientService(ClientServiceConfig{DB: db})
+
+	client, _, err := service.Create(CreateClientRequest{Name: "Jane", Email: "jane@example.com"})
+	if err != nil {
+		t.Fatalf("Create returned an error: %v", err)
+	}
+
+	if notify, err := service.GetNotificationPreference(client.ID); err != nil || !notify {
+		t.Fatalf("new client's preference = %v, %v; want notifications on", notify, err)
+	}
+
+	if err = service.SetNotificationPreference(client.ID, false); err != nil {
+		t.Fatalf("SetNotificationPreference returned an error: %v", err)
+	}
+
+	if notify, err := service.GetNotificationPreference(client.ID); err != nil || notify {
+		t.Errorf("preference after turning it off = %v, %v; want notifications off", notify, err)
+	}
+
+	if err = service.SetNotificationPreference(999, true); !sqlz.IsNotFound(err) {
+		t.Errorf("SetNotificationPreference for a missing client = %v, want not found", err)
+	}
+
+	if _, err = service.GetNotificationPreference(999); !sqlz.IsNotFound(err) {
+		t.Errorf("GetNotificationPreference for a missing client = %v, want not found", err)
+	}
+}
+
+func clientNames(clients []models.Client) []string {
+	result := []string{}
+
+	for _, client := range clients {
+		result = append(result, client.Name)
+	}
+
+	return result
+}
+
+func TestListClients(t *testing.T) {
+	db := newTestDB(t)
+	service := NewClientService(ClientServiceConfig{DB: db})
+
+	for _, name := range []string{"Carol", "alice", "Bob", "Dave"} {
+		insertTestClient(t, db, name)
+	}
+
+	deleted := insertTestClient(t, db, "Eve")
+
+	if err := service.Delete(deleted); err != nil {
+		t.Fatalf("Delete returned an error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		filter    ClientFilter
+		want      []string
+		wantCount int
+	}{
+		{name: "everyone", filter: ClientFilter{}, want: []string{"alice", "Bob", "Carol", "Dave"}, wantCount: 4},
+		{name: "name search ignores case", filter: ClientFilter{Search: "AL"}, want: []string{"alice"}, wantCount: 1},
+		{name: "email search", filter: ClientFilter{Search: "bob@"}, want: []string{"Bob"}, wantCount: 1},
+		{name: "search with a wildcard character", filter: ClientFilter{Search: "%"}, want: []string{}, wantCount: 0},
+		{name: "first page", filter: ClientFilter{PageSize: 3}, want: []string{"alice", "Bob", "Carol"}, wantCount: 4},
+		{name: "second page", filter: ClientFilter{Page: 2, PageSize: 3}, want: []string{"Dave"}, wantCount: 4},
+		{name: "past the last page", filter: ClientFilter{Page: 3, PageSize: 3}, want: []string{}, wantCount: 4},
+		{name: "descending", filter: ClientFilter{Descending: true, PageSize: 2}, want: []string{"Dave", "Carol"}, wantCount: 4},
+		{name: "by email", filter: ClientFilter{SortBy: ClientSortEmail, Descending: true}, want: []string{"Dave", "Carol", "Bob", "alice"}, wantCount: 4},
+		{name: "newest first", filter: ClientFilter{SortBy: ClientSortCreatedAt, Descending: true, PageSize: 1}, want: []string{"Dave"}, wantCount: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clients, err := service.List(tt.filter)
+			if err != nil {
+				t.Fatalf("List returned an error: %v", err)
+			}
+
+			if got := clientNames(clients); !slices.Equal(got, tt.want) {
+				t.Errorf("clients = %v, want %v", got, tt.want)
+			}
+
+			count, err := service.Count(tt.filter)
+
+			if err != nil || count != tt.wantCount {
+				t.Errorf("Count = %d, %v; want %d", count, err, tt.wantCount)
+			}
+		})
+	}
+
+	if _, err := service.List(ClientFilter{SortBy: "password"}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("unknown sort: error = %v, want %v", err, ErrInvalidInput)
+	}
+}
+
+func TestGetAllReturnsEveryClient(t *testing.T) {
+	db := newTestDB(t)
+	service := NewClientService(ClientServiceConfig{DB: db})
+
+	want := []string{}
+
+	for i := range 120 {
+		name := fmt.Sprintf("Client %03d", i)
+		insertTestClient(t, db, name)
+		want = append(want, name)
+	}
+
+	clients, err := service.GetAll()
+	if err != nil {
+		t.Fatalf("GetAll returned an error: %v", err)
+	}
+
+	if got := clientNames(clients); !slices.Equal(got, want) {
+		t.Errorf("GetAll returned %d clients, want all %d in name order", len(got), len(want))
+	}
+}
+
+func TestRecordLogin(t *testing.T) {
+	db := newTestDB(t)
+	service := NewClientService(ClientServiceConfig{DB: db})
+
+	jane := insertTestClient(t, db, "Jane")
+	john := insertTestClient(t, db, "John")
+	now := time.Now().UTC()
+
+	logins := []models.LoginAudit{
+		{IPAddress: "203.0.113.9", UserAgent: "curl/8.0", Outcome: models.LoginOutcomeIncorrectCode, CreatedAt: now.Add(-3 * time.Minute)},
+		{ClientID: sql.NullInt64{Int64: int64(jane), Valid: true}, AccessCodeID: sql.NullInt64{Int64: 4, Valid: true}, IPAddress: "198.51.100.7", UserAgent: "Safari", Outcome: models.LoginOutcomeSuccess, CreatedAt: now.Add(-2 * time.Minute)},
+		{ClientID: sql.NullInt64{Int64: int64(john), Valid: true}, AccessCodeID: sql.NullInt64{Int64: 5, Valid: true}, IPAddress: "192.0.2.1", UserAgent: "Firefox", Outcome: models.LoginOutcomeSuccess, CreatedAt: now.Add(-time.Minute)},
+		{ClientID: sql.NullInt64{Int64: int64(jane), Valid: true}, AccessCodeID: sql.NullInt64{Int64: 4, Valid: true}, IPAddress: "198.51.100.7", UserAgent: strings.Repeat("a", 1000), Outcome: models.LoginOutcomeSuccess},
+	}
+
+	for _, login := range logins {
+		if err := service.RecordLogin(login); err != nil {
+			t.Fatalf("RecordLogin(%+v) returned an error: %v", login, err)
+		}
+	}
+
+	if err := service.RecordLogin(models.LoginAudit{Outcome: "maybe"}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("RecordLogin with an unknown outcome = %v, want ErrInvalidInput", err)
+	}
+
+	var failed int
+
+	if err := db.QueryRow(context.Background(), &failed, `SELECT COUNT(*) FROM login_audit WHERE client_id IS NULL AND outcome = ?`, models.LoginOutcomeIncorrectCode); err != nil {
+		t.Fatalf("error counting failed logins: %v", err)
+	}
+
+	if failed != 1 {
+		t.Errorf("failed logins recorded = %d, want 1", failed)
+	}
+
+	got, err := service.GetRecentLogins(jane, 10)
+	if err != nil {
+		t.Fatalf("GetRecentLogins returned an error: %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d logins for Jane, want 2", len(got))
+	}
+
+	if got[0].CreatedAt.Before(got[1].CreatedAt) {
+		t.Errorf("logins aren't newest first: %v, %v", got[0].CreatedAt, got[1].CreatedAt)
+	}
+
+	if len(got[0].UserAgent) != 512 {
+		t.Errorf("user agent length = %d, want it cut off at 512", len(got[0].UserAgent))
+	}
+
+	if got[1].IPAddress != "198.51.100.7" || got[1].AccessCodeID.Int64 != 4 || !got[1].Succeeded() {
+		t.Errorf("older login = %+v, want a success from 198.51.100.7 with access code 4", got[1])
+	}
+
+	if got, _ = service.GetRecentLogins(jane, 1); len(got) != 1 {
+		t.Errorf("got %d logins with a limit of 1, want 1", len(got))
+	}
+
+	if _, err = service.GetRecentLogins(jane, 0); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("GetRecentLogins with no limit = %v, want ErrInvalidInput", err)
+	}
+}
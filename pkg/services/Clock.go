@@ -0,0 +1,23 @@
+package services
+
+import (
+	"time"
+)
+
+/*
+Clock tells the time. Services that decide what has expired take one so
+tests can set the time instead of waiting for it.
+*/
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the real time, and the default Clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the real time, for packages outside services that take a Clock
+var SystemClock Clock = systemClock{}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDownloadTokenExpired = errors.New("download token has expired")
+	ErrDownloadTokenInvalid = errors.New("download token is not valid")
+)
+
+/*
+DownloadToken is what a download link grants: one zip of one client's album
+until ExpiresAt.
+*/
+type DownloadToken struct {
+	AlbumID   uint
+	ClientID  uint
+	ExpiresAt time.Time
+	Filename  string
+}
+
+/*
+SignDownloadToken returns an opaque token for a download link. It carries the
+token's fields and an HMAC-SHA256 of them keyed with secret, so the link
+doesn't reveal where the zip is stored and can't be altered or guessed.
+*/
+func SignDownloadToken(secret string, token DownloadToken) string {
+	payload := strings.Join([]string{
+		strconv.FormatUint(uint64(token.ClientID), 10),
+		strconv.FormatUint(uint64(token.AlbumID), 10),
+		strconv.FormatInt(token.ExpiresAt.Unix(), 10),
+		token.Filename,
+	}, ":")
+
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(signDownloadPayload(secret, payload))
+}
+
+/*
+VerifyDownloadToken checks the signature on a token made by
+SignDownloadToken and returns what it grants. A token that has been altered
+or can't be read is ErrDownloadTokenInvalid. One that is past its expiry at
+now is ErrDownloadTokenExpired.
+*/
+func VerifyDownloadToken(secret, token string, now time.Time) (DownloadToken, error) {
+	var (
+		err       error
+		payload   []byte
+		signature []byte
+		clientID  uint64
+		albumID   uint64
+		expiresAt int64
+	)
+
+	result := DownloadToken{}
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+
+	if !ok {
+		return result, ErrDownloadTokenInvalid
+	}
+
+	if payload, err = base64.RawURLEncoding.DecodeString(encodedPayload); err != nil {
+		return result, fmt.Errorf("%w: %w", ErrDownloadTokenInvalid, err)
+	}
+
+	if signature, err = base64.RawURLEncoding.DecodeString(encodedSignature); err != nil {
+		return result, fmt.Errorf("%w: %w", ErrDownloadTokenInvalid, err)
+	}
+
+	if !hmac.Equal(signature, signDownloadPayload(secret, string(payload))) {
+		return result, ErrDownloadTokenInvalid
+	}
+
+	// The filename goes last so it is free to hold colons of its own
+	fields := strings.SplitN(string(payload), ":", 4)
+
+	if len(fields) != 4 {
+		return result, ErrDownloadTokenInvalid
+	}
+
+	if clientID, err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+		return result, fmt.Errorf("%w: %w", ErrDownloadTokenInvalid, err)
+	}
+
+	if albumID, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+		return result, fmt.Errorf("%w: %w", ErrDownloadTokenInvalid, err)
+	}
+
+	if expiresAt, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+		return result, fmt.Errorf("%w: %w", ErrDownloadTokenInvalid, err)
+	}
+
+	result = DownloadToken{
+		AlbumID:   uint(albumID),
+		ClientID:  uint(clientID),
+		ExpiresAt: time.Unix(expiresAt, 0),
+		Filename:  fields[3],
+	}
+
+	if !now.Before(result.ExpiresAt) {
+		return result, ErrDownloadTokenExpired
+	}
+
+	return result, nil
+}
+
+func signDownloadPayload(secret, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var downloadLinkPattern = regexp.MustCompile(`/client/zips/([A-Za-z0-9_.%-]+)`)
+
+/*
+linkedDownload reads the token out of a download link made with secret,
+failing the test when it isn't one or doesn't verify.
+*/
+func linkedDownload(t *testing.T, secret, link string) DownloadToken {
+	t.Helper()
+
+	match := downloadLinkPattern.FindStringSubmatch(link)
+
+	if match == nil {
+		t.Fatalf("%q is not a download link", link)
+	}
+
+	token, err := url.PathUnescape(match[1])
+	if err != nil {
+		t.Fatalf("download link %q is not escaped properly: %v", link, err)
+	}
+
+	result, err := VerifyDownloadToken(secret, token, time.Now())
+	if err != nil {
+		t.Fatalf("download link %q does not verify: %v", link, err)
+	}
+
+	return result
+}
+
+// linkedFilenames lists the zips linked from body, in order, once each
+func linkedFilenames(t *testing.T, secret, body string) []string {
+	t.Helper()
+
+	result := []string{}
+	seen := map[string]bool{}
+
+	for _, link := range downloadLinkPattern.FindAllString(body, -1) {
+		filename := linkedDownload(t, secret, link).Filename
+
+		if !seen[filename] {
+			seen[filename] = true
+			result = append(result, filename)
+		}
+	}
+
+	return result
+}
+
+func TestVerifyDownloadToken(t *testing.T) {
+	now := time.Now()
+
+	granted := DownloadToken{
+		AlbumID:   5,
+		ClientID:  1,
+		ExpiresAt: now.Add(time.Hour).Truncate(time.Second),
+		Filename:  "Wedding: Part 1-5.zip",
+	}
+
+	valid := SignDownloadToken("secret", granted)
+	payload, signature, _ := strings.Cut(valid, ".")
+
+	// The same signature on a payload granting another album
+	decoded, _ := base64.RawURLEncoding.DecodeString(payload)
+	otherAlbum := base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(decoded), "1:5:", "1:6:", 1)))
+
+	tests := []struct {
+		name    string
+		secret  string
+		token   string
+		wantErr error
+	}{
+		{name: "valid", secret: "secret", token: valid},
+		{
+			name:    "expired",
+			secret:  "secret",
+			token:   SignDownloadToken("secret", DownloadToken{AlbumID: 5, ClientID: 1, ExpiresAt: now.Add(-time.Minute), Filename: "Wedding-5.zip"}),
+			wantErr: ErrDownloadTokenExpired,
+		},
+		{name: "tampered payload", secret: "secret", token: otherAlbum + "." + signature, wantErr: ErrDownloadTokenInvalid},
+		{name: "tampered signature", secret: "secret", token: payload + "." + strings.Repeat("A", len(signature)), wantErr: ErrDownloadTokenInvalid},
+		{name: "signed with another secret", secret: "other", token: valid, wantErr: ErrDownloadTokenInvalid},
+		{name: "not a token", secret: "secret", token: "Wedding-5.zip", wantErr: ErrDownloadTokenInvalid},
+		{name: "not base64", secret: "secret", token: "!!!.???", wantErr: ErrDownloadTokenInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyDownloadToken(tt.secret, tt.token, now)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got.AlbumID != granted.AlbumID || got.ClientID != granted.ClientID || got.Filename != granted.Filename || !got.ExpiresAt.Equal(granted.ExpiresAt) {
+				t.Errorf("token grants %+v, want %+v", got, granted)
+			}
+		})
+	}
+}
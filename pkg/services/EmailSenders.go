@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/adampresley/adamgokit/email"
+	"github.com/resend/resend-go/v2"
+	"gopkg.in/gomail.v2"
+)
+
+/*
+ResendEmailSender sends email through the Resend API.
+*/
+type ResendEmailSender struct {
+	client *resend.Client
+}
+
+func NewResendEmailSender(apiKey string) ResendEmailSender {
+	return ResendEmailSender{
+		client: resend.NewClient(apiKey),
+	}
+}
+
+func (s ResendEmailSender) Send(mail EmailMessage) error {
+	to := make([]string, 0, len(mail.To))
+
+	for _, address := range mail.To {
+		to = append(to, address.Email)
+	}
+
+	request := &resend.SendEmailRequest{
+		From:    formatAddress(mail.From),
+		To:      to,
+		Subject: mail.Subject,
+		Html:    mail.HtmlBody,
+		Text:    mail.TextBody,
+	}
+
+	if mail.ReplyTo != nil {
+		request.ReplyTo = formatAddress(*mail.ReplyTo)
+	}
+
+	_, err := s.client.Emails.Send(request)
+
+	return err
+}
+
+/*
+SmtpEmailSender sends email through an SMTP server.
+*/
+type SmtpEmailSender struct {
+	dialer *gomail.Dialer
+}
+
+func NewSmtpEmailSender(host string, port int, userName, password string) SmtpEmailSender {
+	return SmtpEmailSender{
+		dialer: gomail.NewDialer(host, port, userName, password),
+	}
+}
+
+func (s SmtpEmailSender) Send(mail EmailMessage) error {
+	m := gomail.NewMessage()
+	m.SetAddressHeader("From", mail.From.Email, mail.From.Name)
+	m.SetHeader("Subject", mail.Subject)
+
+	for _, address := range mail.To {
+		m.SetAddressHeader("To", address.Email, address.Name)
+	}
+
+	if mail.ReplyTo != nil {
+		m.SetAddressHeader("Reply-To", mail.ReplyTo.Email, mail.ReplyTo.Name)
+	}
+
+	/*
+	 * The last part is the preferred one in multipart/alternative, so
+	 * plain text goes first.
+	 */
+	switch {
+	case mail.TextBody != "" && mail.HtmlBody != "":
+		m.SetBody("text/plain", mail.TextBody)
+		m.AddAlternative("text/html", mail.HtmlBody)
+
+	case mail.HtmlBody != "":
+		m.SetBody("text/html", mail.HtmlBody)
+
+	default:
+		m.SetBody("text/plain", mail.TextBody)
+	}
+
+	return s.dialer.DialAndSend(m)
+}
+
+func formatAddress(address email.EmailAddress) string {
+	if address.Name == "" {
+		return address.Email
+	}
+
+	return fmt.Sprintf("%s <%s>", address.Name, address.Email)
+}
@@ -1,42 +1,223 @@
 package services
 
 import (
+	"fmt"
 	"html/template"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
 	"strings"
+	texttemplate "text/template"
 
 	"github.com/adampresley/adamgokit/email"
 )
 
-func SendEmail(apiKey, toName, toEmail, fromName, fromEmail string, data map[string]any) error {
-	parsedTemplate := strings.Builder{}
+const (
+	DefaultDownloadReadySubject = "Your photos download is ready!"
 
-	service := email.NewResendService(&email.Config{
-		ApiKey: apiKey,
-	})
-
-	tmpl := `
+	defaultDownloadReadyTemplate = `
 <h1>Your photo album is ready!</h1>
 <p>Hello {{.toName}}! The photos download you requested is now
 ready. You can click the button below to download the album '{{.albumName}}'
-as a ZIP file containing your photos. This link will expire in 2 days.</p>
+as a ZIP file containing your photos. This link will expire in {{.expirationDays}} days.</p>
+{{with .downloadParts}}
+<p>This album is too large for a single file, so it was split into {{len .}} parts.
+Download each part to get all of your photos.</p>
+<ul>
+{{range .}}<li><a href="{{.url}}">Download Part {{.number}}</a></li>
+{{end}}</ul>
+{{else}}
 <a href="{{.downloadURL}}">Download Album</a>
+{{end}}
 	`
 
-	data["toName"] = toName
+	defaultDownloadReadyTextTemplate = `Your photo album is ready!
+
+Hello {{.toName}}! The photos download you requested is now ready. Use the
+link below to download the album '{{.albumName}}' as a ZIP file containing
+your photos. This link will expire in {{.expirationDays}} days.
+{{with .downloadParts}}
+This album is too large for a single file, so it was split into {{len .}}
+parts. Download each part to get all of your photos.
+{{range .}}
+Part {{.number}}: {{.url}}{{end}}
+{{else}}
+{{.downloadURL}}
+{{end}}`
+)
+
+const (
+	EmailProviderResend = "resend"
+	EmailProviderSmtp   = "smtp"
+)
+
+/*
+EmailMessage is an email with both an HTML and a plain text body. Senders
+deliver it as multipart/alternative when both bodies are present. ReplyTo
+is optional.
+*/
+type EmailMessage struct {
+	From     email.EmailAddress
+	HtmlBody string
+	ReplyTo  *email.EmailAddress
+	Subject  string
+	TextBody string
+	To       []email.EmailAddress
+}
+
+/*
+EmailSender sends a single email.
+*/
+type EmailSender interface {
+	Send(mail EmailMessage) error
+}
+
+type EmailSenderConfig struct {
+	ApiKey       string
+	Provider     string
+	SmtpHost     string
+	SmtpPassword string
+	SmtpPort     int
+	SmtpUser     string
+}
+
+/*
+NewEmailSender returns an EmailSender for the configured provider. An empty
+provider defaults to Resend.
+*/
+func NewEmailSender(config EmailSenderConfig) (EmailSender, error) {
+	switch strings.ToLower(config.Provider) {
+	case "", EmailProviderResend:
+		return NewResendEmailSender(config.ApiKey), nil
+
+	case EmailProviderSmtp:
+		if config.SmtpHost == "" {
+			return nil, fmt.Errorf("smtp email provider requires a host")
+		}
+
+		return NewSmtpEmailSender(config.SmtpHost, config.SmtpPort, config.SmtpUser, config.SmtpPassword), nil
+
+	default:
+		return nil, fmt.Errorf("unknown email provider '%s'", config.Provider)
+	}
+}
+
+/*
+EmailTemplate is the subject and body templates used for an outgoing email.
+Body is a Go html/template, TextBody is a Go text/template.
+*/
+type EmailTemplate struct {
+	Subject  string
+	Body     string
+	TextBody string
+}
+
+/*
+LoadEmailTemplate reads an email body template from the provided file system.
+The plain text template is read from a file next to it with a .txt extension.
+If either file can't be read the built-in download ready template is used instead.
+*/
+func LoadEmailTemplate(fsys fs.FS, path, subject string) EmailTemplate {
+	result := EmailTemplate{
+		Subject:  subject,
+		Body:     defaultDownloadReadyTemplate,
+		TextBody: defaultDownloadReadyTextTemplate,
+	}
+
+	if result.Subject == "" {
+		result.Subject = DefaultDownloadReadySubject
+	}
+
+	if fsys == nil || path == "" {
+		return result
+	}
 
-	t := template.Must(template.New("email").Parse(tmpl))
-	_ = t.Execute(&parsedTemplate, data)
+	if b, err := fs.ReadFile(fsys, path); err != nil {
+		slog.Warn("unable to read email template. using the default", "path", path, "error", err)
+	} else {
+		result.Body = string(b)
+	}
 
-	return service.Send(email.Mail{
-		Body:       parsedTemplate.String(),
-		BodyIsHtml: true,
+	textPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".txt"
+
+	if b, err := fs.ReadFile(fsys, textPath); err != nil {
+		slog.Warn("unable to read plain text email template. using the default", "path", textPath, "error", err)
+	} else {
+		result.TextBody = string(b)
+	}
+
+	return result
+}
+
+func SendEmail(sender EmailSender, toName, toEmail, fromName, fromEmail string, emailTemplate EmailTemplate, data map[string]any) error {
+	if !email.IsValidEmailAddress(toEmail) {
+		return Permanent(fmt.Errorf("invalid email address '%s'", toEmail))
+	}
+
+	if emailTemplate.Subject == "" {
+		emailTemplate.Subject = DefaultDownloadReadySubject
+	}
+
+	data["toName"] = toName
+
+	return sender.Send(EmailMessage{
 		From: email.EmailAddress{
 			Email: fromEmail,
 			Name:  fromName,
 		},
-		Subject: "Your photos download is ready!",
+		HtmlBody: renderHtmlEmail(emailTemplate.Body, data),
+		Subject:  emailTemplate.Subject,
+		TextBody: renderTextEmail(emailTemplate.TextBody, data),
 		To: []email.EmailAddress{
 			{Name: toName, Email: toEmail},
 		},
 	})
 }
+
+func renderHtmlEmail(body string, data map[string]any) string {
+	var (
+		err error
+		t   *template.Template
+	)
+
+	result := strings.Builder{}
+
+	if t, err = template.New("email").Parse(body); err != nil || body == "" {
+		slog.Warn("unable to parse email template. using the default", "error", err)
+		t = template.Must(template.New("email").Parse(defaultDownloadReadyTemplate))
+	}
+
+	if err = t.Execute(&result, data); err != nil {
+		slog.Warn("unable to execute email template. using the default", "error", err)
+		result.Reset()
+
+		t = template.Must(template.New("email").Parse(defaultDownloadReadyTemplate))
+		_ = t.Execute(&result, data)
+	}
+
+	return result.String()
+}
+
+func renderTextEmail(body string, data map[string]any) string {
+	var (
+		err error
+		t   *texttemplate.Template
+	)
+
+	result := strings.Builder{}
+
+	if t, err = texttemplate.New("email").Parse(body); err != nil || body == "" {
+		slog.Warn("unable to parse plain text email template. using the default", "error", err)
+		t = texttemplate.Must(texttemplate.New("email").Parse(defaultDownloadReadyTextTemplate))
+	}
+
+	if err = t.Execute(&result, data); err != nil {
+		slog.Warn("unable to execute plain text email template. using the default", "error", err)
+		result.Reset()
+
+		t = texttemplate.Must(texttemplate.New("email").Parse(defaultDownloadReadyTextTemplate))
+		_ = t.Execute(&result, data)
+	}
+
+	return result.String()
+}
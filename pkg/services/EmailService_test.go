@@ -0,0 +1,199 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+/*
+recordingEmailSender keeps sent messages in memory. When errs is set, each
+send returns the next error in it until they run out.
+*/
+type recordingEmailSender struct {
+	mu   sync.Mutex
+	errs []error
+	sent []EmailMessage
+}
+
+func (s *recordingEmailSender) Send(mail EmailMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = append(s.sent, mail)
+
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+
+	return nil
+}
+
+func (s *recordingEmailSender) messages() []EmailMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]EmailMessage{}, s.sent...)
+}
+
+func downloadReadyData(expirationDays int) map[string]any {
+	return map[string]any{
+		"albumName":      "Wedding",
+		"downloadURL":    "https://example.com/client/library/5/downloads/job.zip",
+		"expirationDays": expirationDays,
+		"name":           "Jane",
+	}
+}
+
+func TestEmailReflectsTheConfiguredExpiration(t *testing.T) {
+	templates := []struct {
+		name     string
+		template EmailTemplate
+	}{
+		{name: "app template", template: LoadEmailTemplate(os.DirFS("../../cmd/website/app"), "emails/download-ready.html", "")},
+		{name: "default template", template: LoadEmailTemplate(nil, "", "")},
+	}
+
+	for _, tt := range templates {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &recordingEmailSender{}
+
+			if err := SendEmail(sender, "Jane", "jane@example.com", "Adam", "adam@example.com", tt.template, downloadReadyData(3)); err != nil {
+				t.Fatalf("SendEmail returned an error: %v", err)
+			}
+
+			mail := sender.messages()[0]
+
+			if !strings.Contains(mail.HtmlBody, "expire in 3 days") {
+				t.Errorf("body = %q, want the configured 3 day expiration", mail.HtmlBody)
+			}
+
+			if strings.Contains(mail.HtmlBody, "2 days") {
+				t.Errorf("body = %q, still mentions 2 days", mail.HtmlBody)
+			}
+		})
+	}
+}
+
+func TestLoadEmailTemplate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"emails/custom.html": {Data: []byte(`<p>{{.albumName}} expires in {{.expirationDays}} days</p>`)},
+	}
+
+	custom := LoadEmailTemplate(fsys, "emails/custom.html", "Custom subject")
+
+	if custom.Subject != "Custom subject" {
+		t.Errorf("subject = %q, want %q", custom.Subject, "Custom subject")
+	}
+
+	if custom.Body != `<p>{{.albumName}} expires in {{.expirationDays}} days</p>` {
+		t.Errorf("body = %q, want the custom template", custom.Body)
+	}
+
+	missing := LoadEmailTemplate(fsys, "emails/missing.html", "")
+
+	if missing.Subject != DefaultDownloadReadySubject {
+		t.Errorf("subject = %q, want the default %q", missing.Subject, DefaultDownloadReadySubject)
+	}
+
+	if missing.Body != defaultDownloadReadyTemplate {
+		t.Errorf("a missing template did not fall back to the default: %q", missing.Body)
+	}
+}
+
+func TestBrokenEmailTemplateFallsBackToTheDefault(t *testing.T) {
+	sender := &recordingEmailSender{}
+	broken := EmailTemplate{Body: `<p>{{.albumName</p>`}
+
+	if err := SendEmail(sender, "Jane", "jane@example.com", "Adam", "adam@example.com", broken, downloadReadyData(5)); err != nil {
+		t.Fatalf("SendEmail returned an error: %v", err)
+	}
+
+	mail := sender.messages()[0]
+
+	if !strings.Contains(mail.HtmlBody, "expire in 5 days") {
+		t.Errorf("body = %q, want the default template", mail.HtmlBody)
+	}
+
+	if mail.Subject != DefaultDownloadReadySubject {
+		t.Errorf("subject = %q, want the default %q", mail.Subject, DefaultDownloadReadySubject)
+	}
+}
+
+func TestNewEmailSender(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  EmailSenderConfig
+		want    EmailSender
+		wantErr bool
+	}{
+		{name: "default", config: EmailSenderConfig{ApiKey: "key"}, want: ResendEmailSender{}},
+		{name: "resend", config: EmailSenderConfig{Provider: "Resend", ApiKey: "key"}, want: ResendEmailSender{}},
+		{name: "smtp", config: EmailSenderConfig{Provider: "smtp", SmtpHost: "localhost", SmtpPort: 25}, want: SmtpEmailSender{}},
+		{name: "smtp without a host", config: EmailSenderConfig{Provider: "smtp"}, wantErr: true},
+		{name: "unknown provider", config: EmailSenderConfig{Provider: "pigeon"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender, err := NewEmailSender(tt.config)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("NewEmailSender returned %T, want an error", sender)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("NewEmailSender returned an error: %v", err)
+			}
+
+			if fmt.Sprintf("%T", sender) != fmt.Sprintf("%T", tt.want) {
+				t.Errorf("sender = %T, want %T", sender, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmailHasHtmlAndPlainTextParts(t *testing.T) {
+	templates := []struct {
+		name     string
+		template EmailTemplate
+	}{
+		{name: "app template", template: LoadEmailTemplate(os.DirFS("../../cmd/website/app"), "emails/download-ready.html", "")},
+		{name: "default template", template: LoadEmailTemplate(nil, "", "")},
+	}
+
+	for _, tt := range templates {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &recordingEmailSender{}
+			data := downloadReadyData(3)
+			data["albumName"] = "Smith & Jones"
+
+			if err := SendEmail(sender, "Jane", "jane@example.com", "Adam", "adam@example.com", tt.template, data); err != nil {
+				t.Fatalf("SendEmail returned an error: %v", err)
+			}
+
+			mail := sender.messages()[0]
+
+			if !strings.Contains(mail.HtmlBody, "<a href=") || !strings.Contains(mail.HtmlBody, "Smith &amp; Jones") {
+				t.Errorf("html body = %q, want an escaped HTML body with a link", mail.HtmlBody)
+			}
+
+			if !strings.Contains(mail.TextBody, "https://example.com/client/library/5/downloads/job.zip") {
+				t.Errorf("text body = %q, want it to contain the download URL", mail.TextBody)
+			}
+
+			if strings.Contains(mail.TextBody, "<") || !strings.Contains(mail.TextBody, "Smith & Jones") {
+				t.Errorf("text body = %q, want plain unescaped text", mail.TextBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	/*
+	 * ErrInvalidInput is wrapped by errors describing bad input, such as a
+	 * missing required field, so callers can tell them apart from failures
+	 */
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+/*
+notFoundError is returned when a record doesn't exist. It matches both the
+service's sentinel, such as ErrAlbumNotFound, and sql.ErrNoRows, so callers
+that check with sqlz.IsNotFound keep working.
+*/
+type notFoundError struct {
+	message  string
+	sentinel error
+}
+
+func (e notFoundError) Error() string {
+	return e.message
+}
+
+func (e notFoundError) Unwrap() []error {
+	return []error{e.sentinel, stdsql.ErrNoRows}
+}
+
+/*
+notFound returns a notFoundError for sentinel, described by format and args.
+*/
+func notFound(sentinel error, format string, args ...any) error {
+	return notFoundError{
+		message:  fmt.Sprintf(format, args...),
+		sentinel: sentinel,
+	}
+}
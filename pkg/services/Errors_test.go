@@ -0,0 +1,110 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rfberaldo/sqlz"
+)
+
+func TestServicesReturnTypedNotFoundErrors(t *testing.T) {
+	db := newTestDB(t)
+	albums := NewAlbumService(AlbumServiceConfig{DB: db})
+	clients := NewClientService(ClientServiceConfig{DB: db})
+
+	clientID := insertTestClient(t, db, "Jane")
+	otherClientID := insertTestClient(t, db, "John")
+	albumID := insertTestAlbum(t, db, clientID, "Wedding", time.Now(), nil)
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{
+			name: "album that doesn't exist",
+			call: func() error { _, err := albums.GetAlbum(clientID, 999); return err },
+			want: ErrAlbumNotFound,
+		},
+		{
+			name: "another client's album",
+			call: func() error { _, err := albums.GetAlbum(otherClientID, albumID); return err },
+			want: ErrAlbumAccessDenied,
+		},
+		{
+			name: "album by id that doesn't exist",
+			call: func() error { _, err := albums.GetAlbumByID(999); return err },
+			want: ErrAlbumNotFound,
+		},
+		{
+			name: "deleting an album that doesn't exist",
+			call: func() error { return albums.DeleteAlbum(clientID, 999) },
+			want: ErrAlbumNotFound,
+		},
+		{
+			name: "favorite limit for an album that doesn't exist",
+			call: func() error { return albums.SetMaxFavorites(999, sql.NullInt64{Int64: 20, Valid: true}) },
+			want: ErrAlbumNotFound,
+		},
+		{
+			name: "access code for a client that doesn't exist",
+			call: func() error { _, err := clients.AddAccessCode(999, "", "Grandma"); return err },
+			want: ErrClientNotFound,
+		},
+		{
+			name: "revoking an access code that doesn't exist",
+			call: func() error { return clients.RevokeAccessCode(clientID, 999) },
+			want: ErrAccessCodeNotFound,
+		},
+		{
+			name: "deleting a client that doesn't exist",
+			call: func() error { return clients.Delete(999) },
+			want: ErrClientNotFound,
+		},
+		{
+			name: "session generation for a client that doesn't exist",
+			call: func() error { _, err := clients.GetSessionGeneration(999); return err },
+			want: ErrClientNotFound,
+		},
+		{
+			name: "notification preference for a client that doesn't exist",
+			call: func() error { _, err := clients.GetNotificationPreference(999); return err },
+			want: ErrClientNotFound,
+		},
+		{
+			name: "invalidating sessions for a client that doesn't exist",
+			call: func() error { return clients.InvalidateSessions(999) },
+			want: ErrClientNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+
+			// Callers that still check for sql.ErrNoRows keep working
+			if !sqlz.IsNotFound(err) {
+				t.Errorf("sqlz.IsNotFound(%v) = false, want true", err)
+			}
+		})
+	}
+}
+
+func TestAnotherClientsAlbumIsNotReportedAsMissing(t *testing.T) {
+	db := newTestDB(t)
+	albums := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	clientID := insertTestClient(t, db, "Jane")
+	otherClientID := insertTestClient(t, db, "John")
+	albumID := insertTestAlbum(t, db, clientID, "Wedding", time.Now(), nil)
+
+	if _, err := albums.GetAlbum(otherClientID, albumID); errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("error = %v, want it to be only %v", err, ErrAlbumAccessDenied)
+	}
+}
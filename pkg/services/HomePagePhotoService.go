@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/rfberaldo/sqlz"
+)
+
+type HomePagePhotoServicer interface {
+	GetFlags() (map[string]models.HomePagePhotoFlag, error)
+	GetListing(folder string) (CachedListing, error)
+	SaveListing(folder string, objects []s3.Object, complete bool) error
+	SetFlags(fileName string, hidden, featured bool) (models.HomePagePhotoFlag, error)
+}
+
+type HomePagePhotoServiceConfig struct {
+	DB *sqlz.DB
+}
+
+type HomePagePhotoService struct {
+	db *sqlz.DB
+}
+
+/*
+CachedListing is the last successful S3 listing of a home page folder.
+Complete is false when listing stopped before the end of the folder.
+*/
+type CachedListing struct {
+	Objects   []s3.Object
+	Complete  bool
+	UpdatedAt time.Time
+}
+
+// listedObject is what is kept of each object in a cached listing
+type listedObject struct {
+	Key          string    `json:"key"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+func NewHomePagePhotoService(config HomePagePhotoServiceConfig) HomePagePhotoService {
+	return HomePagePhotoService{
+		db: config.DB,
+	}
+}
+
+/*
+GetFlags returns the flags for every home page photo that has any, keyed
+by file name.
+*/
+func (s HomePagePhotoService) GetFlags() (map[string]models.HomePagePhotoFlag, error) {
+	var (
+		err   error
+		flags []models.HomePagePhotoFlag
+	)
+
+	sql := `
+SELECT
+   f.file_name
+   , f.hidden
+   , f.featured
+   , f.updated_at
+FROM home_page_photo_flags AS f
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.Query(ctx, &flags, sql); err != nil {
+		return nil, fmt.Errorf("error querying for home page photo flags: %w", err)
+	}
+
+	result := make(map[string]models.HomePagePhotoFlag, len(flags))
+
+	for _, flag := range flags {
+		result[flag.FileName] = flag
+	}
+
+	return result, nil
+}
+
+/*
+SetFlags stores the flags for a home page photo. Clearing both flags
+removes the row, so the photo goes back to being shown as usual.
+*/
+func (s HomePagePhotoService) SetFlags(fileName string, hidden, featured bool) (models.HomePagePhotoFlag, error) {
+	var (
+		err error
+	)
+
+	if fileName == "" {
+		return models.HomePagePhotoFlag{}, fmt.Errorf("%w: a file name is required", ErrInvalidInput)
+	}
+
+	result := models.HomePagePhotoFlag{
+		FileName:  fileName,
+		Hidden:    hidden,
+		Featured:  featured,
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if !hidden && !featured {
+		if _, err = s.db.Exec(ctx, `DELETE FROM home_page_photo_flags WHERE file_name=?`, fileName); err != nil {
+			return models.HomePagePhotoFlag{}, fmt.Errorf("error clearing home page photo flags for '%s': %w", fileName, err)
+		}
+
+		return result, nil
+	}
+
+	sql := `
+INSERT INTO home_page_photo_flags (
+    file_name,
+    hidden,
+    featured,
+    updated_at
+) VALUES (?, ?, ?, ?)
+ON CONFLICT (file_name) DO UPDATE SET
+    hidden = excluded.hidden,
+    featured = excluded.featured,
+    updated_at = excluded.updated_at
+`
+
+	if _, err = s.db.Exec(ctx, sql, fileName, hidden, featured, result.UpdatedAt); err != nil {
+		return models.HomePagePhotoFlag{}, fmt.Errorf("error setting home page photo flags for '%s': %w", fileName, err)
+	}
+
+	return result, nil
+}
+
+/*
+GetListing returns the cached listing of a home page folder. When nothing
+has been cached for the folder the error wraps sql.ErrNoRows.
+*/
+func (s HomePagePhotoService) GetListing(folder string) (CachedListing, error) {
+	var (
+		err     error
+		listing models.HomePageListing
+		objects []listedObject
+	)
+
+	sql := `
+SELECT
+   l.folder
+   , l.objects
+   , l.complete
+   , l.updated_at
+FROM home_page_listings AS l
+WHERE l.folder=?
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err = s.db.QueryRow(ctx, &listing, sql, folder); err != nil {
+		return CachedListing{}, fmt.Errorf("error querying for the cached listing of '%s': %w", folder, err)
+	}
+
+	if err = json.Unmarshal([]byte(listing.Objects), &objects); err != nil {
+		return CachedListing{}, fmt.Errorf("error reading the cached listing of '%s': %w", folder, err)
+	}
+
+	result := CachedListing{
+		Objects:   make([]s3.Object, 0, len(objects)),
+		Complete:  listing.Complete,
+		UpdatedAt: listing.UpdatedAt,
+	}
+
+	for _, object := range objects {
+		result.Objects = append(result.Objects, s3.Object{Key: object.Key, LastModified: object.LastModified})
+	}
+
+	return result, nil
+}
+
+/*
+SaveListing replaces the cached listing of a home page folder with the
+objects from a successful listing.
+*/
+func (s HomePagePhotoService) SaveListing(folder string, objects []s3.Object, complete bool) error {
+	var (
+		err  error
+		body []byte
+	)
+
+	if folder == "" {
+		return fmt.Errorf("%w: a folder is required", ErrInvalidInput)
+	}
+
+	listed := make([]listedObject, 0, len(objects))
+
+	for _, object := range objects {
+		listed = append(listed, listedObject{Key: object.Key, LastModified: object.LastModified})
+	}
+
+	if body, err = json.Marshal(listed); err != nil {
+		return fmt.Errorf("error encoding the listing of '%s': %w", folder, err)
+	}
+
+	sql := `
+INSERT INTO home_page_listings (
+    folder,
+    objects,
+    complete,
+    updated_at
+) VALUES (?, ?, ?, ?)
+ON CONFLICT (folder) DO UPDATE SET
+    objects = excluded.objects,
+    complete = excluded.complete,
+    updated_at = excluded.updated_at
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if _, err = s.db.Exec(ctx, sql, folder, string(body), complete, time.Now().UTC()); err != nil {
+		return fmt.Errorf("error saving the listing of '%s': %w", folder, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/rfberaldo/sqlz"
+)
+
+func TestHomePagePhotoFlags(t *testing.T) {
+	db := newTestDB(t)
+	service := NewHomePagePhotoService(HomePagePhotoServiceConfig{DB: db})
+
+	if _, err := service.SetFlags("beach.jpg", true, false); err != nil {
+		t.Fatalf("SetFlags returned an error: %v", err)
+	}
+
+	if _, err := service.SetFlags("portrait.jpg", false, true); err != nil {
+		t.Fatalf("SetFlags returned an error: %v", err)
+	}
+
+	// Setting a photo's flags again replaces them
+	if _, err := service.SetFlags("beach.jpg", true, true); err != nil {
+		t.Fatalf("SetFlags returned an error: %v", err)
+	}
+
+	flags, err := service.GetFlags()
+	if err != nil {
+		t.Fatalf("GetFlags returned an error: %v", err)
+	}
+
+	if len(flags) != 2 {
+		t.Fatalf("got %d flagged photos, want 2", len(flags))
+	}
+
+	if beach := flags["beach.jpg"]; !beach.Hidden || !beach.Featured {
+		t.Errorf("beach.jpg = %+v, want hidden and featured", beach)
+	}
+
+	if portrait := flags["portrait.jpg"]; portrait.Hidden || !portrait.Featured {
+		t.Errorf("portrait.jpg = %+v, want only featured", portrait)
+	}
+
+	// Clearing both flags forgets the photo
+	if _, err = service.SetFlags("beach.jpg", false, false); err != nil {
+		t.Fatalf("SetFlags returned an error: %v", err)
+	}
+
+	if flags, _ = service.GetFlags(); len(flags) != 1 {
+		t.Errorf("got %d flagged photos after clearing, want 1", len(flags))
+	}
+
+	if _, err = service.SetFlags("", true, false); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("SetFlags with no file name error = %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestHomePageListings(t *testing.T) {
+	db := newTestDB(t)
+	service := NewHomePagePhotoService(HomePagePhotoServiceConfig{DB: db})
+
+	if _, err := service.GetListing("home-page/thumbnail"); !sqlz.IsNotFound(err) {
+		t.Fatalf("GetListing before anything is saved error = %v, want not found", err)
+	}
+
+	uploaded := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+
+	if err := service.SaveListing("home-page/thumbnail", []s3.Object{{Key: "home-page/thumbnail/a.jpg"}}, false); err != nil {
+		t.Fatalf("SaveListing returned an error: %v", err)
+	}
+
+	// Saving again replaces the listing
+	objects := []s3.Object{
+		{Key: "home-page/thumbnail/a.jpg", LastModified: uploaded},
+		{Key: "home-page/thumbnail/b.jpg", LastModified: uploaded},
+	}
+
+	if err := service.SaveListing("home-page/thumbnail", objects, true); err != nil {
+		t.Fatalf("SaveListing returned an error: %v", err)
+	}
+
+	listing, err := service.GetListing("home-page/thumbnail")
+	if err != nil {
+		t.Fatalf("GetListing returned an error: %v", err)
+	}
+
+	keys := []string{}
+
+	for _, object := range listing.Objects {
+		keys = append(keys, object.Key)
+
+		if !object.LastModified.Equal(uploaded) {
+			t.Errorf("%s last modified = %v, want %v", object.Key, object.LastModified, uploaded)
+		}
+	}
+
+	if want := []string{"home-page/thumbnail/a.jpg", "home-page/thumbnail/b.jpg"}; !slices.Equal(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+
+	if !listing.Complete || listing.UpdatedAt.IsZero() {
+		t.Errorf("listing = %+v, want complete with an update time", listing)
+	}
+
+	if err = service.SaveListing("", objects, true); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("SaveListing with no folder error = %v, want ErrInvalidInput", err)
+	}
+}
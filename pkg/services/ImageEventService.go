@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+	"github.com/rfberaldo/sqlz"
+)
+
+type ImageEventServicer interface {
+	Record(events ...models.ImageEvent)
+	Start()
+	Stop()
+}
+
+type ImageEventServiceConfig struct {
+	BatchSize     int
+	BufferSize    int
+	DB            *sqlz.DB
+	FlushInterval time.Duration
+}
+
+/*
+ImageEventService records image views and downloads. Events are queued and
+written in batches by a background goroutine so recording never blocks the
+request path. If the queue is full, events are dropped with a warning.
+*/
+type ImageEventService struct {
+	batchSize     int
+	db            *sqlz.DB
+	events        chan models.ImageEvent
+	flushInterval time.Duration
+	stop          chan struct{}
+	wg            *sync.WaitGroup
+}
+
+func NewImageEventService(config ImageEventServiceConfig) ImageEventService {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+
+	if config.BufferSize <= 0 {
+		config.BufferSize = 1000
+	}
+
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second * 5
+	}
+
+	return ImageEventService{
+		batchSize:     config.BatchSize,
+		db:            config.DB,
+		events:        make(chan models.ImageEvent, config.BufferSize),
+		flushInterval: config.FlushInterval,
+		stop:          make(chan struct{}),
+		wg:            &sync.WaitGroup{},
+	}
+}
+
+/*
+Record queues events to be written. It never blocks.
+*/
+func (s ImageEventService) Record(events ...models.ImageEvent) {
+	for _, event := range events {
+		if event.CreatedAt.IsZero() {
+			event.CreatedAt = time.Now().UTC()
+		}
+
+		select {
+		case s.events <- event:
+		default:
+			slog.Warn("image event queue is full. dropping event", "eventType", event.EventType, "imagePath", event.ImagePath)
+		}
+	}
+}
+
+/*
+Start begins writing queued events in the background.
+*/
+func (s ImageEventService) Start() {
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.flushInterval)
+		defer ticker.Stop()
+
+		batch := make([]models.ImageEvent, 0, s.batchSize)
+
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+
+			if err := s.insert(batch); err != nil {
+				slog.Error("error writing image events", "count", len(batch), "error", err)
+			}
+
+			batch = batch[:0]
+		}
+
+		for {
+			select {
+			case event := <-s.events:
+				batch = append(batch, event)
+
+				if len(batch) >= s.batchSize {
+					flush()
+				}
+
+			case <-ticker.C:
+				flush()
+
+			case <-s.stop:
+				/*
+				 * Drain anything still queued before exiting
+				 */
+				for {
+					select {
+					case event := <-s.events:
+						batch = append(batch, event)
+
+						if len(batch) >= s.batchSize {
+							flush()
+						}
+
+					default:
+						flush()
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+/*
+Stop writes any queued events and stops the background writer.
+*/
+func (s ImageEventService) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s ImageEventService) insert(events []models.ImageEvent) error {
+	var (
+		err error
+	)
+
+	placeholders := make([]string, 0, len(events))
+	params := make([]any, 0, len(events)*5)
+
+	for _, event := range events {
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?)")
+		params = append(params, event.ClientID, event.AlbumID, event.ImagePath, event.EventType, event.CreatedAt)
+	}
+
+	sql := `
+INSERT INTO image_events (
+    client_id,
+    album_id,
+    image_path,
+    event_type,
+    created_at
+) VALUES ` + strings.Join(placeholders, ", ")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if _, err = s.db.Exec(ctx, sql, params...); err != nil {
+		return fmt.Errorf("error inserting %d image events: %w", len(events), err)
+	}
+
+	return nil
+}
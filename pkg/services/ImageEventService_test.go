@@ -0,0 +1,59 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+func TestImageEventsAreCountedPerImage(t *testing.T) {
+	db := newTestDB(t)
+	albumService := NewAlbumService(AlbumServiceConfig{DB: db})
+
+	eventService := NewImageEventService(ImageEventServiceConfig{
+		BatchSize:     2,
+		DB:            db,
+		FlushInterval: time.Hour,
+	})
+
+	eventService.Start()
+
+	event := func(imagePath, eventType string) models.ImageEvent {
+		return models.ImageEvent{ClientID: 1, AlbumID: 2, ImagePath: imagePath, EventType: eventType}
+	}
+
+	eventService.Record(
+		event("a.jpg", models.ImageEventView),
+		event("a.jpg", models.ImageEventView),
+		event("a.jpg", models.ImageEventDownload),
+		event("b.jpg", models.ImageEventView),
+		event("c.jpg", models.ImageEventDownload),
+		event("c.jpg", models.ImageEventDownload),
+		models.ImageEvent{ClientID: 9, AlbumID: 2, ImagePath: "a.jpg", EventType: models.ImageEventView},
+	)
+
+	// Stop flushes whatever is still queued
+	eventService.Stop()
+
+	stats, err := albumService.GetImageStats(1, 2)
+	if err != nil {
+		t.Fatalf("GetImageStats returned an error: %v", err)
+	}
+
+	want := []models.ImageStat{
+		{ImagePath: "c.jpg", Views: 0, Downloads: 2},
+		{ImagePath: "a.jpg", Views: 2, Downloads: 1},
+		{ImagePath: "b.jpg", Views: 1, Downloads: 0},
+	}
+
+	if len(stats) != len(want) {
+		t.Fatalf("stats = %+v, want %+v", stats, want)
+	}
+
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Errorf("stats[%d] = %+v, want %+v", i, stats[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/geturloptions"
+)
+
+const (
+	DefaultImageUrlExpiration = time.Minute * 60
+)
+
+/*
+CdnURL returns the URL of an S3 key behind a CDN at baseURL. Each segment
+of the key is path escaped, so spaces and other reserved characters in file
+names survive, while the slashes between folders are kept.
+*/
+func CdnURL(baseURL, key string) string {
+	segments := strings.Split(strings.TrimPrefix(key, "/"), "/")
+
+	for index, segment := range segments {
+		segments[index] = url.PathEscape(segment)
+	}
+
+	return strings.TrimSuffix(baseURL, "/") + "/" + strings.Join(segments, "/")
+}
+
+/*
+ImageURL returns a URL the browser can load an image from. When cdnBaseURL
+is set the image goes through the CDN. Otherwise a presigned S3 URL is
+made with options.
+*/
+func ImageURL(client s3.S3Client, bucket, cdnBaseURL, key string, options ...geturloptions.GetUrlOption) (string, error) {
+	if cdnBaseURL != "" {
+		return CdnURL(cdnBaseURL, key), nil
+	}
+
+	return client.GetUrl(bucket, key, options...)
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/geturloptions"
+)
+
+/*
+presigningS3Client hands out fake presigned URLs. Anything else panics
+through the nil embedded interface.
+*/
+type presigningS3Client struct {
+	s3.S3Client
+}
+
+func (c presigningS3Client) GetUrl(bucket, key string, options ...geturloptions.GetUrlOption) (string, error) {
+	return "https://" + bucket + ".s3.example.com/" + key + "?X-Amz-Signature=abc", nil
+}
+
+func TestImageURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		cdnBaseURL string
+		key        string
+		want       string
+	}{
+		{name: "presigned without a CDN", key: "home-page/thumbnail/a.jpg", want: "https://bucket.s3.example.com/home-page/thumbnail/a.jpg?X-Amz-Signature=abc"},
+		{name: "through the CDN", cdnBaseURL: "https://cdn.example.com", key: "home-page/thumbnail/a.jpg", want: "https://cdn.example.com/home-page/thumbnail/a.jpg"},
+		{name: "trailing slash on the base", cdnBaseURL: "https://cdn.example.com/photos/", key: "clients/1/2/originals/a.jpg", want: "https://cdn.example.com/photos/clients/1/2/originals/a.jpg"},
+		{name: "reserved characters are escaped", cdnBaseURL: "https://cdn.example.com", key: "clients/1/2/originals/Beach Day #1?.jpg", want: "https://cdn.example.com/clients/1/2/originals/Beach%20Day%20%231%3F.jpg"},
+		{name: "leading slash on the key", cdnBaseURL: "https://cdn.example.com", key: "/home-page/original/a.jpg", want: "https://cdn.example.com/home-page/original/a.jpg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ImageURL(presigningS3Client{}, "bucket", tt.cdnBaseURL, tt.key)
+
+			if err != nil {
+				t.Fatalf("ImageURL returned an error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("ImageURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+PermanentError wraps an error that should not be retried, such as an
+invalid email address.
+*/
+type PermanentError struct {
+	Err error
+}
+
+func (e PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e PermanentError) Unwrap() error {
+	return e.Err
+}
+
+/*
+Permanent marks an error as not retryable.
+*/
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return PermanentError{Err: err}
+}
+
+/*
+IsPermanent returns true if the error, or any error it wraps, was marked
+with Permanent.
+*/
+func IsPermanent(err error) bool {
+	var permanent PermanentError
+	return errors.As(err, &permanent)
+}
+
+type RetryOptions struct {
+	BaseDelay   time.Duration
+	MaxAttempts int
+	OnRetry     func(attempt int, err error)
+}
+
+/*
+RetryWithBackoff calls fn until it succeeds, returns a permanent error, or
+MaxAttempts is reached. The delay between attempts doubles each time
+starting at BaseDelay. Unlike retrier.Retry, which retries until success,
+this is bounded and is meant for work that must eventually give up. Waiting
+between attempts stops early when ctx is done.
+*/
+func RetryWithBackoff(ctx context.Context, fn func() error, options RetryOptions) error {
+	var (
+		err error
+	)
+
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = 1
+	}
+
+	delay := options.BaseDelay
+
+	for attempt := 1; attempt <= options.MaxAttempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+
+		if IsPermanent(err) || attempt == options.MaxAttempts {
+			break
+		}
+
+		if options.OnRetry != nil {
+			options.OnRetry(attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, errors.Join(ctx.Err(), err))
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+
+	if IsPermanent(err) {
+		return err
+	}
+
+	return fmt.Errorf("giving up after %d attempts: %w", options.MaxAttempts, err)
+}
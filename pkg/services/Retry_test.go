@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryWithBackoff(t *testing.T) {
+	errTransient := errors.New("service unavailable")
+
+	tests := []struct {
+		name         string
+		failures     int
+		err          error
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "first try", failures: 0, err: errTransient, wantAttempts: 1},
+		{name: "eventually succeeds", failures: 2, err: errTransient, wantAttempts: 3},
+		{name: "exhausts retries", failures: 10, err: errTransient, wantAttempts: 4, wantErr: true},
+		{name: "permanent error", failures: 10, err: Permanent(errTransient), wantAttempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			retries := []int{}
+
+			err := RetryWithBackoff(context.Background(), func() error {
+				attempts++
+
+				if attempts <= tt.failures {
+					return tt.err
+				}
+
+				return nil
+			}, RetryOptions{
+				BaseDelay:   time.Millisecond,
+				MaxAttempts: 4,
+				OnRetry: func(attempt int, err error) {
+					retries = append(retries, attempt)
+				},
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if err != nil && !errors.Is(err, errTransient) {
+				t.Errorf("error = %v, want it to wrap %v", err, errTransient)
+			}
+
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+
+			if len(retries) != tt.wantAttempts-1 {
+				t.Errorf("OnRetry called for attempts %v, want %d calls", retries, tt.wantAttempts-1)
+			}
+		})
+	}
+}
+
+func TestRetryWithBackoffStopsWhenTheContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	attempts := 0
+
+	err := RetryWithBackoff(ctx, func() error {
+		attempts++
+		return errors.New("service unavailable")
+	}, RetryOptions{BaseDelay: time.Hour, MaxAttempts: 4})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want %v", err, context.Canceled)
+	}
+
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
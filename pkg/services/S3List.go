@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/listoptions"
+)
+
+const (
+	DefaultS3OperationTimeout = time.Second * 30
+)
+
+/*
+ListObjects lists path like S3Client.List, giving up once ctx is done. The
+context is handed to the client so it can cancel the request, but the wait
+doesn't depend on it doing so. A hung endpoint can't hold up the caller past
+ctx's deadline. The returned error wraps ctx.Err() when it gives up, so
+callers can check for context.DeadlineExceeded.
+*/
+func ListObjects(ctx context.Context, client s3.S3Client, bucket, path string, options ...listoptions.ListOption) (s3.ListResponse, error) {
+	type listResult struct {
+		response s3.ListResponse
+		err      error
+	}
+
+	// Buffered so the listing can finish and be dropped after a timeout
+	done := make(chan listResult, 1)
+	options = append(options, listoptions.WithContext(ctx))
+
+	go func() {
+		response, err := client.List(bucket, path, options...)
+		done <- listResult{response: response, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.response, result.err
+
+	case <-ctx.Done():
+		return s3.ListResponse{}, fmt.Errorf("gave up listing '%s': %w", path, ctx.Err())
+	}
+}
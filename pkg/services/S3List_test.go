@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/listoptions"
+)
+
+/*
+slowListS3Client answers listings after delay with a single object. It
+ignores the context it is given, like an endpoint that has stopped
+answering. Anything else panics through the nil embedded interface.
+*/
+type slowListS3Client struct {
+	s3.S3Client
+
+	delay time.Duration
+}
+
+func (c slowListS3Client) List(bucket, path string, options ...listoptions.ListOption) (s3.ListResponse, error) {
+	time.Sleep(c.delay)
+	return s3.ListResponse{NumObjects: 1, Objects: []s3.Object{{Key: path + "a.jpg"}}}, nil
+}
+
+func TestListObjects(t *testing.T) {
+	tests := []struct {
+		name        string
+		delay       time.Duration
+		wantTimeout bool
+	}{
+		{name: "answers in time", delay: 0},
+		{name: "too slow", delay: time.Second, wantTimeout: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+			defer cancel()
+
+			start := time.Now()
+			response, err := ListObjects(ctx, slowListS3Client{delay: tt.delay}, "bucket", "clients/1/2/originals/")
+
+			if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+				t.Errorf("ListObjects took %s, want it to give up at the deadline", elapsed)
+			}
+
+			if tt.wantTimeout {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("error = %v, want context.DeadlineExceeded", err)
+				}
+
+				return
+			}
+
+			if err != nil || len(response.Objects) != 1 {
+				t.Errorf("ListObjects = %+v, %v; want one object", response, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultSessionGenerationTTL = time.Second * 30
+
+/*
+sessionGenerationCache holds client session generations for a short time,
+so checking a session doesn't cost a query on every request. The service
+forgets a client's entry when it invalidates their sessions, and the TTL
+covers changes made to the database outside the service.
+*/
+type sessionGenerationCache struct {
+	mu      sync.RWMutex
+	entries map[uint]sessionGenerationEntry
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+type sessionGenerationEntry struct {
+	generation int
+	expiresAt  time.Time
+}
+
+func newSessionGenerationCache(ttl time.Duration) *sessionGenerationCache {
+	return &sessionGenerationCache{
+		entries: map[uint]sessionGenerationEntry{},
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+func (c *sessionGenerationCache) get(clientID uint) (int, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[clientID]
+
+	if !ok || !c.now().Before(entry.expiresAt) {
+		return 0, false
+	}
+
+	return entry.generation, true
+}
+
+func (c *sessionGenerationCache) set(clientID uint, generation int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[clientID] = sessionGenerationEntry{
+		generation: generation,
+		expiresAt:  c.now().Add(c.ttl),
+	}
+}
+
+func (c *sessionGenerationCache) forget(clientID uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, clientID)
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionGenerationCacheExpires(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cache := newSessionGenerationCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.set(1, 3)
+
+	if generation, ok := cache.get(1); !ok || generation != 3 {
+		t.Fatalf("get = %d, %v; want 3, true", generation, ok)
+	}
+
+	now = now.Add(time.Minute)
+
+	if _, ok := cache.get(1); ok {
+		t.Errorf("entry is still cached after its TTL")
+	}
+
+	cache.set(2, 1)
+	cache.forget(2)
+
+	if _, ok := cache.get(2); ok {
+		t.Errorf("entry is still cached after being forgotten")
+	}
+}
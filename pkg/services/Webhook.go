@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+const (
+	// WebhookEventDownloadReady is sent when an album zip is ready to download
+	WebhookEventDownloadReady = "download.ready"
+
+	/*
+	 * WebhookSignatureHeader holds "sha256=" followed by the hex HMAC-SHA256
+	 * of the request body, keyed with the shared webhook secret
+	 */
+	WebhookSignatureHeader = "X-Webhook-Signature"
+
+	webhookTimeout = time.Second * 10
+)
+
+type WebhookAlbum struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+type WebhookClient struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+/*
+DownloadReadyWebhook is the JSON body posted to the webhook URL when a zip
+is ready. DownloadURL is the first part; DownloadURLs lists every part of a
+split zip.
+*/
+type DownloadReadyWebhook struct {
+	Event        string        `json:"event"`
+	Album        WebhookAlbum  `json:"album"`
+	Client       WebhookClient `json:"client"`
+	DownloadURL  string        `json:"downloadURL"`
+	DownloadURLs []string      `json:"downloadURLs"`
+	ExpiresAt    time.Time     `json:"expiresAt"`
+}
+
+/*
+SignWebhookPayload returns the value of the WebhookSignatureHeader for body.
+Receivers compute the same thing with the shared secret and compare.
+*/
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+/*
+sendDownloadWebhook posts a signed DownloadReadyWebhook to the configured
+URL. Network errors, 429s, and 5xx responses are retried with backoff until
+ctx is done. Any other response is a permanent failure. The outcome is
+recorded on the zip job.
+*/
+func (s ZipService) sendDownloadWebhook(ctx context.Context, jobID string, album *models.Album, client *models.Client, downloadURLs []string) error {
+	var (
+		err  error
+		body []byte
+	)
+
+	l := slog.With("albumID", album.ID, "webhookURL", s.config.WebhookURL, "jobID", jobID)
+
+	payload := DownloadReadyWebhook{
+		Event: WebhookEventDownloadReady,
+		Album: WebhookAlbum{
+			ID:   album.ID,
+			Name: album.Name,
+		},
+		Client: WebhookClient{
+			ID:    client.ID,
+			Name:  client.Name,
+			Email: client.Email,
+		},
+		DownloadURL:  downloadURLs[0],
+		DownloadURLs: downloadURLs,
+		ExpiresAt:    s.config.Clock.Now().UTC().AddDate(0, 0, s.config.ExpirationDays),
+	}
+
+	if body, err = json.Marshal(payload); err == nil {
+		err = RetryWithBackoff(ctx, func() error {
+			return s.postWebhook(ctx, body)
+		}, RetryOptions{
+			BaseDelay:   s.config.WebhookRetryDelay,
+			MaxAttempts: s.config.WebhookMaxAttempts,
+			OnRetry: func(attempt int, err error) {
+				l.Warn("failed to send webhook notification. retrying", "attempt", attempt, "error", err)
+			},
+		})
+	}
+
+	s.jobs.update(jobID, func(job *ZipJob) {
+		job.WebhookSent = err == nil
+
+		if err != nil {
+			job.WebhookError = err.Error()
+		}
+	})
+
+	if err != nil {
+		l.Error("failed to send webhook notification", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s ZipService) postWebhook(ctx context.Context, body []byte) error {
+	var (
+		err      error
+		request  *http.Request
+		response *http.Response
+	)
+
+	if request, err = http.NewRequestWithContext(ctx, http.MethodPost, s.config.WebhookURL, bytes.NewReader(body)); err != nil {
+		return Permanent(fmt.Errorf("error creating webhook request: %w", err))
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(WebhookSignatureHeader, SignWebhookPayload(s.config.WebhookSecret, body))
+
+	if response, err = s.webhookClient.Do(request); err != nil {
+		return fmt.Errorf("error posting webhook: %w", err)
+	}
+
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		return nil
+
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500:
+		return fmt.Errorf("webhook responded with status %d", response.StatusCode)
+
+	default:
+		return Permanent(fmt.Errorf("webhook responded with status %d", response.StatusCode))
+	}
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+/*
+webhookReceiver records the requests it is sent. The first len(statuses)
+requests get those statuses, and every request after that gets a 204.
+*/
+type webhookReceiver struct {
+	statuses []int
+
+	mu       sync.Mutex
+	bodies   [][]byte
+	headers  []http.Header
+	attempts atomic.Int32
+}
+
+func (w *webhookReceiver) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	attempt := int(w.attempts.Add(1))
+
+	w.mu.Lock()
+	w.bodies = append(w.bodies, body)
+	w.headers = append(w.headers, r.Header.Clone())
+	w.mu.Unlock()
+
+	if attempt <= len(w.statuses) {
+		rw.WriteHeader(w.statuses[attempt-1])
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func newWebhookTestService(webhookURL string, sender EmailSender) ZipService {
+	return NewZipService(ZipServiceConfig{
+		EmailMaxAttempts:   1,
+		EmailSender:        sender,
+		ExpirationDays:     3,
+		WebhookMaxAttempts: 3,
+		WebhookRetryDelay:  time.Millisecond,
+		WebhookSecret:      "shared-secret",
+		WebhookURL:         webhookURL,
+	})
+}
+
+func TestDownloadWebhookIsSigned(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	service := newWebhookTestService(server.URL, &recordingEmailSender{})
+	service.jobs.start(ZipJob{ID: "job"})
+
+	album := &models.Album{BaseModel: models.BaseModel{ID: 5}, Name: "Wedding"}
+	client := &models.Client{BaseModel: models.BaseModel{ID: 1}, Name: "Jane", Email: "jane@example.com", NotifyOnDownload: true}
+	downloadURLs := []string{"https://example.com/job-part1.zip", "https://example.com/job-part2.zip"}
+
+	if err := service.sendDownloadWebhook(context.Background(), "job", album, client, downloadURLs); err != nil {
+		t.Fatalf("sendDownloadWebhook returned an error: %v", err)
+	}
+
+	if len(receiver.bodies) != 1 {
+		t.Fatalf("received %d requests, want 1", len(receiver.bodies))
+	}
+
+	body := receiver.bodies[0]
+	signature := receiver.headers[0].Get(WebhookSignatureHeader)
+
+	if !hmac.Equal([]byte(signature), []byte(SignWebhookPayload("shared-secret", body))) {
+		t.Errorf("signature = %q, want the HMAC of the body with the shared secret", signature)
+	}
+
+	if signature == SignWebhookPayload("wrong-secret", body) {
+		t.Errorf("signature matches a different secret")
+	}
+
+	if got := receiver.headers[0].Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+
+	payload := DownloadReadyWebhook{}
+
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("error decoding payload: %v", err)
+	}
+
+	if payload.Event != WebhookEventDownloadReady || payload.Album.ID != 5 || payload.Album.Name != "Wedding" || payload.Client.ID != 1 || payload.Client.Email != "jane@example.com" {
+		t.Errorf("payload = %+v, want the album and client", payload)
+	}
+
+	if payload.DownloadURL != downloadURLs[0] || len(payload.DownloadURLs) != 2 {
+		t.Errorf("download URLs = %q, %v; want both parts", payload.DownloadURL, payload.DownloadURLs)
+	}
+
+	if until := time.Until(payload.ExpiresAt); until < 71*time.Hour || until > 73*time.Hour {
+		t.Errorf("expiresAt = %v, want about 3 days from now", payload.ExpiresAt)
+	}
+
+	if job, _ := service.GetJob("job"); !job.WebhookSent || job.WebhookError != "" {
+		t.Errorf("job = %+v, want the webhook recorded as sent", job)
+	}
+}
+
+func TestDownloadWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int32
+		wantSent     bool
+	}{
+		{name: "transient failures then success", statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, wantAttempts: 3, wantSent: true},
+		{name: "retries exhausted", statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}, wantAttempts: 3},
+		{name: "rejected", statuses: []int{http.StatusUnauthorized}, wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := &webhookReceiver{statuses: tt.statuses}
+			server := httptest.NewServer(receiver)
+			defer server.Close()
+
+			service := newWebhookTestService(server.URL, &recordingEmailSender{})
+			service.jobs.start(ZipJob{ID: "job"})
+
+			album := &models.Album{BaseModel: models.BaseModel{ID: 5}, Name: "Wedding"}
+			client := &models.Client{Name: "Jane", Email: "jane@example.com", NotifyOnDownload: true}
+
+			err := service.sendDownloadWebhook(context.Background(), "job", album, client, []string{"https://example.com/job.zip"})
+
+			if (err == nil) != tt.wantSent {
+				t.Errorf("error = %v, want sent %v", err, tt.wantSent)
+			}
+
+			if got := receiver.attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+
+			if job, _ := service.GetJob("job"); job.WebhookSent != tt.wantSent || tt.wantSent == (job.WebhookError != "") {
+				t.Errorf("job.WebhookSent = %v, job.WebhookError = %q; want sent %v", job.WebhookSent, job.WebhookError, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestWebhookFailuresDoNotBlockTheEmail(t *testing.T) {
+	release := make(chan struct{})
+
+	// The webhook hangs and then fails, long after the email has gone out
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	defer server.Close()
+
+	sender := &recordingEmailSender{}
+	service := newWebhookTestService(server.URL, sender)
+	service.jobs.start(ZipJob{ID: "job"})
+
+	album := &models.Album{BaseModel: models.BaseModel{ID: 5}, Name: "Wedding"}
+	client := &models.Client{Name: "Jane", Email: "jane@example.com", NotifyOnDownload: true}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- service.notifyDownloadReady(context.Background(), "job", album, client, []string{"https://example.com/job.zip"})
+	}()
+
+	deadline := time.After(time.Second * 5)
+
+	for len(sender.messages()) == 0 {
+		select {
+		case <-deadline:
+			t.Fatalf("the email was not sent while the webhook was hanging")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+
+	close(release)
+
+	if err := <-done; err != nil {
+		t.Errorf("notifyDownloadReady returned %v, want the email's result only", err)
+	}
+
+	job, _ := service.GetJob("job")
+
+	if !job.EmailSent || job.WebhookSent || job.WebhookError == "" {
+		t.Errorf("job = %+v, want the email sent and the webhook failure recorded", job)
+	}
+}
+
+func TestNoWebhookWithoutAURL(t *testing.T) {
+	sender := &recordingEmailSender{}
+	service := newWebhookTestService("", sender)
+	service.jobs.start(ZipJob{ID: "job"})
+
+	album := &models.Album{BaseModel: models.BaseModel{ID: 5}, Name: "Wedding"}
+	client := &models.Client{Name: "Jane", Email: "jane@example.com", NotifyOnDownload: true}
+
+	if err := service.notifyDownloadReady(context.Background(), "job", album, client, []string{"https://example.com/job.zip"}); err != nil {
+		t.Fatalf("notifyDownloadReady returned an error: %v", err)
+	}
+
+	if job, _ := service.GetJob("job"); !job.EmailSent || job.WebhookSent || job.WebhookError != "" {
+		t.Errorf("job = %+v, want only the email", job)
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3/geturloptions"
+)
+
+const (
+	// eocdSignature starts a zip's end of central directory record
+	eocdSignature = 0x06054b50
+
+	// eocdSize is the size of the end of central directory record without
+	// its trailing comment
+	eocdSize = 22
+
+	// maxZipCommentSize is the longest comment that can follow the record
+	maxZipCommentSize = 0xffff
+
+	// zipTailTimeout bounds fetching the tail of a zip from S3
+	zipTailTimeout = time.Second * 30
+)
+
+/*
+hasCentralDirectory reports whether the zip stored at key ends with a valid
+end of central directory record. The record is the last thing written to a
+zip, so an upload that was cut short doesn't have one. Only the tail of the
+zip is fetched. The S3 wrapper can't request a byte range, so this goes
+through a presigned URL instead.
+*/
+func (s ZipService) hasCentralDirectory(key string, size int64) (bool, error) {
+	var (
+		err      error
+		url      string
+		request  *http.Request
+		response *http.Response
+		tail     []byte
+	)
+
+	if size < eocdSize {
+		return false, nil
+	}
+
+	tailSize := min(size, eocdSize+maxZipCommentSize)
+
+	ctx, cancel := context.WithTimeout(context.Background(), zipTailTimeout)
+	defer cancel()
+
+	if url, err = s.config.S3Client.GetUrl(s.config.Bucket, key, geturloptions.WithContext(ctx), geturloptions.WithExpiration(zipTailTimeout)); err != nil {
+		return false, fmt.Errorf("error getting URL for zip '%s': %w", key, err)
+	}
+
+	if request, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil); err != nil {
+		return false, fmt.Errorf("error creating request for zip '%s': %w", key, err)
+	}
+
+	request.Header.Set("Range", fmt.Sprintf("bytes=-%d", tailSize))
+
+	if response, err = s.httpClient.Do(request); err != nil {
+		return false, fmt.Errorf("error requesting the end of zip '%s': %w", key, err)
+	}
+
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+
+	case http.StatusOK:
+		// The range was ignored, so skip ahead to the tail
+		if _, err = io.CopyN(io.Discard, response.Body, size-tailSize); err != nil {
+			return false, fmt.Errorf("error reading zip '%s': %w", key, err)
+		}
+
+	default:
+		return false, fmt.Errorf("unexpected status reading the end of zip '%s': %s", key, response.Status)
+	}
+
+	if tail, err = io.ReadAll(io.LimitReader(response.Body, tailSize)); err != nil {
+		return false, fmt.Errorf("error reading the end of zip '%s': %w", key, err)
+	}
+
+	return isCentralDirectoryEnd(tail, size), nil
+}
+
+/*
+isCentralDirectoryEnd reports whether tail, the last bytes of a zip that is
+size bytes long, ends with an end of central directory record. The record
+must account for every byte after it, and, unless the zip is ZIP64, point
+at a central directory that ends right where the record begins.
+*/
+func isCentralDirectoryEnd(tail []byte, size int64) bool {
+	for i := len(tail) - eocdSize; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(tail[i:]) != eocdSignature {
+			continue
+		}
+
+		commentLength := int(binary.LittleEndian.Uint16(tail[i+20:]))
+
+		if i+eocdSize+commentLength != len(tail) {
+			continue
+		}
+
+		directorySize := binary.LittleEndian.Uint32(tail[i+12:])
+		directoryOffset := binary.LittleEndian.Uint32(tail[i+16:])
+
+		if directorySize == 0xffffffff || directoryOffset == 0xffffffff {
+			return true
+		}
+
+		recordOffset := size - int64(len(tail)) + int64(i)
+		return int64(directoryOffset)+int64(directorySize) == recordOffset
+	}
+
+	return false
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/geturloptions"
+)
+
+/*
+urlS3Client hands out a fixed URL for every key. Anything else panics
+through the nil embedded interface.
+*/
+type urlS3Client struct {
+	s3.S3Client
+
+	url string
+}
+
+func (c urlS3Client) GetUrl(bucket, key string, options ...geturloptions.GetUrlOption) (string, error) {
+	return c.url, nil
+}
+
+func buildZip(t *testing.T, comment string) []byte {
+	t.Helper()
+
+	buf := bytes.Buffer{}
+	writer := zip.NewWriter(&buf)
+
+	for i := 0; i < 3; i++ {
+		f, err := writer.Create(fmt.Sprintf("image-%d.jpg", i))
+		if err != nil {
+			t.Fatalf("error creating zip entry: %v", err)
+		}
+
+		_, _ = f.Write(bytes.Repeat([]byte{byte(i)}, 2048))
+	}
+
+	if comment != "" {
+		_ = writer.SetComment(comment)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("error closing zip: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestIsCentralDirectoryEnd(t *testing.T) {
+	complete := buildZip(t, "")
+	withComment := buildZip(t, "album zip")
+
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{name: "complete zip", data: complete, want: true},
+		{name: "complete zip with a comment", data: withComment, want: true},
+		{name: "truncated zip", data: complete[:len(complete)-10], want: false},
+		{name: "zip missing its central directory", data: complete[:len(complete)/2], want: false},
+		{name: "not a zip", data: bytes.Repeat([]byte("a"), 4096), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tail := tt.data[max(0, len(tt.data)-(eocdSize+maxZipCommentSize)):]
+
+			if got := isCentralDirectoryEnd(tail, int64(len(tt.data))); got != tt.want {
+				t.Errorf("isCentralDirectoryEnd() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasCentralDirectoryRequestsOnlyTheTail(t *testing.T) {
+	data := buildZip(t, "")
+	ranges := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "album.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	service := NewZipService(ZipServiceConfig{
+		Bucket:   "bucket",
+		S3Client: urlS3Client{url: server.URL},
+	})
+
+	complete, err := service.hasCentralDirectory("clients/1/2/downloads/album-2.zip", int64(len(data)))
+
+	if err != nil {
+		t.Fatalf("hasCentralDirectory returned an error: %v", err)
+	}
+
+	if !complete {
+		t.Errorf("expected the zip to be complete")
+	}
+
+	if len(ranges) != 1 || !strings.HasPrefix(ranges[0], "bytes=-") {
+		t.Errorf("expected a single suffix range request, got %v", ranges)
+	}
+}
+
+func TestZipJobRegistryIsRunning(t *testing.T) {
+	registry := newZipJobRegistry(systemClock{})
+	registry.start(ZipJob{ID: "album-1"})
+	registry.start(ZipJob{ID: "album-2", State: ZipJobCompleted})
+
+	if !registry.isRunning("album-1") {
+		t.Errorf("expected album-1 to be running")
+	}
+
+	if registry.isRunning("album-2") {
+		t.Errorf("expected album-2 not to be running")
+	}
+
+	if registry.isRunning("album-3") {
+		t.Errorf("expected an unknown job not to be running")
+	}
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+type ZipJobState string
+
+const (
+	ZipJobQueued    ZipJobState = "queued"
+	ZipJobRunning   ZipJobState = "running"
+	ZipJobCompleted ZipJobState = "completed"
+	ZipJobFailed    ZipJobState = "failed"
+)
+
+/*
+ZipJob tracks the status of a single album zip request.
+*/
+type ZipJob struct {
+	ID            string      `json:"id"`
+	AlbumID       uint        `json:"albumID"`
+	AlbumName     string      `json:"albumName"`
+	ClientID      uint        `json:"clientID"`
+	DownloadURL   string      `json:"downloadURL,omitempty"`
+	DownloadURLs  []string    `json:"downloadURLs,omitempty"`
+	EmailError    string      `json:"emailError,omitempty"`
+	EmailSent     bool        `json:"emailSent"`
+	EmailSkipped  bool        `json:"emailSkipped,omitempty"`
+	Error         string      `json:"error,omitempty"`
+	FilesDone     int         `json:"filesDone"`
+	FilesTotal    int         `json:"filesTotal"`
+	Prewarm       bool        `json:"prewarm,omitempty"`
+	QueuePosition int         `json:"queuePosition,omitempty"`
+	StartedAt     time.Time   `json:"startedAt"`
+	State         ZipJobState `json:"state"`
+	UpdatedAt     time.Time   `json:"updatedAt"`
+	WebhookError  string      `json:"webhookError,omitempty"`
+	WebhookSent   bool        `json:"webhookSent"`
+
+	// recipient is notified when the zip is ready. Prewarm jobs have none until a client asks for the zip
+	recipient *models.Client
+}
+
+/*
+zipJobRegistry is an in-memory, concurrency-safe store of zip jobs. Jobs are
+stamped with the time from clock.
+*/
+type zipJobRegistry struct {
+	clock Clock
+	mu    sync.RWMutex
+	jobs  map[string]*ZipJob
+}
+
+func newZipJobRegistry(clock Clock) *zipJobRegistry {
+	return &zipJobRegistry{
+		clock: clock,
+		jobs:  map[string]*ZipJob{},
+	}
+}
+
+func (r *zipJobRegistry) start(job ZipJob) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.add(job)
+}
+
+/*
+startIfIdle starts job unless one with the same ID is still queued or
+running. The check and the start happen under one lock, so only one of two
+concurrent requests for a zip starts it. Returns false when it was already
+going.
+*/
+func (r *zipJobRegistry) startIfIdle(job ZipJob) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.jobs[job.ID]; ok && (existing.State == ZipJobRunning || existing.State == ZipJobQueued) {
+		return false
+	}
+
+	r.add(job)
+	return true
+}
+
+// add stamps and stores job. The caller holds the lock
+func (r *zipJobRegistry) add(job ZipJob) {
+	now := r.clock.Now()
+	job.StartedAt = now
+	job.UpdatedAt = now
+
+	if job.State == "" {
+		job.State = ZipJobRunning
+	}
+
+	r.jobs[job.ID] = &job
+}
+
+func (r *zipJobRegistry) update(jobID string, fn func(job *ZipJob)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job, ok := r.jobs[jobID]; ok {
+		fn(job)
+		job.UpdatedAt = r.clock.Now()
+	}
+}
+
+func (r *zipJobRegistry) get(jobID string) (ZipJob, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if job, ok := r.jobs[jobID]; ok {
+		return *job, true
+	}
+
+	return ZipJob{}, false
+}
+
+// isRunning returns true if the job exists and hasn't finished
+func (r *zipJobRegistry) isRunning(jobID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	job, ok := r.jobs[jobID]
+	return ok && (job.State == ZipJobRunning || job.State == ZipJobQueued)
+}
+
+/*
+claim hands a prewarm job that is still queued or running to recipient, so
+they are notified when it finishes instead of a second zip being built.
+Returns false when there is no such job.
+*/
+func (r *zipJobRegistry) claim(jobID string, recipient *models.Client) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[jobID]
+
+	if !ok || !job.Prewarm || (job.State != ZipJobRunning && job.State != ZipJobQueued) {
+		return false
+	}
+
+	job.Prewarm = false
+	job.recipient = recipient
+	job.UpdatedAt = r.clock.Now()
+	return true
+}
+
+/*
+forClient returns copies of the jobs a client asked for that are still
+queued or running, or finished after since. Prewarm jobs no one has asked
+for yet are left out. Newest first.
+*/
+func (r *zipJobRegistry) forClient(clientID uint, since time.Time) []ZipJob {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []ZipJob{}
+
+	for _, job := range r.jobs {
+		if job.ClientID != clientID || job.Prewarm {
+			continue
+		}
+
+		active := job.State == ZipJobRunning || job.State == ZipJobQueued
+
+		if active || job.UpdatedAt.After(since) {
+			result = append(result, *job)
+		}
+	}
+
+	slices.SortFunc(result, func(a, b ZipJob) int {
+		return b.StartedAt.Compare(a.StartedAt)
+	})
+
+	return result
+}
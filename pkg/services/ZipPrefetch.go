@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/getoptions"
+)
+
+type prefetchedObject struct {
+	Body []byte
+	Err  error
+	Key  string
+}
+
+/*
+prefetchObjects downloads objects from S3 concurrently and delivers them on
+the returned channel in the same order they were given. At most workers
+downloads run at once, and only a few finished objects are held in memory
+waiting to be read, so large albums don't get buffered all at once.
+
+The channel is closed when every object has been delivered or ctx is done.
+*/
+func prefetchObjects(ctx context.Context, client s3.S3Client, bucket string, objects []s3.Object, workers int) <-chan prefetchedObject {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	/*
+	 * The reader below holds one download while it waits for it to finish,
+	 * so the queue only needs room for the rest
+	 */
+	out := make(chan prefetchedObject)
+	pending := make(chan chan prefetchedObject, workers-1)
+
+	go func() {
+		defer close(pending)
+
+		for _, obj := range objects {
+			result := make(chan prefetchedObject, 1)
+
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+
+			go func(key string) {
+				result <- fetchObject(ctx, client, bucket, key)
+			}(obj.Key)
+		}
+	}()
+
+	go func() {
+		defer close(out)
+
+		for result := range pending {
+			obj := <-result
+
+			select {
+			case out <- obj:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+func fetchObject(ctx context.Context, client s3.S3Client, bucket, key string) prefetchedObject {
+	result := prefetchedObject{
+		Key: key,
+	}
+
+	src, err := client.Get(bucket, key, getoptions.WithContext(ctx))
+
+	if err != nil {
+		result.Err = fmt.Errorf("failed to get source file from '%s' S3: %w", key, err)
+		return result
+	}
+
+	defer src.Body.Close()
+
+	if result.Body, err = io.ReadAll(src.Body); err != nil {
+		result.Err = fmt.Errorf("failed to read source file '%s' from S3: %w", key, err)
+	}
+
+	return result
+}
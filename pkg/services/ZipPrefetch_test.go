@@ -0,0 +1,133 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+func testOriginals(count int) map[string][]byte {
+	result := map[string][]byte{}
+
+	for i := 0; i < count; i++ {
+		result[fmt.Sprintf("clients/1/5/originals/image-%02d.jpg", i)] = bytes.Repeat([]byte{byte(i)}, 1024+i*100)
+	}
+
+	return result
+}
+
+func TestPrefetchObjectsKeepsOrderAndBoundsDownloads(t *testing.T) {
+	originals := testOriginals(20)
+
+	s3Client := newZipS3Client(originals)
+	s3Client.getDelay = time.Millisecond
+	close(s3Client.release)
+
+	listing, _ := s3Client.List("bucket", "clients/1/5/originals")
+
+	i := 0
+
+	for obj := range prefetchObjects(context.Background(), s3Client, "bucket", listing.Objects, 3) {
+		if obj.Key != listing.Objects[i].Key {
+			t.Fatalf("object %d = %s, want %s", i, obj.Key, listing.Objects[i].Key)
+		}
+
+		if !bytes.Equal(obj.Body, originals[obj.Key]) {
+			t.Errorf("%s body does not match the original", obj.Key)
+		}
+
+		i++
+	}
+
+	if i != len(originals) {
+		t.Errorf("got %d objects, want %d", i, len(originals))
+	}
+
+	if got := s3Client.mostInFlight(); got > 3 {
+		t.Errorf("%d downloads ran at once, want at most 3", got)
+	}
+}
+
+func TestZipContainsEveryFileIntact(t *testing.T) {
+	originals := testOriginals(25)
+
+	for _, workers := range []int{1, 4, 16} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			s3Client := newZipS3Client(originals)
+			close(s3Client.release)
+
+			service := NewZipService(ZipServiceConfig{
+				Bucket:            "bucket",
+				ClientPhotoFolder: "clients",
+				DownloadWorkers:   workers,
+				EmailSender:       &recordingEmailSender{},
+				S3Client:          s3Client,
+			})
+
+			album := &models.Album{BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Name: "Wedding"}
+			client := &models.Client{BaseModel: models.BaseModel{ID: 1}, Name: "Jane", Email: "jane@example.com"}
+
+			if _, err := service.CreateZipAsync(album, client); err != nil {
+				t.Fatalf("CreateZipAsync returned an error: %v", err)
+			}
+
+			if err := service.Shutdown(context.Background()); err != nil {
+				t.Fatalf("Shutdown returned an error: %v", err)
+			}
+
+			data := s3Client.get("clients/1/5/downloads/Wedding-5.zip")
+
+			reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("the uploaded zip can't be read: %v", err)
+			}
+
+			if len(reader.File) != len(originals) {
+				t.Fatalf("zip has %d files, want %d", len(reader.File), len(originals))
+			}
+
+			for i, f := range reader.File {
+				want := fmt.Sprintf("image-%02d.jpg", i)
+
+				if f.Name != want {
+					t.Errorf("file %d = %s, want %s", i, f.Name, want)
+				}
+
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatalf("error opening %s in the zip: %v", f.Name, err)
+				}
+
+				body, _ := io.ReadAll(rc)
+				_ = rc.Close()
+
+				if !bytes.Equal(body, originals["clients/1/5/originals/"+f.Name]) {
+					t.Errorf("%s in the zip does not match the original", f.Name)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPrefetchObjects(b *testing.B) {
+	s3Client := newZipS3Client(testOriginals(32))
+	s3Client.getDelay = time.Millisecond
+	close(s3Client.release)
+
+	listing, _ := s3Client.List("bucket", "clients/1/5/originals")
+
+	for _, workers := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("%d workers", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for range prefetchObjects(context.Background(), s3Client, "bucket", listing.Objects, workers) {
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"sync"
+)
+
+const (
+	defaultMaxConcurrentZipJobs = 4
+	defaultMaxZipJobsPerClient  = 2
+)
+
+/*
+zipQueue limits how many zip jobs build at once, overall and for any one
+client. Jobs over either limit wait in the order they were queued. A job
+whose client is at its limit doesn't hold up jobs from other clients queued
+behind it.
+*/
+type zipQueue struct {
+	maxConcurrent int
+	maxPerClient  int
+
+	// onPosition is told each waiting job's place in line, from 1, whenever it changes
+	onPosition func(jobID string, position int)
+
+	mu              sync.Mutex
+	running         int
+	runningByClient map[uint]int
+	waiting         []queuedZip
+}
+
+type queuedZip struct {
+	clientID uint
+	jobID    string
+	run      func()
+}
+
+func newZipQueue(maxConcurrent, maxPerClient int, onPosition func(jobID string, position int)) *zipQueue {
+	if maxConcurrent <= 0 {
+		maxConcurrent = defaultMaxConcurrentZipJobs
+	}
+
+	if maxPerClient <= 0 {
+		maxPerClient = defaultMaxZipJobsPerClient
+	}
+
+	return &zipQueue{
+		maxConcurrent:   maxConcurrent,
+		maxPerClient:    min(maxPerClient, maxConcurrent),
+		onPosition:      onPosition,
+		runningByClient: map[uint]int{},
+	}
+}
+
+/*
+enqueue adds a job to the queue and starts it right away if there is a free
+slot. It returns the job's place in line, or 0 when it has started.
+*/
+func (q *zipQueue) enqueue(jobID string, clientID uint, run func()) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.waiting = append(q.waiting, queuedZip{clientID: clientID, jobID: jobID, run: run})
+	q.dispatch()
+
+	for index, job := range q.waiting {
+		if job.jobID == jobID {
+			return index + 1
+		}
+	}
+
+	return 0
+}
+
+/*
+dispatch starts every waiting job there is a slot for and reports the new
+positions of the jobs still waiting. The caller must hold mu.
+*/
+func (q *zipQueue) dispatch() {
+	ready := []queuedZip{}
+	stillWaiting := q.waiting[:0]
+
+	for _, job := range q.waiting {
+		if q.running >= q.maxConcurrent || q.runningByClient[job.clientID] >= q.maxPerClient {
+			stillWaiting = append(stillWaiting, job)
+			continue
+		}
+
+		q.running++
+		q.runningByClient[job.clientID]++
+		ready = append(ready, job)
+	}
+
+	q.waiting = stillWaiting
+
+	if q.onPosition != nil {
+		for index, job := range q.waiting {
+			q.onPosition(job.jobID, index+1)
+		}
+	}
+
+	// Started after the positions are reported so a job never sees a stale one
+	for _, job := range ready {
+		go q.runJob(job)
+	}
+}
+
+func (q *zipQueue) runJob(job queuedZip) {
+	defer q.finish(job.clientID)
+	job.run()
+}
+
+// finish frees a finished job's slot and starts whatever can run in it
+func (q *zipQueue) finish(clientID uint) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.running--
+	q.runningByClient[clientID]--
+
+	if q.runningByClient[clientID] <= 0 {
+		delete(q.runningByClient, clientID)
+	}
+
+	q.dispatch()
+}
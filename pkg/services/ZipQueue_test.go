@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+func newQueueTestService(s3Client *zipS3Client, maxConcurrent, maxPerClient int) ZipService {
+	return NewZipService(ZipServiceConfig{
+		Bucket:               "bucket",
+		ClientPhotoFolder:    "clients",
+		EmailSender:          &recordingEmailSender{},
+		MaxConcurrentZipJobs: maxConcurrent,
+		MaxZipJobsPerClient:  maxPerClient,
+		S3Client:             s3Client,
+	})
+}
+
+func TestZipJobsOverTheLimitWaitForASlot(t *testing.T) {
+	s3Client := newZipS3Client(map[string][]byte{
+		"clients/1/5/originals/a.jpg": []byte("a"),
+		"clients/1/6/originals/b.jpg": []byte("b"),
+	})
+
+	service := newQueueTestService(s3Client, 1, 1)
+	client := &models.Client{BaseModel: models.BaseModel{ID: 1}, Email: "jane@example.com"}
+
+	first, err := service.CreateZipAsync(&models.Album{BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Name: "Wedding"}, client)
+	if err != nil {
+		t.Fatalf("CreateZipAsync returned an error: %v", err)
+	}
+
+	second, err := service.CreateZipAsync(&models.Album{BaseModel: models.BaseModel{ID: 6}, ClientID: 1, Name: "Engagement"}, client)
+	if err != nil {
+		t.Fatalf("CreateZipAsync returned an error: %v", err)
+	}
+
+	if job, _ := service.GetJob(first); job.State != ZipJobRunning {
+		t.Errorf("first job state = %s, want %s", job.State, ZipJobRunning)
+	}
+
+	// The first job is held on its download, so the second can't have a slot yet
+	time.Sleep(50 * time.Millisecond)
+
+	if job, _ := service.GetJob(second); job.State != ZipJobQueued || job.QueuePosition != 1 {
+		t.Errorf("second job = %s at position %d, want %s at position 1", job.State, job.QueuePosition, ZipJobQueued)
+	}
+
+	if s3Client.has("clients/1/6/downloads/Engagement-6.zip") {
+		t.Errorf("the queued job built its zip before a slot freed")
+	}
+
+	close(s3Client.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err = service.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown returned an error: %v", err)
+	}
+
+	for _, jobID := range []string{first, second} {
+		if job, _ := service.GetJob(jobID); job.State != ZipJobCompleted || job.QueuePosition != 0 {
+			t.Errorf("job %s = %s at position %d, want %s", jobID, job.State, job.QueuePosition, ZipJobCompleted)
+		}
+	}
+}
+
+func TestZipJobsPerClientLimitDoesNotHoldUpOtherClients(t *testing.T) {
+	s3Client := newZipS3Client(map[string][]byte{
+		"clients/1/5/originals/a.jpg": []byte("a"),
+		"clients/1/6/originals/b.jpg": []byte("b"),
+		"clients/2/7/originals/c.jpg": []byte("c"),
+	})
+
+	service := newQueueTestService(s3Client, 2, 1)
+	jane := &models.Client{BaseModel: models.BaseModel{ID: 1}, Email: "jane@example.com"}
+	john := &models.Client{BaseModel: models.BaseModel{ID: 2}, Email: "john@example.com"}
+
+	if _, err := service.CreateZipAsync(&models.Album{BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Name: "Wedding"}, jane); err != nil {
+		t.Fatalf("CreateZipAsync returned an error: %v", err)
+	}
+
+	janesSecond, _ := service.CreateZipAsync(&models.Album{BaseModel: models.BaseModel{ID: 6}, ClientID: 1, Name: "Engagement"}, jane)
+	johns, _ := service.CreateZipAsync(&models.Album{BaseModel: models.BaseModel{ID: 7}, ClientID: 2, Name: "Portraits"}, john)
+
+	if job, _ := service.GetJob(janesSecond); job.State != ZipJobQueued || job.QueuePosition != 1 {
+		t.Errorf("Jane's second job = %s at position %d, want %s at position 1", job.State, job.QueuePosition, ZipJobQueued)
+	}
+
+	if job, _ := service.GetJob(johns); job.State != ZipJobRunning {
+		t.Errorf("John's job state = %s, want %s", job.State, ZipJobRunning)
+	}
+
+	close(s3Client.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := service.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown returned an error: %v", err)
+	}
+
+	if job, _ := service.GetJob(janesSecond); job.State != ZipJobCompleted {
+		t.Errorf("Jane's second job state = %s, want %s", job.State, ZipJobCompleted)
+	}
+}
+
+func TestGetClientJobsOnlyReturnsTheClientsJobs(t *testing.T) {
+	s3Client := newZipS3Client(map[string][]byte{
+		"clients/1/5/originals/a.jpg": []byte("a"),
+		"clients/1/5/originals/b.jpg": []byte("b"),
+		"clients/1/6/originals/c.jpg": []byte("c"),
+		"clients/2/7/originals/d.jpg": []byte("d"),
+	})
+
+	service := newQueueTestService(s3Client, 1, 1)
+	jane := &models.Client{BaseModel: models.BaseModel{ID: 1}, Email: "jane@example.com"}
+	john := &models.Client{BaseModel: models.BaseModel{ID: 2}, Email: "john@example.com"}
+
+	wedding, _ := service.CreateZipAsync(&models.Album{BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Name: "Wedding"}, jane)
+	engagement, _ := service.CreateZipAsync(&models.Album{BaseModel: models.BaseModel{ID: 6}, ClientID: 1, Name: "Engagement"}, jane)
+	_, _ = service.CreateZipAsync(&models.Album{BaseModel: models.BaseModel{ID: 7}, ClientID: 2, Name: "Portraits"}, john)
+
+	// A zip built ahead of time that Jane hasn't asked for, and one she asked for long ago
+	service.jobs.start(ZipJob{ID: "Prewarmed-8", AlbumID: 8, ClientID: 1, Prewarm: true})
+	service.jobs.start(ZipJob{ID: "Old-9", AlbumID: 9, ClientID: 1, State: ZipJobCompleted})
+	service.jobs.mu.Lock()
+	service.jobs.jobs["Old-9"].UpdatedAt = time.Now().Add(-recentZipJobWindow - time.Minute)
+	service.jobs.mu.Unlock()
+
+	ids := func(jobs []ZipJob) []string {
+		result := []string{}
+
+		for _, job := range jobs {
+			result = append(result, job.ID)
+		}
+
+		return result
+	}
+
+	jobs := service.GetClientJobs(1)
+
+	if got := ids(jobs); len(got) != 2 || got[0] != engagement || got[1] != wedding {
+		t.Fatalf("Jane's jobs = %v, want [%s %s]", got, engagement, wedding)
+	}
+
+	if jobs[0].State != ZipJobQueued || jobs[1].State != ZipJobRunning {
+		t.Errorf("states = %s, %s; want %s, %s", jobs[0].State, jobs[1].State, ZipJobQueued, ZipJobRunning)
+	}
+
+	for _, job := range service.GetClientJobs(2) {
+		if job.ClientID != 2 {
+			t.Errorf("John's jobs include %s for client %d", job.ID, job.ClientID)
+		}
+	}
+
+	close(s3Client.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := service.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown returned an error: %v", err)
+	}
+
+	// Finished jobs are still reported, with every file done
+	for _, job := range service.GetClientJobs(1) {
+		if job.State != ZipJobCompleted || job.FilesTotal == 0 || job.FilesDone != job.FilesTotal {
+			t.Errorf("job %s = %s with %d of %d files, want completed with every file", job.ID, job.State, job.FilesDone, job.FilesTotal)
+		}
+	}
+
+	if got := service.GetClientJobs(9); len(got) != 0 {
+		t.Errorf("jobs for a client with none = %v, want none", ids(got))
+	}
+}
+
+func TestGetClientJobsDropsJobsFinishedBeforeTheWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, time.March, 10, 12, 0, 0, 0, time.UTC)}
+	s3Client := newZipS3Client(map[string][]byte{"clients/1/5/originals/a.jpg": []byte("a")})
+
+	service := NewZipService(ZipServiceConfig{
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		Clock:             clock,
+		EmailSender:       &recordingEmailSender{},
+		S3Client:          s3Client,
+	})
+
+	jane := &models.Client{BaseModel: models.BaseModel{ID: 1}, Email: "jane@example.com"}
+
+	jobID, err := service.CreateZipAsync(&models.Album{BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Name: "Wedding"}, jane)
+	if err != nil {
+		t.Fatalf("CreateZipAsync returned an error: %v", err)
+	}
+
+	close(s3Client.release)
+
+	if err = service.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned an error: %v", err)
+	}
+
+	// The clock only moves once nothing else is reading it
+	clock.now = clock.now.Add(recentZipJobWindow - time.Minute)
+
+	if got := service.GetClientJobs(1); len(got) != 1 || got[0].ID != jobID {
+		t.Fatalf("jobs just inside the window = %v, want %s", got, jobID)
+	}
+
+	clock.now = clock.now.Add(2 * time.Minute)
+
+	if got := service.GetClientJobs(1); len(got) != 0 {
+		t.Errorf("jobs past the window = %v, want none", got)
+	}
+}
+
+func TestZipQueueReportsPositionsAsTheLineMoves(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		positions = map[string]int{}
+	)
+
+	queue := newZipQueue(1, 1, func(jobID string, position int) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		positions[jobID] = position
+	})
+
+	release := make(chan struct{})
+	started := make(chan string, 3)
+
+	run := func(jobID string) func() {
+		return func() {
+			started <- jobID
+			<-release
+		}
+	}
+
+	if position := queue.enqueue("a", 1, run("a")); position != 0 {
+		t.Errorf("first job position = %d, want 0", position)
+	}
+
+	if position := queue.enqueue("b", 2, run("b")); position != 1 {
+		t.Errorf("second job position = %d, want 1", position)
+	}
+
+	if position := queue.enqueue("c", 3, run("c")); position != 2 {
+		t.Errorf("third job position = %d, want 2", position)
+	}
+
+	if jobID := <-started; jobID != "a" {
+		t.Fatalf("started %s first, want a", jobID)
+	}
+
+	release <- struct{}{}
+
+	if jobID := <-started; jobID != "b" {
+		t.Fatalf("started %s second, want b", jobID)
+	}
+
+	mu.Lock()
+	if positions["c"] != 1 {
+		t.Errorf("c's position = %d after a finished, want 1", positions["c"])
+	}
+	mu.Unlock()
+
+	close(release)
+
+	if jobID := <-started; jobID != "c" {
+		t.Errorf("started %s last, want c", jobID)
+	}
+}
@@ -2,17 +2,27 @@ package services
 
 import (
 	"archive/zip"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/adampresley/adamgokit/s3"
 	"github.com/adampresley/adamgokit/s3/listoptions"
 	"github.com/adampresley/adamgokit/s3/putoptions"
+	"github.com/adampresley/adampresleyphotography/pkg/metrics"
 	"github.com/adampresley/adampresleyphotography/pkg/models"
 )
 
@@ -22,189 +32,1390 @@ type ZipServiceConfig struct {
 	Bucket            string
 	ClientPhotoFolder string
 	ClientService     ClientServicer
+	Clock             Clock
+	DownloadWorkers   int
 	ExpirationDays    int
 	S3Client          s3.S3Client
-	EmailApiKey       string
+	EmailSender       EmailSender
+	EmailTemplate     EmailTemplate
+	IncludeManifest   bool
+	MaxZipBytes       int64
+	EmailMaxAttempts  int
+	EmailRetryDelay   time.Duration
 	FromName          string
 	FromEmail         string
+
+	// FavoritesFolder puts the client's favorites in a favorites folder inside the zip, and the rest at its root
+	FavoritesFolder bool
+
+	// DownloadTokenSecret signs the tokens in download links so they can't be guessed or altered
+	DownloadTokenSecret string
+
+	// MaxConcurrentZipJobs and MaxZipJobsPerClient limit how many zips build at once. Others wait in a queue
+	MaxConcurrentZipJobs int
+	MaxZipJobsPerClient  int
+
+	// WebhookURL, when set, is posted a DownloadReadyWebhook alongside the email
+	WebhookURL         string
+	WebhookSecret      string
+	WebhookMaxAttempts int
+	WebhookRetryDelay  time.Duration
+}
+
+type ZipServicer interface {
+	CleanupExpiredZips() (int, error)
+	CleanupInvalidZips() int
+	CreateZipAsync(album *models.Album, client *models.Client) (string, error)
+	EstimateBundle(album *models.Album) (fileCount int, totalBytes int64, err error)
+	GetClientJobs(clientID uint) []ZipJob
+	GetJob(jobID string) (ZipJob, bool)
+	IsExpired(lastModified time.Time) bool
+	ListClientDownloads(clientID uint) ([]DownloadInfo, error)
+	PrewarmAlbum(album *models.Album, client *models.Client) (bool, error)
+	PrewarmRecentAlbums(days int) (int, error)
+	ResendDownloadEmail(album *models.Album, client *models.Client) (bool, error)
+	Shutdown(ctx context.Context) error
+	StartCleanupRoutine(interval time.Duration)
+	StopCleanupRoutine()
+}
+
+var (
+	ErrZipServiceShuttingDown = fmt.Errorf("zip service is shutting down")
+	ErrZipAlbumEmpty          = fmt.Errorf("album has no photos to zip")
+	ErrZipNoPhotosAdded       = fmt.Errorf("none of the album's photos could be added to the zip")
+)
+
+const (
+	// minCompleteZipSize is the smallest zip considered complete
+	minCompleteZipSize = 1024
+
+	// zipManifestName is the file listing a zip's contents, at the root of the zip
+	zipManifestName = "manifest.txt"
+
+	// zipFavoritesFolder holds the client's favorites inside the zip when FavoritesFolder is on
+	zipFavoritesFolder = "favorites"
+
+	// zipAbortGracePeriod is how long Shutdown waits for aborted jobs to clean up
+	zipAbortGracePeriod = time.Second * 10
+
+	// recentZipJobWindow is how long a finished job is still reported to the client who asked for it
+	recentZipJobWindow = time.Hour * 24
+)
+
+/*
+DownloadInfo describes a finished album zip that a client can download.
+*/
+type DownloadInfo struct {
+	AlbumID     uint
+	AlbumName   string
+	CreatedAt   time.Time
+	DownloadURL string
+	ExpiresAt   time.Time
+	Filename    string
+	Part        int
+	Size        int64
+}
+
+type ZipService struct {
+	config        ZipServiceConfig
+	cancelJobs    context.CancelFunc
+	cleanupTicker *time.Ticker
+	httpClient    *http.Client
+	jobs          *zipJobRegistry
+	jobsCtx       context.Context
+	jobsWG        *sync.WaitGroup
+	queue         *zipQueue
+	shuttingDown  *atomic.Bool
+	stopCleanup   chan struct{}
+	webhookClient *http.Client
+	wg            *sync.WaitGroup
+}
+
+func NewZipService(config ZipServiceConfig) ZipService {
+	// Default expiration to 7 days if not specified
+	if config.ExpirationDays <= 0 {
+		config.ExpirationDays = 7
+	}
+
+	if config.Clock == nil {
+		config.Clock = systemClock{}
+	}
+
+	if config.DownloadWorkers <= 0 {
+		config.DownloadWorkers = 4
+	}
+
+	if config.EmailMaxAttempts <= 0 {
+		config.EmailMaxAttempts = 4
+	}
+
+	if config.EmailRetryDelay <= 0 {
+		config.EmailRetryDelay = time.Second * 2
+	}
+
+	if config.WebhookMaxAttempts <= 0 {
+		config.WebhookMaxAttempts = 4
+	}
+
+	if config.WebhookRetryDelay <= 0 {
+		config.WebhookRetryDelay = time.Second * 2
+	}
+
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	jobs := newZipJobRegistry(config.Clock)
+
+	queue := newZipQueue(config.MaxConcurrentZipJobs, config.MaxZipJobsPerClient, func(jobID string, position int) {
+		jobs.update(jobID, func(job *ZipJob) {
+			job.State = ZipJobQueued
+			job.QueuePosition = position
+		})
+	})
+
+	return ZipService{
+		config:        config,
+		cancelJobs:    cancelJobs,
+		httpClient:    &http.Client{Timeout: zipTailTimeout},
+		jobs:          jobs,
+		jobsCtx:       jobsCtx,
+		jobsWG:        &sync.WaitGroup{},
+		queue:         queue,
+		shuttingDown:  &atomic.Bool{},
+		stopCleanup:   make(chan struct{}),
+		webhookClient: &http.Client{Timeout: webhookTimeout},
+		wg:            &sync.WaitGroup{},
+	}
+}
+
+func (s ZipService) CreateZipAsync(album *models.Album, client *models.Client) (string, error) {
+	var (
+		err        error
+		objectData *s3.ObjectMetadata
+	)
+
+	if s.shuttingDown.Load() {
+		return "", ErrZipServiceShuttingDown
+	}
+
+	jobID := zipJobID(album)
+	zipFilename := fmt.Sprintf("%s.zip", jobID)
+	zipKey := filepath.Join(s.downloadsKey(album), zipFilename)
+
+	started := s.jobs.startIfIdle(ZipJob{
+		ID:        jobID,
+		AlbumID:   album.ID,
+		AlbumName: album.Name,
+		ClientID:  client.ID,
+		recipient: client,
+	})
+
+	/*
+	 * A zip still being built isn't built twice. One being built ahead of
+	 * time is taken over, so the client is told when it is ready.
+	 */
+	if !started {
+		if s.jobs.claim(jobID, client) {
+			slog.Info("zip is already being prewarmed, notifying when it is ready", "jobID", jobID, "albumID", album.ID, "clientID", client.ID)
+		} else {
+			slog.Info("zip is already being built", "jobID", jobID, "albumID", album.ID, "clientID", client.ID)
+		}
+
+		return jobID, nil
+	}
+
+	/*
+	 * Check if the file already exists. A truncated zip, or one built before
+	 * the album's originals last changed, is removed and rebuilt.
+	 */
+	if objectData, err = s.config.S3Client.StatObject(s.config.Bucket, zipKey); err == nil && objectData != nil {
+		rebuild := false
+
+		if !s.isCompleteZipObject(slog.Default(), zipKey, objectData.Size) {
+			slog.Warn("existing zip file is incomplete, rebuilding it", "zipKey", zipKey, "size", objectData.Size)
+			rebuild = true
+		} else if current, currentErr := s.isZipCurrent(zipKey, album); currentErr != nil || !current {
+			slog.Warn("existing zip file may be older than the album's originals, rebuilding it", "zipKey", zipKey, "error", currentErr)
+			rebuild = true
+		}
+
+		if rebuild {
+			if _, err = s.config.S3Client.Delete(s.config.Bucket, []string{zipKey}); err != nil {
+				slog.Error("failed to remove outdated zip file", "error", err, "zipKey", zipKey)
+			}
+
+			objectData = nil
+		}
+	}
+
+	existing := []string{}
+
+	if err == nil && objectData != nil {
+		existing = append(existing, zipFilename)
+	} else if s.config.MaxZipBytes > 0 {
+		existing = s.existingZipParts(album, jobID)
+	}
+
+	if len(existing) > 0 {
+		slog.Info("zip file already exists, sending notifications only", "zipFilenames", existing, "albumID", album.ID)
+
+		downloadURLs := make([]string, 0, len(existing))
+
+		for _, filename := range existing {
+			downloadURLs = append(downloadURLs, s.downloadURL(album, filename, s.linkExpiry(s.config.Clock.Now())))
+		}
+
+		s.jobs.update(jobID, func(job *ZipJob) {
+			job.State = ZipJobCompleted
+		})
+
+		/*
+		 * Sending can take a while when retrying, so it runs as a tracked
+		 * job like any other. Shutdown waits for it or cancels its backoff.
+		 */
+		s.jobsWG.Add(1)
+
+		go func() {
+			defer s.jobsWG.Done()
+			_ = s.notifyDownloadReady(s.jobsCtx, jobID, album, client, downloadURLs)
+		}()
+
+		return jobID, nil
+	}
+
+	s.enqueueZip(jobID, zipFilename, album, client)
+	return jobID, nil
+}
+
+/*
+enqueueZip builds the album's zip once there is a slot for it. Until then
+the job is queued, and GetJob reports its place in line. Shutdown waits for
+queued jobs too. Once jobs are aborted, a queued job fails as soon as it
+gets a slot rather than starting. The returned channel is closed when the
+job is done, however it ends.
+*/
+func (s ZipService) enqueueZip(jobID, zipFilename string, album *models.Album, client *models.Client) <-chan struct{} {
+	done := make(chan struct{})
+	s.jobsWG.Add(1)
+
+	position := s.queue.enqueue(jobID, client.ID, func() {
+		defer s.jobsWG.Done()
+		defer close(done)
+
+		if s.jobsCtx.Err() != nil {
+			s.failJob(jobID, ErrZipServiceShuttingDown)
+			return
+		}
+
+		s.jobs.update(jobID, func(job *ZipJob) {
+			job.State = ZipJobRunning
+			job.QueuePosition = 0
+		})
+
+		s.processZip(jobID, zipFilename, album, client)
+	})
+
+	if position > 0 {
+		slog.Info("zip job queued", "jobID", jobID, "albumID", album.ID, "clientID", client.ID, "position", position)
+	}
+
+	return done
+}
+
+/*
+PrewarmAlbum starts building the album's zip ahead of time, without
+notifying anyone, so it is ready when the client asks for it. Nothing is
+built when the album's zip is complete, hasn't expired, and is newer than
+every original, or when a zip for the album is already being built. A zip
+older than the originals is removed before it is rebuilt so it is never
+sent. Reports whether a build was started.
+*/
+func (s ZipService) PrewarmAlbum(album *models.Album, client *models.Client) (bool, error) {
+	done, err := s.prewarm(album, client)
+	return done != nil, err
+}
+
+/*
+PrewarmRecentAlbums prewarms the zips of albums created in the last days,
+by the configured clock. They are built one at a time, so clients asking
+for downloads aren't stuck in the queue behind them. Albums that can't be
+downloaded, or have expired, are skipped. Returns how many zips were built.
+*/
+func (s ZipService) PrewarmRecentAlbums(days int) (int, error) {
+	var (
+		err     error
+		clients []models.Client
+		albums  []*models.Album
+		done    <-chan struct{}
+	)
+
+	built := 0
+	since := s.config.Clock.Now().AddDate(0, 0, -days)
+
+	if clients, err = s.config.ClientService.GetAll(); err != nil {
+		return built, fmt.Errorf("error retrieving clients to prewarm zips: %w", err)
+	}
+
+	for i := range clients {
+		client := &clients[i]
+
+		if albums, err = s.config.AlbumService.GetAlbumList(client.ID); err != nil {
+			return built, fmt.Errorf("error retrieving albums to prewarm zips for client %d: %w", client.ID, err)
+		}
+
+		for _, album := range albums {
+			if album.CreatedAt.Before(since) || !album.CanDownload() || album.IsExpired() {
+				continue
+			}
+
+			if done, err = s.prewarm(album, client); err != nil {
+				if errors.Is(err, ErrZipServiceShuttingDown) {
+					return built, err
+				}
+
+				slog.Error("error prewarming album zip", "error", err, "albumID", album.ID, "clientID", client.ID)
+				continue
+			}
+
+			if done == nil {
+				continue
+			}
+
+			select {
+			case <-done:
+				built++
+
+			case <-s.jobsCtx.Done():
+				return built, ErrZipServiceShuttingDown
+			}
+		}
+	}
+
+	return built, nil
+}
+
+/*
+prewarm is PrewarmAlbum. The returned channel is closed when the build is
+done, and is nil when nothing needed building.
+*/
+func (s ZipService) prewarm(album *models.Album, client *models.Client) (<-chan struct{}, error) {
+	if s.shuttingDown.Load() {
+		return nil, ErrZipServiceShuttingDown
+	}
+
+	jobID := zipJobID(album)
+
+	if s.jobs.isRunning(jobID) {
+		return nil, nil
+	}
+
+	current, err := s.hasCurrentZip(album)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if current {
+		slog.Info("album zip is current, not prewarming it", "albumID", album.ID, "jobID", jobID)
+		return nil, nil
+	}
+
+	started := s.jobs.startIfIdle(ZipJob{
+		ID:        jobID,
+		AlbumID:   album.ID,
+		AlbumName: album.Name,
+		ClientID:  client.ID,
+		Prewarm:   true,
+	})
+
+	// Another request may have started the zip while this one was checking S3
+	if !started {
+		return nil, nil
+	}
+
+	s.removeZips(album, jobID)
+
+	slog.Info("prewarming album zip", "albumID", album.ID, "clientID", client.ID, "jobID", jobID)
+	return s.enqueueZip(jobID, fmt.Sprintf("%s.zip", jobID), album, client), nil
+}
+
+/*
+hasCurrentZip reports whether the album has a complete zip that hasn't
+expired and was built after its newest original was uploaded.
+*/
+func (s ZipService) hasCurrentZip(album *models.Album) (bool, error) {
+	zips, err := s.currentZips(album)
+
+	if err != nil || len(zips) == 0 {
+		return false, err
+	}
+
+	stale, err := s.predatesOriginals(album, zips)
+	return !stale, err
+}
+
+// predatesOriginals reports whether any of zips was built before the album's newest original was uploaded
+func (s ZipService) predatesOriginals(album *models.Album, zips []s3.Object) (bool, error) {
+	newest, err := s.newestOriginal(album)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, zipFile := range zips {
+		if zipFile.LastModified.Before(newest) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+/*
+isZipCurrent reports whether the zip at zipKey was built after the album's
+newest original was uploaded, so it holds every photo as it is now. A zip
+that isn't there isn't current.
+*/
+func (s ZipService) isZipCurrent(zipKey string, album *models.Album) (bool, error) {
+	objectData, err := s.config.S3Client.StatObject(s.config.Bucket, zipKey)
+
+	if err != nil {
+		return false, fmt.Errorf("error checking zip '%s': %w", zipKey, err)
+	}
+
+	if objectData == nil {
+		return false, nil
+	}
+
+	newest, err := s.newestOriginal(album)
+
+	if err != nil {
+		return false, err
+	}
+
+	return !objectData.LastModified.Before(newest), nil
+}
+
+// newestOriginal returns when the album's most recent original was uploaded, or the zero time when it has none
+func (s ZipService) newestOriginal(album *models.Album) (time.Time, error) {
+	var newest time.Time
+
+	originals, err := s.config.S3Client.List(s.config.Bucket, s.originalsKey(album), listoptions.WithGetAll())
+
+	if err != nil {
+		return newest, fmt.Errorf("error listing originals for album %d: %w", album.ID, err)
+	}
+
+	for _, original := range originals.Objects {
+		if original.LastModified.After(newest) {
+			newest = original.LastModified
+		}
+	}
+
+	return newest, nil
+}
+
+// albumZips returns the album's zip and any parts of a split one, in no particular order
+func (s ZipService) albumZips(album *models.Album, jobID string) ([]s3.Object, error) {
+	list, err := s.config.S3Client.List(s.config.Bucket, s.downloadsKey(album))
+
+	if err != nil {
+		return nil, fmt.Errorf("error listing downloads for album %d: %w", album.ID, err)
+	}
+
+	result := []s3.Object{}
+
+	for _, file := range list.Objects {
+		filename := filepath.Base(file.Key)
+
+		if filename == jobID+".zip" || zipPartNumber(jobID, filename) > 0 {
+			result = append(result, file)
+		}
+	}
+
+	return result, nil
+}
+
+/*
+removeZips deletes the album's zip and any parts of a split one. Errors are
+only logged.
+*/
+func (s ZipService) removeZips(album *models.Album, jobID string) {
+	l := slog.With("albumID", album.ID, "jobID", jobID)
+	zips, err := s.albumZips(album, jobID)
+
+	if err != nil {
+		l.Error("error listing album zips to remove", "error", err)
+		return
+	}
+
+	if len(zips) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(zips))
+
+	for _, file := range zips {
+		keys = append(keys, file.Key)
+	}
+
+	l.Info("removing outdated album zip", "zipKeys", keys)
+
+	if _, err = s.config.S3Client.Delete(s.config.Bucket, keys); err != nil {
+		l.Error("failed to remove outdated album zip", "error", err)
+	}
+}
+
+/*
+existingZipParts returns the filenames of a split zip already built for the
+album, in part order. Parts must be complete, built after the album's
+newest original, and numbered from 1 without gaps. Otherwise they are all removed so the zip is rebuilt, and nothing is
+returned.
+*/
+func (s ZipService) existingZipParts(album *models.Album, jobID string) []string {
+	l := slog.With("albumID", album.ID, "jobID", jobID)
+
+	list, err := s.config.S3Client.List(s.config.Bucket, s.downloadsKey(album))
+
+	if err != nil {
+		l.Error("error listing existing zip parts", "error", err)
+		return nil
+	}
+
+	parts := map[int]s3.Object{}
+
+	for _, file := range list.Objects {
+		if number := zipPartNumber(jobID, filepath.Base(file.Key)); number > 0 {
+			parts[number] = file
+		}
+	}
+
+	result := []string{}
+	keys := []string{}
+	complete := true
+
+	for number := 1; number <= len(parts); number++ {
+		file, ok := parts[number]
+
+		if !ok || !s.isCompleteZipObject(l, file.Key, file.Size) {
+			complete = false
+		}
+
+		if ok {
+			result = append(result, filepath.Base(file.Key))
+		}
+	}
+
+	if complete {
+		found := make([]s3.Object, 0, len(parts))
+
+		for _, file := range parts {
+			found = append(found, file)
+		}
+
+		stale, staleErr := s.predatesOriginals(album, found)
+
+		if staleErr == nil && !stale {
+			return result
+		}
+
+		l.Warn("existing zip parts may be older than the album's originals", "error", staleErr)
+	}
+
+	for _, file := range parts {
+		keys = append(keys, file.Key)
+	}
+
+	l.Warn("existing zip parts are incomplete or outdated, rebuilding them", "zipKeys", keys)
+
+	if _, err = s.config.S3Client.Delete(s.config.Bucket, keys); err != nil {
+		l.Error("failed to remove incomplete zip parts", "error", err)
+	}
+
+	return nil
+}
+
+// failJob marks a zip job as failed
+func (s ZipService) failJob(jobID string, err error) {
+	metrics.ZipJobsFailed.Inc()
+
+	s.jobs.update(jobID, func(job *ZipJob) {
+		job.State = ZipJobFailed
+		job.Error = err.Error()
+		job.QueuePosition = 0
+	})
+}
+
+/*
+abortZip stops an in-progress upload and removes anything that made it to
+S3, including parts that were already finished. The upload context must
+already be canceled so the upload fails rather than completing with a
+truncated zip.
+*/
+func (s ZipService) abortZip(jobID string, part *zipPart, finished []*zipPart) {
+	if part != nil {
+		_ = part.stream.Writer.Close()
+		_, _ = part.stream.Wait()
+		finished = append(finished, part)
+	}
+
+	s.discardZipParts(slog.Default(), finished)
+	s.failJob(jobID, ErrZipServiceShuttingDown)
+}
+
+// discardZipParts removes the zips a failed job already uploaded
+func (s ZipService) discardZipParts(l *slog.Logger, parts []*zipPart) {
+	if len(parts) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(parts))
+
+	for _, part := range parts {
+		keys = append(keys, part.key)
+	}
+
+	if _, err := s.config.S3Client.Delete(s.config.Bucket, keys); err != nil {
+		l.Error("failed to remove zips from S3", "error", err, "zipKeys", keys)
+	}
+}
+
+/*
+Shutdown stops accepting new zip jobs and waits for running jobs to finish.
+If ctx ends first, running jobs are aborted and their partial uploads are
+removed.
+*/
+func (s ZipService) Shutdown(ctx context.Context) error {
+	s.shuttingDown.Store(true)
+
+	done := make(chan struct{})
+
+	go func() {
+		s.jobsWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("all zip jobs finished")
+		return nil
+
+	case <-ctx.Done():
+		slog.Warn("timed out waiting for zip jobs. aborting them")
+		s.cancelJobs()
+	}
+
+	select {
+	case <-done:
+	case <-time.After(zipAbortGracePeriod):
+		slog.Error("zip jobs did not abort in time")
+	}
+
+	return fmt.Errorf("timed out waiting for zip jobs to finish: %w", ctx.Err())
+}
+
+/*
+GetClientJobs returns the status of every zip the client asked for that is
+still being built, and those that finished in the last day. Newest first.
+*/
+func (s ZipService) GetClientJobs(clientID uint) []ZipJob {
+	return s.jobs.forClient(clientID, s.config.Clock.Now().Add(-recentZipJobWindow))
+}
+
+// GetJob returns the current status of a zip job
+func (s ZipService) GetJob(jobID string) (ZipJob, bool) {
+	return s.jobs.get(jobID)
+}
+
+func (s ZipService) processZip(jobID, zipFilename string, album *models.Album, client *models.Client) {
+	var (
+		part     *zipPart
+		finished []*zipPart
+	)
+
+	l := slog.With("albumID", album.ID, "jobID", jobID)
+	l.Info("starting zip creation process with io.Pipe")
+	metrics.ZipJobsStarted.Inc()
+
+	listResponse, err := s.config.S3Client.List(s.config.Bucket, s.originalsKey(album), listoptions.WithGetAll())
+
+	if err != nil {
+		l.Error("error listing album images", "error", err)
+		s.failJob(jobID, err)
+		return
+	}
+
+	/*
+	 * An album without originals gets no zip. One with only a manifest
+	 * would be smaller than minCompleteZipSize, so it would look truncated
+	 * and be rebuilt on every request, and removed by CleanupInvalidZips.
+	 */
+	if len(listResponse.Objects) == 0 {
+		l.Warn("album has no originals. not building a zip")
+		s.failJob(jobID, ErrZipAlbumEmpty)
+		return
+	}
+
+	/*
+	 * Albums larger than MaxZipBytes are split into numbered parts. The
+	 * running size is the size of the originals, so a part can end up a
+	 * little over the limit once zip headers are added.
+	 */
+	var totalBytes int64
+
+	for _, obj := range listResponse.Objects {
+		totalBytes += obj.Size
+	}
+
+	split := s.config.MaxZipBytes > 0 && totalBytes > s.config.MaxZipBytes
+
+	s.jobs.update(jobID, func(job *ZipJob) {
+		job.FilesTotal = len(listResponse.Objects)
+	})
+
+	// Files that couldn't be added still count as done, so progress reaches the total
+	fileDone := func() {
+		s.jobs.update(jobID, func(job *ZipJob) {
+			job.FilesDone++
+		})
+	}
+	favorites := s.favoriteFilenames(l, album)
+
+	startPart := func(number int) (*zipPart, error) {
+		if !split {
+			return s.startZipPart(album, zipFilename, 0)
+		}
+
+		return s.startZipPart(album, zipPartFilename(jobID, number), number)
+	}
+
+	fail := func(err error) {
+		s.discardZipParts(l, finished)
+		s.failJob(jobID, err)
+	}
+
+	finishPart := func(p *zipPart) error {
+		if s.config.IncludeManifest {
+			if err := p.addManifest(album, client, s.config.Clock.Now()); err != nil {
+				return err
+			}
+		}
+
+		return p.finish()
+	}
+
+	/*
+	 * Originals are downloaded in parallel, but written to the zip one at
+	 * a time and in order since zip.Writer isn't safe for concurrent use.
+	 */
+	prefetchCtx, cancelPrefetch := context.WithCancel(s.jobsCtx)
+	defer cancelPrefetch()
+
+	for obj := range prefetchObjects(prefetchCtx, s.config.S3Client, s.config.Bucket, listResponse.Objects, s.config.DownloadWorkers) {
+		if obj.Err != nil {
+			l.Error("failed to add image to zip", "error", obj.Err, "image", obj.Key)
+			fileDone()
+			continue
+		}
+
+		// A file bigger than the limit on its own still gets a part of its own
+		if split && part != nil && part.size > 0 && part.size+int64(len(obj.Body)) > s.config.MaxZipBytes {
+			if err = finishPart(part); err != nil {
+				l.Error("failed to finish zip part", "error", err, "zipKey", part.key)
+				fail(err)
+				return
+			}
+
+			finished = append(finished, part)
+			part = nil
+		}
+
+		if part == nil {
+			if part, err = startPart(len(finished) + 1); err != nil {
+				l.Error("failed to setup s3 stream", "error", err)
+				fail(err)
+				return
+			}
+		}
+
+		folder := ""
+
+		if favorites[filepath.Base(obj.Key)] {
+			folder = zipFavoritesFolder
+		}
+
+		err = part.add(obj, folder)
+		fileDone()
+
+		if err != nil {
+			l.Error("failed to add image to zip", "error", err, "image", obj.Key)
+		}
+	}
+
+	if s.jobsCtx.Err() != nil {
+		l.Warn("shutting down. aborting zip creation")
+		s.abortZip(jobID, part, finished)
+		return
+	}
+
+	// Nothing could be downloaded, so there is nothing worth zipping
+	if part == nil {
+		l.Error("no photos could be added to the zip")
+		fail(ErrZipNoPhotosAdded)
+		return
+	}
+
+	if err = finishPart(part); err != nil {
+		l.Error("failed to finish zip", "error", err, "zipKey", part.key)
+		fail(err)
+		return
+	}
+
+	finished = append(finished, part)
+
+	l.Info("finished uploading zip file to S3", "parts", len(finished))
+	metrics.ZipJobsCompleted.Inc()
+
+	downloadURLs := make([]string, 0, len(finished))
+
+	for _, p := range finished {
+		downloadURLs = append(downloadURLs, s.downloadURL(album, p.filename, s.linkExpiry(s.config.Clock.Now())))
+	}
+
+	/*
+	 * The recipient is read as the job completes, so a client who asks for
+	 * a prewarmed zip while it is being built is still notified
+	 */
+	var recipient *models.Client
+
+	s.jobs.update(jobID, func(job *ZipJob) {
+		job.State = ZipJobCompleted
+		job.DownloadURL = downloadURLs[0]
+		job.DownloadURLs = downloadURLs
+		recipient = job.recipient
+	})
+
+	if recipient == nil {
+		l.Info("prewarmed zip is ready", "downloadURLs", downloadURLs)
+		return
+	}
+
+	if err = s.notifyDownloadReady(s.jobsCtx, jobID, album, recipient, downloadURLs); err != nil {
+		return
+	}
+
+	l.Info("zip creation completed successfully", "downloadURLs", downloadURLs)
+}
+
+/*
+zipPart is one zip being streamed to S3. Albums that aren't split are
+written as a single part, numbered 0.
+*/
+type zipPart struct {
+	filename  string
+	files     []string
+	key       string
+	names     map[string]bool
+	number    int
+	size      int64
+	stream    s3.PutStreamResponse
+	zipWriter *zip.Writer
+}
+
+/*
+startZipPart opens an upload for a new zip in the album's downloads folder.
+The upload uses the jobs context so Shutdown can abort it. An aborted upload
+never completes, so no partial zip is left behind.
+*/
+func (s ZipService) startZipPart(album *models.Album, filename string, number int) (*zipPart, error) {
+	key := filepath.Join(s.downloadsKey(album), filename)
+
+	stream, err := s.config.S3Client.PutStream(
+		s.config.Bucket,
+		key,
+		putoptions.WithContentType("application/zip"),
+		putoptions.WithContext(s.jobsCtx),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("error opening upload for '%s': %w", key, err)
+	}
+
+	return &zipPart{
+		filename: filename,
+		key:      key,
+		number:   number,
+		stream:   stream,
+		zipWriter: zip.NewWriter(metrics.CountingWriter{
+			Counter: metrics.ZipBytesWritten,
+			Writer:  stream.Writer,
+		}),
+	}, nil
 }
 
-type ZipServicer interface {
-	CreateZipAsync(album *models.Album, client *models.Client) (string, error)
-	StartCleanupRoutine(interval time.Duration)
-	StopCleanupRoutine()
+/*
+favoriteFilenames returns the filenames of the album's favorites when
+FavoritesFolder is on, and nothing otherwise. Favorites that can't be read
+are logged, and the zip is built without a favorites folder.
+*/
+func (s ZipService) favoriteFilenames(l *slog.Logger, album *models.Album) map[string]bool {
+	result := map[string]bool{}
+
+	if !s.config.FavoritesFolder {
+		return result
+	}
+
+	favorites, err := s.config.AlbumService.GetFavorites(album.ClientID, album.ID)
+
+	if err != nil {
+		l.Error("error getting favorites for the zip. leaving them with the rest", "error", err)
+		return result
+	}
+
+	for _, favorite := range favorites {
+		result[favorite.ImagePath] = true
+	}
+
+	return result
 }
 
-type ZipService struct {
-	config        ZipServiceConfig
-	cleanupTicker *time.Ticker
-	stopCleanup   chan struct{}
-	wg            *sync.WaitGroup
+// add writes an original to the zip, inside folder when one is given
+func (p *zipPart) add(obj prefetchedObject, folder string) error {
+	imageName := p.entryName(folder, filepath.Base(obj.Key))
+	slog.Info("adding image to zip", "image", imageName, "zipKey", p.key)
+
+	dest, err := p.zipWriter.Create(imageName)
+
+	if err != nil {
+		return fmt.Errorf("failed to create file '%s' in zip: %w", imageName, err)
+	}
+
+	if _, err := dest.Write(obj.Body); err != nil {
+		return fmt.Errorf("failed to copy file '%s' to zip: %w", imageName, err)
+	}
+
+	p.files = append(p.files, imageName)
+	p.size += int64(len(obj.Body))
+	return nil
 }
 
-func NewZipService(config ZipServiceConfig) ZipService {
-	// Default expiration to 7 days if not specified
-	if config.ExpirationDays <= 0 {
-		config.ExpirationDays = 7
+/*
+entryName returns the path of a file in the zip, inside folder when one is
+given. Names are compared ignoring case, as they are when extracted on most
+desktops, and a name already in the zip gets a number added so no entry
+overwrites another.
+*/
+func (p *zipPart) entryName(folder, filename string) string {
+	if p.names == nil {
+		p.names = map[string]bool{strings.ToLower(zipManifestName): true}
 	}
 
-	return ZipService{
-		config:      config,
-		stopCleanup: make(chan struct{}),
-		wg:          &sync.WaitGroup{},
+	name := path.Join(folder, filename)
+	extension := path.Ext(name)
+	stem := strings.TrimSuffix(name, extension)
+
+	for number := 2; p.names[strings.ToLower(name)]; number++ {
+		name = fmt.Sprintf("%s-%d%s", stem, number, extension)
 	}
+
+	p.names[strings.ToLower(name)] = true
+	return name
 }
 
-func (s ZipService) CreateZipAsync(album *models.Album, client *models.Client) (string, error) {
-	var (
-		err        error
-		objectData *s3.ObjectMetadata
-	)
+/*
+addManifest writes manifest.txt at the root of the zip, listing the album,
+the client, when the zip was made, and each photo in it. It must be the
+last entry added.
+*/
+func (p *zipPart) addManifest(album *models.Album, client *models.Client, generatedAt time.Time) error {
+	manifest := &strings.Builder{}
 
-	jobID := fmt.Sprintf("%s-%d", strings.ReplaceAll(album.Name, " ", "-"), album.ID)
-	zipFilename := fmt.Sprintf("%s.zip", jobID)
+	fmt.Fprintf(manifest, "Album: %s\r\n", album.Name)
+	fmt.Fprintf(manifest, "Client: %s\r\n", client.Name)
+	fmt.Fprintf(manifest, "Generated: %s\r\n", generatedAt.Format("January 2, 2006 3:04 PM MST"))
 
-	zipKey := filepath.Join(
-		s.config.ClientPhotoFolder,
-		fmt.Sprint(client.ID),
-		fmt.Sprint(album.ID),
-		"downloads",
-		zipFilename,
-	)
+	if p.number > 0 {
+		fmt.Fprintf(manifest, "Part: %d\r\n", p.number)
+	}
 
-	// Check if the file already exists
-	if objectData, err = s.config.S3Client.StatObject(s.config.Bucket, zipKey); err == nil && objectData != nil {
-		slog.Info("zip file already exists, sending email only", "zipKey", zipKey, "albumID", album.ID)
-		downloadURL := fmt.Sprintf("%s/client/downloads/%s", s.config.BaseDownloadURL, zipFilename)
+	fmt.Fprintf(manifest, "Photos: %d\r\n\r\n", len(p.files))
+
+	for _, file := range p.files {
+		fmt.Fprintf(manifest, "%s\r\n", file)
+	}
+
+	dest, err := p.zipWriter.Create(zipManifestName)
+
+	if err != nil {
+		return fmt.Errorf("failed to create %s in zip: %w", zipManifestName, err)
+	}
+
+	if _, err = io.WriteString(dest, manifest.String()); err != nil {
+		return fmt.Errorf("failed to write %s to zip: %w", zipManifestName, err)
+	}
+
+	return nil
+}
+
+// finish writes the zip's central directory and waits for the upload to complete
+func (p *zipPart) finish() error {
+	if err := p.zipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close zip writer: %w", err)
+	}
+
+	if err := p.stream.Writer.Close(); err != nil {
+		return fmt.Errorf("failed to close s3 stream writer: %w", err)
+	}
+
+	if _, err := p.stream.Wait(); err != nil {
+		return fmt.Errorf("failed to wait for s3 stream: %w", err)
+	}
+
+	return nil
+}
+
+/*
+notifyDownloadReady emails the client their download link and, when a
+webhook is configured, posts it to the webhook at the same time. The two
+run independently so a slow or failing webhook never holds up the email.
+Clients who turned off download emails aren't emailed. They pick the zip up
+from their downloads page instead. Only the email's error is returned.
+*/
+func (s ZipService) notifyDownloadReady(ctx context.Context, jobID string, album *models.Album, client *models.Client, downloadURLs []string) error {
+	webhookDone := make(chan struct{})
+
+	if s.config.WebhookURL == "" {
+		close(webhookDone)
+	} else {
+		go func() {
+			defer close(webhookDone)
+			_ = s.sendDownloadWebhook(ctx, jobID, album, client, downloadURLs)
+		}()
+	}
+
+	var err error
+
+	if client.NotifyOnDownload {
+		err = s.sendDownloadEmail(ctx, jobID, album, client, downloadURLs)
+	} else {
+		slog.Info("client turned off download emails, not sending one", "albumID", album.ID, "clientID", client.ID, "jobID", jobID)
+
+		s.jobs.update(jobID, func(job *ZipJob) {
+			job.DownloadURL = downloadURLs[0]
+			job.DownloadURLs = downloadURLs
+			job.EmailSkipped = true
+		})
+	}
+
+	<-webhookDone
+	return err
+}
+
+/*
+sendDownloadEmail emails the client their download link. Transient failures
+are retried with backoff until ctx is done. The outcome is recorded on the
+zip job.
+*/
+func (s ZipService) sendDownloadEmail(ctx context.Context, jobID string, album *models.Album, client *models.Client, downloadURLs []string) error {
+	l := slog.With("albumID", album.ID, "email", client.Email, "jobID", jobID)
+
+	data := map[string]any{
+		"downloadURL":    downloadURLs[0],
+		"name":           client.Name,
+		"albumName":      album.Name,
+		"expirationDays": s.config.ExpirationDays,
+	}
+
+	// downloadParts is only set for split zips so templates can check for it
+	if len(downloadURLs) > 1 {
+		parts := make([]map[string]any, 0, len(downloadURLs))
+
+		for i, downloadURL := range downloadURLs {
+			parts = append(parts, map[string]any{"number": i + 1, "url": downloadURL})
+		}
 
-		err = SendEmail(
-			s.config.EmailApiKey,
+		data["downloadParts"] = parts
+	}
+
+	err := RetryWithBackoff(ctx, func() error {
+		return SendEmail(
+			s.config.EmailSender,
 			client.Name,
 			client.Email,
 			s.config.FromName,
 			s.config.FromEmail,
-			map[string]any{
-				"downloadURL":    downloadURL,
-				"name":           client.Name,
-				"albumName":      album.Name,
-				"expirationDays": s.config.ExpirationDays,
-			},
+			s.config.EmailTemplate,
+			data,
 		)
+	}, RetryOptions{
+		BaseDelay:   s.config.EmailRetryDelay,
+		MaxAttempts: s.config.EmailMaxAttempts,
+		OnRetry: func(attempt int, err error) {
+			l.Warn("failed to send email notification. retrying", "attempt", attempt, "error", err)
+		},
+	})
+
+	s.jobs.update(jobID, func(job *ZipJob) {
+		job.DownloadURL = downloadURLs[0]
+		job.DownloadURLs = downloadURLs
+		job.EmailSent = err == nil
 
 		if err != nil {
-			slog.Error("failed to send email notification", "error", err, "email", client.Email, "albumID", album.ID)
-			return jobID, err
+			job.EmailError = err.Error()
 		}
+	})
 
-		return jobID, nil
+	if err != nil {
+		l.Error("failed to send email notification", "error", err)
+		return err
 	}
 
-	// Start the background job to create the zip
-	go s.processZip(zipKey, zipFilename, album, client)
+	return nil
+}
 
-	return jobID, nil
+/*
+ResendDownloadEmail emails the client the links to the album's zip again
+without rebuilding it. It reports false, and sends nothing, when there is no
+complete zip that hasn't expired, so the caller can start a new one. The
+email is sent in the background like any other, even to clients who turned
+download emails off, since they asked for this one.
+*/
+func (s ZipService) ResendDownloadEmail(album *models.Album, client *models.Client) (bool, error) {
+	if s.shuttingDown.Load() {
+		return false, ErrZipServiceShuttingDown
+	}
+
+	downloadURLs, err := s.currentDownloadURLs(album)
+
+	if err != nil || len(downloadURLs) == 0 {
+		return false, err
+	}
+
+	jobID := zipJobID(album)
+	slog.Info("resending download email", "albumID", album.ID, "clientID", client.ID, "jobID", jobID, "parts", len(downloadURLs))
+
+	s.jobsWG.Add(1)
+
+	go func() {
+		defer s.jobsWG.Done()
+		_ = s.sendDownloadEmail(s.jobsCtx, jobID, album, client, downloadURLs)
+	}()
+
+	return true, nil
 }
 
-func (s ZipService) processZip(zipKey, zipFilename string, album *models.Album, client *models.Client) {
-	l := slog.With("albumID", album.ID, "zipKey", zipKey)
-	l.Info("starting zip creation process with io.Pipe")
+/*
+currentDownloadURLs returns the links to the album's zip when it is complete
+and hasn't expired: the single zip, or every part of a split one in order.
+Nothing is returned when a part is missing, incomplete, or expired. Like
+ListClientDownloads, only the size of each zip is checked.
+*/
+func (s ZipService) currentDownloadURLs(album *models.Album) ([]string, error) {
+	zips, err := s.currentZips(album)
 
-	originalsKey := filepath.Join(
-		s.config.ClientPhotoFolder,
-		fmt.Sprint(album.ClientID),
-		fmt.Sprint(album.ID),
-		"originals",
-	)
+	if err != nil {
+		return nil, err
+	}
 
-	addFile := func(zipWriter *zip.Writer, key string) error {
-		imageName := filepath.Base(key)
-		l.Info("adding image to zip", "image", imageName)
+	result := []string{}
 
-		src, err := s.config.S3Client.Get(s.config.Bucket, key)
+	for _, file := range zips {
+		result = append(result, s.downloadURL(album, filepath.Base(file.Key), s.linkExpiry(file.LastModified)))
+	}
 
-		if err != nil {
-			return fmt.Errorf("failed to get source file from '%s' S3: %w", key, err)
-		}
+	return result, nil
+}
 
-		dest, err := zipWriter.Create(imageName)
+/*
+currentZips returns the album's zip when it is complete and hasn't expired:
+the single zip, or every part of a split one in order. Nothing is returned
+when a part is missing, incomplete, or expired.
+*/
+func (s ZipService) currentZips(album *models.Album) ([]s3.Object, error) {
+	list, err := s.config.S3Client.List(s.config.Bucket, s.downloadsKey(album))
 
-		if err != nil {
-			return fmt.Errorf("failed to create file '%s' in zip: %w", imageName, err)
+	if err != nil {
+		return nil, fmt.Errorf("error listing downloads for album %d: %w", album.ID, err)
+	}
+
+	jobID := zipJobID(album)
+	parts := map[int]s3.Object{}
+
+	usable := func(file s3.Object) bool {
+		return isCompleteZip(file.Size) && !s.IsExpired(file.LastModified)
+	}
+
+	for _, file := range list.Objects {
+		filename := filepath.Base(file.Key)
+
+		if filename == jobID+".zip" && usable(file) {
+			return []s3.Object{file}, nil
+		}
+
+		if number := zipPartNumber(jobID, filename); number > 0 {
+			parts[number] = file
 		}
+	}
+
+	result := []s3.Object{}
 
-		defer src.Body.Close()
+	for number := 1; number <= len(parts); number++ {
+		file, ok := parts[number]
 
-		if _, err := io.Copy(dest, src.Body); err != nil {
-			return fmt.Errorf("failed to copy file '%s' to zip: %w", imageName, err)
+		if !ok || !usable(file) {
+			return nil, nil
 		}
 
-		return nil
+		result = append(result, file)
 	}
 
-	stream, err := s.config.S3Client.PutStream(s.config.Bucket, zipKey, putoptions.WithContentType("application/zip"))
+	return result, nil
+}
+
+/*
+EstimateBundle reports how many files an album's zip will hold and the total
+size of the originals going into it. Only the S3 listing is read, so nothing
+is downloaded. The zip itself is slightly larger because of its headers.
+*/
+func (s ZipService) EstimateBundle(album *models.Album) (fileCount int, totalBytes int64, err error) {
+	var (
+		list s3.ListResponse
+	)
 
-	if err != nil {
-		l.Error("failed to setup s3 stream", "error", err)
-		return
+	if list, err = s.config.S3Client.List(s.config.Bucket, s.originalsKey(album), listoptions.WithGetAll()); err != nil {
+		return 0, 0, fmt.Errorf("error listing originals for album %d: %w", album.ID, err)
 	}
 
-	zipWriter := zip.NewWriter(stream.Writer)
-	listResponse, err := s.config.S3Client.List(s.config.Bucket, originalsKey, listoptions.WithGetAll())
+	for _, file := range list.Objects {
+		fileCount++
+		totalBytes += file.Size
+	}
 
-	if err != nil {
-		l.Error("error listing album images", "error", err)
-		return
+	return fileCount, totalBytes, nil
+}
+
+/*
+ListClientDownloads returns the zips available to a client across all of
+their albums, newest first. Expired and incomplete zips are left out. Each
+part of a split zip is its own download, with Part set to its number.
+*/
+func (s ZipService) ListClientDownloads(clientID uint) ([]DownloadInfo, error) {
+	var (
+		err    error
+		albums []*models.Album
+		list   s3.ListResponse
+	)
+
+	result := []DownloadInfo{}
+
+	if albums, err = s.config.AlbumService.GetAlbumList(clientID); err != nil {
+		return result, fmt.Errorf("error retrieving albums for client %d: %w", clientID, err)
 	}
 
-	for _, img := range listResponse.Objects {
-		if err = addFile(zipWriter, img.Key); err != nil {
-			l.Error("failed to add image to zip", "error", err, "image", img.Key)
-			continue
+	for _, album := range albums {
+		if list, err = s.config.S3Client.List(s.config.Bucket, s.downloadsKey(album)); err != nil {
+			return result, fmt.Errorf("error listing downloads for album %d: %w", album.ID, err)
 		}
-	}
 
-	if err = zipWriter.Close(); err != nil {
-		l.Error("failed to close zip writer", "error", err)
-		return
+		for _, file := range list.Objects {
+			if !strings.HasSuffix(strings.ToLower(file.Key), ".zip") || !isCompleteZip(file.Size) || s.IsExpired(file.LastModified) {
+				continue
+			}
+
+			filename := filepath.Base(file.Key)
+
+			result = append(result, DownloadInfo{
+				AlbumID:     album.ID,
+				AlbumName:   album.Name,
+				CreatedAt:   file.LastModified,
+				DownloadURL: s.downloadURL(album, filename, s.linkExpiry(file.LastModified)),
+				ExpiresAt:   s.linkExpiry(file.LastModified),
+				Filename:    filename,
+				Part:        zipPartNumber(zipJobID(album), filename),
+				Size:        file.Size,
+			})
+		}
 	}
 
-	if err = stream.Writer.Close(); err != nil {
-		l.Error("failed to close s3 stream writer", "error", err)
-		return
+	/*
+	 * The parts of a split zip stay together, in order, and are sorted as
+	 * of their newest part.
+	 */
+	newestPart := map[uint]time.Time{}
+
+	for _, download := range result {
+		if download.Part > 0 && download.CreatedAt.After(newestPart[download.AlbumID]) {
+			newestPart[download.AlbumID] = download.CreatedAt
+		}
 	}
 
-	_, err = stream.Wait()
+	sortTime := func(download DownloadInfo) time.Time {
+		if download.Part > 0 {
+			return newestPart[download.AlbumID]
+		}
 
-	if err != nil {
-		l.Error("failed to wait for s3 stream", "error", err)
-		return
+		return download.CreatedAt
 	}
 
-	l.Info("finished uploading zip file to S3")
+	slices.SortFunc(result, func(a, b DownloadInfo) int {
+		return cmp.Or(
+			sortTime(b).Compare(sortTime(a)),
+			cmp.Compare(a.AlbumID, b.AlbumID),
+			cmp.Compare(a.Part, b.Part),
+		)
+	})
 
-	// Generate download URL
-	downloadURL := fmt.Sprintf("%s/client/downloads/%s", s.config.BaseDownloadURL, zipFilename)
+	return result, nil
+}
 
-	err = SendEmail(
-		s.config.EmailApiKey,
-		client.Name,
-		client.Email,
-		s.config.FromName,
-		s.config.FromEmail,
-		map[string]any{
-			"downloadURL":    downloadURL,
-			"name":           client.Name,
-			"albumName":      album.Name,
-			"expirationDays": s.config.ExpirationDays,
-		},
+// IsExpired returns true when a zip created at lastModified is past the
+// configured expiration period
+func (s ZipService) IsExpired(lastModified time.Time) bool {
+	return lastModified.Before(s.expirationCutoff())
+}
+
+// expirationCutoff is the point in time, by the configured clock, before which zips are considered expired
+func (s ZipService) expirationCutoff() time.Time {
+	return s.config.Clock.Now().AddDate(0, 0, -s.config.ExpirationDays)
+}
+
+// downloadsKey is the S3 prefix holding an album's zips
+func (s ZipService) downloadsKey(album *models.Album) string {
+	return filepath.Join(
+		s.config.ClientPhotoFolder,
+		fmt.Sprint(album.ClientID),
+		fmt.Sprint(album.ID),
+		"downloads",
 	)
+}
 
-	if err != nil {
-		l.Error("failed to send email notification", "error", err, "email", client.Email)
-		return
-	}
+// originalsKey is the S3 prefix holding an album's original images
+func (s ZipService) originalsKey(album *models.Album) string {
+	return filepath.Join(
+		s.config.ClientPhotoFolder,
+		fmt.Sprint(album.ClientID),
+		fmt.Sprint(album.ID),
+		"originals",
+	)
+}
+
+/*
+downloadURL builds the link a client uses to download a finished zip. The
+link holds a signed token rather than the zip's name, and stops working at
+expiresAt.
+*/
+func (s ZipService) downloadURL(album *models.Album, zipFilename string, expiresAt time.Time) string {
+	token := SignDownloadToken(s.config.DownloadTokenSecret, DownloadToken{
+		AlbumID:   album.ID,
+		ClientID:  album.ClientID,
+		ExpiresAt: expiresAt,
+		Filename:  zipFilename,
+	})
+
+	return fmt.Sprintf("%s/client/zips/%s", s.config.BaseDownloadURL, url.PathEscape(token))
+}
 
-	l.Info("zip creation completed successfully", "downloadURL", downloadURL)
+// linkExpiry is when the link to a zip created at createdAt stops working
+func (s ZipService) linkExpiry(createdAt time.Time) time.Time {
+	return createdAt.AddDate(0, 0, s.config.ExpirationDays)
 }
 
 // StartCleanupRoutine starts a periodic routine to clean up expired zip files
@@ -219,7 +1430,10 @@ func (s ZipService) StartCleanupRoutine(interval time.Duration) {
 		for {
 			select {
 			case <-s.cleanupTicker.C:
-				s.cleanupExpiredZips()
+				if _, err := s.CleanupExpiredZips(); err != nil {
+					slog.Error("error cleaning up expired zips", "error", err)
+				}
+
 			case <-s.stopCleanup:
 				s.cleanupTicker.Stop()
 				return
@@ -239,67 +1453,196 @@ func (s ZipService) StopCleanupRoutine() {
 	}
 }
 
-// cleanupExpiredZips removes zip files older than the expiration period
-func (s ZipService) cleanupExpiredZips() {
+/*
+CleanupExpiredZips removes zip files older than the expiration period. It
+runs on the cleanup routine's schedule and can be run on demand. Returns the
+number of zips removed, which are still counted when the clients or albums
+to look through can't all be read.
+*/
+func (s ZipService) CleanupExpiredZips() (int, error) {
+	l := slog.With("function", "CleanupExpiredZips")
+	l.Info("starting cleanup of expired zip files")
+
+	var removedCount int
+
+	err := s.forEachDownloadZip(l, func(file s3.Object) {
+		// Check if the file is older than the cutoff time
+		if !s.IsExpired(file.LastModified) {
+			return
+		}
+
+		l.Info("removing expired zip file from S3", "path", file.Key, "modTime", file.LastModified)
+
+		if _, err := s.config.S3Client.Delete(s.config.Bucket, []string{file.Key}); err != nil {
+			l.Error("failed to remove expired zip file from S3", "error", err, "path", file.Key)
+		} else {
+			removedCount++
+		}
+	})
+
+	if err != nil {
+		return removedCount, fmt.Errorf("error cleaning up expired zips: %w", err)
+	}
+
+	l.Info("completed cleanup of expired zip files", "removed", removedCount)
+	return removedCount, nil
+}
+
+/*
+CleanupInvalidZips removes zips that are missing their central directory,
+such as those left behind when the process dies mid-upload. Zips that a
+running job is still writing are left alone. Streaming uploads that never
+completed aren't visible as objects at all, so those are left to the
+bucket's lifecycle rules. Returns the number of zips removed.
+*/
+func (s ZipService) CleanupInvalidZips() int {
+	l := slog.With("function", "CleanupInvalidZips")
+	l.Info("starting cleanup of invalid zip files")
+
+	var removedCount int
+
+	err := s.forEachDownloadZip(l, func(file s3.Object) {
+		jobID := strings.TrimSuffix(filepath.Base(file.Key), filepath.Ext(file.Key))
+
+		// Parts of a split zip are named for their job plus a part number
+		if i := strings.LastIndex(jobID, "-"); i > 0 && s.jobs.isRunning(jobID[:i]) {
+			jobID = jobID[:i]
+		}
+
+		if s.jobs.isRunning(jobID) {
+			l.Info("skipping zip with a running job", "path", file.Key, "jobID", jobID)
+			return
+		}
+
+		if isCompleteZip(file.Size) {
+			complete, err := s.hasCentralDirectory(file.Key, file.Size)
+
+			if err != nil {
+				l.Error("error checking zip for a central directory. leaving it", "error", err, "path", file.Key)
+				return
+			}
+
+			if complete {
+				return
+			}
+		}
+
+		l.Warn("removing invalid zip file from S3", "path", file.Key, "size", file.Size)
+
+		if _, err := s.config.S3Client.Delete(s.config.Bucket, []string{file.Key}); err != nil {
+			l.Error("failed to remove invalid zip file from S3", "error", err, "path", file.Key)
+		} else {
+			removedCount++
+		}
+	})
+
+	if err != nil {
+		l.Error("error looking for invalid zip files", "error", err)
+	}
+
+	l.Info("completed cleanup of invalid zip files", "removed", removedCount)
+	return removedCount
+}
+
+/*
+forEachDownloadZip calls fn for every zip in every album's downloads folder.
+It stops with an error when the clients or their albums can't be read. A
+downloads folder that can't be listed is logged and skipped.
+*/
+func (s ZipService) forEachDownloadZip(l *slog.Logger, fn func(file s3.Object)) error {
 	var (
 		err     error
 		clients []models.Client
 		albums  []*models.Album
 	)
 
-	l := slog.With("function", "cleanupExpiredZips")
-	l.Info("starting cleanup of expired zip files")
-
-	// Calculate the cutoff time
-	cutoffTime := time.Now().AddDate(0, 0, -s.config.ExpirationDays)
-	var removedCount int
-
 	if clients, err = s.config.ClientService.GetAll(); err != nil {
-		l.Error("error retrieving clients from database", "error", err)
-		return
+		return fmt.Errorf("error retrieving clients from database: %w", err)
 	}
 
 	for _, client := range clients {
 		if albums, err = s.config.AlbumService.GetAlbumList(client.ID); err != nil {
-			l.Error("error retrieving albums", "clientID", client.ID, "error", err)
-			return
+			return fmt.Errorf("error retrieving albums for client %d: %w", client.ID, err)
 		}
 
 		for _, album := range albums {
-			downloadsKey := filepath.Join(
-				s.config.ClientPhotoFolder,
-				fmt.Sprint(album.ClientID),
-				fmt.Sprint(album.ID),
-				"downloads",
-			)
-
+			downloadsKey := s.downloadsKey(album)
 			listResponse, err := s.config.S3Client.List(s.config.Bucket, downloadsKey)
 			if err != nil {
 				l.Error("failed to list S3 directory", "error", err, "path", downloadsKey)
 				continue
 			}
 
-			// Check each file
 			for _, file := range listResponse.Objects {
 				// Only process zip files
 				if !strings.HasSuffix(strings.ToLower(file.Key), ".zip") {
 					continue
 				}
 
-				// Check if the file is older than the cutoff time
-				if file.LastModified.Before(cutoffTime) {
-					l.Info("removing expired zip file from S3", "path", file.Key, "modTime", file.LastModified)
-
-					if _, err := s.config.S3Client.Delete(s.config.Bucket, []string{file.Key}); err != nil {
-						l.Error("failed to remove expired zip file from S3", "error", err, "path", file.Key)
-					} else {
-						removedCount++
-					}
-				}
+				fn(file)
 			}
 		}
 	}
 
-	l.Info("completed cleanup of expired zip files", "removed", removedCount)
+	return nil
+}
+
+// zipJobID names an album's zip job. It is also the zip's filename without the extension.
+func zipJobID(album *models.Album) string {
+	return fmt.Sprintf("%s-%d", strings.ReplaceAll(album.Name, " ", "-"), album.ID)
+}
+
+// zipPartFilename names one part of a split zip, numbered from 1
+func zipPartFilename(jobID string, number int) string {
+	return fmt.Sprintf("%s-%d.zip", jobID, number)
+}
+
+/*
+zipPartNumber returns the part number of filename when it is a part of the
+job's split zip, or 0 when it isn't.
+*/
+func zipPartNumber(jobID, filename string) int {
+	suffix, ok := strings.CutPrefix(filename, jobID+"-")
+
+	if !ok {
+		return 0
+	}
+
+	number, err := strconv.Atoi(strings.TrimSuffix(suffix, ".zip"))
+
+	if err != nil || number < 1 || zipPartFilename(jobID, number) != filename {
+		return 0
+	}
+
+	return number
+}
+
+/*
+isCompleteZip reports whether a zip of the given size could hold at least
+one photo. An empty archive is just its 22 byte end of central directory
+record, and anything under minCompleteZipSize is a truncated upload. This
+only looks at the size. isCompleteZipObject checks the zip itself.
+*/
+func isCompleteZip(size int64) bool {
+	return size >= minCompleteZipSize
 }
 
+/*
+isCompleteZipObject reports whether the zip stored at key is big enough to
+hold a photo and ends with its central directory. A zip that can't be
+checked is treated as incomplete so it gets rebuilt rather than sent.
+*/
+func (s ZipService) isCompleteZipObject(l *slog.Logger, key string, size int64) bool {
+	if !isCompleteZip(size) {
+		return false
+	}
+
+	complete, err := s.hasCentralDirectory(key, size)
+
+	if err != nil {
+		l.Error("error checking zip for a central directory", "error", err, "key", key)
+		return false
+	}
+
+	return complete
+}
@@ -0,0 +1,1373 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/listoptions"
+	"github.com/adampresley/adampresleyphotography/pkg/models"
+)
+
+func TestIsExpired(t *testing.T) {
+	service := NewZipService(ZipServiceConfig{ExpirationDays: 3})
+
+	tests := []struct {
+		name         string
+		lastModified time.Time
+		want         bool
+	}{
+		{name: "just created", lastModified: time.Now(), want: false},
+		{name: "inside the window", lastModified: time.Now().AddDate(0, 0, -2), want: false},
+		{name: "past the window", lastModified: time.Now().AddDate(0, 0, -4), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := service.IsExpired(tt.lastModified); got != tt.want {
+				t.Errorf("IsExpired = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsExpiredDefaultsToSevenDays(t *testing.T) {
+	service := NewZipService(ZipServiceConfig{})
+
+	if service.IsExpired(time.Now().AddDate(0, 0, -6)) {
+		t.Errorf("a six day old zip is expired, want the default of 7 days")
+	}
+
+	if !service.IsExpired(time.Now().AddDate(0, 0, -8)) {
+		t.Errorf("an eight day old zip is not expired, want the default of 7 days")
+	}
+}
+
+// fakeClock is a Clock that only moves when the test moves it
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestCleanupExpiredZipsAtTheCutoff(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, time.March, 10, 12, 0, 0, 0, time.UTC)}
+	cutoff := clock.now.AddDate(0, 0, -7)
+
+	s3Client := newZipS3Client(nil)
+	s3Client.put("clients/1/5/downloads/Before-5.zip", []byte("zip"), cutoff.Add(-time.Second))
+	s3Client.put("clients/1/5/downloads/At-5.zip", []byte("zip"), cutoff)
+	s3Client.put("clients/1/5/downloads/After-5.zip", []byte("zip"), cutoff.Add(time.Second))
+
+	service := NewZipService(ZipServiceConfig{
+		AlbumService: albumListService{albums: map[uint][]*models.Album{
+			1: {{BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Name: "Wedding"}},
+		}},
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		ClientService:     clientListService{clients: []models.Client{{BaseModel: models.BaseModel{ID: 1}}}},
+		Clock:             clock,
+		ExpirationDays:    7,
+		S3Client:          s3Client,
+	})
+
+	steps := []struct {
+		name        string
+		advance     time.Duration
+		wantRemoved int
+		want        map[string]bool
+	}{
+		{
+			name:        "at the cutoff",
+			wantRemoved: 1,
+			want:        map[string]bool{"Before-5.zip": false, "At-5.zip": true, "After-5.zip": true},
+		},
+		{
+			name:        "a second later",
+			advance:     time.Second,
+			wantRemoved: 1,
+			want:        map[string]bool{"At-5.zip": false, "After-5.zip": true},
+		},
+		{
+			name:        "two seconds later",
+			advance:     time.Second,
+			wantRemoved: 1,
+			want:        map[string]bool{"After-5.zip": false},
+		},
+		{
+			name:    "nothing left",
+			advance: time.Hour,
+		},
+	}
+
+	for _, step := range steps {
+		clock.now = clock.now.Add(step.advance)
+
+		removed, err := service.CleanupExpiredZips()
+		if err != nil {
+			t.Fatalf("%s: CleanupExpiredZips returned an error: %v", step.name, err)
+		}
+
+		if removed != step.wantRemoved {
+			t.Errorf("%s: removed %d zips, want %d", step.name, removed, step.wantRemoved)
+		}
+
+		for filename, wantKept := range step.want {
+			if kept := s3Client.has("clients/1/5/downloads/" + filename); kept != wantKept {
+				t.Errorf("%s: %s kept = %v, want %v", step.name, filename, kept, wantKept)
+			}
+		}
+	}
+}
+
+func TestSendDownloadEmailUsesTheConfiguredSender(t *testing.T) {
+	sender := &recordingEmailSender{}
+
+	service := NewZipService(ZipServiceConfig{
+		EmailSender:    sender,
+		EmailTemplate:  LoadEmailTemplate(nil, "", ""),
+		ExpirationDays: 3,
+		FromEmail:      "adam@example.com",
+		FromName:       "Adam",
+	})
+
+	album := &models.Album{BaseModel: models.BaseModel{ID: 5}, Name: "Wedding"}
+	client := &models.Client{Name: "Jane", Email: "jane@example.com"}
+	downloadURL := "https://example.com/client/library/5/downloads/job.zip"
+
+	if err := service.sendDownloadEmail(context.Background(), "job", album, client, []string{downloadURL}); err != nil {
+		t.Fatalf("sendDownloadEmail returned an error: %v", err)
+	}
+
+	sent := sender.messages()
+
+	if len(sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(sent))
+	}
+
+	mail := sent[0]
+
+	if len(mail.To) != 1 || mail.To[0].Email != "jane@example.com" || mail.To[0].Name != "Jane" {
+		t.Errorf("to = %+v, want Jane <jane@example.com>", mail.To)
+	}
+
+	if mail.From.Email != "adam@example.com" {
+		t.Errorf("from = %+v, want adam@example.com", mail.From)
+	}
+
+	for _, want := range []string{downloadURL, "Wedding", "Jane"} {
+		if !strings.Contains(mail.HtmlBody, want) {
+			t.Errorf("body = %q, want it to contain %q", mail.HtmlBody, want)
+		}
+	}
+}
+
+func TestSendDownloadEmailRecordsTheOutcomeOnTheJob(t *testing.T) {
+	errUnavailable := errors.New("service unavailable")
+
+	tests := []struct {
+		name          string
+		email         string
+		errs          []error
+		wantAttempts  int
+		wantEmailSent bool
+	}{
+		{name: "transient failures then success", email: "jane@example.com", errs: []error{errUnavailable, errUnavailable}, wantAttempts: 3, wantEmailSent: true},
+		{name: "retries exhausted", email: "jane@example.com", errs: []error{errUnavailable, errUnavailable, errUnavailable}, wantAttempts: 3},
+		{name: "invalid address", email: "not an address", wantAttempts: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &recordingEmailSender{errs: tt.errs}
+
+			service := NewZipService(ZipServiceConfig{
+				EmailMaxAttempts: 3,
+				EmailRetryDelay:  time.Millisecond,
+				EmailSender:      sender,
+			})
+
+			service.jobs.start(ZipJob{ID: "job"})
+
+			album := &models.Album{BaseModel: models.BaseModel{ID: 5}, Name: "Wedding"}
+			client := &models.Client{Name: "Jane", Email: tt.email}
+
+			err := service.sendDownloadEmail(context.Background(), "job", album, client, []string{"https://example.com/job.zip"})
+
+			if (err == nil) != tt.wantEmailSent {
+				t.Errorf("error = %v, want sent %v", err, tt.wantEmailSent)
+			}
+
+			if got := len(sender.messages()); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+
+			job, _ := service.GetJob("job")
+
+			if job.EmailSent != tt.wantEmailSent {
+				t.Errorf("job.EmailSent = %v, want %v", job.EmailSent, tt.wantEmailSent)
+			}
+
+			if tt.wantEmailSent == (job.EmailError != "") {
+				t.Errorf("job.EmailError = %q, want it set only on failure", job.EmailError)
+			}
+		})
+	}
+}
+
+func TestDownloadEmailFollowsTheClientsPreference(t *testing.T) {
+	tests := []struct {
+		name             string
+		notifyOnDownload bool
+		wantEmails       int
+	}{
+		{name: "notifications on", notifyOnDownload: true, wantEmails: 1},
+		{name: "notifications off", notifyOnDownload: false, wantEmails: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &recordingEmailSender{}
+
+			service := NewZipService(ZipServiceConfig{
+				EmailSender:   sender,
+				EmailTemplate: LoadEmailTemplate(nil, "", ""),
+			})
+
+			service.jobs.start(ZipJob{ID: "job"})
+
+			album := &models.Album{BaseModel: models.BaseModel{ID: 5}, Name: "Wedding"}
+			client := &models.Client{Name: "Jane", Email: "jane@example.com", NotifyOnDownload: tt.notifyOnDownload}
+			downloadURL := "https://example.com/client/library/5/downloads/job.zip"
+
+			if err := service.notifyDownloadReady(context.Background(), "job", album, client, []string{downloadURL}); err != nil {
+				t.Fatalf("notifyDownloadReady returned an error: %v", err)
+			}
+
+			if got := len(sender.messages()); got != tt.wantEmails {
+				t.Errorf("sent %d emails, want %d", got, tt.wantEmails)
+			}
+
+			job, _ := service.GetJob("job")
+
+			if job.DownloadURL != downloadURL {
+				t.Errorf("job.DownloadURL = %q, want %q either way", job.DownloadURL, downloadURL)
+			}
+
+			if job.EmailSkipped == tt.notifyOnDownload {
+				t.Errorf("job.EmailSkipped = %v, want %v", job.EmailSkipped, !tt.notifyOnDownload)
+			}
+		})
+	}
+}
+
+func newShutdownTestService(s3Client *zipS3Client) (ZipService, *models.Album, *models.Client) {
+	service := NewZipService(ZipServiceConfig{
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		EmailSender:       &recordingEmailSender{},
+		S3Client:          s3Client,
+	})
+
+	album := &models.Album{BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Name: "Wedding"}
+	client := &models.Client{BaseModel: models.BaseModel{ID: 1}, Name: "Jane", Email: "jane@example.com", NotifyOnDownload: true}
+
+	return service, album, client
+}
+
+func TestShutdownWaitsForRunningZipJobs(t *testing.T) {
+	s3Client := newZipS3Client(map[string][]byte{"clients/1/5/originals/a.jpg": []byte("a")})
+	service, album, client := newShutdownTestService(s3Client)
+
+	jobID, err := service.CreateZipAsync(album, client)
+	if err != nil {
+		t.Fatalf("CreateZipAsync returned an error: %v", err)
+	}
+
+	shutdown := make(chan error, 1)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		shutdown <- service.Shutdown(ctx)
+	}()
+
+	select {
+	case err = <-shutdown:
+		t.Fatalf("Shutdown returned %v while a job was still running", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(s3Client.release)
+
+	if err = <-shutdown; err != nil {
+		t.Fatalf("Shutdown returned an error: %v", err)
+	}
+
+	if job, _ := service.GetJob(jobID); job.State != ZipJobCompleted {
+		t.Errorf("job state = %s, want %s", job.State, ZipJobCompleted)
+	}
+
+	if !s3Client.has("clients/1/5/downloads/Wedding-5.zip") {
+		t.Errorf("the finished zip was not uploaded")
+	}
+
+	if _, err = service.CreateZipAsync(album, client); !errors.Is(err, ErrZipServiceShuttingDown) {
+		t.Errorf("CreateZipAsync after shutdown: error = %v, want %v", err, ErrZipServiceShuttingDown)
+	}
+}
+
+func TestShutdownAbortsZipJobsAtTheDeadline(t *testing.T) {
+	s3Client := newZipS3Client(map[string][]byte{"clients/1/5/originals/a.jpg": []byte("a")})
+	service, album, client := newShutdownTestService(s3Client)
+
+	jobID, err := service.CreateZipAsync(album, client)
+	if err != nil {
+		t.Fatalf("CreateZipAsync returned an error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err = service.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if job, _ := service.GetJob(jobID); job.State != ZipJobFailed {
+		t.Errorf("job state = %s, want %s", job.State, ZipJobFailed)
+	}
+
+	if s3Client.has("clients/1/5/downloads/Wedding-5.zip") {
+		t.Errorf("a partial zip was left in the bucket")
+	}
+}
+
+/*
+listS3Client lists a fixed set of objects. Anything else panics through
+the nil embedded interface.
+*/
+type listS3Client struct {
+	s3.S3Client
+
+	objects []s3.Object
+}
+
+func (c listS3Client) List(bucket, path string, options ...listoptions.ListOption) (s3.ListResponse, error) {
+	result := s3.ListResponse{}
+
+	for _, object := range c.objects {
+		if strings.HasPrefix(object.Key, path) {
+			result.Objects = append(result.Objects, object)
+		}
+	}
+
+	result.NumObjects = len(result.Objects)
+	return result, nil
+}
+
+/*
+albumListService returns a fixed list of albums per client. Anything else
+panics through the nil embedded interface.
+*/
+type albumListService struct {
+	AlbumServicer
+
+	albums map[uint][]*models.Album
+}
+
+func (s albumListService) GetAlbumList(clientID uint) ([]*models.Album, error) {
+	return s.albums[clientID], nil
+}
+
+func TestListClientDownloads(t *testing.T) {
+	now := time.Now()
+
+	albums := albumListService{albums: map[uint][]*models.Album{
+		1: {
+			{BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Name: "Wedding"},
+			{BaseModel: models.BaseModel{ID: 6}, ClientID: 1, Name: "Reception"},
+		},
+		2: {
+			{BaseModel: models.BaseModel{ID: 7}, ClientID: 2, Name: "Portraits"},
+		},
+	}}
+
+	s3Client := listS3Client{objects: []s3.Object{
+		{Key: "clients/1/5/downloads/Wedding-5.zip", Size: 4096, LastModified: now.Add(-2 * time.Hour)},
+		{Key: "clients/1/5/downloads/notes.txt", Size: 4096, LastModified: now},
+		{Key: "clients/1/6/downloads/Reception-6.zip", Size: 8192, LastModified: now.Add(-time.Hour)},
+		{Key: "clients/1/6/downloads/truncated.zip", Size: 22, LastModified: now},
+		{Key: "clients/1/6/downloads/old.zip", Size: 4096, LastModified: now.AddDate(0, 0, -8)},
+		{Key: "clients/2/7/downloads/Portraits-7.zip", Size: 4096, LastModified: now.AddDate(0, 0, -10)},
+	}}
+
+	service := NewZipService(ZipServiceConfig{
+		AlbumService:      albums,
+		BaseDownloadURL:   "https://example.com",
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		ExpirationDays:    7,
+		S3Client:          s3Client,
+	})
+
+	t.Run("multiple downloads", func(t *testing.T) {
+		downloads, err := service.ListClientDownloads(1)
+		if err != nil {
+			t.Fatalf("ListClientDownloads returned an error: %v", err)
+		}
+
+		if len(downloads) != 2 {
+			t.Fatalf("got %d downloads, want 2: %+v", len(downloads), downloads)
+		}
+
+		// Newest first
+		want := []DownloadInfo{
+			{AlbumID: 6, AlbumName: "Reception", Filename: "Reception-6.zip", Size: 8192},
+			{AlbumID: 5, AlbumName: "Wedding", Filename: "Wedding-5.zip", Size: 4096},
+		}
+
+		for i, download := range downloads {
+			if download.AlbumID != want[i].AlbumID || download.AlbumName != want[i].AlbumName || download.Filename != want[i].Filename || download.Size != want[i].Size {
+				t.Errorf("download %d = %+v, want %+v", i, download, want[i])
+			}
+
+			if link := linkedDownload(t, "", download.DownloadURL); link.AlbumID != download.AlbumID || link.ClientID != 1 || link.Filename != download.Filename || !link.ExpiresAt.Equal(download.ExpiresAt.Truncate(time.Second)) {
+				t.Errorf("download %d links to %+v, want its own zip until it expires", i, link)
+			}
+
+			if got := download.ExpiresAt.Sub(download.CreatedAt); got != 7*24*time.Hour {
+				t.Errorf("download %d expires %v after it was created, want 7 days", i, got)
+			}
+		}
+	})
+
+	t.Run("split zip parts stay together", func(t *testing.T) {
+		s3Client := listS3Client{objects: []s3.Object{
+			{Key: "clients/1/5/downloads/Wedding-5-1.zip", Size: 4096, LastModified: now.Add(-3 * time.Hour)},
+			{Key: "clients/1/5/downloads/Wedding-5-2.zip", Size: 4096, LastModified: now.Add(-150 * time.Minute)},
+			{Key: "clients/1/5/downloads/Wedding-5-3.zip", Size: 4096, LastModified: now.Add(-30 * time.Minute)},
+			{Key: "clients/1/6/downloads/Reception-6.zip", Size: 8192, LastModified: now.Add(-time.Hour)},
+		}}
+
+		service := NewZipService(ZipServiceConfig{
+			AlbumService:      albums,
+			Bucket:            "bucket",
+			ClientPhotoFolder: "clients",
+			ExpirationDays:    7,
+			S3Client:          s3Client,
+		})
+
+		downloads, err := service.ListClientDownloads(1)
+		if err != nil {
+			t.Fatalf("ListClientDownloads returned an error: %v", err)
+		}
+
+		got := []string{}
+
+		for _, download := range downloads {
+			got = append(got, fmt.Sprintf("%s/%d", download.Filename, download.Part))
+		}
+
+		want := []string{"Wedding-5-1.zip/1", "Wedding-5-2.zip/2", "Wedding-5-3.zip/3", "Reception-6.zip/0"}
+
+		if !slices.Equal(got, want) {
+			t.Errorf("downloads = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("all expired", func(t *testing.T) {
+		downloads, err := service.ListClientDownloads(2)
+		if err != nil {
+			t.Fatalf("ListClientDownloads returned an error: %v", err)
+		}
+
+		if len(downloads) != 0 {
+			t.Errorf("got %d downloads, want none: %+v", len(downloads), downloads)
+		}
+	})
+}
+
+func TestEstimateBundle(t *testing.T) {
+	s3Client := listS3Client{objects: []s3.Object{
+		{Key: "clients/1/5/originals/a.jpg", Size: 1000},
+		{Key: "clients/1/5/originals/b.jpg", Size: 2500},
+		{Key: "clients/1/5/originals/c.jpg", Size: 500},
+		{Key: "clients/1/5/downloads/Wedding-5.zip", Size: 4096},
+		{Key: "clients/1/6/originals/d.jpg", Size: 700},
+	}}
+
+	service := NewZipService(ZipServiceConfig{
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		S3Client:          s3Client,
+	})
+
+	tests := []struct {
+		name          string
+		album         *models.Album
+		wantFileCount int
+		wantBytes     int64
+	}{
+		{name: "album with originals", album: &models.Album{BaseModel: models.BaseModel{ID: 5}, ClientID: 1}, wantFileCount: 3, wantBytes: 4000},
+		{name: "empty album", album: &models.Album{BaseModel: models.BaseModel{ID: 8}, ClientID: 1}, wantFileCount: 0, wantBytes: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileCount, totalBytes, err := service.EstimateBundle(tt.album)
+			if err != nil {
+				t.Fatalf("EstimateBundle returned an error: %v", err)
+			}
+
+			if fileCount != tt.wantFileCount || totalBytes != tt.wantBytes {
+				t.Errorf("estimate = %d files, %d bytes; want %d files, %d bytes", fileCount, totalBytes, tt.wantFileCount, tt.wantBytes)
+			}
+		})
+	}
+}
+
+func TestZipPartNumber(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     int
+	}{
+		{filename: "Wedding-5-1.zip", want: 1},
+		{filename: "Wedding-5-12.zip", want: 12},
+		{filename: "Wedding-5.zip", want: 0},
+		{filename: "Wedding-5-0.zip", want: 0},
+		{filename: "Wedding-5-01.zip", want: 0},
+		{filename: "Wedding-5-x.zip", want: 0},
+		{filename: "Reception-6-1.zip", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			if got := zipPartNumber("Wedding-5", tt.filename); got != tt.want {
+				t.Errorf("zipPartNumber = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+zipNames returns the names of the files in a zip, failing the test if it
+can't be read.
+*/
+func zipNames(t *testing.T, data []byte) []string {
+	t.Helper()
+
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("the uploaded zip can't be read: %v", err)
+	}
+
+	result := []string{}
+
+	for _, f := range reader.File {
+		result = append(result, f.Name)
+	}
+
+	return result
+}
+
+func TestZipIsSplitIntoPartsOverTheLimit(t *testing.T) {
+	originals := map[string][]byte{
+		"clients/1/5/originals/a.jpg": bytes.Repeat([]byte{'a'}, 2000),
+		"clients/1/5/originals/b.jpg": bytes.Repeat([]byte{'b'}, 2000),
+		"clients/1/5/originals/c.jpg": bytes.Repeat([]byte{'c'}, 2000),
+		"clients/1/5/originals/d.jpg": bytes.Repeat([]byte{'d'}, 2000),
+		"clients/1/5/originals/e.jpg": bytes.Repeat([]byte{'e'}, 9000),
+		"clients/1/5/originals/f.jpg": bytes.Repeat([]byte{'f'}, 1000),
+	}
+
+	tests := []struct {
+		name      string
+		maxBytes  int64
+		wantParts map[string][]string
+	}{
+		{
+			name:     "over the limit",
+			maxBytes: 5000,
+			wantParts: map[string][]string{
+				"Wedding-5-1.zip": {"a.jpg", "b.jpg"},
+				"Wedding-5-2.zip": {"c.jpg", "d.jpg"},
+				"Wedding-5-3.zip": {"e.jpg"},
+				"Wedding-5-4.zip": {"f.jpg"},
+			},
+		},
+		{
+			name:     "under the limit",
+			maxBytes: 100000,
+			wantParts: map[string][]string{
+				"Wedding-5.zip": {"a.jpg", "b.jpg", "c.jpg", "d.jpg", "e.jpg", "f.jpg"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Client := newZipS3Client(originals)
+			close(s3Client.release)
+
+			emailSender := &recordingEmailSender{}
+
+			service := NewZipService(ZipServiceConfig{
+				BaseDownloadURL:   "https://example.com",
+				Bucket:            "bucket",
+				ClientPhotoFolder: "clients",
+				EmailSender:       emailSender,
+				MaxZipBytes:       tt.maxBytes,
+				S3Client:          s3Client,
+			})
+
+			album := &models.Album{BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Name: "Wedding"}
+			client := &models.Client{BaseModel: models.BaseModel{ID: 1}, Name: "Jane", Email: "jane@example.com", NotifyOnDownload: true}
+
+			jobID, err := service.CreateZipAsync(album, client)
+			if err != nil {
+				t.Fatalf("CreateZipAsync returned an error: %v", err)
+			}
+
+			if err = service.Shutdown(context.Background()); err != nil {
+				t.Fatalf("Shutdown returned an error: %v", err)
+			}
+
+			downloads, _ := s3Client.List("bucket", "clients/1/5/downloads")
+
+			if len(downloads.Objects) != len(tt.wantParts) {
+				t.Fatalf("got %d zips, want %d: %+v", len(downloads.Objects), len(tt.wantParts), downloads.Objects)
+			}
+
+			for filename, wantNames := range tt.wantParts {
+				if got := zipNames(t, s3Client.get("clients/1/5/downloads/"+filename)); !slices.Equal(got, wantNames) {
+					t.Errorf("%s holds %v, want %v", filename, got, wantNames)
+				}
+			}
+
+			job, _ := service.GetJob(jobID)
+
+			if len(job.DownloadURLs) != len(tt.wantParts) {
+				t.Errorf("job has %d download URLs, want %d: %v", len(job.DownloadURLs), len(tt.wantParts), job.DownloadURLs)
+			}
+
+			messages := emailSender.messages()
+
+			if len(messages) != 1 {
+				t.Fatalf("sent %d emails, want 1", len(messages))
+			}
+
+			for _, downloadURL := range job.DownloadURLs {
+				if link := linkedDownload(t, "", downloadURL); tt.wantParts[link.Filename] == nil {
+					t.Errorf("job links %s, want one of %v", link.Filename, tt.wantParts)
+				}
+
+				if !strings.Contains(messages[0].TextBody, downloadURL) {
+					t.Errorf("email does not link %s:\n%s", downloadURL, messages[0].TextBody)
+				}
+			}
+		})
+	}
+}
+
+/*
+zipFile returns the contents of name in a zip, failing the test if it isn't
+there.
+*/
+func zipFile(t *testing.T, data []byte, name string) string {
+	t.Helper()
+
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("the uploaded zip can't be read: %v", err)
+	}
+
+	rc, err := reader.Open(name)
+	if err != nil {
+		t.Fatalf("error opening %s in the zip: %v", name, err)
+	}
+
+	defer rc.Close()
+
+	body, _ := io.ReadAll(rc)
+	return string(body)
+}
+
+func TestZipManifestListsTheIncludedFiles(t *testing.T) {
+	originals := map[string][]byte{
+		"clients/1/5/originals/a.jpg": bytes.Repeat([]byte{'a'}, 2000),
+		"clients/1/5/originals/b.jpg": bytes.Repeat([]byte{'b'}, 2000),
+		"clients/1/5/originals/c.jpg": bytes.Repeat([]byte{'c'}, 2000),
+	}
+
+	tests := []struct {
+		name            string
+		includeManifest bool
+		maxBytes        int64
+		wantManifests   map[string][]string
+	}{
+		{
+			name:            "single zip",
+			includeManifest: true,
+			wantManifests:   map[string][]string{"Wedding-5.zip": {"a.jpg", "b.jpg", "c.jpg"}},
+		},
+		{
+			name:            "split zip",
+			includeManifest: true,
+			maxBytes:        5000,
+			wantManifests: map[string][]string{
+				"Wedding-5-1.zip": {"a.jpg", "b.jpg"},
+				"Wedding-5-2.zip": {"c.jpg"},
+			},
+		},
+		{
+			name:          "turned off",
+			wantManifests: map[string][]string{"Wedding-5.zip": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Client := newZipS3Client(originals)
+			close(s3Client.release)
+
+			service := NewZipService(ZipServiceConfig{
+				Bucket:            "bucket",
+				ClientPhotoFolder: "clients",
+				EmailSender:       &recordingEmailSender{},
+				IncludeManifest:   tt.includeManifest,
+				MaxZipBytes:       tt.maxBytes,
+				S3Client:          s3Client,
+			})
+
+			album := &models.Album{BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Name: "Wedding"}
+			client := &models.Client{BaseModel: models.BaseModel{ID: 1}, Name: "Jane", Email: "jane@example.com"}
+
+			if _, err := service.CreateZipAsync(album, client); err != nil {
+				t.Fatalf("CreateZipAsync returned an error: %v", err)
+			}
+
+			if err := service.Shutdown(context.Background()); err != nil {
+				t.Fatalf("Shutdown returned an error: %v", err)
+			}
+
+			for filename, wantFiles := range tt.wantManifests {
+				data := s3Client.get("clients/1/5/downloads/" + filename)
+				names := zipNames(t, data)
+
+				if wantFiles == nil {
+					if slices.Contains(names, zipManifestName) {
+						t.Errorf("%s has a manifest, want none", filename)
+					}
+
+					continue
+				}
+
+				if got := names[len(names)-1]; got != zipManifestName {
+					t.Fatalf("last entry in %s = %s, want %s", filename, got, zipManifestName)
+				}
+
+				manifest := zipFile(t, data, zipManifestName)
+
+				for _, want := range []string{"Album: Wedding", "Client: Jane", "Generated: "} {
+					if !strings.Contains(manifest, want) {
+						t.Errorf("manifest in %s is missing %q:\n%s", filename, want, manifest)
+					}
+				}
+
+				_, listing, _ := strings.Cut(manifest, "\r\n\r\n")
+
+				if got := strings.Fields(listing); !slices.Equal(got, wantFiles) {
+					t.Errorf("manifest in %s lists %v, want %v", filename, got, wantFiles)
+				}
+			}
+		})
+	}
+}
+
+/*
+favoritesAlbumService returns a fixed list of favorites. Anything else
+panics through the nil embedded interface.
+*/
+type favoritesAlbumService struct {
+	AlbumServicer
+
+	favorites []models.Favorite
+}
+
+func (s favoritesAlbumService) GetFavorites(clientID, albumID uint) ([]models.Favorite, error) {
+	return s.favorites, nil
+}
+
+func TestFavoritesGoInTheirOwnFolder(t *testing.T) {
+	originals := map[string][]byte{
+		"clients/1/5/originals/a.jpg": []byte("a"),
+		"clients/1/5/originals/b.jpg": []byte("b"),
+		"clients/1/5/originals/c.jpg": []byte("c"),
+	}
+
+	favorites := []models.Favorite{
+		{AlbumID: 5, ClientID: 1, ImagePath: "b.jpg"},
+		{AlbumID: 5, ClientID: 1, ImagePath: "deleted.jpg"},
+	}
+
+	tests := []struct {
+		name            string
+		favoritesFolder bool
+		want            []string
+	}{
+		{name: "favorites folder on", favoritesFolder: true, want: []string{"a.jpg", "favorites/b.jpg", "c.jpg", zipManifestName}},
+		{name: "favorites folder off", want: []string{"a.jpg", "b.jpg", "c.jpg", zipManifestName}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Client := newZipS3Client(originals)
+			close(s3Client.release)
+
+			service := NewZipService(ZipServiceConfig{
+				AlbumService:      favoritesAlbumService{favorites: favorites},
+				Bucket:            "bucket",
+				ClientPhotoFolder: "clients",
+				EmailSender:       &recordingEmailSender{},
+				FavoritesFolder:   tt.favoritesFolder,
+				IncludeManifest:   true,
+				S3Client:          s3Client,
+			})
+
+			album := &models.Album{BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Name: "Wedding"}
+			client := &models.Client{BaseModel: models.BaseModel{ID: 1}, Name: "Jane", Email: "jane@example.com"}
+
+			if _, err := service.CreateZipAsync(album, client); err != nil {
+				t.Fatalf("CreateZipAsync returned an error: %v", err)
+			}
+
+			if err := service.Shutdown(context.Background()); err != nil {
+				t.Fatalf("Shutdown returned an error: %v", err)
+			}
+
+			data := s3Client.get("clients/1/5/downloads/Wedding-5.zip")
+
+			if got := zipNames(t, data); !slices.Equal(got, tt.want) {
+				t.Errorf("zip holds %v, want %v", got, tt.want)
+			}
+
+			// The manifest lists each photo where it is in the zip
+			_, listing, _ := strings.Cut(zipFile(t, data, zipManifestName), "\r\n\r\n")
+
+			if got := strings.Fields(listing); !slices.Equal(got, tt.want[:len(tt.want)-1]) {
+				t.Errorf("manifest lists %v, want %v", got, tt.want[:len(tt.want)-1])
+			}
+		})
+	}
+}
+
+func TestZipEntryNamesAreUnique(t *testing.T) {
+	part := &zipPart{}
+
+	tests := []struct {
+		folder   string
+		filename string
+		want     string
+	}{
+		{filename: "a.jpg", want: "a.jpg"},
+		{folder: zipFavoritesFolder, filename: "a.jpg", want: "favorites/a.jpg"},
+		{filename: "A.JPG", want: "A-2.JPG"},
+		{filename: "a.jpg", want: "a-3.jpg"},
+		{folder: zipFavoritesFolder, filename: "a.jpg", want: "favorites/a-2.jpg"},
+		{filename: zipManifestName, want: "manifest-2.txt"},
+	}
+
+	for _, tt := range tests {
+		if got := part.entryName(tt.folder, tt.filename); got != tt.want {
+			t.Errorf("entryName(%q, %q) = %q, want %q", tt.folder, tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestResendDownloadEmail(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		objects    []s3.Object
+		wantResent bool
+		wantLinks  []string
+	}{
+		{
+			name:       "zip exists",
+			objects:    []s3.Object{{Key: "clients/1/5/downloads/Wedding-5.zip", Size: 4096, LastModified: now}},
+			wantResent: true,
+			wantLinks:  []string{"Wedding-5.zip"},
+		},
+		{
+			name: "split zip exists",
+			objects: []s3.Object{
+				{Key: "clients/1/5/downloads/Wedding-5-2.zip", Size: 4096, LastModified: now},
+				{Key: "clients/1/5/downloads/Wedding-5-1.zip", Size: 4096, LastModified: now},
+			},
+			wantResent: true,
+			wantLinks:  []string{"Wedding-5-1.zip", "Wedding-5-2.zip"},
+		},
+		{name: "no zip", objects: nil},
+		{name: "zip expired", objects: []s3.Object{{Key: "clients/1/5/downloads/Wedding-5.zip", Size: 4096, LastModified: now.AddDate(0, 0, -8)}}},
+		{name: "zip incomplete", objects: []s3.Object{{Key: "clients/1/5/downloads/Wedding-5.zip", Size: 100, LastModified: now}}},
+		{name: "split zip missing a part", objects: []s3.Object{{Key: "clients/1/5/downloads/Wedding-5-2.zip", Size: 4096, LastModified: now}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &recordingEmailSender{}
+
+			service := NewZipService(ZipServiceConfig{
+				BaseDownloadURL:   "https://example.com",
+				Bucket:            "bucket",
+				ClientPhotoFolder: "clients",
+				EmailSender:       sender,
+				EmailTemplate:     LoadEmailTemplate(nil, "", ""),
+				ExpirationDays:    7,
+				S3Client:          listS3Client{objects: tt.objects},
+			})
+
+			album := &models.Album{BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Name: "Wedding"}
+
+			// Asking for the email again sends it even with download emails turned off
+			client := &models.Client{BaseModel: models.BaseModel{ID: 1}, Name: "Jane", Email: "jane@example.com", NotifyOnDownload: false}
+
+			resent, err := service.ResendDownloadEmail(album, client)
+			if err != nil {
+				t.Fatalf("ResendDownloadEmail returned an error: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err = service.Shutdown(ctx); err != nil {
+				t.Fatalf("Shutdown returned an error: %v", err)
+			}
+
+			if resent != tt.wantResent {
+				t.Fatalf("resent = %v, want %v", resent, tt.wantResent)
+			}
+
+			sent := sender.messages()
+
+			if !tt.wantResent {
+				if len(sent) != 0 {
+					t.Errorf("sent %d emails, want none", len(sent))
+				}
+
+				return
+			}
+
+			if len(sent) != 1 {
+				t.Fatalf("sent %d emails, want 1", len(sent))
+			}
+
+			if got := linkedFilenames(t, "", sent[0].HtmlBody); !slices.Equal(got, tt.wantLinks) {
+				t.Errorf("body links %v, want %v", got, tt.wantLinks)
+			}
+		})
+	}
+}
+
+func newPrewarmTestService(s3Client *zipS3Client, sender *recordingEmailSender) (ZipService, *models.Album, *models.Client) {
+	service := NewZipService(ZipServiceConfig{
+		BaseDownloadURL:   "https://example.com",
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		EmailSender:       sender,
+		EmailTemplate:     LoadEmailTemplate(nil, "", ""),
+		ExpirationDays:    7,
+		S3Client:          s3Client,
+	})
+
+	album := &models.Album{BaseModel: models.BaseModel{ID: 5}, ClientID: 1, Name: "Wedding", AllowDownload: true, Purchased: true}
+	client := &models.Client{BaseModel: models.BaseModel{ID: 1}, Name: "Jane", Email: "jane@example.com", NotifyOnDownload: true}
+
+	return service, album, client
+}
+
+func TestPrewarmAlbum(t *testing.T) {
+	now := time.Now()
+	zipKey := "clients/1/5/downloads/Wedding-5.zip"
+	originalKey := "clients/1/5/originals/a.jpg"
+	oldZip := bytes.Repeat([]byte{'z'}, 2048)
+
+	tests := []struct {
+		name            string
+		originalAt      time.Time
+		zipAt           time.Time
+		hasZip          bool
+		wantStarted     bool
+		wantZipReplaced bool
+	}{
+		{name: "no zip yet", originalAt: now.Add(-time.Hour), wantStarted: true, wantZipReplaced: true},
+		{name: "zip is current", originalAt: now.Add(-time.Hour), zipAt: now, hasZip: true},
+		{name: "originals changed since the zip", originalAt: now, zipAt: now.Add(-time.Hour), hasZip: true, wantStarted: true, wantZipReplaced: true},
+		{name: "zip expired", originalAt: now.AddDate(0, 0, -10), zipAt: now.AddDate(0, 0, -8), hasZip: true, wantStarted: true, wantZipReplaced: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Client := newZipS3Client(nil)
+			s3Client.put(originalKey, []byte("a"), tt.originalAt)
+			close(s3Client.release)
+
+			if tt.hasZip {
+				s3Client.put(zipKey, oldZip, tt.zipAt)
+			}
+
+			sender := &recordingEmailSender{}
+			service, album, client := newPrewarmTestService(s3Client, sender)
+
+			started, err := service.PrewarmAlbum(album, client)
+			if err != nil {
+				t.Fatalf("PrewarmAlbum returned an error: %v", err)
+			}
+
+			if err = service.Shutdown(context.Background()); err != nil {
+				t.Fatalf("Shutdown returned an error: %v", err)
+			}
+
+			if started != tt.wantStarted {
+				t.Errorf("started = %v, want %v", started, tt.wantStarted)
+			}
+
+			if replaced := !bytes.Equal(s3Client.get(zipKey), oldZip); replaced != tt.wantZipReplaced {
+				t.Errorf("zip replaced = %v, want %v", replaced, tt.wantZipReplaced)
+			}
+
+			if tt.wantZipReplaced {
+				if got := zipNames(t, s3Client.get(zipKey)); !slices.Contains(got, "a.jpg") {
+					t.Errorf("prewarmed zip holds %v, want a.jpg", got)
+				}
+			}
+
+			// Nobody asked for the zip yet, so nobody is told about it
+			if got := len(sender.messages()); got != 0 {
+				t.Errorf("sent %d emails, want none", got)
+			}
+		})
+	}
+}
+
+func TestRequestingAZipBeingPrewarmedTakesItOver(t *testing.T) {
+	s3Client := newZipS3Client(map[string][]byte{"clients/1/5/originals/a.jpg": []byte("a")})
+	sender := &recordingEmailSender{}
+	service, album, client := newPrewarmTestService(s3Client, sender)
+
+	if started, err := service.PrewarmAlbum(album, client); err != nil || !started {
+		t.Fatalf("PrewarmAlbum = %v, %v, want it started", started, err)
+	}
+
+	jobID, err := service.CreateZipAsync(album, client)
+	if err != nil {
+		t.Fatalf("CreateZipAsync returned an error: %v", err)
+	}
+
+	close(s3Client.release)
+
+	if err = service.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned an error: %v", err)
+	}
+
+	job, _ := service.GetJob(jobID)
+
+	if job.State != ZipJobCompleted || job.Prewarm {
+		t.Errorf("job is %s with prewarm %v, want a completed requested job", job.State, job.Prewarm)
+	}
+
+	if got := len(sender.messages()); got != 1 {
+		t.Errorf("sent %d emails, want 1", got)
+	}
+}
+
+func TestRequestingAZipTwiceBuildsItOnce(t *testing.T) {
+	s3Client := newZipS3Client(map[string][]byte{"clients/1/5/originals/a.jpg": []byte("a")})
+	sender := &recordingEmailSender{}
+	service, album, client := newPrewarmTestService(s3Client, sender)
+
+	first, err := service.CreateZipAsync(album, client)
+	if err != nil {
+		t.Fatalf("CreateZipAsync returned an error: %v", err)
+	}
+
+	// The first build is held on its download, so it is still running
+	second, err := service.CreateZipAsync(album, client)
+	if err != nil {
+		t.Fatalf("second CreateZipAsync returned an error: %v", err)
+	}
+
+	close(s3Client.release)
+
+	if err = service.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned an error: %v", err)
+	}
+
+	if second != first {
+		t.Errorf("second job ID = %q, want the running job %q", second, first)
+	}
+
+	// Every build emails the client when it is done
+	if got := len(sender.messages()); got != 1 {
+		t.Errorf("sent %d emails, want 1 from a single build", got)
+	}
+}
+
+func TestConcurrentRequestsForAZipBuildItOnce(t *testing.T) {
+	s3Client := newZipS3Client(map[string][]byte{"clients/1/5/originals/a.jpg": []byte("a")})
+	sender := &recordingEmailSender{}
+	service, album, client := newPrewarmTestService(s3Client, sender)
+
+	const requests = 10
+
+	var (
+		wg    sync.WaitGroup
+		ready = make(chan struct{})
+		ids   = make(chan string, requests)
+	)
+
+	// Half the requests come from clients and half from the prewarmer, all at once
+	for i := range requests {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			<-ready
+
+			if i%2 == 1 {
+				if _, err := service.PrewarmAlbum(album, client); err != nil {
+					t.Errorf("PrewarmAlbum returned an error: %v", err)
+				}
+
+				return
+			}
+
+			jobID, err := service.CreateZipAsync(album, client)
+			if err != nil {
+				t.Errorf("CreateZipAsync returned an error: %v", err)
+			}
+
+			ids <- jobID
+		}()
+	}
+
+	close(ready)
+	wg.Wait()
+	close(ids)
+	close(s3Client.release)
+
+	if err := service.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned an error: %v", err)
+	}
+
+	for jobID := range ids {
+		if jobID != "Wedding-5" {
+			t.Errorf("job ID = %q, want Wedding-5", jobID)
+		}
+	}
+
+	// Every build the client asked for emails them when it is done
+	if got := len(sender.messages()); got != 1 {
+		t.Errorf("sent %d emails, want 1 from a single build", got)
+	}
+}
+
+func TestEmptyAlbumGetsNoZip(t *testing.T) {
+	s3Client := newZipS3Client(nil)
+	close(s3Client.release)
+
+	sender := &recordingEmailSender{}
+	service, album, client := newPrewarmTestService(s3Client, sender)
+
+	jobID, err := service.CreateZipAsync(album, client)
+	if err != nil {
+		t.Fatalf("CreateZipAsync returned an error: %v", err)
+	}
+
+	if err = service.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned an error: %v", err)
+	}
+
+	if job, _ := service.GetJob(jobID); job.State != ZipJobFailed || job.Error != ErrZipAlbumEmpty.Error() {
+		t.Errorf("job = %s with error %q, want it failed with %q", job.State, job.Error, ErrZipAlbumEmpty)
+	}
+
+	if s3Client.has("clients/1/5/downloads/Wedding-5.zip") {
+		t.Errorf("an empty album's zip was uploaded")
+	}
+
+	if got := len(sender.messages()); got != 0 {
+		t.Errorf("sent %d emails, want none", got)
+	}
+}
+
+func TestExistingZipIsOnlySentWhileCurrent(t *testing.T) {
+	now := time.Now()
+	zipKey := "clients/1/5/downloads/Wedding-5.zip"
+	originalKey := "clients/1/5/originals/a.jpg"
+
+	// Random bytes don't compress, so the zip is big enough to count as complete
+	photo := make([]byte, 2048)
+	_, _ = rand.NewChaCha8([32]byte{}).Read(photo)
+
+	existing := bytes.Buffer{}
+	writer := zip.NewWriter(&existing)
+	entry, _ := writer.Create("old.jpg")
+	_, _ = entry.Write(photo)
+	_ = writer.Close()
+
+	tests := []struct {
+		name        string
+		hasZip      bool
+		zipAt       time.Time
+		wantCurrent bool
+		wantNames   []string
+	}{
+		{name: "zip newer than the originals", hasZip: true, zipAt: now, wantCurrent: true, wantNames: []string{"old.jpg"}},
+		{name: "zip older than the originals", hasZip: true, zipAt: now.Add(-2 * time.Hour), wantNames: []string{"a.jpg"}},
+		{name: "zip missing", wantNames: []string{"a.jpg"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Client := newZipS3Client(nil)
+			s3Client.put(originalKey, photo, now.Add(-time.Hour))
+			s3Client.serve(t)
+			close(s3Client.release)
+
+			if tt.hasZip {
+				s3Client.put(zipKey, existing.Bytes(), tt.zipAt)
+			}
+
+			sender := &recordingEmailSender{}
+			service, album, client := newPrewarmTestService(s3Client, sender)
+
+			current, err := service.isZipCurrent(zipKey, album)
+			if err != nil {
+				t.Fatalf("isZipCurrent returned an error: %v", err)
+			}
+
+			if current != tt.wantCurrent {
+				t.Errorf("isZipCurrent = %v, want %v", current, tt.wantCurrent)
+			}
+
+			if _, err = service.CreateZipAsync(album, client); err != nil {
+				t.Fatalf("CreateZipAsync returned an error: %v", err)
+			}
+
+			if err = service.Shutdown(context.Background()); err != nil {
+				t.Fatalf("Shutdown returned an error: %v", err)
+			}
+
+			if got := zipNames(t, s3Client.get(zipKey)); !slices.Equal(got, tt.wantNames) {
+				t.Errorf("zip sent holds %v, want %v", got, tt.wantNames)
+			}
+
+			if got := len(sender.messages()); got != 1 {
+				t.Errorf("sent %d emails, want 1", got)
+			}
+		})
+	}
+}
+
+/*
+clientListService returns a fixed list of clients. Anything else panics
+through the nil embedded interface.
+*/
+type clientListService struct {
+	ClientServicer
+
+	clients []models.Client
+}
+
+func (s clientListService) GetAll() ([]models.Client, error) {
+	return s.clients, nil
+}
+
+func TestPrewarmRecentAlbums(t *testing.T) {
+	// Far from the real time, so the window can only come from the clock
+	clock := &fakeClock{now: time.Date(2025, time.March, 10, 12, 0, 0, 0, time.UTC)}
+	now := clock.now
+
+	recent := func(id uint, name string, allowDownload bool) *models.Album {
+		return &models.Album{BaseModel: models.BaseModel{ID: id, CreatedAt: now.AddDate(0, 0, -1)}, ClientID: 1, Name: name, AllowDownload: allowDownload, Purchased: true}
+	}
+
+	old := recent(7, "Engagement", true)
+	old.CreatedAt = now.AddDate(0, 0, -30)
+
+	// Random bytes don't compress, so the zip is big enough to count as complete
+	photo := make([]byte, 2048)
+	_, _ = rand.NewChaCha8([32]byte{}).Read(photo)
+
+	s3Client := newZipS3Client(map[string][]byte{
+		"clients/1/5/originals/a.jpg": photo,
+		"clients/1/6/originals/b.jpg": []byte("b"),
+		"clients/1/7/originals/c.jpg": []byte("c"),
+	})
+
+	close(s3Client.release)
+
+	sender := &recordingEmailSender{}
+
+	service := NewZipService(ZipServiceConfig{
+		AlbumService: albumListService{albums: map[uint][]*models.Album{
+			1: {recent(5, "Wedding", true), recent(6, "Proofs", false), old},
+		}},
+		BaseDownloadURL:   "https://example.com",
+		Bucket:            "bucket",
+		ClientPhotoFolder: "clients",
+		ClientService:     clientListService{clients: []models.Client{{BaseModel: models.BaseModel{ID: 1}, Name: "Jane", Email: "jane@example.com"}}},
+		Clock:             clock,
+		EmailSender:       sender,
+		S3Client:          s3Client,
+	})
+
+	built, err := service.PrewarmRecentAlbums(7)
+	if err != nil {
+		t.Fatalf("PrewarmRecentAlbums returned an error: %v", err)
+	}
+
+	if built != 1 {
+		t.Errorf("built %d zips, want 1", built)
+	}
+
+	// A second run finds the zip current and leaves it alone
+	if built, err = service.PrewarmRecentAlbums(7); err != nil || built != 0 {
+		t.Errorf("second PrewarmRecentAlbums = %d, %v, want nothing built", built, err)
+	}
+
+	if err = service.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned an error: %v", err)
+	}
+
+	wantZips := map[string]bool{
+		"clients/1/5/downloads/Wedding-5.zip":    true,
+		"clients/1/6/downloads/Proofs-6.zip":     false,
+		"clients/1/7/downloads/Engagement-7.zip": false,
+	}
+
+	for key, want := range wantZips {
+		if got := s3Client.has(key); got != want {
+			t.Errorf("%s built = %v, want %v", key, got, want)
+		}
+	}
+
+	if got := len(sender.messages()); got != 0 {
+		t.Errorf("sent %d emails, want none", got)
+	}
+}
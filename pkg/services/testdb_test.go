@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adampresleyphotography/pkg/migrations"
+	_ "github.com/glebarez/sqlite"
+	"github.com/rfberaldo/sqlz"
+	"github.com/rfberaldo/sqlz/binds"
+)
+
+/*
+newTestDB returns an in-memory SQLite database with the website's
+migrations applied, the same way the website applies them on startup.
+*/
+func newTestDB(t *testing.T) *sqlz.DB {
+	t.Helper()
+
+	binds.Register("sqlite", binds.BindByDriver("sqlite3"))
+
+	db, err := sqlz.Connect("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("error opening test database: %v", err)
+	}
+
+	// Every connection to :memory: gets its own database
+	db.Pool().SetMaxOpenConns(1)
+
+	t.Cleanup(func() {
+		_ = db.Pool().Close()
+	})
+
+	migrator := migrations.NewMigrator(migrations.MigratorConfig{
+		DB: db,
+		FS: os.DirFS(filepath.Join("..", "..", "cmd", "website", "sql-migrations")),
+	})
+
+	if _, err = migrator.Migrate(); err != nil {
+		t.Fatalf("error running migrations: %v", err)
+	}
+
+	return db
+}
+
+// mustExec runs a statement against the test database or fails the test
+func mustExec(t *testing.T, db *sqlz.DB, query string, args ...any) int64 {
+	t.Helper()
+
+	result, err := db.Exec(context.Background(), query, args...)
+	if err != nil {
+		t.Fatalf("error running %q: %v", query, err)
+	}
+
+	id, _ := result.LastInsertId()
+	return id
+}
+
+// insertTestClient adds a client and returns its ID
+func insertTestClient(t *testing.T, db *sqlz.DB, name string) uint {
+	t.Helper()
+
+	now := time.Now()
+	return uint(mustExec(t, db, `INSERT INTO clients (created_at, updated_at, name, email) VALUES (?, ?, ?, ?)`, now, now, name, strings.ToLower(name)+"@example.com"))
+}
+
+// insertTestAlbum adds an album and returns its ID. expiresAt may be nil.
+func insertTestAlbum(t *testing.T, db *sqlz.DB, clientID uint, name string, shootDate time.Time, expiresAt any) uint {
+	t.Helper()
+
+	now := time.Now()
+
+	return uint(mustExec(
+		t,
+		db,
+		`INSERT INTO albums (created_at, updated_at, name, "path", client_id, shoot_date, poster_image_path, expires_at) VALUES (?, ?, ?, '', ?, ?, '', ?)`,
+		now, now, name, clientID, shootDate, expiresAt,
+	))
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adamgokit/s3"
+	"github.com/adampresley/adamgokit/s3/deleteoptions"
+	"github.com/adampresley/adamgokit/s3/getoptions"
+	"github.com/adampresley/adamgokit/s3/geturloptions"
+	"github.com/adampresley/adamgokit/s3/listoptions"
+	"github.com/adampresley/adamgokit/s3/putoptions"
+)
+
+/*
+zipS3Client is an in-memory bucket for exercising zip jobs. Downloads block
+until release is closed, or their context is done, so tests control when a
+job can finish. Each download then takes getDelay, and the most downloads
+seen running at once is kept in maxInFlight. Streamed uploads only land in
+the bucket if they complete before their context is done, and are listed as
+modified when they land. Objects can be fetched over HTTP once serve is
+called. Anything else panics through the nil embedded interface.
+*/
+type zipS3Client struct {
+	s3.S3Client
+
+	getDelay time.Duration
+	release  chan struct{}
+	url      string
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	modified    map[string]time.Time
+	objects     map[string][]byte
+}
+
+func newZipS3Client(originals map[string][]byte) *zipS3Client {
+	objects := map[string][]byte{}
+
+	for key, data := range originals {
+		objects[key] = data
+	}
+
+	return &zipS3Client{
+		modified: map[string]time.Time{},
+		objects:  objects,
+		release:  make(chan struct{}),
+	}
+}
+
+func (c *zipS3Client) Delete(bucket string, keys []string, options ...deleteoptions.DeleteOption) (s3.DeleteResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		delete(c.objects, key)
+		delete(c.modified, key)
+	}
+
+	return s3.DeleteResponse{DeletedKeys: keys}, nil
+}
+
+func (c *zipS3Client) Get(bucket, key string, options ...getoptions.GetOption) (s3.GetObjectResponse, error) {
+	o := &getoptions.GetOptions{Context: context.Background()}
+
+	for _, option := range options {
+		option(o)
+	}
+
+	c.mu.Lock()
+	c.inFlight++
+	c.maxInFlight = max(c.maxInFlight, c.inFlight)
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}()
+
+	select {
+	case <-c.release:
+	case <-o.Context.Done():
+		return s3.GetObjectResponse{}, o.Context.Err()
+	}
+
+	time.Sleep(c.getDelay)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return s3.GetObjectResponse{Body: io.NopCloser(bytes.NewReader(c.objects[key]))}, nil
+}
+
+func (c *zipS3Client) List(bucket, path string, options ...listoptions.ListOption) (s3.ListResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := s3.ListResponse{}
+
+	for key, data := range c.objects {
+		if strings.HasPrefix(key, path) {
+			result.Objects = append(result.Objects, s3.Object{Key: key, LastModified: c.modified[key], Size: int64(len(data))})
+		}
+	}
+
+	sort.Slice(result.Objects, func(i, j int) bool {
+		return result.Objects[i].Key < result.Objects[j].Key
+	})
+
+	result.NumObjects = len(result.Objects)
+	return result, nil
+}
+
+func (c *zipS3Client) PutStream(bucket, key string, options ...putoptions.PutOption) (s3.PutStreamResponse, error) {
+	o := &putoptions.PutOptions{Context: context.Background()}
+
+	for _, option := range options {
+		option(o)
+	}
+
+	reader, writer := io.Pipe()
+	done := make(chan error, 1)
+
+	go func() {
+		data, err := io.ReadAll(reader)
+
+		if err == nil {
+			err = o.Context.Err()
+		}
+
+		if err == nil {
+			c.mu.Lock()
+			c.objects[key] = data
+			c.modified[key] = time.Now()
+			c.mu.Unlock()
+		}
+
+		done <- err
+	}()
+
+	return s3.PutStreamResponse{
+		Writer: writer,
+		Wait: func() (s3.PutObjectResponse, error) {
+			return s3.PutObjectResponse{}, <-done
+		},
+	}, nil
+}
+
+// StatObject describes key, or returns nil when it isn't in the bucket
+func (c *zipS3Client) StatObject(bucket, key string) (*s3.ObjectMetadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, ok := c.objects[key]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &s3.ObjectMetadata{LastModified: c.modified[key], Size: int64(len(data))}, nil
+}
+
+// GetUrl links to key on the server started by serve
+func (c *zipS3Client) GetUrl(bucket, key string, options ...geturloptions.GetUrlOption) (string, error) {
+	return c.url + "/" + key, nil
+}
+
+// serve makes the bucket's objects downloadable over HTTP until the test ends
+func (c *zipS3Client) serve(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/")
+
+		if !c.has(key) {
+			http.NotFound(w, r)
+			return
+		}
+
+		http.ServeContent(w, r, path.Base(key), time.Time{}, bytes.NewReader(c.get(key)))
+	}))
+
+	t.Cleanup(server.Close)
+	c.url = server.URL
+}
+
+func (c *zipS3Client) get(key string) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.objects[key]
+}
+
+// put stores data at key, listed as last modified at modified
+func (c *zipS3Client) put(key string, data []byte, modified time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.objects[key] = data
+	c.modified[key] = modified
+}
+
+func (c *zipS3Client) mostInFlight() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.maxInFlight
+}
+
+func (c *zipS3Client) has(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.objects[key]
+	return ok
+}